@@ -7,6 +7,15 @@ roscore &
 go install github.com/fetchrobotics/rosgo/gengo
 go generate github.com/fetchrobotics/rosgo/test/test_message
 go test github.com/fetchrobotics/rosgo/xmlrpc
+go test github.com/fetchrobotics/rosgo/yaml
+go test github.com/fetchrobotics/rosgo/master
+go test github.com/fetchrobotics/rosgo/rosapi
+go test github.com/fetchrobotics/rosgo/dynamic
+go test github.com/fetchrobotics/rosgo/rosbag
 go test github.com/fetchrobotics/rosgo/ros
+go test github.com/fetchrobotics/rosgo/cmd/gorostopic
+go test github.com/fetchrobotics/rosgo/cmd/gorosservice
+go test github.com/fetchrobotics/rosgo/cmd/gorosnode
+go test github.com/fetchrobotics/rosgo/cmd/gorosbag
 go test github.com/fetchrobotics/rosgo/test/test_message
 
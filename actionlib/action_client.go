@@ -41,7 +41,7 @@ func newDefaultActionClient(node ros.Node, action string, actType ActionType) *d
 		actionGoal:     actType.GoalType(),
 		logger:         node.Logger(),
 		statusReceived: false,
-		goalIDGen:      newGoalIDGenerator(node.Name()),
+		goalIDGen:      newGoalIDGenerator(node.Name(), node.Clock()),
 	}
 
 	ac.goalPub = node.NewPublisher(fmt.Sprintf("%s/goal", action), actType.GoalType())
@@ -59,8 +59,8 @@ func (ac *defaultActionClient) SendGoal(goal ros.Message, transitionCb, feedback
 	}
 
 	ag := ac.actionType.GoalType().NewMessage().(ActionGoal)
-	goalID := actionlib_msgs.GoalID{Id: ac.goalIDGen.generateID(), Stamp: ros.Now()}
-	header := std_msgs.Header{Stamp: ros.Now()}
+	goalID := actionlib_msgs.GoalID{Id: ac.goalIDGen.generateID(), Stamp: ac.node.Now()}
+	header := std_msgs.Header{Stamp: ac.node.Now()}
 
 	ag.SetGoal(goal)
 	ag.SetGoalId(goalID)
@@ -123,8 +123,8 @@ func (ac *defaultActionClient) PublishCancel(cancel *actionlib_msgs.GoalID) {
 func (ac *defaultActionClient) WaitForServer(timeout ros.Duration) bool {
 	started := false
 	ac.logger.Info("[ActionClient] Waiting action server to start")
-	rate := ros.CycleTime(ros.NewDuration(0, 10000000))
-	waitStart := ros.Now()
+	rate := ros.CycleTime(ros.NewDuration(0, 10000000), ros.RateClock(ac.node.Clock()))
+	waitStart := ac.node.Now()
 
 LOOP:
 	for !started {
@@ -135,7 +135,7 @@ LOOP:
 		sPubs := ac.statusSub.GetNumPublishers()
 		started = (gSubs > 0 && cSubs > 0 && fPubs > 0 && rPubs > 0 && sPubs > 0)
 
-		now := ros.Now()
+		now := ac.node.Now()
 		diff := now.Diff(waitStart)
 		if !timeout.IsZero() && diff.Cmp(timeout) >= 0 {
 			break LOOP
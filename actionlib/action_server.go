@@ -55,7 +55,7 @@ func newDefaultActionServer(node ros.Node, action string, actType ActionType, go
 		handlersTimeout: ros.NewDuration(60, 0),
 		goalCallback:    goalCb,
 		cancelCallback:  cancelCb,
-		lastCancel:      ros.Now(),
+		lastCancel:      node.Now(),
 	}
 }
 
@@ -64,7 +64,7 @@ func (as *defaultActionServer) init() {
 	as.shutdownChan = make(chan struct{}, 10)
 
 	// setup goal id generator and goal handlers
-	as.goalIDGen = newGoalIDGenerator(as.node.Name())
+	as.goalIDGen = newGoalIDGenerator(as.node.Name(), as.node.Clock())
 	as.handlers = map[string]*serverGoalHandler{}
 
 	// setup action result type so that we can create default result messages
@@ -72,7 +72,7 @@ func (as *defaultActionServer) init() {
 	as.actionResultType = res.Type()
 
 	// get frequency from ros params
-	as.statusFrequency = ros.NewRate(5.0)
+	as.statusFrequency = ros.NewRate(5.0, ros.RateClock(as.node.Clock()))
 
 	// get queue sizes from ros params
 	// queue sizes not implemented by ros.Node yet
@@ -120,7 +120,7 @@ func (as *defaultActionServer) Start() {
 // PublishResult publishes action result message
 func (as *defaultActionServer) PublishResult(status actionlib_msgs.GoalStatus, result ros.Message) {
 	msg := as.actionResult.NewMessage().(ActionResult)
-	msg.SetHeader(std_msgs.Header{Stamp: ros.Now()})
+	msg.SetHeader(std_msgs.Header{Stamp: as.node.Now()})
 	msg.SetStatus(status)
 	msg.SetResult(result)
 	as.resultPub.Publish(msg)
@@ -129,7 +129,7 @@ func (as *defaultActionServer) PublishResult(status actionlib_msgs.GoalStatus, r
 // PublishFeedback publishes action feedback messages
 func (as *defaultActionServer) PublishFeedback(status actionlib_msgs.GoalStatus, feedback ros.Message) {
 	msg := as.actionFeedback.NewMessage().(ActionFeedback)
-	msg.SetHeader(std_msgs.Header{Stamp: ros.Now()})
+	msg.SetHeader(std_msgs.Header{Stamp: as.node.Now()})
 	msg.SetStatus(status)
 	msg.SetFeedback(feedback)
 	as.feedbackPub.Publish(msg)
@@ -145,7 +145,7 @@ func (as *defaultActionServer) getStatus() *actionlib_msgs.GoalStatusArray {
 			handlerTime := gh.GetHandlerDestructionTime()
 			destroyTime := handlerTime.Add(as.handlersTimeout)
 
-			if !handlerTime.IsZero() && destroyTime.Cmp(ros.Now()) <= 0 {
+			if !handlerTime.IsZero() && destroyTime.Cmp(as.node.Now()) <= 0 {
 				delete(as.handlers, id)
 				continue
 			}
@@ -155,7 +155,7 @@ func (as *defaultActionServer) getStatus() *actionlib_msgs.GoalStatusArray {
 	}
 
 	goalStatus := &actionlib_msgs.GoalStatusArray{}
-	goalStatus.Header.Stamp = ros.Now()
+	goalStatus.Header.Stamp = as.node.Now()
 	goalStatus.StatusList = statusList
 	return goalStatus
 }
@@ -200,7 +200,7 @@ func (as *defaultActionServer) internalCancelCallback(goalID *actionlib_msgs.Goa
 	if goalID.Id != "" && !goalFound {
 		gh := newServerGoalHandlerWithGoalId(as, goalID)
 		as.handlers[goalID.Id] = gh
-		gh.SetHandlerDestructionTime(ros.Now())
+		gh.SetHandlerDestructionTime(as.node.Now())
 	}
 
 	if goalID.Stamp.Cmp(as.lastCancel) > 0 {
@@ -228,7 +228,7 @@ func (as *defaultActionServer) internalGoalCallback(goal ActionGoal, event ros.M
 				as.PublishResult(st, result)
 			}
 
-			gh.SetHandlerDestructionTime(ros.Now())
+			gh.SetHandlerDestructionTime(as.node.Now())
 			return
 		}
 	}
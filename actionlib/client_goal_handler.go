@@ -124,7 +124,7 @@ func (gh *clientGoalHandler) Cancel() error {
 	}
 
 	cancelMsg := &actionlib_msgs.GoalID{
-		Stamp: ros.Now(),
+		Stamp: gh.actionClient.node.Now(),
 		Id:    gh.actionGoalID}
 
 	gh.actionClient.cancelPub.Publish(cancelMsg)
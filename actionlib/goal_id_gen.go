@@ -11,11 +11,13 @@ type goalIDGenerator struct {
 	goals      int
 	goalsMutex sync.RWMutex
 	nodeName   string
+	clock      ros.Clock
 }
 
-func newGoalIDGenerator(nodeName string) *goalIDGenerator {
+func newGoalIDGenerator(nodeName string, clock ros.Clock) *goalIDGenerator {
 	return &goalIDGenerator{
 		nodeName: nodeName,
+		clock:    clock,
 	}
 }
 
@@ -25,6 +27,6 @@ func (g *goalIDGenerator) generateID() string {
 
 	g.goals++
 
-	timeNow := ros.Now()
+	timeNow := g.clock.Now()
 	return fmt.Sprintf("%s-%d-%d-%d", g.nodeName, g.goals, timeNow.Sec, timeNow.NSec)
 }
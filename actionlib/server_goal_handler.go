@@ -11,6 +11,7 @@ import (
 
 type serverGoalHandler struct {
 	as                     ActionServer
+	clock                  ros.Clock
 	sm                     *serverStateMachine
 	goal                   ActionGoal
 	handlerDestructionTime ros.Time
@@ -19,19 +20,30 @@ type serverGoalHandler struct {
 
 func newServerGoalHandlerWithGoal(as ActionServer, goal ActionGoal) *serverGoalHandler {
 	return &serverGoalHandler{
-		as:   as,
-		sm:   newServerStateMachine(goal.GetGoalId()),
-		goal: goal,
+		as:    as,
+		clock: serverClock(as),
+		sm:    newServerStateMachine(goal.GetGoalId()),
+		goal:  goal,
 	}
 }
 
 func newServerGoalHandlerWithGoalId(as ActionServer, goalID *actionlib_msgs.GoalID) *serverGoalHandler {
 	return &serverGoalHandler{
-		as: as,
-		sm: newServerStateMachine(*goalID),
+		as:    as,
+		clock: serverClock(as),
+		sm:    newServerStateMachine(*goalID),
 	}
 }
 
+// serverClock returns the clock of the node of an action server, or the
+// wall clock for other implementations.
+func serverClock(as ActionServer) ros.Clock {
+	if s, ok := as.(*defaultActionServer); ok {
+		return s.node.Clock()
+	}
+	return ros.NewWallClock()
+}
+
 func (gh *serverGoalHandler) GetHandlerDestructionTime() ros.Time {
 	gh.handlerMutex.RLock()
 	defer gh.handlerMutex.RUnlock()
@@ -72,7 +84,7 @@ func (gh *serverGoalHandler) SetCancelled(result ros.Message, text string) error
 			" or recalling state, it is currently in state: %d", status.Status)
 	}
 
-	gh.SetHandlerDestructionTime(ros.Now())
+	gh.SetHandlerDestructionTime(gh.clock.Now())
 	gh.as.PublishResult(status, result)
 
 	return nil
@@ -89,7 +101,7 @@ func (gh *serverGoalHandler) SetRejected(result ros.Message, text string) error
 			"or recalling state, it is currently in state: %d", status.Status)
 	}
 
-	gh.SetHandlerDestructionTime(ros.Now())
+	gh.SetHandlerDestructionTime(gh.clock.Now())
 	gh.as.PublishResult(status, result)
 
 	return nil
@@ -106,7 +118,7 @@ func (gh *serverGoalHandler) SetAborted(result ros.Message, text string) error {
 			"or recalling state, it is currently in state: %d", status.Status)
 	}
 
-	gh.SetHandlerDestructionTime(ros.Now())
+	gh.SetHandlerDestructionTime(gh.clock.Now())
 	gh.as.PublishResult(status, result)
 
 	return nil
@@ -123,7 +135,7 @@ func (gh *serverGoalHandler) SetSucceeded(result ros.Message, text string) error
 			"or recalling state, it is currently in state: %d", status.Status)
 	}
 
-	gh.SetHandlerDestructionTime(ros.Now())
+	gh.SetHandlerDestructionTime(gh.clock.Now())
 	gh.as.PublishResult(status, result)
 
 	return nil
@@ -138,7 +150,7 @@ func (gh *serverGoalHandler) SetCancelRequested() bool {
 		return false
 	}
 
-	gh.SetHandlerDestructionTime(ros.Now())
+	gh.SetHandlerDestructionTime(gh.clock.Now())
 	return true
 }
 
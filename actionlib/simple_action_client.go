@@ -70,7 +70,7 @@ func (sc *simpleActionClient) WaitForResult(timeout ros.Duration) bool {
 		return false
 	}
 
-	waitStart := ros.Now()
+	waitStart := sc.ac.node.Now()
 	waitStart = waitStart.Add(timeout)
 
 LOOP:
@@ -81,7 +81,7 @@ LOOP:
 		case <-time.After(100 * time.Millisecond):
 		}
 
-		if !timeout.IsZero() && waitStart.Cmp(ros.Now()) <= 0 {
+		if !timeout.IsZero() && waitStart.Cmp(sc.ac.node.Now()) <= 0 {
 			break LOOP
 		}
 	}
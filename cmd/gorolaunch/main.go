@@ -0,0 +1,188 @@
+// gorolaunch starts the nodes described by roslaunch XML files. It is a
+// roslaunch replacement for local machines; it starts an embedded master
+// when none is running.
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/rosapi"
+	"github.com/fetchrobotics/rosgo/roslaunch"
+	"github.com/fetchrobotics/rosgo/yaml"
+)
+
+const usage = `USAGE: gorolaunch [options] <package> <file.launch> [arg:=value...]
+       gorolaunch [options] <file.launch> [arg:=value...]
+
+Options:
+	-nodes	print the names of the nodes and exit
+	-params	print the parameters and exit
+	-wait	wait for a master instead of starting one
+	-timeout duration	time given to nodes to exit after being interrupted
+`
+
+const defaultMasterURI = "http://localhost:11311"
+
+func main() {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr, stop))
+}
+
+func run(args []string, stdout, stderr io.Writer, stop <-chan struct{}) int {
+	if err := launch(args, stdout, stderr, stop); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func launch(args []string, stdout, stderr io.Writer, stop <-chan struct{}) error {
+	fs := cli.NewFlagSet("gorolaunch")
+	nodes := fs.Bool("nodes", false, "print the names of the nodes")
+	params := fs.Bool("params", false, "print the parameters")
+	wait := fs.Bool("wait", false, "wait for a master")
+	timeout := fs.Duration("timeout", roslaunch.DefaultShutdownTimeout, "time given to nodes to exit")
+	positional, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, usage)
+	}
+	launchArgs := map[string]string{}
+	var files []string
+	for _, arg := range positional {
+		if i := strings.Index(arg, ":="); i >= 0 {
+			if !strings.HasPrefix(arg, "__") {
+				launchArgs[arg[:i]] = arg[i+2:]
+			}
+		} else {
+			files = append(files, arg)
+		}
+	}
+	filename, err := launchFile(files)
+	if err != nil {
+		return err
+	}
+	config, err := roslaunch.Load(filename, launchArgs)
+	if err != nil {
+		return err
+	}
+	if *nodes {
+		for _, n := range config.Nodes {
+			fmt.Fprintln(stdout, n.Name)
+		}
+		return nil
+	}
+	if *params {
+		for _, name := range config.ParamNames() {
+			value, err := yaml.Marshal(config.Params[name])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s: %s", name, value)
+		}
+		return nil
+	}
+
+	masterURI := cli.MasterURI(positional)
+	if masterURI == "" {
+		masterURI = defaultMasterURI
+	}
+	if _, err := rosapi.NewMasterClient(masterURI, "/roslaunch").GetPid(); err != nil {
+		if *wait {
+			if err := waitForMaster(masterURI, stop); err != nil {
+				return err
+			}
+		} else {
+			u, err := url.Parse(masterURI)
+			if err != nil {
+				return err
+			}
+			m, err := master.NewMaster(u.Host)
+			if err != nil {
+				return err
+			}
+			defer m.Shutdown()
+			masterURI = m.URI()
+			fmt.Fprintf(stdout, "started master at %s\n", masterURI)
+		}
+	}
+
+	runner := roslaunch.NewRunner(config,
+		roslaunch.RunnerMasterURI(masterURI),
+		roslaunch.RunnerOutput(stdout, stderr),
+		roslaunch.RunnerShutdownTimeout(*timeout))
+	if err := runner.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- runner.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-stop:
+		fmt.Fprintln(stdout, "shutting down processing monitor...")
+		runner.Shutdown()
+		return <-done
+	}
+}
+
+// launchFile returns the launch file given as a path or as a package and
+// the name of a file of this package.
+func launchFile(files []string) (string, error) {
+	switch len(files) {
+	case 1:
+		return files[0], nil
+	case 2:
+		if _, err := os.Stat(files[0]); err == nil {
+			return "", fmt.Errorf("only one launch file is supported\n%s", usage)
+		}
+		dir, err := roslaunch.FindPackage(filepath.SplitList(os.Getenv("ROS_PACKAGE_PATH")), files[0])
+		if err != nil {
+			return "", err
+		}
+		var found string
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && found == "" && !info.IsDir() && info.Name() == files[1] {
+				found = path
+			}
+			return nil
+		})
+		if found == "" {
+			return "", fmt.Errorf("%s not found in package %s", files[1], files[0])
+		}
+		return found, nil
+	}
+	return "", fmt.Errorf("%s", usage)
+}
+
+// waitForMaster waits until the master answers.
+func waitForMaster(masterURI string, stop <-chan struct{}) error {
+	client := rosapi.NewMasterClient(masterURI, "/roslaunch")
+	for {
+		if _, err := client.GetPid(); err == nil {
+			return nil
+		}
+		select {
+		case <-stop:
+			return fmt.Errorf("interrupted while waiting for the master at %s", masterURI)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLaunch = `<launch>
+  <arg name="robot" default="r2"/>
+  <param name="rate" value="10"/>
+  <group ns="$(arg robot)">
+    <rosparam>limits: {speed: 1.5}</rosparam>
+    <node pkg="demo" type="spin.sh" name="driver"/>
+  </group>
+  <node pkg="demo" type="done.sh" name="done" required="true"/>
+</launch>
+`
+
+func TestLaunch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorolaunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, content := range map[string]string{
+		"demo/package.xml":         "<package/>",
+		"demo/launch/robot.launch": testLaunch,
+		"demo/scripts/spin.sh":     "#!/bin/sh\nexec sleep 30\n",
+		"demo/scripts/done.sh":     "#!/bin/sh\nsleep 0.3\n",
+	} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Setenv("ROS_PACKAGE_PATH", dir)
+	defer os.Unsetenv("ROS_PACKAGE_PATH")
+	os.Setenv("ROS_LOG_DIR", filepath.Join(dir, "log"))
+	defer os.Unsetenv("ROS_LOG_DIR")
+
+	runCommand := func(args ...string) (string, int) {
+		var out bytes.Buffer
+		code := run(args, &out, &out, make(chan struct{}))
+		return out.String(), code
+	}
+	if out, code := runCommand("-nodes", "demo", "robot.launch", "robot:=c3"); code != 0 || out != "/c3/driver\n/done\n" {
+		t.Errorf("unexpected nodes %q (%d)", out, code)
+	}
+	if out, code := runCommand("-params", filepath.Join(dir, "demo/launch/robot.launch")); code != 0 || out != "/r2/limits/speed: 1.5\n/rate: 10\n" {
+		t.Errorf("unexpected parameters %q (%d)", out, code)
+	}
+	if _, code := runCommand("demo", "missing.launch"); code == 0 {
+		t.Error("expected a failure for a missing launch file")
+	}
+
+	// The required node exits after a while and the driver is stopped.
+	start := time.Now()
+	out, code := runCommand("demo", "robot.launch", "__master:=http://127.0.0.1:0")
+	if code == 0 || !strings.Contains(out, "required node /done exited") {
+		t.Errorf("expected the required node to stop the launch but %q (%d)", out, code)
+	}
+	for _, line := range []string{"started master at", "process[/r2/driver]: started with pid", "[/r2/driver] killing on exit"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected the output to contain %q but\n%s", line, out)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("the launch took %v to stop", elapsed)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+const exportUsage = "usage: gorosbag export [-f csv|jsonl] [-o dir] [--topics topics] [-s start] [-u duration] <bag>"
+
+// exportFile is the file of a topic and message type.
+type exportFile struct {
+	path   string
+	file   *os.File
+	buf    *bufio.Writer
+	csv    *csv.Writer
+	count  int
+	header bool
+}
+
+// exportName returns the file name of a topic, such as odom_filtered.csv for
+// /odom/filtered.
+func exportName(topic string, index int, format string) string {
+	name := strings.Replace(strings.Trim(topic, "/"), "/", "_", -1)
+	if index > 1 {
+		name += "_" + strconv.Itoa(index)
+	}
+	return name + "." + format
+}
+
+func formatStamp(t ros.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Sec, t.NSec)
+}
+
+// flatten lists the columns of a message for CSV. Nested messages, times and
+// durations are expanded while arrays are single JSON columns.
+func flatten(prefix string, value interface{}, columns, values *[]string) {
+	switch v := value.(type) {
+	case *dynamic.Message:
+		for _, f := range v.Type().Fields() {
+			flatten(prefix+f.Name+".", v.Data[f.Name], columns, values)
+		}
+		return
+	case ros.Time:
+		*columns = append(*columns, prefix+"secs", prefix+"nsecs")
+		*values = append(*values, strconv.FormatUint(uint64(v.Sec), 10), strconv.FormatUint(uint64(v.NSec), 10))
+		return
+	case ros.Duration:
+		*columns = append(*columns, prefix+"secs", prefix+"nsecs")
+		*values = append(*values, strconv.FormatUint(uint64(v.Sec), 10), strconv.FormatUint(uint64(v.NSec), 10))
+		return
+	}
+	*columns = append(*columns, strings.TrimSuffix(prefix, "."))
+	switch v := value.(type) {
+	case string:
+		*values = append(*values, v)
+	case float32:
+		*values = append(*values, strconv.FormatFloat(float64(v), 'g', -1, 32))
+	case float64:
+		*values = append(*values, strconv.FormatFloat(v, 'g', -1, 64))
+	default:
+		*values = append(*values, string(dynamic.ToJSON(v)))
+	}
+}
+
+func (f *exportFile) write(t ros.Time, msg *dynamic.Message) error {
+	f.count++
+	if f.csv == nil {
+		_, err := fmt.Fprintf(f.buf, `{"time":%s,"message":%s}`+"\n", formatStamp(t), dynamic.ToJSON(msg))
+		return err
+	}
+	columns := []string{"time"}
+	values := []string{formatStamp(t)}
+	flatten("", msg, &columns, &values)
+	if !f.header {
+		f.header = true
+		if err := f.csv.Write(columns); err != nil {
+			return err
+		}
+	}
+	return f.csv.Write(values)
+}
+
+func (f *exportFile) close() error {
+	if f.csv != nil {
+		f.csv.Flush()
+		if err := f.csv.Error(); err != nil {
+			f.file.Close()
+			return err
+		}
+	}
+	if err := f.buf.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+func (c *command) export(args []string) error {
+	fs := cli.NewFlagSet("export")
+	format := fs.String("f", "csv", "output format, csv or jsonl")
+	outputDir := fs.String("o", ".", "directory of the exported files")
+	sel := selectionFlags(fs)
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, exportUsage)
+	}
+	if len(args) != 1 {
+		return fmt.Errorf(exportUsage)
+	}
+	if *format != "csv" && *format != "jsonl" {
+		return fmt.Errorf("unsupported format %q\n%s", *format, exportUsage)
+	}
+	r, err := openBag(args[0])
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	options, err := sel.options(r)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*outputDir, 0755); err != nil {
+		return err
+	}
+
+	// Files are keyed by topic and MD5 sum, since a topic may change type.
+	files := map[string]*exportFile{}
+	var order []*exportFile
+	perTopic := map[string]int{}
+	closeAll := func() error {
+		var first error
+		for _, f := range order {
+			if err := f.close(); err != nil && first == nil {
+				first = err
+			}
+		}
+		return first
+	}
+	ctx := dynamic.NewContextFromEnv()
+	it := r.Messages(options...)
+	for it.Next() {
+		m := it.Message()
+		key := m.Connection.Topic + "\x00" + m.Connection.MD5Sum
+		f, ok := files[key]
+		if !ok {
+			perTopic[m.Connection.Topic]++
+			path := filepath.Join(*outputDir, exportName(m.Connection.Topic, perTopic[m.Connection.Topic], *format))
+			file, err := os.Create(path)
+			if err != nil {
+				closeAll()
+				return err
+			}
+			f = &exportFile{path: path, file: file, buf: bufio.NewWriter(file)}
+			if *format == "csv" {
+				f.csv = csv.NewWriter(f.buf)
+			}
+			files[key] = f
+			order = append(order, f)
+		}
+		msg, err := decodeMessage(ctx, m)
+		if err == nil {
+			err = f.write(m.Time, msg)
+		}
+		if err != nil {
+			closeAll()
+			return err
+		}
+	}
+	if err := it.Err(); err != nil {
+		closeAll()
+		return err
+	}
+	if err := closeAll(); err != nil {
+		return err
+	}
+	for _, f := range order {
+		fmt.Fprintf(c.out, "Wrote %d messages to %s\n", f.count, f.path)
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// expression is a filter written with the Go syntax, such as
+// `topic == "/odom" && m.pose.pose.position.x > 1.5 && t < 1600000000`.
+// topic is the name of the topic, t the time of the message in seconds and
+// m the decoded message. Times and durations compare as seconds, and len
+// returns the length of arrays and strings.
+type expression struct {
+	root ast.Expr
+}
+
+// exprEnv gives the variables of an expression. The message is decoded only
+// when the expression uses it, and at most once.
+type exprEnv struct {
+	topic   string
+	time    ros.Time
+	message func() (*dynamic.Message, error)
+	decoded *dynamic.Message
+	err     error
+}
+
+func (env *exprEnv) decode() (*dynamic.Message, error) {
+	if env.decoded == nil && env.err == nil {
+		env.decoded, env.err = env.message()
+	}
+	return env.decoded, env.err
+}
+
+func parseExpression(s string) (*expression, error) {
+	root, err := parser.ParseExpr(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression: %v", err)
+	}
+	return &expression{root}, nil
+}
+
+// match evaluates the expression, which must be a boolean.
+func (e *expression) match(env *exprEnv) (bool, error) {
+	v, err := eval(e.root, env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression is not a boolean: %v", v)
+	}
+	return b, nil
+}
+
+func eval(node ast.Expr, env *exprEnv) (interface{}, error) {
+	switch n := node.(type) {
+	case *ast.ParenExpr:
+		return eval(n.X, env)
+	case *ast.BasicLit:
+		return evalLiteral(n)
+	case *ast.Ident:
+		switch n.Name {
+		case "topic":
+			return env.topic, nil
+		case "t":
+			return env.time, nil
+		case "m":
+			return env.decode()
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		return nil, fmt.Errorf("unknown name %s", n.Name)
+	case *ast.SelectorExpr:
+		x, err := eval(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		return selectField(x, n.Sel.Name)
+	case *ast.IndexExpr:
+		x, err := eval(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		index, err := eval(n.Index, env)
+		if err != nil {
+			return nil, err
+		}
+		return selectIndex(x, index)
+	case *ast.CallExpr:
+		if fn, ok := n.Fun.(*ast.Ident); !ok || fn.Name != "len" || len(n.Args) != 1 {
+			return nil, fmt.Errorf("unsupported call, only len(x) is available")
+		}
+		x, err := eval(n.Args[0], env)
+		if err != nil {
+			return nil, err
+		}
+		switch v := x.(type) {
+		case string:
+			return float64(len(v)), nil
+		case []byte:
+			return float64(len(v)), nil
+		case []interface{}:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("len of a value without length")
+	case *ast.UnaryExpr:
+		x, err := eval(n.X, env)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case token.NOT:
+			if b, ok := x.(bool); ok {
+				return !b, nil
+			}
+		case token.SUB:
+			if f, ok := toNumber(x); ok {
+				return -f, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid operand of %s: %v", n.Op, x)
+	case *ast.BinaryExpr:
+		return evalBinary(n, env)
+	}
+	return nil, fmt.Errorf("unsupported expression %T", node)
+}
+
+func evalLiteral(n *ast.BasicLit) (interface{}, error) {
+	switch n.Kind {
+	case token.INT, token.FLOAT:
+		return strconv.ParseFloat(n.Value, 64)
+	case token.STRING:
+		return strconv.Unquote(n.Value)
+	case token.CHAR:
+		s, err := strconv.Unquote(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		return float64([]rune(s)[0]), nil
+	}
+	return nil, fmt.Errorf("unsupported literal %s", n.Value)
+}
+
+func selectField(x interface{}, name string) (interface{}, error) {
+	switch v := x.(type) {
+	case *dynamic.Message:
+		value, ok := v.Data[name]
+		if !ok {
+			return nil, fmt.Errorf("%s has no field %s", v.Type().Name(), name)
+		}
+		return value, nil
+	case ros.Time:
+		return temporalField(v.Sec, v.NSec, name)
+	case ros.Duration:
+		return temporalField(v.Sec, v.NSec, name)
+	}
+	return nil, fmt.Errorf("cannot select %s in %v", name, x)
+}
+
+func temporalField(sec, nsec uint32, name string) (interface{}, error) {
+	switch name {
+	case "secs":
+		return float64(sec), nil
+	case "nsecs":
+		return float64(nsec), nil
+	}
+	return nil, fmt.Errorf("time has no field %s", name)
+}
+
+func selectIndex(x, index interface{}) (interface{}, error) {
+	f, ok := toNumber(index)
+	if !ok || f != float64(int(f)) {
+		return nil, fmt.Errorf("invalid index %v", index)
+	}
+	i := int(f)
+	var n int
+	switch v := x.(type) {
+	case []interface{}:
+		n = len(v)
+	case []byte:
+		n = len(v)
+	default:
+		return nil, fmt.Errorf("cannot index %v", x)
+	}
+	if i < 0 {
+		i += n
+	}
+	if i < 0 || i >= n {
+		return nil, fmt.Errorf("index %d out of range", int(f))
+	}
+	if v, ok := x.([]byte); ok {
+		return v[i], nil
+	}
+	return x.([]interface{})[i], nil
+}
+
+// toNumber converts numeric values, times and durations to float64.
+func toNumber(x interface{}) (float64, bool) {
+	switch v := x.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case ros.Time:
+		return v.ToSec(), true
+	case ros.Duration:
+		return v.ToSec(), true
+	}
+	return 0, false
+}
+
+func evalBinary(n *ast.BinaryExpr, env *exprEnv) (interface{}, error) {
+	x, err := eval(n.X, env)
+	if err != nil {
+		return nil, err
+	}
+	if n.Op == token.LAND || n.Op == token.LOR {
+		a, ok := x.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid operand of %s: %v", n.Op, x)
+		}
+		// Short circuit, so that m is only decoded when needed.
+		if a == (n.Op == token.LOR) {
+			return a, nil
+		}
+		y, err := eval(n.Y, env)
+		if err != nil {
+			return nil, err
+		}
+		b, ok := y.(bool)
+		if !ok {
+			return nil, fmt.Errorf("invalid operand of %s: %v", n.Op, y)
+		}
+		return b, nil
+	}
+	y, err := eval(n.Y, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if a, ok := x.(string); ok {
+		b, ok := y.(string)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare string %q with %v", a, y)
+		}
+		switch n.Op {
+		case token.ADD:
+			return a + b, nil
+		case token.EQL:
+			return a == b, nil
+		case token.NEQ:
+			return a != b, nil
+		case token.LSS:
+			return a < b, nil
+		case token.LEQ:
+			return a <= b, nil
+		case token.GTR:
+			return a > b, nil
+		case token.GEQ:
+			return a >= b, nil
+		}
+		return nil, fmt.Errorf("invalid operator %s on strings", n.Op)
+	}
+	if a, ok := x.(bool); ok {
+		b, ok := y.(bool)
+		if !ok {
+			return nil, fmt.Errorf("cannot compare bool with %v", y)
+		}
+		switch n.Op {
+		case token.EQL:
+			return a == b, nil
+		case token.NEQ:
+			return a != b, nil
+		}
+		return nil, fmt.Errorf("invalid operator %s on bools", n.Op)
+	}
+	a, ok := toNumber(x)
+	if !ok {
+		return nil, fmt.Errorf("invalid operand of %s: %v", n.Op, x)
+	}
+	b, ok := toNumber(y)
+	if !ok {
+		return nil, fmt.Errorf("invalid operand of %s: %v", n.Op, y)
+	}
+	switch n.Op {
+	case token.ADD:
+		return a + b, nil
+	case token.SUB:
+		return a - b, nil
+	case token.MUL:
+		return a * b, nil
+	case token.QUO:
+		return a / b, nil
+	case token.EQL:
+		return a == b, nil
+	case token.NEQ:
+		return a != b, nil
+	case token.LSS:
+		return a < b, nil
+	case token.LEQ:
+		return a <= b, nil
+	case token.GTR:
+		return a > b, nil
+	case token.GEQ:
+		return a >= b, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s", n.Op)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+	"github.com/fetchrobotics/rosgo/rosbag"
+)
+
+const filterUsage = `usage: gorosbag filter [--topics topics] [-s start] [-u duration] [--bz2 | --lz4] <in> <out> [expression]
+
+The expression uses the Go syntax with the variables topic, t (the time in
+seconds) and m (the message), e.g. 'topic == "/odom" && m.twist.twist.linear.x > 0.5'.`
+
+// selection holds the flags selecting the messages of a bag.
+type selection struct {
+	topics   *string
+	start    *string
+	duration *string
+}
+
+func selectionFlags(fs *flag.FlagSet) *selection {
+	return &selection{
+		topics:   fs.String("topics", "", "select these topics, separated by commas or spaces"),
+		start:    fs.String("s", "", "skip this offset from the start of the bag, in seconds or with a unit"),
+		duration: fs.String("u", "", "select only this duration, in seconds or with a unit"),
+	}
+}
+
+// options returns the read options of the selection in r.
+func (s *selection) options(r *rosbag.Reader) ([]rosbag.ReadOption, error) {
+	var options []rosbag.ReadOption
+	if fields := strings.FieldsFunc(*s.topics, func(r rune) bool { return r == ',' || r == ' ' }); len(fields) > 0 {
+		for i, f := range fields {
+			fields[i] = cli.ResolveName(f)
+		}
+		options = append(options, rosbag.ReadTopics(fields...))
+	}
+	start := r.StartTime()
+	if *s.start != "" {
+		d, err := parseDuration(*s.start)
+		if err != nil {
+			return nil, err
+		}
+		var offset ros.Duration
+		offset.FromNSec(uint64(d))
+		start = start.Add(offset)
+		options = append(options, rosbag.ReadStart(start))
+	}
+	if *s.duration != "" {
+		d, err := parseDuration(*s.duration)
+		if err != nil {
+			return nil, err
+		}
+		var duration ros.Duration
+		duration.FromNSec(uint64(d))
+		options = append(options, rosbag.ReadEnd(start.Add(duration)))
+	}
+	return options, nil
+}
+
+// decodeMessage decodes a bag message with the definition of its connection.
+func decodeMessage(ctx *dynamic.Context, m *rosbag.Message) (*dynamic.Message, error) {
+	msgType, err := ctx.ConnectionType(m.Connection.Header)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", m.Connection.Topic, err)
+	}
+	msg := msgType.New()
+	if err := m.Decode(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (c *command) filter(args []string) error {
+	fs := cli.NewFlagSet("filter")
+	sel := selectionFlags(fs)
+	writerOptions := writerFlags(fs)
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, filterUsage)
+	}
+	if len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf(filterUsage)
+	}
+	var expr *expression
+	if len(args) == 3 {
+		if expr, err = parseExpression(args[2]); err != nil {
+			return err
+		}
+	}
+	options, err := writerOptions()
+	if err != nil {
+		return err
+	}
+
+	r, err := openBag(args[0])
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	readOptions, err := sel.options(r)
+	if err != nil {
+		return err
+	}
+	w, err := rosbag.Create(args[1], options...)
+	if err != nil {
+		return err
+	}
+	ctx := dynamic.NewContextFromEnv()
+	read, written := 0, 0
+	it := r.Messages(readOptions...)
+	for it.Next() {
+		m := it.Message()
+		read++
+		if expr != nil {
+			ok, err := expr.match(&exprEnv{
+				topic:   m.Connection.Topic,
+				time:    m.Time,
+				message: func() (*dynamic.Message, error) { return decodeMessage(ctx, m) },
+			})
+			if err != nil {
+				w.Close()
+				return fmt.Errorf("%s at %d.%09d: %v", m.Connection.Topic, m.Time.Sec, m.Time.NSec, err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		if err := w.WriteMessage(m); err != nil {
+			w.Close()
+			return err
+		}
+		written++
+	}
+	if err := it.Err(); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Wrote %d of %d messages to %s\n", written, read, args[1])
+	return nil
+}
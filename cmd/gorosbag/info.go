@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/ros"
+	"github.com/fetchrobotics/rosgo/rosbag"
+)
+
+const infoUsage = "usage: gorosbag info <bag>..."
+
+// openBag opens an indexed bag, suggesting reindex for interrupted ones.
+func openBag(path string) (*rosbag.Reader, error) {
+	r, err := rosbag.Open(path)
+	if err == rosbag.ErrUnindexed {
+		return nil, fmt.Errorf("%s: bag is not indexed, run gorosbag reindex", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return r, nil
+}
+
+func (c *command) info(args []string) error {
+	fs := cli.NewFlagSet("info")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, infoUsage)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf(infoUsage)
+	}
+	for i, path := range args {
+		if i > 0 {
+			fmt.Fprintln(c.out)
+		}
+		if err := printInfo(c.out, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t ros.Time) string {
+	return fmt.Sprintf("%s (%d.%09d)", time.Unix(int64(t.Sec), int64(t.NSec)).Format("Jan 02 2006 15:04:05.00"), t.Sec, t.NSec)
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(size)/(1<<30))
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
+
+// topicInfo sums the connections of a topic.
+type topicInfo struct {
+	count       int
+	types       []string
+	connections int
+}
+
+func printInfo(out io.Writer, path string) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	r, err := openBag(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	counts := map[uint32]int{}
+	chunks := map[string]int{}
+	var compressionNames []string
+	var size, compressedSize int64
+	for _, chunk := range r.Chunks() {
+		for id, n := range chunk.MessageCounts {
+			counts[id] += int(n)
+		}
+		if chunks[chunk.Compression] == 0 {
+			compressionNames = append(compressionNames, chunk.Compression)
+		}
+		chunks[chunk.Compression]++
+		size += int64(chunk.Size)
+		compressedSize += int64(chunk.CompressedSize)
+	}
+	topics := map[string]*topicInfo{}
+	var topicNames []string
+	types := map[string]string{}
+	var typeNames []string
+	for _, conn := range r.Connections() {
+		info, ok := topics[conn.Topic]
+		if !ok {
+			info = &topicInfo{}
+			topics[conn.Topic] = info
+			topicNames = append(topicNames, conn.Topic)
+		}
+		info.count += counts[conn.ID]
+		info.connections++
+		if !contains(info.types, conn.Type) {
+			info.types = append(info.types, conn.Type)
+		}
+		if _, ok := types[conn.Type]; !ok {
+			typeNames = append(typeNames, conn.Type)
+		}
+		types[conn.Type] = conn.MD5Sum
+	}
+	sort.Strings(compressionNames)
+	sort.Strings(topicNames)
+	sort.Strings(typeNames)
+
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "path:\t%s\n", path)
+	if r.Format() == rosbag.FormatMCAP {
+		fmt.Fprintf(w, "format:\tmcap\n")
+	} else {
+		fmt.Fprintf(w, "version:\t2.0\n")
+	}
+	if r.MessageCount() > 0 {
+		start, end := r.StartTime(), r.EndTime()
+		duration := end.Diff(start)
+		fmt.Fprintf(w, "duration:\t%v\n", time.Duration(duration.ToNSec()))
+		fmt.Fprintf(w, "start:\t%s\n", formatTime(start))
+		fmt.Fprintf(w, "end:\t%s\n", formatTime(end))
+	}
+	fmt.Fprintf(w, "size:\t%s\n", formatSize(stat.Size()))
+	fmt.Fprintf(w, "messages:\t%d\n", r.MessageCount())
+	var compressions []string
+	for _, name := range compressionNames {
+		s := fmt.Sprintf("%s [%d/%d chunks", name, chunks[name], len(r.Chunks()))
+		if name != rosbag.CompressionNone && size > 0 {
+			s += fmt.Sprintf("; %.2f%%", 100*float64(compressedSize)/float64(size))
+		}
+		compressions = append(compressions, s+"]")
+	}
+	if len(compressions) == 0 {
+		compressions = []string{rosbag.CompressionNone}
+	}
+	fmt.Fprintf(w, "compression:\t%s\n", strings.Join(compressions, "\n\t"))
+	var typeLines []string
+	for _, name := range typeNames {
+		typeLines = append(typeLines, fmt.Sprintf("%s [%s]", name, types[name]))
+	}
+	fmt.Fprintf(w, "types:\t%s\n", strings.Join(typeLines, "\n\t"))
+	for i, name := range topicNames {
+		info := topics[name]
+		label := ""
+		if i == 0 {
+			label = "topics:"
+		}
+		line := fmt.Sprintf("%s\t%s\t%d msgs\t: %s", label, name, info.count, strings.Join(info.types, ", "))
+		if info.connections > 1 {
+			line += fmt.Sprintf(" (%d connections)", info.connections)
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
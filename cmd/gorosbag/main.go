@@ -0,0 +1,97 @@
+// gorosbag records, plays and inspects ROS bags and MCAP files. It is a
+// rosbag replacement which needs no Python ROS installation.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+const usage = `USAGE: gorosbag <command> [options] [args]
+
+Commands:
+	gorosbag record [options] <topic>...	record topics into a bag
+	gorosbag play [options] <bag>...	publish the messages of bags
+	gorosbag info <bag>...	summarize bags
+	gorosbag filter [options] <in> <out> [expression]	copy selected messages to a new bag
+	gorosbag reindex [options] <bag>...	recover bags whose recording was interrupted
+	gorosbag export [options] <bag>	write the messages of each topic to CSV or JSON lines
+`
+
+// command is the environment of a running subcommand.
+type command struct {
+	// args are all the arguments, including remappings.
+	args []string
+	in   io.Reader
+	out  io.Writer
+	// stop ends long running commands.
+	stop <-chan struct{}
+}
+
+var handlers = map[string]func(c *command, args []string) error{
+	"record":  (*command).record,
+	"play":    (*command).play,
+	"info":    (*command).info,
+	"filter":  (*command).filter,
+	"reindex": (*command).reindex,
+	"export":  (*command).export,
+}
+
+func main() {
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+	}()
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, stop))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, stop <-chan struct{}) int {
+	var rest []string
+	for _, arg := range args {
+		if !strings.Contains(arg, ros.Remap) {
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 1
+	}
+	handler, ok := handlers[rest[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return 1
+	}
+	c := &command{args, stdin, stdout, stop}
+	if err := handler(c, rest[1:]); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// newNode creates the node of commands talking to the ROS graph.
+func (c *command) newNode(base string) (ros.Node, error) {
+	return ros.NewNode(cli.AnonymousName(base), c.args)
+}
+
+// spin runs the node until the command is stopped.
+func (c *command) spin(node ros.Node) {
+	for node.OK() {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		node.SpinOnce()
+	}
+}
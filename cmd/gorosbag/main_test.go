@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+	"github.com/fetchrobotics/rosgo/rosbag"
+)
+
+var stringType = ros.NewRawMessageType("std_msgs/String", "992ce8a1687cec8c8bd883ec73ca41d1", "string data\n")
+
+func stringMessage(s string) *ros.RawMessage {
+	return ros.NewRawMessage(stringType, append([]byte{byte(len(s)), 0, 0, 0}, s...))
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gorosbag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+type background struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+	out  bytes.Buffer
+}
+
+// start runs a command until stopped.
+func start(t *testing.T, args ...string) *background {
+	b := &background{stop: make(chan struct{})}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		var stderr bytes.Buffer
+		if code := run(args, strings.NewReader(""), &b.out, &stderr, b.stop); code != 0 {
+			t.Errorf("%v failed: %s", args, stderr.String())
+		}
+	}()
+	return b
+}
+
+func (b *background) wait() string {
+	close(b.stop)
+	b.wg.Wait()
+	return b.out.String()
+}
+
+func TestRecord(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	node, err := ros.NewNode("/talker", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+	pub := node.NewPublisher("/chatter", stringType)
+
+	dir := tempDir(t)
+	path := filepath.Join(dir, "out.bag")
+	record := start(t, append([]string{"record", "-O", filepath.Join(dir, "out"), "--lz4", "chatter"}, rosArgs...)...)
+	for i := 0; i < 50; i++ {
+		pub.Publish(stringMessage("hello"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	out := record.wait()
+	if !strings.Contains(out, "Closed "+path) {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	r, err := rosbag.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.MessageCount() == 0 {
+		t.Error("no message recorded")
+	}
+	if c := r.Chunks()[0]; c.Compression != rosbag.CompressionLZ4 {
+		t.Errorf("unexpected compression %q", c.Compression)
+	}
+	if conns := r.Connections(); len(conns) != 1 || conns[0].Topic != "/chatter" || conns[0].Type != "std_msgs/String" {
+		t.Errorf("unexpected connections %v", conns)
+	}
+}
+
+func TestBagName(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	for _, tc := range []struct{ name, prefix, ext, want string }{
+		{"", "", ".bag", "2020-01-02-03-04-05.bag"},
+		{"", "run", ".bag", "run_2020-01-02-03-04-05.bag"},
+		{"out", "run", ".bag", "out.bag"},
+		{"out.bag", "", ".bag", "out.bag"},
+		{"", "run", ".mcap", "run_2020-01-02-03-04-05.mcap"},
+		{"out.mcap", "", ".bag", "out.mcap"},
+	} {
+		if got := bagName(tc.name, tc.prefix, tc.ext, now); got != tc.want {
+			t.Errorf("bagName(%q, %q): expected %q but %q", tc.name, tc.prefix, tc.want, got)
+		}
+	}
+}
+
+func TestPlay(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "in.bag")
+	w, err := rosbag.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint32(0); i < 10; i++ {
+		w.Write("/chatter", ros.NewTime(1, i*10000000), stringMessage("hello"))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	node, err := ros.NewNode("/listener", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mutex sync.Mutex
+	count := 0
+	node.NewSubscriber("/played", stringType, func(msg *ros.RawMessage) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		count++
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		<-done
+	}()
+
+	var stdout, stderr bytes.Buffer
+	args := append([]string{"play", "-d", "0.5", "-r", "2", path, "/chatter:=/played"}, rosArgs...)
+	if code := run(args, strings.NewReader(""), &stdout, &stderr, make(chan struct{})); code != 0 {
+		t.Fatalf("play failed: %s", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "Done.") {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	defer mutex.Unlock()
+	if count != 10 {
+		t.Errorf("expected 10 messages but %d", count)
+	}
+}
+
+func runCommand(t *testing.T, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	if code := run(args, strings.NewReader(""), &stdout, &stderr, make(chan struct{})); code != 0 {
+		t.Fatalf("%v failed: %s", args, stderr.String())
+	}
+	return stdout.String()
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBagTools(t *testing.T) {
+	dir := tempDir(t)
+	path := filepath.Join(dir, "in.bag")
+	w, err := rosbag.Create(path, rosbag.WriterChunkSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := uint32(0); i < 10; i++ {
+		w.Write("/chatter", ros.NewTime(1, i*100000000), stringMessage(fmt.Sprint("hello ", i)))
+	}
+	w.Write("/status", ros.NewTime(1, 0), stringMessage("ready"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out := runCommand(t, "info", path)
+	for _, s := range []string{
+		"messages:    11\n",
+		"duration:    900ms\n",
+		"compression: none [",
+		"types:       std_msgs/String [992ce8a1687cec8c8bd883ec73ca41d1]\n",
+		"topics:      /chatter 10 msgs : std_msgs/String\n",
+		"             /status  1 msg",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("info output misses %q:\n%s", s, out)
+		}
+	}
+
+	filtered := filepath.Join(dir, "filtered.mcap")
+	out = runCommand(t, "filter", "--lz4", "--topics", "chatter", "-s", "0.2", path, filtered, `m.data == "hello 3" || t >= 1.8`)
+	if want := "Wrote 3 of 8 messages to " + filtered + "\n"; out != want {
+		t.Errorf("expected %q but %q", want, out)
+	}
+	if out := runCommand(t, "info", filtered); !strings.Contains(out, "format:      mcap\n") || !strings.Contains(out, "compression: lz4 [") {
+		t.Errorf("unexpected info of an MCAP file:\n%s", out)
+	}
+
+	out = runCommand(t, "export", "-o", dir, filtered)
+	if want := "Wrote 3 messages to " + filepath.Join(dir, "chatter.csv") + "\n"; out != want {
+		t.Errorf("expected %q but %q", want, out)
+	}
+	if got, want := readFile(t, filepath.Join(dir, "chatter.csv")), "time,data\n1.300000000,hello 3\n1.800000000,hello 8\n1.900000000,hello 9\n"; got != want {
+		t.Errorf("expected CSV %q but %q", want, got)
+	}
+	runCommand(t, "export", "-f", "jsonl", "-o", dir, "--topics", "/status", path)
+	if got, want := readFile(t, filepath.Join(dir, "status.jsonl")), `{"time":1.000000000,"message":{"data":"ready"}}`+"\n"; got != want {
+		t.Errorf("expected JSON lines %q but %q", want, got)
+	}
+
+	// A recording killed before its index was written.
+	crashed := filepath.Join(dir, "crashed.bag")
+	w, err = rosbag.Create(crashed+".active", rosbag.WriterChunkSize(256))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for i := uint32(0); i < 5; i++ {
+		w.Write("/chatter", ros.NewTime(2, i), stringMessage("hello"))
+	}
+	w.Flush()
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"info", crashed + ".active"}, strings.NewReader(""), &stdout, &stderr, nil); code == 0 || !strings.Contains(stderr.String(), "reindex") {
+		t.Errorf("info of an unindexed bag should suggest reindex: %q", stderr.String())
+	}
+	out = runCommand(t, "reindex", crashed+".active")
+	if want := "Reindexed " + crashed + ".active to " + crashed + ": 5 messages\n"; out != want {
+		t.Errorf("expected %q but %q", want, out)
+	}
+	if out := runCommand(t, "info", crashed); !strings.Contains(out, "messages:    5\n") {
+		t.Errorf("unexpected info of the reindexed bag:\n%s", out)
+	}
+	runCommand(t, "reindex", crashed)
+	if _, err := os.Stat(filepath.Join(dir, "crashed.orig.bag")); err != nil {
+		t.Errorf("missing backup: %v", err)
+	}
+}
+
+func TestExpression(t *testing.T) {
+	msgType, err := dynamic.NewContext(nil).AddDefinition("test/Pose", "float64 x\nuint8[] ids\ntime stamp\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := msgType.New()
+	msg.Data["x"] = 1.5
+	msg.Data["ids"] = []byte{4, 5, 6}
+	msg.Data["stamp"] = ros.NewTime(10, 500000000)
+	decoded := 0
+	newEnv := func() *exprEnv {
+		return &exprEnv{
+			topic: "/pose",
+			time:  ros.NewTime(10, 0),
+			message: func() (*dynamic.Message, error) {
+				decoded++
+				return msg, nil
+			},
+		}
+	}
+	for _, tc := range []struct {
+		expr string
+		want bool
+	}{
+		{`topic == "/pose"`, true},
+		{`topic != "/pose" && m.x > 0`, false},
+		{`m.x * 2 == 3 && -m.x < 0`, true},
+		{`len(m.ids) == 3 && m.ids[-1] == 6`, true},
+		{`m.stamp - t == 0.5 && m.stamp.secs == 10`, true},
+		{`!(t >= 11) || false`, true},
+	} {
+		e, err := parseExpression(tc.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := e.match(newEnv())
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+		} else if got != tc.want {
+			t.Errorf("%s: expected %v", tc.expr, tc.want)
+		}
+	}
+	// Once for each expression using m.
+	if decoded != 3 {
+		t.Errorf("expected the message to be decoded 3 times but %d", decoded)
+	}
+	for _, s := range []string{`m.y`, `topic + 1`, `m.x`, `f(m)`, `m.ids[3] == 0`} {
+		e, err := parseExpression(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.match(newEnv()); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
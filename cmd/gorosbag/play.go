@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/rosbag"
+)
+
+const playUsage = "usage: gorosbag play [-r rate] [-s start] [-u duration] [-l] [--pause] [--clock [--hz hz]] [-d delay] [--topics topics] <bag>..."
+
+func (c *command) play(args []string) error {
+	fs := cli.NewFlagSet("play")
+	rate := fs.Float64("r", 1, "playback rate multiplier")
+	start := fs.String("s", "0", "start offset, in seconds or with a unit")
+	duration := fs.String("u", "", "play only this duration, in seconds or with a unit")
+	loop := fs.Bool("l", false, "loop the playback")
+	pause := fs.Bool("pause", false, "start paused")
+	clock := fs.Bool("clock", false, "publish the bag time on /clock")
+	hz := fs.Float64("hz", 100, "frequency of /clock")
+	delay := fs.String("d", "0.2", "delay after advertising the topics")
+	topics := fs.String("topics", "", "play only these topics, separated by commas or spaces")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, playUsage)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf(playUsage)
+	}
+
+	options := []rosbag.PlayerOption{
+		rosbag.PlayerRate(*rate),
+		rosbag.PlayerLoop(*loop),
+		rosbag.PlayerPaused(*pause),
+	}
+	for _, opt := range []struct {
+		value  string
+		option func(time.Duration) rosbag.PlayerOption
+	}{
+		{*start, rosbag.PlayerStart},
+		{*duration, rosbag.PlayerDuration},
+		{*delay, rosbag.PlayerDelay},
+	} {
+		if opt.value == "" {
+			continue
+		}
+		d, err := parseDuration(opt.value)
+		if err != nil {
+			return err
+		}
+		options = append(options, opt.option(d))
+	}
+	if *clock {
+		options = append(options, rosbag.PlayerClock(*hz))
+	}
+	if fields := strings.FieldsFunc(*topics, func(r rune) bool { return r == ',' || r == ' ' }); len(fields) > 0 {
+		for i, f := range fields {
+			fields[i] = cli.ResolveName(f)
+		}
+		options = append(options, rosbag.PlayerTopics(fields...))
+	}
+
+	var readers []*rosbag.Reader
+	defer func() {
+		for _, r := range readers {
+			r.Close()
+		}
+	}()
+	for _, path := range args {
+		r, err := rosbag.Open(path)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		readers = append(readers, r)
+	}
+
+	node, err := c.newNode("gorosbag_play")
+	if err != nil {
+		return err
+	}
+	defer node.Shutdown()
+	player, err := rosbag.NewPlayer(node, readers, options...)
+	if err != nil {
+		return err
+	}
+	defer player.Shutdown()
+
+	fmt.Fprintln(c.out, "Hit Enter to toggle paused, or type s and Enter to step.")
+	go c.control(player)
+	done := make(chan error, 1)
+	go func() { done <- player.Play() }()
+	select {
+	case err := <-done:
+		if err == nil {
+			fmt.Fprintln(c.out, "Done.")
+		}
+		return err
+	case <-c.stop:
+		player.Shutdown()
+		return <-done
+	}
+}
+
+// control reads the playback commands from the input.
+func (c *command) control(player *rosbag.Player) {
+	scanner := bufio.NewScanner(c.in)
+	for scanner.Scan() {
+		switch strings.TrimSpace(scanner.Text()) {
+		case "":
+			if player.Paused() {
+				player.Resume()
+				fmt.Fprintln(c.out, "[RUNNING]")
+			} else {
+				player.Pause()
+				fmt.Fprintln(c.out, "[PAUSED]")
+			}
+		case "s":
+			player.Step()
+		}
+	}
+}
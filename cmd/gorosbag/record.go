@@ -0,0 +1,155 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/rosbag"
+)
+
+const recordUsage = "usage: gorosbag record [-a] [-e] [-x regex] [-O name | -o prefix] [--split --size MB --duration time] [--max-splits n] [--mcap] [--bz2 | --lz4] <topic>..."
+
+// parseDuration accepts seconds as a number or Go durations such as 5m.
+func parseDuration(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+// bagName builds the name of the recorded bag from the -O and -o options.
+// ext is the extension of the file format, .bag or .mcap.
+func bagName(name, prefix, ext string, now time.Time) string {
+	if name != "" {
+		if strings.HasSuffix(name, ".bag") || strings.HasSuffix(name, ".mcap") {
+			return name
+		}
+		return name + ext
+	}
+	stamp := now.Format("2006-01-02-15-04-05")
+	if prefix != "" {
+		return prefix + "_" + stamp + ext
+	}
+	return stamp + ext
+}
+
+// writerFlags adds the options of the written bags to fs. The returned
+// function builds them once fs is parsed.
+func writerFlags(fs *flag.FlagSet) func() ([]rosbag.WriterOption, error) {
+	bz2 := fs.Bool("bz2", false, "compress chunks with bz2")
+	lz4 := fs.Bool("lz4", false, "compress chunks with lz4")
+	chunkSize := fs.Int("chunksize", rosbag.DefaultChunkSize/1024, "chunk size in KB")
+	return func() ([]rosbag.WriterOption, error) {
+		options := []rosbag.WriterOption{rosbag.WriterChunkSize(*chunkSize * 1024)}
+		if *bz2 && *lz4 {
+			return nil, fmt.Errorf("--bz2 and --lz4 are exclusive")
+		} else if *bz2 {
+			options = append(options, rosbag.WriterCompression(rosbag.CompressionBZ2))
+		} else if *lz4 {
+			options = append(options, rosbag.WriterCompression(rosbag.CompressionLZ4))
+		}
+		return options, nil
+	}
+}
+
+func (c *command) record(args []string) error {
+	fs := cli.NewFlagSet("record")
+	all := fs.Bool("a", false, "record all topics")
+	regex := fs.Bool("e", false, "match topics with regular expressions")
+	exclude := fs.String("x", "", "exclude topics matching the regular expression")
+	name := fs.String("O", "", "name of the bag")
+	prefix := fs.String("o", "", "prefix of the bag name")
+	split := fs.Bool("split", false, "split the bag at the size or duration limit")
+	size := fs.Int64("size", 0, "split size in MB")
+	duration := fs.String("duration", "", "split duration, in seconds or with a unit (5m, 2h)")
+	maxSplits := fs.Int("max-splits", 0, "keep at most this number of bags")
+	mcap := fs.Bool("mcap", false, "record to an MCAP file")
+	writerOptions := writerFlags(fs)
+	discovery := fs.Duration("discovery", time.Second, "period of the discovery of new topics")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, recordUsage)
+	}
+
+	var options []rosbag.RecorderOption
+	switch {
+	case *all:
+		options = append(options, rosbag.RecorderAll())
+	case *regex:
+		for _, arg := range args {
+			p, err := regexp.Compile(arg)
+			if err != nil {
+				return err
+			}
+			options = append(options, rosbag.RecorderRegex(p))
+		}
+	default:
+		for _, arg := range args {
+			options = append(options, rosbag.RecorderTopics(cli.ResolveName(arg)))
+		}
+	}
+	if !*all && len(args) == 0 {
+		return fmt.Errorf(recordUsage)
+	}
+	if *exclude != "" {
+		p, err := regexp.Compile(*exclude)
+		if err != nil {
+			return err
+		}
+		options = append(options, rosbag.RecorderExclude(p))
+	}
+	if *split {
+		if *size <= 0 && *duration == "" {
+			return fmt.Errorf("--split needs --size or --duration")
+		}
+		if *size > 0 {
+			options = append(options, rosbag.RecorderSplitSize(*size*1024*1024))
+		}
+		if *duration != "" {
+			d, err := parseDuration(*duration)
+			if err != nil {
+				return err
+			}
+			options = append(options, rosbag.RecorderSplitDuration(d))
+		}
+	}
+	if *maxSplits > 0 {
+		options = append(options, rosbag.RecorderMaxSplits(*maxSplits))
+	}
+	bagOptions, err := writerOptions()
+	if err != nil {
+		return err
+	}
+	options = append(options,
+		rosbag.RecorderWriterOptions(bagOptions...),
+		rosbag.RecorderDiscoveryPeriod(*discovery))
+
+	node, err := c.newNode("gorosbag_record")
+	if err != nil {
+		return err
+	}
+	defer node.Shutdown()
+	ext := ".bag"
+	if *mcap {
+		ext = ".mcap"
+	}
+	path := bagName(*name, *prefix, ext, time.Now())
+	recorder, err := rosbag.NewRecorder(node, path, options...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Recording to %s\n", path)
+	c.spin(node)
+	if err := recorder.Shutdown(); err != nil {
+		return err
+	}
+	for _, bag := range recorder.Bags() {
+		fmt.Fprintf(c.out, "Closed %s\n", bag)
+	}
+	return nil
+}
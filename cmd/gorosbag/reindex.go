@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/rosbag"
+)
+
+const reindexUsage = "usage: gorosbag reindex [--output-dir dir] [--bz2 | --lz4] <bag>..."
+
+// reindexPaths returns where a bag is reindexed and where the original is
+// kept. Bags left active by an interrupted recording get their final name;
+// other bags are rewritten in place after a backup named like name.orig.bag
+// or name.orig.mcap.
+func reindexPaths(path, outputDir string) (out string, backup string) {
+	out = strings.TrimSuffix(path, ".active")
+	if outputDir != "" {
+		return filepath.Join(outputDir, filepath.Base(out)), ""
+	}
+	if out != path {
+		return out, ""
+	}
+	if ext := filepath.Ext(path); ext == ".bag" || ext == ".mcap" {
+		return path, strings.TrimSuffix(path, ext) + ".orig" + ext
+	}
+	return path, path + ".orig"
+}
+
+func (c *command) reindex(args []string) error {
+	fs := cli.NewFlagSet("reindex")
+	outputDir := fs.String("output-dir", "", "write the reindexed bags to this directory")
+	writerOptions := writerFlags(fs)
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return fmt.Errorf("%v\n%s", err, reindexUsage)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf(reindexUsage)
+	}
+	options, err := writerOptions()
+	if err != nil {
+		return err
+	}
+	for _, path := range args {
+		out, backup := reindexPaths(path, *outputDir)
+		src := path
+		if backup != "" {
+			if err := os.Rename(path, backup); err != nil {
+				return err
+			}
+			src = backup
+		}
+		count, truncated, err := reindexBag(src, out, options)
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		fmt.Fprintf(c.out, "Reindexed %s to %s: %d messages", path, out, count)
+		if truncated {
+			fmt.Fprint(c.out, ", end of the bag was truncated")
+		}
+		fmt.Fprintln(c.out)
+	}
+	return nil
+}
+
+// reindexBag copies the messages found by scanning src into a new bag.
+func reindexBag(src, dst string, options []rosbag.WriterOption) (int, bool, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+	w, err := rosbag.Create(dst, options...)
+	if err != nil {
+		return 0, false, err
+	}
+	s := rosbag.NewScanner(f)
+	count := 0
+	for s.Next() {
+		if err := w.WriteMessage(s.Message()); err != nil {
+			w.Close()
+			return count, false, err
+		}
+		count++
+	}
+	if err := s.Err(); err != nil {
+		w.Close()
+		return count, false, err
+	}
+	return count, s.Truncated(), w.Close()
+}
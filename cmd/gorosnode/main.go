@@ -0,0 +1,489 @@
+// gorosnode inspects the nodes of a ROS graph. It is a rosnode replacement
+// which talks to the master and the nodes through the ROS XML-RPC APIs.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/rosapi"
+)
+
+const usage = `USAGE: gorosnode <command> [options] [args]
+
+Commands:
+	gorosnode list [-u] [-a] [namespace]	list active nodes
+	gorosnode info <node>...		print information about nodes
+	gorosnode ping [-c count] <node> | -a	test connectivity to nodes
+	gorosnode kill <node>... | -a		kill running nodes
+	gorosnode machine [machine]		list machines or the nodes running on one
+	gorosnode cleanup [-y]			purge registrations of unreachable nodes
+`
+
+const callerID = "/gorosnode"
+
+type command struct {
+	master *rosapi.MasterClient
+	in     io.Reader
+	out    io.Writer
+}
+
+var handlers = map[string]func(c *command, args []string) error{
+	"list":    (*command).list,
+	"info":    (*command).info,
+	"ping":    (*command).ping,
+	"kill":    (*command).kill,
+	"machine": (*command).machine,
+	"cleanup": (*command).cleanup,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var rest []string
+	for _, arg := range args {
+		if !strings.Contains(arg, ":=") {
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 1
+	}
+	handler, ok := handlers[rest[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return 1
+	}
+	masterURI := cli.MasterURI(args)
+	if masterURI == "" {
+		fmt.Fprintln(stderr, "ROS_MASTER_URI is not set")
+		return 1
+	}
+	c := &command{rosapi.NewMasterClient(masterURI, callerID), stdin, stdout}
+	if err := handler(c, rest[1:]); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// nodeNames returns the sorted names of the nodes having registrations.
+func nodeNames(state *rosapi.SystemState) []string {
+	seen := map[string]bool{}
+	for _, m := range []map[string][]string{state.Publishers, state.Subscribers, state.Services} {
+		for _, nodes := range m {
+			for _, n := range nodes {
+				seen[n] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *command) nodes() ([]string, error) {
+	state, err := c.master.GetSystemState()
+	if err != nil {
+		return nil, err
+	}
+	return nodeNames(state), nil
+}
+
+func (c *command) list(args []string) error {
+	fs := cli.NewFlagSet("list")
+	uris := fs.Bool("u", false, "print the XML-RPC URIs of the nodes")
+	all := fs.Bool("a", false, "print the names and the URIs of the nodes")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	namespace := "/"
+	if len(args) > 0 {
+		namespace = cli.ResolveName(args[0])
+	}
+	names, err := c.nodes()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if namespace != "/" && !strings.HasPrefix(name, namespace+"/") {
+			continue
+		}
+		if !*uris && !*all {
+			fmt.Fprintln(c.out, name)
+			continue
+		}
+		uri, err := c.master.LookupNode(name)
+		if err != nil {
+			uri = "unknown"
+		}
+		if *all {
+			fmt.Fprintf(c.out, "%s \t%s\n", uri, name)
+		} else {
+			fmt.Fprintln(c.out, uri)
+		}
+	}
+	return nil
+}
+
+func (c *command) info(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: gorosnode info <node>...")
+	}
+	state, err := c.master.GetSystemState()
+	if err != nil {
+		return err
+	}
+	topicTypes, err := c.master.GetTopicTypes()
+	if err != nil {
+		return err
+	}
+	types := map[string]string{}
+	for _, t := range topicTypes {
+		types[t.Name] = t.Type
+	}
+
+	for i, arg := range args {
+		if i > 0 {
+			fmt.Fprintln(c.out)
+		}
+		name := cli.ResolveName(arg)
+		fmt.Fprintln(c.out, strings.Repeat("-", 80))
+		fmt.Fprintf(c.out, "Node [%s]\n", name)
+		for _, section := range []struct {
+			title string
+			names map[string][]string
+			typed bool
+		}{
+			{"Publications", state.Publishers, true},
+			{"Subscriptions", state.Subscribers, true},
+			{"Services", state.Services, false},
+		} {
+			var entries []string
+			for topic, nodes := range section.names {
+				for _, n := range nodes {
+					if n == name {
+						entries = append(entries, topic)
+					}
+				}
+			}
+			sort.Strings(entries)
+			if len(entries) == 0 {
+				fmt.Fprintf(c.out, "%s: None\n\n", section.title)
+				continue
+			}
+			fmt.Fprintf(c.out, "%s: \n", section.title)
+			for _, e := range entries {
+				if section.typed {
+					fmt.Fprintf(c.out, " * %s [%s]\n", e, types[e])
+				} else {
+					fmt.Fprintf(c.out, " * %s\n", e)
+				}
+			}
+			fmt.Fprintln(c.out)
+		}
+		c.contact(name)
+	}
+	return nil
+}
+
+// contact prints what the node itself reports.
+func (c *command) contact(name string) {
+	uri, err := c.master.LookupNode(name)
+	if err != nil {
+		fmt.Fprintf(c.out, "cannot contact [%s]: unknown node\n", name)
+		return
+	}
+	fmt.Fprintf(c.out, "contacting node %s ...\n", uri)
+	slave := rosapi.NewSlaveClient(uri, callerID)
+	pid, err := slave.GetPid()
+	if err != nil {
+		fmt.Fprintf(c.out, "ERROR: communication with node[%s] failed! %v\n", uri, err)
+		return
+	}
+	fmt.Fprintf(c.out, "Pid: %d\n", pid)
+	infos, err := slave.GetBusInfo()
+	if err != nil {
+		fmt.Fprintf(c.out, "Connections: unavailable (%v)\n", err)
+		return
+	}
+	fmt.Fprintln(c.out, "Connections:")
+	for _, info := range infos {
+		fmt.Fprintf(c.out, " * topic: %s\n", info.Topic)
+		direction := "inbound"
+		if info.Direction == "o" {
+			direction = "outbound"
+		}
+		fmt.Fprintf(c.out, "    * to: %s\n", info.DestinationID)
+		fmt.Fprintf(c.out, "    * direction: %s\n", direction)
+		fmt.Fprintf(c.out, "    * transport: %s\n", info.Transport)
+	}
+}
+
+// pingTimeout bounds the getPid calls of ping.
+var pingTimeout = 3 * time.Second
+
+// pingNode measures the round trip time of a getPid call.
+func (c *command) pingNode(name string) (string, time.Duration, error) {
+	uri, err := c.master.LookupNode(name)
+	if err != nil {
+		return "", 0, err
+	}
+	client := rosapi.NewSlaveClient(uri, callerID)
+	client.Timeout = pingTimeout
+	start := time.Now()
+	if _, err := client.GetPid(); err != nil {
+		return uri, 0, err
+	}
+	return uri, time.Since(start), nil
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (c *command) ping(args []string) error {
+	fs := cli.NewFlagSet("ping")
+	count := fs.Int("c", 0, "number of pings, 0 pings until interrupted")
+	all := fs.Bool("a", false, "ping all nodes once")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *all {
+		names, err := c.nodes()
+		if err != nil {
+			return err
+		}
+		var unreachable []string
+		for _, name := range names {
+			uri, d, err := c.pingNode(name)
+			if err != nil {
+				fmt.Fprintf(c.out, "ERROR: connection refused to [%s] %s\n", name, uri)
+				unreachable = append(unreachable, name)
+				continue
+			}
+			fmt.Fprintf(c.out, "%s\t%fms\n", name, milliseconds(d))
+		}
+		if len(unreachable) > 0 {
+			fmt.Fprintln(c.out, "ERROR: the following nodes are unreachable:")
+			for _, name := range unreachable {
+				fmt.Fprintf(c.out, " * %s\n", name)
+			}
+		}
+		return nil
+	}
+
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gorosnode ping [-c count] <node> | -a")
+	}
+	name := cli.ResolveName(args[0])
+	fmt.Fprintf(c.out, "rosnode: node is [%s]\n", name)
+	for i := 0; *count == 0 || i < *count; i++ {
+		if i > 0 {
+			time.Sleep(time.Second)
+		}
+		uri, d, err := c.pingNode(name)
+		if err != nil {
+			return fmt.Errorf("cannot ping [%s]: %v", name, err)
+		}
+		if i == 0 {
+			fmt.Fprintf(c.out, "pinging %s with a timeout of %.1fs\n", name, pingTimeout.Seconds())
+		}
+		host := uri
+		if u, err := url.Parse(uri); err == nil {
+			host = u.Host
+		}
+		fmt.Fprintf(c.out, "xmlrpc reply from %s\ttime=%fms\n", host, milliseconds(d))
+	}
+	return nil
+}
+
+func (c *command) kill(args []string) error {
+	fs := cli.NewFlagSet("kill")
+	all := fs.Bool("a", false, "kill all nodes")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	var names []string
+	if *all {
+		if names, err = c.nodes(); err != nil {
+			return err
+		}
+	} else {
+		if len(args) == 0 {
+			return fmt.Errorf("usage: gorosnode kill <node>... | -a")
+		}
+		for _, arg := range args {
+			names = append(names, cli.ResolveName(arg))
+		}
+	}
+
+	var failed []string
+	for _, name := range names {
+		fmt.Fprintf(c.out, "killing %s\n", name)
+		uri, err := c.master.LookupNode(name)
+		if err == nil {
+			err = rosapi.NewSlaveClient(uri, callerID).Shutdown("user request")
+		}
+		if err != nil {
+			fmt.Fprintf(c.out, "ERROR: failed to kill %s: %v\n", name, err)
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("failed to kill %s", strings.Join(failed, ", "))
+	}
+	fmt.Fprintln(c.out, "killed")
+	return nil
+}
+
+// hostOf returns the host name of a node URI.
+func hostOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+func (c *command) machine(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: gorosnode machine [machine]")
+	}
+	names, err := c.nodes()
+	if err != nil {
+		return err
+	}
+	machines := map[string][]string{}
+	for _, name := range names {
+		uri, err := c.master.LookupNode(name)
+		if err != nil {
+			continue
+		}
+		host := hostOf(uri)
+		machines[host] = append(machines[host], name)
+	}
+
+	if len(args) == 1 {
+		for _, name := range machines[args[0]] {
+			fmt.Fprintln(c.out, name)
+		}
+		return nil
+	}
+	hosts := make([]string, 0, len(machines))
+	for host := range machines {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		fmt.Fprintln(c.out, host)
+	}
+	return nil
+}
+
+func (c *command) cleanup(args []string) error {
+	fs := cli.NewFlagSet("cleanup")
+	yes := fs.Bool("y", false, "purge without asking")
+	if _, err := cli.ParseFlags(fs, args); err != nil {
+		return err
+	}
+	state, err := c.master.GetSystemState()
+	if err != nil {
+		return err
+	}
+	unreachable := map[string]string{}
+	var names []string
+	for _, name := range nodeNames(state) {
+		uri, err := c.master.LookupNode(name)
+		if err != nil {
+			continue
+		}
+		if _, err := rosapi.NewSlaveClient(uri, callerID).GetPid(); err != nil {
+			unreachable[name] = uri
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		fmt.Fprintln(c.out, "All nodes are reachable, nothing to purge.")
+		return nil
+	}
+
+	fmt.Fprintln(c.out, "Unable to contact the following nodes:")
+	for _, name := range names {
+		fmt.Fprintf(c.out, " * %s %s\n", name, unreachable[name])
+	}
+	if !*yes {
+		fmt.Fprint(c.out, "Purge all unreachable nodes from the master? y/n ")
+		answer, _ := bufio.NewReader(c.in).ReadString('\n')
+		if strings.TrimSpace(answer) != "y" {
+			fmt.Fprintln(c.out, "aborting")
+			return nil
+		}
+	}
+
+	for _, name := range names {
+		fmt.Fprintf(c.out, "unregistering %s\n", name)
+		if err := c.unregister(name, unreachable[name], state); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(c.out, "done")
+	return nil
+}
+
+// unregister removes every registration of a node from the master on its
+// behalf.
+func (c *command) unregister(name, uri string, state *rosapi.SystemState) error {
+	master := rosapi.NewMasterClient(c.master.URI, name)
+	has := func(nodes []string) bool {
+		for _, n := range nodes {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	for topic, nodes := range state.Publishers {
+		if has(nodes) {
+			if _, err := master.UnregisterPublisher(topic, uri); err != nil {
+				return err
+			}
+		}
+	}
+	for topic, nodes := range state.Subscribers {
+		if has(nodes) {
+			if _, err := master.UnregisterSubscriber(topic, uri); err != nil {
+				return err
+			}
+		}
+	}
+	for service, nodes := range state.Services {
+		if has(nodes) {
+			serviceURI, err := master.LookupService(service)
+			if err != nil {
+				continue
+			}
+			if _, err := master.UnregisterService(service, serviceURI); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+	"github.com/fetchrobotics/rosgo/rosapi"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	if code := run(args, strings.NewReader(stdin), &stdout, &stderr); code != 0 {
+		t.Fatalf("%v failed: %s", args, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestNodeCommands(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	args := func(a ...string) []string { return append(a, rosArgs...) }
+
+	node, err := ros.NewNode("/talker", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgType := ros.NewRawMessageType("std_msgs/String", "992ce8a1687cec8c8bd883ec73ca41d1", "string data\n")
+	pub := node.NewPublisher("/chatter", msgType)
+	defer pub.Shutdown()
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		<-shutdown
+	}()
+
+	// A node which died without unregistering.
+	dead := rosapi.NewMasterClient(m.URI(), "/ns/dead")
+	if _, err := dead.RegisterSubscriber("/chatter", "std_msgs/String", "http://127.0.0.1:1/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := dead.RegisterService("/ns/reset", "rosrpc://127.0.0.1:1", "http://127.0.0.1:1/"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := runCommand(t, "", args("list")...); got != "/ns/dead\n/talker\n" {
+		t.Errorf("list: unexpected output %q", got)
+	}
+	if got := runCommand(t, "", args("list", "/ns")...); got != "/ns/dead\n" {
+		t.Errorf("list /ns: unexpected output %q", got)
+	}
+	if got := runCommand(t, "", args("list", "-a", "/ns")...); got != "http://127.0.0.1:1/ \t/ns/dead\n" {
+		t.Errorf("list -a /ns: unexpected output %q", got)
+	}
+	info := runCommand(t, "", args("info", "/talker")...)
+	for _, want := range []string{"Node [/talker]\n", "Publications: \n * /chatter [std_msgs/String]\n", "Subscriptions: None\n", "Pid: "} {
+		if !strings.Contains(info, want) {
+			t.Errorf("info: expected %q in %q", want, info)
+		}
+	}
+	info = runCommand(t, "", args("info", "/ns/dead")...)
+	for _, want := range []string{"Subscriptions: \n * /chatter [std_msgs/String]\n", "Services: \n * /ns/reset\n", "ERROR: communication"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("info of a dead node: expected %q in %q", want, info)
+		}
+	}
+	if got := runCommand(t, "", args("ping", "-c", "1", "talker")...); !strings.Contains(got, "xmlrpc reply from 127.0.0.1:") {
+		t.Errorf("ping: unexpected output %q", got)
+	}
+	if got := runCommand(t, "", args("ping", "-a")...); !strings.Contains(got, "unreachable:\n * /ns/dead\n") {
+		t.Errorf("ping -a: unexpected output %q", got)
+	}
+	if got := runCommand(t, "", args("machine")...); got != "127.0.0.1\n" {
+		t.Errorf("machine: unexpected output %q", got)
+	}
+	if got := runCommand(t, "", args("machine", "127.0.0.1")...); got != "/ns/dead\n/talker\n" {
+		t.Errorf("machine 127.0.0.1: unexpected output %q", got)
+	}
+
+	if got := runCommand(t, "n\n", args("cleanup")...); !strings.Contains(got, "aborting") {
+		t.Errorf("cleanup: unexpected output %q", got)
+	}
+	runCommand(t, "y\n", args("cleanup")...)
+	if got := runCommand(t, "", args("list")...); got != "/talker\n" {
+		t.Errorf("list after cleanup: unexpected output %q", got)
+	}
+
+	runCommand(t, "", args("kill", "/talker")...)
+	select {
+	case <-shutdown:
+	case <-time.After(5 * time.Second):
+		t.Error("node was not shut down by kill")
+	}
+}
+
+func TestPingTimeout(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	// A node which never answers.
+	hung := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		<-hung
+	}))
+	defer server.Close()
+	defer close(hung)
+	if _, err := rosapi.NewMasterClient(m.URI(), "/hung").RegisterSubscriber("/chatter", "std_msgs/String", server.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(timeout time.Duration) { pingTimeout = timeout }(pingTimeout)
+	pingTimeout = 100 * time.Millisecond
+	var stdout, stderr bytes.Buffer
+	args := []string{"ping", "-c", "1", "/hung", "__master:=" + m.URI()}
+	if code := run(args, strings.NewReader(""), &stdout, &stderr); code == 0 {
+		t.Errorf("ping of a hung node succeeded: %s", stdout.String())
+	}
+}
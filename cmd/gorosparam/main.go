@@ -0,0 +1,181 @@
+// gorosparam reads and writes the parameter server. It is a rosparam
+// replacement which talks to the master through the ROS XML-RPC API.
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/rosapi"
+	"github.com/fetchrobotics/rosgo/rosparam"
+	"github.com/fetchrobotics/rosgo/yaml"
+)
+
+const usage = `USAGE: gorosparam <command> [options] [args]
+
+Commands:
+	gorosparam set [-t file] <name> [value]	set a parameter to a YAML value or the content of a file
+	gorosparam get <name>			print a parameter as YAML
+	gorosparam load <file> [namespace]	load a YAML file, - for the standard input
+	gorosparam dump [file] [namespace]	dump parameters as YAML, to the standard output by default
+	gorosparam delete <name>		delete a parameter
+	gorosparam list [namespace]		list parameter names
+`
+
+const callerID = "/gorosparam"
+
+type command struct {
+	master *rosapi.MasterClient
+	in     io.Reader
+	out    io.Writer
+}
+
+var handlers = map[string]func(c *command, args []string) error{
+	"set":    (*command).set,
+	"get":    (*command).get,
+	"load":   (*command).load,
+	"dump":   (*command).dump,
+	"delete": (*command).delete,
+	"list":   (*command).list,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var rest []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "__") || !strings.Contains(arg, ":=") {
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 1
+	}
+	handler, ok := handlers[rest[0]]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return 1
+	}
+	masterURI := cli.MasterURI(args)
+	if masterURI == "" {
+		fmt.Fprintln(stderr, "ROS_MASTER_URI is not set")
+		return 1
+	}
+	c := &command{rosapi.NewMasterClient(masterURI, callerID), stdin, stdout}
+	if err := handler(c, rest[1:]); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// namespace resolves an optional namespace argument.
+func namespace(args []string) string {
+	if len(args) == 0 {
+		return cli.ResolveName("")
+	}
+	return cli.ResolveName(args[0])
+}
+
+func (c *command) set(args []string) error {
+	fs := cli.NewFlagSet("set")
+	textfile := fs.String("t", "", "set the parameter to the content of a text file")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *textfile != "" {
+		if len(args) != 1 {
+			return fmt.Errorf("usage: gorosparam set -t <file> <name>")
+		}
+		data, err := ioutil.ReadFile(*textfile)
+		if err != nil {
+			return err
+		}
+		return c.master.SetParam(cli.ResolveName(args[0]), string(data))
+	}
+	if len(args) != 2 {
+		return fmt.Errorf("usage: gorosparam set <name> <value>")
+	}
+	return rosparam.Set(c.master, cli.ResolveName(args[0]), args[1])
+}
+
+func (c *command) get(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gorosparam get <name>")
+	}
+	value, err := c.master.GetParam(cli.ResolveName(args[0]))
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(data)
+	return err
+}
+
+func (c *command) load(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: gorosparam load <file> [namespace]")
+	}
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = ioutil.ReadAll(c.in)
+	} else {
+		data, err = ioutil.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	return rosparam.Load(c.master, namespace(args[1:]), data)
+}
+
+func (c *command) dump(args []string) error {
+	if len(args) > 2 {
+		return fmt.Errorf("usage: gorosparam dump [file] [namespace]")
+	}
+	file := "-"
+	if len(args) > 0 {
+		file = args[0]
+	}
+	data, err := rosparam.Dump(c.master, namespace(args[min(len(args), 1):]))
+	if err != nil {
+		return err
+	}
+	if file == "-" {
+		_, err = c.out.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
+
+func (c *command) delete(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gorosparam delete <name>")
+	}
+	return c.master.DeleteParam(cli.ResolveName(args[0]))
+}
+
+func (c *command) list(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: gorosparam list [namespace]")
+	}
+	names, err := rosparam.List(c.master, namespace(args))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Fprintln(c.out, name)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fetchrobotics/rosgo/master"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	if code := run(args, strings.NewReader(stdin), &stdout, &stderr); code != 0 {
+		t.Fatalf("%v failed: %s", args, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestParamCommands(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	args := func(a ...string) []string { return append(a, "__master:="+m.URI()) }
+	dir, err := ioutil.TempDir("", "gorosparam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	runCommand(t, "", args("set", "/rate", "10")...)
+	runCommand(t, "", args("set", "/arm/joints", "[shoulder, elbow]")...)
+	if got := runCommand(t, "", args("get", "/rate")...); got != "10\n" {
+		t.Errorf("get: unexpected output %q", got)
+	}
+	if got := runCommand(t, "", args("get", "/arm")...); got != "joints:\n- shoulder\n- elbow\n" {
+		t.Errorf("get: unexpected output %q", got)
+	}
+
+	runCommand(t, "gain: !degrees 180\nmode: fast\n", args("load", "-", "/controller")...)
+	if got := runCommand(t, "", args("list", "/controller")...); got != "/controller/gain\n/controller/mode\n" {
+		t.Errorf("list: unexpected output %q", got)
+	}
+	if got := runCommand(t, "", args("dump", "-", "/controller")...); got != "gain: 3.141592653589793\nmode: fast\n" {
+		t.Errorf("dump: unexpected output %q", got)
+	}
+
+	filename := filepath.Join(dir, "arm.yaml")
+	runCommand(t, "", args("dump", filename, "/arm")...)
+	runCommand(t, "", args("load", filename, "/copy")...)
+	if got := runCommand(t, "", args("get", "/copy/joints")...); got != "- shoulder\n- elbow\n" {
+		t.Errorf("get: unexpected output %q", got)
+	}
+
+	textfile := filepath.Join(dir, "description.txt")
+	if err := ioutil.WriteFile(textfile, []byte("<robot/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runCommand(t, "", args("set", "-t", textfile, "/description")...)
+	if got := runCommand(t, "", args("get", "/description")...); got != "<robot/>\n" {
+		t.Errorf("get: unexpected output %q", got)
+	}
+
+	runCommand(t, "", args("delete", "/arm")...)
+	if got := runCommand(t, "", args("list")...); got != "/controller/gain\n/controller/mode\n/copy/joints\n/description\n/rate\n" {
+		t.Errorf("list: unexpected output %q", got)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(args("get", "/arm"), strings.NewReader(""), &stdout, &stderr); code == 0 {
+		t.Error("expected get of a deleted parameter to fail")
+	}
+	if code := run([]string{"unknown"}, strings.NewReader(""), &stdout, &stderr); code == 0 {
+		t.Error("expected an unknown command to fail")
+	}
+}
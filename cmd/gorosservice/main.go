@@ -0,0 +1,235 @@
+// gorosservice lists and calls ROS services. It is a rosservice replacement
+// which needs no Python ROS installation. Service types are read from the
+// .srv files found in ROS_PACKAGE_PATH.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+	"github.com/fetchrobotics/rosgo/yaml"
+)
+
+const usage = `USAGE: gorosservice <command> [options] [args]
+
+Commands:
+	gorosservice list [-n] [namespace]		list active services
+	gorosservice info <service>			print information about a service
+	gorosservice type <service>			print the type of a service
+	gorosservice uri <service>			print the rosrpc URI of a service
+	gorosservice call [-t timeout] <service> [args...]
+							call a service with YAML arguments
+`
+
+type command struct {
+	node ros.Node
+	ctx  *dynamic.Context
+	out  io.Writer
+}
+
+var handlers = map[string]func(c *command, args []string) error{
+	"list": (*command).list,
+	"info": (*command).info,
+	"type": (*command).typeOf,
+	"uri":  (*command).uri,
+	"call": (*command).call,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var name string
+	for _, arg := range args {
+		if !strings.Contains(arg, ros.Remap) {
+			name = arg
+			break
+		}
+	}
+	handler, ok := handlers[name]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return 1
+	}
+
+	node, err := ros.NewNode(cli.AnonymousName("gorosservice"), args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer node.Shutdown()
+
+	rest := node.NonRosArgs()
+	for i, arg := range rest {
+		if arg == name {
+			rest = append(rest[:i:i], rest[i+1:]...)
+			break
+		}
+	}
+	c := &command{node, dynamic.NewContextFromEnv(), stdout}
+	if err := handler(c, rest); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func (c *command) list(args []string) error {
+	fs := cli.NewFlagSet("list")
+	nodes := fs.Bool("n", false, "print the node providing each service")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	namespace := "/"
+	if len(args) > 0 {
+		namespace = cli.ResolveName(args[0])
+	}
+	state, err := c.node.Graph().SystemState()
+	if err != nil {
+		return err
+	}
+	var services []string
+	for s := range state.Services {
+		if namespace == "/" || s == namespace || strings.HasPrefix(s, namespace+"/") {
+			services = append(services, s)
+		}
+	}
+	sort.Strings(services)
+	for _, s := range services {
+		if *nodes {
+			fmt.Fprintf(c.out, "%s %s\n", s, strings.Join(state.Services[s], " "))
+		} else {
+			fmt.Fprintln(c.out, s)
+		}
+	}
+	return nil
+}
+
+func oneService(name string, args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("usage: gorosservice %s <service>", name)
+	}
+	return cli.ResolveName(args[0]), nil
+}
+
+func (c *command) info(args []string) error {
+	service, err := oneService("info", args)
+	if err != nil {
+		return err
+	}
+	graph := c.node.Graph()
+	uri, err := graph.LookupService(service)
+	if err != nil {
+		return err
+	}
+	header, err := graph.ProbeService(service)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Node: %s\n", header["callerid"])
+	fmt.Fprintf(c.out, "URI: %s\n", uri)
+	fmt.Fprintf(c.out, "Type: %s\n", header["type"])
+	if srvType, err := c.ctx.ServiceType(header["type"]); err == nil {
+		var names []string
+		for _, f := range srvType.Request().Fields() {
+			names = append(names, f.Name)
+		}
+		fmt.Fprintf(c.out, "Args: %s\n", strings.Join(names, " "))
+	} else {
+		fmt.Fprintf(c.out, "Args: unknown (%v)\n", err)
+	}
+	return nil
+}
+
+func (c *command) typeOf(args []string) error {
+	service, err := oneService("type", args)
+	if err != nil {
+		return err
+	}
+	header, err := c.node.Graph().ProbeService(service)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, header["type"])
+	return nil
+}
+
+func (c *command) uri(args []string) error {
+	service, err := oneService("uri", args)
+	if err != nil {
+		return err
+	}
+	uri, err := c.node.Graph().LookupService(service)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.out, uri)
+	return nil
+}
+
+func (c *command) call(args []string) error {
+	fs := cli.NewFlagSet("call")
+	timeout := fs.Duration("t", 5*time.Second, "timeout of each network operation")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return fmt.Errorf("usage: gorosservice call [-t timeout] <service> [args...]")
+	}
+	service := cli.ResolveName(args[0])
+	header, err := c.node.Graph().ProbeService(service)
+	if err != nil {
+		return err
+	}
+	srvType, err := c.ctx.ServiceType(header["type"])
+	if err != nil {
+		return err
+	}
+	if srvType.MD5Sum() != header["md5sum"] {
+		return fmt.Errorf("definition of %s does not match the service: MD5 sum %s instead of %s",
+			srvType.Name(), srvType.MD5Sum(), header["md5sum"])
+	}
+
+	// A single argument is a YAML document and several arguments are the
+	// field values in definition order.
+	srv := srvType.New()
+	var value interface{}
+	if len(args) == 2 {
+		if value, err = yaml.Unmarshal([]byte(args[1])); err != nil {
+			return err
+		}
+	} else if len(args) > 2 {
+		var values []interface{}
+		for _, arg := range args[1:] {
+			v, err := yaml.Unmarshal([]byte(arg))
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+		}
+		value = values
+	}
+	if err := srv.Request.Fill(value); err != nil {
+		return err
+	}
+
+	client := c.node.NewServiceClient(service, srvType, ros.ServiceClientTCPTimeout(*timeout))
+	defer client.Shutdown()
+	if err := client.Call(srv); err != nil {
+		return fmt.Errorf("service call failed: %v", err)
+	}
+	if len(srvType.Response().Fields()) > 0 {
+		fmt.Fprintln(c.out, srv.Response.String())
+	}
+	return nil
+}
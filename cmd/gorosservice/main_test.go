@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+const setBool = "bool data\n---\nbool success\nstring message\n"
+
+func setupPackagePath(t *testing.T) {
+	root, err := ioutil.TempDir("", "gorosservice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	dir := filepath.Join(root, "std_srvs")
+	os.MkdirAll(filepath.Join(dir, "srv"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "package.xml"), []byte("<package/>"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "srv", "SetBool.srv"), []byte(setBool), 0644)
+	os.Setenv("ROS_PACKAGE_PATH", root)
+}
+
+func runCommand(t *testing.T, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	if code := run(args, &stdout, &stderr); code != 0 {
+		t.Fatalf("%v failed: %s", args, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestServiceCommands(t *testing.T) {
+	setupPackagePath(t)
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	args := func(a ...string) []string { return append(a, rosArgs...) }
+
+	srvType, err := dynamic.NewContextFromEnv().ServiceType("std_srvs/SetBool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := ros.NewNode("/server", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := node.NewServiceServer("/toggle", srvType, func(srv *dynamic.Service) error {
+		data, _ := srv.Request.Get("data")
+		srv.Response.Data["success"] = data
+		if data == true {
+			srv.Response.Data["message"] = "on"
+		}
+		return nil
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		node.Spin()
+	}()
+	defer func() {
+		server.Shutdown()
+		node.Shutdown()
+		<-done
+	}()
+
+	if got := runCommand(t, args("list")...); got != "/toggle\n" {
+		t.Errorf("list: unexpected output %q", got)
+	}
+	if got := runCommand(t, args("list", "-n", "/other")...); got != "" {
+		t.Errorf("list /other: unexpected output %q", got)
+	}
+	if got := runCommand(t, args("list", "-n")...); got != "/toggle /server\n" {
+		t.Errorf("list -n: unexpected output %q", got)
+	}
+	if got := runCommand(t, args("type", "toggle")...); got != "std_srvs/SetBool\n" {
+		t.Errorf("type: unexpected output %q", got)
+	}
+	uri := runCommand(t, args("uri", "/toggle")...)
+	if !strings.HasPrefix(uri, "rosrpc://127.0.0.1:") {
+		t.Errorf("uri: unexpected output %q", uri)
+	}
+	info := runCommand(t, args("info", "/toggle")...)
+	for _, want := range []string{"Node: /server\n", "URI: " + uri, "Type: std_srvs/SetBool\n", "Args: data\n"} {
+		if !strings.Contains(info, want) {
+			t.Errorf("info: expected %q in %q", want, info)
+		}
+	}
+
+	if got, want := runCommand(t, args("call", "/toggle", "data: true")...), "success: True\nmessage: \"on\"\n"; got != want {
+		t.Errorf("call with a dictionary: expected %q but %q", want, got)
+	}
+	if got, want := runCommand(t, args("call", "/toggle", "false")...), "success: False\nmessage: ''\n"; got != want {
+		t.Errorf("call with positional values: expected %q but %q", want, got)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run(args("call", "/missing"), &stdout, &stderr); code == 0 {
+		t.Error("call of a missing service should fail")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+func (c *command) echo(args []string) error {
+	fs := cli.NewFlagSet("echo")
+	count := fs.Int("n", 0, "exit after printing count messages")
+	asJSON := fs.Bool("json", false, "print messages as JSON, one per line")
+	noArrays := fs.Bool("noarr", false, "hide the content of arrays")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gorostopic echo [-n count] [--json] [--noarr] <topic>[/field]")
+	}
+	topic, _, field, err := c.findTopic(args[0])
+	if err != nil {
+		return err
+	}
+
+	received := 0
+	var callbackErr error
+	sub := c.node.NewSubscriber(topic, ros.AnyMessageType, func(raw *ros.RawMessage, event ros.MessageEvent) {
+		if callbackErr != nil {
+			return
+		}
+		msg, err := c.decode(raw, event)
+		if err != nil {
+			callbackErr = err
+			return
+		}
+		var value interface{} = msg
+		if len(field) > 0 {
+			if value, err = msg.Get(field); err != nil {
+				callbackErr = err
+				return
+			}
+		}
+		if *noArrays {
+			value = hideArrays(value)
+		}
+		if *asJSON {
+			fmt.Fprintf(c.out, "%s\n", dynamic.ToJSON(value))
+		} else {
+			fmt.Fprintf(c.out, "%s\n---\n", dynamic.FormatValue(value))
+		}
+		received++
+	})
+	defer sub.Shutdown()
+
+	for c.running() && callbackErr == nil && (*count <= 0 || received < *count) {
+		c.node.SpinOnce()
+	}
+	return callbackErr
+}
+
+func (c *command) decode(raw *ros.RawMessage, event ros.MessageEvent) (*dynamic.Message, error) {
+	msgType, err := c.ctx.ConnectionType(event.ConnectionHeader)
+	if err != nil {
+		return nil, err
+	}
+	msg := msgType.New()
+	if err := msg.Deserialize(ros.NewReader(raw.Bytes)); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// hideArrays replaces arrays by a description of their length.
+func hideArrays(value interface{}) interface{} {
+	switch v := value.(type) {
+	case *dynamic.Message:
+		m := v.Type().New()
+		for k, item := range v.Data {
+			m.Data[k] = hideArrays(item)
+		}
+		return m
+	case []interface{}:
+		return fmt.Sprintf("<array of length %d>", len(v))
+	case []byte:
+		return fmt.Sprintf("<array of length %d>", len(v))
+	}
+	return value
+}
+
+// window keeps the last samples of a statistic.
+type window struct {
+	size    int
+	samples []float64
+}
+
+func (w *window) add(x float64) {
+	w.samples = append(w.samples, x)
+	if w.size > 0 && len(w.samples) > w.size {
+		w.samples = w.samples[len(w.samples)-w.size:]
+	}
+}
+
+func (w *window) stats() (mean, min, max, stddev float64) {
+	min, max = math.Inf(1), math.Inf(-1)
+	for _, x := range w.samples {
+		mean += x
+		min = math.Min(min, x)
+		max = math.Max(max, x)
+	}
+	mean /= float64(len(w.samples))
+	for _, x := range w.samples {
+		stddev += (x - mean) * (x - mean)
+	}
+	stddev = math.Sqrt(stddev / float64(len(w.samples)))
+	return
+}
+
+// monitor subscribes to topic and prints report every second until the
+// command ends. sample is called for each message and returns an error to
+// abort.
+func (c *command) monitor(topic string, sample func(raw *ros.RawMessage, event ros.MessageEvent) error, report func()) error {
+	var callbackErr error
+	updated := false
+	sub := c.node.NewSubscriber(topic, ros.AnyMessageType, func(raw *ros.RawMessage, event ros.MessageEvent) {
+		if callbackErr == nil {
+			callbackErr = sample(raw, event)
+			updated = true
+		}
+	})
+	defer sub.Shutdown()
+
+	last := time.Now()
+	for c.running() && callbackErr == nil {
+		c.node.SpinOnce()
+		if time.Since(last) >= time.Second {
+			last = time.Now()
+			if updated {
+				report()
+			} else {
+				fmt.Fprintln(c.out, "no new messages")
+			}
+			updated = false
+		}
+	}
+	return callbackErr
+}
+
+func (c *command) parseMonitorArgs(name string, args []string, defaultWindow int) (string, *window, error) {
+	fs := cli.NewFlagSet(name)
+	size := fs.Int("w", defaultWindow, "number of samples used for the statistics, 0 for unlimited")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(args) != 1 {
+		return "", nil, fmt.Errorf("usage: gorostopic %s [-w window] <topic>", name)
+	}
+	return cli.ResolveName(args[0]), &window{size: *size}, nil
+}
+
+func (c *command) hz(args []string) error {
+	topic, w, err := c.parseMonitorArgs("hz", args, 50000)
+	if err != nil {
+		return err
+	}
+	var last time.Time
+	return c.monitor(topic, func(raw *ros.RawMessage, event ros.MessageEvent) error {
+		if !last.IsZero() {
+			w.add(event.ReceiptTime.Sub(last).Seconds())
+		}
+		last = event.ReceiptTime
+		return nil
+	}, func() {
+		if len(w.samples) == 0 {
+			return
+		}
+		mean, min, max, stddev := w.stats()
+		fmt.Fprintf(c.out, "average rate: %.3f\n\tmin: %.3fs max: %.3fs std dev: %.5fs window: %d\n",
+			1/mean, min, max, stddev, len(w.samples)+1)
+	})
+}
+
+func formatBytes(b float64) string {
+	switch {
+	case b >= 1000000:
+		return fmt.Sprintf("%.2fMB", b/1000000)
+	case b >= 1000:
+		return fmt.Sprintf("%.2fKB", b/1000)
+	}
+	return fmt.Sprintf("%.2fB", b)
+}
+
+func (c *command) bw(args []string) error {
+	topic, w, err := c.parseMonitorArgs("bw", args, 100)
+	if err != nil {
+		return err
+	}
+	var times []time.Time
+	return c.monitor(topic, func(raw *ros.RawMessage, event ros.MessageEvent) error {
+		w.add(float64(len(raw.Bytes)))
+		times = append(times, event.ReceiptTime)
+		if len(times) > len(w.samples) {
+			times = times[len(times)-len(w.samples):]
+		}
+		return nil
+	}, func() {
+		mean, min, max, _ := w.stats()
+		elapsed := time.Since(times[0]).Seconds()
+		total := mean * float64(len(w.samples))
+		fmt.Fprintf(c.out, "average: %s/s\n\tmean: %s min: %s max: %s window: %d\n",
+			formatBytes(total/elapsed), formatBytes(mean), formatBytes(min), formatBytes(max), len(w.samples))
+	})
+}
+
+func (c *command) delay(args []string) error {
+	topic, w, err := c.parseMonitorArgs("delay", args, 50000)
+	if err != nil {
+		return err
+	}
+	return c.monitor(topic, func(raw *ros.RawMessage, event ros.MessageEvent) error {
+		msg, err := c.decode(raw, event)
+		if err != nil {
+			return err
+		}
+		stamp, err := msg.Get("header/stamp")
+		if err != nil {
+			return fmt.Errorf("%s has no header", msg.Type().Name())
+		}
+		t := stamp.(ros.Time)
+		w.add(event.ReceiptTime.Sub(time.Unix(int64(t.Sec), int64(t.NSec))).Seconds())
+		return nil
+	}, func() {
+		mean, min, max, stddev := w.stats()
+		fmt.Fprintf(c.out, "average delay: %.3f\n\tmin: %.3fs max: %.3fs std dev: %.5fs window: %d\n",
+			mean, min, max, stddev, len(w.samples))
+	})
+}
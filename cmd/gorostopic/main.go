@@ -0,0 +1,263 @@
+// gorostopic displays information about ROS topics and publishes messages.
+// It is a rostopic replacement which needs no Python ROS installation.
+// Message types are read from the message_definition connection header or
+// from the .msg files found in ROS_PACKAGE_PATH.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+const usage = `USAGE: gorostopic <command> [options] [args]
+
+Commands:
+	gorostopic list [-v] [-p|-s] [namespace]	list active topics
+	gorostopic info <topic>				print information about a topic
+	gorostopic type <topic>				print the type of a topic
+	gorostopic echo [-n count] [--json] [--noarr] <topic>[/field]
+							print messages
+	gorostopic hz [-w window] <topic>		print the publishing rate
+	gorostopic bw [-w window] <topic>		print the bandwidth
+	gorostopic delay [-w window] <topic>		print the delay from header stamps
+	gorostopic pub [-r rate] [-1] [-l] <topic> <type> [args...]
+							publish a message
+`
+
+// command is the environment of a running subcommand.
+type command struct {
+	node ros.Node
+	ctx  *dynamic.Context
+	out  io.Writer
+	// stop ends long running commands besides node shutdown.
+	stop <-chan struct{}
+}
+
+var handlers = map[string]func(c *command, args []string) error{
+	"list":  (*command).list,
+	"info":  (*command).info,
+	"type":  (*command).typeOf,
+	"echo":  (*command).echo,
+	"hz":    (*command).hz,
+	"bw":    (*command).bw,
+	"delay": (*command).delay,
+	"pub":   (*command).pub,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr, nil))
+}
+
+func run(args []string, stdout, stderr io.Writer, stop <-chan struct{}) int {
+	var name string
+	for _, arg := range args {
+		if !strings.Contains(arg, ros.Remap) {
+			name = arg
+			break
+		}
+	}
+	handler, ok := handlers[name]
+	if !ok {
+		fmt.Fprint(stderr, usage)
+		return 1
+	}
+
+	node, err := ros.NewNode(cli.AnonymousName("gorostopic"), args)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer node.Shutdown()
+
+	rest := node.NonRosArgs()
+	for i, arg := range rest {
+		if arg == name {
+			rest = append(rest[:i:i], rest[i+1:]...)
+			break
+		}
+	}
+	c := &command{node, dynamic.NewContextFromEnv(), stdout, stop}
+	if err := handler(c, rest); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// running tells whether long running commands should continue.
+func (c *command) running() bool {
+	select {
+	case <-c.stop:
+		return false
+	default:
+	}
+	return c.node.OK()
+}
+
+// findTopic splits a name into a known topic and a field path.
+func (c *command) findTopic(name string) (topic string, topicType string, field string, err error) {
+	name = cli.ResolveName(name)
+	topics, err := c.node.Graph().TopicTypes()
+	if err != nil {
+		return "", "", "", err
+	}
+	types := make(map[string]string)
+	for _, t := range topics {
+		types[t.Name] = t.Type
+	}
+	for candidate := name; candidate != "/"; candidate = path.Dir(candidate) {
+		if t, ok := types[candidate]; ok {
+			return candidate, t, strings.TrimPrefix(strings.TrimPrefix(name, candidate), "/"), nil
+		}
+	}
+	return name, "", "", nil
+}
+
+func (c *command) list(args []string) error {
+	fs := cli.NewFlagSet("list")
+	verbose := fs.Bool("v", false, "list topic types and publisher and subscriber counts")
+	pubOnly := fs.Bool("p", false, "list only published topics")
+	subOnly := fs.Bool("s", false, "list only subscribed topics")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	namespace := "/"
+	if len(args) > 0 {
+		namespace = cli.ResolveName(args[0])
+	}
+	inNamespace := func(topic string) bool {
+		return namespace == "/" || topic == namespace || strings.HasPrefix(topic, namespace+"/")
+	}
+
+	graph := c.node.Graph()
+	state, err := graph.SystemState()
+	if err != nil {
+		return err
+	}
+	topics, err := graph.TopicTypes()
+	if err != nil {
+		return err
+	}
+	types := make(map[string]string)
+	for _, t := range topics {
+		types[t.Name] = t.Type
+	}
+
+	if !*verbose {
+		set := make(map[string]bool)
+		if !*subOnly {
+			for t := range state.Publishers {
+				set[t] = true
+			}
+		}
+		if !*pubOnly {
+			for t := range state.Subscribers {
+				set[t] = true
+			}
+		}
+		for _, t := range sortedKeys(set) {
+			if inNamespace(t) {
+				fmt.Fprintln(c.out, t)
+			}
+		}
+		return nil
+	}
+
+	printSection := func(title string, m map[string][]string, noun string) {
+		fmt.Fprintf(c.out, "%s:\n", title)
+		names := make(map[string]bool)
+		for t := range m {
+			names[t] = true
+		}
+		for _, t := range sortedKeys(names) {
+			if !inNamespace(t) {
+				continue
+			}
+			n := len(m[t])
+			plural := noun
+			if n != 1 {
+				plural += "s"
+			}
+			fmt.Fprintf(c.out, " * %s [%s] %d %s\n", t, types[t], n, plural)
+		}
+		fmt.Fprintln(c.out)
+	}
+	if !*subOnly {
+		printSection("Published topics", state.Publishers, "publisher")
+	}
+	if !*pubOnly {
+		printSection("Subscribed topics", state.Subscribers, "subscriber")
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c *command) info(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gorostopic info <topic>")
+	}
+	topic, topicType, _, err := c.findTopic(args[0])
+	if err != nil {
+		return err
+	}
+	if len(topicType) == 0 {
+		return fmt.Errorf("unknown topic %s", topic)
+	}
+	graph := c.node.Graph()
+	state, err := graph.SystemState()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "Type: %s\n\n", topicType)
+	for _, section := range []struct {
+		title string
+		nodes []string
+	}{{"Publishers", state.Publishers[topic]}, {"Subscribers", state.Subscribers[topic]}} {
+		if len(section.nodes) == 0 {
+			fmt.Fprintf(c.out, "%s: None\n\n", section.title)
+			continue
+		}
+		fmt.Fprintf(c.out, "%s:\n", section.title)
+		for _, n := range section.nodes {
+			uri, err := graph.LookupNode(n)
+			if err != nil {
+				uri = "unknown"
+			}
+			fmt.Fprintf(c.out, " * %s (%s)\n", n, uri)
+		}
+		fmt.Fprintln(c.out)
+	}
+	return nil
+}
+
+func (c *command) typeOf(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gorostopic type <topic>")
+	}
+	topic, topicType, _, err := c.findTopic(args[0])
+	if err != nil {
+		return err
+	}
+	if len(topicType) == 0 {
+		return fmt.Errorf("unknown topic %s", topic)
+	}
+	fmt.Fprintln(c.out, topicType)
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+)
+
+func setupPackagePath(t *testing.T) {
+	root, err := ioutil.TempDir("", "gorostopic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	for pkg, msgs := range map[string]map[string]string{
+		"std_msgs":  {"String": "string data\n", "Header": "uint32 seq\ntime stamp\nstring frame_id\n"},
+		"test_msgs": {"Stamped": "Header header\nfloat64[] values\n"},
+	} {
+		dir := filepath.Join(root, pkg)
+		os.MkdirAll(filepath.Join(dir, "msg"), 0755)
+		ioutil.WriteFile(filepath.Join(dir, "package.xml"), []byte("<package/>"), 0644)
+		for name, text := range msgs {
+			ioutil.WriteFile(filepath.Join(dir, "msg", name+".msg"), []byte(text), 0644)
+		}
+	}
+	os.Setenv("ROS_PACKAGE_PATH", root)
+}
+
+type background struct {
+	stop chan struct{}
+	wg   sync.WaitGroup
+	out  bytes.Buffer
+}
+
+// start runs a command until stopped.
+func start(t *testing.T, args ...string) *background {
+	b := &background{stop: make(chan struct{})}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		var stderr bytes.Buffer
+		if code := run(args, &b.out, &stderr, b.stop); code != 0 {
+			t.Errorf("%v failed: %s", args, stderr.String())
+		}
+	}()
+	return b
+}
+
+func (b *background) wait() string {
+	close(b.stop)
+	b.wg.Wait()
+	return b.out.String()
+}
+
+func runCommand(t *testing.T, args ...string) string {
+	var stdout, stderr bytes.Buffer
+	if code := run(args, &stdout, &stderr, nil); code != 0 {
+		t.Fatalf("%v failed: %s", args, stderr.String())
+	}
+	return stdout.String()
+}
+
+func TestTopicCommands(t *testing.T) {
+	setupPackagePath(t)
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	args := func(a ...string) []string { return append(a, rosArgs...) }
+
+	pub := start(t, args("pub", "-r", "20", "/chatter", "std_msgs/String", "data: hello")...)
+	stamped := start(t, args("pub", "-r", "20", "stamped", "test_msgs/Stamped", "{header: {stamp: now}, values: [1, 2.5]}")...)
+	time.Sleep(200 * time.Millisecond)
+
+	if out := runCommand(t, args("list")...); out != "/chatter\n/stamped\n" {
+		t.Errorf("unexpected list output %q", out)
+	}
+	if out := runCommand(t, args("list", "-v", "-p")...); !strings.Contains(out, " * /chatter [std_msgs/String] 1 publisher\n") {
+		t.Errorf("unexpected verbose list output %q", out)
+	}
+	if out := runCommand(t, args("type", "/chatter")...); out != "std_msgs/String\n" {
+		t.Errorf("unexpected type output %q", out)
+	}
+	if out := runCommand(t, args("info", "/chatter")...); !strings.HasPrefix(out, "Type: std_msgs/String\n\nPublishers:\n * /gorostopic_") ||
+		!strings.HasSuffix(out, "Subscribers: None\n\n") {
+		t.Errorf("unexpected info output %q", out)
+	}
+
+	if out := runCommand(t, args("echo", "-n", "2", "/chatter")...); out != "data: \"hello\"\n---\ndata: \"hello\"\n---\n" {
+		t.Errorf("unexpected echo output %q", out)
+	}
+	if out := runCommand(t, args("echo", "/stamped/values", "-n", "1", "--json")...); out != "[1,2.5]\n" {
+		t.Errorf("unexpected echo output %q", out)
+	}
+	if out := runCommand(t, args("echo", "-n", "1", "--noarr", "/stamped/values")...); out != "\"<array of length 2>\"\n---\n" {
+		t.Errorf("unexpected echo output %q", out)
+	}
+
+	hz := start(t, args("hz", "/chatter")...)
+	bw := start(t, args("bw", "/chatter")...)
+	delay := start(t, args("delay", "/stamped")...)
+	time.Sleep(1500 * time.Millisecond)
+	if out := hz.wait(); !strings.HasPrefix(out, "average rate: ") {
+		t.Errorf("unexpected hz output %q", out)
+	}
+	if out := bw.wait(); !strings.HasPrefix(out, "average: ") || !strings.Contains(out, "mean: 9.00B") {
+		t.Errorf("unexpected bw output %q", out)
+	}
+	if out := delay.wait(); !strings.HasPrefix(out, "average delay: 0.0") {
+		t.Errorf("unexpected delay output %q", out)
+	}
+
+	pub.wait()
+	stamped.wait()
+}
+
+func TestPubOnce(t *testing.T) {
+	setupPackagePath(t)
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+
+	onceDuration = time.Second
+	pub := start(t, append([]string{"pub", "-1", "/latched", "std_msgs/String", "--", "-once"}, rosArgs...)...)
+	time.Sleep(200 * time.Millisecond)
+
+	// The message is published before the subscription and received since
+	// it is latched.
+	if out := runCommand(t, append([]string{"echo", "-n", "1", "/latched"}, rosArgs...)...); out != "data: \"-once\"\n---\n" {
+		t.Errorf("unexpected echo output %q", out)
+	}
+	pub.wait()
+
+	var stdout, stderr bytes.Buffer
+	if code := run(append([]string{"pub", "-1", "/x", "unknown_msgs/Unknown"}, rosArgs...), &stdout, &stderr, nil); code == 0 {
+		t.Error("pub of an unknown type succeeded")
+	}
+	stderr.Reset()
+	if code := run([]string{"unknown"}, &stdout, &stderr, nil); code == 0 || !strings.HasPrefix(stderr.String(), "USAGE") {
+		t.Error("unknown command succeeded")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/cmd/internal/cli"
+	"github.com/fetchrobotics/rosgo/ros"
+	"github.com/fetchrobotics/rosgo/yaml"
+)
+
+// onceDuration is how long the message is latched in once mode.
+var onceDuration = 3 * time.Second
+
+func (c *command) pub(args []string) error {
+	fs := cli.NewFlagSet("pub")
+	rate := fs.Float64("r", 0, "publishing rate in Hz, 0 to publish once")
+	once := fs.Bool("1", false, "publish one message, latch it for 3 seconds and exit")
+	latch := fs.Bool("l", false, "latch the messages when publishing at a rate")
+	args, err := cli.ParseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: gorostopic pub [-r rate] [-1] [-l] <topic> <type> [args...]")
+	}
+	topic := cli.ResolveName(args[0])
+	msgType, err := c.ctx.MessageType(args[1])
+	if err != nil {
+		return err
+	}
+
+	// A single argument is a YAML document and several arguments are the
+	// field values in definition order.
+	msg := msgType.New()
+	var value interface{}
+	if len(args) == 3 {
+		value, err = yaml.Unmarshal([]byte(args[2]))
+	} else if len(args) > 3 {
+		var values []interface{}
+		for _, arg := range args[2:] {
+			v, err := yaml.Unmarshal([]byte(arg))
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+		}
+		value = values
+	}
+	if err != nil {
+		return err
+	}
+	if err := msg.Fill(value); err != nil {
+		return err
+	}
+
+	latched := *latch || *rate <= 0
+	pub := c.node.NewPublisher(topic, msgType, ros.PublisherLatched(latched))
+	defer pub.Shutdown()
+
+	if *rate > 0 && !*once {
+		r := ros.NewRate(*rate, ros.RateClock(c.node.Clock()))
+		for c.running() {
+			// Refill to evaluate "now" stamps for every message.
+			msg = msgType.New()
+			if err := msg.Fill(value); err != nil {
+				return err
+			}
+			pub.Publish(msg)
+			c.node.SpinOnce()
+			r.Sleep()
+		}
+		return nil
+	}
+
+	pub.Publish(msg)
+	if *once {
+		fmt.Fprintf(c.out, "publishing and latching message for %v\n", onceDuration)
+		deadline := time.Now().Add(onceDuration)
+		for c.running() && time.Now().Before(deadline) {
+			c.node.SpinOnce()
+		}
+		return nil
+	}
+	fmt.Fprintln(c.out, "publishing and latching message. Press ctrl-C to terminate")
+	for c.running() {
+		c.node.SpinOnce()
+	}
+	return nil
+}
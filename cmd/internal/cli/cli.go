@@ -0,0 +1,64 @@
+// Package cli gathers helpers shared by the command line tools.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// NewFlagSet creates a flag set which reports errors instead of exiting.
+func NewFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+// ParseFlags parses flags placed anywhere among the positional arguments
+// and returns the positional arguments. Arguments after "--" are positional.
+func ParseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// ResolveName resolves a graph name given on the command line against
+// ROS_NAMESPACE.
+func ResolveName(name string) string {
+	if strings.HasPrefix(name, "/") {
+		return path.Clean(name)
+	}
+	return path.Clean("/" + os.Getenv("ROS_NAMESPACE") + "/" + name)
+}
+
+// MasterURI returns the master URI given by a __master:= argument or
+// ROS_MASTER_URI.
+func MasterURI(args []string) string {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "__master:=") {
+			return strings.TrimPrefix(arg, "__master:=")
+		}
+	}
+	return os.Getenv("ROS_MASTER_URI")
+}
+
+// AnonymousName makes a unique node name from a base name.
+func AnonymousName(base string) string {
+	return fmt.Sprintf("/%s_%d_%d", base, os.Getpid(), time.Now().UnixNano())
+}
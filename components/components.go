@@ -0,0 +1,90 @@
+// Package components runs many nodes in one process, like nodelets.
+//
+// Component types are registered by name in a registry, usually from the
+// init function of the package implementing them:
+//
+//	func init() {
+//		components.Register("my_pkg/Driver", func(node ros.Node) (components.Component, error) {
+//			return newDriver(node)
+//		})
+//	}
+//
+// A Container loads and unloads named instances of the registered types,
+// each with its own namespace, remappings and arguments, either from Go or
+// through the load_nodelet, unload_nodelet and list services of a
+// nodelet manager:
+//
+//	node, _ := ros.NewNode("manager", os.Args[1:])
+//	container, _ := components.NewContainer(node)
+//	defer container.Shutdown()
+//	container.Load("/camera/driver", "my_pkg/Driver", nil, nil)
+//	node.Spin()
+//
+// Like nodelets, instances share the node of the container: each one gets a
+// child handle of it named after the instance, so the process has a single
+// XML-RPC server and master registration, and the callbacks of all the
+// instances are called by the Spin of the container node. Publishers and
+// subscribers of a topic are shared by the instances using it, but the
+// messages still go through a loopback TCPROS connection of the node;
+// rosgo has no zero-copy intra-process transport yet.
+package components
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// Component is a loaded instance of a component type.
+type Component interface {
+	// Shutdown releases the resources of the component before the
+	// publishers, subscribers and services created through its node are
+	// shut down.
+	Shutdown()
+}
+
+// Factory creates a component running on node. The arguments given to the
+// component are the non-ROS arguments of node. Factories of components
+// loaded through the services run in a callback of the container node, so
+// they must not wait for other callbacks.
+type Factory func(node ros.Node) (Component, error)
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[string]Factory{}
+)
+
+// Register registers the factory of a component type. It panics when the
+// type is already registered.
+func Register(typ string, factory Factory) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if factory == nil {
+		panic(fmt.Sprintf("components: nil factory of %s", typ))
+	}
+	if _, ok := registry[typ]; ok {
+		panic(fmt.Sprintf("components: %s is registered twice", typ))
+	}
+	registry[typ] = factory
+}
+
+// Types returns the sorted names of the registered component types.
+func Types() []string {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	types := make([]string, 0, len(registry))
+	for typ := range registry {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+	return types
+}
+
+func factory(typ string) (Factory, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	f, ok := registry[typ]
+	return f, ok
+}
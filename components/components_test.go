@@ -0,0 +1,260 @@
+package components
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+var textType *dynamic.MessageType
+
+// received records the messages of the listeners by node name.
+var received = struct {
+	sync.Mutex
+	messages map[string][]string
+}{messages: map[string][]string{}}
+
+type talker struct {
+	pub ros.Publisher
+}
+
+func (t *talker) Shutdown() { t.pub.Shutdown() }
+
+type listener struct {
+	sub ros.Subscriber
+}
+
+func (l *listener) Shutdown() { l.sub.Shutdown() }
+
+func init() {
+	var err error
+	if textType, err = dynamic.NewContext(nil).AddDefinition("test_msgs/Text", "string data\n"); err != nil {
+		panic(err)
+	}
+	Register("test/Talker", func(node ros.Node) (Component, error) {
+		pub := node.NewPublisher("chatter", textType, ros.PublisherLatched(true))
+		msg := textType.New()
+		text := "hello"
+		if args := node.NonRosArgs(); len(args) > 0 {
+			text = args[0]
+		}
+		msg.Data["data"] = text
+		pub.Publish(msg)
+		return &talker{pub}, nil
+	})
+	Register("test/Listener", func(node ros.Node) (Component, error) {
+		name := node.Name()
+		sub := node.NewSubscriber("chatter", textType, func(msg *dynamic.Message) {
+			received.Lock()
+			defer received.Unlock()
+			received.messages[name] = append(received.messages[name], msg.Data["data"].(string))
+		})
+		return &listener{sub}, nil
+	})
+}
+
+func waitForMessage(t *testing.T, name, want string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		received.Lock()
+		messages := received.messages[name]
+		received.Unlock()
+		for _, m := range messages {
+			if m == want {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s did not receive %q but %v", name, want, messages)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if types := Types(); !reflect.DeepEqual(types, []string{"test/Listener", "test/Talker"}) {
+		t.Errorf("unexpected types %v", types)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a type registered twice")
+		}
+	}()
+	Register("test/Talker", func(node ros.Node) (Component, error) { return nil, nil })
+}
+
+func TestServiceTypes(t *testing.T) {
+	for _, tc := range []struct {
+		name, md5sum, want string
+	}{
+		{"NodeletLoad", NodeletLoadType.MD5Sum(), "8cfbf33bf3fbd4c54a833f6e2b105331"},
+		{"NodeletUnload", NodeletUnloadType.MD5Sum(), "d08a3b641c2f8680fbdfb1ea2e17a3e1"},
+		{"NodeletList", NodeletListType.MD5Sum(), "99c7b10e794f5600b8030e697e946ca7"},
+	} {
+		if tc.md5sum != tc.want {
+			t.Errorf("%s: expected md5sum %s but %s", tc.name, tc.want, tc.md5sum)
+		}
+	}
+}
+
+func TestContainer(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	node, err := ros.NewNode("/manager", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		wg.Wait()
+	}()
+	container, err := NewContainer(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Shutdown()
+
+	if err := container.Load("/camera/talker", "test/Talker", nil, []string{"image"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := container.Load("/viewer", "test/Listener", map[string]string{"chatter": "/camera/chatter"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessage(t, "viewer", "image")
+	// The components run on the node of the container.
+	if nodes, err := node.Graph().Nodes(); err != nil || !reflect.DeepEqual(nodes, []string{"/manager"}) {
+		t.Errorf("unexpected nodes %v, %v", nodes, err)
+	}
+	if err := container.Load("/viewer", "test/Listener", nil, nil); err == nil {
+		t.Error("expected an error for a name already loaded")
+	}
+	if err := container.Load("/other", "test/Unknown", nil, nil); err == nil {
+		t.Error("expected an error for an unknown type")
+	}
+
+	load := node.NewServiceClient("/manager/load_nodelet", NodeletLoadType)
+	defer load.Shutdown()
+	srv := NodeletLoadType.New()
+	srv.Request.Data["name"] = "/logger"
+	srv.Request.Data["type"] = "test/Listener"
+	srv.Request.Data["remap_source_args"] = []interface{}{"chatter"}
+	srv.Request.Data["remap_target_args"] = []interface{}{"/camera/chatter"}
+	if err := load.Call(srv); err != nil {
+		t.Fatal(err)
+	}
+	if !srv.Response.Data["success"].(bool) {
+		t.Fatal("failed to load through the service")
+	}
+	waitForMessage(t, "logger", "image")
+
+	list := node.NewServiceClient("/manager/list", NodeletListType)
+	defer list.Shutdown()
+	srv = NodeletListType.New()
+	if err := list.Call(srv); err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{"/camera/talker", "/logger", "/viewer"}
+	if got := srv.Response.Data["nodelets"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the components %v but %v", want, got)
+	}
+
+	unload := node.NewServiceClient("/manager/unload_nodelet", NodeletUnloadType)
+	defer unload.Shutdown()
+	for _, tc := range []struct {
+		name    string
+		success bool
+	}{
+		{"/logger", true},
+		{"/logger", false},
+	} {
+		srv := NodeletUnloadType.New()
+		srv.Request.Data["name"] = tc.name
+		if err := unload.Call(srv); err != nil {
+			t.Fatal(err)
+		}
+		if success := srv.Response.Data["success"].(bool); success != tc.success {
+			t.Errorf("unloading %s: expected success %v but %v", tc.name, tc.success, success)
+		}
+	}
+	if err := container.Unload("/viewer"); err != nil {
+		t.Error(err)
+	}
+	if err := container.Unload("/viewer"); err == nil {
+		t.Error("expected an error for a component not loaded")
+	}
+	if names := container.List(); !reflect.DeepEqual(names, []string{"/camera/talker"}) {
+		t.Errorf("unexpected components %v", names)
+	}
+}
+
+func TestContainerReload(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	node, err := ros.NewNode("/reloader", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		wg.Wait()
+	}()
+	container, err := NewContainer(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer container.Shutdown()
+
+	if err := container.Load("/talker", "test/Talker", nil, []string{"first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := container.Load("/reloaded", "test/Listener", map[string]string{"chatter": "/chatter"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessage(t, "reloaded", "first")
+
+	// A reloaded talker publishes on the topic of the unloaded one.
+	if err := container.Unload("/talker"); err != nil {
+		t.Fatal(err)
+	}
+	if err := container.Load("/talker", "test/Talker", nil, []string{"second"}); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessage(t, "reloaded", "second")
+
+	// A reloaded listener subscribes the topic of the unloaded one.
+	if err := container.Unload("/reloaded"); err != nil {
+		t.Fatal(err)
+	}
+	received.Lock()
+	delete(received.messages, "reloaded")
+	received.Unlock()
+	if err := container.Load("/reloaded", "test/Listener", map[string]string{"chatter": "/chatter"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitForMessage(t, "reloaded", "second")
+}
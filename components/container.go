@@ -0,0 +1,244 @@
+package components
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+var (
+	// NodeletLoadType is the nodelet/NodeletLoad type of the load_nodelet
+	// service.
+	NodeletLoadType *dynamic.ServiceType
+	// NodeletUnloadType is the nodelet/NodeletUnload type of the
+	// unload_nodelet service.
+	NodeletUnloadType *dynamic.ServiceType
+	// NodeletListType is the nodelet/NodeletList type of the list service.
+	NodeletListType *dynamic.ServiceType
+)
+
+func init() {
+	ctx := dynamic.NewContext(nil)
+	var err error
+	if NodeletLoadType, err = ctx.AddServiceDefinition("nodelet/NodeletLoad",
+		"string name\nstring type\nstring[] remap_source_args\nstring[] remap_target_args\nstring[] my_argv\nstring bond_id\n---\nbool success\n"); err != nil {
+		panic(err)
+	}
+	if NodeletUnloadType, err = ctx.AddServiceDefinition("nodelet/NodeletUnload", "string name\n---\nbool success\n"); err != nil {
+		panic(err)
+	}
+	if NodeletListType, err = ctx.AddServiceDefinition("nodelet/NodeletList", "---\nstring[] nodelets\n"); err != nil {
+		panic(err)
+	}
+}
+
+// Container hosts named components in the process of its node.
+type Container interface {
+	// Load creates a component of type typ named name. The remappings map
+	// names of the component to other names, and args are given to the
+	// component as its non-ROS arguments.
+	Load(name, typ string, remappings map[string]string, args []string) error
+	// Unload shuts down the component named name.
+	Unload(name string) error
+	// List returns the sorted names of the loaded components.
+	List() []string
+	// Shutdown unloads all the components and stops the services.
+	Shutdown()
+}
+
+// ContainerOption configures a Container.
+type ContainerOption func(c *defaultContainer)
+
+// ContainerServices enables or disables the load_nodelet, unload_nodelet
+// and list services. They are enabled by default.
+func ContainerServices(enabled bool) ContainerOption {
+	return func(c *defaultContainer) {
+		c.services = enabled
+	}
+}
+
+type instance struct {
+	component Component
+	node      ros.Node
+}
+
+// stop shuts the component down, then what it created through its node.
+func (i *instance) stop() {
+	i.component.Shutdown()
+	i.node.Shutdown()
+}
+
+type defaultContainer struct {
+	mutex     sync.Mutex
+	node      ros.Node
+	services  bool
+	instances map[string]*instance
+	servers   []ros.ServiceServer
+	// stopping tracks the components unloaded through the services.
+	stopping sync.WaitGroup
+}
+
+// NewContainer creates a container hosting components on child handles of
+// node, which serves the services of the container.
+func NewContainer(node ros.Node, options ...ContainerOption) (Container, error) {
+	c := &defaultContainer{
+		node:      node,
+		services:  true,
+		instances: map[string]*instance{},
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	if c.services {
+		c.servers = []ros.ServiceServer{
+			node.NewServiceServer("~load_nodelet", NodeletLoadType, c.onLoad),
+			node.NewServiceServer("~unload_nodelet", NodeletUnloadType, c.onUnload),
+			node.NewServiceServer("~list", NodeletListType, c.onList),
+		}
+	}
+	return c, nil
+}
+
+func (c *defaultContainer) Load(name, typ string, remappings map[string]string, args []string) error {
+	f, ok := factory(typ)
+	if !ok {
+		return fmt.Errorf("components: unknown component type %s", typ)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.instances == nil {
+		return fmt.Errorf("components: container is shut down")
+	}
+	if _, ok := c.instances[name]; ok {
+		return fmt.Errorf("components: %s is already loaded", name)
+	}
+
+	namespace, base := path.Split(path.Clean(name))
+	if args == nil {
+		args = []string{}
+	}
+	node := c.node.NewChild(namespace, ros.NameMap(remappings), ros.ChildName(base), ros.ChildArgs(args))
+	component, err := f(node)
+	if err != nil {
+		node.Shutdown()
+		return fmt.Errorf("components: failed to load %s of type %s: %v", name, typ, err)
+	}
+	c.instances[name] = &instance{component: component, node: node}
+	c.node.Logger().Infof("Loaded %s of type %s", name, typ)
+	return nil
+}
+
+// detach removes the component named name from the container.
+func (c *defaultContainer) detach(name string) (*instance, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	i, ok := c.instances[name]
+	if !ok {
+		return nil, fmt.Errorf("components: %s is not loaded", name)
+	}
+	delete(c.instances, name)
+	return i, nil
+}
+
+func (c *defaultContainer) Unload(name string) error {
+	i, err := c.detach(name)
+	if err != nil {
+		return err
+	}
+	i.stop()
+	c.node.Logger().Infof("Unloaded %s", name)
+	return nil
+}
+
+func (c *defaultContainer) List() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	names := make([]string, 0, len(c.instances))
+	for name := range c.instances {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (c *defaultContainer) Shutdown() {
+	for _, s := range c.servers {
+		s.Shutdown()
+	}
+	c.mutex.Lock()
+	instances := c.instances
+	c.instances = nil
+	c.mutex.Unlock()
+	var wg sync.WaitGroup
+	for _, i := range instances {
+		wg.Add(1)
+		go func(i *instance) {
+			defer wg.Done()
+			i.stop()
+		}(i)
+	}
+	wg.Wait()
+	c.stopping.Wait()
+}
+
+func (c *defaultContainer) onLoad(srv *dynamic.Service) error {
+	req := srv.Request.Data
+	sources := stringsOf(req["remap_source_args"])
+	targets := stringsOf(req["remap_target_args"])
+	if len(sources) != len(targets) {
+		return fmt.Errorf("components: %d remapping sources but %d targets", len(sources), len(targets))
+	}
+	remappings := map[string]string{}
+	for i := range sources {
+		remappings[sources[i]] = targets[i]
+	}
+	name, typ := req["name"].(string), req["type"].(string)
+	err := c.Load(name, typ, remappings, stringsOf(req["my_argv"]))
+	if err != nil {
+		c.node.Logger().Error(err)
+	}
+	srv.Response.Data["success"] = err == nil
+	return nil
+}
+
+func (c *defaultContainer) onUnload(srv *dynamic.Service) error {
+	name := srv.Request.Data["name"].(string)
+	i, err := c.detach(name)
+	if err != nil {
+		c.node.Logger().Error(err)
+		srv.Response.Data["success"] = false
+		return nil
+	}
+	// Components may take longer to stop than a service callback is allowed.
+	c.stopping.Add(1)
+	go func() {
+		defer c.stopping.Done()
+		i.stop()
+		c.node.Logger().Infof("Unloaded %s", name)
+	}()
+	srv.Response.Data["success"] = true
+	return nil
+}
+
+func (c *defaultContainer) onList(srv *dynamic.Service) error {
+	names := []interface{}{}
+	for _, name := range c.List() {
+		names = append(names, name)
+	}
+	srv.Response.Data["nodelets"] = names
+	return nil
+}
+
+// stringsOf converts a string array field to a slice of strings.
+func stringsOf(field interface{}) []string {
+	values, _ := field.([]interface{})
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		result = append(result, v.(string))
+	}
+	return result
+}
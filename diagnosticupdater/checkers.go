@@ -0,0 +1,212 @@
+package diagnosticupdater
+
+import (
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// DefaultWindowSize is the number of updates over which the frequency is
+// measured when FrequencyParams.WindowSize is not set.
+const DefaultWindowSize = 5
+
+// FrequencyParams are the frequencies accepted by a FrequencyStatus.
+type FrequencyParams struct {
+	// Min and Max are the expected frequencies in Hz. A Max of 0 means no
+	// maximum.
+	Min, Max float64
+	// Tolerance is the ratio by which the frequency may exceed Min and Max.
+	Tolerance float64
+	// WindowSize is the number of updates over which the frequency is
+	// measured.
+	WindowSize int
+}
+
+// FrequencyStatus checks that events happen at a frequency between a
+// minimum and a maximum.
+type FrequencyStatus interface {
+	Task
+	// Tick records an event.
+	Tick()
+	// Clear forgets the events.
+	Clear()
+}
+
+type defaultFrequencyStatus struct {
+	mutex  sync.Mutex
+	name   string
+	params FrequencyParams
+	now    func() time.Time
+	count  int
+	// times and counts are the times and the event counts of the last
+	// updates, a ring whose oldest entry is at index.
+	times  []time.Time
+	counts []int
+	index  int
+}
+
+// NewFrequencyStatus creates a task checking the frequency of the calls to
+// Tick.
+func NewFrequencyStatus(name string, params FrequencyParams) FrequencyStatus {
+	if params.WindowSize < 1 {
+		params.WindowSize = DefaultWindowSize
+	}
+	s := &defaultFrequencyStatus{name: name, params: params, now: time.Now}
+	s.Clear()
+	return s
+}
+
+func (s *defaultFrequencyStatus) Name() string {
+	return s.name
+}
+
+func (s *defaultFrequencyStatus) Tick() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.count++
+}
+
+func (s *defaultFrequencyStatus) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	s.count = 0
+	s.times = make([]time.Time, s.params.WindowSize)
+	s.counts = make([]int, s.params.WindowSize)
+	for i := range s.times {
+		s.times[i] = now
+	}
+	s.index = 0
+}
+
+func (s *defaultFrequencyStatus) Run(status *Status) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	now := s.now()
+	events := s.count - s.counts[s.index]
+	window := now.Sub(s.times[s.index]).Seconds()
+	frequency := float64(events) / window
+	s.times[s.index] = now
+	s.counts[s.index] = s.count
+	s.index = (s.index + 1) % len(s.times)
+
+	min := s.params.Min * (1 - s.params.Tolerance)
+	max := s.params.Max * (1 + s.params.Tolerance)
+	switch {
+	case events == 0:
+		status.Summary(Error, "No events recorded.")
+	case frequency < min:
+		status.Summary(Warn, "Frequency too low.")
+	case s.params.Max > 0 && frequency > max:
+		status.Summary(Warn, "Frequency too high.")
+	default:
+		status.Summary(OK, "Desired frequency met")
+	}
+	status.Add("Events in window", events)
+	status.Add("Events since startup", s.count)
+	status.Addf("Duration of window (s)", "%f", window)
+	status.Addf("Actual frequency (Hz)", "%f", frequency)
+	if s.params.Min == s.params.Max {
+		status.Addf("Target frequency (Hz)", "%f", s.params.Min)
+	}
+	if s.params.Min > 0 {
+		status.Addf("Minimum acceptable frequency (Hz)", "%f", min)
+	}
+	if s.params.Max > 0 {
+		status.Addf("Maximum acceptable frequency (Hz)", "%f", max)
+	}
+}
+
+// TimeStampParams are the delays accepted by a TimeStampStatus.
+type TimeStampParams struct {
+	// MinAcceptable and MaxAcceptable are the earliest and latest accepted
+	// delays between a stamp and its tick. MinAcceptable is negative when
+	// stamps may be in the future.
+	MinAcceptable, MaxAcceptable time.Duration
+}
+
+// DefaultTimeStampParams accepts stamps up to 1s in the future and 5s in
+// the past.
+var DefaultTimeStampParams = TimeStampParams{-time.Second, 5 * time.Second}
+
+// TimeStampStatus checks that stamps are close to the time of their tick.
+type TimeStampStatus interface {
+	Task
+	// Tick records an event stamped at stamp.
+	Tick(stamp ros.Time)
+}
+
+type defaultTimeStampStatus struct {
+	mutex     sync.Mutex
+	name      string
+	params    TimeStampParams
+	now       func() time.Time
+	valid     bool
+	zeroSeen  bool
+	minDelta  time.Duration
+	maxDelta  time.Duration
+	early     int
+	late      int
+	zeroCount int
+}
+
+// NewTimeStampStatus creates a task checking the stamps given to Tick. It
+// reports the earliest and the latest delays since the last update.
+func NewTimeStampStatus(name string, params TimeStampParams) TimeStampStatus {
+	return &defaultTimeStampStatus{name: name, params: params, now: time.Now}
+}
+
+func (s *defaultTimeStampStatus) Name() string {
+	return s.name
+}
+
+func (s *defaultTimeStampStatus) Tick(stamp ros.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if stamp.IsZero() {
+		s.zeroSeen = true
+		return
+	}
+	delta := s.now().Sub(time.Unix(int64(stamp.Sec), int64(stamp.NSec)))
+	if !s.valid || delta > s.maxDelta {
+		s.maxDelta = delta
+	}
+	if !s.valid || delta < s.minDelta {
+		s.minDelta = delta
+	}
+	s.valid = true
+}
+
+func (s *defaultTimeStampStatus) Run(status *Status) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	status.Summary(OK, "Timestamps are reasonable.")
+	if !s.valid {
+		status.Summary(Warn, "No data since last update.")
+	} else {
+		if s.minDelta < s.params.MinAcceptable {
+			status.Summary(Error, "Timestamps too far in future seen.")
+			s.early++
+		}
+		if s.maxDelta > s.params.MaxAcceptable {
+			status.Summary(Error, "Timestamps too far in past seen.")
+			s.late++
+		}
+	}
+	if s.zeroSeen {
+		status.Summary(Error, "Zero timestamp seen.")
+		s.zeroCount++
+	}
+	status.Addf("Earliest timestamp delay:", "%f", s.minDelta.Seconds())
+	status.Addf("Latest timestamp delay:", "%f", s.maxDelta.Seconds())
+	status.Addf("Earliest acceptable timestamp delay:", "%f", s.params.MinAcceptable.Seconds())
+	status.Addf("Latest acceptable timestamp delay:", "%f", s.params.MaxAcceptable.Seconds())
+	status.Add("Late diagnostic update count:", s.late)
+	status.Add("Early diagnostic update count:", s.early)
+	status.Add("Zero seen diagnostic update count:", s.zeroCount)
+	s.valid = false
+	s.zeroSeen = false
+	s.minDelta = 0
+	s.maxDelta = 0
+}
@@ -0,0 +1,320 @@
+// Package diagnosticupdater reports the health of a node on /diagnostics,
+// like the diagnostic_updater ROS package.
+//
+// An Updater runs named tasks periodically, each filling a Status with a
+// level, a message and key/values, and publishes them as a
+// diagnostic_msgs/DiagnosticArray:
+//
+//	updater := diagnosticupdater.NewUpdater(node)
+//	defer updater.Shutdown()
+//	updater.Add("Battery", func(status *diagnosticupdater.Status) {
+//		status.Summary(diagnosticupdater.OK, "Charged")
+//		status.Add("Voltage", voltage)
+//	})
+//
+// FrequencyStatus and TimeStampStatus are tasks checking the rate and the
+// delay of events, and a DiagnosedPublisher checks both for the messages of
+// a publisher.
+package diagnosticupdater
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// DefaultPeriod is the period of the updates when the ~diagnostic_period
+// parameter is not set.
+const DefaultPeriod = time.Second
+
+// Level is the level of a status.
+type Level byte
+
+const (
+	OK    Level = 0
+	Warn  Level = 1
+	Error Level = 2
+	Stale Level = 3
+)
+
+func (l Level) String() string {
+	switch l {
+	case OK:
+		return "OK"
+	case Warn:
+		return "WARN"
+	case Error:
+		return "ERROR"
+	case Stale:
+		return "STALE"
+	}
+	return fmt.Sprintf("Level(%d)", byte(l))
+}
+
+// KeyValue is a value reported by a status.
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// Status is the state of a component, as in diagnostic_msgs/DiagnosticStatus.
+type Status struct {
+	Level      Level
+	Name       string
+	Message    string
+	HardwareID string
+	Values     []KeyValue
+}
+
+// Summary sets the level and the message.
+func (s *Status) Summary(level Level, message string) {
+	s.Level = level
+	s.Message = message
+}
+
+// Summaryf sets the level and a formatted message.
+func (s *Status) Summaryf(level Level, format string, args ...interface{}) {
+	s.Summary(level, fmt.Sprintf(format, args...))
+}
+
+// MergeSummary raises the level to level, keeping the messages of the
+// highest level, joined by "; " when they are both OK or both not OK.
+func (s *Status) MergeSummary(level Level, message string) {
+	if (level > OK) == (s.Level > OK) {
+		if s.Message != "" && message != "" {
+			s.Message += "; "
+		}
+		s.Message += message
+	} else if level > s.Level {
+		s.Message = message
+	}
+	if level > s.Level {
+		s.Level = level
+	}
+}
+
+// Add adds a value, formatted with fmt.Sprint.
+func (s *Status) Add(key string, value interface{}) {
+	s.Values = append(s.Values, KeyValue{key, fmt.Sprint(value)})
+}
+
+// Addf adds a formatted value.
+func (s *Status) Addf(key string, format string, args ...interface{}) {
+	s.Add(key, fmt.Sprintf(format, args...))
+}
+
+// Task fills the status of a component.
+type Task interface {
+	Name() string
+	Run(status *Status)
+}
+
+type funcTask struct {
+	name string
+	run  func(status *Status)
+}
+
+// NewTask creates a task calling run.
+func NewTask(name string, run func(status *Status)) Task {
+	return &funcTask{name, run}
+}
+
+func (t *funcTask) Name() string       { return t.name }
+func (t *funcTask) Run(status *Status) { t.run(status) }
+
+type compositeTask struct {
+	name  string
+	tasks []Task
+}
+
+// NewCompositeTask creates a task running tasks, whose summaries are merged
+// and whose values are concatenated.
+func NewCompositeTask(name string, tasks ...Task) Task {
+	return &compositeTask{name, tasks}
+}
+
+func (t *compositeTask) Name() string { return t.name }
+
+func (t *compositeTask) Run(status *Status) {
+	summary := Status{Level: status.Level, Message: status.Message}
+	for _, task := range t.tasks {
+		s := Status{Level: status.Level, Message: status.Message, Name: status.Name, HardwareID: status.HardwareID}
+		task.Run(&s)
+		summary.MergeSummary(s.Level, s.Message)
+		status.Values = append(status.Values, s.Values...)
+	}
+	status.Summary(summary.Level, summary.Message)
+}
+
+// Updater publishes the statuses of its tasks on /diagnostics.
+type Updater interface {
+	// Add adds a task calling run.
+	Add(name string, run func(status *Status))
+	// AddTask adds a task.
+	AddTask(task Task)
+	// Remove removes the task of a name and reports whether there was one.
+	Remove(name string) bool
+	// SetHardwareID sets the hardware ID of the statuses.
+	SetHardwareID(id string)
+	// Update runs the tasks and publishes their statuses now.
+	Update()
+	// Broadcast publishes a status of level and message for every task,
+	// such as when the node shuts down.
+	Broadcast(level Level, message string)
+	// Shutdown stops the updates.
+	Shutdown()
+}
+
+// UpdaterOption configures an Updater.
+type UpdaterOption func(u *defaultUpdater)
+
+// UpdaterPeriod sets the period of the updates instead of the
+// ~diagnostic_period parameter.
+func UpdaterPeriod(period time.Duration) UpdaterOption {
+	return func(u *defaultUpdater) {
+		u.period = period
+	}
+}
+
+// UpdaterHardwareID sets the hardware ID instead of the ~hardware_id
+// parameter.
+func UpdaterHardwareID(id string) UpdaterOption {
+	return func(u *defaultUpdater) {
+		u.hardwareID = id
+	}
+}
+
+type defaultUpdater struct {
+	mutex      sync.Mutex
+	logger     ros.Logger
+	clock      ros.Clock
+	pub        ros.Publisher
+	prefix     string
+	period     time.Duration
+	hardwareID string
+	tasks      []Task
+	warned     bool
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewUpdater creates an updater publishing on /diagnostics every
+// ~diagnostic_period seconds, with the hardware ID of the ~hardware_id
+// parameter.
+func NewUpdater(node ros.Node, options ...UpdaterOption) Updater {
+	u := &defaultUpdater{
+		logger: node.Logger(),
+		clock:  node.Clock(),
+		prefix: strings.TrimPrefix(node.Name(), "/") + ": ",
+		done:   make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt(u)
+	}
+	if u.period == 0 {
+		u.period = DefaultPeriod
+		if value, err := node.GetParam("~diagnostic_period"); err == nil {
+			switch period := value.(type) {
+			case float64:
+				u.period = time.Duration(period * float64(time.Second))
+			case int32:
+				u.period = time.Duration(period) * time.Second
+			default:
+				u.logger.Warnf("diagnosticupdater: invalid ~diagnostic_period %v", value)
+			}
+		}
+	}
+	if u.hardwareID == "" {
+		if value, err := node.GetParam("~hardware_id"); err == nil {
+			u.hardwareID = fmt.Sprint(value)
+		}
+	}
+	u.pub = node.NewPublisher("/diagnostics", DiagnosticArrayType)
+	u.wg.Add(1)
+	go u.run()
+	return u
+}
+
+func (u *defaultUpdater) run() {
+	defer u.wg.Done()
+	ticker := time.NewTicker(u.period)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.Update()
+		case <-u.done:
+			return
+		}
+	}
+}
+
+func (u *defaultUpdater) Add(name string, run func(status *Status)) {
+	u.AddTask(NewTask(name, run))
+}
+
+func (u *defaultUpdater) AddTask(task Task) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.tasks = append(u.tasks, task)
+}
+
+func (u *defaultUpdater) Remove(name string) bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	for i, task := range u.tasks {
+		if task.Name() == name {
+			u.tasks = append(u.tasks[:i], u.tasks[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (u *defaultUpdater) SetHardwareID(id string) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.hardwareID = id
+}
+
+func (u *defaultUpdater) newStatus(task Task) Status {
+	return Status{Name: u.prefix + task.Name(), HardwareID: u.hardwareID}
+}
+
+func (u *defaultUpdater) Update() {
+	u.mutex.Lock()
+	tasks := append([]Task(nil), u.tasks...)
+	statuses := make([]Status, len(tasks))
+	for i, task := range tasks {
+		statuses[i] = u.newStatus(task)
+	}
+	if u.hardwareID == "" && !u.warned {
+		u.logger.Warn("diagnosticupdater: no hardware ID, set the ~hardware_id parameter")
+		u.warned = true
+	}
+	u.mutex.Unlock()
+	for i, task := range tasks {
+		task.Run(&statuses[i])
+	}
+	u.pub.Publish(NewDiagnosticArray(u.clock.Now(), statuses))
+}
+
+func (u *defaultUpdater) Broadcast(level Level, message string) {
+	u.mutex.Lock()
+	statuses := make([]Status, len(u.tasks))
+	for i, task := range u.tasks {
+		statuses[i] = u.newStatus(task)
+		statuses[i].Summary(level, message)
+	}
+	u.mutex.Unlock()
+	u.pub.Publish(NewDiagnosticArray(u.clock.Now(), statuses))
+}
+
+func (u *defaultUpdater) Shutdown() {
+	close(u.done)
+	u.wg.Wait()
+	u.pub.Shutdown()
+}
@@ -0,0 +1,230 @@
+package diagnosticupdater
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+func TestMergeSummary(t *testing.T) {
+	for _, tc := range []struct {
+		level   Level
+		message string
+		merged  []Level
+		want    Status
+	}{
+		{OK, "ok", []Level{OK}, Status{Level: OK, Message: "ok; merged"}},
+		{OK, "ok", []Level{Warn}, Status{Level: Warn, Message: "merged"}},
+		{Warn, "warn", []Level{Error}, Status{Level: Error, Message: "warn; merged"}},
+		{Error, "error", []Level{OK}, Status{Level: Error, Message: "error"}},
+		{OK, "", []Level{OK}, Status{Level: OK, Message: "merged"}},
+	} {
+		s := Status{Level: tc.level, Message: tc.message}
+		for _, level := range tc.merged {
+			s.MergeSummary(level, "merged")
+		}
+		if !reflect.DeepEqual(s, tc.want) {
+			t.Errorf("merging %v into %v %q: expected %v but %v", tc.merged, tc.level, tc.message, tc.want, s)
+		}
+	}
+}
+
+func value(s Status, key string) string {
+	for _, kv := range s.Values {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return ""
+}
+
+func TestFrequencyStatus(t *testing.T) {
+	now := time.Unix(100, 0)
+	f := NewFrequencyStatus("Frequency", FrequencyParams{Min: 10, Max: 20, Tolerance: 0.1, WindowSize: 2})
+	f.(*defaultFrequencyStatus).now = func() time.Time { return now }
+	f.Clear()
+	run := func(ticks int) Status {
+		for i := 0; i < ticks; i++ {
+			f.Tick()
+		}
+		now = now.Add(time.Second)
+		var s Status
+		f.Run(&s)
+		return s
+	}
+	for _, tc := range []struct {
+		ticks     int
+		level     Level
+		frequency string
+	}{
+		{0, Error, "0.000000"},
+		// The window spans the last 2 updates.
+		{15, Warn, "7.500000"},
+		{4, OK, "9.500000"},
+		{4, Warn, "4.000000"},
+		{42, Warn, "23.000000"},
+	} {
+		s := run(tc.ticks)
+		if s.Level != tc.level || value(s, "Actual frequency (Hz)") != tc.frequency {
+			t.Errorf("%d ticks: expected %v at %s Hz but %v at %s Hz", tc.ticks, tc.level, tc.frequency, s.Level, value(s, "Actual frequency (Hz)"))
+		}
+	}
+	s := run(0)
+	if want := []string{"Events in window", "Events since startup", "Duration of window (s)", "Actual frequency (Hz)", "Minimum acceptable frequency (Hz)", "Maximum acceptable frequency (Hz)"}; len(s.Values) != len(want) {
+		t.Errorf("expected the values %v but %v", want, s.Values)
+	}
+	if value(s, "Events since startup") != "65" || value(s, "Minimum acceptable frequency (Hz)") != "9.000000" {
+		t.Errorf("unexpected values %v", s.Values)
+	}
+}
+
+func TestTimeStampStatus(t *testing.T) {
+	now := time.Unix(100, 0)
+	ts := NewTimeStampStatus("Time stamp", DefaultTimeStampParams)
+	ts.(*defaultTimeStampStatus).now = func() time.Time { return now }
+	run := func(stamps ...ros.Time) Status {
+		for _, stamp := range stamps {
+			ts.Tick(stamp)
+		}
+		var s Status
+		ts.Run(&s)
+		return s
+	}
+	for _, tc := range []struct {
+		stamps  []ros.Time
+		level   Level
+		message string
+	}{
+		{nil, Warn, "No data since last update."},
+		{[]ros.Time{ros.NewTime(99, 500000000), ros.NewTime(98, 0)}, OK, "Timestamps are reasonable."},
+		{[]ros.Time{ros.NewTime(102, 0)}, Error, "Timestamps too far in future seen."},
+		{[]ros.Time{ros.NewTime(90, 0)}, Error, "Timestamps too far in past seen."},
+		{[]ros.Time{ros.NewTime(99, 0), {}}, Error, "Zero timestamp seen."},
+	} {
+		s := run(tc.stamps...)
+		if s.Level != tc.level || s.Message != tc.message {
+			t.Errorf("stamps %v: expected %v %q but %v %q", tc.stamps, tc.level, tc.message, s.Level, s.Message)
+		}
+	}
+	s := run(ros.NewTime(99, 500000000), ros.NewTime(98, 0))
+	if value(s, "Earliest timestamp delay:") != "0.500000" || value(s, "Latest timestamp delay:") != "2.000000" {
+		t.Errorf("unexpected delays %v", s.Values)
+	}
+	if value(s, "Late diagnostic update count:") != "1" || value(s, "Early diagnostic update count:") != "1" {
+		t.Errorf("unexpected counts %v", s.Values)
+	}
+}
+
+func TestCompositeTask(t *testing.T) {
+	task := NewCompositeTask("Composite",
+		NewTask("a", func(s *Status) {
+			s.Summary(Warn, "a")
+			s.Add("a", 1)
+		}),
+		NewTask("b", func(s *Status) {
+			s.Summary(Warn, "b")
+			s.Add("b", true)
+		}),
+	)
+	var s Status
+	task.Run(&s)
+	want := Status{Level: Warn, Message: "a; b", Values: []KeyValue{{"a", "1"}, {"b", "true"}}}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("expected %v but %v", want, s)
+	}
+}
+
+func TestDiagnosticArray(t *testing.T) {
+	if md5 := DiagnosticArrayType.MD5Sum(); md5 != "60810da900de1dd6ddd437c3503511da" {
+		t.Errorf("unexpected md5sum %s", md5)
+	}
+	statuses := []Status{
+		{Level: Error, Name: "node: motor", Message: "hot", HardwareID: "motor1", Values: []KeyValue{{"Temperature", "90"}}},
+		{Level: OK, Name: "node: battery"},
+	}
+	got, err := StatusesOf(NewDiagnosticArray(ros.NewTime(1, 0), statuses))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, statuses) {
+		t.Errorf("expected %v but %v", statuses, got)
+	}
+}
+
+func TestUpdater(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	node, err := ros.NewNode("/driver", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		wg.Wait()
+	}()
+	if err := node.SetParam("~hardware_id", "robot1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := node.SetParam("~diagnostic_period", 0.05); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(chan []Status, 100)
+	sub := node.NewSubscriber("/diagnostics", DiagnosticArrayType, func(msg *dynamic.Message) {
+		statuses, err := StatusesOf(msg)
+		if err != nil {
+			t.Error(err)
+		}
+		received <- statuses
+	})
+	defer sub.Shutdown()
+
+	updater := NewUpdater(node)
+	defer updater.Shutdown()
+	updater.Add("Battery", func(s *Status) {
+		s.Summary(OK, "Charged")
+		s.Add("Voltage", 12.5)
+	})
+	pub := NewDiagnosedPublisher(node.NewPublisher("/scan", DiagnosticArrayType), updater, "/scan topic status",
+		FrequencyParams{Min: 1, Max: 1000}, DefaultTimeStampParams)
+	pub.Publish(NewDiagnosticArray(ros.Now(), nil))
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case statuses := <-received:
+			if len(statuses) != 2 {
+				continue
+			}
+			battery := Status{Name: "driver: Battery", Message: "Charged", HardwareID: "robot1", Values: []KeyValue{{"Voltage", "12.5"}}}
+			if !reflect.DeepEqual(statuses[0], battery) {
+				t.Errorf("expected %v but %v", battery, statuses[0])
+			}
+			if statuses[1].Name != "driver: /scan topic status" || value(statuses[1], "Events since startup") != "1" || value(statuses[1], "Latest timestamp delay:") == "" {
+				t.Errorf("unexpected publisher status %v", statuses[1])
+			}
+			pub.Shutdown()
+			if updater.Remove(pub.Name()) {
+				t.Error("expected the publisher task to be removed on shutdown")
+			}
+			return
+		case <-deadline:
+			t.Fatal("no diagnostics received")
+		}
+	}
+}
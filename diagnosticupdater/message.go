@@ -0,0 +1,96 @@
+package diagnosticupdater
+
+import (
+	"fmt"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+const diagnosticArrayDefinition = `Header header
+DiagnosticStatus[] status
+================================================================================
+MSG: std_msgs/Header
+uint32 seq
+time stamp
+string frame_id
+================================================================================
+MSG: diagnostic_msgs/DiagnosticStatus
+byte OK=0
+byte WARN=1
+byte ERROR=2
+byte STALE=3
+byte level
+string name
+string message
+string hardware_id
+KeyValue[] values
+================================================================================
+MSG: diagnostic_msgs/KeyValue
+string key
+string value
+`
+
+// DiagnosticArrayType is the diagnostic_msgs/DiagnosticArray type of
+// /diagnostics.
+var DiagnosticArrayType = newDiagnosticArrayType()
+
+func newDiagnosticArrayType() *dynamic.MessageType {
+	msgType, err := dynamic.NewContext(nil).AddDefinition("diagnostic_msgs/DiagnosticArray", diagnosticArrayDefinition)
+	if err != nil {
+		panic(err)
+	}
+	return msgType
+}
+
+// NewDiagnosticArray returns a diagnostic_msgs/DiagnosticArray of statuses.
+func NewDiagnosticArray(stamp ros.Time, statuses []Status) *dynamic.Message {
+	statusType := DiagnosticArrayType.FieldType("status")
+	keyValueType := statusType.FieldType("values")
+	msg := DiagnosticArrayType.New()
+	msg.Data["header"].(*dynamic.Message).Data["stamp"] = stamp
+	values := make([]interface{}, len(statuses))
+	for i, s := range statuses {
+		status := statusType.New()
+		status.Data["level"] = uint8(s.Level)
+		status.Data["name"] = s.Name
+		status.Data["message"] = s.Message
+		status.Data["hardware_id"] = s.HardwareID
+		keyValues := make([]interface{}, len(s.Values))
+		for j, kv := range s.Values {
+			keyValue := keyValueType.New()
+			keyValue.Data["key"] = kv.Key
+			keyValue.Data["value"] = kv.Value
+			keyValues[j] = keyValue
+		}
+		status.Data["values"] = keyValues
+		values[i] = status
+	}
+	msg.Data["status"] = values
+	return msg
+}
+
+// StatusesOf returns the statuses of a diagnostic_msgs/DiagnosticArray.
+func StatusesOf(msg *dynamic.Message) ([]Status, error) {
+	if msg.Type().Name() != DiagnosticArrayType.Name() {
+		return nil, fmt.Errorf("diagnosticupdater: expected %s but %s", DiagnosticArrayType.Name(), msg.Type().Name())
+	}
+	values, _ := msg.Data["status"].([]interface{})
+	statuses := make([]Status, 0, len(values))
+	for _, value := range values {
+		status := value.(*dynamic.Message)
+		s := Status{
+			Level:      Level(status.Data["level"].(uint8)),
+			Name:       status.Data["name"].(string),
+			Message:    status.Data["message"].(string),
+			HardwareID: status.Data["hardware_id"].(string),
+		}
+		keyValues, _ := status.Data["values"].([]interface{})
+		for _, kv := range keyValues {
+			keyValue := kv.(*dynamic.Message)
+			s.Values = append(s.Values, KeyValue{keyValue.Data["key"].(string), keyValue.Data["value"].(string)})
+		}
+		statuses = append(statuses, s)
+	}
+	return statuses, nil
+}
@@ -0,0 +1,49 @@
+package diagnosticupdater
+
+import (
+	"github.com/fetchrobotics/rosgo/messagefilters"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// DiagnosedPublisher is a publisher whose rate, and the delay of the stamps
+// of messages with a header, are reported by an updater.
+type DiagnosedPublisher interface {
+	ros.Publisher
+	Task
+}
+
+type diagnosedPublisher struct {
+	ros.Publisher
+	Task
+	updater   Updater
+	frequency FrequencyStatus
+	stamp     TimeStampStatus
+}
+
+// NewDiagnosedPublisher wraps pub and adds a task named name to updater,
+// checking the frequency of the published messages and their stamps.
+// Shutting the publisher down removes the task.
+func NewDiagnosedPublisher(pub ros.Publisher, updater Updater, name string, frequency FrequencyParams, stamp TimeStampParams) DiagnosedPublisher {
+	p := &diagnosedPublisher{
+		Publisher: pub,
+		updater:   updater,
+		frequency: NewFrequencyStatus("Frequency", frequency),
+		stamp:     NewTimeStampStatus("Time stamp", stamp),
+	}
+	p.Task = NewCompositeTask(name, p.frequency, p.stamp)
+	updater.AddTask(p)
+	return p
+}
+
+func (p *diagnosedPublisher) Publish(msg ros.Message) {
+	p.frequency.Tick()
+	if stamp, ok := messagefilters.Stamp(msg); ok {
+		p.stamp.Tick(stamp)
+	}
+	p.Publisher.Publish(msg)
+}
+
+func (p *diagnosedPublisher) Shutdown() {
+	p.updater.Remove(p.Name())
+	p.Publisher.Shutdown()
+}
@@ -0,0 +1,202 @@
+package dynamic
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Context creates message types from .msg files found in ROS package paths
+// and from full message definitions. Types are cached by name.
+type Context struct {
+	mutex    sync.Mutex
+	msgPaths map[string]string
+	srvPaths map[string]string
+	specs    map[string]*msgSpec
+	types    map[string]*MessageType
+	// connTypes caches the types of connection headers by name and MD5 sum.
+	connTypes map[string]*MessageType
+}
+
+// NewContext indexes the message and service files of the packages found
+// under rosPkgPaths.
+func NewContext(rosPkgPaths []string) *Context {
+	ctx := &Context{
+		msgPaths:  make(map[string]string),
+		srvPaths:  make(map[string]string),
+		specs:     make(map[string]*msgSpec),
+		types:     make(map[string]*MessageType),
+		connTypes: make(map[string]*MessageType),
+	}
+	for _, p := range rosPkgPaths {
+		ctx.findPackages(p, 0)
+	}
+	return ctx
+}
+
+// NewContextFromEnv creates a context searching ROS_PACKAGE_PATH.
+func NewContextFromEnv() *Context {
+	var paths []string
+	for _, p := range filepath.SplitList(os.Getenv("ROS_PACKAGE_PATH")) {
+		if len(p) > 0 {
+			paths = append(paths, p)
+		}
+	}
+	return NewContext(paths)
+}
+
+const maxPackageDepth = 5
+
+func (ctx *Context) findPackages(dir string, depth int) {
+	if _, err := os.Stat(filepath.Join(dir, "package.xml")); err == nil {
+		pkg := filepath.Base(dir)
+		for ext, paths := range map[string]map[string]string{"msg": ctx.msgPaths, "srv": ctx.srvPaths} {
+			files, _ := filepath.Glob(filepath.Join(dir, ext, "*."+ext))
+			for _, f := range files {
+				name := pkg + "/" + strings.TrimSuffix(filepath.Base(f), "."+ext)
+				if _, ok := paths[name]; !ok {
+					paths[name] = f
+				}
+			}
+		}
+		return
+	}
+	if depth >= maxPackageDepth {
+		return
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			ctx.findPackages(filepath.Join(dir, e.Name()), depth+1)
+		}
+	}
+}
+
+// MessageTypes returns the names of the message types found in the package
+// paths.
+func (ctx *Context) MessageTypes() []string {
+	var names []string
+	for name := range ctx.msgPaths {
+		names = append(names, name)
+	}
+	return names
+}
+
+// MessageType returns the message type of the given name.
+func (ctx *Context) MessageType(name string) (*MessageType, error) {
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	return ctx.messageType(name, nil)
+}
+
+// AddDefinition creates a message type from its full definition, i.e. the
+// .msg text followed by the texts of its dependencies separated by
+// "=====...\nMSG: pkg/Type" lines. Dependencies missing from the
+// definition are searched in the package paths.
+func (ctx *Context) AddDefinition(name string, definition string) (*MessageType, error) {
+	texts, err := splitDefinition(name, definition)
+	if err != nil {
+		return nil, err
+	}
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	return ctx.messageType(name, texts)
+}
+
+func (ctx *Context) loadSpec(name string, texts map[string]string) (*msgSpec, error) {
+	if text, ok := texts[name]; ok {
+		return parseSpec(name, text)
+	}
+	if spec, ok := ctx.specs[name]; ok {
+		return spec, nil
+	}
+	var text string
+	if path, ok := ctx.msgPaths[name]; ok {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	} else if name == headerFullName {
+		text = headerText
+	} else {
+		return nil, fmt.Errorf("definition of message type %s is not found", name)
+	}
+	spec, err := parseSpec(name, text)
+	if err != nil {
+		return nil, err
+	}
+	ctx.specs[name] = spec
+	return spec, nil
+}
+
+// messageType builds a message type using the texts of a full definition
+// first. Types built from a full definition are not cached since another
+// publisher may use a different version of the same type.
+func (ctx *Context) messageType(name string, texts map[string]string) (*MessageType, error) {
+	if texts == nil {
+		if t, ok := ctx.types[name]; ok {
+			return t, nil
+		}
+	}
+	spec, err := ctx.loadSpec(name, texts)
+	if err != nil {
+		return nil, err
+	}
+	t := &MessageType{
+		name:      name,
+		text:      spec.text,
+		fields:    spec.fields,
+		constants: spec.constants,
+		nested:    make([]*MessageType, len(spec.fields)),
+	}
+	for i, f := range spec.fields {
+		if f.IsBuiltin() {
+			continue
+		}
+		if t.nested[i], err = ctx.messageType(f.Type, texts); err != nil {
+			return nil, err
+		}
+	}
+	t.md5sum = computeMD5(t)
+	t.definition = computeDefinition(t)
+	if texts == nil {
+		ctx.types[name] = t
+	}
+	return t, nil
+}
+
+// ConnectionType returns the message type of a connection header using its
+// message_definition field or, when the definition is missing or
+// incomplete, the package paths. The MD5 sum of the returned type matches
+// the md5sum field of the header.
+func (ctx *Context) ConnectionType(header map[string]string) (*MessageType, error) {
+	name, md5sum := header["type"], header["md5sum"]
+	key := name + "/" + md5sum
+	ctx.mutex.Lock()
+	t, ok := ctx.connTypes[key]
+	ctx.mutex.Unlock()
+	if ok {
+		return t, nil
+	}
+
+	t, err := ctx.AddDefinition(name, header["message_definition"])
+	if err != nil || t.MD5Sum() != md5sum {
+		if t, err = ctx.MessageType(name); err != nil {
+			return nil, err
+		}
+		if t.MD5Sum() != md5sum {
+			return nil, fmt.Errorf("definition of %s does not match MD5 sum %s", name, md5sum)
+		}
+	}
+	ctx.mutex.Lock()
+	ctx.connTypes[key] = t
+	ctx.mutex.Unlock()
+	return t, nil
+}
@@ -0,0 +1,258 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+func writePackage(t *testing.T, root string, pkg string, msgs map[string]string) {
+	dir := filepath.Join(root, pkg)
+	if err := os.MkdirAll(filepath.Join(dir, "msg"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "package.xml"), []byte("<package/>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, text := range msgs {
+		if err := ioutil.WriteFile(filepath.Join(dir, "msg", name+".msg"), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newTestContext(t *testing.T) *Context {
+	root, err := ioutil.TempDir("", "dynamic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	writePackage(t, root, "std_msgs", map[string]string{
+		"String": "string data\n",
+		"Header": "uint32 seq\ntime stamp\nstring frame_id\n",
+	})
+	writePackage(t, filepath.Join(root, "nested"), "geometry_msgs", map[string]string{
+		"Point":        "# comment\nfloat64 x\nfloat64 y\nfloat64 z\n",
+		"PointStamped": "Header header\nPoint point\n",
+		"Polygon":      "Point32[] points\n",
+		"Point32":      "float32 x\nfloat32 y\nfloat32 z\n",
+	})
+	writePackage(t, root, "test_msgs", map[string]string{
+		"All": "int8 A=-1\nstring S=hello # world\nuint8[] data\nint16[2] pair\ntime t\nduration d\nbool flag\nstd_msgs/String[] strings\n",
+	})
+	return NewContext([]string{root})
+}
+
+func TestMD5Sum(t *testing.T) {
+	ctx := newTestContext(t)
+	for name, md5sum := range map[string]string{
+		"std_msgs/String":            "992ce8a1687cec8c8bd883ec73ca41d1",
+		"std_msgs/Header":            "2176decaecbce78abc3b96ef049fabed",
+		"geometry_msgs/Point":        "4a842b65f413084dc2b10fb484ea7f17",
+		"geometry_msgs/PointStamped": "c63aecb41bfdfd6b7e1fac37c7cbe7bf",
+		"geometry_msgs/Polygon":      "cd60a26494a087f577976f0329fa120e",
+	} {
+		msgType, err := ctx.MessageType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msgType.MD5Sum() != md5sum {
+			t.Errorf("%s: expected %s but %s", name, md5sum, msgType.MD5Sum())
+		}
+	}
+	if _, err := ctx.MessageType("unknown_msgs/Unknown"); err == nil {
+		t.Error("MessageType of an unknown type succeeded")
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	ctx := newTestContext(t)
+	msgType, err := ctx.MessageType("geometry_msgs/PointStamped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sep := "================================================================================\n"
+	expected := "Header header\nPoint point\n" +
+		sep + "MSG: std_msgs/Header\nuint32 seq\ntime stamp\nstring frame_id\n" +
+		sep + "MSG: geometry_msgs/Point\n# comment\nfloat64 x\nfloat64 y\nfloat64 z\n"
+	if msgType.Text() != expected {
+		t.Errorf("expected %q but %q", expected, msgType.Text())
+	}
+
+	parsed, err := NewContext(nil).AddDefinition("geometry_msgs/PointStamped", msgType.Text())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.MD5Sum() != msgType.MD5Sum() {
+		t.Errorf("MD5 sum of parsed definition: %s", parsed.MD5Sum())
+	}
+}
+
+func TestSerialization(t *testing.T) {
+	ctx := newTestContext(t)
+	msgType, err := ctx.MessageType("test_msgs/All")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := msgType.Constants(); len(c) != 2 || c[0].Value != int8(-1) || c[1].Value != "hello # world" {
+		t.Errorf("unexpected constants %v", c)
+	}
+
+	msg := msgType.New()
+	err = msg.Fill(map[string]interface{}{
+		"data":    "ab",
+		"pair":    []interface{}{1, -2},
+		"t":       map[string]interface{}{"secs": 1, "nsecs": 2},
+		"d":       1.5,
+		"flag":    true,
+		"strings": []interface{}{map[string]interface{}{"data": "x"}, []interface{}{"y"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := msg.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{
+		2, 0, 0, 0, 'a', 'b',
+		1, 0, 0xfe, 0xff,
+		1, 0, 0, 0, 2, 0, 0, 0,
+		1, 0, 0, 0, 0x00, 0x65, 0xcd, 0x1d,
+		1,
+		2, 0, 0, 0, 1, 0, 0, 0, 'x', 1, 0, 0, 0, 'y',
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("expected %v but %v", expected, buf.Bytes())
+	}
+
+	decoded := msgType.New()
+	if err := decoded.Deserialize(ros.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded.Data["pair"], []interface{}{int16(1), int16(-2)}) {
+		t.Errorf("unexpected pair %v", decoded.Data["pair"])
+	}
+	if v, err := decoded.Get("strings[1]/data"); err != nil || v != "y" {
+		t.Errorf("Get: %v, %v", v, err)
+	}
+	if _, err := decoded.Get("strings[2]"); err == nil {
+		t.Error("Get out of range succeeded")
+	}
+	if err := decoded.Deserialize(ros.NewReader(buf.Bytes()[:10])); err == nil {
+		t.Error("Deserialize of truncated data succeeded")
+	}
+
+	if err := msgType.New().Fill(map[string]interface{}{"pair": []interface{}{1}}); err == nil {
+		t.Error("Fill with wrong array length succeeded")
+	}
+	if err := msgType.New().Fill(map[string]interface{}{"pair": []interface{}{1, 40000}}); err == nil {
+		t.Error("Fill with out of range value succeeded")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	ctx := newTestContext(t)
+	msgType, err := ctx.MessageType("geometry_msgs/PointStamped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := msgType.New()
+	if err := msg.Fill(map[string]interface{}{
+		"header": map[string]interface{}{"seq": 3, "stamp": map[string]interface{}{"secs": 1, "nsecs": 2}},
+		"point":  []interface{}{1, 2.5, -3},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `header:
+  seq: 3
+  stamp:
+    secs: 1
+    nsecs: 2
+  frame_id: ''
+point:
+  x: 1.0
+  y: 2.5
+  z: -3.0`
+	if msg.String() != expected {
+		t.Errorf("expected\n%s\nbut\n%s", expected, msg.String())
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedJSON := `{"header":{"seq":3,"stamp":{"secs":1,"nsecs":2},"frame_id":""},"point":{"x":1,"y":2.5,"z":-3}}`
+	if string(data) != expectedJSON {
+		t.Errorf("expected %s but %s", expectedJSON, data)
+	}
+
+	polygonType, err := ctx.MessageType("geometry_msgs/Polygon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	polygon := polygonType.New()
+	polygon.Fill([]interface{}{[]interface{}{[]interface{}{1, 2, 3}, []interface{}{4, 5, 6}}})
+	expected = `points:
+- x: 1.0
+  y: 2.0
+  z: 3.0
+- x: 4.0
+  y: 5.0
+  z: 6.0`
+	if polygon.String() != expected {
+		t.Errorf("expected\n%s\nbut\n%s", expected, polygon.String())
+	}
+}
+
+func TestServiceType(t *testing.T) {
+	root, err := ioutil.TempDir("", "dynamic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "std_srvs")
+	os.MkdirAll(filepath.Join(dir, "srv"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "package.xml"), []byte("<package/>"), 0644)
+	for name, text := range map[string]string{
+		"Empty":   "---\n",
+		"SetBool": "bool data # e.g. for hardware enabling / disabling\n---\nbool success   # indicate successful run of triggered service\nstring message # informational, e.g. for error messages\n",
+		"Trigger": "---\nbool success\nstring message\n",
+	} {
+		ioutil.WriteFile(filepath.Join(dir, "srv", name+".srv"), []byte(text), 0644)
+	}
+
+	ctx := NewContext([]string{root})
+	for name, md5sum := range map[string]string{
+		"std_srvs/Empty":   "d41d8cd98f00b204e9800998ecf8427e",
+		"std_srvs/SetBool": "09fb03525b03e7ea1fd3992bafd87e16",
+		"std_srvs/Trigger": "937c9679a518e3a18d831e57125ea522",
+	} {
+		srvType, err := ctx.ServiceType(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if srvType.MD5Sum() != md5sum {
+			t.Errorf("%s: expected %s but %s", name, md5sum, srvType.MD5Sum())
+		}
+	}
+	srvType, _ := ctx.ServiceType("std_srvs/SetBool")
+	if srvType.RequestType().Name() != "std_srvs/SetBoolRequest" || len(srvType.Response().Fields()) != 2 {
+		t.Errorf("unexpected request and response types")
+	}
+
+	srvType, err = ctx.AddServiceDefinition("test_srvs/Swap", "Pair pair\n---\nPair pair\n"+
+		"================================================================================\nMSG: test_srvs/Pair\nint32 a\nint32 b\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pair := srvType.Response().FieldType("pair"); pair == nil || pair.Name() != "test_srvs/Pair" || srvType.Request().FieldType("pair") == nil {
+		t.Errorf("unexpected types of a service with dependencies")
+	}
+}
@@ -0,0 +1,257 @@
+package dynamic
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// String formats the message as YAML in the style of rostopic echo.
+func (m *Message) String() string {
+	var buf bytes.Buffer
+	formatMessage(&buf, m, 0)
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// FormatValue formats a field value as YAML in the style of rostopic echo.
+func FormatValue(value interface{}) string {
+	var buf bytes.Buffer
+	switch v := value.(type) {
+	case *Message:
+		formatMessage(&buf, v, 0)
+	case ros.Time, ros.Duration:
+		formatTemporal(&buf, v, 0)
+	case []interface{}:
+		if len(v) > 0 && isComposite(v[0]) {
+			formatList(&buf, v, 0)
+		} else {
+			buf.WriteString(formatScalar(value))
+		}
+	default:
+		buf.WriteString(formatScalar(value))
+	}
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+func isComposite(value interface{}) bool {
+	switch value.(type) {
+	case *Message, ros.Time, ros.Duration:
+		return true
+	}
+	return false
+}
+
+func writeIndent(buf *bytes.Buffer, indent int) {
+	buf.WriteString(strings.Repeat("  ", indent))
+}
+
+func formatMessage(buf *bytes.Buffer, m *Message, indent int) {
+	for i, f := range m.msgType.fields {
+		if i > 0 {
+			writeIndent(buf, indent)
+		}
+		buf.WriteString(f.Name)
+		buf.WriteString(":")
+		formatField(buf, m.Data[f.Name], indent)
+	}
+	if len(m.msgType.fields) == 0 {
+		buf.WriteString("{}\n")
+	}
+}
+
+func formatField(buf *bytes.Buffer, value interface{}, indent int) {
+	switch v := value.(type) {
+	case *Message:
+		if len(v.msgType.fields) == 0 {
+			buf.WriteString(" {}\n")
+			return
+		}
+		buf.WriteString("\n")
+		writeIndent(buf, indent+1)
+		formatMessage(buf, v, indent+1)
+	case ros.Time, ros.Duration:
+		buf.WriteString("\n")
+		writeIndent(buf, indent+1)
+		formatTemporal(buf, v, indent+1)
+	case []interface{}:
+		if len(v) > 0 && isComposite(v[0]) {
+			buf.WriteString("\n")
+			writeIndent(buf, indent)
+			formatList(buf, v, indent)
+			return
+		}
+		buf.WriteString(" ")
+		buf.WriteString(formatScalar(v))
+		buf.WriteString("\n")
+	default:
+		buf.WriteString(" ")
+		buf.WriteString(formatScalar(v))
+		buf.WriteString("\n")
+	}
+}
+
+func formatList(buf *bytes.Buffer, values []interface{}, indent int) {
+	for i, item := range values {
+		if i > 0 {
+			writeIndent(buf, indent)
+		}
+		buf.WriteString("- ")
+		switch v := item.(type) {
+		case *Message:
+			formatMessage(buf, v, indent+1)
+		default:
+			formatTemporal(buf, v, indent+1)
+		}
+	}
+}
+
+func formatTemporal(buf *bytes.Buffer, value interface{}, indent int) {
+	var sec, nsec uint32
+	switch v := value.(type) {
+	case ros.Time:
+		sec, nsec = v.Sec, v.NSec
+	case ros.Duration:
+		sec, nsec = v.Sec, v.NSec
+	}
+	buf.WriteString("secs: ")
+	buf.WriteString(strconv.FormatUint(uint64(sec), 10))
+	buf.WriteString("\n")
+	writeIndent(buf, indent)
+	buf.WriteString("nsecs: ")
+	buf.WriteString(strconv.FormatUint(uint64(nsec), 10))
+	buf.WriteString("\n")
+}
+
+func formatFloat(f float64, bits int) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func formatScalar(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		if len(v) == 0 {
+			return "''"
+		}
+		return strconv.Quote(v)
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case float32:
+		return formatFloat(float64(v), 32)
+	case float64:
+		return formatFloat(v, 64)
+	case []byte:
+		items := make([]string, len(v))
+		for i, b := range v {
+			items[i] = strconv.Itoa(int(b))
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = formatScalar(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case ros.Time, ros.Duration:
+		var buf bytes.Buffer
+		formatTemporal(&buf, v, 0)
+		return "{" + strings.Replace(strings.TrimSpace(buf.String()), "\n", ", ", -1) + "}"
+	case *Message:
+		return strings.Replace(v.String(), "\n", ", ", -1)
+	}
+	return jsonScalar(value)
+}
+
+func jsonScalar(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "null"
+	}
+	return string(data)
+}
+
+// MarshalJSON encodes the message as a JSON object keeping the field order.
+// Times and durations are objects with secs and nsecs, uint8 arrays are
+// arrays of numbers and non-finite floats are null.
+func (m *Message) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	writeJSON(&buf, m)
+	return buf.Bytes(), nil
+}
+
+// ToJSON encodes a field value like Message.MarshalJSON.
+func ToJSON(value interface{}) []byte {
+	var buf bytes.Buffer
+	writeJSON(&buf, value)
+	return buf.Bytes()
+}
+
+func writeJSON(buf *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case *Message:
+		buf.WriteString("{")
+		for i, f := range v.msgType.fields {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString(strconv.Quote(f.Name))
+			buf.WriteString(":")
+			writeJSON(buf, v.Data[f.Name])
+		}
+		buf.WriteString("}")
+	case ros.Time:
+		buf.WriteString(`{"secs":` + strconv.FormatUint(uint64(v.Sec), 10) + `,"nsecs":` + strconv.FormatUint(uint64(v.NSec), 10) + "}")
+	case ros.Duration:
+		buf.WriteString(`{"secs":` + strconv.FormatUint(uint64(v.Sec), 10) + `,"nsecs":` + strconv.FormatUint(uint64(v.NSec), 10) + "}")
+	case []interface{}:
+		buf.WriteString("[")
+		for i, item := range v {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			writeJSON(buf, item)
+		}
+		buf.WriteString("]")
+	case []byte:
+		buf.WriteString("[")
+		for i, b := range v {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString(strconv.Itoa(int(b)))
+		}
+		buf.WriteString("]")
+	case float32:
+		writeJSONFloat(buf, float64(v), 32)
+	case float64:
+		writeJSONFloat(buf, v, 64)
+	default:
+		buf.WriteString(jsonScalar(v))
+	}
+}
+
+func writeJSONFloat(buf *bytes.Buffer, f float64, bits int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		buf.WriteString("null")
+		return
+	}
+	buf.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+}
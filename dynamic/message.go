@@ -0,0 +1,402 @@
+// Package dynamic provides ROS messages whose types are defined at run time
+// from message definitions instead of generated code.
+package dynamic
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// MessageType is a message type built from its definition. It implements
+// ros.MessageType.
+type MessageType struct {
+	name       string
+	text       string
+	fields     []Field
+	constants  []Constant
+	nested     []*MessageType
+	md5sum     string
+	definition string
+}
+
+func (t *MessageType) Name() string {
+	return t.name
+}
+
+func (t *MessageType) MD5Sum() string {
+	return t.md5sum
+}
+
+// Text returns the full definition including the definitions of the nested
+// types, as sent in the message_definition connection header.
+func (t *MessageType) Text() string {
+	return t.definition
+}
+
+// Fields returns the fields of the type in definition order.
+func (t *MessageType) Fields() []Field {
+	return t.fields
+}
+
+// Constants returns the constants of the type.
+func (t *MessageType) Constants() []Constant {
+	return t.constants
+}
+
+// FieldType returns the message type of a field or nil for builtin types.
+func (t *MessageType) FieldType(name string) *MessageType {
+	for i, f := range t.fields {
+		if f.Name == name {
+			return t.nested[i]
+		}
+	}
+	return nil
+}
+
+func (t *MessageType) NewMessage() ros.Message {
+	return t.New()
+}
+
+// New creates a message with zero values.
+func (t *MessageType) New() *Message {
+	m := &Message{msgType: t, Data: make(map[string]interface{})}
+	for i, f := range t.fields {
+		if f.IsArray {
+			n := f.ArrayLen
+			if n < 0 {
+				n = 0
+			}
+			if isByteType(f.Type) {
+				m.Data[f.Name] = make([]byte, n)
+				continue
+			}
+			values := make([]interface{}, n)
+			for j := range values {
+				values[j] = zeroValue(f.Type, t.nested[i])
+			}
+			m.Data[f.Name] = values
+		} else {
+			m.Data[f.Name] = zeroValue(f.Type, t.nested[i])
+		}
+	}
+	return m
+}
+
+func isByteType(t string) bool {
+	return t == "uint8" || t == "char" || t == "byte"
+}
+
+func zeroValue(t string, nested *MessageType) interface{} {
+	switch t {
+	case "int8":
+		return int8(0)
+	case "uint8", "char", "byte":
+		return uint8(0)
+	case "int16":
+		return int16(0)
+	case "uint16":
+		return uint16(0)
+	case "int32":
+		return int32(0)
+	case "uint32":
+		return uint32(0)
+	case "int64":
+		return int64(0)
+	case "uint64":
+		return uint64(0)
+	case "float32":
+		return float32(0)
+	case "float64":
+		return float64(0)
+	case "string":
+		return ""
+	case "bool":
+		return false
+	case "time":
+		return ros.Time{}
+	case "duration":
+		return ros.Duration{}
+	}
+	return nested.New()
+}
+
+func computeMD5(t *MessageType) string {
+	sum := md5.Sum([]byte(md5Text(t)))
+	return hex.EncodeToString(sum[:])
+}
+
+// md5Text returns the canonical text hashed into the MD5 sum of a type.
+func md5Text(t *MessageType) string {
+	var lines []string
+	for _, c := range t.constants {
+		lines = append(lines, fmt.Sprintf("%s %s=%s", c.Type, c.Name, c.ValueText))
+	}
+	for i, f := range t.fields {
+		if f.IsBuiltin() {
+			lines = append(lines, f.String())
+		} else {
+			lines = append(lines, fmt.Sprintf("%s %s", t.nested[i].md5sum, f.Name))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func collectDependencies(t *MessageType, deps *[]*MessageType, seen map[string]bool) {
+	for _, n := range t.nested {
+		if n == nil || seen[n.name] {
+			continue
+		}
+		seen[n.name] = true
+		*deps = append(*deps, n)
+		collectDependencies(n, deps, seen)
+	}
+}
+
+func computeDefinition(t *MessageType) string {
+	var buf bytes.Buffer
+	buf.WriteString(strings.TrimRight(t.text, "\n"))
+	buf.WriteString("\n")
+	var deps []*MessageType
+	collectDependencies(t, &deps, make(map[string]bool))
+	for _, d := range deps {
+		buf.WriteString(strings.Repeat("=", 80))
+		buf.WriteString("\nMSG: ")
+		buf.WriteString(d.name)
+		buf.WriteString("\n")
+		buf.WriteString(strings.TrimRight(d.text, "\n"))
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// Message is a message of a dynamic type. Data maps field names to values:
+// Go numeric types matching the field types, bool, string, ros.Time,
+// ros.Duration, *Message for nested messages, []byte for uint8 and char
+// arrays and []interface{} for other arrays.
+type Message struct {
+	msgType *MessageType
+	Data    map[string]interface{}
+}
+
+func (m *Message) GetType() ros.MessageType {
+	return m.msgType
+}
+
+// Type returns the dynamic type of the message.
+func (m *Message) Type() *MessageType {
+	return m.msgType
+}
+
+func (m *Message) Serialize(buf *bytes.Buffer) error {
+	t := m.msgType
+	for i, f := range t.fields {
+		value, ok := m.Data[f.Name]
+		if !ok {
+			value = t.New().Data[f.Name]
+		}
+		if err := serializeField(buf, f, t.nested[i], value); err != nil {
+			return fmt.Errorf("%s.%s: %v", t.name, f.Name, err)
+		}
+	}
+	return nil
+}
+
+func serializeField(buf *bytes.Buffer, f Field, nested *MessageType, value interface{}) error {
+	if !f.IsArray {
+		return serializeValue(buf, f.Type, value)
+	}
+	if data, ok := value.([]byte); ok && isByteType(f.Type) {
+		if f.ArrayLen < 0 {
+			binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+		} else if len(data) != f.ArrayLen {
+			return fmt.Errorf("expected %d elements but %d", f.ArrayLen, len(data))
+		}
+		buf.Write(data)
+		return nil
+	}
+	values, ok := value.([]interface{})
+	if !ok {
+		return fmt.Errorf("expected an array but %T", value)
+	}
+	if f.ArrayLen < 0 {
+		binary.Write(buf, binary.LittleEndian, uint32(len(values)))
+	} else if len(values) != f.ArrayLen {
+		return fmt.Errorf("expected %d elements but %d", f.ArrayLen, len(values))
+	}
+	for _, v := range values {
+		if err := serializeValue(buf, f.Type, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func serializeValue(buf *bytes.Buffer, t string, value interface{}) error {
+	switch t {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected string but %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+		return nil
+	case "time":
+		v, ok := value.(ros.Time)
+		if !ok {
+			return fmt.Errorf("expected ros.Time but %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, v.Sec)
+		binary.Write(buf, binary.LittleEndian, v.NSec)
+		return nil
+	case "duration":
+		v, ok := value.(ros.Duration)
+		if !ok {
+			return fmt.Errorf("expected ros.Duration but %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, v.Sec)
+		binary.Write(buf, binary.LittleEndian, v.NSec)
+		return nil
+	}
+	if isBuiltinType(t) {
+		expected := zeroValue(t, nil)
+		if fmt.Sprintf("%T", value) != fmt.Sprintf("%T", expected) {
+			return fmt.Errorf("expected %T but %T", expected, value)
+		}
+		return binary.Write(buf, binary.LittleEndian, value)
+	}
+	m, ok := value.(*Message)
+	if !ok {
+		return fmt.Errorf("expected *dynamic.Message but %T", value)
+	}
+	if m.msgType.name != t {
+		return fmt.Errorf("expected %s but %s", t, m.msgType.name)
+	}
+	return m.Serialize(buf)
+}
+
+func (m *Message) Deserialize(buf *ros.Reader) error {
+	t := m.msgType
+	if m.Data == nil {
+		m.Data = make(map[string]interface{})
+	}
+	for i, f := range t.fields {
+		value, err := deserializeField(buf, f, t.nested[i])
+		if err != nil {
+			return fmt.Errorf("%s.%s: %v", t.name, f.Name, err)
+		}
+		m.Data[f.Name] = value
+	}
+	return nil
+}
+
+func readLength(buf *ros.Reader) (int, error) {
+	data := buf.Next(4)
+	if len(data) < 4 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := int(binary.LittleEndian.Uint32(data))
+	if n > buf.Len() {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+func deserializeField(buf *ros.Reader, f Field, nested *MessageType) (interface{}, error) {
+	if !f.IsArray {
+		return deserializeValue(buf, f.Type, nested)
+	}
+	n := f.ArrayLen
+	if n < 0 {
+		var err error
+		if n, err = readLength(buf); err != nil {
+			return nil, err
+		}
+	}
+	if isByteType(f.Type) {
+		data := buf.Next(n)
+		if len(data) < n {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return append([]byte{}, data...), nil
+	}
+	values := make([]interface{}, n)
+	for i := range values {
+		v, err := deserializeValue(buf, f.Type, nested)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func deserializeValue(buf *ros.Reader, t string, nested *MessageType) (interface{}, error) {
+	if nested != nil {
+		m := nested.New()
+		if err := m.Deserialize(buf); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	if t == "string" {
+		n, err := readLength(buf)
+		if err != nil {
+			return nil, err
+		}
+		return string(buf.Next(n)), nil
+	}
+	size := bitSize(t) / 8
+	switch t {
+	case "bool":
+		size = 1
+	case "time", "duration":
+		size = 8
+	}
+	data := buf.Next(size)
+	if len(data) < size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	le := binary.LittleEndian
+	switch t {
+	case "int8":
+		return int8(data[0]), nil
+	case "uint8", "char", "byte":
+		return data[0], nil
+	case "bool":
+		return data[0] != 0, nil
+	case "int16":
+		return int16(le.Uint16(data)), nil
+	case "uint16":
+		return le.Uint16(data), nil
+	case "int32":
+		return int32(le.Uint32(data)), nil
+	case "uint32":
+		return le.Uint32(data), nil
+	case "int64":
+		return int64(le.Uint64(data)), nil
+	case "uint64":
+		return le.Uint64(data), nil
+	case "float32":
+		return math.Float32frombits(le.Uint32(data)), nil
+	case "float64":
+		return math.Float64frombits(le.Uint64(data)), nil
+	case "time":
+		var v ros.Time
+		v.Sec, v.NSec = le.Uint32(data), le.Uint32(data[4:])
+		return v, nil
+	case "duration":
+		var v ros.Duration
+		v.Sec, v.NSec = le.Uint32(data), le.Uint32(data[4:])
+		return v, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", t)
+}
@@ -0,0 +1,135 @@
+package dynamic
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// ServiceType is a service type built from its definition. It implements
+// ros.ServiceType.
+type ServiceType struct {
+	name     string
+	md5sum   string
+	request  *MessageType
+	response *MessageType
+}
+
+func (t *ServiceType) Name() string {
+	return t.name
+}
+
+func (t *ServiceType) MD5Sum() string {
+	return t.md5sum
+}
+
+func (t *ServiceType) RequestType() ros.MessageType {
+	return t.request
+}
+
+func (t *ServiceType) ResponseType() ros.MessageType {
+	return t.response
+}
+
+// Request returns the dynamic type of the request.
+func (t *ServiceType) Request() *MessageType {
+	return t.request
+}
+
+// Response returns the dynamic type of the response.
+func (t *ServiceType) Response() *MessageType {
+	return t.response
+}
+
+func (t *ServiceType) NewService() ros.Service {
+	return t.New()
+}
+
+// New creates a service with zero request and response.
+func (t *ServiceType) New() *Service {
+	return &Service{t.request.New(), t.response.New()}
+}
+
+// Service is a request and response pair of a dynamic service type.
+type Service struct {
+	Request  *Message
+	Response *Message
+}
+
+func (s *Service) ReqMessage() ros.Message {
+	return s.Request
+}
+
+func (s *Service) ResMessage() ros.Message {
+	return s.Response
+}
+
+// ServiceTypes returns the names of the service types found in the package
+// paths.
+func (ctx *Context) ServiceTypes() []string {
+	var names []string
+	for name := range ctx.srvPaths {
+		names = append(names, name)
+	}
+	return names
+}
+
+// ServiceType returns the service type of the given name.
+func (ctx *Context) ServiceType(name string) (*ServiceType, error) {
+	path, ok := ctx.srvPaths[name]
+	if !ok {
+		return nil, fmt.Errorf("definition of service type %s is not found", name)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.AddServiceDefinition(name, string(data))
+}
+
+// AddServiceDefinition creates a service type from the text of a .srv file,
+// which may be followed by the definitions of the message types it uses as
+// in AddDefinition.
+func (ctx *Context) AddServiceDefinition(name string, text string) (*ServiceType, error) {
+	var reqLines, resLines []string
+	isResponse := false
+	for _, line := range strings.Split(text, "\n") {
+		if !isResponse && strings.HasPrefix(line, "---") {
+			isResponse = true
+			continue
+		}
+		if isResponse {
+			resLines = append(resLines, line)
+		} else {
+			reqLines = append(reqLines, line)
+		}
+	}
+	if !isResponse {
+		return nil, fmt.Errorf("missing --- separator in definition of %s", name)
+	}
+
+	texts, err := splitDefinition(name+"Response", strings.Join(resLines, "\n"))
+	if err != nil {
+		return nil, err
+	}
+	texts[name+"Request"] = strings.Join(reqLines, "\n")
+
+	ctx.mutex.Lock()
+	defer ctx.mutex.Unlock()
+	t := &ServiceType{name: name}
+	if t.request, err = ctx.messageType(name+"Request", texts); err != nil {
+		return nil, err
+	}
+	if t.response, err = ctx.messageType(name+"Response", texts); err != nil {
+		return nil, err
+	}
+	hash := md5.New()
+	hash.Write([]byte(md5Text(t.request)))
+	hash.Write([]byte(md5Text(t.response)))
+	t.md5sum = hex.EncodeToString(hash.Sum(nil))
+	return t, nil
+}
@@ -0,0 +1,254 @@
+package dynamic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	headerType     = "Header"
+	headerFullName = "std_msgs/Header"
+	headerText     = "uint32 seq\ntime stamp\nstring frame_id\n"
+)
+
+var builtinTypes = map[string]bool{
+	"int8": true, "uint8": true, "int16": true, "uint16": true,
+	"int32": true, "uint32": true, "int64": true, "uint64": true,
+	"float32": true, "float64": true, "string": true, "bool": true,
+	"time": true, "duration": true,
+	// deprecated:
+	"char": true, "byte": true,
+}
+
+func isBuiltinType(t string) bool {
+	return builtinTypes[t]
+}
+
+// Field is a field of a message definition.
+type Field struct {
+	Name string
+	// Type is a builtin type or the full name of a message type.
+	Type    string
+	IsArray bool
+	// ArrayLen is the length of fixed size arrays and -1 otherwise.
+	ArrayLen int
+}
+
+// IsBuiltin tells whether the field type is not a message type.
+func (f Field) IsBuiltin() bool {
+	return isBuiltinType(f.Type)
+}
+
+func (f Field) String() string {
+	if f.IsArray && f.ArrayLen >= 0 {
+		return fmt.Sprintf("%s[%d] %s", f.Type, f.ArrayLen, f.Name)
+	} else if f.IsArray {
+		return fmt.Sprintf("%s[] %s", f.Type, f.Name)
+	}
+	return fmt.Sprintf("%s %s", f.Type, f.Name)
+}
+
+// Constant is a constant of a message definition.
+type Constant struct {
+	Type      string
+	Name      string
+	Value     interface{}
+	ValueText string
+}
+
+type msgSpec struct {
+	name      string
+	text      string
+	fields    []Field
+	constants []Constant
+}
+
+func splitName(name string) (string, string) {
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+func stripComment(line string) string {
+	return strings.TrimSpace(strings.SplitN(line, "#", 2)[0])
+}
+
+// parseSpec parses the text of a .msg file.
+func parseSpec(name string, text string) (*msgSpec, error) {
+	pkg, _ := splitName(name)
+	spec := &msgSpec{name: name, text: text}
+	for lineno, line := range strings.Split(text, "\n") {
+		clean := stripComment(line)
+		if len(clean) == 0 {
+			continue
+		}
+		i := strings.IndexFunc(clean, unicode.IsSpace)
+		if i < 0 {
+			return nil, fmt.Errorf("[%s@%d] invalid declaration: %s", name, lineno, line)
+		}
+		fieldType := clean[:i]
+		rest := strings.TrimSpace(clean[i:])
+		if eq := strings.Index(rest, "="); eq >= 0 {
+			c, err := parseConstant(fieldType, line, rest[:eq])
+			if err != nil {
+				return nil, fmt.Errorf("[%s@%d] %v", name, lineno, err)
+			}
+			spec.constants = append(spec.constants, *c)
+			continue
+		}
+		f, err := parseField(pkg, fieldType, rest)
+		if err != nil {
+			return nil, fmt.Errorf("[%s@%d] %v", name, lineno, err)
+		}
+		spec.fields = append(spec.fields, *f)
+	}
+	return spec, nil
+}
+
+func parseField(pkg string, fieldType string, name string) (*Field, error) {
+	f := &Field{Name: name, ArrayLen: -1}
+	if i := strings.Index(fieldType, "["); i >= 0 {
+		if !strings.HasSuffix(fieldType, "]") {
+			return nil, fmt.Errorf("missing ']' in %s", fieldType)
+		}
+		f.IsArray = true
+		if size := fieldType[i+1 : len(fieldType)-1]; len(size) > 0 {
+			n, err := strconv.ParseUint(size, 10, 31)
+			if err != nil {
+				return nil, fmt.Errorf("invalid array length in %s", fieldType)
+			}
+			f.ArrayLen = int(n)
+		}
+		fieldType = fieldType[:i]
+	}
+	if fieldType == headerType {
+		fieldType = headerFullName
+	} else if !isBuiltinType(fieldType) && !strings.Contains(fieldType, "/") {
+		if len(pkg) == 0 {
+			return nil, fmt.Errorf("cannot resolve type %s", fieldType)
+		}
+		fieldType = pkg + "/" + fieldType
+	}
+	f.Type = fieldType
+	return f, nil
+}
+
+func parseConstant(fieldType string, line string, name string) (*Constant, error) {
+	name = strings.TrimSpace(name)
+	var valueText string
+	if fieldType == "string" {
+		// String constants take everything after '=' including '#'.
+		valueText = strings.TrimSpace(line[strings.Index(line, "=")+1:])
+	} else {
+		clean := stripComment(line)
+		valueText = strings.TrimSpace(clean[strings.Index(clean, "=")+1:])
+	}
+	value, err := parseConstantValue(fieldType, valueText)
+	if err != nil {
+		return nil, err
+	}
+	return &Constant{fieldType, name, value, valueText}, nil
+}
+
+func parseConstantValue(fieldType string, text string) (interface{}, error) {
+	switch fieldType {
+	case "string":
+		return text, nil
+	case "bool":
+		switch text {
+		case "True", "true", "1":
+			return true, nil
+		case "False", "false", "0", "None":
+			return false, nil
+		}
+		return nil, fmt.Errorf("invalid bool constant %s", text)
+	case "float32":
+		v, err := strconv.ParseFloat(text, 32)
+		return float32(v), err
+	case "float64":
+		return strconv.ParseFloat(text, 64)
+	case "int8", "int16", "int32", "int64":
+		v, err := strconv.ParseInt(text, 0, bitSize(fieldType))
+		if err != nil {
+			return nil, err
+		}
+		return convertInt(fieldType, v), nil
+	case "uint8", "uint16", "uint32", "uint64", "char", "byte":
+		v, err := strconv.ParseUint(text, 0, bitSize(fieldType))
+		if err != nil {
+			return nil, err
+		}
+		return convertUint(fieldType, v), nil
+	}
+	return nil, fmt.Errorf("invalid constant type %s", fieldType)
+}
+
+func bitSize(t string) int {
+	switch t {
+	case "int8", "uint8", "char", "byte":
+		return 8
+	case "int16", "uint16":
+		return 16
+	case "int32", "uint32", "float32":
+		return 32
+	}
+	return 64
+}
+
+func convertInt(t string, v int64) interface{} {
+	switch t {
+	case "int8":
+		return int8(v)
+	case "int16":
+		return int16(v)
+	case "int32":
+		return int32(v)
+	}
+	return v
+}
+
+func convertUint(t string, v uint64) interface{} {
+	switch t {
+	case "uint8", "char", "byte":
+		return uint8(v)
+	case "uint16":
+		return uint16(v)
+	case "uint32":
+		return uint32(v)
+	}
+	return v
+}
+
+// splitDefinition splits a full message definition, as found in the
+// message_definition connection header, into the texts of each type.
+func splitDefinition(name string, definition string) (map[string]string, error) {
+	texts := make(map[string]string)
+	current := name
+	var lines []string
+	flush := func() {
+		texts[current] = strings.Join(lines, "\n")
+		lines = nil
+	}
+	all := strings.Split(definition, "\n")
+	for i := 0; i < len(all); i++ {
+		line := all[i]
+		if len(line) >= 3 && strings.Trim(line, "=") == "" {
+			flush()
+			if i+1 >= len(all) || !strings.HasPrefix(all[i+1], "MSG: ") {
+				return nil, fmt.Errorf("malformed definition of %s: missing MSG: line", name)
+			}
+			current = strings.TrimSpace(all[i+1][len("MSG: "):])
+			if current == headerType {
+				current = headerFullName
+			}
+			i++
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return texts, nil
+}
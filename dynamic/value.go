@@ -0,0 +1,324 @@
+package dynamic
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// Get returns the value at path, a list of field names separated by '/' or
+// '.' where array elements are selected with [index], e.g. "pose/position/x"
+// or "points[0].x".
+func (m *Message) Get(path string) (interface{}, error) {
+	var value interface{} = m
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '.' }) {
+		name := part
+		var indices []int
+		if i := strings.Index(part, "["); i >= 0 {
+			name = part[:i]
+			for _, s := range strings.Split(strings.TrimSuffix(part[i+1:], "]"), "][") {
+				index, err := strconv.Atoi(s)
+				if err != nil {
+					return nil, fmt.Errorf("invalid index in %s", part)
+				}
+				indices = append(indices, index)
+			}
+		}
+		if len(name) > 0 {
+			msg, ok := value.(*Message)
+			if !ok {
+				return nil, fmt.Errorf("%s is not a message", name)
+			}
+			if value, ok = msg.Data[name]; !ok {
+				return nil, fmt.Errorf("%s has no field %s", msg.msgType.name, name)
+			}
+		}
+		for _, index := range indices {
+			switch v := value.(type) {
+			case []interface{}:
+				if index < 0 {
+					index += len(v)
+				}
+				if index < 0 || index >= len(v) {
+					return nil, fmt.Errorf("index %d out of range in %s", index, part)
+				}
+				value = v[index]
+			case []byte:
+				if index < 0 {
+					index += len(v)
+				}
+				if index < 0 || index >= len(v) {
+					return nil, fmt.Errorf("index %d out of range in %s", index, part)
+				}
+				value = v[index]
+			default:
+				return nil, fmt.Errorf("%s is not an array", part)
+			}
+		}
+	}
+	return value, nil
+}
+
+// Fill sets fields from generic values such as decoded YAML or JSON. A map
+// sets the fields by name and a list sets them in definition order. Fields
+// not given keep their values.
+func (m *Message) Fill(value interface{}) error {
+	t := m.msgType
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		for key, item := range v {
+			index := -1
+			for i, f := range t.fields {
+				if f.Name == key {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				return fmt.Errorf("%s has no field %s", t.name, key)
+			}
+			if err := m.setField(index, item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(v) > len(t.fields) {
+			return fmt.Errorf("too many values for %s: %d", t.name, len(v))
+		}
+		for i, item := range v {
+			if err := m.setField(i, item); err != nil {
+				return err
+			}
+		}
+	default:
+		if len(t.fields) != 1 {
+			return fmt.Errorf("cannot set %s from %v", t.name, value)
+		}
+		return m.setField(0, value)
+	}
+	return nil
+}
+
+func (m *Message) setField(index int, value interface{}) error {
+	t := m.msgType
+	f := t.fields[index]
+	v, err := convertField(f, t.nested[index], m.Data[f.Name], value)
+	if err != nil {
+		return fmt.Errorf("%s.%s: %v", t.name, f.Name, err)
+	}
+	m.Data[f.Name] = v
+	return nil
+}
+
+func convertField(f Field, nested *MessageType, current interface{}, value interface{}) (interface{}, error) {
+	if !f.IsArray {
+		return convertValue(f.Type, nested, current, value)
+	}
+	if data, ok := value.([]byte); ok && isByteType(f.Type) {
+		value = string(data)
+	}
+	if s, ok := value.(string); ok && isByteType(f.Type) {
+		value = []byte(s)
+		if f.ArrayLen >= 0 && len(s) != f.ArrayLen {
+			return nil, fmt.Errorf("expected %d elements but %d", f.ArrayLen, len(s))
+		}
+		return value, nil
+	}
+	var items []interface{}
+	if value != nil {
+		var ok bool
+		if items, ok = value.([]interface{}); !ok {
+			return nil, fmt.Errorf("expected a list but %v", value)
+		}
+	}
+	if f.ArrayLen >= 0 && len(items) != f.ArrayLen {
+		return nil, fmt.Errorf("expected %d elements but %d", f.ArrayLen, len(items))
+	}
+	if isByteType(f.Type) {
+		data := make([]byte, len(items))
+		for i, item := range items {
+			v, err := convertValue(f.Type, nil, nil, item)
+			if err != nil {
+				return nil, err
+			}
+			data[i] = v.(uint8)
+		}
+		return data, nil
+	}
+	values := make([]interface{}, len(items))
+	for i, item := range items {
+		v, err := convertValue(f.Type, nested, nil, item)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func convertValue(t string, nested *MessageType, current interface{}, value interface{}) (interface{}, error) {
+	if nested != nil {
+		if m, ok := value.(*Message); ok {
+			return m, nil
+		}
+		m, ok := current.(*Message)
+		if !ok {
+			m = nested.New()
+		}
+		return m, m.Fill(value)
+	}
+	switch t {
+	case "string":
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		if value == nil {
+			return "", nil
+		}
+		return fmt.Sprint(value), nil
+	case "bool":
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("expected bool but %v", value)
+	case "time", "duration":
+		return convertTemporal(t, value)
+	case "float32", "float64":
+		f, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("expected a number but %v", value)
+		}
+		if t == "float32" {
+			return float32(f), nil
+		}
+		return f, nil
+	}
+	if f, ok := value.(float64); ok && f == math.Trunc(f) {
+		value = int64(f)
+	}
+	if !isBuiltinType(t) {
+		return nil, fmt.Errorf("unknown type %s", t)
+	}
+	if strings.HasPrefix(t, "int") {
+		i, ok := toInt(value)
+		if !ok {
+			return nil, fmt.Errorf("expected an integer but %v", value)
+		}
+		bits := uint(bitSize(t))
+		if bits < 64 && (i < -1<<(bits-1) || i >= 1<<(bits-1)) {
+			return nil, fmt.Errorf("%d out of range of %s", i, t)
+		}
+		return convertInt(t, i), nil
+	}
+	u, ok := toUint(value)
+	if !ok {
+		return nil, fmt.Errorf("expected an unsigned integer but %v", value)
+	}
+	bits := uint(bitSize(t))
+	if bits < 64 && u >= 1<<bits {
+		return nil, fmt.Errorf("%d out of range of %s", u, t)
+	}
+	return convertUint(t, u), nil
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	if i, ok := toInt(value); ok {
+		return float64(i), true
+	}
+	if u, ok := toUint(value); ok {
+		return float64(u), true
+	}
+	return 0, false
+}
+
+func toInt(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+func toUint(value interface{}) (uint64, bool) {
+	if v, ok := value.(uint64); ok {
+		return v, true
+	}
+	if i, ok := toInt(value); ok && i >= 0 {
+		return uint64(i), true
+	}
+	return 0, false
+}
+
+func convertTemporal(t string, value interface{}) (interface{}, error) {
+	var sec, nsec int64
+	switch v := value.(type) {
+	case ros.Time:
+		return v, nil
+	case ros.Duration:
+		return v, nil
+	case string:
+		if v != "now" || t != "time" {
+			return nil, fmt.Errorf("invalid %s %q", t, v)
+		}
+		return ros.Now(), nil
+	case map[string]interface{}:
+		for key, item := range v {
+			i, ok := toInt(item)
+			if !ok {
+				return nil, fmt.Errorf("invalid %s %v", t, value)
+			}
+			switch key {
+			case "secs":
+				sec = i
+			case "nsecs":
+				nsec = i
+			default:
+				return nil, fmt.Errorf("invalid %s field %s", t, key)
+			}
+		}
+	default:
+		f, ok := toFloat(value)
+		if !ok {
+			return nil, fmt.Errorf("invalid %s %v", t, value)
+		}
+		d := time.Duration(f * float64(time.Second))
+		sec, nsec = int64(d/time.Second), int64(d%time.Second)
+	}
+	if sec < 0 || nsec < 0 {
+		return nil, fmt.Errorf("negative %s %v", t, value)
+	}
+	if t == "time" {
+		return ros.NewTime(uint32(sec), uint32(nsec)), nil
+	}
+	return ros.NewDuration(uint32(sec), uint32(nsec)), nil
+}
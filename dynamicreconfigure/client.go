@@ -0,0 +1,173 @@
+package dynamicreconfigure
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// Client changes the configuration of the server of another node.
+type Client interface {
+	// Configuration returns the latest configuration published by the
+	// server, or nil.
+	Configuration() Config
+	// Description returns the description published by the server, or nil.
+	Description() *Description
+	// WaitForConfiguration waits at most timeout for a configuration.
+	WaitForConfiguration(timeout time.Duration) (Config, error)
+	// WaitForDescription waits at most timeout for the description.
+	WaitForDescription(timeout time.Duration) (*Description, error)
+	// UpdateConfiguration changes parameters and returns the resulting
+	// configuration.
+	UpdateConfiguration(changes Config) (Config, error)
+	Shutdown()
+}
+
+// ClientOption configures a Client.
+type ClientOption func(c *defaultClient)
+
+// ClientConfigCallback sets a callback called with each configuration
+// published by the server.
+func ClientConfigCallback(callback func(config Config)) ClientOption {
+	return func(c *defaultClient) {
+		c.configCallback = callback
+	}
+}
+
+// ClientDescriptionCallback sets a callback called with the description
+// published by the server.
+func ClientDescriptionCallback(callback func(description *Description)) ClientOption {
+	return func(c *defaultClient) {
+		c.descriptionCallback = callback
+	}
+}
+
+type defaultClient struct {
+	mutex               sync.Mutex
+	config              Config
+	description         *Description
+	configCallback      func(config Config)
+	descriptionCallback func(description *Description)
+	// updated is closed and replaced whenever a message is received.
+	updated      chan struct{}
+	service      ros.ServiceClient
+	updates      ros.Subscriber
+	descriptions ros.Subscriber
+}
+
+// NewClient creates a client of the server of namespace server, usually the
+// name of its node.
+func NewClient(node ros.Node, server string, options ...ClientOption) Client {
+	c := &defaultClient{updated: make(chan struct{})}
+	for _, opt := range options {
+		opt(c)
+	}
+	c.service = node.NewServiceClient(server+"/set_parameters", ReconfigureType)
+	c.descriptions = node.NewSubscriber(server+"/parameter_descriptions", ConfigDescriptionType, func(msg *dynamic.Message) {
+		description := parseDescriptionMessage(msg)
+		c.mutex.Lock()
+		c.description = description
+		c.notify()
+		c.mutex.Unlock()
+		if c.descriptionCallback != nil {
+			c.descriptionCallback(description)
+		}
+	})
+	c.updates = node.NewSubscriber(server+"/parameter_updates", ConfigType, func(msg *dynamic.Message) {
+		config, _ := parseConfigMessage(msg)
+		c.mutex.Lock()
+		c.config = config
+		c.notify()
+		c.mutex.Unlock()
+		if c.configCallback != nil {
+			c.configCallback(config.copy())
+		}
+	})
+	return c
+}
+
+func (c *defaultClient) notify() {
+	close(c.updated)
+	c.updated = make(chan struct{})
+}
+
+func (c *defaultClient) Configuration() Config {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.config.copy()
+}
+
+func (c *defaultClient) Description() *Description {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.description
+}
+
+// wait waits at most timeout for ready to return true.
+func (c *defaultClient) wait(timeout time.Duration, ready func() bool) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		c.mutex.Lock()
+		ok, updated := ready(), c.updated
+		c.mutex.Unlock()
+		if ok {
+			return true
+		}
+		select {
+		case <-updated:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+func (c *defaultClient) WaitForConfiguration(timeout time.Duration) (Config, error) {
+	if !c.wait(timeout, func() bool { return c.config != nil }) {
+		return nil, fmt.Errorf("dynamicreconfigure: no configuration received after %v", timeout)
+	}
+	return c.Configuration(), nil
+}
+
+func (c *defaultClient) WaitForDescription(timeout time.Duration) (*Description, error) {
+	if !c.wait(timeout, func() bool { return c.description != nil }) {
+		return nil, fmt.Errorf("dynamicreconfigure: no description received after %v", timeout)
+	}
+	return c.Description(), nil
+}
+
+func (c *defaultClient) UpdateConfiguration(changes Config) (Config, error) {
+	var params []ParamDescription
+	if description := c.Description(); description != nil {
+		params = description.Params()
+		names := map[string]bool{}
+		for _, p := range params {
+			names[p.Name] = true
+		}
+		for name := range changes {
+			if !names[name] {
+				return nil, fmt.Errorf("dynamicreconfigure: unknown parameter %s", name)
+			}
+		}
+	}
+	msg, err := newConfigMessage(changes, params, nil)
+	if err != nil {
+		return nil, err
+	}
+	srv := ReconfigureType.New()
+	srv.Request.Data["config"] = msg
+	if err := c.service.Call(srv); err != nil {
+		return nil, err
+	}
+	config, _ := parseConfigMessage(srv.Response.Data["config"].(*dynamic.Message))
+	return config, nil
+}
+
+func (c *defaultClient) Shutdown() {
+	c.service.Shutdown()
+	c.updates.Shutdown()
+	c.descriptions.Shutdown()
+}
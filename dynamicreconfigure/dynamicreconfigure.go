@@ -0,0 +1,409 @@
+// Package dynamicreconfigure implements the dynamic_reconfigure protocol,
+// which lets tools such as rqt_reconfigure change the parameters of a
+// running node.
+//
+// A Server declares its parameters with a struct instead of a .cfg file.
+// Each field is a parameter of type bool, int, str or double, described by
+// tags, and struct fields are groups of parameters:
+//
+//	type Config struct {
+//		Speed float64 `param:"speed" default:"0.5" min:"0" max:"2" description:"Maximum speed"`
+//		Mode  int     `param:"mode" default:"1" enum:"Slow=0,Normal=1,Fast=2"`
+//		Laser struct {
+//			Enabled bool `param:"enabled" default:"true" level:"1"`
+//		} `group:"Laser"`
+//	}
+//
+//	server, err := dynamicreconfigure.NewServer(node, func(config *Config, level uint32) {
+//		// Apply the configuration.
+//	})
+//
+// A Client changes the configuration of a server of another node.
+package dynamicreconfigure
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+)
+
+const configDefinition = `BoolParameter[] bools
+IntParameter[] ints
+StrParameter[] strs
+DoubleParameter[] doubles
+GroupState[] groups
+================================================================================
+MSG: dynamic_reconfigure/BoolParameter
+string name
+bool value
+================================================================================
+MSG: dynamic_reconfigure/IntParameter
+string name
+int32 value
+================================================================================
+MSG: dynamic_reconfigure/StrParameter
+string name
+string value
+================================================================================
+MSG: dynamic_reconfigure/DoubleParameter
+string name
+float64 value
+================================================================================
+MSG: dynamic_reconfigure/GroupState
+string name
+bool state
+int32 id
+int32 parent
+`
+
+const configDescriptionDefinition = `Group[] groups
+Config max
+Config min
+Config dflt
+================================================================================
+MSG: dynamic_reconfigure/Group
+string name
+string type
+ParamDescription[] parameters
+int32 parent
+int32 id
+================================================================================
+MSG: dynamic_reconfigure/ParamDescription
+string name
+string type
+uint32 level
+string description
+string edit_method
+================================================================================
+MSG: dynamic_reconfigure/Config
+` + configDefinition
+
+var (
+	// ConfigType is the dynamic_reconfigure/Config type of the
+	// parameter_updates topic.
+	ConfigType *dynamic.MessageType
+	// ConfigDescriptionType is the dynamic_reconfigure/ConfigDescription
+	// type of the parameter_descriptions topic.
+	ConfigDescriptionType *dynamic.MessageType
+	// ReconfigureType is the dynamic_reconfigure/Reconfigure type of the
+	// set_parameters service.
+	ReconfigureType *dynamic.ServiceType
+)
+
+func init() {
+	ctx := dynamic.NewContext(nil)
+	var err error
+	if ConfigType, err = ctx.AddDefinition("dynamic_reconfigure/Config", configDefinition); err != nil {
+		panic(err)
+	}
+	if ConfigDescriptionType, err = ctx.AddDefinition("dynamic_reconfigure/ConfigDescription", configDescriptionDefinition); err != nil {
+		panic(err)
+	}
+	reconfigure := "Config config\n---\nConfig config\n" +
+		"================================================================================\n" +
+		"MSG: dynamic_reconfigure/Config\n" + configDefinition
+	if ReconfigureType, err = ctx.AddServiceDefinition("dynamic_reconfigure/Reconfigure", reconfigure); err != nil {
+		panic(err)
+	}
+}
+
+// Parameter types.
+const (
+	TypeBool   = "bool"
+	TypeInt    = "int"
+	TypeStr    = "str"
+	TypeDouble = "double"
+)
+
+// configFields are the fields of a dynamic_reconfigure/Config by parameter
+// type.
+var configFields = map[string]string{
+	TypeBool:   "bools",
+	TypeInt:    "ints",
+	TypeStr:    "strs",
+	TypeDouble: "doubles",
+}
+
+// ParamDescription describes a parameter.
+type ParamDescription struct {
+	Name        string
+	Type        string
+	Level       uint32
+	Description string
+	// EditMethod describes the values of an enum parameter, as a Python
+	// dictionary.
+	EditMethod string
+	// Min, Max and Default are a bool, an int, a string or a float64
+	// depending on Type.
+	Min, Max, Default interface{}
+}
+
+// Group is a group of parameters. The top-level group is named Default and
+// its id and parent are 0.
+type Group struct {
+	Name       string
+	Type       string
+	ID, Parent int32
+	State      bool
+	Params     []ParamDescription
+}
+
+// Description describes the parameters of a server.
+type Description struct {
+	Groups []Group
+}
+
+// Params returns the parameters of all the groups.
+func (d *Description) Params() []ParamDescription {
+	var params []ParamDescription
+	for _, g := range d.Groups {
+		params = append(params, g.Params...)
+	}
+	return params
+}
+
+// GroupState is the state of a group in a configuration.
+type GroupState struct {
+	Name       string
+	State      bool
+	ID, Parent int32
+}
+
+// Config is the value of parameters by name, each a bool, an int, a string
+// or a float64.
+type Config map[string]interface{}
+
+func (config Config) copy() Config {
+	if config == nil {
+		return nil
+	}
+	c := Config{}
+	for name, value := range config {
+		c[name] = value
+	}
+	return c
+}
+
+// typeOf returns the parameter type of a value.
+func typeOf(value interface{}) (string, error) {
+	switch reflect.ValueOf(value).Kind() {
+	case reflect.Bool:
+		return TypeBool, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return TypeInt, nil
+	case reflect.String:
+		return TypeStr, nil
+	case reflect.Float32, reflect.Float64:
+		return TypeDouble, nil
+	}
+	return "", fmt.Errorf("dynamicreconfigure: unsupported parameter value %v of type %T", value, value)
+}
+
+// convert converts a value to the Go type of a parameter type.
+func convert(value interface{}, typ string) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	switch kind := v.Kind(); {
+	case typ == TypeBool && kind == reflect.Bool:
+		return v.Bool(), nil
+	case typ == TypeStr && kind == reflect.String:
+		return v.String(), nil
+	case typ == TypeInt && kind >= reflect.Int && kind <= reflect.Int64:
+		return int(v.Int()), nil
+	case typ == TypeInt && kind >= reflect.Uint && kind <= reflect.Uint64:
+		return int(v.Uint()), nil
+	case typ == TypeInt && (kind == reflect.Float32 || kind == reflect.Float64) && v.Float() == math.Trunc(v.Float()):
+		return int(v.Float()), nil
+	case typ == TypeDouble && kind >= reflect.Int && kind <= reflect.Int64:
+		return float64(v.Int()), nil
+	case typ == TypeDouble && kind >= reflect.Uint && kind <= reflect.Uint64:
+		return float64(v.Uint()), nil
+	case typ == TypeDouble && (kind == reflect.Float32 || kind == reflect.Float64):
+		return v.Float(), nil
+	}
+	return nil, fmt.Errorf("dynamicreconfigure: value %v of type %T is not a %s", value, value, typ)
+}
+
+// newConfigMessage returns a dynamic_reconfigure/Config of a configuration,
+// whose values are converted to the types of params, or typed by their Go
+// types when they are not in params.
+func newConfigMessage(config Config, params []ParamDescription, groups []GroupState) (*dynamic.Message, error) {
+	types := map[string]string{}
+	for _, p := range params {
+		types[p.Name] = p.Type
+	}
+	msg := ConfigType.New()
+	add := func(name string, value interface{}) error {
+		typ, ok := types[name]
+		if !ok {
+			var err error
+			if typ, err = typeOf(value); err != nil {
+				return err
+			}
+		}
+		v, err := convert(value, typ)
+		if err != nil {
+			return fmt.Errorf("dynamicreconfigure: parameter %s: %v", name, err)
+		}
+		if typ == TypeInt {
+			v = int32(v.(int))
+		}
+		field := configFields[typ]
+		param := ConfigType.FieldType(field).New()
+		param.Data["name"] = name
+		param.Data["value"] = v
+		msg.Data[field] = append(msg.Data[field].([]interface{}), param)
+		return nil
+	}
+	// The parameters are sent in the order of their description.
+	for _, p := range params {
+		if value, ok := config[p.Name]; ok {
+			if err := add(p.Name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for name, value := range config {
+		if _, ok := types[name]; !ok {
+			if err := add(name, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	stateType := ConfigType.FieldType("groups")
+	states := make([]interface{}, len(groups))
+	for i, g := range groups {
+		state := stateType.New()
+		state.Data["name"] = g.Name
+		state.Data["state"] = g.State
+		state.Data["id"] = g.ID
+		state.Data["parent"] = g.Parent
+		states[i] = state
+	}
+	msg.Data["groups"] = states
+	return msg, nil
+}
+
+// parseConfigMessage returns the configuration and the group states of a
+// dynamic_reconfigure/Config.
+func parseConfigMessage(msg *dynamic.Message) (Config, []GroupState) {
+	config := Config{}
+	for _, field := range configFields {
+		params, _ := msg.Data[field].([]interface{})
+		for _, p := range params {
+			param := p.(*dynamic.Message)
+			value := param.Data["value"]
+			if v, ok := value.(int32); ok {
+				value = int(v)
+			}
+			config[param.Data["name"].(string)] = value
+		}
+	}
+	var groups []GroupState
+	states, _ := msg.Data["groups"].([]interface{})
+	for _, s := range states {
+		state := s.(*dynamic.Message)
+		groups = append(groups, GroupState{
+			Name:   state.Data["name"].(string),
+			State:  state.Data["state"].(bool),
+			ID:     state.Data["id"].(int32),
+			Parent: state.Data["parent"].(int32),
+		})
+	}
+	return config, groups
+}
+
+func groupStates(d *Description) []GroupState {
+	states := make([]GroupState, len(d.Groups))
+	for i, g := range d.Groups {
+		states[i] = GroupState{g.Name, g.State, g.ID, g.Parent}
+	}
+	return states
+}
+
+// newDescriptionMessage returns the dynamic_reconfigure/ConfigDescription
+// of a description.
+func newDescriptionMessage(d *Description) (*dynamic.Message, error) {
+	msg := ConfigDescriptionType.New()
+	groupType := ConfigDescriptionType.FieldType("groups")
+	paramType := groupType.FieldType("parameters")
+	groups := make([]interface{}, len(d.Groups))
+	for i, g := range d.Groups {
+		group := groupType.New()
+		group.Data["name"] = g.Name
+		group.Data["type"] = g.Type
+		group.Data["parent"] = g.Parent
+		group.Data["id"] = g.ID
+		params := make([]interface{}, len(g.Params))
+		for j, p := range g.Params {
+			param := paramType.New()
+			param.Data["name"] = p.Name
+			param.Data["type"] = p.Type
+			param.Data["level"] = p.Level
+			param.Data["description"] = p.Description
+			param.Data["edit_method"] = p.EditMethod
+			params[j] = param
+		}
+		group.Data["parameters"] = params
+		groups[i] = group
+	}
+	msg.Data["groups"] = groups
+
+	params := d.Params()
+	min, max, dflt := Config{}, Config{}, Config{}
+	for _, p := range params {
+		min[p.Name], max[p.Name], dflt[p.Name] = p.Min, p.Max, p.Default
+	}
+	for field, config := range map[string]Config{"min": min, "max": max, "dflt": dflt} {
+		m, err := newConfigMessage(config, params, groupStates(d))
+		if err != nil {
+			return nil, err
+		}
+		msg.Data[field] = m
+	}
+	return msg, nil
+}
+
+// parseDescriptionMessage returns the description of a
+// dynamic_reconfigure/ConfigDescription.
+func parseDescriptionMessage(msg *dynamic.Message) *Description {
+	min, _ := parseConfigMessage(msg.Data["min"].(*dynamic.Message))
+	max, _ := parseConfigMessage(msg.Data["max"].(*dynamic.Message))
+	dflt, states := parseConfigMessage(msg.Data["dflt"].(*dynamic.Message))
+	d := &Description{}
+	groups, _ := msg.Data["groups"].([]interface{})
+	for _, value := range groups {
+		group := value.(*dynamic.Message)
+		g := Group{
+			Name:   group.Data["name"].(string),
+			Type:   group.Data["type"].(string),
+			ID:     group.Data["id"].(int32),
+			Parent: group.Data["parent"].(int32),
+			State:  true,
+		}
+		for _, s := range states {
+			if s.ID == g.ID {
+				g.State = s.State
+			}
+		}
+		params, _ := group.Data["parameters"].([]interface{})
+		for _, value := range params {
+			param := value.(*dynamic.Message)
+			name := param.Data["name"].(string)
+			g.Params = append(g.Params, ParamDescription{
+				Name:        name,
+				Type:        param.Data["type"].(string),
+				Level:       param.Data["level"].(uint32),
+				Description: param.Data["description"].(string),
+				EditMethod:  param.Data["edit_method"].(string),
+				Min:         min[name],
+				Max:         max[name],
+				Default:     dflt[name],
+			})
+		}
+		d.Groups = append(d.Groups, g)
+	}
+	return d
+}
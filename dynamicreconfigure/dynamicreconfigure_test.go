@@ -0,0 +1,216 @@
+package dynamicreconfigure
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+type testConfig struct {
+	Speed float64 `param:"speed" default:"0.5" min:"0" max:"2" level:"1" description:"Maximum speed"`
+	Mode  int     `param:"mode" default:"1" level:"2" enum:"Slow=0, Normal=1, Fast=2" enum_description:"Speed mode"`
+	Laser struct {
+		Enabled bool   `param:"enabled" default:"true" level:"4"`
+		Frame   string `param:"frame" default:"laser"`
+		Filter  struct {
+			Window int `param:"window" min:"1"`
+		} `group:"Filter" type:"collapse"`
+	}
+	ignored string
+	Skipped int `param:"-"`
+}
+
+func TestDescribe(t *testing.T) {
+	d, params, err := describe(reflect.TypeOf(testConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(params) != 5 {
+		t.Errorf("expected 5 parameters but %v", params)
+	}
+	want := &Description{Groups: []Group{
+		{Name: "Default", State: true, Params: []ParamDescription{
+			{Name: "speed", Type: TypeDouble, Level: 1, Description: "Maximum speed", Min: 0.0, Max: 2.0, Default: 0.5},
+			{Name: "mode", Type: TypeInt, Level: 2, Min: math.MinInt32, Max: math.MaxInt32, Default: 1,
+				EditMethod: "{'enum': [{'name': 'Slow', 'type': 'int', 'value': 0, 'description': ''}, " +
+					"{'name': 'Normal', 'type': 'int', 'value': 1, 'description': ''}, " +
+					"{'name': 'Fast', 'type': 'int', 'value': 2, 'description': ''}], 'enum_description': 'Speed mode'}"},
+		}},
+		{Name: "Laser", ID: 1, State: true, Params: []ParamDescription{
+			{Name: "enabled", Type: TypeBool, Level: 4, Min: false, Max: true, Default: true},
+			{Name: "frame", Type: TypeStr, Min: "", Max: "", Default: "laser"},
+		}},
+		{Name: "Filter", Type: "collapse", ID: 2, Parent: 1, State: true, Params: []ParamDescription{
+			{Name: "window", Type: TypeInt, Min: 1, Max: math.MaxInt32, Default: 0},
+		}},
+	}}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("expected\n%+v\nbut\n%+v", want, d)
+	}
+
+	for _, config := range []interface{}{
+		struct {
+			A []int
+		}{},
+		struct {
+			A int `default:"a"`
+		}{},
+		struct {
+			A int `param:"a"`
+			B int `param:"a"`
+		}{},
+		struct {
+			A int `enum:"A"`
+		}{},
+	} {
+		if _, _, err := describe(reflect.TypeOf(config)); err == nil {
+			t.Errorf("expected an error for %T", config)
+		}
+	}
+}
+
+func TestMessages(t *testing.T) {
+	for _, tc := range []struct {
+		name, md5sum, want string
+	}{
+		{"Config", ConfigType.MD5Sum(), "958f16a05573709014982821e6822580"},
+		{"ConfigDescription", ConfigDescriptionType.MD5Sum(), "757ce9d44ba8ddd801bb30bc456f946f"},
+		{"Reconfigure", ReconfigureType.MD5Sum(), "bb125d226a21982a4a98760418dc2672"},
+	} {
+		if tc.md5sum != tc.want {
+			t.Errorf("%s: expected md5sum %s but %s", tc.name, tc.want, tc.md5sum)
+		}
+	}
+
+	d, _, err := describe(reflect.TypeOf(testConfig{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := newDescriptionMessage(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := parseDescriptionMessage(msg); !reflect.DeepEqual(got, d) {
+		t.Errorf("expected\n%+v\nbut\n%+v", d, got)
+	}
+
+	config := Config{"speed": 1, "mode": 2, "other": "value"}
+	msg, err = newConfigMessage(config, d.Params(), groupStates(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, groups := parseConfigMessage(msg)
+	if want := (Config{"speed": 1.0, "mode": 2, "other": "value"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but %v", want, got)
+	}
+	if !reflect.DeepEqual(groups, groupStates(d)) {
+		t.Errorf("expected groups %v but %v", groupStates(d), groups)
+	}
+	if _, err := newConfigMessage(Config{"mode": "fast"}, d.Params(), nil); err == nil {
+		t.Error("expected an error for a value of the wrong type")
+	}
+}
+
+func TestServer(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	node, err := ros.NewNode("/driver", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		wg.Wait()
+	}()
+	if err := node.SetParam("~speed", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	var levels []uint32
+	server, err := NewServer(node, func(config *testConfig, level uint32) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		levels = append(levels, level)
+		if config.Laser.Frame == "" {
+			config.Laser.Frame = "laser"
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Shutdown()
+	if config := server.Config().(*testConfig); config.Speed != 1 || config.Mode != 1 || !config.Laser.Enabled || config.Laser.Filter.Window != 1 {
+		t.Errorf("unexpected initial configuration %+v", config)
+	}
+
+	client := NewClient(node, "/driver")
+	defer client.Shutdown()
+	d, err := client.WaitForDescription(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(d, server.Description()) {
+		t.Errorf("expected the description\n%+v\nbut\n%+v", server.Description(), d)
+	}
+	config, err := client.WaitForConfiguration(5 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Config{"speed": 1.0, "mode": 1, "enabled": true, "frame": "laser", "window": 1}); !reflect.DeepEqual(config, want) {
+		t.Errorf("expected the configuration %v but %v", want, config)
+	}
+
+	config, err = client.UpdateConfiguration(Config{"speed": 3, "enabled": false, "frame": ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Config{"speed": 2.0, "mode": 1, "enabled": false, "frame": "laser", "window": 1}); !reflect.DeepEqual(config, want) {
+		t.Errorf("expected the configuration %v but %v", want, config)
+	}
+	mutex.Lock()
+	if want := []uint32{^uint32(0), 1 | 4}; !reflect.DeepEqual(levels, want) {
+		t.Errorf("expected the levels %v but %v", want, levels)
+	}
+	mutex.Unlock()
+	if speed, err := node.GetParam("~speed"); err != nil || speed != 2.0 {
+		t.Errorf("expected the speed parameter to be 2 but %v, %v", speed, err)
+	}
+	if _, err := client.UpdateConfiguration(Config{"unknown": 1}); err == nil {
+		t.Error("expected an error for an unknown parameter")
+	}
+
+	updated := server.Config().(*testConfig)
+	updated.Mode = 2
+	if err := server.UpdateConfig(updated); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Configuration()["mode"] != 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("the updated configuration was not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := server.UpdateConfig(&struct{}{}); err == nil {
+		t.Error("expected an error for a configuration of another type")
+	}
+	if _, err := NewServer(node, func(config testConfig) {}); err == nil {
+		t.Error("expected an error for an invalid callback")
+	}
+}
@@ -0,0 +1,436 @@
+package dynamicreconfigure
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// Server serves the configuration of a node, declared by a struct.
+//
+// The fields of the struct are described by tags:
+//
+//	param        name of the parameter, the field name by default, or "-"
+//	             to ignore the field
+//	default      default value, the zero value by default
+//	min, max     range of int and double parameters
+//	level        bits set in the level given to the callback when the
+//	             parameter changes
+//	description  description of the parameter
+//	enum         values of an enum parameter, such as "Slow=0,Fast=1"
+//	enum_description
+//	             description of the enum
+//
+// Struct fields are groups named by their group tag or their field name,
+// whose type tag is a dynamic_reconfigure group type such as "tab" or
+// "collapse", and whose state tag is "false" to hide the group.
+type Server interface {
+	// Config returns a copy of the configuration, a pointer to the struct
+	// declaring it.
+	Config() interface{}
+	// UpdateConfig sets and publishes the configuration, a pointer to the
+	// struct declaring it, without calling the callback.
+	UpdateConfig(config interface{}) error
+	// Description returns the description of the parameters.
+	Description() *Description
+	Shutdown()
+}
+
+// ServerOption configures a Server.
+type ServerOption func(s *defaultServer)
+
+// ServerNamespace sets the namespace of the topics, the service and the
+// parameters of the server, the private namespace of the node by default.
+func ServerNamespace(namespace string) ServerOption {
+	return func(s *defaultServer) {
+		s.namespace = namespace
+	}
+}
+
+// param is a parameter of a server and the index of its field.
+type param struct {
+	ParamDescription
+	index []int
+}
+
+type defaultServer struct {
+	mutex        sync.Mutex
+	node         ros.Node
+	namespace    string
+	callback     reflect.Value
+	description  *Description
+	params       []param
+	groups       []GroupState
+	config       reflect.Value
+	descriptions ros.Publisher
+	updates      ros.Publisher
+	service      ros.ServiceServer
+}
+
+// NewServer creates a server of the configuration declared by the struct
+// taken by callback, a func(config *Config, level uint32). The configuration
+// starts from the defaults, overridden by the parameter server, and callback
+// is called with it and a level of all bits set. Then callback is called with
+// each new configuration and the level bits of the parameters which changed,
+// and may modify it. The configuration is mirrored to the parameter server.
+func NewServer(node ros.Node, callback interface{}, options ...ServerOption) (Server, error) {
+	s := &defaultServer{node: node, namespace: "~", callback: reflect.ValueOf(callback)}
+	for _, opt := range options {
+		opt(s)
+	}
+	fun := s.callback.Type()
+	if fun.Kind() != reflect.Func || fun.NumIn() != 2 || fun.In(0).Kind() != reflect.Ptr ||
+		fun.In(0).Elem().Kind() != reflect.Struct || fun.In(1) != reflect.TypeOf(uint32(0)) {
+		return nil, fmt.Errorf("dynamicreconfigure: the callback must be a func(config *Config, level uint32) but %v", fun)
+	}
+	var err error
+	if s.description, s.params, err = describe(fun.In(0).Elem()); err != nil {
+		return nil, err
+	}
+	s.groups = groupStates(s.description)
+
+	config := reflect.New(fun.In(0).Elem())
+	for _, p := range s.params {
+		set(config, p, p.Default)
+		value, err := node.GetParam(s.name(p.Name))
+		if err != nil {
+			continue
+		}
+		if value, err = convert(value, p.Type); err != nil {
+			node.Logger().Warnf("dynamicreconfigure: ignoring parameter %s: %v", s.name(p.Name), err)
+			continue
+		}
+		set(config, p, value)
+	}
+	s.clamp(config)
+
+	descriptionMsg, err := newDescriptionMessage(s.description)
+	if err != nil {
+		return nil, err
+	}
+	s.descriptions = node.NewPublisher(s.name("parameter_descriptions"), ConfigDescriptionType, ros.PublisherLatched(true))
+	s.descriptions.Publish(descriptionMsg)
+	s.updates = node.NewPublisher(s.name("parameter_updates"), ConfigType, ros.PublisherLatched(true))
+	s.callback.Call([]reflect.Value{config, reflect.ValueOf(^uint32(0))})
+	s.update(config)
+	s.service = node.NewServiceServer(s.name("set_parameters"), ReconfigureType, s.setParameters)
+	return s, nil
+}
+
+func (s *defaultServer) name(name string) string {
+	if s.namespace == "~" {
+		return "~" + name
+	}
+	return strings.TrimSuffix(s.namespace, "/") + "/" + name
+}
+
+// update sets the configuration, mirrors it to the parameter server and
+// publishes it.
+func (s *defaultServer) update(config reflect.Value) {
+	s.config = config
+	values := s.values(config)
+	for _, p := range s.params {
+		if err := s.node.SetParam(s.name(p.Name), values[p.Name]); err != nil {
+			s.node.Logger().Errorf("dynamicreconfigure: setting parameter %s: %v", s.name(p.Name), err)
+		}
+	}
+	msg, err := newConfigMessage(values, s.description.Params(), s.groups)
+	if err != nil {
+		s.node.Logger().Error(err)
+		return
+	}
+	s.updates.Publish(msg)
+}
+
+func (s *defaultServer) setParameters(srv *dynamic.Service) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	changes, states := parseConfigMessage(srv.Request.Data["config"].(*dynamic.Message))
+	config := s.copy(s.config)
+	for _, p := range s.params {
+		value, ok := changes[p.Name]
+		if !ok {
+			continue
+		}
+		value, err := convert(value, p.Type)
+		if err != nil {
+			s.node.Logger().Warnf("dynamicreconfigure: ignoring parameter %s: %v", p.Name, err)
+			continue
+		}
+		set(config, p, value)
+	}
+	for _, state := range states {
+		for i := range s.groups {
+			if s.groups[i].Name == state.Name {
+				s.groups[i].State = state.State
+			}
+		}
+	}
+	s.clamp(config)
+	var level uint32
+	old, values := s.values(s.config), s.values(config)
+	for _, p := range s.params {
+		if old[p.Name] != values[p.Name] {
+			level |= p.Level
+		}
+	}
+	s.callback.Call([]reflect.Value{config, reflect.ValueOf(level)})
+	s.update(config)
+	msg, err := newConfigMessage(s.values(s.config), s.description.Params(), s.groups)
+	if err != nil {
+		return err
+	}
+	srv.Response.Data["config"] = msg
+	return nil
+}
+
+func (s *defaultServer) Config() interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.copy(s.config).Interface()
+}
+
+func (s *defaultServer) UpdateConfig(config interface{}) error {
+	v := reflect.ValueOf(config)
+	if v.Type() != s.config.Type() {
+		return fmt.Errorf("dynamicreconfigure: expected a configuration of type %v but %T", s.config.Type(), config)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	v = s.copy(v)
+	s.clamp(v)
+	s.update(v)
+	return nil
+}
+
+func (s *defaultServer) Description() *Description {
+	return s.description
+}
+
+func (s *defaultServer) Shutdown() {
+	s.service.Shutdown()
+	s.descriptions.Shutdown()
+	s.updates.Shutdown()
+}
+
+func (s *defaultServer) copy(config reflect.Value) reflect.Value {
+	c := reflect.New(config.Type().Elem())
+	c.Elem().Set(config.Elem())
+	return c
+}
+
+func (s *defaultServer) values(config reflect.Value) Config {
+	values := Config{}
+	for _, p := range s.params {
+		values[p.Name] = get(config, p)
+	}
+	return values
+}
+
+func (s *defaultServer) clamp(config reflect.Value) {
+	for _, p := range s.params {
+		switch value := get(config, p).(type) {
+		case int:
+			if min := p.Min.(int); value < min {
+				set(config, p, min)
+			} else if max := p.Max.(int); value > max {
+				set(config, p, max)
+			}
+		case float64:
+			if min := p.Min.(float64); value < min {
+				set(config, p, min)
+			} else if max := p.Max.(float64); value > max {
+				set(config, p, max)
+			}
+		}
+	}
+}
+
+func get(config reflect.Value, p param) interface{} {
+	field := config.Elem().FieldByIndex(p.index)
+	switch p.Type {
+	case TypeBool:
+		return field.Bool()
+	case TypeInt:
+		return int(field.Int())
+	case TypeStr:
+		return field.String()
+	}
+	return field.Float()
+}
+
+func set(config reflect.Value, p param, value interface{}) {
+	field := config.Elem().FieldByIndex(p.index)
+	switch v := value.(type) {
+	case bool:
+		field.SetBool(v)
+	case int:
+		field.SetInt(int64(v))
+	case string:
+		field.SetString(v)
+	case float64:
+		field.SetFloat(v)
+	}
+}
+
+// describe returns the description of the parameters declared by a struct.
+func describe(t reflect.Type) (*Description, []param, error) {
+	d := &describer{
+		description: &Description{Groups: []Group{{Name: "Default", State: true}}},
+		names:       map[string]bool{},
+	}
+	if err := d.walk(t, nil, 0); err != nil {
+		return nil, nil, err
+	}
+	return d.description, d.params, nil
+}
+
+type describer struct {
+	description *Description
+	params      []param
+	names       map[string]bool
+}
+
+func (d *describer) walk(t reflect.Type, index []int, group int) error {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" || f.Tag.Get("param") == "-" {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		if f.Type.Kind() == reflect.Struct {
+			g := Group{
+				Name:   f.Tag.Get("group"),
+				Type:   f.Tag.Get("type"),
+				ID:     int32(len(d.description.Groups)),
+				Parent: d.description.Groups[group].ID,
+				State:  f.Tag.Get("state") != "false",
+			}
+			if g.Name == "" {
+				g.Name = f.Name
+			}
+			d.description.Groups = append(d.description.Groups, g)
+			if err := d.walk(f.Type, fieldIndex, int(g.ID)); err != nil {
+				return err
+			}
+			continue
+		}
+		p, err := newParam(f)
+		if err != nil {
+			return err
+		}
+		if d.names[p.Name] {
+			return fmt.Errorf("dynamicreconfigure: duplicate parameter %s", p.Name)
+		}
+		d.names[p.Name] = true
+		p.index = fieldIndex
+		d.params = append(d.params, p)
+		d.description.Groups[group].Params = append(d.description.Groups[group].Params, p.ParamDescription)
+	}
+	return nil
+}
+
+func newParam(f reflect.StructField) (param, error) {
+	p := param{ParamDescription: ParamDescription{
+		Name:        f.Tag.Get("param"),
+		Description: f.Tag.Get("description"),
+	}}
+	if p.Name == "" {
+		p.Name = f.Name
+	}
+	switch f.Type.Kind() {
+	case reflect.Bool:
+		p.Type, p.Default, p.Min, p.Max = TypeBool, false, false, true
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		p.Type, p.Default, p.Min, p.Max = TypeInt, 0, math.MinInt32, math.MaxInt32
+	case reflect.String:
+		p.Type, p.Default, p.Min, p.Max = TypeStr, "", "", ""
+	case reflect.Float32, reflect.Float64:
+		p.Type, p.Default, p.Min, p.Max = TypeDouble, 0.0, math.Inf(-1), math.Inf(1)
+	default:
+		return p, fmt.Errorf("dynamicreconfigure: parameter %s has unsupported type %v", p.Name, f.Type)
+	}
+	for _, v := range []struct {
+		tag   string
+		value *interface{}
+	}{{"default", &p.Default}, {"min", &p.Min}, {"max", &p.Max}} {
+		if s, ok := f.Tag.Lookup(v.tag); ok {
+			value, err := parseValue(s, p.Type)
+			if err != nil {
+				return p, fmt.Errorf("dynamicreconfigure: %s of parameter %s: %v", v.tag, p.Name, err)
+			}
+			*v.value = value
+		}
+	}
+	if s, ok := f.Tag.Lookup("level"); ok {
+		level, err := strconv.ParseUint(s, 0, 32)
+		if err != nil {
+			return p, fmt.Errorf("dynamicreconfigure: level of parameter %s: %v", p.Name, err)
+		}
+		p.Level = uint32(level)
+	}
+	if s, ok := f.Tag.Lookup("enum"); ok {
+		var err error
+		if p.EditMethod, err = editMethod(s, p.Type, f.Tag.Get("enum_description")); err != nil {
+			return p, fmt.Errorf("dynamicreconfigure: enum of parameter %s: %v", p.Name, err)
+		}
+	}
+	return p, nil
+}
+
+func parseValue(s string, typ string) (interface{}, error) {
+	switch typ {
+	case TypeBool:
+		return strconv.ParseBool(s)
+	case TypeInt:
+		i, err := strconv.ParseInt(s, 0, 32)
+		return int(i), err
+	case TypeDouble:
+		return strconv.ParseFloat(s, 64)
+	}
+	return s, nil
+}
+
+// editMethod returns the edit method of an enum, a Python dictionary as
+// generated from .cfg files, from its "Name=value,..." tag.
+func editMethod(enum string, typ string, description string) (string, error) {
+	var constants []string
+	for _, constant := range strings.Split(enum, ",") {
+		parts := strings.SplitN(constant, "=", 2)
+		if len(parts) != 2 {
+			return "", fmt.Errorf("expected Name=value but %q", constant)
+		}
+		value, err := parseValue(strings.TrimSpace(parts[1]), typ)
+		if err != nil {
+			return "", err
+		}
+		constants = append(constants, fmt.Sprintf("{'name': %s, 'type': %s, 'value': %s, 'description': ''}",
+			pythonString(strings.TrimSpace(parts[0])), pythonString(typ), pythonValue(value)))
+	}
+	return fmt.Sprintf("{'enum': [%s], 'enum_description': %s}", strings.Join(constants, ", "), pythonString(description)), nil
+}
+
+func pythonString(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(s) + "'"
+}
+
+func pythonValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case string:
+		return pythonString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,580 @@
+// Package master implements an embedded ROS master.
+//
+// The master serves the ROS Master API (registration of publishers,
+// subscribers and services) and the Parameter Server API over XML-RPC. It is
+// meant for tests and small deployments where running roscore is not an
+// option; any ROS node, including rosgo nodes, can use it through
+// ROS_MASTER_URI.
+package master
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/xmlrpc"
+	"github.com/fetchrobotics/rosgo/yaml"
+)
+
+const (
+	apiStatusError   = -1
+	apiStatusFailure = 0
+	apiStatusSuccess = 1
+
+	callerID = "/master"
+)
+
+// DefaultNotifyTimeout bounds the calls notifying nodes so that a hung node
+// does not delay the notifications of the others.
+const DefaultNotifyTimeout = 5 * time.Second
+
+// Master defines interface for an embedded ROS master.
+type Master interface {
+	// URI returns the XML-RPC URI of the master, suitable for ROS_MASTER_URI.
+	URI() string
+
+	// LoadParams sets the parameters of a YAML document under namespace.
+	// Each key of a top-level dictionary is set individually, so existing
+	// parameters of the namespace are kept.
+	LoadParams(namespace string, data []byte) error
+
+	// DumpParams returns the parameters under namespace as a YAML document.
+	DumpParams(namespace string) ([]byte, error)
+
+	Shutdown()
+}
+
+// Option allows to customize created masters.
+type Option func(m *defaultMaster)
+
+// InitialParams loads a YAML document into the root namespace when the master
+// starts.
+func InitialParams(data []byte) Option {
+	return func(m *defaultMaster) {
+		m.initialParams = data
+	}
+}
+
+// NotifyTimeout changes how long the master waits for a node to handle a
+// notification, DefaultNotifyTimeout by default.
+func NotifyTimeout(timeout time.Duration) Option {
+	return func(m *defaultMaster) {
+		m.notifyTimeout = timeout
+	}
+}
+
+// ErrorLog sets the logger of the notifications that failed, the standard
+// logger by default.
+func ErrorLog(logger *log.Logger) Option {
+	return func(m *defaultMaster) {
+		m.errorLog = logger
+	}
+}
+
+// NewMaster starts a master listening on address, e.g. ":11311" or
+// "127.0.0.1:0" to pick a free port.
+func NewMaster(address string, opts ...Option) (Master, error) {
+	return newDefaultMaster(address, opts...)
+}
+
+// defaultMaster implements Master interface.
+type defaultMaster struct {
+	uri           string
+	listener      net.Listener
+	server        *http.Server
+	handler       *xmlrpc.Handler
+	mutex         sync.Mutex
+	nodes         map[string]string // callerID -> callerAPI
+	publishers    registrations
+	subscribers   registrations
+	services      registrations
+	topicTypes    map[string]string
+	params        *paramServer
+	notifier      *notifier
+	notifyTimeout time.Duration
+	errorLog      *log.Logger
+	initialParams []byte
+}
+
+func newDefaultMaster(address string, opts ...Option) (*defaultMaster, error) {
+	m := new(defaultMaster)
+	m.notifyTimeout = DefaultNotifyTimeout
+	m.errorLog = log.New(os.Stderr, "", log.LstdFlags)
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.nodes = make(map[string]string)
+	m.publishers = make(registrations)
+	m.subscribers = make(registrations)
+	m.services = make(registrations)
+	m.topicTypes = make(map[string]string)
+	m.params = newParamServer()
+	if m.initialParams != nil {
+		if err := m.LoadParams("/", m.initialParams); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = determineHost()
+	}
+	m.uri = fmt.Sprintf("http://%s/", net.JoinHostPort(host, port))
+	m.listener = listener
+	m.notifier = newNotifier()
+
+	methods := map[string]xmlrpc.Method{
+		"getUri": func(callerID string) (interface{}, error) { return m.getURI(callerID) },
+		"getPid": func(callerID string) (interface{}, error) { return m.getPid(callerID) },
+		"registerService": func(callerID, service, serviceAPI, callerAPI string) (interface{}, error) {
+			return m.registerService(callerID, service, serviceAPI, callerAPI)
+		},
+		"unregisterService": func(callerID, service, serviceAPI string) (interface{}, error) {
+			return m.unregisterService(callerID, service, serviceAPI)
+		},
+		"registerSubscriber": func(callerID, topic, topicType, callerAPI string) (interface{}, error) {
+			return m.registerSubscriber(callerID, topic, topicType, callerAPI)
+		},
+		"unregisterSubscriber": func(callerID, topic, callerAPI string) (interface{}, error) {
+			return m.unregisterSubscriber(callerID, topic, callerAPI)
+		},
+		"registerPublisher": func(callerID, topic, topicType, callerAPI string) (interface{}, error) {
+			return m.registerPublisher(callerID, topic, topicType, callerAPI)
+		},
+		"unregisterPublisher": func(callerID, topic, callerAPI string) (interface{}, error) {
+			return m.unregisterPublisher(callerID, topic, callerAPI)
+		},
+		"lookupNode": func(callerID, nodeName string) (interface{}, error) {
+			return m.lookupNode(callerID, nodeName)
+		},
+		"getPublishedTopics": func(callerID, subgraph string) (interface{}, error) {
+			return m.getPublishedTopics(callerID, subgraph)
+		},
+		"getTopicTypes":  func(callerID string) (interface{}, error) { return m.getTopicTypes(callerID) },
+		"getSystemState": func(callerID string) (interface{}, error) { return m.getSystemState(callerID) },
+		"lookupService": func(callerID, service string) (interface{}, error) {
+			return m.lookupService(callerID, service)
+		},
+		"deleteParam": func(callerID, key string) (interface{}, error) { return m.deleteParam(callerID, key) },
+		"setParam": func(callerID, key string, value interface{}) (interface{}, error) {
+			return m.setParam(callerID, key, value)
+		},
+		"getParam":    func(callerID, key string) (interface{}, error) { return m.getParam(callerID, key) },
+		"searchParam": func(callerID, key string) (interface{}, error) { return m.searchParam(callerID, key) },
+		"subscribeParam": func(callerID, callerAPI, key string) (interface{}, error) {
+			return m.subscribeParam(callerID, callerAPI, key)
+		},
+		"unsubscribeParam": func(callerID, callerAPI, key string) (interface{}, error) {
+			return m.unsubscribeParam(callerID, callerAPI, key)
+		},
+		"hasParam":      func(callerID, key string) (interface{}, error) { return m.hasParam(callerID, key) },
+		"getParamNames": func(callerID string) (interface{}, error) { return m.getParamNames(callerID) },
+	}
+	m.handler = xmlrpc.NewHandler(methods)
+	m.server = &http.Server{Handler: m.handler}
+	go m.server.Serve(m.listener)
+	return m, nil
+}
+
+func determineHost() string {
+	if host := os.Getenv("ROS_HOSTNAME"); len(host) > 0 {
+		return host
+	}
+	if ip := os.Getenv("ROS_IP"); len(ip) > 0 {
+		return ip
+	}
+	if host, err := os.Hostname(); err == nil && len(host) > 0 {
+		return host
+	}
+	return "localhost"
+}
+
+func buildResult(code int32, message string, value interface{}) interface{} {
+	return []interface{}{code, message, value}
+}
+
+func (m *defaultMaster) URI() string {
+	return m.uri
+}
+
+func (m *defaultMaster) Shutdown() {
+	// Closing the connections too makes clients notice the shutdown like
+	// the exit of a master process.
+	m.server.Close()
+	m.handler.WaitForShutdown()
+	m.notifier.shutdown()
+}
+
+func (m *defaultMaster) LoadParams(namespace string, data []byte) error {
+	value, err := yaml.Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	ns := resolveName("/", namespace)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var updates []paramUpdate
+	if d, ok := value.(map[string]interface{}); ok {
+		for k, v := range d {
+			u, err := m.params.set(joinName(ns, k), v)
+			if err != nil {
+				return err
+			}
+			updates = append(updates, u...)
+		}
+	} else {
+		if updates, err = m.params.set(ns, value); err != nil {
+			return err
+		}
+	}
+	m.notifyParamUpdates(updates)
+	return nil
+}
+
+func (m *defaultMaster) DumpParams(namespace string) ([]byte, error) {
+	m.mutex.Lock()
+	value, ok := m.params.get(resolveName("/", namespace))
+	m.mutex.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("parameter [%s] is not set", namespace)
+	}
+	return yaml.Marshal(value)
+}
+
+// registerNode records the API of a node. If another node was registered with
+// the same name, it is asked to shut down and its registrations are dropped.
+// Must be called with the mutex held.
+func (m *defaultMaster) registerNode(callerID, callerAPI string) {
+	if api, ok := m.nodes[callerID]; ok && api != callerAPI {
+		m.notify(api, "shutdown", callerID, "new node registered with same name")
+		m.dropNode(callerID)
+	}
+	m.nodes[callerID] = callerAPI
+}
+
+// dropNode removes every registration of the node. Must be called with the
+// mutex held.
+func (m *defaultMaster) dropNode(nodeID string) {
+	for _, topic := range m.publishers.dropNode(nodeID) {
+		m.notifyPublisherUpdate(topic)
+	}
+	m.subscribers.dropNode(nodeID)
+	m.services.dropNode(nodeID)
+	m.params.dropNode(nodeID)
+	delete(m.nodes, nodeID)
+}
+
+// forgetNodeIfIdle drops the node entry once it has no registration left.
+// Must be called with the mutex held.
+func (m *defaultMaster) forgetNodeIfIdle(nodeID string) {
+	if m.publishers.has(nodeID) || m.subscribers.has(nodeID) || m.services.has(nodeID) {
+		return
+	}
+	for _, subs := range m.params.subscribers {
+		if _, ok := subs[nodeID]; ok {
+			return
+		}
+	}
+	delete(m.nodes, nodeID)
+}
+
+// notifyPublisherUpdate sends the current publisher list of topic to its
+// subscribers. Must be called with the mutex held.
+func (m *defaultMaster) notifyPublisherUpdate(topic string) {
+	publishers := m.publishers.apis(topic)
+	for _, api := range m.subscribers.apis(topic) {
+		m.notify(api, "publisherUpdate", callerID, topic, publishers)
+	}
+}
+
+func (m *defaultMaster) notifyParamUpdates(updates []paramUpdate) {
+	for _, u := range updates {
+		m.notify(u.callerAPI, "paramUpdate", callerID, u.key, u.value)
+	}
+}
+
+// notify calls method on the API of a node from the notifier. Failures are
+// only logged since the node may be gone.
+func (m *defaultMaster) notify(api, method string, args ...interface{}) {
+	m.notifier.push(func() {
+		if _, err := xmlrpc.CallTimeout(api, m.notifyTimeout, method, args...); err != nil {
+			m.errorLog.Printf("Failed to call %s on %s: %v", method, api, err)
+		}
+	})
+}
+
+func (m *defaultMaster) getURI(callerID string) (interface{}, error) {
+	return buildResult(apiStatusSuccess, "", m.uri), nil
+}
+
+func (m *defaultMaster) getPid(callerID string) (interface{}, error) {
+	return buildResult(apiStatusSuccess, "", os.Getpid()), nil
+}
+
+func (m *defaultMaster) registerService(callerID, service, serviceAPI, callerAPI string) (interface{}, error) {
+	service = resolveName(callerID, service)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.registerNode(callerID, callerAPI)
+	m.services.register(service, nodeRef{callerID, serviceAPI})
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Registered [%s] as provider of [%s]", callerID, service), 1), nil
+}
+
+func (m *defaultMaster) unregisterService(callerID, service, serviceAPI string) (interface{}, error) {
+	service = resolveName(callerID, service)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.services.unregister(service, callerID, serviceAPI) {
+		return buildResult(apiStatusSuccess, fmt.Sprintf("[%s] is not a provider of [%s]", callerID, service), 0), nil
+	}
+	m.forgetNodeIfIdle(callerID)
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Unregistered [%s] as provider of [%s]", callerID, service), 1), nil
+}
+
+func (m *defaultMaster) registerSubscriber(callerID, topic, topicType, callerAPI string) (interface{}, error) {
+	topic = resolveName(callerID, topic)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.registerNode(callerID, callerAPI)
+	m.subscribers.register(topic, nodeRef{callerID, callerAPI})
+	if _, ok := m.topicTypes[topic]; !ok && topicType != "*" {
+		m.topicTypes[topic] = topicType
+	}
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Subscribed to [%s]", topic), m.publishers.apis(topic)), nil
+}
+
+func (m *defaultMaster) unregisterSubscriber(callerID, topic, callerAPI string) (interface{}, error) {
+	topic = resolveName(callerID, topic)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.subscribers.unregister(topic, callerID, callerAPI) {
+		return buildResult(apiStatusSuccess, fmt.Sprintf("[%s] is not a subscriber of [%s]", callerID, topic), 0), nil
+	}
+	m.forgetNodeIfIdle(callerID)
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Unregistered [%s] as subscriber of [%s]", callerID, topic), 1), nil
+}
+
+func (m *defaultMaster) registerPublisher(callerID, topic, topicType, callerAPI string) (interface{}, error) {
+	topic = resolveName(callerID, topic)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.registerNode(callerID, callerAPI)
+	m.publishers.register(topic, nodeRef{callerID, callerAPI})
+	if topicType != "*" {
+		m.topicTypes[topic] = topicType
+	}
+	m.notifyPublisherUpdate(topic)
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Registered [%s] as publisher of [%s]", callerID, topic), m.subscribers.apis(topic)), nil
+}
+
+func (m *defaultMaster) unregisterPublisher(callerID, topic, callerAPI string) (interface{}, error) {
+	topic = resolveName(callerID, topic)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if !m.publishers.unregister(topic, callerID, callerAPI) {
+		return buildResult(apiStatusSuccess, fmt.Sprintf("[%s] is not a publisher of [%s]", callerID, topic), 0), nil
+	}
+	m.notifyPublisherUpdate(topic)
+	m.forgetNodeIfIdle(callerID)
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Unregistered [%s] as publisher of [%s]", callerID, topic), 1), nil
+}
+
+func (m *defaultMaster) lookupNode(callerID, nodeName string) (interface{}, error) {
+	nodeName = resolveName(callerID, nodeName)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if api, ok := m.nodes[nodeName]; ok {
+		return buildResult(apiStatusSuccess, fmt.Sprintf("node api [%s]", api), api), nil
+	}
+	return buildResult(apiStatusError, fmt.Sprintf("unknown node [%s]", nodeName), ""), nil
+}
+
+func (m *defaultMaster) getPublishedTopics(callerID, subgraph string) (interface{}, error) {
+	if len(subgraph) > 0 {
+		subgraph = resolveName(callerID, subgraph)
+	} else {
+		subgraph = "/"
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	result := []interface{}{}
+	for _, entry := range m.publishers.state() {
+		topic := entry.([]interface{})[0].(string)
+		if isInNamespace(topic, subgraph) {
+			result = append(result, []interface{}{topic, m.topicTypes[topic]})
+		}
+	}
+	return buildResult(apiStatusSuccess, "current topics", result), nil
+}
+
+func (m *defaultMaster) getTopicTypes(callerID string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	result := []interface{}{}
+	for topic, topicType := range m.topicTypes {
+		result = append(result, []interface{}{topic, topicType})
+	}
+	return buildResult(apiStatusSuccess, "current system state", result), nil
+}
+
+func (m *defaultMaster) getSystemState(callerID string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	state := []interface{}{m.publishers.state(), m.subscribers.state(), m.services.state()}
+	return buildResult(apiStatusSuccess, "current system state", state), nil
+}
+
+func (m *defaultMaster) lookupService(callerID, service string) (interface{}, error) {
+	service = resolveName(callerID, service)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if refs, ok := m.services[service]; ok && len(refs) > 0 {
+		api := refs[len(refs)-1].callerAPI
+		return buildResult(apiStatusSuccess, fmt.Sprintf("rosrpc URI: [%s]", api), api), nil
+	}
+	return buildResult(apiStatusError, fmt.Sprintf("no provider for [%s]", service), ""), nil
+}
+
+func (m *defaultMaster) deleteParam(callerID, key string) (interface{}, error) {
+	key = resolveName(callerID, key)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	updates, err := m.params.delete(key)
+	if err != nil {
+		return buildResult(apiStatusError, err.Error(), 0), nil
+	}
+	m.notifyParamUpdates(updates)
+	return buildResult(apiStatusSuccess, fmt.Sprintf("parameter %s deleted", key), 0), nil
+}
+
+func (m *defaultMaster) setParam(callerID, key string, value interface{}) (interface{}, error) {
+	key = resolveName(callerID, key)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	updates, err := m.params.set(key, value)
+	if err != nil {
+		return buildResult(apiStatusError, err.Error(), 0), nil
+	}
+	m.notifyParamUpdates(updates)
+	return buildResult(apiStatusSuccess, fmt.Sprintf("parameter %s set", key), 0), nil
+}
+
+func (m *defaultMaster) getParam(callerID, key string) (interface{}, error) {
+	key = resolveName(callerID, key)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	value, ok := m.params.get(key)
+	if !ok {
+		return buildResult(apiStatusError, fmt.Sprintf("Parameter [%s] is not set", key), 0), nil
+	}
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Parameter [%s]", key), value), nil
+}
+
+func (m *defaultMaster) searchParam(callerID, key string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	found, ok := m.params.search(joinName("/", callerID), key)
+	if !ok {
+		return buildResult(apiStatusError, fmt.Sprintf("Cannot find parameter [%s] in an upwards search", key), ""), nil
+	}
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Found [%s]", found), found), nil
+}
+
+func (m *defaultMaster) subscribeParam(callerID, callerAPI, key string) (interface{}, error) {
+	key = resolveName(callerID, key)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.registerNode(callerID, callerAPI)
+	value := m.params.subscribe(callerID, callerAPI, key)
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Subscribed to parameter [%s]", key), value), nil
+}
+
+func (m *defaultMaster) unsubscribeParam(callerID, callerAPI, key string) (interface{}, error) {
+	key = resolveName(callerID, key)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	n := m.params.unsubscribe(callerID, callerAPI, key)
+	m.forgetNodeIfIdle(callerID)
+	return buildResult(apiStatusSuccess, fmt.Sprintf("Unsubscribe to parameter [%s]", key), n), nil
+}
+
+func (m *defaultMaster) hasParam(callerID, key string) (interface{}, error) {
+	key = resolveName(callerID, key)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return buildResult(apiStatusSuccess, key, m.params.has(key)), nil
+}
+
+func (m *defaultMaster) getParamNames(callerID string) (interface{}, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	names := []interface{}{}
+	for _, name := range m.params.names() {
+		names = append(names, name)
+	}
+	return buildResult(apiStatusSuccess, "Parameter names", names), nil
+}
+
+// notifier delivers callbacks to nodes in order, off the request goroutines.
+type notifier struct {
+	mutex sync.Mutex
+	cond  *sync.Cond
+	queue []func()
+	done  bool
+	wait  sync.WaitGroup
+}
+
+func newNotifier() *notifier {
+	n := new(notifier)
+	n.cond = sync.NewCond(&n.mutex)
+	n.wait.Add(1)
+	go n.run()
+	return n
+}
+
+func (n *notifier) push(job func()) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if !n.done {
+		n.queue = append(n.queue, job)
+		n.cond.Signal()
+	}
+}
+
+func (n *notifier) run() {
+	defer n.wait.Done()
+	for {
+		n.mutex.Lock()
+		for len(n.queue) == 0 && !n.done {
+			n.cond.Wait()
+		}
+		if n.done {
+			n.mutex.Unlock()
+			return
+		}
+		job := n.queue[0]
+		n.queue = n.queue[1:]
+		n.mutex.Unlock()
+		job()
+	}
+}
+
+func (n *notifier) shutdown() {
+	n.mutex.Lock()
+	n.done = true
+	n.cond.Signal()
+	n.mutex.Unlock()
+	n.wait.Wait()
+}
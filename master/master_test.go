@@ -0,0 +1,243 @@
+package master
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/xmlrpc"
+)
+
+type fakeSlave struct {
+	uri      string
+	listener net.Listener
+	handler  *xmlrpc.Handler
+	updates  chan []interface{}
+}
+
+func newFakeSlave(t *testing.T) *fakeSlave {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSlave{
+		uri:      fmt.Sprintf("http://%s/", listener.Addr().String()),
+		listener: listener,
+		updates:  make(chan []interface{}, 10),
+	}
+	s.handler = xmlrpc.NewHandler(map[string]xmlrpc.Method{
+		"publisherUpdate": func(callerID string, topic string, publishers []interface{}) (interface{}, error) {
+			s.updates <- []interface{}{"publisherUpdate", topic, publishers}
+			return buildResult(apiStatusSuccess, "", 0), nil
+		},
+		"paramUpdate": func(callerID string, key string, value interface{}) (interface{}, error) {
+			s.updates <- []interface{}{"paramUpdate", key, value}
+			return buildResult(apiStatusSuccess, "", 0), nil
+		},
+	})
+	go http.Serve(listener, s.handler)
+	return s
+}
+
+func (s *fakeSlave) close() {
+	s.listener.Close()
+	s.handler.WaitForShutdown()
+}
+
+func (s *fakeSlave) expect(t *testing.T, expected ...interface{}) {
+	select {
+	case update := <-s.updates:
+		if !reflect.DeepEqual(update, expected) {
+			t.Errorf("expected %v but %v", expected, update)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("%v not received", expected)
+	}
+}
+
+func call(t *testing.T, m Master, method string, args ...interface{}) interface{} {
+	result, err := xmlrpc.Call(m.URI(), method, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	xs := result.([]interface{})
+	if xs[0].(int32) != apiStatusSuccess {
+		t.Fatalf("%s failed: %v", method, xs[1])
+	}
+	return xs[2]
+}
+
+func TestRegistration(t *testing.T) {
+	m, err := NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	sub := newFakeSlave(t)
+	defer sub.close()
+	pub := newFakeSlave(t)
+	defer pub.close()
+
+	publishers := call(t, m, "registerSubscriber", "/ns/listener", "chatter", "std_msgs/String", sub.uri)
+	if len(publishers.([]interface{})) != 0 {
+		t.Errorf("unexpected publishers %v", publishers)
+	}
+	subscribers := call(t, m, "registerPublisher", "/talker", "/ns/chatter", "std_msgs/String", pub.uri)
+	if !reflect.DeepEqual(subscribers, []interface{}{sub.uri}) {
+		t.Errorf("unexpected subscribers %v", subscribers)
+	}
+	sub.expect(t, "publisherUpdate", "/ns/chatter", []interface{}{pub.uri})
+
+	call(t, m, "registerService", "/talker", "/talker/get_loggers", "rosrpc://localhost:1234", pub.uri)
+	if uri := call(t, m, "lookupService", "/other", "/talker/get_loggers"); uri != "rosrpc://localhost:1234" {
+		t.Errorf("unexpected service URI %v", uri)
+	}
+	if uri := call(t, m, "lookupNode", "/other", "/talker"); uri != pub.uri {
+		t.Errorf("unexpected node URI %v", uri)
+	}
+
+	state := call(t, m, "getSystemState", "/other")
+	expected := []interface{}{
+		[]interface{}{[]interface{}{"/ns/chatter", []interface{}{"/talker"}}},
+		[]interface{}{[]interface{}{"/ns/chatter", []interface{}{"/ns/listener"}}},
+		[]interface{}{[]interface{}{"/talker/get_loggers", []interface{}{"/talker"}}},
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Errorf("expected %v but %v", expected, state)
+	}
+	topics := call(t, m, "getPublishedTopics", "/other", "/ns")
+	if !reflect.DeepEqual(topics, []interface{}{[]interface{}{"/ns/chatter", "std_msgs/String"}}) {
+		t.Errorf("unexpected topics %v", topics)
+	}
+
+	if n := call(t, m, "unregisterPublisher", "/talker", "/ns/chatter", pub.uri); n != int32(1) {
+		t.Errorf("unregisterPublisher returned %v", n)
+	}
+	sub.expect(t, "publisherUpdate", "/ns/chatter", []interface{}(nil))
+	if n := call(t, m, "unregisterPublisher", "/talker", "/ns/chatter", pub.uri); n != int32(0) {
+		t.Errorf("unregisterPublisher returned %v", n)
+	}
+	call(t, m, "unregisterService", "/talker", "/talker/get_loggers", "rosrpc://localhost:1234")
+	if _, err := xmlrpc.Call(m.URI(), "lookupNode", "/other", "/talker"); err != nil {
+		t.Error(err)
+	}
+	if result, _ := xmlrpc.Call(m.URI(), "lookupNode", "/other", "/talker"); result.([]interface{})[0] != int32(apiStatusError) {
+		t.Errorf("node without registrations still known: %v", result)
+	}
+}
+
+// syncBuffer is a buffer safe for concurrent logging and reading.
+type syncBuffer struct {
+	sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buffer.String()
+}
+
+func TestHungSubscriber(t *testing.T) {
+	var logs syncBuffer
+	m, err := NewMaster("127.0.0.1:0", NotifyTimeout(100*time.Millisecond), ErrorLog(log.New(&logs, "", 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	// The API of the first subscriber accepts calls but never answers.
+	unblock := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer hung.Close()
+	defer close(unblock)
+	sub := newFakeSlave(t)
+	defer sub.close()
+	pub := newFakeSlave(t)
+	defer pub.close()
+
+	call(t, m, "registerSubscriber", "/hung", "/chatter", "std_msgs/String", hung.URL)
+	call(t, m, "registerSubscriber", "/listener", "/chatter", "std_msgs/String", sub.uri)
+	call(t, m, "registerPublisher", "/talker", "/chatter", "std_msgs/String", pub.uri)
+	sub.expect(t, "publisherUpdate", "/chatter", []interface{}{pub.uri})
+	call(t, m, "unregisterPublisher", "/talker", "/chatter", pub.uri)
+	sub.expect(t, "publisherUpdate", "/chatter", []interface{}(nil))
+	if !strings.Contains(logs.String(), "publisherUpdate on "+hung.URL) {
+		t.Errorf("the failed notification was not logged: %q", logs.String())
+	}
+}
+
+func TestParams(t *testing.T) {
+	m, err := NewMaster("127.0.0.1:0", InitialParams([]byte("rosdistro: noetic\nrobot:\n  name: fetch\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	node := newFakeSlave(t)
+	defer node.close()
+
+	if v := call(t, m, "getParam", "/node", "rosdistro"); v != "noetic" {
+		t.Errorf("unexpected value %v", v)
+	}
+	if v := call(t, m, "subscribeParam", "/robot/node", node.uri, "~gain"); !reflect.DeepEqual(v, map[string]interface{}{}) {
+		t.Errorf("unexpected value %v", v)
+	}
+	call(t, m, "setParam", "/robot/node", "~gain", 1.5)
+	node.expect(t, "paramUpdate", "/robot/node/gain/", 1.5)
+
+	if v := call(t, m, "searchParam", "/robot/node", "name"); v != "/robot/name" {
+		t.Errorf("unexpected search result %v", v)
+	}
+	if v := call(t, m, "hasParam", "/node", "/robot/node/gain"); v != true {
+		t.Errorf("unexpected hasParam result %v", v)
+	}
+	names := call(t, m, "getParamNames", "/node")
+	if !reflect.DeepEqual(names, []interface{}{"/robot/name", "/robot/node/gain", "/rosdistro"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	if err := m.LoadParams("/robot/node", []byte("gain: 2.5\nlimits: [1, 2]\n")); err != nil {
+		t.Fatal(err)
+	}
+	node.expect(t, "paramUpdate", "/robot/node/gain/", 2.5)
+	data, err := m.DumpParams("/robot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"name: fetch",
+		"node:",
+		"  gain: 2.5",
+		"  limits:",
+		"  - 1",
+		"  - 2",
+		"",
+	}, "\n")
+	if string(data) != expected {
+		t.Errorf("expected\n%s\nbut\n%s", expected, data)
+	}
+
+	call(t, m, "deleteParam", "/node", "/robot/node")
+	node.expect(t, "paramUpdate", "/robot/node/gain/", map[string]interface{}{})
+	if result, _ := xmlrpc.Call(m.URI(), "getParam", "/node", "/robot/node/gain"); result.([]interface{})[0] != int32(apiStatusError) {
+		t.Errorf("deleted parameter still set: %v", result)
+	}
+}
@@ -0,0 +1,47 @@
+package master
+
+import (
+	"strings"
+)
+
+// canonicalizeName removes duplicated and trailing separators.
+func canonicalizeName(name string) string {
+	if len(name) == 0 || name == "/" {
+		return name
+	}
+	components := splitKey(name)
+	if name[0] == '/' {
+		return "/" + strings.Join(components, "/")
+	}
+	return strings.Join(components, "/")
+}
+
+func joinName(ns string, name string) string {
+	if len(name) > 0 && name[0] == '/' {
+		return canonicalizeName(name)
+	}
+	return canonicalizeName(ns + "/" + name)
+}
+
+// namespaceOf returns the namespace containing the node callerID.
+func namespaceOf(callerID string) string {
+	name := canonicalizeName(callerID)
+	i := strings.LastIndex(name, "/")
+	if i <= 0 {
+		return "/"
+	}
+	return name[:i]
+}
+
+// resolveName resolves a name passed by the node callerID to a global name.
+func resolveName(callerID string, name string) string {
+	switch {
+	case len(name) == 0:
+		return namespaceOf(callerID)
+	case name[0] == '/':
+		return canonicalizeName(name)
+	case name[0] == '~':
+		return joinName(joinName("/", callerID), name[1:])
+	}
+	return joinName(namespaceOf(callerID), name)
+}
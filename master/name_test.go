@@ -0,0 +1,25 @@
+package master
+
+import (
+	"testing"
+)
+
+func TestResolveName(t *testing.T) {
+	for _, tc := range []struct {
+		callerID string
+		name     string
+		want     string
+	}{
+		{"/node", "foo", "/foo"},
+		{"/ns/node", "foo", "/ns/foo"},
+		{"/ns/node", "foo/bar/", "/ns/foo/bar"},
+		{"/ns/node", "/foo", "/foo"},
+		{"/ns/node", "~foo", "/ns/node/foo"},
+		{"/ns/node", "", "/ns"},
+		{"/node", "//foo//bar", "/foo/bar"},
+	} {
+		if got := resolveName(tc.callerID, tc.name); got != tc.want {
+			t.Errorf("resolveName(%q, %q): expected %q but %q", tc.callerID, tc.name, tc.want, got)
+		}
+	}
+}
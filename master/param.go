@@ -0,0 +1,259 @@
+package master
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// paramServer holds the parameter tree. Namespaces are represented by
+// map[string]interface{} values, exactly like dictionaries in rosmaster.
+type paramServer struct {
+	params      map[string]interface{}
+	subscribers map[string]map[string]string // key -> callerID -> callerAPI
+}
+
+// paramUpdate is a notification to be sent to a node subscribing a key.
+type paramUpdate struct {
+	callerID  string
+	callerAPI string
+	key       string
+	value     interface{}
+}
+
+func newParamServer() *paramServer {
+	return &paramServer{
+		params:      make(map[string]interface{}),
+		subscribers: make(map[string]map[string]string),
+	}
+}
+
+// splitKey returns the namespaces of a canonical global name.
+func splitKey(key string) []string {
+	var result []string
+	for _, c := range strings.Split(key, "/") {
+		if len(c) > 0 {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// copyValue returns a deep copy of namespace dictionaries so that callers
+// cannot modify the tree.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []interface{}:
+		l := make([]interface{}, len(v))
+		for i, e := range v {
+			l[i] = copyValue(e)
+		}
+		return l
+	}
+	return value
+}
+
+func (ps *paramServer) get(key string) (interface{}, bool) {
+	var value interface{} = ps.params
+	for _, ns := range splitKey(key) {
+		d, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = d[ns]; !ok {
+			return nil, false
+		}
+	}
+	return copyValue(value), true
+}
+
+func (ps *paramServer) has(key string) bool {
+	_, ok := ps.get(key)
+	return ok
+}
+
+// set stores value at key. Intermediate namespaces are created as needed and
+// replace any non-namespace value in the way. Setting a dictionary replaces the
+// whole subtree.
+func (ps *paramServer) set(key string, value interface{}) ([]paramUpdate, error) {
+	value = copyValue(value)
+	namespaces := splitKey(key)
+	if len(namespaces) == 0 {
+		d, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot set root of parameter tree to non-dictionary")
+		}
+		ps.params = d
+	} else {
+		d := ps.params
+		for _, ns := range namespaces[:len(namespaces)-1] {
+			child, ok := d[ns].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				d[ns] = child
+			}
+			d = child
+		}
+		d[namespaces[len(namespaces)-1]] = value
+	}
+	return ps.computeUpdates(key, value), nil
+}
+
+func (ps *paramServer) delete(key string) ([]paramUpdate, error) {
+	namespaces := splitKey(key)
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("cannot delete root of parameter tree")
+	}
+	d := ps.params
+	for _, ns := range namespaces[:len(namespaces)-1] {
+		child, ok := d[ns].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("parameter [%s] is not set", key)
+		}
+		d = child
+	}
+	last := namespaces[len(namespaces)-1]
+	if _, ok := d[last]; !ok {
+		return nil, fmt.Errorf("parameter [%s] is not set", key)
+	}
+	delete(d, last)
+	return ps.computeUpdates(key, map[string]interface{}{}), nil
+}
+
+// search looks for key starting in the namespace ns and proceeding upwards.
+// Only the first namespace of key needs to exist for a match.
+func (ps *paramServer) search(ns string, key string) (string, bool) {
+	if len(key) == 0 || key[0] == '/' {
+		return "", false
+	}
+	keyNamespaces := splitKey(key)
+	if len(keyNamespaces) == 0 {
+		return "", false
+	}
+	namespaces := splitKey(ns)
+	for i := len(namespaces); i >= 0; i-- {
+		base := "/" + strings.Join(namespaces[:i], "/")
+		if ps.has(joinName(base, keyNamespaces[0])) {
+			return joinName(base, strings.Join(keyNamespaces, "/")), true
+		}
+	}
+	return "", false
+}
+
+func (ps *paramServer) names() []string {
+	var result []string
+	var walk func(prefix string, d map[string]interface{})
+	walk = func(prefix string, d map[string]interface{}) {
+		for k, v := range d {
+			name := joinName(prefix, k)
+			if child, ok := v.(map[string]interface{}); ok {
+				walk(name, child)
+			} else {
+				result = append(result, name)
+			}
+		}
+	}
+	walk("/", ps.params)
+	sort.Strings(result)
+	return result
+}
+
+func (ps *paramServer) subscribe(callerID, callerAPI, key string) interface{} {
+	subs, ok := ps.subscribers[key]
+	if !ok {
+		subs = make(map[string]string)
+		ps.subscribers[key] = subs
+	}
+	subs[callerID] = callerAPI
+	if value, ok := ps.get(key); ok {
+		return value
+	}
+	return map[string]interface{}{}
+}
+
+func (ps *paramServer) unsubscribe(callerID, callerAPI, key string) int {
+	subs, ok := ps.subscribers[key]
+	if !ok || subs[callerID] != callerAPI {
+		return 0
+	}
+	delete(subs, callerID)
+	if len(subs) == 0 {
+		delete(ps.subscribers, key)
+	}
+	return 1
+}
+
+// dropNode removes every subscription of a node.
+func (ps *paramServer) dropNode(callerID string) {
+	for key, subs := range ps.subscribers {
+		delete(subs, callerID)
+		if len(subs) == 0 {
+			delete(ps.subscribers, key)
+		}
+	}
+}
+
+// computeUpdates determines which subscribers are affected by a change of key
+// to value. A subscriber of an enclosing namespace receives the changed key,
+// a subscriber of a key inside the changed subtree receives its new value or
+// an empty dictionary when the key no longer exists.
+func (ps *paramServer) computeUpdates(key string, value interface{}) []paramUpdate {
+	var updates []paramUpdate
+	keys := make([]string, 0, len(ps.subscribers))
+	for k := range ps.subscribers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, subKey := range keys {
+		var updateKey string
+		var updateValue interface{}
+		if subKey != key && isInNamespace(key, subKey) {
+			updateKey, updateValue = key, value
+		} else if isInNamespace(subKey, key) {
+			updateKey = subKey
+			updateValue = map[string]interface{}{}
+			if v, ok := ps.get(subKey); ok {
+				updateValue = v
+			}
+		} else {
+			continue
+		}
+		callerIDs := make([]string, 0, len(ps.subscribers[subKey]))
+		for callerID := range ps.subscribers[subKey] {
+			callerIDs = append(callerIDs, callerID)
+		}
+		sort.Strings(callerIDs)
+		for _, callerID := range callerIDs {
+			updates = append(updates, paramUpdate{
+				callerID:  callerID,
+				callerAPI: ps.subscribers[subKey][callerID],
+				key:       withTrailingSep(updateKey),
+				value:     copyValue(updateValue),
+			})
+		}
+	}
+	return updates
+}
+
+// isInNamespace reports whether name equals ns or lives below it.
+func isInNamespace(name, ns string) bool {
+	if ns == "/" || name == ns {
+		return true
+	}
+	return strings.HasPrefix(name, ns+"/")
+}
+
+// withTrailingSep formats keys of paramUpdate notifications the way rosmaster
+// does.
+func withTrailingSep(key string) string {
+	if strings.HasSuffix(key, "/") {
+		return key
+	}
+	return key + "/"
+}
@@ -0,0 +1,138 @@
+package master
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParamSetGet(t *testing.T) {
+	ps := newParamServer()
+	if _, err := ps.set("/a/b/c", int32(1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ps.set("/a/d", "x"); err != nil {
+		t.Fatal(err)
+	}
+
+	value, ok := ps.get("/a")
+	if !ok {
+		t.Fatal("/a is not set")
+	}
+	expected := map[string]interface{}{
+		"b": map[string]interface{}{"c": int32(1)},
+		"d": "x",
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("expected %v but %v", expected, value)
+	}
+
+	// Values returned are copies.
+	value.(map[string]interface{})["d"] = "y"
+	if v, _ := ps.get("/a/d"); v != "x" {
+		t.Errorf("parameter tree modified through returned value: %v", v)
+	}
+
+	// A scalar in the way of a namespace is replaced.
+	if _, err := ps.set("/a/d/e", 2.0); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := ps.get("/a/d/e"); !ok || v != 2.0 {
+		t.Errorf("expected 2.0 but %v", v)
+	}
+
+	// Setting a dictionary replaces the subtree.
+	if _, err := ps.set("/a", map[string]interface{}{"z": true}); err != nil {
+		t.Fatal(err)
+	}
+	if ps.has("/a/b/c") {
+		t.Error("/a/b/c should have been replaced")
+	}
+	if names := ps.names(); !reflect.DeepEqual(names, []string{"/a/z"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	if _, err := ps.set("/", 1); err == nil {
+		t.Error("root set to a scalar")
+	}
+	if _, err := ps.delete("/"); err == nil {
+		t.Error("root deleted")
+	}
+	if _, err := ps.delete("/a/missing"); err == nil {
+		t.Error("deleting a missing parameter should fail")
+	}
+	if _, err := ps.delete("/a/z"); err != nil {
+		t.Error(err)
+	}
+	if ps.has("/a/z") {
+		t.Error("/a/z not deleted")
+	}
+}
+
+func TestParamSearch(t *testing.T) {
+	ps := newParamServer()
+	ps.set("/robot/arm/speed", 1)
+	ps.set("/speed", 2)
+	ps.set("/robot/gains/p", 3)
+
+	for _, tc := range []struct {
+		ns    string
+		key   string
+		found string
+	}{
+		{"/robot/arm/node", "speed", "/robot/arm/speed"},
+		{"/robot/node", "speed", "/speed"},
+		{"/other/node", "speed", "/speed"},
+		{"/robot/arm/node", "gains/p", "/robot/gains/p"},
+		{"/robot/arm/node", "gains/i", "/robot/gains/i"},
+		{"/robot/arm/node", "missing", ""},
+		{"/robot/arm/node", "/speed", ""},
+	} {
+		found, _ := ps.search(tc.ns, tc.key)
+		if found != tc.found {
+			t.Errorf("search(%q, %q): expected %q but %q", tc.ns, tc.key, tc.found, found)
+		}
+	}
+}
+
+func TestParamUpdates(t *testing.T) {
+	ps := newParamServer()
+	ps.set("/ns/a", 1)
+	if v := ps.subscribe("/node1", "http://node1", "/ns/a"); v != 1 {
+		t.Errorf("expected current value but %v", v)
+	}
+	if v := ps.subscribe("/node2", "http://node2", "/ns"); !reflect.DeepEqual(v, map[string]interface{}{"a": 1}) {
+		t.Errorf("expected current value but %v", v)
+	}
+	if v := ps.subscribe("/node3", "http://node3", "/missing"); !reflect.DeepEqual(v, map[string]interface{}{}) {
+		t.Errorf("expected empty dictionary but %v", v)
+	}
+
+	updates, _ := ps.set("/ns/a", 2)
+	expected := []paramUpdate{
+		{"/node2", "http://node2", "/ns/a/", 2},
+		{"/node1", "http://node1", "/ns/a/", 2},
+	}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected %v but %v", expected, updates)
+	}
+
+	updates, _ = ps.set("/ns", map[string]interface{}{"b": 3})
+	expected = []paramUpdate{
+		{"/node2", "http://node2", "/ns/", map[string]interface{}{"b": 3}},
+		{"/node1", "http://node1", "/ns/a/", map[string]interface{}{}},
+	}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("expected %v but %v", expected, updates)
+	}
+
+	if n := ps.unsubscribe("/node2", "http://other", "/ns"); n != 0 {
+		t.Error("unsubscribed with a wrong API")
+	}
+	if n := ps.unsubscribe("/node2", "http://node2", "/ns"); n != 1 {
+		t.Error("unsubscribe failed")
+	}
+	updates, _ = ps.delete("/ns/b")
+	if len(updates) != 0 {
+		t.Errorf("unexpected updates %v", updates)
+	}
+}
@@ -0,0 +1,95 @@
+package master
+
+import (
+	"sort"
+)
+
+// nodeRef identifies a registered node.
+type nodeRef struct {
+	callerID  string
+	callerAPI string
+}
+
+// registrations maps a topic or service name to its registered nodes. For
+// services, the API is the rosrpc URI of the service.
+type registrations map[string][]nodeRef
+
+func (r registrations) register(name string, ref nodeRef) {
+	for i, existing := range r[name] {
+		if existing.callerID == ref.callerID {
+			r[name][i] = ref
+			return
+		}
+	}
+	r[name] = append(r[name], ref)
+}
+
+func (r registrations) unregister(name string, callerID string, api string) bool {
+	for i, existing := range r[name] {
+		if existing.callerID == callerID && existing.callerAPI == api {
+			r[name] = append(r[name][:i], r[name][i+1:]...)
+			if len(r[name]) == 0 {
+				delete(r, name)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// dropNode removes all registrations of the node and returns the names that
+// were affected.
+func (r registrations) dropNode(callerID string) []string {
+	var names []string
+	for name, refs := range r {
+		for i, ref := range refs {
+			if ref.callerID == callerID {
+				r[name] = append(refs[:i], refs[i+1:]...)
+				if len(r[name]) == 0 {
+					delete(r, name)
+				}
+				names = append(names, name)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r registrations) has(callerID string) bool {
+	for _, refs := range r {
+		for _, ref := range refs {
+			if ref.callerID == callerID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (r registrations) apis(name string) []string {
+	result := []string{}
+	for _, ref := range r[name] {
+		result = append(result, ref.callerAPI)
+	}
+	return result
+}
+
+// state returns the [[name, [callerID...]]...] lists used by getSystemState.
+func (r registrations) state() []interface{} {
+	names := make([]string, 0, len(r))
+	for name := range r {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := []interface{}{}
+	for _, name := range names {
+		nodes := []interface{}{}
+		for _, ref := range r[name] {
+			nodes = append(nodes, ref.callerID)
+		}
+		result = append(result, []interface{}{name, nodes})
+	}
+	return result
+}
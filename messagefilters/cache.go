@@ -0,0 +1,181 @@
+package messagefilters
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// Cache keeps the latest messages of its input sorted by stamp, and passes
+// them on to its callbacks.
+type Cache interface {
+	Filter
+	// Add adds a message, dropping the oldest message when the cache is
+	// full. The input of the cache adds its messages with it.
+	Add(msg ros.Message) error
+	// Interval returns the messages stamped between start and end included.
+	Interval(start, end ros.Time) []ros.Message
+	// SurroundingInterval returns the messages of Interval and the messages
+	// just before start and just after end.
+	SurroundingInterval(start, end ros.Time) []ros.Message
+	// ElemBeforeTime returns the latest message stamped at or before t, or
+	// nil.
+	ElemBeforeTime(t ros.Time) ros.Message
+	// ElemAfterTime returns the earliest message stamped at or after t, or
+	// nil.
+	ElemAfterTime(t ros.Time) ros.Message
+	// OldestTime returns the stamp of the oldest message, or zero.
+	OldestTime() ros.Time
+	// LatestTime returns the stamp of the latest message, or zero.
+	LatestTime() ros.Time
+}
+
+// CacheOption configures a Cache.
+type CacheOption func(c *defaultCache)
+
+// CacheLogger sets the logger of the messages of the input which cannot be
+// cached, such as messages without header.
+func CacheLogger(logger ros.Logger) CacheOption {
+	return func(c *defaultCache) {
+		c.logger = logger
+	}
+}
+
+type cachedMessage struct {
+	stamp ros.Time
+	msg   ros.Message
+}
+
+type defaultCache struct {
+	signal
+	mutex    sync.Mutex
+	size     int
+	logger   ros.Logger
+	messages []cachedMessage
+}
+
+// NewCache keeps the size latest messages of input, at least one. input may
+// be nil when messages are added with Add.
+func NewCache(input Filter, size int, options ...CacheOption) Cache {
+	if size < 1 {
+		size = 1
+	}
+	c := &defaultCache{size: size}
+	for _, opt := range options {
+		opt(c)
+	}
+	if c.logger == nil {
+		c.logger = ros.NewDefaultLogger()
+	}
+	if input != nil {
+		input.RegisterCallback(func(msg ros.Message) {
+			if err := c.Add(msg); err != nil {
+				c.logger.Error(err)
+			}
+		})
+	}
+	return c
+}
+
+func (c *defaultCache) Add(msg ros.Message) error {
+	stamp, ok := Stamp(msg)
+	if !ok {
+		return fmt.Errorf("messagefilters: cached message has no header stamp")
+	}
+	c.mutex.Lock()
+	// Messages mostly arrive in order, so the search starts from the end.
+	n := len(c.messages)
+	for n > 0 && c.messages[n-1].stamp.Cmp(stamp) > 0 {
+		n--
+	}
+	c.messages = append(c.messages, cachedMessage{})
+	copy(c.messages[n+1:], c.messages[n:])
+	c.messages[n] = cachedMessage{stamp, msg}
+	if len(c.messages) > c.size {
+		c.messages = append(c.messages[:0], c.messages[len(c.messages)-c.size:]...)
+	}
+	c.mutex.Unlock()
+	c.emit(msg)
+	return nil
+}
+
+// search returns the index of the first message stamped after t, or at t
+// when inclusive.
+func (c *defaultCache) search(t ros.Time, inclusive bool) int {
+	return sort.Search(len(c.messages), func(i int) bool {
+		cmp := c.messages[i].stamp.Cmp(t)
+		return cmp > 0 || inclusive && cmp == 0
+	})
+}
+
+func (c *defaultCache) slice(from, to int) []ros.Message {
+	var result []ros.Message
+	for _, m := range c.messages[from:to] {
+		result = append(result, m.msg)
+	}
+	return result
+}
+
+func (c *defaultCache) Interval(start, end ros.Time) []ros.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	from, to := c.search(start, true), c.search(end, false)
+	if from >= to {
+		return nil
+	}
+	return c.slice(from, to)
+}
+
+func (c *defaultCache) SurroundingInterval(start, end ros.Time) []ros.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	from, to := c.search(start, false), c.search(end, true)
+	if from > 0 {
+		from--
+	}
+	if to < len(c.messages) {
+		to++
+	}
+	if from >= to {
+		return nil
+	}
+	return c.slice(from, to)
+}
+
+func (c *defaultCache) ElemBeforeTime(t ros.Time) ros.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if n := c.search(t, false); n > 0 {
+		return c.messages[n-1].msg
+	}
+	return nil
+}
+
+func (c *defaultCache) ElemAfterTime(t ros.Time) ros.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if n := c.search(t, true); n < len(c.messages) {
+		return c.messages[n].msg
+	}
+	return nil
+}
+
+func (c *defaultCache) OldestTime() ros.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.messages) == 0 {
+		return ros.Time{}
+	}
+	return c.messages[0].stamp
+}
+
+func (c *defaultCache) LatestTime() ros.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.messages) == 0 {
+		return ros.Time{}
+	}
+	return c.messages[len(c.messages)-1].stamp
+}
@@ -0,0 +1,104 @@
+// Package messagefilters synchronizes the messages of several topics by the
+// stamp of their header, like the message_filters ROS package.
+//
+// Filters pass messages to the callbacks registered to them. A Subscriber
+// passes the messages of a topic, a Cache keeps the latest of them for time
+// queries, and synchronizers call their callback with one message of each
+// input once their stamps match:
+//
+//	image := messagefilters.NewSubscriber(node, "camera/image", sensor_msgs.MsgImage)
+//	info := messagefilters.NewSubscriber(node, "camera/camera_info", sensor_msgs.MsgCameraInfo)
+//	messagefilters.NewTimeSynchronizer([]messagefilters.Filter{image, info},
+//		func(image *sensor_msgs.Image, info *sensor_msgs.CameraInfo) {
+//			...
+//		})
+package messagefilters
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// Filter passes messages to callbacks.
+type Filter interface {
+	// RegisterCallback adds a callback called with every message passed by
+	// the filter.
+	RegisterCallback(callback func(msg ros.Message))
+}
+
+// signal calls the callbacks registered to a filter.
+type signal struct {
+	mutex     sync.Mutex
+	callbacks []func(msg ros.Message)
+}
+
+func (s *signal) RegisterCallback(callback func(msg ros.Message)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.callbacks = append(s.callbacks, callback)
+}
+
+func (s *signal) emit(msg ros.Message) {
+	s.mutex.Lock()
+	callbacks := append([]func(msg ros.Message){}, s.callbacks...)
+	s.mutex.Unlock()
+	for _, callback := range callbacks {
+		callback(msg)
+	}
+}
+
+// Subscriber is the filter of the messages of a topic.
+type Subscriber interface {
+	Filter
+	ros.Subscriber
+}
+
+type defaultSubscriber struct {
+	signal
+	ros.Subscriber
+}
+
+// NewSubscriber subscribes to topic. The messages are passed from the
+// callbacks of node, while it spins.
+func NewSubscriber(node ros.Node, topic string, msgType ros.MessageType) Subscriber {
+	s := &defaultSubscriber{}
+	s.Subscriber = node.NewSubscriber(topic, msgType, func(msg ros.Message) {
+		s.emit(msg)
+	})
+	return s
+}
+
+var timeType = reflect.TypeOf(ros.Time{})
+
+// Stamp returns the stamp of the header of a message. Generated messages
+// have it in the Stamp field of their Header field, and dynamic messages in
+// the stamp field of their header field.
+func Stamp(msg ros.Message) (ros.Time, bool) {
+	if m, ok := msg.(*dynamic.Message); ok {
+		header, ok := m.Data["header"].(*dynamic.Message)
+		if !ok {
+			return ros.Time{}, false
+		}
+		stamp, ok := header.Data["stamp"].(ros.Time)
+		return stamp, ok
+	}
+	v := reflect.ValueOf(msg)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ros.Time{}, false
+	}
+	header := v.FieldByName("Header")
+	if header.Kind() != reflect.Struct {
+		return ros.Time{}, false
+	}
+	stamp := header.FieldByName("Stamp")
+	if !stamp.IsValid() || stamp.Type() != timeType {
+		return ros.Time{}, false
+	}
+	return stamp.Interface().(ros.Time), true
+}
@@ -0,0 +1,305 @@
+package messagefilters
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+type testHeader struct {
+	Seq     uint32
+	Stamp   ros.Time
+	FrameId string
+}
+
+type testStamped struct {
+	Header testHeader
+	Data   string
+}
+
+func (m *testStamped) GetType() ros.MessageType          { return nil }
+func (m *testStamped) Serialize(buf *bytes.Buffer) error { return nil }
+func (m *testStamped) Deserialize(buf *ros.Reader) error { return nil }
+
+type testUnstamped struct {
+	Data string
+}
+
+func (m *testUnstamped) GetType() ros.MessageType          { return nil }
+func (m *testUnstamped) Serialize(buf *bytes.Buffer) error { return nil }
+func (m *testUnstamped) Deserialize(buf *ros.Reader) error { return nil }
+
+func stamped(sec, nsec uint32, data string) *testStamped {
+	return &testStamped{Header: testHeader{Stamp: ros.NewTime(sec, nsec)}, Data: data}
+}
+
+// testFilter passes the messages given to it.
+type testFilter struct {
+	signal
+}
+
+func data(msgs []ros.Message) []string {
+	var result []string
+	for _, m := range msgs {
+		result = append(result, m.(*testStamped).Data)
+	}
+	return result
+}
+
+func stampedType(t *testing.T) *dynamic.MessageType {
+	ctx := dynamic.NewContext(nil)
+	if _, err := ctx.AddDefinition("std_msgs/Header", "uint32 seq\ntime stamp\nstring frame_id\n"); err != nil {
+		t.Fatal(err)
+	}
+	msgType, err := ctx.AddDefinition("test_msgs/Stamped", "Header header\nstring data\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msgType
+}
+
+func newStamped(msgType *dynamic.MessageType, stamp ros.Time, data string) *dynamic.Message {
+	msg := msgType.New()
+	msg.Data["header"].(*dynamic.Message).Data["stamp"] = stamp
+	msg.Data["data"] = data
+	return msg
+}
+
+func TestStamp(t *testing.T) {
+	if stamp, ok := Stamp(stamped(1, 2, "")); !ok || stamp != ros.NewTime(1, 2) {
+		t.Errorf("unexpected stamp %v, %v", stamp, ok)
+	}
+	if _, ok := Stamp(&testUnstamped{}); ok {
+		t.Error("expected no stamp")
+	}
+
+	msg := newStamped(stampedType(t), ros.NewTime(3, 4), "")
+	if stamp, ok := Stamp(msg); !ok || stamp != ros.NewTime(3, 4) {
+		t.Errorf("unexpected stamp of a dynamic message %v, %v", stamp, ok)
+	}
+}
+
+func TestTimeSynchronizer(t *testing.T) {
+	a, b := &testFilter{}, &testFilter{}
+	var got [][]string
+	_, err := NewTimeSynchronizer([]Filter{a, b}, func(x, y *testStamped) {
+		got = append(got, []string{x.Data, y.Data})
+	}, SyncQueueSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.emit(stamped(1, 0, "a1"))
+	a.emit(stamped(2, 0, "a2"))
+	b.emit(stamped(2, 0, "b2"))
+	b.emit(stamped(1, 0, "b1"))
+	// Only 2 incomplete sets are kept, so 3 is dropped.
+	a.emit(stamped(3, 0, "a3"))
+	a.emit(stamped(4, 0, "a4"))
+	b.emit(stamped(5, 0, "b5"))
+	b.emit(stamped(3, 0, "b3"))
+	b.emit(stamped(4, 0, "b4"))
+	want := [][]string{{"a2", "b2"}, {"a4", "b4"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but %v", want, got)
+	}
+
+	if _, err := NewTimeSynchronizer([]Filter{a, b}, func(x *testStamped) {}); err == nil {
+		t.Error("expected an error for a callback of 1 argument")
+	}
+	if _, err := NewTimeSynchronizer([]Filter{a}, func(x []ros.Message) {}); err == nil {
+		t.Error("expected an error for a single input")
+	}
+	s, _ := NewTimeSynchronizer([]Filter{a, b}, func(x []ros.Message) {})
+	if err := s.Add(0, &testUnstamped{}); err == nil {
+		t.Error("expected an error for a message without header")
+	}
+	if err := s.Add(2, stamped(1, 0, "")); err == nil {
+		t.Error("expected an error for a missing input")
+	}
+}
+
+func TestApproximateTimeSynchronizer(t *testing.T) {
+	ms := func(n uint32) *testStamped {
+		return stamped(1, n*1000000, "")
+	}
+	tests := []struct {
+		name    string
+		options []SyncOption
+		// msgs are the inputs and the stamps in ms of the messages.
+		msgs [][2]uint32
+		want [][]uint32
+	}{
+		// a1 may make a better set with b0 than a0, so a0 waits for it.
+		{"waits for a better set", nil,
+			[][2]uint32{{0, 0}, {1, 30}, {0, 35}}, [][]uint32{{35, 30}}},
+		{"outputs when a later message cannot be better", nil,
+			[][2]uint32{{0, 0}, {1, 30}, {0, 100}}, [][]uint32{{0, 30}}},
+		// a1 is at least 60ms after a0, which cannot make a better set.
+		{"inter-message lower bound", []SyncOption{SyncInterMessageLowerBound(0, 60*time.Millisecond)},
+			[][2]uint32{{0, 0}, {1, 30}}, [][]uint32{{0, 30}}},
+		{"max interval", []SyncOption{SyncMaxInterval(10 * time.Millisecond)},
+			[][2]uint32{{0, 0}, {1, 30}, {0, 35}, {1, 70}}, [][]uint32{{35, 30}}},
+		{"three inputs", nil,
+			[][2]uint32{{0, 0}, {1, 3}, {1, 40}, {2, 8}, {0, 60}, {2, 65}, {1, 62}},
+			[][]uint32{{0, 3, 8}}},
+	}
+	for _, test := range tests {
+		var got [][]uint32
+		inputs := make([]Filter, len(test.want[0]))
+		for i := range inputs {
+			inputs[i] = &testFilter{}
+		}
+		s, err := NewApproximateTimeSynchronizer(inputs, func(msgs []ros.Message) {
+			var set []uint32
+			for _, msg := range msgs {
+				set = append(set, msg.(*testStamped).Header.Stamp.NSec/1000000)
+			}
+			got = append(got, set)
+		}, test.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range test.msgs {
+			if err := s.Add(int(msg[0]), ms(msg[1])); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v but %v", test.name, test.want, got)
+		}
+	}
+
+	s, _ := NewApproximateTimeSynchronizer([]Filter{&testFilter{}, &testFilter{}}, func(msgs []ros.Message) {}, SyncQueueSize(2))
+	for _, n := range []uint32{0, 10, 20} {
+		s.Add(0, ms(n))
+	}
+	if d := s.(*approximateTimeSynchronizer).deques[0]; len(d) != 2 || d[0].msg.(*testStamped).Header.Stamp.NSec != 10000000 {
+		t.Errorf("expected the oldest message to be dropped but %v", d)
+	}
+	if _, err := NewApproximateTimeSynchronizer([]Filter{&testFilter{}, &testFilter{}}, func(msgs []ros.Message) {}, SyncInterMessageLowerBound(2, 0)); err == nil {
+		t.Error("expected an error for the lower bound of a missing input")
+	}
+	if _, err := NewApproximateTimeSynchronizer([]Filter{&testFilter{}, &testFilter{}}, func(msgs []ros.Message) {}, SyncMaxInterval(-1)); err == nil {
+		t.Error("expected an error for a negative interval")
+	}
+}
+
+func TestCache(t *testing.T) {
+	input := &testFilter{}
+	c := NewCache(input, 4)
+	var passed []string
+	c.RegisterCallback(func(msg ros.Message) {
+		passed = append(passed, msg.(*testStamped).Data)
+	})
+	if c.ElemBeforeTime(ros.NewTime(10, 0)) != nil || c.LatestTime() != (ros.Time{}) {
+		t.Error("expected an empty cache")
+	}
+	for _, sec := range []uint32{1, 2, 4, 3, 5} {
+		input.emit(stamped(sec, 0, string('0'+rune(sec))))
+	}
+	if want := []string{"1", "2", "4", "3", "5"}; !reflect.DeepEqual(passed, want) {
+		t.Errorf("expected the messages %v to be passed but %v", want, passed)
+	}
+	if c.OldestTime() != ros.NewTime(2, 0) || c.LatestTime() != ros.NewTime(5, 0) {
+		t.Errorf("unexpected time range %v - %v", c.OldestTime(), c.LatestTime())
+	}
+	for _, tc := range []struct {
+		start, end uint32
+		want       []string
+		surround   []string
+	}{
+		{3, 4, []string{"3", "4"}, []string{"3", "4"}},
+		{2, 5, []string{"2", "3", "4", "5"}, []string{"2", "3", "4", "5"}},
+		{1, 2, []string{"2"}, []string{"2"}},
+		{6, 7, nil, []string{"5"}},
+	} {
+		start, end := ros.NewTime(tc.start, 0), ros.NewTime(tc.end, 0)
+		if got := data(c.Interval(start, end)); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("interval %d-%d: expected %v but %v", tc.start, tc.end, tc.want, got)
+		}
+		if got := data(c.SurroundingInterval(start, end)); !reflect.DeepEqual(got, tc.surround) {
+			t.Errorf("surrounding interval %d-%d: expected %v but %v", tc.start, tc.end, tc.surround, got)
+		}
+	}
+	got := data(c.SurroundingInterval(ros.NewTime(2, 500), ros.NewTime(3, 500)))
+	if want := []string{"2", "3", "4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v but %v", want, got)
+	}
+	if m := c.ElemBeforeTime(ros.NewTime(3, 500)); m.(*testStamped).Data != "3" {
+		t.Errorf("unexpected message before 3.5 %v", m)
+	}
+	if m := c.ElemAfterTime(ros.NewTime(3, 500)); m.(*testStamped).Data != "4" {
+		t.Errorf("unexpected message after 3.5 %v", m)
+	}
+	if m := c.ElemAfterTime(ros.NewTime(6, 0)); m != nil {
+		t.Errorf("unexpected message after 6 %v", m)
+	}
+	if err := c.Add(&testUnstamped{}); err == nil {
+		t.Error("expected an error for a message without header")
+	}
+}
+
+func TestSubscriber(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	node, err := ros.NewNode("/fusion", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgType := stampedType(t)
+	image := NewSubscriber(node, "/image", msgType)
+	info := NewSubscriber(node, "/info", msgType)
+	defer image.Shutdown()
+	defer info.Shutdown()
+	matched := make(chan []string, 10)
+	_, err = NewTimeSynchronizer([]Filter{image, info}, func(image, info *dynamic.Message) {
+		matched <- []string{image.Data["data"].(string), info.Data["data"].(string)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		wg.Wait()
+	}()
+
+	// Messages published before the subscribers connect are lost.
+	connected := make(chan struct{}, 2)
+	onConnect := func(ros.SingleSubscriberPublisher) { connected <- struct{}{} }
+	imagePub := node.NewPublisherWithCallbacks("/image", msgType, onConnect, nil)
+	infoPub := node.NewPublisherWithCallbacks("/info", msgType, onConnect, nil)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-connected:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the subscribers did not connect")
+		}
+	}
+	imagePub.Publish(newStamped(msgType, ros.NewTime(1, 0), "image1"))
+	infoPub.Publish(newStamped(msgType, ros.NewTime(2, 0), "info2"))
+	imagePub.Publish(newStamped(msgType, ros.NewTime(2, 0), "image2"))
+	select {
+	case got := <-matched:
+		if want := []string{"image2", "info2"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("expected %v but %v", want, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no synchronized messages")
+	}
+}
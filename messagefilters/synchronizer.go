@@ -0,0 +1,524 @@
+package messagefilters
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// DefaultQueueSize is the number of messages of each input a synchronizer
+// keeps waiting for a match.
+const DefaultQueueSize = 10
+
+// DefaultAgePenalty is the default age penalty of the approximate time
+// policy, as in message_filters.
+const DefaultAgePenalty = 0.1
+
+// Synchronizer calls its callback with a set of messages, one of each input,
+// whose stamps match.
+type Synchronizer interface {
+	// Add adds a message of the input at index i. The inputs of the
+	// synchronizer add their messages with it.
+	Add(i int, msg ros.Message) error
+}
+
+// SyncOption configures a synchronizer.
+type SyncOption func(s *synchronizer)
+
+// SyncQueueSize sets the number of messages of each input kept waiting for
+// a match, DefaultQueueSize by default.
+func SyncQueueSize(size int) SyncOption {
+	return func(s *synchronizer) {
+		s.queueSize = size
+	}
+}
+
+// SyncMaxInterval bounds the difference between the stamps of the sets of
+// the approximate time policy, which is unbounded by default.
+func SyncMaxInterval(interval time.Duration) SyncOption {
+	return func(s *synchronizer) {
+		s.maxInterval = int64(interval)
+	}
+}
+
+// SyncAgePenalty sets the age penalty of the approximate time policy,
+// DefaultAgePenalty by default. Higher values output sets sooner, at the
+// cost of missing better sets made of later messages.
+func SyncAgePenalty(penalty float64) SyncOption {
+	return func(s *synchronizer) {
+		s.agePenalty = penalty
+	}
+}
+
+// SyncInterMessageLowerBound tells the approximate time policy that the
+// stamps of the messages of input i are at least bound apart, which lets it
+// output sets without waiting for the next message of the input.
+func SyncInterMessageLowerBound(i int, bound time.Duration) SyncOption {
+	return func(s *synchronizer) {
+		s.lowerBounds[i] = bound
+	}
+}
+
+// SyncLogger sets the logger of the messages which cannot be synchronized,
+// such as messages without header.
+func SyncLogger(logger ros.Logger) SyncOption {
+	return func(s *synchronizer) {
+		s.logger = logger
+	}
+}
+
+// synchronizer is the part of synchronizers common to all policies.
+type synchronizer struct {
+	mutex     sync.Mutex
+	inputs    int
+	queueSize int
+	logger    ros.Logger
+	callback  func(msgs []ros.Message)
+	// Parameters of the approximate time policy, in nanoseconds.
+	maxInterval int64
+	agePenalty  float64
+	lowerBounds map[int]time.Duration
+}
+
+func newSynchronizer(inputs []Filter, callback interface{}, options []SyncOption) (*synchronizer, error) {
+	s := &synchronizer{
+		inputs:      len(inputs),
+		queueSize:   DefaultQueueSize,
+		maxInterval: math.MaxInt64,
+		agePenalty:  DefaultAgePenalty,
+		lowerBounds: map[int]time.Duration{},
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	if s.logger == nil {
+		s.logger = ros.NewDefaultLogger()
+	}
+	if len(inputs) < 2 {
+		return nil, fmt.Errorf("messagefilters: a synchronizer needs at least 2 inputs")
+	}
+	if s.queueSize < 1 {
+		return nil, fmt.Errorf("messagefilters: invalid queue size %d", s.queueSize)
+	}
+	var err error
+	s.callback, err = setCallback(callback, len(inputs), s.logger)
+	return s, err
+}
+
+// connect adds the messages of the inputs to sync.
+func (s *synchronizer) connect(inputs []Filter, sync Synchronizer) {
+	for i, input := range inputs {
+		i := i
+		input.RegisterCallback(func(msg ros.Message) {
+			if err := sync.Add(i, msg); err != nil {
+				s.logger.Error(err)
+			}
+		})
+	}
+}
+
+func (s *synchronizer) stamp(i int, msg ros.Message) (uint64, error) {
+	if i < 0 || i >= s.inputs {
+		return 0, fmt.Errorf("messagefilters: no input %d", i)
+	}
+	stamp, ok := Stamp(msg)
+	if !ok {
+		return 0, fmt.Errorf("messagefilters: message of input %d has no header stamp", i)
+	}
+	return stamp.ToNSec(), nil
+}
+
+// setCallback converts the callback of a synchronizer, which takes either
+// a []ros.Message or one argument per input of the message types.
+func setCallback(callback interface{}, inputs int, logger ros.Logger) (func(msgs []ros.Message), error) {
+	if f, ok := callback.(func(msgs []ros.Message)); ok {
+		return f, nil
+	}
+	fun := reflect.ValueOf(callback)
+	if fun.Kind() != reflect.Func || fun.Type().NumIn() != inputs {
+		return nil, fmt.Errorf("messagefilters: the callback must take %d messages", inputs)
+	}
+	return func(msgs []ros.Message) {
+		args := make([]reflect.Value, len(msgs))
+		for i, msg := range msgs {
+			args[i] = reflect.ValueOf(msg)
+			if !args[i].Type().AssignableTo(fun.Type().In(i)) {
+				logger.Errorf("messagefilters: message %d of type %s does not match the callback", i, args[i].Type())
+				return
+			}
+		}
+		fun.Call(args)
+	}, nil
+}
+
+// timeSynchronizer matches messages of identical stamps.
+type timeSynchronizer struct {
+	*synchronizer
+	// sets are the incomplete sets of messages by stamp.
+	sets map[uint64][]ros.Message
+}
+
+// NewTimeSynchronizer calls callback with the messages of the inputs which
+// have the same stamp. callback is either a func([]ros.Message) or takes one
+// argument per input, such as func(*sensor_msgs.Image,
+// *sensor_msgs.CameraInfo). Incomplete sets older than a match are dropped.
+func NewTimeSynchronizer(inputs []Filter, callback interface{}, options ...SyncOption) (Synchronizer, error) {
+	base, err := newSynchronizer(inputs, callback, options)
+	if err != nil {
+		return nil, err
+	}
+	s := &timeSynchronizer{synchronizer: base, sets: map[uint64][]ros.Message{}}
+	s.connect(inputs, s)
+	return s, nil
+}
+
+func (s *timeSynchronizer) Add(i int, msg ros.Message) error {
+	stamp, err := s.stamp(i, msg)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	set, ok := s.sets[stamp]
+	if !ok {
+		set = make([]ros.Message, s.inputs)
+		s.sets[stamp] = set
+	}
+	set[i] = msg
+	for _, m := range set {
+		if m == nil {
+			s.dropOldest()
+			s.mutex.Unlock()
+			return nil
+		}
+	}
+	for t := range s.sets {
+		if t <= stamp {
+			delete(s.sets, t)
+		}
+	}
+	s.mutex.Unlock()
+	s.callback(set)
+	return nil
+}
+
+// dropOldest drops the oldest sets beyond the queue size.
+func (s *timeSynchronizer) dropOldest() {
+	if len(s.sets) <= s.queueSize {
+		return
+	}
+	stamps := make([]uint64, 0, len(s.sets))
+	for t := range s.sets {
+		stamps = append(stamps, t)
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i] < stamps[j] })
+	for _, t := range stamps[:len(stamps)-s.queueSize] {
+		delete(s.sets, t)
+	}
+}
+
+type stampedMessage struct {
+	stamp int64
+	msg   ros.Message
+}
+
+// noPivot tells that the approximate time policy has no candidate.
+const noPivot = -1
+
+// approximateTimeSynchronizer implements the ApproximateTime policy of
+// message_filters. Among the sets made of one message of each input, it
+// outputs the one whose stamps are the closest, with a penalty for old
+// sets, as soon as it can prove that no later message gives a better set.
+// Sets end with a pivot message, the latest of the set, and every later
+// set must contain a message newer than the pivot; with the age penalty
+// and the lower bounds of the intervals between messages, this bounds the
+// spread of the sets which are still possible.
+type approximateTimeSynchronizer struct {
+	*synchronizer
+	// deques are the messages of each input not considered yet for the
+	// current pivot, and past the ones considered.
+	deques [][]stampedMessage
+	past   [][]stampedMessage
+	// nonEmpty is the number of inputs with messages in their deque.
+	nonEmpty  int
+	candidate []ros.Message
+	// candidateStart and candidateEnd are the earliest and the latest stamps
+	// of the candidate.
+	candidateStart int64
+	candidateEnd   int64
+	pivot          int
+	pivotTime      int64
+	// dropped tells which inputs dropped messages since they were last
+	// behind a set, which makes them unfit as pivot.
+	dropped []bool
+	warned  []bool
+	// output are the sets to pass to the callback once the lock is released.
+	output [][]ros.Message
+}
+
+// NewApproximateTimeSynchronizer calls callback with a message of each input
+// whose stamps are close, with the ApproximateTime policy of message_filters:
+// each message is part of at most one set, sets do not cross, and among the
+// possible sets the one with the smallest difference between its earliest
+// and latest stamps is chosen, with a penalty for older sets given by
+// SyncAgePenalty. A set is output only once no later message can give a
+// better one, which happens when a message of each input newer than the set
+// arrived, or earlier with SyncInterMessageLowerBound. SyncMaxInterval
+// bounds the difference of stamps in a set. callback is as for
+// NewTimeSynchronizer.
+func NewApproximateTimeSynchronizer(inputs []Filter, callback interface{}, options ...SyncOption) (Synchronizer, error) {
+	base, err := newSynchronizer(inputs, callback, options)
+	if err != nil {
+		return nil, err
+	}
+	if base.maxInterval < 0 {
+		return nil, fmt.Errorf("messagefilters: negative interval %v", time.Duration(base.maxInterval))
+	}
+	if base.agePenalty < 0 {
+		return nil, fmt.Errorf("messagefilters: negative age penalty %v", base.agePenalty)
+	}
+	for i, bound := range base.lowerBounds {
+		if i < 0 || i >= len(inputs) {
+			return nil, fmt.Errorf("messagefilters: lower bound of the intervals of the missing input %d", i)
+		}
+		if bound < 0 {
+			return nil, fmt.Errorf("messagefilters: negative lower bound %v of the intervals of input %d", bound, i)
+		}
+	}
+	s := &approximateTimeSynchronizer{
+		synchronizer: base,
+		deques:       make([][]stampedMessage, len(inputs)),
+		past:         make([][]stampedMessage, len(inputs)),
+		pivot:        noPivot,
+		dropped:      make([]bool, len(inputs)),
+		warned:       make([]bool, len(inputs)),
+	}
+	s.connect(inputs, s)
+	return s, nil
+}
+
+func (s *approximateTimeSynchronizer) Add(i int, msg ros.Message) error {
+	stamp, err := s.stamp(i, msg)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	s.deques[i] = append(s.deques[i], stampedMessage{int64(stamp), msg})
+	if len(s.deques[i]) == 1 {
+		s.nonEmpty++
+		if s.nonEmpty == s.inputs {
+			s.process()
+		}
+	} else {
+		s.checkInterMessageBound(i)
+	}
+	if len(s.deques[i])+len(s.past[i]) > s.queueSize {
+		// Cancel the search of a candidate and drop the oldest message.
+		s.nonEmpty = 0
+		for j := range s.deques {
+			s.recover(j, len(s.past[j]))
+		}
+		s.deques[i] = s.deques[i][1:]
+		if len(s.deques[i]) == 0 {
+			s.nonEmpty--
+		}
+		s.dropped[i] = true
+		if s.pivot != noPivot {
+			s.candidate = nil
+			s.pivot = noPivot
+			s.process()
+		}
+	}
+	output := s.output
+	s.output = nil
+	s.mutex.Unlock()
+	for _, set := range output {
+		s.callback(set)
+	}
+	return nil
+}
+
+// checkInterMessageBound warns once per input about messages out of order
+// or closer than the lower bound of their intervals.
+func (s *approximateTimeSynchronizer) checkInterMessageBound(i int) {
+	if s.warned[i] {
+		return
+	}
+	deque := s.deques[i]
+	var previous int64
+	if len(deque) == 1 {
+		if len(s.past[i]) == 0 {
+			return
+		}
+		previous = s.past[i][len(s.past[i])-1].stamp
+	} else {
+		previous = deque[len(deque)-2].stamp
+	}
+	stamp := deque[len(deque)-1].stamp
+	if stamp < previous {
+		s.logger.Warnf("messagefilters: messages of input %d arrived out of order (will print only once)", i)
+		s.warned[i] = true
+	} else if bound := s.lowerBounds[i]; stamp-previous < int64(bound) {
+		s.logger.Warnf("messagefilters: messages of input %d arrived closer (%v) than the lower bound of their intervals (%v) (will print only once)",
+			i, time.Duration(stamp-previous), bound)
+		s.warned[i] = true
+	}
+}
+
+// process looks for candidates while every input has messages.
+func (s *approximateTimeSynchronizer) process() {
+	for s.nonEmpty == s.inputs {
+		startIndex, startTime, endIndex, endTime := s.bounds(s.frontTime)
+		for i := range s.dropped {
+			if i != endIndex {
+				// No dropped message could have been better than the ones
+				// kept, so the input may be pivot again.
+				s.dropped[i] = false
+			}
+		}
+		if s.pivot == noPivot {
+			if endTime-startTime > s.maxInterval || s.dropped[endIndex] {
+				s.deleteFront(startIndex)
+				continue
+			}
+			s.makeCandidate()
+			s.candidateStart, s.candidateEnd = startTime, endTime
+			s.pivot, s.pivotTime = endIndex, endTime
+			s.moveFrontToPast(startIndex)
+		} else {
+			if !s.better(startTime, endTime) {
+				s.moveFrontToPast(startIndex)
+			} else {
+				s.makeCandidate()
+				s.candidateStart, s.candidateEnd = startTime, endTime
+				s.moveFrontToPast(startIndex)
+			}
+		}
+
+		if startIndex == s.pivot {
+			// Every candidate of the pivot was considered.
+			s.publishCandidate()
+		} else if !s.better(s.pivotTime, endTime) {
+			// Later candidates contain [pivotTime, endTime], which is
+			// already worse than the candidate.
+			s.publishCandidate()
+		} else if s.nonEmpty < s.inputs {
+			s.searchVirtual()
+		}
+	}
+}
+
+// searchVirtual considers the messages still to come with the earliest
+// stamps they may have, and publishes the candidate when they cannot give
+// a better one.
+func (s *approximateTimeSynchronizer) searchVirtual() {
+	moves := make([]int, s.inputs)
+	for {
+		startIndex, startTime, _, endTime := s.bounds(s.virtualTime)
+		if !s.better(s.pivotTime, endTime) {
+			s.publishCandidate()
+			return
+		}
+		if s.better(startTime, endTime) {
+			// A future set may be better, so wait for more messages.
+			s.nonEmpty = 0
+			for i, n := range moves {
+				s.recover(i, n)
+			}
+			return
+		}
+		s.moveFrontToPast(startIndex)
+		moves[startIndex]++
+	}
+}
+
+// better tells whether the set spanning from start to end is better than
+// the candidate.
+func (s *approximateTimeSynchronizer) better(start, end int64) bool {
+	return float64(end-s.candidateEnd)*(1+s.agePenalty) < float64(start-s.candidateStart)
+}
+
+// bounds returns the inputs with the earliest and latest times.
+func (s *approximateTimeSynchronizer) bounds(timeOf func(i int) int64) (int, int64, int, int64) {
+	startIndex, endIndex := 0, 0
+	startTime, endTime := timeOf(0), timeOf(0)
+	for i := 1; i < s.inputs; i++ {
+		t := timeOf(i)
+		if t < startTime {
+			startIndex, startTime = i, t
+		}
+		if t >= endTime {
+			endIndex, endTime = i, t
+		}
+	}
+	return startIndex, startTime, endIndex, endTime
+}
+
+func (s *approximateTimeSynchronizer) frontTime(i int) int64 {
+	return s.deques[i][0].stamp
+}
+
+// virtualTime is the stamp of the next message of an input, or the earliest
+// stamp its next message may have.
+func (s *approximateTimeSynchronizer) virtualTime(i int) int64 {
+	if len(s.deques[i]) > 0 {
+		return s.deques[i][0].stamp
+	}
+	past := s.past[i]
+	t := past[len(past)-1].stamp + int64(s.lowerBounds[i])
+	if t < s.pivotTime {
+		t = s.pivotTime
+	}
+	return t
+}
+
+func (s *approximateTimeSynchronizer) makeCandidate() {
+	s.candidate = make([]ros.Message, s.inputs)
+	for i, deque := range s.deques {
+		s.candidate[i] = deque[0].msg
+		// The past messages cannot be part of a better set.
+		s.past[i] = nil
+	}
+}
+
+func (s *approximateTimeSynchronizer) publishCandidate() {
+	s.output = append(s.output, s.candidate)
+	s.candidate = nil
+	s.pivot = noPivot
+	// Put the past messages back and drop the ones of the set.
+	s.nonEmpty = 0
+	for i := range s.deques {
+		s.deques[i] = append(s.past[i], s.deques[i]...)
+		s.past[i] = nil
+		s.deques[i] = s.deques[i][1:]
+		if len(s.deques[i]) > 0 {
+			s.nonEmpty++
+		}
+	}
+}
+
+func (s *approximateTimeSynchronizer) deleteFront(i int) {
+	s.deques[i] = s.deques[i][1:]
+	if len(s.deques[i]) == 0 {
+		s.nonEmpty--
+	}
+}
+
+func (s *approximateTimeSynchronizer) moveFrontToPast(i int) {
+	s.past[i] = append(s.past[i], s.deques[i][0])
+	s.deleteFront(i)
+}
+
+// recover moves the n latest past messages of input i back to its deque.
+func (s *approximateTimeSynchronizer) recover(i int, n int) {
+	past := s.past[i]
+	s.deques[i] = append(append([]stampedMessage{}, past[len(past)-n:]...), s.deques[i]...)
+	s.past[i] = past[:len(past)-n]
+	if len(s.deques[i]) > 0 {
+		s.nonEmpty++
+	}
+}
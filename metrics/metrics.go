@@ -0,0 +1,176 @@
+// Package metrics exports the traffic counters of a node in the Prometheus
+// text format, without depending on the Prometheus client library.
+//
+//	server, err := metrics.Serve(node, ":9100")
+//
+// serves them at http://host:9100/metrics until the node shuts down. Handler
+// gives an http.Handler to mount in an existing server instead.
+//
+// The exported metrics are:
+//
+//	ros_topic_messages_total{topic,direction}             messages sent or received
+//	ros_topic_bytes_total{topic,direction}                bytes sent or received
+//	ros_topic_connections{topic,direction}                connected subscribers or publishers
+//	ros_topic_dropped_messages_total{topic}               messages dropped from full subscriber queues
+//	ros_subscriber_callback_latency_seconds{topic}        time from receipt to callback
+//	ros_spin_queue_depth                                  callbacks waiting for Spin
+//	ros_service_calls_total{service,direction}            service calls
+//	ros_service_errors_total{service,direction}           failed service calls
+//	ros_service_call_duration_seconds{service,direction}  service call latency
+//
+// where direction is "out" for published topics and called services and
+// "in" for subscribed topics and served services.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// ContentType is the content type of the Prometheus text format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Write writes metrics in the Prometheus text format.
+func Write(w io.Writer, m ros.Metrics) error {
+	b := bufio.NewWriter(w)
+	var outbound, inbound []ros.TopicMetrics
+	for _, t := range m.Topics {
+		if t.Direction == ros.Outbound {
+			outbound = append(outbound, t)
+		} else {
+			inbound = append(inbound, t)
+		}
+	}
+
+	family(b, "ros_topic_messages_total", "counter", "Messages sent to subscribers or received from publishers.")
+	for _, t := range m.Topics {
+		sample(b, "ros_topic_messages_total", topicLabels(t), float64(t.Messages))
+	}
+	family(b, "ros_topic_bytes_total", "counter", "Bytes sent to subscribers or received from publishers.")
+	for _, t := range m.Topics {
+		sample(b, "ros_topic_bytes_total", topicLabels(t), float64(t.Bytes))
+	}
+	family(b, "ros_topic_connections", "gauge", "Connected subscribers or publishers.")
+	for _, t := range m.Topics {
+		sample(b, "ros_topic_connections", topicLabels(t), float64(t.Connections))
+	}
+	family(b, "ros_topic_dropped_messages_total", "counter", "Messages dropped because the queue of a subscriber was full.")
+	for _, t := range outbound {
+		sample(b, "ros_topic_dropped_messages_total", labels("topic", t.Topic), float64(t.Drops))
+	}
+	family(b, "ros_subscriber_callback_latency_seconds", "histogram", "Time from the receipt of messages to the start of their callbacks.")
+	for _, t := range inbound {
+		histogram(b, "ros_subscriber_callback_latency_seconds", []string{"topic", t.Topic}, t.CallbackLatency)
+	}
+	family(b, "ros_spin_queue_depth", "gauge", "Callbacks waiting for Spin.")
+	sample(b, "ros_spin_queue_depth", "", float64(m.SpinQueueDepth))
+
+	family(b, "ros_service_calls_total", "counter", "Service calls made or served.")
+	for _, s := range m.Services {
+		sample(b, "ros_service_calls_total", serviceLabels(s), float64(s.Calls))
+	}
+	family(b, "ros_service_errors_total", "counter", "Service calls which failed.")
+	for _, s := range m.Services {
+		sample(b, "ros_service_errors_total", serviceLabels(s), float64(s.Errors))
+	}
+	family(b, "ros_service_call_duration_seconds", "histogram", "Duration of the service calls.")
+	for _, s := range m.Services {
+		histogram(b, "ros_service_call_duration_seconds", []string{"service", s.Service, "direction", s.Direction.String()}, s.Latency)
+	}
+	return b.Flush()
+}
+
+// Handler returns an HTTP handler serving the metrics of node.
+func Handler(node ros.Node) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		if err := Write(w, node.Metrics()); err != nil {
+			node.Logger().Warnf("Failed to write metrics: %v", err)
+		}
+	})
+}
+
+// Server serves the metrics of a node at /metrics.
+type Server struct {
+	listener net.Listener
+	server   *http.Server
+}
+
+// Serve starts serving the metrics of node at address until the node shuts
+// down or the server is closed.
+func Serve(node ros.Node, address string) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler(node))
+	s := &Server{listener: listener, server: &http.Server{Handler: mux}}
+	go s.server.Serve(listener)
+	node.OnShutdown(func(ros.ShutdownReason) {
+		s.Close()
+	})
+	return s, nil
+}
+
+// Addr returns the address the server listens to.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+func family(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func sample(w io.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s %s\n", name, labels, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+func histogram(w io.Writer, name string, pairs []string, h ros.Histogram) {
+	for i, bound := range h.Buckets {
+		le := strconv.FormatFloat(bound, 'g', -1, 64)
+		sample(w, name+"_bucket", labels(append(pairs, "le", le)...), float64(h.Counts[i]))
+	}
+	sample(w, name+"_bucket", labels(append(pairs, "le", "+Inf")...), float64(h.Count))
+	sample(w, name+"_sum", labels(pairs...), h.Sum)
+	sample(w, name+"_count", labels(pairs...), float64(h.Count))
+}
+
+func topicLabels(t ros.TopicMetrics) string {
+	return labels("topic", t.Topic, "direction", t.Direction.String())
+}
+
+func serviceLabels(s ros.ServiceMetrics) string {
+	return labels("service", s.Service, "direction", s.Direction.String())
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats label names and values given in pairs.
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", pairs[i], escaper.Replace(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
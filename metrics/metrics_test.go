@@ -0,0 +1,146 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+func TestWrite(t *testing.T) {
+	latency := ros.Histogram{Buckets: []float64{0.01, 1}, Counts: []uint64{1, 3}, Count: 4, Sum: 2.5}
+	m := ros.Metrics{
+		Topics: []ros.TopicMetrics{
+			{Topic: "/chatter", Direction: ros.Outbound, Messages: 3, Bytes: 42, Connections: 1, Drops: 2},
+			{Topic: `/a"b`, Direction: ros.Inbound, Messages: 1, Bytes: 14, CallbackLatency: latency},
+		},
+		Services: []ros.ServiceMetrics{
+			{Service: "/reset", Direction: ros.Inbound, Calls: 4, Errors: 1, Latency: latency},
+		},
+		SpinQueueDepth: 5,
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, m); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP ros_topic_messages_total Messages sent to subscribers or received from publishers.
+# TYPE ros_topic_messages_total counter
+ros_topic_messages_total{topic="/chatter",direction="out"} 3
+ros_topic_messages_total{topic="/a\"b",direction="in"} 1
+# HELP ros_topic_bytes_total Bytes sent to subscribers or received from publishers.
+# TYPE ros_topic_bytes_total counter
+ros_topic_bytes_total{topic="/chatter",direction="out"} 42
+ros_topic_bytes_total{topic="/a\"b",direction="in"} 14
+# HELP ros_topic_connections Connected subscribers or publishers.
+# TYPE ros_topic_connections gauge
+ros_topic_connections{topic="/chatter",direction="out"} 1
+ros_topic_connections{topic="/a\"b",direction="in"} 0
+# HELP ros_topic_dropped_messages_total Messages dropped because the queue of a subscriber was full.
+# TYPE ros_topic_dropped_messages_total counter
+ros_topic_dropped_messages_total{topic="/chatter"} 2
+# HELP ros_subscriber_callback_latency_seconds Time from the receipt of messages to the start of their callbacks.
+# TYPE ros_subscriber_callback_latency_seconds histogram
+ros_subscriber_callback_latency_seconds_bucket{topic="/a\"b",le="0.01"} 1
+ros_subscriber_callback_latency_seconds_bucket{topic="/a\"b",le="1"} 3
+ros_subscriber_callback_latency_seconds_bucket{topic="/a\"b",le="+Inf"} 4
+ros_subscriber_callback_latency_seconds_sum{topic="/a\"b"} 2.5
+ros_subscriber_callback_latency_seconds_count{topic="/a\"b"} 4
+# HELP ros_spin_queue_depth Callbacks waiting for Spin.
+# TYPE ros_spin_queue_depth gauge
+ros_spin_queue_depth 5
+# HELP ros_service_calls_total Service calls made or served.
+# TYPE ros_service_calls_total counter
+ros_service_calls_total{service="/reset",direction="in"} 4
+# HELP ros_service_errors_total Service calls which failed.
+# TYPE ros_service_errors_total counter
+ros_service_errors_total{service="/reset",direction="in"} 1
+# HELP ros_service_call_duration_seconds Duration of the service calls.
+# TYPE ros_service_call_duration_seconds histogram
+ros_service_call_duration_seconds_bucket{service="/reset",direction="in",le="0.01"} 1
+ros_service_call_duration_seconds_bucket{service="/reset",direction="in",le="1"} 3
+ros_service_call_duration_seconds_bucket{service="/reset",direction="in",le="+Inf"} 4
+ros_service_call_duration_seconds_sum{service="/reset",direction="in"} 2.5
+ros_service_call_duration_seconds_count{service="/reset",direction="in"} 4
+`
+	if got := buf.String(); got != want {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+}
+
+func TestServe(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	textType, err := dynamic.NewContext(nil).AddDefinition("test_msgs/Text", "string data\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newNode := func(name string) ros.Node {
+		node, err := ros.NewNode(name, []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return node
+	}
+	talker := newNode("/talker")
+	defer talker.Shutdown()
+	listener := newNode("/listener")
+	defer listener.Shutdown()
+
+	server, err := Serve(listener, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	received := make(chan struct{}, 1)
+	listener.NewSubscriber("chatter", textType, func(*dynamic.Message) {
+		received <- struct{}{}
+	})
+	go listener.Spin()
+	pub := talker.NewPublisher("chatter", textType, ros.PublisherLatched(true))
+	msg := textType.New()
+	msg.Data["data"] = "hello"
+	pub.Publish(msg)
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message was not received")
+	}
+
+	res, err := http.Get("http://" + server.Addr() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != ContentType {
+		t.Errorf("unexpected content type %q", res.Header.Get("Content-Type"))
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`ros_topic_messages_total{topic="/chatter",direction="in"} 1`,
+		`ros_topic_bytes_total{topic="/chatter",direction="in"} 13`,
+		`ros_topic_connections{topic="/chatter",direction="in"} 1`,
+		`ros_subscriber_callback_latency_seconds_count{topic="/chatter"} 1`,
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("%s is missing from:\n%s", line, body)
+		}
+	}
+
+	listener.Shutdown()
+	if _, err := http.Get("http://" + server.Addr() + "/metrics"); err == nil {
+		t.Error("the server runs after the shutdown of the node")
+	}
+}
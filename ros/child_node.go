@@ -0,0 +1,186 @@
+package ros
+
+import (
+	"sync"
+)
+
+// childNode is a node handle which shares the connections of a defaultNode
+// and resolves names relative to its own namespace.
+type childNode struct {
+	node         *defaultNode
+	nameResolver *NameResolver
+	name         string
+	args         []string
+	handles      []interface{ Shutdown() }
+	handlesMutex sync.Mutex
+}
+
+// ChildOption customizes child node handles.
+type ChildOption func(c *childNode)
+
+// ChildName gives a child a node name of its own, under which its private
+// names resolve, like the nodelets of a nodelet manager.
+func ChildName(name string) ChildOption {
+	return func(c *childNode) {
+		c.name = name
+	}
+}
+
+// ChildArgs gives a child the non-ROS arguments args instead of those of
+// its parent.
+func ChildArgs(args []string) ChildOption {
+	return func(c *childNode) {
+		c.args = args
+	}
+}
+
+func newChildNode(node *defaultNode, parent *NameResolver, namespace string, remappings NameMap, options ...ChildOption) *childNode {
+	c := &childNode{node: node}
+	for _, opt := range options {
+		opt(c)
+	}
+	c.nameResolver = parent.newChild(namespace, c.name, remappings)
+	return c
+}
+
+// track records a handle to shut down with the child.
+func (c *childNode) track(handle interface{ Shutdown() }) {
+	c.handlesMutex.Lock()
+	defer c.handlesMutex.Unlock()
+	c.handles = append(c.handles, handle)
+}
+
+func (c *childNode) NewPublisher(topic string, msgType MessageType, options ...PublisherOption) Publisher {
+	return c.NewPublisherWithCallbacks(topic, msgType, nil, nil, options...)
+}
+
+func (c *childNode) NewPublisherWithCallbacks(topic string, msgType MessageType, connectCallback, disconnectCallback func(SingleSubscriberPublisher), options ...PublisherOption) Publisher {
+	pub := &publisherHandle{defaultPublisher: c.node.newPublisher(c.nameResolver.remap(topic), msgType, connectCallback, disconnectCallback, options...)}
+	c.track(pub)
+	return pub
+}
+
+func (c *childNode) NewSubscriber(topic string, msgType MessageType, callback interface{}, options ...SubscriberOption) Subscriber {
+	sub, cb := c.node.newSubscriber(c.nameResolver.remap(topic), msgType, callback, options...)
+	handle := &subscriberHandle{defaultSubscriber: sub, node: c.node, callback: cb}
+	c.track(handle)
+	return handle
+}
+
+func (c *childNode) NewServiceClient(service string, srvType ServiceType, options ...ServiceClientOption) ServiceClient {
+	client := c.node.newServiceClient(c.nameResolver.remap(service), srvType, options...)
+	c.track(client)
+	return client
+}
+
+func (c *childNode) NewServiceServer(service string, srvType ServiceType, handler interface{}, options ...ServiceServerOption) ServiceServer {
+	server := c.node.newServiceServer(c.nameResolver.remap(service), srvType, handler, options...)
+	if server == nil {
+		return nil
+	}
+	c.track(server)
+	return server
+}
+
+func (c *childNode) OK() bool {
+	return c.node.OK()
+}
+
+func (c *childNode) SpinOnce() {
+	c.node.SpinOnce()
+}
+
+func (c *childNode) Spin() {
+	c.node.Spin()
+}
+
+// Shutdown shuts down the publishers, subscribers and services created
+// through the child. Publishers and subscribers are shared with the node and
+// the other children, so the child only releases its publisher references
+// and removes its callbacks. The underlying node keeps running.
+func (c *childNode) Shutdown() {
+	c.handlesMutex.Lock()
+	handles := c.handles
+	c.handles = nil
+	c.handlesMutex.Unlock()
+	for _, handle := range handles {
+		handle.Shutdown()
+	}
+}
+
+func (c *childNode) OnShutdown(hook func(reason ShutdownReason)) {
+	c.node.OnShutdown(hook)
+}
+
+func (c *childNode) ShutdownReason() *ShutdownReason {
+	return c.node.ShutdownReason()
+}
+
+func (c *childNode) OnMasterEvent(callback func(event MasterEvent)) {
+	c.node.OnMasterEvent(callback)
+}
+
+func (c *childNode) GetParam(key string) (interface{}, error) {
+	return c.node.getParam(c.nameResolver.remap(key))
+}
+
+func (c *childNode) SetParam(key string, value interface{}) error {
+	return c.node.setParam(c.nameResolver.remap(key), value)
+}
+
+func (c *childNode) HasParam(key string) (bool, error) {
+	return c.node.hasParam(c.nameResolver.remap(key))
+}
+
+func (c *childNode) SearchParam(key string) (string, error) {
+	return c.node.searchParam(c.nameResolver.namespace, key)
+}
+
+func (c *childNode) DeleteParam(key string) error {
+	return c.node.deleteParam(c.nameResolver.remap(key))
+}
+
+func (c *childNode) NewChild(namespace string, remappings NameMap, options ...ChildOption) Node {
+	child := newChildNode(c.node, c.nameResolver, namespace, remappings, options...)
+	if len(child.name) == 0 {
+		child.name = c.name
+	}
+	if child.args == nil {
+		child.args = c.args
+	}
+	return child
+}
+
+func (c *childNode) Graph() Graph {
+	return &defaultGraph{c.node, c.nameResolver}
+}
+
+func (c *childNode) Now() Time {
+	return c.node.Now()
+}
+
+func (c *childNode) Clock() Clock {
+	return c.node.Clock()
+}
+
+func (c *childNode) Metrics() Metrics {
+	return c.node.Metrics()
+}
+
+func (c *childNode) Logger() Logger {
+	return c.node.logger
+}
+
+func (c *childNode) NonRosArgs() []string {
+	if c.args != nil {
+		return c.args
+	}
+	return c.node.nonRosArgs
+}
+
+func (c *childNode) Name() string {
+	if len(c.name) > 0 {
+		return c.name
+	}
+	return c.node.name
+}
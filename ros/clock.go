@@ -0,0 +1,70 @@
+package ros
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a source of ROS time. Every node has its own clock, the wall
+// clock unless NodeClock is given.
+type Clock interface {
+	Now() Time
+}
+
+// SimClock is a clock which only advances when it is set, e.g. by a
+// simulator driving several nodes of one process.
+type SimClock interface {
+	Clock
+	Set(t Time)
+}
+
+type wallClock struct{}
+
+// NewWallClock returns a clock giving the system time.
+func NewWallClock() Clock {
+	return wallClock{}
+}
+
+func (wallClock) Now() Time {
+	return Now()
+}
+
+type defaultSimClock struct {
+	now   Time
+	mutex sync.RWMutex
+}
+
+// NewSimClock returns a clock starting at t.
+func NewSimClock(t Time) SimClock {
+	return &defaultSimClock{now: t}
+}
+
+func (c *defaultSimClock) Now() Time {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.now
+}
+
+func (c *defaultSimClock) Set(t Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.now = t
+}
+
+// simClockPollPeriod is the period at which sleeps poll clocks other than
+// the wall clock.
+const simClockPollPeriod = time.Millisecond
+
+// sleepUntil sleeps until clock reaches t.
+func sleepUntil(clock Clock, t Time) {
+	if _, ok := clock.(wallClock); ok {
+		if now := Now(); t.Cmp(now) > 0 {
+			remaining := t.Diff(now)
+			remaining.Sleep()
+		}
+		return
+	}
+	for now := clock.Now(); now.Cmp(t) < 0; now = clock.Now() {
+		time.Sleep(simClockPollPeriod)
+	}
+}
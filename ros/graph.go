@@ -0,0 +1,273 @@
+package ros
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/rosapi"
+)
+
+// TopicInfo is a topic name with its message type.
+type TopicInfo = rosapi.TopicInfo
+
+// SystemState maps each topic or service name to the nodes using it.
+type SystemState = rosapi.SystemState
+
+// Graph queries the state of the ROS graph from the master. Names are
+// resolved relative to the namespace of the node.
+type Graph interface {
+	// PublishedTopics returns the topics having publishers under the
+	// namespace subgraph. An empty subgraph means all topics.
+	PublishedTopics(subgraph string) ([]TopicInfo, error)
+	// TopicTypes returns every topic known to the master with its type.
+	TopicTypes() ([]TopicInfo, error)
+	SystemState() (*SystemState, error)
+	// Nodes returns the sorted names of the nodes registered to the master.
+	Nodes() ([]string, error)
+	// LookupNode returns the XML-RPC URI of a node.
+	LookupNode(name string) (string, error)
+	// PingNode calls the Slave API of a node and returns the round trip time.
+	PingNode(name string) (time.Duration, error)
+	// LookupService returns the rosrpc URI of a service.
+	LookupService(name string) (string, error)
+	// ProbeService returns the connection header of a service, which tells
+	// its type and MD5 sum, without calling it.
+	ProbeService(name string) (map[string]string, error)
+	// Watch polls the master every interval and calls callback with the
+	// changes since the previous poll. Callbacks are executed by Spin and
+	// SpinOnce like subscriber callbacks.
+	Watch(interval time.Duration, callback func([]GraphEvent)) GraphWatcher
+}
+
+// GraphEventKind tells what changed in the graph.
+type GraphEventKind int
+
+const (
+	NodeAdded GraphEventKind = iota
+	NodeRemoved
+	PublisherAdded
+	PublisherRemoved
+	SubscriberAdded
+	SubscriberRemoved
+	ServiceAdded
+	ServiceRemoved
+)
+
+func (k GraphEventKind) String() string {
+	switch k {
+	case NodeAdded:
+		return "NodeAdded"
+	case NodeRemoved:
+		return "NodeRemoved"
+	case PublisherAdded:
+		return "PublisherAdded"
+	case PublisherRemoved:
+		return "PublisherRemoved"
+	case SubscriberAdded:
+		return "SubscriberAdded"
+	case SubscriberRemoved:
+		return "SubscriberRemoved"
+	case ServiceAdded:
+		return "ServiceAdded"
+	case ServiceRemoved:
+		return "ServiceRemoved"
+	}
+	return "Unknown"
+}
+
+// GraphEvent is a change of the graph. Name is the topic or the service and
+// is empty for node events.
+type GraphEvent struct {
+	Kind GraphEventKind
+	Node string
+	Name string
+}
+
+// GraphWatcher stops the notifications of Graph.Watch.
+type GraphWatcher interface {
+	Shutdown()
+}
+
+const probeTimeout = 3 * time.Second
+
+type defaultGraph struct {
+	node         *defaultNode
+	nameResolver *NameResolver
+}
+
+func (g *defaultGraph) master() *rosapi.MasterClient {
+	return rosapi.NewMasterClient(g.node.masterURI, g.node.qualifiedName)
+}
+
+func (g *defaultGraph) PublishedTopics(subgraph string) ([]TopicInfo, error) {
+	if len(subgraph) > 0 {
+		subgraph = g.nameResolver.resolve(subgraph)
+	}
+	return g.master().GetPublishedTopics(subgraph)
+}
+
+func (g *defaultGraph) TopicTypes() ([]TopicInfo, error) {
+	return g.master().GetTopicTypes()
+}
+
+func (g *defaultGraph) SystemState() (*SystemState, error) {
+	return g.master().GetSystemState()
+}
+
+func (g *defaultGraph) Nodes() ([]string, error) {
+	state, err := g.SystemState()
+	if err != nil {
+		return nil, err
+	}
+	return stateNodes(state), nil
+}
+
+func (g *defaultGraph) LookupNode(name string) (string, error) {
+	return g.master().LookupNode(g.nameResolver.resolve(name))
+}
+
+func (g *defaultGraph) PingNode(name string) (time.Duration, error) {
+	uri, err := g.LookupNode(name)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	if _, err := rosapi.NewSlaveClient(uri, g.node.qualifiedName).GetPid(); err != nil {
+		return 0, err
+	}
+	return time.Since(start), nil
+}
+
+func (g *defaultGraph) LookupService(name string) (string, error) {
+	return g.master().LookupService(g.nameResolver.remap(name))
+}
+
+func (g *defaultGraph) ProbeService(name string) (map[string]string, error) {
+	service := g.nameResolver.remap(name)
+	uri, err := g.master().LookupService(service)
+	if err != nil {
+		return nil, err
+	}
+	return probeService(uri, service, g.node.qualifiedName, probeTimeout)
+}
+
+func (g *defaultGraph) Watch(interval time.Duration, callback func([]GraphEvent)) GraphWatcher {
+	w := &defaultGraphWatcher{quitChan: make(chan struct{})}
+	go w.run(g, interval, callback)
+	return w
+}
+
+type defaultGraphWatcher struct {
+	quitChan chan struct{}
+	quitOnce sync.Once
+}
+
+func (w *defaultGraphWatcher) run(g *defaultGraph, interval time.Duration, callback func([]GraphEvent)) {
+	node := g.node
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *SystemState
+	for {
+		state, err := g.SystemState()
+		if err != nil {
+			node.logger.Debugf("Graph watcher failed to get system state: %v", err)
+		} else {
+			if last != nil {
+				if events := diffSystemState(last, state); len(events) > 0 {
+					select {
+					case node.jobChan <- func() { callback(events) }:
+					case <-w.quitChan:
+						return
+					case <-node.done:
+						return
+					}
+				}
+			}
+			last = state
+		}
+
+		select {
+		case <-ticker.C:
+			if !node.OK() {
+				return
+			}
+		case <-w.quitChan:
+			return
+		case <-node.done:
+			return
+		}
+	}
+}
+
+func (w *defaultGraphWatcher) Shutdown() {
+	w.quitOnce.Do(func() {
+		close(w.quitChan)
+	})
+}
+
+func stateNodes(state *SystemState) []string {
+	set := make(map[string]bool)
+	for _, m := range []map[string][]string{state.Publishers, state.Subscribers, state.Services} {
+		for _, nodes := range m {
+			for _, n := range nodes {
+				set[n] = true
+			}
+		}
+	}
+	nodes := make([]string, 0, len(set))
+	for n := range set {
+		nodes = append(nodes, n)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// diffRegistrations returns the (name, node) pairs of a missing from b.
+func diffRegistrations(a, b map[string][]string, kind GraphEventKind) []GraphEvent {
+	var events []GraphEvent
+	names := make([]string, 0, len(a))
+	for name := range a {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, n := range a[name] {
+			found := false
+			for _, m := range b[name] {
+				if m == n {
+					found = true
+					break
+				}
+			}
+			if !found {
+				events = append(events, GraphEvent{kind, n, name})
+			}
+		}
+	}
+	return events
+}
+
+func diffSystemState(old, current *SystemState) []GraphEvent {
+	var events []GraphEvent
+	oldNodes := stateNodes(old)
+	newNodes := stateNodes(current)
+	for _, n := range newNodes {
+		if i := sort.SearchStrings(oldNodes, n); i == len(oldNodes) || oldNodes[i] != n {
+			events = append(events, GraphEvent{NodeAdded, n, ""})
+		}
+	}
+	for _, n := range oldNodes {
+		if i := sort.SearchStrings(newNodes, n); i == len(newNodes) || newNodes[i] != n {
+			events = append(events, GraphEvent{NodeRemoved, n, ""})
+		}
+	}
+	events = append(events, diffRegistrations(current.Publishers, old.Publishers, PublisherAdded)...)
+	events = append(events, diffRegistrations(old.Publishers, current.Publishers, PublisherRemoved)...)
+	events = append(events, diffRegistrations(current.Subscribers, old.Subscribers, SubscriberAdded)...)
+	events = append(events, diffRegistrations(old.Subscribers, current.Subscribers, SubscriberRemoved)...)
+	events = append(events, diffRegistrations(current.Services, old.Services, ServiceAdded)...)
+	events = append(events, diffRegistrations(old.Services, current.Services, ServiceRemoved)...)
+	return events
+}
@@ -0,0 +1,134 @@
+package ros
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+)
+
+type testMessageType struct{}
+
+func (t testMessageType) Text() string        { return "uint8[] data\n" }
+func (t testMessageType) MD5Sum() string      { return "f43a8e1b362b75baa741461b46adc799" }
+func (t testMessageType) Name() string        { return "test_msgs/Bytes" }
+func (t testMessageType) NewMessage() Message { return &testMessage{} }
+
+type testMessage struct {
+	data []byte
+}
+
+func (m *testMessage) GetType() MessageType { return testMessageType{} }
+
+func (m *testMessage) Serialize(buf *bytes.Buffer) error {
+	_, err := buf.Write(m.data)
+	return err
+}
+
+func (m *testMessage) Deserialize(buf *Reader) error {
+	m.data = append([]byte{}, buf.Next(buf.Len())...)
+	return nil
+}
+
+func newTestNode(t *testing.T, m master.Master, name string) Node {
+	node, err := NewNode(name, []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return node
+}
+
+func TestGraph(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	talker := newTestNode(t, m, "/ns/talker")
+	defer talker.Shutdown()
+	talker.NewPublisher("chatter", testMessageType{})
+
+	node := newTestNode(t, m, "/ns/graph")
+	defer node.Shutdown()
+	graph := node.Graph()
+
+	topics, err := graph.PublishedTopics("")
+	if err != nil || !reflect.DeepEqual(topics, []TopicInfo{{Name: "/ns/chatter", Type: "test_msgs/Bytes"}}) {
+		t.Errorf("PublishedTopics: %v, %v", topics, err)
+	}
+	if topics, err := graph.PublishedTopics("/other"); err != nil || len(topics) != 0 {
+		t.Errorf("PublishedTopics of another namespace: %v, %v", topics, err)
+	}
+	state, err := graph.SystemState()
+	if err != nil || !reflect.DeepEqual(state.Publishers["/ns/chatter"], []string{"/ns/talker"}) {
+		t.Errorf("SystemState: %v, %v", state, err)
+	}
+	if nodes, err := graph.Nodes(); err != nil || !reflect.DeepEqual(nodes, []string{"/ns/talker"}) {
+		t.Errorf("Nodes: %v, %v", nodes, err)
+	}
+	if _, err := graph.LookupNode("talker"); err != nil {
+		t.Error(err)
+	}
+	if _, err := graph.PingNode("talker"); err != nil {
+		t.Error(err)
+	}
+	if _, err := graph.PingNode("unknown"); err == nil {
+		t.Error("PingNode of an unknown node succeeded")
+	}
+
+	events := make(chan []GraphEvent, 10)
+	watcher := graph.Watch(10*time.Millisecond, func(e []GraphEvent) { events <- e })
+	defer watcher.Shutdown()
+	time.Sleep(50 * time.Millisecond)
+
+	listener := newTestNode(t, m, "/ns/listener")
+	listener.NewSubscriber("chatter", testMessageType{}, func(msg *testMessage) {})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		node.SpinOnce()
+		select {
+		case e := <-events:
+			expected := []GraphEvent{
+				{NodeAdded, "/ns/listener", ""},
+				{SubscriberAdded, "/ns/listener", "/ns/chatter"},
+			}
+			if !reflect.DeepEqual(e, expected) {
+				t.Errorf("expected %v but %v", expected, e)
+			}
+			listener.Shutdown()
+			// Shutting the watcher down twice is harmless.
+			watcher.Shutdown()
+			return
+		default:
+		}
+	}
+	listener.Shutdown()
+	t.Error("No graph event received")
+}
+
+func TestDiffSystemState(t *testing.T) {
+	old := &SystemState{
+		Publishers:  map[string][]string{"/a": {"/n1"}},
+		Subscribers: map[string][]string{},
+		Services:    map[string][]string{"/srv": {"/n2"}},
+	}
+	current := &SystemState{
+		Publishers:  map[string][]string{"/a": {"/n1", "/n3"}},
+		Subscribers: map[string][]string{"/a": {"/n1"}},
+		Services:    map[string][]string{},
+	}
+	expected := []GraphEvent{
+		{NodeAdded, "/n3", ""},
+		{NodeRemoved, "/n2", ""},
+		{PublisherAdded, "/n3", "/a"},
+		{SubscriberAdded, "/n1", "/a"},
+		{ServiceRemoved, "/n2", "/srv"},
+	}
+	if events := diffSystemState(old, current); !reflect.DeepEqual(events, expected) {
+		t.Errorf("expected %v but %v", expected, events)
+	}
+}
@@ -0,0 +1,204 @@
+package ros
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/rosapi"
+)
+
+// DefaultMasterCheckInterval is how often nodes check their registration to
+// the master, like the pings of rosnode.
+const DefaultMasterCheckInterval = time.Second
+
+// masterCallTimeout bounds the calls of the master monitor so that a hung
+// master is reported as lost.
+const masterCallTimeout = 5 * time.Second
+
+// maxReregistrationBackoff bounds the delay between failed re-registrations.
+const maxReregistrationBackoff = 30 * time.Second
+
+// MasterEventKind tells what happened to the master of a node.
+type MasterEventKind int
+
+const (
+	// MasterLost means that the master stopped answering.
+	MasterLost MasterEventKind = iota
+	// MasterRestarted means that the master answers but lost the
+	// registrations of the node.
+	MasterRestarted
+	// MasterReregistered means that the publishers, subscribers and services
+	// of the node were registered again.
+	MasterReregistered
+)
+
+func (k MasterEventKind) String() string {
+	switch k {
+	case MasterLost:
+		return "MasterLost"
+	case MasterRestarted:
+		return "MasterRestarted"
+	case MasterReregistered:
+		return "MasterReregistered"
+	}
+	return fmt.Sprintf("MasterEventKind(%d)", int(k))
+}
+
+// MasterEvent is a change of the connection of a node to its master.
+type MasterEvent struct {
+	Kind MasterEventKind
+	// Err is the error which revealed the loss of the master.
+	Err error
+}
+
+// monitorMaster checks the registration of the node every interval and
+// registers everything again when the master restarted.
+func (node *defaultNode) monitorMaster(interval time.Duration) {
+	defer close(node.monitorDone)
+	delay, backoff := interval, interval
+	lost, restarted := false, false
+	for {
+		select {
+		case <-node.done:
+			return
+		case <-time.After(delay):
+		}
+		delay = interval
+
+		registered, err := node.checkRegistration()
+		if err != nil {
+			if !lost {
+				lost = true
+				node.logger.Warnf("Lost the master at %s: %v", node.masterURI, err)
+				node.masterEvent(MasterEvent{Kind: MasterLost, Err: err})
+			}
+			continue
+		}
+		lost = false
+		if registered {
+			continue
+		}
+		if !restarted {
+			restarted = true
+			node.logger.Infof("The master at %s restarted", node.masterURI)
+			node.masterEvent(MasterEvent{Kind: MasterRestarted})
+		}
+		if err := node.reregister(); err != nil {
+			node.logger.Warnf("Failed to register to the master again: %v", err)
+			if backoff *= 2; backoff > maxReregistrationBackoff {
+				backoff = maxReregistrationBackoff
+			}
+			delay = backoff
+			continue
+		}
+		restarted = false
+		backoff = interval
+		node.logger.Infof("Registered to the master at %s again", node.masterURI)
+		node.masterEvent(MasterEvent{Kind: MasterReregistered})
+	}
+}
+
+// checkRegistration tells whether the master knows the node. Nodes without
+// publishers, subscribers or services are unknown to the master, so only
+// its reachability is checked for them.
+func (node *defaultNode) checkRegistration() (bool, error) {
+	node.publishersMutex.RLock()
+	node.subscribersMutex.RLock()
+	node.serversMutex.RLock()
+	empty := len(node.publishers) == 0 && len(node.subscribers) == 0 && len(node.servers) == 0
+	node.serversMutex.RUnlock()
+	node.subscribersMutex.RUnlock()
+	node.publishersMutex.RUnlock()
+
+	client := node.masterClient()
+	if empty {
+		_, err := client.GetPid()
+		return true, err
+	}
+	uri, err := client.LookupNode(node.qualifiedName)
+	if _, ok := err.(*rosapi.Error); ok {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return uri == node.xmlrpcURI, nil
+}
+
+// masterClient returns a client of the master for the monitor.
+func (node *defaultNode) masterClient() *rosapi.MasterClient {
+	client := rosapi.NewMasterClient(node.masterURI, node.qualifiedName)
+	client.Timeout = masterCallTimeout
+	return client
+}
+
+// reregister registers the publishers, subscribers and services of the node.
+func (node *defaultNode) reregister() error {
+	client := node.masterClient()
+	node.publishersMutex.RLock()
+	publishers := make(map[string]*defaultPublisher, len(node.publishers))
+	for name, pub := range node.publishers {
+		publishers[name] = pub
+	}
+	node.publishersMutex.RUnlock()
+	for name, pub := range publishers {
+		if _, err := client.RegisterPublisher(name, pub.msgType.Name(), node.xmlrpcURI); err != nil {
+			return err
+		}
+	}
+
+	node.subscribersMutex.RLock()
+	subscribers := make(map[string]*defaultSubscriber, len(node.subscribers))
+	for name, sub := range node.subscribers {
+		subscribers[name] = sub
+	}
+	node.subscribersMutex.RUnlock()
+	for name, sub := range subscribers {
+		publishers, err := client.RegisterSubscriber(name, sub.msgType.Name(), node.xmlrpcURI)
+		if err != nil {
+			return err
+		}
+		select {
+		case sub.pubListChan <- publishers:
+		default:
+			node.logger.Warnf("Publisher list of %s not updated", name)
+		}
+	}
+
+	node.serversMutex.RLock()
+	servers := make(map[string]*defaultServiceServer, len(node.servers))
+	for name, server := range node.servers {
+		servers[name] = server
+	}
+	node.serversMutex.RUnlock()
+	for name, server := range servers {
+		if err := client.RegisterService(name, server.rosrpcAddr, node.xmlrpcURI); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// masterEvent calls the master event callbacks from Spin.
+func (node *defaultNode) masterEvent(event MasterEvent) {
+	node.masterMutex.Lock()
+	callbacks := node.masterCallbacks
+	node.masterMutex.Unlock()
+	if len(callbacks) == 0 {
+		return
+	}
+	job := func() {
+		for _, callback := range callbacks {
+			callback(event)
+		}
+	}
+	select {
+	case node.jobChan <- job:
+	case <-node.done:
+	}
+}
+
+func (node *defaultNode) OnMasterEvent(callback func(event MasterEvent)) {
+	node.masterMutex.Lock()
+	defer node.masterMutex.Unlock()
+	node.masterCallbacks = append(node.masterCallbacks, callback)
+}
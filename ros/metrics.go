@@ -0,0 +1,228 @@
+package ros
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds in seconds of the buckets of the
+// latency histograms.
+var LatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Direction tells whether traffic leaves or enters a node.
+type Direction int
+
+const (
+	// Outbound is the traffic of published topics and of the service calls
+	// made by a node.
+	Outbound Direction = iota
+	// Inbound is the traffic of subscribed topics and of the service calls
+	// served by a node.
+	Inbound
+)
+
+func (d Direction) String() string {
+	if d == Inbound {
+		return "in"
+	}
+	return "out"
+}
+
+// Histogram is a snapshot of observed durations.
+type Histogram struct {
+	// Buckets are the upper bounds of the buckets in seconds and Counts the
+	// number of observations lower or equal to them, like in Prometheus.
+	Buckets []float64
+	Counts  []uint64
+	Count   uint64
+	// Sum is the sum of the observations in seconds.
+	Sum float64
+}
+
+// TopicMetrics are the counters of a topic published or subscribed by a node.
+type TopicMetrics struct {
+	Topic     string
+	Direction Direction
+	// Messages and Bytes count the messages sent to each subscriber or
+	// received from each publisher, with their size prefix.
+	Messages uint64
+	Bytes    uint64
+	// Connections is the number of connected subscribers or publishers.
+	Connections int
+	// Drops counts the messages discarded because the queue of a subscriber
+	// connection was full.
+	Drops uint64
+	// CallbackLatency is the time from the receipt of subscribed messages
+	// to the start of their callbacks.
+	CallbackLatency Histogram
+}
+
+// ServiceMetrics are the counters of a service called or served by a node.
+type ServiceMetrics struct {
+	Service   string
+	Direction Direction
+	Calls     uint64
+	Errors    uint64
+	Latency   Histogram
+}
+
+// Metrics is a snapshot of the traffic counters of a node. Counters start
+// when the node starts and keep their values when topics and services are
+// shut down.
+type Metrics struct {
+	Topics   []TopicMetrics
+	Services []ServiceMetrics
+	// SpinQueueDepth is the number of callbacks waiting for Spin.
+	SpinQueueDepth int
+}
+
+type histogram struct {
+	mutex  sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.counts == nil {
+		h.counts = make([]uint64, len(LatencyBuckets))
+	}
+	seconds := d.Seconds()
+	for i, bound := range LatencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+func (h *histogram) snapshot() Histogram {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	counts := make([]uint64, len(LatencyBuckets))
+	copy(counts, h.counts)
+	return Histogram{Buckets: LatencyBuckets, Counts: counts, Count: h.count, Sum: h.sum}
+}
+
+// topicCounters are updated atomically by the publisher sessions and the
+// subscriber links of a topic.
+type topicCounters struct {
+	messages    uint64
+	bytes       uint64
+	drops       uint64
+	connections int64
+	latency     histogram
+}
+
+func (c *topicCounters) add(size int) {
+	atomic.AddUint64(&c.messages, 1)
+	atomic.AddUint64(&c.bytes, uint64(size))
+}
+
+type serviceCounters struct {
+	calls   uint64
+	errors  uint64
+	latency histogram
+}
+
+func (c *serviceCounters) observe(d time.Duration, failed bool) {
+	atomic.AddUint64(&c.calls, 1)
+	if failed {
+		atomic.AddUint64(&c.errors, 1)
+	}
+	c.latency.observe(d)
+}
+
+type metricsKey struct {
+	name      string
+	direction Direction
+}
+
+func (k metricsKey) less(other metricsKey) bool {
+	if k.name != other.name {
+		return k.name < other.name
+	}
+	return k.direction < other.direction
+}
+
+// nodeMetrics holds the counters of the topics and services of a node.
+type nodeMetrics struct {
+	mutex    sync.Mutex
+	topics   map[metricsKey]*topicCounters
+	services map[metricsKey]*serviceCounters
+}
+
+func newNodeMetrics() *nodeMetrics {
+	return &nodeMetrics{
+		topics:   make(map[metricsKey]*topicCounters),
+		services: make(map[metricsKey]*serviceCounters),
+	}
+}
+
+func (m *nodeMetrics) topic(name string, direction Direction) *topicCounters {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := metricsKey{name, direction}
+	c, ok := m.topics[key]
+	if !ok {
+		c = new(topicCounters)
+		m.topics[key] = c
+	}
+	return c
+}
+
+func (m *nodeMetrics) service(name string, direction Direction) *serviceCounters {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	key := metricsKey{name, direction}
+	c, ok := m.services[key]
+	if !ok {
+		c = new(serviceCounters)
+		m.services[key] = c
+	}
+	return c
+}
+
+func (m *nodeMetrics) snapshot() ([]TopicMetrics, []ServiceMetrics) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var topics []TopicMetrics
+	for key, c := range m.topics {
+		topics = append(topics, TopicMetrics{
+			Topic:           key.name,
+			Direction:       key.direction,
+			Messages:        atomic.LoadUint64(&c.messages),
+			Bytes:           atomic.LoadUint64(&c.bytes),
+			Connections:     int(atomic.LoadInt64(&c.connections)),
+			Drops:           atomic.LoadUint64(&c.drops),
+			CallbackLatency: c.latency.snapshot(),
+		})
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		return metricsKey{topics[i].Topic, topics[i].Direction}.less(metricsKey{topics[j].Topic, topics[j].Direction})
+	})
+	var services []ServiceMetrics
+	for key, c := range m.services {
+		services = append(services, ServiceMetrics{
+			Service:   key.name,
+			Direction: key.direction,
+			Calls:     atomic.LoadUint64(&c.calls),
+			Errors:    atomic.LoadUint64(&c.errors),
+			Latency:   c.latency.snapshot(),
+		})
+	}
+	sort.Slice(services, func(i, j int) bool {
+		return metricsKey{services[i].Service, services[i].Direction}.less(metricsKey{services[j].Service, services[j].Direction})
+	})
+	return topics, services
+}
+
+func (node *defaultNode) Metrics() Metrics {
+	topics, services := node.metrics.snapshot()
+	return Metrics{Topics: topics, Services: services, SpinQueueDepth: len(node.jobChan)}
+}
@@ -95,6 +95,10 @@ type NameResolver struct {
 	namespace       string
 	mapping         NameMap
 	resolvedMapping NameMap
+	parent          *NameResolver
+	// named tells whether private names resolve under the node name of a
+	// child instead of in its parent.
+	named bool
 }
 
 func newNameResolver(namespace string, nodeName string, remapping NameMap) *NameResolver {
@@ -114,6 +118,28 @@ func newNameResolver(namespace string, nodeName string, remapping NameMap) *Name
 	return n
 }
 
+// newChild creates a resolver for a namespace relative to this one. Its
+// remappings are applied before the ones of its parent. Private names
+// resolve in the parent unless nodeName gives the child a name of its own.
+func (n *NameResolver) newChild(namespace string, nodeName string, remapping NameMap) *NameResolver {
+	c := new(NameResolver)
+	c.nodeName = n.nodeName
+	if len(nodeName) > 0 {
+		c.nodeName = nodeName
+		c.named = true
+	}
+	c.namespace = n.resolve(namespace)
+	c.mapping = remapping
+	c.resolvedMapping = make(NameMap)
+	c.parent = n
+
+	for k, v := range c.mapping {
+		c.resolvedMapping[c.resolve(k)] = c.resolve(v)
+	}
+
+	return c
+}
+
 // Resolve a ROS name to global name
 func (n *NameResolver) resolve(name string) string {
 	if len(name) == 0 {
@@ -124,6 +150,8 @@ func (n *NameResolver) resolve(name string) string {
 	canonName := canonicalizeName(name)
 	if isGlobalName(canonName) {
 		resolvedName = canonName
+	} else if isPrivateName(canonName) && n.parent != nil && !n.named {
+		resolvedName = n.parent.resolve(canonName)
 	} else if isPrivateName(canonName) {
 		resolvedName = canonicalizeName(n.namespace + Sep + n.nodeName + Sep + canonName[1:])
 	} else {
@@ -137,8 +165,10 @@ func (n *NameResolver) resolve(name string) string {
 func (n *NameResolver) remap(name string) string {
 	key := n.resolve(name)
 	if value, ok := n.resolvedMapping[key]; ok {
-		return value
-	} else {
-		return key
+		key = value
+	}
+	if n.parent != nil {
+		return n.parent.remap(key)
 	}
+	return key
 }
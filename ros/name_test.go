@@ -239,6 +239,41 @@ func TestNameMap5(t *testing.T) {
 	}
 }
 
+func TestChildNameResolver(t *testing.T) {
+	resolver := newNameResolver("/robot", "mynode", NameMap{"points": "/cloud", "odom": "odom_raw"})
+	child := resolver.newChild("sensors/left", "", NameMap{"scan": "points", "/robot/odom": "/odom"})
+	private := resolver.newChild("~", "", nil)
+	global := child.newChild("/arm", "", nil)
+	named := resolver.newChild("/camera", "driver", NameMap{"~mode": "mode"})
+
+	for _, c := range []struct {
+		resolver *NameResolver
+		name     string
+		want     string
+	}{
+		{child, "image", "/robot/sensors/left/image"},
+		{child, "/image", "/image"},
+		{child, "~rate", "/robot/mynode/rate"},
+		{child, "", "/robot/sensors/left"},
+		{child, "scan", "/robot/sensors/left/points"},
+		{child, "/robot/odom", "/odom"},
+		{child, "/robot/points", "/cloud"},
+		{child, "points", "/robot/sensors/left/points"},
+		{private, "rate", "/robot/mynode/rate"},
+		{private, "odom", "/robot/mynode/odom"},
+		{global, "joints", "/arm/joints"},
+		{global, "/robot/odom", "/odom"},
+		{private, "/robot/odom", "/robot/odom_raw"},
+		{named, "image", "/camera/image"},
+		{named, "~rate", "/camera/driver/rate"},
+		{named, "~mode", "/camera/mode"},
+	} {
+		if result := c.resolver.remap(c.name); result != c.want {
+			t.Errorf("%s in %s: expected %s but %s", c.name, c.resolver.namespace, c.want, result)
+		}
+	}
+}
+
 func TestGetNamespace(t *testing.T) {
 	var ns string
 	ns = getNamespace("")
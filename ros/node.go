@@ -1,12 +1,10 @@
 package ros
 
 import (
-	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"reflect"
 	"strconv"
@@ -15,6 +13,7 @@ import (
 	"time"
 
 	"github.com/fetchrobotics/rosgo/xmlrpc"
+	"github.com/fetchrobotics/rosgo/yaml"
 )
 
 const (
@@ -60,16 +59,29 @@ type defaultNode struct {
 	xmlrpcHandler    *xmlrpc.Handler
 	subscribers      map[string]*defaultSubscriber
 	subscribersMutex sync.RWMutex
+	statisticsPub    *defaultPublisher
 	publishers       map[string]*defaultPublisher
 	publishersMutex  sync.RWMutex
 	servers          map[string]*defaultServiceServer
 	serversMutex     sync.RWMutex
 	jobChan          chan func()
-	interruptChan    chan os.Signal
+	metrics          *nodeMetrics
+	signals          bool
+	clock            Clock
 	logger           Logger
 	ok               bool
 	okMutex          sync.RWMutex
 	waitGroup        sync.WaitGroup
+	shutdownTimeout  time.Duration
+	shutdownHooks    []func(ShutdownReason)
+	shutdownReason   *ShutdownReason
+	shutdownMutex    sync.Mutex
+	shutdownOnce     sync.Once
+	done             chan struct{}
+	masterInterval   time.Duration
+	masterCallbacks  []func(MasterEvent)
+	masterMutex      sync.Mutex
+	monitorDone      chan struct{}
 	logDir           string
 	hostname         string
 	listenIP         string
@@ -82,6 +94,9 @@ type defaultNode struct {
 
 func newDefaultNode(name string, args []string, opts ...NodeOption) (*defaultNode, error) {
 	node := new(defaultNode)
+	node.signals = true
+	node.shutdownTimeout = DefaultShutdownTimeout
+	node.masterInterval = DefaultMasterCheckInterval
 	for _, opt := range opts {
 		opt(node)
 	}
@@ -133,7 +148,9 @@ func newDefaultNode(name string, args []string, opts ...NodeOption) (*defaultNod
 		node.listenIP = "0.0.0.0"
 	}
 
-	node.masterURI = os.Getenv("ROS_MASTER_URI")
+	if len(node.masterURI) == 0 {
+		node.masterURI = os.Getenv("ROS_MASTER_URI")
+	}
 	if value, ok := specials["__master"]; ok {
 		node.masterURI = value
 	}
@@ -149,29 +166,29 @@ func newDefaultNode(name string, args []string, opts ...NodeOption) (*defaultNod
 	node.subscribers = make(map[string]*defaultSubscriber)
 	node.publishers = make(map[string]*defaultPublisher)
 	node.servers = make(map[string]*defaultServiceServer)
-	node.interruptChan = make(chan os.Signal)
+	node.metrics = newNodeMetrics()
 	node.ok = true
 
-	logger := NewDefaultLogger()
-	node.logger = logger
-
-	// Install signal handler
-	signal.Notify(node.interruptChan, os.Interrupt)
-	go func() {
-		<-node.interruptChan
-		logger.Info("Interrupted")
-		node.okMutex.Lock()
-		node.ok = false
-		node.okMutex.Unlock()
-	}()
+	if node.clock == nil {
+		node.clock = NewWallClock()
+	}
+	if node.logger == nil {
+		node.logger = NewDefaultLogger()
+	}
+	logger := node.logger
 
 	node.jobChan = make(chan func(), 100)
+	node.done = make(chan struct{})
 
 	logger.Debugf("Master URI = %s", node.masterURI)
 
-	// Set parameters set by arguments
+	// Set private parameters set by arguments
 	for k, v := range params {
-		_, err := callRosAPI(node.masterURI, "setParam", node.qualifiedName, k, v)
+		value, err := loadParamFromString(v)
+		if err != nil || value == nil {
+			value = v
+		}
+		_, err = callRosAPI(node.masterURI, "setParam", node.qualifiedName, node.qualifiedName+"/"+k, value)
 		if err != nil {
 			return nil, err
 		}
@@ -210,6 +227,13 @@ func newDefaultNode(name string, args []string, opts ...NodeOption) (*defaultNod
 	}
 	node.xmlrpcHandler = xmlrpc.NewHandler(m)
 	go http.Serve(node.xmlrpcListener, node.xmlrpcHandler)
+	if node.signals {
+		handleSignals(node)
+	}
+	if node.masterInterval > 0 {
+		node.monitorDone = make(chan struct{})
+		go node.monitorMaster(node.masterInterval)
+	}
 	logger.Debugf("Started %s", node.qualifiedName)
 	return node, nil
 }
@@ -234,9 +258,7 @@ func (node *defaultNode) getmasterURI(callerID string) (interface{}, error) {
 }
 
 func (node *defaultNode) shutdown(callerID string, msg string) (interface{}, error) {
-	node.okMutex.Lock()
-	node.ok = false
-	node.okMutex.Unlock()
+	node.requestShutdown(ShutdownReason{Cause: ShutdownRemote, CallerID: callerID, Message: msg})
 	return buildRosAPIResult(APIStatusSuccess, "Success", 0), nil
 }
 
@@ -261,8 +283,8 @@ func (node *defaultNode) getPublications(callerID string) (interface{}, error) {
 	defer node.publishersMutex.RUnlock()
 
 	result := []interface{}{}
-	for topic, typ := range node.publishers {
-		pair := []interface{}{topic, typ}
+	for topic, pub := range node.publishers {
+		pair := []interface{}{topic, pub.msgType.Name()}
 		result = append(result, pair)
 	}
 	return buildRosAPIResult(APIStatusSuccess, "Success", result), nil
@@ -276,7 +298,10 @@ func (node *defaultNode) publisherUpdate(callerID string, topic string, publishe
 	node.logger.Debug("Slave API publisherUpdate() called.")
 	var code int32
 	var message string
-	if sub, ok := node.subscribers[topic]; !ok {
+	node.subscribersMutex.RLock()
+	sub, ok := node.subscribers[topic]
+	node.subscribersMutex.RUnlock()
+	if !ok {
 		node.logger.Debug("publisherUpdate() called without subscribing topic.")
 		code = APIStatusFailure
 		message = "No such topic"
@@ -285,7 +310,10 @@ func (node *defaultNode) publisherUpdate(callerID string, topic string, publishe
 		for i, URI := range publishers {
 			pubURIs[i] = URI.(string)
 		}
-		sub.pubListChan <- pubURIs
+		select {
+		case sub.pubListChan <- pubURIs:
+		case <-sub.doneChan:
+		}
 		code = APIStatusSuccess
 		message = "Success"
 	}
@@ -326,17 +354,31 @@ func (node *defaultNode) requestTopic(callerID string, topic string, protocols [
 	return buildRosAPIResult(APIStatusSuccess, "Success", selectedProtocol), nil
 }
 
-func (node *defaultNode) NewPublisher(topic string, msgType MessageType) Publisher {
-	name := node.nameResolver.remap(topic)
-	return node.NewPublisherWithCallbacks(name, msgType, nil, nil)
+// PublisherOption customizes publisher instances.
+type PublisherOption func(p *defaultPublisher)
+
+// PublisherLatched makes the publisher send the last published message to
+// every newly connected subscriber.
+func PublisherLatched(latched bool) PublisherOption {
+	return func(p *defaultPublisher) {
+		p.latched = latched
+	}
+}
+
+func (node *defaultNode) NewPublisher(topic string, msgType MessageType, options ...PublisherOption) Publisher {
+	return node.NewPublisherWithCallbacks(topic, msgType, nil, nil, options...)
 }
 
-func (node *defaultNode) NewPublisherWithCallbacks(topic string, msgType MessageType, connectCallback, disconnectCallback func(SingleSubscriberPublisher)) Publisher {
+func (node *defaultNode) NewPublisherWithCallbacks(topic string, msgType MessageType, connectCallback, disconnectCallback func(SingleSubscriberPublisher), options ...PublisherOption) Publisher {
+	return &publisherHandle{defaultPublisher: node.newPublisher(node.nameResolver.remap(topic), msgType, connectCallback, disconnectCallback, options...)}
+}
+
+// newPublisher creates a publisher for a resolved topic name.
+func (node *defaultNode) newPublisher(name string, msgType MessageType, connectCallback, disconnectCallback func(SingleSubscriberPublisher), options ...PublisherOption) *defaultPublisher {
 	node.publishersMutex.Lock()
 	defer node.publishersMutex.Unlock()
 
-	name := node.nameResolver.remap(topic)
-	pub, ok := node.publishers[topic]
+	pub, ok := node.publishers[name]
 	if !ok {
 		_, err := callRosAPI(node.masterURI, "registerPublisher",
 			node.qualifiedName,
@@ -346,20 +388,51 @@ func (node *defaultNode) NewPublisherWithCallbacks(topic string, msgType Message
 			node.logger.Fatalf("Failed to call registerPublisher(): %s", err)
 		}
 
-		pub = newDefaultPublisher(node, name, msgType, connectCallback, disconnectCallback)
+		pub = newDefaultPublisher(node, name, msgType, connectCallback, disconnectCallback, options...)
 		node.publishers[name] = pub
+		node.waitGroup.Add(1)
 		go pub.start(&node.waitGroup)
 	}
+	pub.refs++
 
 	return pub
 }
 
-func (node *defaultNode) NewSubscriber(topic string, msgType MessageType, callback interface{}) Subscriber {
+// releasePublisher drops a handle of a publisher shared by child nodes and
+// shuts the publisher down with the last one. The publisher is unregistered
+// and forgotten first, so that publishing the topic again creates a new
+// publisher whose registration the old one cannot undo.
+func (node *defaultNode) releasePublisher(pub *defaultPublisher) {
+	node.publishersMutex.Lock()
+	defer node.publishersMutex.Unlock()
+	pub.refs--
+	if pub.refs > 0 {
+		return
+	}
+	delete(node.publishers, pub.topic)
+	if _, err := callRosAPI(node.masterURI, "unregisterPublisher", node.qualifiedName, pub.topic, node.xmlrpcURI); err != nil {
+		node.logger.Warn(err)
+	}
+	pub.unregistered = true
+	pub.Shutdown()
+}
+
+func (node *defaultNode) NewSubscriber(topic string, msgType MessageType, callback interface{}, options ...SubscriberOption) Subscriber {
+	sub, cb := node.newSubscriber(node.nameResolver.remap(topic), msgType, callback, options...)
+	return &subscriberHandle{defaultSubscriber: sub, node: node, callback: cb}
+}
+
+// newSubscriber creates a subscriber for a resolved topic name, or adds the
+// callback to the existing one.
+func (node *defaultNode) newSubscriber(name string, msgType MessageType, callback interface{}, options ...SubscriberOption) (*defaultSubscriber, *subscriberCallback) {
 	node.subscribersMutex.Lock()
 	defer node.subscribersMutex.Unlock()
 
-	name := node.nameResolver.remap(topic)
 	logger := node.logger
+	cb := &subscriberCallback{fn: callback}
+	for _, option := range options {
+		option(cb)
+	}
 
 	sub, ok := node.subscribers[name]
 	if !ok {
@@ -387,23 +460,74 @@ func (node *defaultNode) NewSubscriber(topic string, msgType MessageType, callba
 
 		logger.Debugf("Publisher URI list: %+v", publishers)
 
-		sub = newDefaultSubscriber(name, msgType, callback)
+		sub = newDefaultSubscriber(name, msgType, cb)
+		sub.counters = node.metrics.topic(name, Inbound)
+		sub.statistics = node.newStatistics(name)
 		node.subscribers[name] = sub
 
 		logger.Debugf("Start subscriber goroutine for topic '%s'", sub.topic)
-		go sub.start(&node.waitGroup, node.qualifiedName, node.xmlrpcURI, node.masterURI, node.jobChan, logger, func() {
-			node.subscribersMutex.Lock()
-			defer node.subscribersMutex.Unlock()
-			delete(node.subscribers, name)
-		})
+		node.waitGroup.Add(1)
+		go sub.start(&node.waitGroup, node.qualifiedName, node.xmlrpcURI, node.masterURI, node.jobChan, logger)
 		logger.Debugf("Done")
 		sub.pubListChan <- publishers
 		logger.Debugf("Update publisher list for topic '%s'", sub.topic)
 	} else {
-		sub.callbacks = append(sub.callbacks, callback)
+		sub.addCallback(cb)
+	}
+	sub.refs++
+
+	return sub, cb
+}
+
+// releaseSubscriber drops a handle of a subscriber shared by child nodes with
+// its callback and shuts the subscriber down with the last one, which is
+// unregistered and forgotten first like in releasePublisher.
+func (node *defaultNode) releaseSubscriber(sub *defaultSubscriber, callback *subscriberCallback) {
+	node.subscribersMutex.Lock()
+	defer node.subscribersMutex.Unlock()
+	sub.refs--
+	if sub.refs > 0 {
+		sub.removeCallback(callback)
+		return
+	}
+	delete(node.subscribers, sub.topic)
+	if _, err := callRosAPI(node.masterURI, "unregisterSubscriber", node.qualifiedName, sub.topic, node.xmlrpcURI); err != nil {
+		node.logger.Warn(err)
 	}
+	sub.unregistered = true
+	sub.Shutdown()
+}
+
+// publisherHandle is a handle to a publisher the node shares between the
+// handles of its topic, from the node and its children.
+type publisherHandle struct {
+	*defaultPublisher
+	once sync.Once
+}
+
+// Shutdown releases the handle. The publisher shuts down with its last
+// handle.
+func (p *publisherHandle) Shutdown() {
+	p.once.Do(func() {
+		p.node.releasePublisher(p.defaultPublisher)
+	})
+}
+
+// subscriberHandle is a handle to a subscriber the node shares between the
+// handles of its topic, from the node and its children.
+type subscriberHandle struct {
+	*defaultSubscriber
+	node     *defaultNode
+	callback *subscriberCallback
+	once     sync.Once
+}
 
-	return sub
+// Shutdown removes the callback and options of the handle and releases it.
+// The subscriber shuts down with its last handle.
+func (s *subscriberHandle) Shutdown() {
+	s.once.Do(func() {
+		s.node.releaseSubscriber(s.defaultSubscriber, s.callback)
+	})
 }
 
 // ServiceClientOption customizes service client instances.
@@ -419,12 +543,17 @@ func ServiceClientTCPTimeout(t time.Duration) ServiceClientOption {
 }
 
 func (node *defaultNode) NewServiceClient(service string, srvType ServiceType, options ...ServiceClientOption) ServiceClient {
-	name := node.nameResolver.remap(service)
+	return node.newServiceClient(node.nameResolver.remap(service), srvType, options...)
+}
+
+// newServiceClient creates a service client for a resolved service name.
+func (node *defaultNode) newServiceClient(name string, srvType ServiceType, options ...ServiceClientOption) *defaultServiceClient {
 	opts := []ServiceClientOption{}
 	opts = append(opts, node.srvClientOpts...)
 	opts = append(opts, options...)
 
 	client := newDefaultServiceClient(node.logger, node.qualifiedName, node.masterURI, name, srvType, opts...)
+	client.counters = node.metrics.service(name, Outbound)
 	return client
 }
 
@@ -441,10 +570,18 @@ func ServiceServerTCPTimeout(t time.Duration) ServiceServerOption {
 }
 
 func (node *defaultNode) NewServiceServer(service string, srvType ServiceType, handler interface{}, options ...ServiceServerOption) ServiceServer {
+	server := node.newServiceServer(node.nameResolver.remap(service), srvType, handler, options...)
+	if server == nil {
+		return nil
+	}
+	return server
+}
+
+// newServiceServer creates a service server for a resolved service name.
+func (node *defaultNode) newServiceServer(name string, srvType ServiceType, handler interface{}, options ...ServiceServerOption) *defaultServiceServer {
 	node.serversMutex.Lock()
 	defer node.serversMutex.Unlock()
 
-	name := node.nameResolver.remap(service)
 	server, ok := node.servers[name]
 	if ok {
 		server.Shutdown()
@@ -487,52 +624,143 @@ func (node *defaultNode) Spin() {
 	}
 }
 
-func (node *defaultNode) Shutdown() {
-	node.logger.Debug("Shutting node down")
+// stop records the reason of the shutdown and stops the node. It returns
+// false if the node was already stopped.
+func (node *defaultNode) stop(reason ShutdownReason) bool {
+	node.shutdownMutex.Lock()
+	defer node.shutdownMutex.Unlock()
+	if node.shutdownReason != nil {
+		return false
+	}
+	node.shutdownReason = &reason
 	node.okMutex.Lock()
 	node.ok = false
 	node.okMutex.Unlock()
+	return true
+}
+
+// requestShutdown shuts the node down in the background, e.g. on signals.
+func (node *defaultNode) requestShutdown(reason ShutdownReason) {
+	if node.stop(reason) {
+		node.logger.Infof("Shutting down: %s", reason)
+		go node.Shutdown()
+	}
+}
+
+func (node *defaultNode) Shutdown() {
+	node.stop(ShutdownReason{Cause: ShutdownRequested})
+	node.shutdownOnce.Do(node.teardown)
+}
+
+func (node *defaultNode) OnShutdown(hook func(reason ShutdownReason)) {
+	node.shutdownMutex.Lock()
+	defer node.shutdownMutex.Unlock()
+	node.shutdownHooks = append(node.shutdownHooks, hook)
+}
+
+func (node *defaultNode) ShutdownReason() *ShutdownReason {
+	node.shutdownMutex.Lock()
+	defer node.shutdownMutex.Unlock()
+	if node.shutdownReason == nil {
+		return nil
+	}
+	reason := *node.shutdownReason
+	return &reason
+}
+
+// teardown runs the shutdown hooks, then shuts down the publishers,
+// subscribers and servers, each of which stops accepting connections,
+// flushes its messages, unregisters from the master and closes its sockets.
+func (node *defaultNode) teardown() {
+	node.logger.Debug("Shutting node down")
+	deadline := time.Now().Add(node.shutdownTimeout)
+	releaseSignals(node)
+	close(node.done)
+	if node.monitorDone != nil && !waitTimeout(func() { <-node.monitorDone }, time.Until(deadline)) {
+		node.logger.Warn("Master monitor did not stop in time")
+	}
+	reason := node.ShutdownReason()
+	node.shutdownMutex.Lock()
+	hooks := node.shutdownHooks
+	node.shutdownMutex.Unlock()
+	for _, hook := range hooks {
+		hook(*reason)
+	}
 	node.logger.Debug("Shutdown subscribers")
+	node.subscribersMutex.RLock()
 	for _, s := range node.subscribers {
 		s.Shutdown()
 	}
+	node.subscribersMutex.RUnlock()
 	node.logger.Debug("Shutdown subscribers...done")
 	node.logger.Debug("Shutdown publishers")
+	node.publishersMutex.RLock()
 	for _, p := range node.publishers {
 		p.Shutdown()
 	}
+	node.publishersMutex.RUnlock()
 	node.logger.Debug("Shutdown publishers...done")
 	node.logger.Debug("Shutdown servers")
+	node.serversMutex.RLock()
 	for _, s := range node.servers {
 		s.Shutdown()
 	}
+	node.serversMutex.RUnlock()
 	node.logger.Debug("Shutdown servers...done")
 	node.logger.Debug("Wait all goroutines")
-	node.waitGroup.Wait()
+	if !waitTimeout(node.waitGroup.Wait, time.Until(deadline)) {
+		node.logger.Warnf("Shutdown timed out after %v", node.shutdownTimeout)
+	}
 	node.logger.Debug("Wait all goroutines...Done")
 	node.logger.Debug("Close XMLRPC lisetner")
 	node.xmlrpcListener.Close()
 	node.logger.Debug("Close XMLRPC done")
 	node.logger.Debug("Wait XMLRPC server shutdown")
-	node.xmlrpcHandler.WaitForShutdown()
+	if !waitTimeout(node.xmlrpcHandler.WaitForShutdown, time.Until(deadline)) {
+		node.logger.Warn("XMLRPC server did not shut down in time")
+	}
 	node.logger.Debug("Wait XMLRPC server shutdown...Done")
 	node.logger.Debug("Shutting node down completed")
-	return
+}
+
+// waitTimeout calls wait and waits at most timeout for it to return. It
+// tells whether wait returned.
+func waitTimeout(wait func(), timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
 
 func (node *defaultNode) GetParam(key string) (interface{}, error) {
-	name := node.nameResolver.remap(key)
+	return node.getParam(node.nameResolver.remap(key))
+}
+
+func (node *defaultNode) getParam(name string) (interface{}, error) {
 	return callRosAPI(node.masterURI, "getParam", node.qualifiedName, name)
 }
 
 func (node *defaultNode) SetParam(key string, value interface{}) error {
-	name := node.nameResolver.remap(key)
+	return node.setParam(node.nameResolver.remap(key), value)
+}
+
+func (node *defaultNode) setParam(name string, value interface{}) error {
 	_, e := callRosAPI(node.masterURI, "setParam", node.qualifiedName, name, value)
 	return e
 }
 
 func (node *defaultNode) HasParam(key string) (bool, error) {
-	name := node.nameResolver.remap(key)
+	return node.hasParam(node.nameResolver.remap(key))
+}
+
+func (node *defaultNode) hasParam(name string) (bool, error) {
 	result, err := callRosAPI(node.masterURI, "hasParam", node.qualifiedName, name)
 	if err != nil {
 		return false, err
@@ -542,7 +770,12 @@ func (node *defaultNode) HasParam(key string) (bool, error) {
 }
 
 func (node *defaultNode) SearchParam(key string) (string, error) {
-	result, err := callRosAPI(node.masterURI, "searchParam", node.qualifiedName, key)
+	return node.searchParam(node.qualifiedName, key)
+}
+
+// searchParam searches key upwards from the namespace of callerID.
+func (node *defaultNode) searchParam(callerID string, key string) (string, error) {
+	result, err := callRosAPI(node.masterURI, "searchParam", callerID, key)
 	if err != nil {
 		return "", err
 	}
@@ -551,11 +784,30 @@ func (node *defaultNode) SearchParam(key string) (string, error) {
 }
 
 func (node *defaultNode) DeleteParam(key string) error {
-	name := node.nameResolver.remap(key)
+	return node.deleteParam(node.nameResolver.remap(key))
+}
+
+func (node *defaultNode) deleteParam(name string) error {
 	_, err := callRosAPI(node.masterURI, "deleteParam", node.qualifiedName, name)
 	return err
 }
 
+func (node *defaultNode) NewChild(namespace string, remappings NameMap, options ...ChildOption) Node {
+	return newChildNode(node, node.nameResolver, namespace, remappings, options...)
+}
+
+func (node *defaultNode) Graph() Graph {
+	return &defaultGraph{node, node.nameResolver}
+}
+
+func (node *defaultNode) Now() Time {
+	return node.clock.Now()
+}
+
+func (node *defaultNode) Clock() Clock {
+	return node.clock
+}
+
 func (node *defaultNode) Logger() Logger {
 	return node.logger
 }
@@ -568,12 +820,8 @@ func (node *defaultNode) Name() string {
 	return node.name
 }
 
+// loadParamFromString decodes the YAML value of a private parameter given as
+// a _name:=value argument.
 func loadParamFromString(s string) (interface{}, error) {
-	decoder := json.NewDecoder(strings.NewReader(s))
-	var value interface{}
-	err := decoder.Decode(&value)
-	if err != nil {
-		return nil, err
-	}
-	return value, err
+	return yaml.Unmarshal([]byte(s))
 }
@@ -1,19 +1,840 @@
 package ros
 
 import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/rosapi"
 )
 
-func TestLoadJsonFromString(t *testing.T) {
-	value, err := loadParamFromString("42")
+func TestLoadParamFromString(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want interface{}
+	}{
+		{"42", 42},
+		{"4.5", 4.5},
+		{"true", true},
+		{"hello", "hello"},
+		{"[1, 2.5, a]", []interface{}{1, 2.5, "a"}},
+		{"{p: 1.0, name: arm}", map[string]interface{}{"p": 1.0, "name": "arm"}},
+	} {
+		value, err := loadParamFromString(tc.text)
+		if err != nil {
+			t.Errorf("%s: %v", tc.text, err)
+		} else if !reflect.DeepEqual(value, tc.want) {
+			t.Errorf("%s: expected %#v but %#v", tc.text, tc.want, value)
+		}
+	}
+}
+
+func TestNodeParams(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0", master.InitialParams([]byte("rosdistro: noetic\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	node, err := NewNode("/ns/test_params", []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"})
 	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+
+	if hasParam, err := node.HasParam("/rosdistro"); err != nil || !hasParam {
+		t.Errorf("HasParam failed: %v %v", hasParam, err)
+	}
+	if foundKey, err := node.SearchParam("rosdistro"); err != nil || foundKey != "/rosdistro" {
+		t.Errorf("SearchParam failed: %v %v", foundKey, err)
+	}
+
+	if err := node.SetParam("~rate", 42); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := node.GetParam("/ns/test_params/rate"); err != nil || value != int32(42) {
+		t.Errorf("GetParam failed: %v %v", value, err)
+	}
+	if err := node.SetParam("gains", map[string]interface{}{"p": 1.0, "i": 0.5}); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := node.GetParam("/ns/gains/i"); err != nil || value != 0.5 {
+		t.Errorf("GetParam failed: %v %v", value, err)
+	}
+
+	if err := node.DeleteParam("gains"); err != nil {
 		t.Error(err)
 	}
-	i, ok := value.(float64)
-	if !ok {
-		t.Fail()
+	if hasParam, err := node.HasParam("gains/p"); err != nil || hasParam {
+		t.Errorf("HasParam after DeleteParam: %v %v", hasParam, err)
+	}
+	if _, err := node.GetParam("gains"); err == nil {
+		t.Error("GetParam for a deleted parameter succeeded")
+	}
+}
+
+func TestNodePrivateArgs(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	node, err := NewNode("/ns/test_args", []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1",
+		"_rate:=10", "_frame:=base_link", "_gains:={p: 1.5, i: 0}", "_joints:=[a, b]", "_empty:="})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+
+	for name, want := range map[string]interface{}{
+		"~rate":    int32(10),
+		"~frame":   "base_link",
+		"~gains":   map[string]interface{}{"p": 1.5, "i": int32(0)},
+		"~joints":  []interface{}{"a", "b"},
+		"~empty":   "",
+		"~gains/p": 1.5,
+	} {
+		if value, err := node.GetParam(name); err != nil || !reflect.DeepEqual(value, want) {
+			t.Errorf("%s: expected %#v but %#v, %v", name, want, value, err)
+		}
+	}
+	if hasParam, _ := node.HasParam("/ns/rate"); hasParam {
+		t.Error("a private argument was set outside of the private namespace")
+	}
+}
+
+func TestChildNode(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	node, err := NewNode("/ns/test_child", []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1", "image:=camera/image"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+
+	child := node.NewChild("sensors/left", NameMap{"scan": "points"})
+	child.NewPublisher("image", testMessageType{})
+	child.NewPublisher("scan", testMessageType{})
+	node.NewPublisher("image", testMessageType{})
+	topics := func() []TopicInfo {
+		topics, err := node.Graph().PublishedTopics("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+		return topics
+	}
+	want := []TopicInfo{
+		{Name: "/ns/camera/image", Type: "test_msgs/Bytes"},
+		{Name: "/ns/sensors/left/image", Type: "test_msgs/Bytes"},
+		{Name: "/ns/sensors/left/points", Type: "test_msgs/Bytes"},
+	}
+	if got := topics(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected the topics %v but %v", want, got)
+	}
+
+	if err := child.SetParam("rate", 5); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := node.GetParam("sensors/left/rate"); err != nil || value != int32(5) {
+		t.Errorf("unexpected parameter %v, %v", value, err)
+	}
+	if err := node.NewChild("~", nil).SetParam("gain", 1.5); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := child.GetParam("~gain"); err != nil || value != 1.5 {
+		t.Errorf("unexpected private parameter %v, %v", value, err)
+	}
+	if err := node.SetParam("sensors/frame", "base"); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := child.SearchParam("frame"); err != nil || found != "/ns/sensors/frame" {
+		t.Errorf("unexpected search result %v, %v", found, err)
+	}
+
+	child.Shutdown()
+	for deadline := time.Now().Add(5 * time.Second); len(topics()) != 1; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("the publishers of the child were not shut down: %v", topics())
+		}
+	}
+	if !node.OK() {
+		t.Error("shutting a child down shut the node down")
+	}
+}
+
+func TestChildNodeSharedTopics(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	node := newTestNode(t, m, "/node")
+	defer node.Shutdown()
+	go node.Spin()
+
+	first, second := node.NewChild("first", nil), node.NewChild("second", nil)
+	pub := node.NewPublisher("/chatter", testMessageType{})
+	first.NewPublisher("/chatter", testMessageType{})
+	received := make(chan string, 100)
+	statuses := make(chan string, 100)
+	first.NewSubscriber("/chatter", testMessageType{}, func(*testMessage) { received <- "first" },
+		SubscriberStatusCallback(func(SubscriberStatus) { statuses <- "first" }))
+	second.NewSubscriber("/chatter", testMessageType{}, func(*testMessage) { received <- "second" })
+	// Handles of the node are released like those of the children, without
+	// taking the topic away from them.
+	node.NewPublisher("/chatter", testMessageType{}).Shutdown()
+	node.NewSubscriber("/chatter", testMessageType{}, func(*testMessage) { received <- "node" },
+		SubscriberStatusCallback(func(SubscriberStatus) { statuses <- "node" })).Shutdown()
+
+	registrations := func() (publishers, subscribers []string) {
+		state, err := rosapi.NewMasterClient(m.URI(), "/test").GetSystemState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state.Publishers["/chatter"], state.Subscribers["/chatter"]
+	}
+	// expect publishes until only the callbacks of want are called.
+	expect := func(want string) {
+		deadline := time.Now().Add(5 * time.Second)
+		var got map[string]bool
+		for time.Now().Before(deadline) {
+			pub.Publish(&testMessage{data: []byte{1}})
+			time.Sleep(50 * time.Millisecond)
+			got = map[string]bool{}
+			for len(received) > 0 {
+				got[<-received] = true
+			}
+			if len(got) == 1 && got[want] {
+				return
+			}
+		}
+		t.Fatalf("the messages were not received by %s only but %v", want, got)
+	}
+
+	first.Shutdown()
+	expect("second")
+	if publishers, subscribers := registrations(); len(publishers) != 1 || len(subscribers) != 1 {
+		t.Errorf("the topic was taken away from the node: %v, %v", publishers, subscribers)
+	}
+	// The status callbacks went away with their handles.
+	for len(statuses) > 0 {
+		<-statuses
+	}
+	other := newTestNode(t, m, "/other")
+	other.NewPublisher("/chatter", testMessageType{})
+	time.Sleep(200 * time.Millisecond)
+	other.Shutdown()
+	if len(statuses) > 0 {
+		t.Errorf("unexpected status of the handle %s", <-statuses)
+	}
+
+	// The subscriber shuts down with its last callback.
+	second.Shutdown()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		publishers, subscribers := registrations()
+		if len(publishers) == 1 && len(subscribers) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected registrations %v, %v", publishers, subscribers)
+		}
+	}
+}
+
+func TestChildNodeRecreatedTopics(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	node := newTestNode(t, m, "/node")
+	defer node.Shutdown()
+	listener := newTestNode(t, m, "/listener")
+	defer listener.Shutdown()
+	go node.Spin()
+	go listener.Spin()
+	received := make(chan struct{}, 100)
+	listener.NewSubscriber("/chatter", testMessageType{}, func(*testMessage) { received <- struct{}{} })
+
+	// expect publishes until a message is received.
+	expect := func(pub Publisher, topic string) {
+		for len(received) > 0 {
+			<-received
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			pub.Publish(&testMessage{data: []byte{1}})
+			select {
+			case <-received:
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		t.Fatalf("no message was received on %s", topic)
+	}
+
+	first := node.NewChild("first", nil)
+	expect(first.NewPublisher("/chatter", testMessageType{}), "the topic of the first child")
+	first.Shutdown()
+	// Messages of the first publisher may still arrive.
+	time.Sleep(100 * time.Millisecond)
+	second := node.NewChild("second", nil)
+	defer second.Shutdown()
+	expect(second.NewPublisher("/chatter", testMessageType{}), "the topic published again")
+
+	// A subscription created again gets the messages too.
+	first = node.NewChild("first", nil)
+	first.NewSubscriber("/echo", testMessageType{}, func(*testMessage) {})
+	first.Shutdown()
+	echoes := make(chan struct{}, 100)
+	second.NewSubscriber("/echo", testMessageType{}, func(*testMessage) { echoes <- struct{}{} })
+	echo := listener.NewPublisher("/echo", testMessageType{})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(echoes) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no message was received on the subscription created again")
+		}
+		echo.Publish(&testMessage{data: []byte{1}})
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+type testLogger struct {
+	*defaultLogger
+	mutex sync.Mutex
+	infos []string
+}
+
+func (l *testLogger) Info(v ...interface{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.infos = append(l.infos, fmt.Sprint(v...))
+}
+
+func (l *testLogger) Infof(format string, v ...interface{}) {
+	l.Info(fmt.Sprintf(format, v...))
+}
+
+func TestMultipleNodes(t *testing.T) {
+	m1, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m1.Shutdown()
+	m2, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m2.Shutdown()
+
+	clock := NewSimClock(NewTime(100, 0))
+	logger := &testLogger{defaultLogger: NewDefaultLogger()}
+	args := []string{"__hostname:=127.0.0.1"}
+	driver, err := NewNode("/robot1/driver", args, NodeMasterURI(m1.URI()), NodeClock(clock), NodeLogger(logger), NodeSignalHandling(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer driver.Shutdown()
+	planner, err := NewNode("/robot1/planner", args, NodeMasterURI(m1.URI()), NodeSignalHandling(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer planner.Shutdown()
+	other, err := NewNode("/robot2/driver", args, NodeMasterURI(m2.URI()), NodeSignalHandling(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Shutdown()
+
+	if now := driver.Now(); now != NewTime(100, 0) {
+		t.Errorf("expected the time of the simulated clock but %v", now)
+	}
+	clock.Set(NewTime(101, 5))
+	if now := driver.Now(); now != NewTime(101, 5) {
+		t.Errorf("expected the time of the simulated clock but %v", now)
+	}
+	if driver.Clock() != clock {
+		t.Error("expected the clock of the node")
+	}
+	if now := planner.Now(); now.Sec < 1000000000 {
+		t.Errorf("expected the wall time but %v", now)
+	}
+	if driver.Logger() != logger || planner.Logger() == other.Logger() {
+		t.Error("expected each node to have its own logger")
+	}
+
+	pub := driver.NewPublisher("odom", testMessageType{})
+	other.NewPublisher("odom", testMessageType{})
+	received := make(chan []byte, 10)
+	planner.NewSubscriber("odom", testMessageType{}, func(msg *testMessage) {
+		received <- msg.data
+	})
+	spinning := make(chan struct{})
+	go func() {
+		defer close(spinning)
+		planner.Spin()
+	}()
+	timeout := time.After(5 * time.Second)
+	for done := false; !done; {
+		pub.Publish(&testMessage{data: []byte{42}})
+		select {
+		case data := <-received:
+			if !bytes.Equal(data, []byte{42}) {
+				t.Errorf("unexpected message %v", data)
+			}
+			done = true
+		case <-time.After(50 * time.Millisecond):
+		case <-timeout:
+			t.Fatal("the message was not received")
+		}
+	}
+
+	for _, c := range []struct {
+		node Node
+		want []TopicInfo
+	}{
+		{planner, []TopicInfo{{Name: "/robot1/odom", Type: "test_msgs/Bytes"}}},
+		{other, []TopicInfo{{Name: "/robot2/odom", Type: "test_msgs/Bytes"}}},
+	} {
+		if topics, err := c.node.Graph().PublishedTopics(""); err != nil || !reflect.DeepEqual(topics, c.want) {
+			t.Errorf("%s: expected the topics %v but %v, %v", c.node.Name(), c.want, topics, err)
+		}
+	}
+
+	driver.Shutdown()
+	if !planner.OK() || !other.OK() {
+		t.Error("shutting a node down stopped the other nodes")
+	}
+	if topics, err := planner.Graph().PublishedTopics(""); err != nil || len(topics) != 0 {
+		t.Errorf("expected the publisher to be unregistered but %v, %v", topics, err)
+	}
+	planner.Shutdown()
+	<-spinning
+}
+
+func TestNodeSignals(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	logger := &testLogger{defaultLogger: NewDefaultLogger()}
+	handling, err := NewNode("/handling", []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}, NodeLogger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handling.Shutdown()
+	ignoring, err := NewNode("/ignoring", []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}, NodeSignalHandling(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ignoring.Shutdown()
+
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(os.Interrupt); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); handling.OK(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("the node was not interrupted")
+		}
+	}
+	if !ignoring.OK() || ignoring.ShutdownReason() != nil {
+		t.Error("a node not handling signals was interrupted")
+	}
+	if reason := handling.ShutdownReason(); reason == nil || reason.Cause != ShutdownInterrupted {
+		t.Errorf("unexpected shutdown reason %v", reason)
+	}
+	logger.mutex.Lock()
+	if !reflect.DeepEqual(logger.infos, []string{"Shutting down: interrupted"}) {
+		t.Errorf("unexpected logs %v", logger.infos)
+	}
+	logger.mutex.Unlock()
+
+	handling.Shutdown()
+	signalHandler.mutex.Lock()
+	if signalHandler.signalChan != nil {
+		t.Error("the signal handler was not removed with the last node")
+	}
+	signalHandler.mutex.Unlock()
+}
+
+func TestNodeShutdown(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	talker := newTestNode(t, m, "/talker")
+	defer talker.Shutdown()
+	listener := newTestNode(t, m, "/listener")
+	defer listener.Shutdown()
+
+	var hooks []string
+	talker.OnShutdown(func(reason ShutdownReason) {
+		hooks = append(hooks, "first: "+reason.String())
+	})
+	talker.OnShutdown(func(reason ShutdownReason) {
+		hooks = append(hooks, "second")
+	})
+
+	connected := make(chan struct{}, 1)
+	pub := talker.NewPublisherWithCallbacks("chatter", testMessageType{}, func(SingleSubscriberPublisher) {
+		connected <- struct{}{}
+	}, nil)
+	received := make(chan byte, 10)
+	listener.NewSubscriber("chatter", testMessageType{}, func(msg *testMessage) {
+		received <- msg.data[0]
+	})
+	go listener.Spin()
+	select {
+	case <-connected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the subscriber did not connect")
+	}
+
+	// The messages published before the shutdown are delivered.
+	for i := byte(0); i < 5; i++ {
+		pub.Publish(&testMessage{data: []byte{i}})
+	}
+	uri, err := talker.Graph().LookupNode("/talker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rosapi.NewSlaveClient(uri, "/killer").Shutdown("user request"); err != nil {
+		t.Fatal(err)
+	}
+	talker.Shutdown()
+	// The sessions were flushed by the shutdown.
+	if metrics := talker.Metrics(); len(metrics.Topics) != 1 || metrics.Topics[0].Messages != 5 {
+		t.Errorf("the messages were not sent during the shutdown: %+v", metrics.Topics)
+	}
+	for i := byte(0); i < 5; i++ {
+		select {
+		case data := <-received:
+			if data != i {
+				t.Errorf("expected the message %d but %d", i, data)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the message %d was not delivered", i)
+		}
+	}
+
+	want := ShutdownReason{Cause: ShutdownRemote, CallerID: "/killer", Message: "user request"}
+	if reason := talker.ShutdownReason(); reason == nil || *reason != want {
+		t.Errorf("expected the shutdown reason %v but %v", want, reason)
+	}
+	if want := []string{"first: shutdown requested by /killer: user request", "second"}; !reflect.DeepEqual(hooks, want) {
+		t.Errorf("expected the hooks %v but %v", want, hooks)
+	}
+	if topics, err := listener.Graph().PublishedTopics(""); err != nil || len(topics) != 0 {
+		t.Errorf("expected the publisher to be unregistered but %v, %v", topics, err)
+	}
+	if listener.ShutdownReason() != nil {
+		t.Error("a running node has a shutdown reason")
+	}
+	listener.Shutdown()
+	if reason := listener.ShutdownReason(); reason == nil || reason.Cause != ShutdownRequested {
+		t.Errorf("unexpected shutdown reason %v", reason)
+	}
+}
+
+type testServiceType struct{}
+
+func (t testServiceType) MD5Sum() string            { return "c3a8f5ad9ab3f8ef2b1ba8ae1ae7f9d7" }
+func (t testServiceType) Name() string              { return "test_msgs/Echo" }
+func (t testServiceType) RequestType() MessageType  { return testMessageType{} }
+func (t testServiceType) ResponseType() MessageType { return testMessageType{} }
+func (t testServiceType) NewService() Service {
+	return &testService{&testMessage{}, &testMessage{}}
+}
+
+type testService struct {
+	req, res *testMessage
+}
+
+func (s *testService) ReqMessage() Message { return s.req }
+func (s *testService) ResMessage() Message { return s.res }
+
+func TestMasterRestart(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(m.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := "127.0.0.1:" + u.Port()
+
+	node, err := NewNode("/restarted", []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"},
+		NodeMasterCheckInterval(20*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := make(chan MasterEventKind, 10)
+	node.OnMasterEvent(func(event MasterEvent) {
+		events <- event.Kind
+	})
+	node.NewPublisher("chatter", testMessageType{})
+	node.NewSubscriber("echo", testMessageType{}, func(*testMessage) {})
+	node.NewServiceServer("reset", testServiceType{}, func(*testService) error { return nil })
+	// Nodes check the master by default unless the interval is zero.
+	defaulted := newTestNode(t, m, "/defaulted")
+	defer defaulted.Shutdown()
+	defaulted.NewPublisher("defaulted", testMessageType{})
+	unmonitored, err := NewNode("/unmonitored", []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"},
+		NodeMasterCheckInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unmonitored.Shutdown()
+	unmonitored.NewPublisher("unmonitored", testMessageType{})
+	spinning := make(chan struct{})
+	go func() {
+		defer close(spinning)
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		<-spinning
+	}()
+
+	expect := func(want MasterEventKind) {
+		select {
+		case kind := <-events:
+			if kind != want {
+				t.Fatalf("expected the event %v but %v", want, kind)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the event %v was not raised", want)
+		}
+	}
+	m.Shutdown()
+	expect(MasterLost)
+	m, err = master.NewMaster(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	expect(MasterRestarted)
+	expect(MasterReregistered)
+
+	state, err := rosapi.NewMasterClient(m.URI(), "/test").GetSystemState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		registrations map[string][]string
+		name          string
+	}{
+		{state.Publishers, "/chatter"},
+		{state.Subscribers, "/echo"},
+		{state.Services, "/reset"},
+	} {
+		if !reflect.DeepEqual(c.registrations[c.name], []string{"/restarted"}) {
+			t.Errorf("%s was not registered again: %v", c.name, c.registrations)
+		}
+	}
+	select {
+	case kind := <-events:
+		t.Errorf("unexpected event %v", kind)
+	case <-time.After(100 * time.Millisecond):
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(state.Publishers["/defaulted"]) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("/defaulted was not registered again: %v", state.Publishers)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if state, err = rosapi.NewMasterClient(m.URI(), "/test").GetSystemState(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if publishers := state.Publishers["/unmonitored"]; len(publishers) != 0 {
+		t.Errorf("/unmonitored was registered again: %v", publishers)
+	}
+
+}
+
+func TestSubscriberReconnect(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	talker := newTestNode(t, m, "/talker")
+	defer talker.Shutdown()
+	listener := newTestNode(t, m, "/listener")
+	defer listener.Shutdown()
+
+	pub := talker.NewPublisher("chatter", testMessageType{})
+	received := make(chan byte, 10)
+	statuses := make(chan SubscriberStatus, 10)
+	listener.NewSubscriber("chatter", testMessageType{}, func(msg *testMessage) {
+		received <- msg.data[0]
+	}, SubscriberStatusCallback(func(status SubscriberStatus) {
+		statuses <- status
+	}))
+	go listener.Spin()
+
+	next := func() SubscriberStatus {
+		select {
+		case status := <-statuses:
+			return status
+		case <-time.After(5 * time.Second):
+			t.Fatal("no subscriber status")
+		}
+		return SubscriberStatus{}
+	}
+	talkerURI, err := talker.Graph().LookupNode("/talker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := next(); !status.Connected || status.Publisher != talkerURI || status.Topic != "/chatter" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// A publisher which cannot be reached is retried without affecting the others.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadURI := "http://" + l.Addr().String() + "/"
+	l.Close()
+	listenerURI, err := listener.Graph().LookupNode("/listener")
+	if err != nil {
+		t.Fatal(err)
+	}
+	slave := rosapi.NewSlaveClient(listenerURI, "/master")
+	if err := slave.PublisherUpdate("/chatter", []string{talkerURI, deadURI}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if status := next(); status.Connected || status.Publisher != deadURI || status.Err == nil {
+			t.Fatalf("unexpected status %+v", status)
+		}
+	}
+	pub.Publish(&testMessage{data: []byte{1}})
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message was not delivered")
+	}
+
+	// Publishers which are not registered any more are not retried.
+	if err := slave.PublisherUpdate("/chatter", []string{talkerURI}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	for len(statuses) > 0 {
+		<-statuses
+	}
+	select {
+	case status := <-statuses:
+		t.Errorf("unexpected status %+v", status)
+	case <-time.After(time.Second):
+	}
+}
+
+func TestNodeMetrics(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	talker := newTestNode(t, m, "/talker")
+	defer talker.Shutdown()
+	listener := newTestNode(t, m, "/listener")
+	defer listener.Shutdown()
+
+	pub := talker.NewPublisher("chatter", testMessageType{}, PublisherLatched(true))
+	received := make(chan struct{}, 1)
+	listener.NewSubscriber("chatter", testMessageType{}, func(*testMessage) {
+		received <- struct{}{}
+	})
+	talker.NewServiceServer("echo", testServiceType{}, func(srv *testService) error {
+		if len(srv.req.data) == 0 {
+			return fmt.Errorf("empty request")
+		}
+		srv.res.data = srv.req.data
+		return nil
+	})
+	go talker.Spin()
+	go listener.Spin()
+
+	pub.Publish(&testMessage{data: []byte{1, 2, 3}})
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the message was not received")
+	}
+	client := listener.NewServiceClient("echo", testServiceType{}, ServiceClientTCPTimeout(time.Second))
+	if err := client.Call(&testService{&testMessage{data: []byte{1}}, &testMessage{}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Call(&testService{&testMessage{}, &testMessage{}}); err == nil {
+		t.Fatal("the empty request did not fail")
+	}
+
+	// The counters of the talker are updated after the messages and the
+	// responses are written.
+	deadline := time.Now().Add(5 * time.Second)
+	var topics []TopicMetrics
+	var services []ServiceMetrics
+	for time.Now().Before(deadline) {
+		metrics := talker.Metrics()
+		topics, services = metrics.Topics, metrics.Services
+		if len(topics) == 1 && topics[0].Messages == 1 && len(services) == 1 && services[0].Calls == 2 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Messages are counted with their size prefix.
+	want := TopicMetrics{Topic: "/chatter", Direction: Outbound, Messages: 1, Bytes: 7, Connections: 1}
+	if len(topics) != 1 {
+		t.Fatalf("unexpected topics %+v", topics)
+	}
+	if topics[0].CallbackLatency.Count != 0 {
+		t.Errorf("a publisher has callback latencies %+v", topics[0].CallbackLatency)
+	}
+	topics[0].CallbackLatency = Histogram{}
+	if !reflect.DeepEqual(topics[0], want) {
+		t.Errorf("expected %+v but %+v", want, topics[0])
+	}
+	if len(services) != 1 || services[0].Service != "/echo" || services[0].Direction != Inbound ||
+		services[0].Calls != 2 || services[0].Errors != 1 || services[0].Latency.Count != 2 {
+		t.Errorf("unexpected services %+v", services)
+	}
+
+	metrics := listener.Metrics()
+	if len(metrics.Topics) != 1 || metrics.Topics[0].Direction != Inbound || metrics.Topics[0].Messages != 1 ||
+		metrics.Topics[0].Bytes != 7 || metrics.Topics[0].CallbackLatency.Count != 1 {
+		t.Errorf("unexpected topics %+v", metrics.Topics)
 	}
-	if i != 42.0 {
-		t.Error(i)
+	if len(metrics.Services) != 1 || metrics.Services[0].Direction != Outbound ||
+		metrics.Services[0].Calls != 2 || metrics.Services[0].Errors != 1 {
+		t.Errorf("unexpected services %+v", metrics.Services)
 	}
 }
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -30,21 +31,37 @@ type defaultPublisher struct {
 	sesssionIDCount    int
 	sessions           map[int]*remoteSubscriberSession
 	sessionChan        chan *remoteSubscriberSession
+	sessionGroup       sync.WaitGroup
 	sessionErrorChan   chan error
 	listenerErrorChan  chan error
 	listener           net.Listener
 	connectCallback    func(SingleSubscriberPublisher)
 	disconnectCallback func(SingleSubscriberPublisher)
+	latched            bool
+	lastMsg            []byte
+	counters           *topicCounters
+	// refs counts the handles given by the node, guarded by its publishers
+	// mutex.
+	refs int
+	// unregistered tells that the node already unregistered the publisher
+	// from the master before shutting it down.
+	unregistered bool
+	doneChan     chan struct{}
 }
 
 func newDefaultPublisher(node *defaultNode,
 	topic string, msgType MessageType,
-	connectCallback, disconnectCallback func(SingleSubscriberPublisher)) *defaultPublisher {
+	connectCallback, disconnectCallback func(SingleSubscriberPublisher),
+	options ...PublisherOption) *defaultPublisher {
 	pub := new(defaultPublisher)
+	for _, opt := range options {
+		opt(pub)
+	}
 	pub.node = node
 	pub.topic = topic
 	pub.msgType = msgType
 	pub.shutdownChan = make(chan struct{}, 10)
+	pub.doneChan = make(chan struct{})
 	pub.sessions = make(map[int]*remoteSubscriberSession)
 	pub.msgChan = make(chan []byte, 10)
 	pub.listenerErrorChan = make(chan error, 10)
@@ -52,6 +69,7 @@ func newDefaultPublisher(node *defaultNode,
 	pub.sessionErrorChan = make(chan error, 10)
 	pub.connectCallback = connectCallback
 	pub.disconnectCallback = disconnectCallback
+	pub.counters = node.metrics.topic(topic, Outbound)
 	if listener, err := net.Listen("tcp", ":0"); err != nil {
 		panic(err)
 	} else {
@@ -63,9 +81,9 @@ func newDefaultPublisher(node *defaultNode,
 func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
 	logger := pub.node.logger
 	logger.Debugf("Publisher goroutine for %s started.", pub.topic)
-	wg.Add(1)
 	defer func() {
 		logger.Debug("defaultPublisher.start exit")
+		close(pub.doneChan)
 		wg.Done()
 	}()
 
@@ -76,6 +94,9 @@ func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
 		select {
 		case msg := <-pub.msgChan:
 			logger.Debug("Receive msgChan")
+			if pub.latched {
+				pub.lastMsg = msg
+			}
 			for _, s := range pub.sessions {
 				session := s
 				session.msgChan <- msg
@@ -88,7 +109,14 @@ func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
 
 		case s := <-pub.sessionChan:
 			pub.sessions[s.id] = s
-			go s.start()
+			pub.sessionGroup.Add(1)
+			go func() {
+				defer pub.sessionGroup.Done()
+				s.start()
+			}()
+			if pub.lastMsg != nil {
+				s.msgChan <- pub.lastMsg
+			}
 
 		case err := <-pub.sessionErrorChan:
 			logger.Error(err)
@@ -101,15 +129,51 @@ func (pub *defaultPublisher) start(wg *sync.WaitGroup) {
 			logger.Debug("defaultPublisher.start Receive shutdownChan")
 			pub.listener.Close()
 			logger.Debug("defaultPublisher.start closed listener")
-			_, err := callRosAPI(pub.node.masterURI, "unregisterPublisher", pub.node.qualifiedName, pub.topic, pub.node.xmlrpcURI)
-			if err != nil {
-				logger.Warn(err)
+			// Messages published before the shutdown are still sent.
+			for flushed := false; !flushed; {
+				select {
+				case msg := <-pub.msgChan:
+					for _, s := range pub.sessions {
+						s.msgChan <- msg
+					}
+				default:
+					flushed = true
+				}
+			}
+			if !pub.unregistered {
+				_, err := callRosAPI(pub.node.masterURI, "unregisterPublisher", pub.node.qualifiedName, pub.topic, pub.node.xmlrpcURI)
+				if err != nil {
+					logger.Warn(err)
+				}
 			}
 
 			for id, s := range pub.sessions {
-				s.quitChan <- struct{}{}
+				close(s.quitChan)
 				delete(pub.sessions, id)
 			}
+			pub.waitSessions()
+			return
+		}
+	}
+}
+
+// waitSessions waits for the sessions to flush their queues and close,
+// at most for the shutdown timeout of the node.
+func (pub *defaultPublisher) waitSessions() {
+	done := make(chan struct{})
+	go func() {
+		pub.sessionGroup.Wait()
+		close(done)
+	}()
+	timeout := time.After(pub.node.shutdownTimeout)
+	for {
+		select {
+		case <-done:
+			return
+		case <-pub.sessionErrorChan:
+			// Closing sessions report their exit.
+		case <-timeout:
+			pub.node.logger.Warnf("Subscribers of %s were not flushed in time", pub.topic)
 			return
 		}
 	}
@@ -144,7 +208,11 @@ func (pub *defaultPublisher) listenRemoteSubscriber() {
 func (pub *defaultPublisher) Publish(msg Message) {
 	var buf bytes.Buffer
 	_ = msg.Serialize(&buf)
-	pub.msgChan <- buf.Bytes()
+	// Messages published after the shutdown are dropped.
+	select {
+	case pub.msgChan <- buf.Bytes():
+	case <-pub.doneChan:
+	}
 }
 
 func (pub *defaultPublisher) GetNumSubscribers() int {
@@ -173,6 +241,7 @@ type remoteSubscriberSession struct {
 	typeText           string
 	md5sum             string
 	typeName           string
+	latched            bool
 	sizeBytesSent      uint32
 	msgBytesSent       uint32
 	numSent            int64
@@ -182,6 +251,7 @@ type remoteSubscriberSession struct {
 	logger             Logger
 	connectCallback    func(SingleSubscriberPublisher)
 	disconnectCallback func(SingleSubscriberPublisher)
+	counters           *topicCounters
 }
 
 func newRemoteSubscriberSession(pub *defaultPublisher, id int, conn net.Conn) *remoteSubscriberSession {
@@ -193,6 +263,7 @@ func newRemoteSubscriberSession(pub *defaultPublisher, id int, conn net.Conn) *r
 	session.typeText = pub.msgType.Text()
 	session.md5sum = pub.msgType.MD5Sum()
 	session.typeName = pub.msgType.Name()
+	session.latched = pub.latched
 	session.sizeBytesSent = 0
 	session.msgBytesSent = 0
 	session.numSent = 0
@@ -202,6 +273,7 @@ func newRemoteSubscriberSession(pub *defaultPublisher, id int, conn net.Conn) *r
 	session.logger = pub.node.logger
 	session.connectCallback = pub.connectCallback
 	session.disconnectCallback = pub.disconnectCallback
+	session.counters = pub.counters
 	return session
 }
 
@@ -237,6 +309,7 @@ func (session *remoteSubscriberSession) start() {
 
 	defer func() {
 		logger.Debug("remoteSubscriberSession.start exit")
+		session.conn.Close()
 
 		if session.disconnectCallback != nil {
 			session.disconnectCallback(ssp)
@@ -286,7 +359,11 @@ func (session *remoteSubscriberSession) start() {
 	var resHeaders []header
 	resHeaders = append(resHeaders, header{"message_definition", session.typeText})
 	resHeaders = append(resHeaders, header{"callerid", session.nodeID})
-	resHeaders = append(resHeaders, header{"latching", "0"})
+	if session.latched {
+		resHeaders = append(resHeaders, header{"latching", "1"})
+	} else {
+		resHeaders = append(resHeaders, header{"latching", "0"})
+	}
 	resHeaders = append(resHeaders, header{"md5sum", session.md5sum})
 	resHeaders = append(resHeaders, header{"topic", session.topic})
 	resHeaders = append(resHeaders, header{"type", session.typeName})
@@ -298,6 +375,8 @@ func (session *remoteSubscriberSession) start() {
 	if err != nil {
 		panic(errors.New("failed to write response header"))
 	}
+	atomic.AddInt64(&session.counters.connections, 1)
+	defer atomic.AddInt64(&session.counters.connections, -1)
 
 	// 3. Start sending message
 	logger.Debug("Start sending messages...")
@@ -310,19 +389,29 @@ func (session *remoteSubscriberSession) start() {
 			logger.Debug("Receive msgChan")
 			if len(queue) == queueMaxSize {
 				<-queue
+				atomic.AddUint64(&session.counters.drops, 1)
 			}
 			queue <- msg
 
 		case <-session.quitChan:
 			logger.Debug("Receive quitChan")
+			// Flush the queued messages before closing the connection.
+			for len(session.msgChan) > 0 && len(queue) < queueMaxSize {
+				queue <- <-session.msgChan
+			}
+			close(queue)
+			for msg := range queue {
+				if err := session.writeMessage(msg); err != nil {
+					logger.Debug(err)
+					return
+				}
+			}
 			return
 
 		case msg := <-queue:
 			logger.Debug("writing")
 			logger.Debug(hex.EncodeToString(msg))
-			session.conn.SetDeadline(time.Now().Add(10 * time.Millisecond))
-			size := uint32(len(msg))
-			if err := binary.Write(session.conn, binary.LittleEndian, size); err != nil {
+			if err := session.writeMessage(msg); err != nil {
 				if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
 					logger.Debug("timeout")
 					continue
@@ -332,17 +421,21 @@ func (session *remoteSubscriberSession) start() {
 				}
 			}
 			logger.Debug(len(msg))
-			session.conn.SetDeadline(time.Now().Add(10 * time.Millisecond))
-			if _, err := session.conn.Write(msg); err != nil {
-				if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
-					logger.Debug("timeout")
-					continue
-				} else {
-					logger.Error(err)
-					panic(err)
-				}
-			}
-			logger.Debug(hex.EncodeToString(msg))
 		}
 	}
 }
+
+// writeMessage writes a message with its size to the subscriber.
+func (session *remoteSubscriberSession) writeMessage(msg []byte) error {
+	session.conn.SetDeadline(time.Now().Add(10 * time.Millisecond))
+	size := uint32(len(msg))
+	if err := binary.Write(session.conn, binary.LittleEndian, size); err != nil {
+		return err
+	}
+	session.conn.SetDeadline(time.Now().Add(10 * time.Millisecond))
+	if _, err := session.conn.Write(msg); err != nil {
+		return err
+	}
+	session.counters.add(4 + len(msg))
+	return nil
+}
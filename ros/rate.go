@@ -5,19 +5,33 @@ type Rate struct {
 	actualCycleTime   Duration
 	expectedCycleTime Duration
 	start             Time
+	clock             Clock
 }
 
-func NewRate(frequency float64) Rate {
-	var actualCycleTime, expectedCycleTime Duration
+// RateOption allows to customize created rates.
+type RateOption func(r *Rate)
+
+// RateClock makes the rate follow clock instead of the wall clock, e.g.
+// Node.Clock() for the simulated time of a node.
+func RateClock(clock Clock) RateOption {
+	return func(r *Rate) {
+		r.clock = clock
+	}
+}
+
+func NewRate(frequency float64, options ...RateOption) Rate {
+	var expectedCycleTime Duration
 	expectedCycleTime.FromSec(1.0 / frequency)
-	start := Now()
-	return Rate{actualCycleTime, expectedCycleTime, start}
+	return CycleTime(expectedCycleTime, options...)
 }
 
-func CycleTime(d Duration) Rate {
-	var actualCycleTime Duration
-	start := Now()
-	return Rate{actualCycleTime, d, start}
+func CycleTime(d Duration, options ...RateOption) Rate {
+	r := Rate{expectedCycleTime: d, clock: NewWallClock()}
+	for _, option := range options {
+		option(&r)
+	}
+	r.start = r.clock.Now()
+	return r
 }
 
 func (r *Rate) CycleTime() Duration {
@@ -30,18 +44,12 @@ func (r *Rate) ExpectedCycleTime() Duration {
 
 func (r *Rate) Reset() {
 	r.actualCycleTime = NewDuration(0, 0)
-	r.start = Now()
+	r.start = r.clock.Now()
 }
 
 func (r *Rate) Sleep() error {
-	end := Now()
-	diff := end.Diff(r.start)
-	var remaining Duration
-	if r.expectedCycleTime.Cmp(diff) >= 0 {
-		remaining = r.expectedCycleTime.Sub(diff)
-	}
-	remaining.Sleep()
-	now := Now()
+	sleepUntil(r.clock, r.start.Add(r.expectedCycleTime))
+	now := r.clock.Now()
 	r.actualCycleTime = now.Diff(r.start)
 	r.start = r.start.Add(r.expectedCycleTime)
 	return nil
@@ -83,3 +83,28 @@ func TestRateSleep(t *testing.T) {
 		}
 	}
 }
+
+func TestRateClock(t *testing.T) {
+	clock := NewSimClock(NewTime(100, 0))
+	r := NewRate(1, RateClock(clock))
+	done := make(chan struct{})
+	go func() {
+		r.Sleep()
+		close(done)
+	}()
+	clock.Set(NewTime(100, 500000000))
+	select {
+	case <-done:
+		t.Fatal("expected the rate to wait for the simulated time")
+	case <-time.After(50 * time.Millisecond):
+	}
+	clock.Set(NewTime(101, 0))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the rate to wake up at the simulated time")
+	}
+	if d := r.CycleTime(); d != NewDuration(1, 0) {
+		t.Errorf("expected a cycle of 1s but %v", d)
+	}
+}
@@ -0,0 +1,65 @@
+package ros
+
+import (
+	"bytes"
+)
+
+// RawMessageType is a message type known only by its name, MD5 sum and
+// definition. Its messages keep the serialized bytes, so it can be used to
+// subscribe to topics of types unknown at compile time or to republish
+// recorded messages.
+type RawMessageType struct {
+	name   string
+	md5sum string
+	text   string
+}
+
+// AnyMessageType matches any topic type. Subscribers can find the actual
+// type and definition in the connection header of MessageEvent.
+var AnyMessageType = NewRawMessageType("*", "*", "")
+
+// NewRawMessageType creates a raw message type.
+func NewRawMessageType(name string, md5sum string, text string) *RawMessageType {
+	return &RawMessageType{name, md5sum, text}
+}
+
+func (t *RawMessageType) Text() string {
+	return t.text
+}
+
+func (t *RawMessageType) MD5Sum() string {
+	return t.md5sum
+}
+
+func (t *RawMessageType) Name() string {
+	return t.name
+}
+
+func (t *RawMessageType) NewMessage() Message {
+	return &RawMessage{msgType: t}
+}
+
+// RawMessage is a serialized message.
+type RawMessage struct {
+	msgType *RawMessageType
+	Bytes   []byte
+}
+
+// NewRawMessage creates a message of msgType from its serialized bytes.
+func NewRawMessage(msgType *RawMessageType, data []byte) *RawMessage {
+	return &RawMessage{msgType, data}
+}
+
+func (m *RawMessage) GetType() MessageType {
+	return m.msgType
+}
+
+func (m *RawMessage) Serialize(buf *bytes.Buffer) error {
+	_, err := buf.Write(m.Bytes)
+	return err
+}
+
+func (m *RawMessage) Deserialize(buf *Reader) error {
+	m.Bytes = buf.Next(buf.Len())
+	return nil
+}
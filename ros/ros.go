@@ -8,13 +8,13 @@ import (
 type Node interface {
 
 	// NewPublisher creates a publisher for specified topic and message type.
-	NewPublisher(topic string, msgType MessageType) Publisher
+	NewPublisher(topic string, msgType MessageType, options ...PublisherOption) Publisher
 
 	// NewPublisherWithCallbacks creates a publisher which gives you callbacks when subscribers
 	// connect and disconnect.  The callbacks are called in their own
 	// goroutines, so they don't need to return immediately to let the
 	// connection proceed.
-	NewPublisherWithCallbacks(topic string, msgType MessageType, connectCallback, disconnectCallback func(SingleSubscriberPublisher)) Publisher
+	NewPublisherWithCallbacks(topic string, msgType MessageType, connectCallback, disconnectCallback func(SingleSubscriberPublisher), options ...PublisherOption) Publisher
 
 	// NewSubscriber creates a subscriber to specified topic, where
 	// the messages are of a given type. callback should be a function
@@ -23,14 +23,31 @@ type Node interface {
 	// the normal case, and the argument should be of the generated message type.
 	// If the function takes 2 arguments, the first argument should be of the
 	// generated message type and the second argument should be of type MessageEvent.
-	NewSubscriber(topic string, msgType MessageType, callback interface{}) Subscriber
+	// Lost connections to publishers are retried while the publishers are
+	// registered; SubscriberStatusCallback reports them.
+	NewSubscriber(topic string, msgType MessageType, callback interface{}, options ...SubscriberOption) Subscriber
 	NewServiceClient(service string, srvType ServiceType, options ...ServiceClientOption) ServiceClient
 	NewServiceServer(service string, srvType ServiceType, callback interface{}, options ...ServiceServerOption) ServiceServer
 
 	OK() bool
 	SpinOnce()
 	Spin()
+
+	// Shutdown stops the node, runs the shutdown hooks and tears the
+	// connections down in at most the shutdown timeout of the node. Nodes
+	// handling signals and nodes killed through the Slave API shut down by
+	// themselves; calling Shutdown again waits for the end of the teardown.
 	Shutdown()
+	// OnShutdown registers a hook called with the reason of the shutdown
+	// before the connections are torn down. Hooks are called in the order of
+	// registration.
+	OnShutdown(hook func(reason ShutdownReason))
+	// ShutdownReason returns why the node shut down, or nil while it runs.
+	ShutdownReason() *ShutdownReason
+	// OnMasterEvent registers a callback called when the master is lost or
+	// restarts, after which the node registers everything again. Callbacks
+	// are executed by Spin and SpinOnce like subscriber callbacks.
+	OnMasterEvent(callback func(event MasterEvent))
 
 	GetParam(name string) (interface{}, error)
 	SetParam(name string, value interface{}) error
@@ -38,6 +55,28 @@ type Node interface {
 	SearchParam(name string) (string, error)
 	DeleteParam(name string) error
 
+	// Graph gives access to the topics, services and nodes registered to the master.
+	Graph() Graph
+
+	// NewChild creates a node handle sharing the connections of this node
+	// whose names resolve relative to namespace, after applying remappings.
+	// Relative namespaces are resolved against the namespace of this node
+	// and "~" gives a handle in the private namespace. Shutting a child down
+	// only shuts down what was created through it; topics it shares with
+	// the node or other children keep working for them. Options give the
+	// child a name and arguments of its own.
+	NewChild(namespace string, remappings NameMap, options ...ChildOption) Node
+
+	// Now returns the time of the clock of the node.
+	Now() Time
+
+	// Clock returns the clock of the node, e.g. for RateClock.
+	Clock() Clock
+
+	// Metrics returns the traffic counters of the topics and services of
+	// the node.
+	Metrics() Metrics
+
 	Logger() Logger
 
 	NonRosArgs() []string
@@ -61,6 +100,54 @@ func NodeServiceServerOptions(opts ...ServiceServerOption) NodeOption {
 	}
 }
 
+// NodeMasterURI makes the node use the master at uri instead of the one of
+// ROS_MASTER_URI. A __master argument still takes precedence.
+func NodeMasterURI(uri string) NodeOption {
+	return func(n *defaultNode) {
+		n.masterURI = uri
+	}
+}
+
+// NodeLogger makes the node log to logger instead of a logger of its own.
+func NodeLogger(logger Logger) NodeOption {
+	return func(n *defaultNode) {
+		n.logger = logger
+	}
+}
+
+// NodeClock makes the node take the time from clock instead of the wall clock.
+func NodeClock(clock Clock) NodeOption {
+	return func(n *defaultNode) {
+		n.clock = clock
+	}
+}
+
+// NodeSignalHandling tells whether the node shuts down on SIGINT and
+// SIGTERM, which is the default. The signals are shared by all the nodes of
+// the process handling them; nodes embedded in a program handling its
+// signals itself should disable it.
+func NodeSignalHandling(enabled bool) NodeOption {
+	return func(n *defaultNode) {
+		n.signals = enabled
+	}
+}
+
+// NodeShutdownTimeout changes the default shutdown timeout of 5s.
+func NodeShutdownTimeout(timeout time.Duration) NodeOption {
+	return func(n *defaultNode) {
+		n.shutdownTimeout = timeout
+	}
+}
+
+// NodeMasterCheckInterval changes how often the node checks that the master
+// still knows it, DefaultMasterCheckInterval by default. Zero disables the
+// check and the re-registration after master restarts.
+func NodeMasterCheckInterval(interval time.Duration) NodeOption {
+	return func(n *defaultNode) {
+		n.masterInterval = interval
+	}
+}
+
 func NewNode(name string, args []string, opts ...NodeOption) (Node, error) {
 	return newDefaultNode(name, args, opts...)
 }
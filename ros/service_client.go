@@ -18,6 +18,7 @@ type defaultServiceClient struct {
 	masterURI  string
 	nodeID     string
 	tcpTimeout time.Duration
+	counters   *serviceCounters
 }
 
 func newDefaultServiceClient(logger Logger, nodeID string, masterURI string, service string, srvType ServiceType, options ...ServiceClientOption) *defaultServiceClient {
@@ -36,6 +37,13 @@ func newDefaultServiceClient(logger Logger, nodeID string, masterURI string, ser
 }
 
 func (c *defaultServiceClient) Call(srv Service) error {
+	start := time.Now()
+	err := c.call(srv)
+	c.counters.observe(time.Since(start), err != nil)
+	return err
+}
+
+func (c *defaultServiceClient) call(srv Service) error {
 	logger := c.logger
 
 	result, err := callRosAPI(c.masterURI, "lookupService", c.nodeID, c.service)
@@ -151,3 +159,39 @@ func (c *defaultServiceClient) Call(srv Service) error {
 }
 
 func (*defaultServiceClient) Shutdown() {}
+
+// probeService reads the response header of a service without calling it.
+func probeService(serviceRawURL string, service string, nodeID string, timeout time.Duration) (map[string]string, error) {
+	serviceURL, err := url.Parse(serviceRawURL)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("tcp", serviceURL.Host, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	headers := []header{
+		{"probe", "1"},
+		{"service", service},
+		{"md5sum", "*"},
+		{"callerid", nodeID},
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := writeConnectionHeader(headers, conn); err != nil {
+		return nil, err
+	}
+	resHeaders, err := readConnectionHeader(conn)
+	if err != nil {
+		return nil, err
+	}
+	resHeaderMap := make(map[string]string)
+	for _, h := range resHeaders {
+		resHeaderMap[h.key] = h.value
+	}
+	if errMsg, ok := resHeaderMap["error"]; ok {
+		return nil, errors.New(errMsg)
+	}
+	return resHeaderMap, nil
+}
@@ -32,6 +32,7 @@ type defaultServiceServer struct {
 	shutdownChan     chan struct{}
 	sessionCloseChan chan *remoteClientSessionCloseEvent
 	tcpTimeout       time.Duration
+	counters         *serviceCounters
 }
 
 func newDefaultServiceServer(node *defaultNode, service string, srvType ServiceType, handler interface{}, opts ...ServiceServerOption) *defaultServiceServer {
@@ -51,6 +52,7 @@ func newDefaultServiceServer(node *defaultNode, service string, srvType ServiceT
 	server.srvType = srvType
 	server.handler = handler
 	server.tcpTimeout = 10 * time.Millisecond
+	server.counters = node.metrics.service(service, Inbound)
 	for _, option := range opts {
 		option(server)
 	}
@@ -75,6 +77,7 @@ func newDefaultServiceServer(node *defaultNode, service string, srvType ServiceT
 		server.listener.Close()
 		return nil
 	}
+	node.waitGroup.Add(1)
 	go server.start()
 	return server
 }
@@ -87,7 +90,6 @@ func (s *defaultServiceServer) Shutdown() {
 func (s *defaultServiceServer) start() {
 	logger := s.node.logger
 	logger.Debugf("service server '%s' start listen %s.", s.service, s.listener.Addr().String())
-	s.node.waitGroup.Add(1)
 	defer func() {
 		logger.Debug("defaultServiceServer.start exit")
 		s.node.waitGroup.Done()
@@ -176,6 +178,7 @@ func (s *remoteClientSession) start() {
 	logger.Debugf("remoteClientSession.start '%s'", s.server.service)
 	defer func() {
 		logger.Debug("remoteClientSession.start exit")
+		conn.Close()
 	}()
 	defer func() {
 		if err := recover(); err != nil {
@@ -241,6 +244,11 @@ func (s *remoteClientSession) start() {
 	if _, err = io.ReadFull(conn, resBuffer); err != nil {
 		panic(err)
 	}
+	start := time.Now()
+	failed := true
+	defer func() {
+		s.server.counters.observe(time.Since(start), failed)
+	}()
 
 	s.server.node.jobChan <- func() {
 		srv := s.server.srvType.NewService()
@@ -294,6 +302,7 @@ func (s *remoteClientSession) start() {
 		if _, err := conn.Write(resMsg); err != nil {
 			panic(err)
 		}
+		failed = false
 	case err := <-s.errorChan:
 		logger.Error(err)
 		// 4. Write OK byte
@@ -313,7 +322,7 @@ func (s *remoteClientSession) start() {
 			panic(err)
 		}
 	case <-s.quitChan:
-		s.errorChan <- fmt.Errorf("service shut down")
+		logger.Debugf("service %s shut down before responding", service)
 	case <-timeoutChan:
 		panic(fmt.Errorf("service callback timeout"))
 	}
@@ -0,0 +1,60 @@
+package ros
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultShutdownTimeout is the time given to the connections of a node to
+// be torn down.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// ShutdownCause tells what shut a node down.
+type ShutdownCause int
+
+const (
+	// ShutdownRequested means that the program called Shutdown.
+	ShutdownRequested ShutdownCause = iota
+	// ShutdownInterrupted means that the process received SIGINT.
+	ShutdownInterrupted
+	// ShutdownTerminated means that the process received SIGTERM.
+	ShutdownTerminated
+	// ShutdownRemote means that another node called the shutdown method of
+	// the Slave API, e.g. gorosnode kill.
+	ShutdownRemote
+)
+
+func (c ShutdownCause) String() string {
+	switch c {
+	case ShutdownRequested:
+		return "ShutdownRequested"
+	case ShutdownInterrupted:
+		return "ShutdownInterrupted"
+	case ShutdownTerminated:
+		return "ShutdownTerminated"
+	case ShutdownRemote:
+		return "ShutdownRemote"
+	}
+	return fmt.Sprintf("ShutdownCause(%d)", int(c))
+}
+
+// ShutdownReason tells why a node shut down.
+type ShutdownReason struct {
+	Cause ShutdownCause
+	// CallerID is the node which requested a remote shutdown.
+	CallerID string
+	// Message is the message of a remote shutdown.
+	Message string
+}
+
+func (r ShutdownReason) String() string {
+	switch r.Cause {
+	case ShutdownInterrupted:
+		return "interrupted"
+	case ShutdownTerminated:
+		return "terminated"
+	case ShutdownRemote:
+		return fmt.Sprintf("shutdown requested by %s: %s", r.CallerID, r.Message)
+	}
+	return "shutdown requested"
+}
@@ -0,0 +1,61 @@
+package ros
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// signalHandler delivers SIGINT and SIGTERM to every node of the process
+// which handles signals. It is installed by the first such node and removed with
+// the last one, which restores the default behavior of the signals.
+var signalHandler struct {
+	nodes      map[*defaultNode]struct{}
+	signalChan chan os.Signal
+	mutex      sync.Mutex
+}
+
+// handleSignals makes node shut down on SIGINT and SIGTERM.
+func handleSignals(node *defaultNode) {
+	signalHandler.mutex.Lock()
+	defer signalHandler.mutex.Unlock()
+	if signalHandler.nodes == nil {
+		signalHandler.nodes = make(map[*defaultNode]struct{})
+	}
+	signalHandler.nodes[node] = struct{}{}
+	if signalHandler.signalChan != nil {
+		return
+	}
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
+	signalHandler.signalChan = signalChan
+	go func() {
+		for sig := range signalChan {
+			reason := ShutdownReason{Cause: ShutdownInterrupted}
+			if sig == syscall.SIGTERM {
+				reason.Cause = ShutdownTerminated
+			}
+			signalHandler.mutex.Lock()
+			for n := range signalHandler.nodes {
+				n.requestShutdown(reason)
+			}
+			signalHandler.mutex.Unlock()
+		}
+	}()
+}
+
+// releaseSignals stops delivering signals to node.
+func releaseSignals(node *defaultNode) {
+	signalHandler.mutex.Lock()
+	defer signalHandler.mutex.Unlock()
+	if _, ok := signalHandler.nodes[node]; !ok {
+		return
+	}
+	delete(signalHandler.nodes, node)
+	if len(signalHandler.nodes) == 0 {
+		signal.Stop(signalHandler.signalChan)
+		close(signalHandler.signalChan)
+		signalHandler.signalChan = nil
+	}
+}
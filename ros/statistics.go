@@ -0,0 +1,323 @@
+package ros
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"time"
+)
+
+// Defaults of the statistics parameters, as in roscpp.
+const (
+	DefaultStatisticsWindowMinElements = 10
+	DefaultStatisticsWindowMaxElements = 100
+	DefaultStatisticsWindowMinSize     = 4 * time.Second
+	DefaultStatisticsWindowMaxSize     = 64 * time.Second
+)
+
+// TopicStatistics is a rosgraph_msgs/TopicStatistics message. When the
+// /enable_statistics parameter is true, subscribers publish one on
+// /statistics for each connected publisher at the end of every window.
+type TopicStatistics struct {
+	Topic         string
+	NodePub       string
+	NodeSub       string
+	WindowStart   Time
+	WindowStop    Time
+	DeliveredMsgs int32
+	DroppedMsgs   int32
+	Traffic       int32
+	// Periods between two messages.
+	PeriodMean   Duration
+	PeriodStddev Duration
+	PeriodMax    Duration
+	// Ages of the messages according to the stamp of their header, zero
+	// for messages without header.
+	StampAgeMean   Duration
+	StampAgeStddev Duration
+	StampAgeMax    Duration
+}
+
+type topicStatisticsType struct{}
+
+// TopicStatisticsType is the type of TopicStatistics messages.
+var TopicStatisticsType MessageType = topicStatisticsType{}
+
+func (topicStatisticsType) Text() string {
+	return `# name of the topic
+string topic
+
+# node id of the publisher
+string node_pub
+
+# node id of the subscriber
+string node_sub
+
+# the statistics apply to this time window
+time window_start
+time window_stop
+
+# number of messages delivered during the window
+int32 delivered_msgs
+# numbers of messages dropped during the window
+int32 dropped_msgs
+
+# traffic during the window, in bytes
+int32 traffic
+
+# mean/stddev/max period between two messages
+duration period_mean
+duration period_stddev
+duration period_max
+
+# mean/stddev/max age of the message based on the
+# timestamp in the message header. In case the
+# message does not have a header, it will be 0.
+duration stamp_age_mean
+duration stamp_age_stddev
+duration stamp_age_max
+`
+}
+
+func (topicStatisticsType) MD5Sum() string      { return "10152ed868c5097a5e2e4a89d7daa710" }
+func (topicStatisticsType) Name() string        { return "rosgraph_msgs/TopicStatistics" }
+func (topicStatisticsType) NewMessage() Message { return &TopicStatistics{} }
+
+func (m *TopicStatistics) GetType() MessageType {
+	return TopicStatisticsType
+}
+
+func (m *TopicStatistics) Serialize(buf *bytes.Buffer) error {
+	for _, s := range []string{m.Topic, m.NodePub, m.NodeSub} {
+		if err := binary.Write(buf, binary.LittleEndian, uint32(len(s))); err != nil {
+			return err
+		}
+		if _, err := buf.WriteString(s); err != nil {
+			return err
+		}
+	}
+	for _, v := range m.fields() {
+		if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *TopicStatistics) Deserialize(buf *Reader) error {
+	for _, s := range []*string{&m.Topic, &m.NodePub, &m.NodeSub} {
+		var size uint32
+		if err := binary.Read(buf, binary.LittleEndian, &size); err != nil {
+			return err
+		}
+		data := make([]byte, int(size))
+		if err := binary.Read(buf, binary.LittleEndian, data); err != nil {
+			return err
+		}
+		*s = string(data)
+	}
+	for _, v := range m.fields() {
+		if err := binary.Read(buf, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fields returns the fixed size fields following the strings.
+func (m *TopicStatistics) fields() []interface{} {
+	return []interface{}{
+		&m.WindowStart.Sec, &m.WindowStart.NSec, &m.WindowStop.Sec, &m.WindowStop.NSec,
+		&m.DeliveredMsgs, &m.DroppedMsgs, &m.Traffic,
+		&m.PeriodMean.Sec, &m.PeriodMean.NSec, &m.PeriodStddev.Sec, &m.PeriodStddev.NSec, &m.PeriodMax.Sec, &m.PeriodMax.NSec,
+		&m.StampAgeMean.Sec, &m.StampAgeMean.NSec, &m.StampAgeStddev.Sec, &m.StampAgeStddev.NSec, &m.StampAgeMax.Sec, &m.StampAgeMax.NSec,
+	}
+}
+
+// windowStatistics accumulates the messages of a publisher during a window.
+type windowStatistics struct {
+	start     Time
+	arrivals  []int64
+	ages      []int64
+	dropped   int32
+	traffic   int32
+	lastSeq   uint32
+	hasSeq    bool
+	hasHeader bool
+}
+
+// topicStatistics computes the statistics of a subscription like roscpp:
+// the window starts at one second and doubles or halves within the window
+// size parameters when it holds too many or too few messages.
+type topicStatistics struct {
+	topic       string
+	nodeSub     string
+	clock       Clock
+	publish     func(*TopicStatistics)
+	period      time.Duration
+	minElements int
+	maxElements int
+	minWindow   time.Duration
+	maxWindow   time.Duration
+	windows     map[string]*windowStatistics
+}
+
+func newTopicStatistics(topic, nodeSub string, clock Clock, publish func(*TopicStatistics)) *topicStatistics {
+	return &topicStatistics{
+		topic:       topic,
+		nodeSub:     nodeSub,
+		clock:       clock,
+		publish:     publish,
+		period:      time.Second,
+		minElements: DefaultStatisticsWindowMinElements,
+		maxElements: DefaultStatisticsWindowMaxElements,
+		minWindow:   DefaultStatisticsWindowMinSize,
+		maxWindow:   DefaultStatisticsWindowMaxSize,
+		windows:     make(map[string]*windowStatistics),
+	}
+}
+
+// record accounts a message received from a publisher and publishes the
+// statistics of the publisher when its window is over.
+func (s *topicStatistics) record(event MessageEvent, data []byte) {
+	now := s.clock.Now()
+	nsec := int64(now.ToNSec())
+	w, ok := s.windows[event.PublisherName]
+	if !ok {
+		w = &windowStatistics{start: now, hasHeader: hasHeader(event.ConnectionHeader["message_definition"])}
+		s.windows[event.PublisherName] = w
+	}
+	w.arrivals = append(w.arrivals, nsec)
+	w.traffic += int32(4 + len(data))
+	if w.hasHeader && len(data) >= 12 {
+		seq := binary.LittleEndian.Uint32(data)
+		stamp := NewTime(binary.LittleEndian.Uint32(data[4:]), binary.LittleEndian.Uint32(data[8:]))
+		w.ages = append(w.ages, nsec-int64(stamp.ToNSec()))
+		if w.hasSeq && seq > w.lastSeq+1 {
+			w.dropped += int32(seq - w.lastSeq - 1)
+		}
+		w.lastSeq, w.hasSeq = seq, true
+	}
+
+	if nsec-int64(w.start.ToNSec()) < int64(s.period) {
+		return
+	}
+	msg := &TopicStatistics{
+		Topic:         s.topic,
+		NodePub:       event.PublisherName,
+		NodeSub:       s.nodeSub,
+		WindowStart:   w.start,
+		WindowStop:    now,
+		DeliveredMsgs: int32(len(w.arrivals)),
+		DroppedMsgs:   w.dropped,
+		Traffic:       w.traffic,
+	}
+	msg.StampAgeMean, msg.StampAgeStddev, msg.StampAgeMax = summarize(w.ages)
+	var periods []int64
+	for i := 1; i < len(w.arrivals); i++ {
+		periods = append(periods, w.arrivals[i]-w.arrivals[i-1])
+	}
+	msg.PeriodMean, msg.PeriodStddev, msg.PeriodMax = summarize(periods)
+	s.publish(msg)
+
+	if len(w.arrivals) > s.maxElements && s.period*2 <= s.maxWindow {
+		s.period *= 2
+	}
+	if len(w.arrivals) < s.minElements && s.period/2 >= s.minWindow {
+		s.period /= 2
+	}
+	*w = windowStatistics{start: now, lastSeq: w.lastSeq, hasSeq: w.hasSeq, hasHeader: w.hasHeader}
+}
+
+// summarize returns the mean, the standard deviation and the maximum of
+// durations in nanoseconds. Negative durations count as zero.
+func summarize(values []int64) (Duration, Duration, Duration) {
+	if len(values) == 0 {
+		return Duration{}, Duration{}, Duration{}
+	}
+	var sum, max float64
+	for _, v := range values {
+		sum += float64(v)
+		max = math.Max(max, float64(v))
+	}
+	mean := sum / float64(len(values))
+	var variance float64
+	for _, v := range values {
+		variance += (float64(v) - mean) * (float64(v) - mean)
+	}
+	stddev := math.Sqrt(variance / float64(len(values)))
+	return durationFromNSec(mean), durationFromNSec(stddev), durationFromNSec(max)
+}
+
+func durationFromNSec(nsec float64) Duration {
+	var d Duration
+	if nsec > 0 {
+		d.FromNSec(uint64(nsec))
+	}
+	return d
+}
+
+// hasHeader tells whether the first field of a message definition is a
+// std_msgs/Header.
+func hasHeader(definition string) bool {
+	for _, line := range strings.Split(definition, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		return len(fields) == 2 && (fields[0] == "Header" || fields[0] == "std_msgs/Header")
+	}
+	return false
+}
+
+// newStatistics returns the statistics of a subscription to a resolved
+// topic name, or nil when the /enable_statistics parameter is not true.
+// The publisher of the statistics is created with the first subscription,
+// so that the subscribers never wait for the master. It must be called
+// with subscribersMutex held.
+func (node *defaultNode) newStatistics(topic string) *topicStatistics {
+	if enabled, _ := node.getParam("/enable_statistics"); enabled != true {
+		return nil
+	}
+	if node.statisticsPub == nil {
+		node.statisticsPub = node.newPublisher(node.nameResolver.remap("/statistics"), TopicStatisticsType, nil, nil)
+	}
+	pub := node.statisticsPub
+	s := newTopicStatistics(topic, node.qualifiedName, node.clock, func(msg *TopicStatistics) {
+		if node.OK() {
+			pub.Publish(msg)
+		}
+	})
+	if value, ok := node.numberParam("/statistics_window_min_elements"); ok {
+		s.minElements = int(value)
+	}
+	if value, ok := node.numberParam("/statistics_window_max_elements"); ok {
+		s.maxElements = int(value)
+	}
+	if value, ok := node.numberParam("/statistics_window_min_size"); ok {
+		s.minWindow = time.Duration(value * float64(time.Second))
+	}
+	if value, ok := node.numberParam("/statistics_window_max_size"); ok {
+		s.maxWindow = time.Duration(value * float64(time.Second))
+	}
+	return s
+}
+
+// numberParam gets an integer or floating point parameter.
+func (node *defaultNode) numberParam(name string) (float64, bool) {
+	value, err := node.getParam(name)
+	if err != nil {
+		return 0, false
+	}
+	switch v := value.(type) {
+	case int32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
@@ -0,0 +1,187 @@
+package ros
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+)
+
+func TestTopicStatisticsSerialization(t *testing.T) {
+	msg := TopicStatistics{
+		Topic:         "/chatter",
+		NodePub:       "/talker",
+		NodeSub:       "/listener",
+		WindowStart:   NewTime(10, 5),
+		WindowStop:    NewTime(11, 6),
+		DeliveredMsgs: 3,
+		DroppedMsgs:   1,
+		Traffic:       42,
+		PeriodMean:    NewDuration(0, 100),
+		StampAgeMax:   NewDuration(2, 0),
+	}
+	var buf bytes.Buffer
+	if err := msg.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if size := buf.Len(); size != 3*4+8+7+9+19*4 {
+		t.Errorf("unexpected size %d", size)
+	}
+	var result TopicStatistics
+	if err := result.Deserialize(NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, msg) {
+		t.Errorf("expected %+v but %+v", msg, result)
+	}
+}
+
+func TestHasHeader(t *testing.T) {
+	for definition, want := range map[string]bool{
+		"Header header\nfloat64 data\n":              true,
+		"# comment\n\nstd_msgs/Header header  # h\n": true,
+		"float64 data\nHeader header\n":              false,
+		"uint8 HEADER=1\nHeader header\n":            false,
+		"":                                           false,
+	} {
+		if got := hasHeader(definition); got != want {
+			t.Errorf("hasHeader(%q) = %v", definition, got)
+		}
+	}
+}
+
+func TestTopicStatisticsWindow(t *testing.T) {
+	clock := NewSimClock(NewTime(100, 0))
+	var published []*TopicStatistics
+	s := newTopicStatistics("/chatter", "/listener", clock, func(msg *TopicStatistics) {
+		published = append(published, msg)
+	})
+	s.minElements, s.maxElements = 3, 5
+	s.minWindow, s.maxWindow = 500*time.Millisecond, 2*time.Second
+
+	event := MessageEvent{PublisherName: "/talker", ConnectionHeader: map[string]string{
+		"message_definition": "Header header\n",
+	}}
+	now := time.Unix(100, 0)
+	var seq uint32
+	send := func(period time.Duration, skipped uint32) {
+		now = now.Add(period)
+		var t Time
+		t.FromNSec(uint64(now.UnixNano()))
+		clock.Set(t)
+		// Messages are stamped 50ms before they are received.
+		var stamp Time
+		stamp.FromNSec(uint64(now.Add(-50 * time.Millisecond).UnixNano()))
+		seq += 1 + skipped
+		data := make([]byte, 12)
+		binary.LittleEndian.PutUint32(data, seq)
+		binary.LittleEndian.PutUint32(data[4:], stamp.Sec)
+		binary.LittleEndian.PutUint32(data[8:], stamp.NSec)
+		s.record(event, data)
+	}
+
+	// The first window of one second holds 11 messages, one of them after
+	// two dropped ones.
+	send(0, 0)
+	for i := 0; i < 10; i++ {
+		skipped := uint32(0)
+		if i == 4 {
+			skipped = 2
+		}
+		send(100*time.Millisecond, skipped)
+	}
+	if len(published) != 1 {
+		t.Fatalf("expected one message but %d", len(published))
+	}
+	msg := published[0]
+	want := TopicStatistics{
+		Topic:         "/chatter",
+		NodePub:       "/talker",
+		NodeSub:       "/listener",
+		WindowStart:   NewTime(100, 0),
+		WindowStop:    NewTime(101, 0),
+		DeliveredMsgs: 11,
+		DroppedMsgs:   2,
+		Traffic:       11 * 16,
+		PeriodMean:    NewDuration(0, 100000000),
+		PeriodMax:     NewDuration(0, 100000000),
+		StampAgeMean:  NewDuration(0, 50000000),
+		StampAgeMax:   NewDuration(0, 50000000),
+	}
+	if !reflect.DeepEqual(*msg, want) {
+		t.Errorf("expected %+v but %+v", want, *msg)
+	}
+
+	// The window doubled since it held more than 5 messages.
+	if s.period != 2*time.Second {
+		t.Errorf("expected a window of 2s but %v", s.period)
+	}
+	for i := 0; i < 3; i++ {
+		send(time.Second, 0)
+	}
+	if len(published) < 2 || published[1].DeliveredMsgs != 2 || published[1].PeriodMean != NewDuration(1, 0) {
+		t.Fatalf("unexpected messages %+v", published)
+	}
+	// It is halved when it holds less than 3 messages but not below 500ms.
+	send(time.Second, 0)
+	send(time.Second, 0)
+	if s.period != 500*time.Millisecond {
+		t.Errorf("expected a window of 500ms but %v", s.period)
+	}
+}
+
+func TestTopicStatisticsPublishing(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	talker := newTestNode(t, m, "/talker")
+	defer talker.Shutdown()
+	listener := newTestNode(t, m, "/listener")
+	defer listener.Shutdown()
+	if err := listener.SetParam("/enable_statistics", true); err != nil {
+		t.Fatal(err)
+	}
+
+	statistics := make(chan *TopicStatistics, 10)
+	talker.NewSubscriber("/statistics", TopicStatisticsType, func(msg *TopicStatistics) {
+		statistics <- msg
+	})
+	listener.NewSubscriber("chatter", testMessageType{}, func(*testMessage) {})
+	// The publisher of the statistics is registered with the subscription,
+	// not by the subscriber on the first message.
+	if listener.(*defaultNode).statisticsPub == nil {
+		t.Error("expected the statistics publisher to be created with the subscription")
+	}
+	go talker.Spin()
+	go listener.Spin()
+
+	pub := talker.NewPublisher("chatter", testMessageType{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(20 * time.Millisecond):
+				pub.Publish(&testMessage{data: []byte{1}})
+			}
+		}
+	}()
+
+	select {
+	case msg := <-statistics:
+		if msg.Topic != "/chatter" || msg.NodePub != "/talker" || msg.NodeSub != "/listener" ||
+			msg.DeliveredMsgs < 2 || msg.Traffic != 5*msg.DeliveredMsgs || msg.PeriodMean.IsZero() {
+			t.Errorf("unexpected statistics %+v", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no statistics were published")
+	}
+}
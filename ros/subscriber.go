@@ -6,48 +6,127 @@ import (
 	"io"
 	"net"
 	"reflect"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type messageEvent struct {
 	bytes []byte
 	event MessageEvent
+	// pub is the XML-RPC URI of the publisher.
+	pub string
+}
+
+const (
+	// minLinkRetryDelay and maxLinkRetryDelay bound the delay between
+	// attempts to connect to a publisher.
+	minLinkRetryDelay = 100 * time.Millisecond
+	maxLinkRetryDelay = 10 * time.Second
+	linkTimeout       = 5 * time.Second
+)
+
+// SubscriberStatus reports a change of the connection of a subscriber to
+// one of the publishers of its topic.
+type SubscriberStatus struct {
+	Topic string
+	// Publisher is the XML-RPC URI of the publisher.
+	Publisher string
+	Connected bool
+	// Err tells why the subscriber is not connected. Connecting again is
+	// retried while the publisher is registered to the master.
+	Err error
+}
+
+// SubscriberOption customizes a subscriber handle. Handles of a topic share
+// one subscriber, and options only last as long as the handle they were
+// given with.
+type SubscriberOption func(c *subscriberCallback)
+
+// SubscriberStatusCallback registers a callback called when the subscriber
+// connects to a publisher or loses its connection. Callbacks are executed by
+// Spin and SpinOnce like message callbacks.
+func SubscriberStatusCallback(callback func(status SubscriberStatus)) SubscriberOption {
+	return func(c *subscriberCallback) {
+		c.statusCallbacks = append(c.statusCallbacks, callback)
+	}
+}
+
+// linkEvent tells the subscriber goroutine that a link to a publisher
+// connected, or ended with err.
+type linkEvent struct {
+	pub       string
+	quitChan  chan struct{}
+	connected bool
+	err       error
+}
+
+// subscriberCallback is a message callback of a subscriber with the options
+// of its handle, which handles remove by identity.
+type subscriberCallback struct {
+	fn              interface{}
+	statusCallbacks []func(SubscriberStatus)
+}
+
+// callbackChange adds or removes a callback of a running subscriber. Both go
+// through one channel to keep their order.
+type callbackChange struct {
+	callback *subscriberCallback
+	add      bool
 }
 
 // The subscription object runs in own goroutine (startSubscription).
 // Do not access any properties from other goroutine.
 type defaultSubscriber struct {
-	topic            string
-	msgType          MessageType
-	pubList          []string
-	pubListChan      chan []string
-	msgChan          chan messageEvent
-	callbacks        []interface{}
-	addCallbackChan  chan interface{}
-	shutdownChan     chan struct{}
-	connections      map[string]chan struct{}
-	disconnectedChan chan string
+	topic        string
+	msgType      MessageType
+	pubList      []string
+	pubListChan  chan []string
+	msgChan      chan messageEvent
+	callbacks    []*subscriberCallback
+	callbackChan chan callbackChange
+	shutdownChan chan struct{}
+	connections  map[string]chan struct{}
+	linkChan     chan linkEvent
+	retryChan    chan string
+	retryDelays  map[string]time.Duration
+	doneChan     chan struct{}
+	counters     *topicCounters
+	statistics   *topicStatistics
+	// latchedMsgs are the last messages of the latched publishers, given
+	// to the callbacks added later.
+	latchedMsgs map[string]messageEvent
+	// refs counts the handles given by the node, guarded by its subscribers
+	// mutex.
+	refs int
+	// unregistered tells that the node already unregistered the subscriber
+	// from the master before shutting it down.
+	unregistered bool
 }
 
-func newDefaultSubscriber(topic string, msgType MessageType, callback interface{}) *defaultSubscriber {
+func newDefaultSubscriber(topic string, msgType MessageType, callback *subscriberCallback) *defaultSubscriber {
 	sub := new(defaultSubscriber)
 	sub.topic = topic
 	sub.msgType = msgType
 	sub.msgChan = make(chan messageEvent, 10)
 	sub.pubListChan = make(chan []string, 10)
-	sub.addCallbackChan = make(chan interface{}, 10)
+	sub.callbackChan = make(chan callbackChange, 10)
 	sub.shutdownChan = make(chan struct{}, 10)
-	sub.disconnectedChan = make(chan string, 10)
+	sub.linkChan = make(chan linkEvent, 10)
+	sub.retryChan = make(chan string, 10)
+	sub.retryDelays = make(map[string]time.Duration)
+	sub.doneChan = make(chan struct{})
 	sub.connections = make(map[string]chan struct{})
-	sub.callbacks = []interface{}{callback}
+	sub.latchedMsgs = make(map[string]messageEvent)
+	sub.callbacks = []*subscriberCallback{callback}
 	return sub
 }
 
-func (sub *defaultSubscriber) start(wg *sync.WaitGroup, nodeID string, nodeURI string, masterURI string, jobChan chan func(), logger Logger, unregisterFromNode func()) {
+func (sub *defaultSubscriber) start(wg *sync.WaitGroup, nodeID string, nodeURI string, masterURI string, jobChan chan func(), logger Logger) {
 	logger.Debugf("Subscriber goroutine for %s started.", sub.topic)
-	wg.Add(1)
 	defer wg.Done()
+	defer close(sub.doneChan)
 	defer func() {
 		logger.Debug("defaultSubscriber.start exit")
 	}()
@@ -61,128 +140,219 @@ func (sub *defaultSubscriber) start(wg *sync.WaitGroup, nodeID string, nodeURI s
 			sub.pubList = list
 
 			for _, pub := range deadPubs {
-				quitChan := sub.connections[pub]
-				quitChan <- struct{}{}
-				delete(sub.connections, pub)
+				if quitChan, ok := sub.connections[pub]; ok {
+					close(quitChan)
+					delete(sub.connections, pub)
+				}
+				delete(sub.retryDelays, pub)
+				delete(sub.latchedMsgs, pub)
 			}
 
 			for _, pub := range newPubs {
-				protocols := []interface{}{[]interface{}{"TCPROS"}}
-				result, err := callRosAPI(pub, "requestTopic", nodeID, sub.topic, protocols)
-				if err != nil {
-					logger.Fatalf("[DefaultSubscriber] %v", err)
-					continue
-				}
+				sub.connect(pub, nodeID, logger)
+			}
 
-				protocolParams := result.([]interface{})
-				for _, x := range protocolParams {
-					logger.Debug(x)
+		case change := <-sub.callbackChan:
+			logger.Debug("Receive callbackChan")
+			if change.add {
+				sub.callbacks = append(sub.callbacks, change.callback)
+				for _, msgEvent := range sub.latchedMsgs {
+					sub.dispatch(jobChan, logger, msgEvent, []*subscriberCallback{change.callback})
 				}
-
-				name := protocolParams[0].(string)
-				if name == "TCPROS" {
-					addr := protocolParams[1].(string)
-					port := protocolParams[2].(int32)
-					uri := fmt.Sprintf("%s:%d", addr, port)
-					quitChan := make(chan struct{}, 10)
-					sub.connections[pub] = quitChan
-					go startRemotePublisherConn(logger,
-						uri, sub.topic,
-						sub.msgType.MD5Sum(),
-						sub.msgType.Name(), nodeID,
-						sub.msgChan,
-						quitChan,
-						sub.disconnectedChan)
-				} else {
-					logger.Warnf("rosgo Not support protocol '%s'", name)
+				break
+			}
+			for i, c := range sub.callbacks {
+				if c == change.callback {
+					sub.callbacks = append(sub.callbacks[:i:i], sub.callbacks[i+1:]...)
+					break
 				}
 			}
 
-		case callback := <-sub.addCallbackChan:
-			logger.Debug("Receive addCallbackChan")
-			sub.callbacks = append(sub.callbacks, callback)
-
 		case msgEvent := <-sub.msgChan:
 			// Pop received message then bind callbacks and enqueue to the job channle.
 			logger.Debug("Receive msgChan")
-			callbacks := make([]interface{}, len(sub.callbacks))
-			copy(callbacks, sub.callbacks)
-			jobChan <- func() {
-				m := sub.msgType.NewMessage()
-				reader := NewReader(msgEvent.bytes)
-				if err := m.Deserialize(reader); err != nil {
-					logger.Error(err)
-				}
-				args := []reflect.Value{reflect.ValueOf(m), reflect.ValueOf(msgEvent.event)}
-				for _, callback := range callbacks {
-					fun := reflect.ValueOf(callback)
-					numArgsNeeded := fun.Type().NumIn()
-					if numArgsNeeded <= 2 {
-						fun.Call(args[0:numArgsNeeded])
-					}
-				}
+			if sub.statistics != nil {
+				sub.statistics.record(msgEvent.event, msgEvent.bytes)
 			}
+			if msgEvent.event.ConnectionHeader["latching"] == "1" {
+				sub.latchedMsgs[msgEvent.pub] = msgEvent
+			}
+			callbacks := make([]*subscriberCallback, len(sub.callbacks))
+			copy(callbacks, sub.callbacks)
+			sub.dispatch(jobChan, logger, msgEvent, callbacks)
 			logger.Debug("Callback job enqueued.")
 
-		case pubURI := <-sub.disconnectedChan:
-			logger.Debugf("Connection to %s was disconnected.", pubURI)
-			delete(sub.connections, pubURI)
+		case ev := <-sub.linkChan:
+			if sub.connections[ev.pub] != ev.quitChan {
+				// The link was closed by the subscriber.
+				break
+			}
+			status := SubscriberStatus{Topic: sub.topic, Publisher: ev.pub, Connected: ev.connected, Err: ev.err}
+			if ev.connected {
+				delete(sub.retryDelays, ev.pub)
+			} else {
+				delete(sub.connections, ev.pub)
+				sub.retry(ev.pub)
+				logger.Warnf("Connection to %s for topic %s failed, retrying in %v: %v", ev.pub, sub.topic, sub.retryDelays[ev.pub], ev.err)
+			}
+			sub.reportStatus(jobChan, status)
+
+		case pub := <-sub.retryChan:
+			if _, ok := sub.connections[pub]; !ok && contains(sub.pubList, pub) {
+				sub.connect(pub, nodeID, logger)
+			}
 
 		case <-sub.shutdownChan:
 			// Shutdown subscription goroutine
 			logger.Debug("Receive shutdownChan")
+			if !sub.unregistered {
+				_, err := callRosAPI(masterURI, "unregisterSubscriber", nodeID, sub.topic, nodeURI)
+				if err != nil {
+					logger.Warn(err)
+				}
+			}
 			for _, closeChan := range sub.connections {
-				closeChan <- struct{}{}
 				close(closeChan)
 			}
-			_, err := callRosAPI(masterURI, "unregisterSubscriber", nodeID, sub.topic, nodeURI)
-			if err != nil {
-				logger.Warn(err)
+			return
+		}
+	}
+}
+
+// dispatch enqueues the call of callbacks with a message.
+func (sub *defaultSubscriber) dispatch(jobChan chan func(), logger Logger, msgEvent messageEvent, callbacks []*subscriberCallback) {
+	jobChan <- func() {
+		sub.counters.latency.observe(time.Since(msgEvent.event.ReceiptTime))
+		m := sub.msgType.NewMessage()
+		reader := NewReader(msgEvent.bytes)
+		if err := m.Deserialize(reader); err != nil {
+			logger.Error(err)
+		}
+		args := []reflect.Value{reflect.ValueOf(m), reflect.ValueOf(msgEvent.event)}
+		for _, callback := range callbacks {
+			fun := reflect.ValueOf(callback.fn)
+			numArgsNeeded := fun.Type().NumIn()
+			if numArgsNeeded <= 2 {
+				fun.Call(args[0:numArgsNeeded])
 			}
+		}
+	}
+}
 
-			unregisterFromNode()
-			return
+// addCallback adds a message callback to the running subscriber, which
+// receives the last messages of the latched publishers.
+func (sub *defaultSubscriber) addCallback(callback *subscriberCallback) {
+	select {
+	case sub.callbackChan <- callbackChange{callback, true}:
+	case <-sub.doneChan:
+	}
+}
+
+// removeCallback removes a message callback from the running subscriber.
+func (sub *defaultSubscriber) removeCallback(callback *subscriberCallback) {
+	select {
+	case sub.callbackChan <- callbackChange{callback, false}:
+	case <-sub.doneChan:
+	}
+}
+
+// connect starts a link to the publisher at the XML-RPC URI pub.
+func (sub *defaultSubscriber) connect(pub string, nodeID string, logger Logger) {
+	quitChan := make(chan struct{})
+	sub.connections[pub] = quitChan
+	go func() {
+		err := sub.link(pub, nodeID, logger, quitChan)
+		select {
+		case sub.linkChan <- linkEvent{pub: pub, quitChan: quitChan, err: err}:
+		case <-quitChan:
 		}
+	}()
+}
+
+// retry connects to pub again after a delay doubling with each failure.
+func (sub *defaultSubscriber) retry(pub string) {
+	delay, ok := sub.retryDelays[pub]
+	if !ok {
+		delay = minLinkRetryDelay
+	} else if delay *= 2; delay > maxLinkRetryDelay {
+		delay = maxLinkRetryDelay
 	}
+	sub.retryDelays[pub] = delay
+	time.AfterFunc(delay, func() {
+		select {
+		case sub.retryChan <- pub:
+		case <-sub.doneChan:
+		}
+	})
 }
 
-func startRemotePublisherConn(logger Logger,
-	pubURI string, topic string, md5sum string,
-	msgType string, nodeID string,
-	msgChan chan messageEvent,
-	quitChan chan struct{},
-	disconnectedChan chan string) {
-	logger.Debug("startRemotePublisherConn()")
+// reportStatus calls the status callbacks of the handles from Spin.
+func (sub *defaultSubscriber) reportStatus(jobChan chan func(), status SubscriberStatus) {
+	var callbacks []func(SubscriberStatus)
+	for _, c := range sub.callbacks {
+		callbacks = append(callbacks, c.statusCallbacks...)
+	}
+	if len(callbacks) == 0 {
+		return
+	}
+	jobChan <- func() {
+		for _, callback := range callbacks {
+			callback(status)
+		}
+	}
+}
 
+// link requests the topic from the publisher at the XML-RPC URI pub and
+// receives its messages until quitChan is closed or the connection fails.
+func (sub *defaultSubscriber) link(pub string, nodeID string, logger Logger, quitChan chan struct{}) error {
+	logger.Debug("defaultSubscriber.link()")
 	defer func() {
-		logger.Debug("startRemotePublisherConn() exit")
+		logger.Debug("defaultSubscriber.link() exit")
 	}()
 
-	conn, err := net.Dial("tcp", pubURI)
+	protocols := []interface{}{[]interface{}{"TCPROS"}}
+	result, err := callRosAPI(pub, "requestTopic", nodeID, sub.topic, protocols)
+	if err != nil {
+		return fmt.Errorf("requestTopic failed: %v", err)
+	}
+	protocolParams, _ := result.([]interface{})
+	for _, x := range protocolParams {
+		logger.Debug(x)
+	}
+	if len(protocolParams) < 3 || protocolParams[0] != "TCPROS" {
+		return fmt.Errorf("rosgo Not support protocol %v", protocolParams)
+	}
+	addr, _ := protocolParams[1].(string)
+	port, _ := protocolParams[2].(int32)
+	uri := net.JoinHostPort(addr, strconv.Itoa(int(port)))
+
+	conn, err := net.DialTimeout("tcp", uri, linkTimeout)
 	if err != nil {
-		logger.Fatalf("Failed to connect %s!", pubURI)
+		return fmt.Errorf("failed to connect %s: %v", uri, err)
 	}
+	defer conn.Close()
 
 	// 1. Write connection header
 	var headers []header
-	headers = append(headers, header{"topic", topic})
-	headers = append(headers, header{"md5sum", md5sum})
-	headers = append(headers, header{"type", msgType})
+	headers = append(headers, header{"topic", sub.topic})
+	headers = append(headers, header{"md5sum", sub.msgType.MD5Sum()})
+	headers = append(headers, header{"type", sub.msgType.Name()})
 	headers = append(headers, header{"callerid", nodeID})
 	logger.Debug("TCPROS Connection Header")
 	for _, h := range headers {
 		logger.Debugf("  `%s` = `%s`", h.key, h.value)
 	}
+	conn.SetDeadline(time.Now().Add(linkTimeout))
 	err = writeConnectionHeader(headers, conn)
 	if err != nil {
-		logger.Fatal("Failed to write connection header.")
+		return fmt.Errorf("failed to write connection header: %v", err)
 	}
 
 	// 2. Read reponse header
 	var resHeaders []header
 	resHeaders, err = readConnectionHeader(conn)
 	if err != nil {
-		logger.Fatal("Failed to read reasponse header.")
+		return fmt.Errorf("failed to read response header: %v", err)
 	}
 	logger.Debug("TCPROS Response Header:")
 	resHeaderMap := make(map[string]string)
@@ -191,9 +361,16 @@ func startRemotePublisherConn(logger Logger,
 		logger.Debugf("  `%s` = `%s`", h.key, h.value)
 	}
 
-	if md5sum != resHeaderMap["md5sum"] && md5sum != "*" {
-		panic("incompatible message type: md5sum mismatch")
+	if md5sum := sub.msgType.MD5Sum(); md5sum != resHeaderMap["md5sum"] && md5sum != "*" {
+		return fmt.Errorf("incompatible message type: md5sum mismatch, %s vs %s", md5sum, resHeaderMap["md5sum"])
 	}
+	select {
+	case sub.linkChan <- linkEvent{pub: pub, quitChan: quitChan, connected: true}:
+	case <-quitChan:
+		return nil
+	}
+	atomic.AddInt64(&sub.counters.connections, 1)
+	defer atomic.AddInt64(&sub.counters.connections, -1)
 
 	logger.Debug("Start receiving messages...")
 	event := MessageEvent{ // Event struct to be sent with each message.
@@ -208,27 +385,23 @@ func startRemotePublisherConn(logger Logger,
 	for {
 		select {
 		case <-quitChan:
-			return
+			return nil
 		default:
 			conn.SetDeadline(time.Now().Add(1000 * time.Millisecond))
 			if readingSize {
 				//logger.Debug("Reading message size...")
 				err := binary.Read(conn, binary.LittleEndian, &msgSize)
 				if err != nil {
-					if err == io.EOF {
-						logger.Infof("Publisher %s on topic %s disconnected", pubURI, topic)
-						disconnectedChan <- pubURI
-						return
-					}
 					if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
 						// Timed out
 						//logger.Debug(neterr)
 						continue
-					} else {
-						logger.Error("Failed to read a message size", err)
-						disconnectedChan <- pubURI
-						return
 					}
+					if err == io.EOF {
+						logger.Infof("Publisher %s on topic %s disconnected", uri, sub.topic)
+						return fmt.Errorf("publisher disconnected")
+					}
+					return fmt.Errorf("failed to read a message size: %v", err)
 				}
 				logger.Debugf("  %d", msgSize)
 				buffer = make([]byte, int(msgSize))
@@ -237,23 +410,20 @@ func startRemotePublisherConn(logger Logger,
 				//logger.Debug("Reading message body...")
 				_, err = io.ReadFull(conn, buffer)
 				if err != nil {
-					if err == io.EOF {
-						logger.Info("Publisher disconnected")
-						disconnectedChan <- pubURI
-						return
-					}
 					if neterr, ok := err.(net.Error); ok && neterr.Timeout() {
 						// Timed out
 						//logger.Debug(neterr)
 						continue
-					} else {
-						logger.Error("Failed to read a message body", err)
-						disconnectedChan <- pubURI
-						return
 					}
+					return fmt.Errorf("failed to read a message body: %v", err)
 				}
 				event.ReceiptTime = time.Now()
-				msgChan <- messageEvent{bytes: buffer, event: event}
+				sub.counters.add(4 + len(buffer))
+				select {
+				case sub.msgChan <- messageEvent{bytes: buffer, event: event, pub: pub}:
+				case <-quitChan:
+					return nil
+				}
 				readingSize = true
 			}
 		}
@@ -4,7 +4,7 @@ const maxUint32 = int64(^uint32(0))
 
 func normalizeTemporal(sec int64, nsec int64) (uint32, uint32) {
 	const SecondInNanosecond = 1000000000
-	if nsec > SecondInNanosecond {
+	if nsec >= SecondInNanosecond {
 		sec += nsec / SecondInNanosecond
 		nsec = nsec % SecondInNanosecond
 	} else if nsec < 0 {
@@ -16,6 +16,11 @@ func TestNormalizeTemporal(t *testing.T) {
 		t.Error(sec, nsec)
 	}
 
+	sec, nsec = normalizeTemporal(1, 1000000000)
+	if sec != 2 || nsec != 0 {
+		t.Error(sec, nsec)
+	}
+
 	sec, nsec = normalizeTemporal(3, -2000000001)
 	if sec != 0 || nsec != 999999999 {
 		t.Error(sec, nsec)
@@ -0,0 +1,242 @@
+package rosapi
+
+import (
+	"time"
+)
+
+// SystemState maps each topic or service name to the nodes using it.
+type SystemState struct {
+	Publishers  map[string][]string
+	Subscribers map[string][]string
+	Services    map[string][]string
+}
+
+// MasterClient calls the Master API and the Parameter Server API on behalf of
+// the node CallerID.
+type MasterClient struct {
+	URI      string
+	CallerID string
+	// Timeout bounds the duration of the calls, zero for no timeout.
+	Timeout time.Duration
+}
+
+// NewMasterClient creates a client of the master at masterURI.
+func NewMasterClient(masterURI string, callerID string) *MasterClient {
+	return &MasterClient{URI: masterURI, CallerID: callerID}
+}
+
+func (c *MasterClient) call(method string, args ...interface{}) (interface{}, error) {
+	return CallTimeout(c.URI, c.Timeout, method, append([]interface{}{c.CallerID}, args...)...)
+}
+
+// RegisterService registers the caller as a provider of service.
+func (c *MasterClient) RegisterService(service, serviceAPI, callerAPI string) error {
+	_, err := c.call("registerService", service, serviceAPI, callerAPI)
+	return err
+}
+
+// UnregisterService returns the number of unregistrations (0 or 1).
+func (c *MasterClient) UnregisterService(service, serviceAPI string) (int, error) {
+	result, err := c.call("unregisterService", service, serviceAPI)
+	if err != nil {
+		return 0, err
+	}
+	return asInt("unregisterService", result)
+}
+
+// RegisterSubscriber returns the XML-RPC URIs of the current publishers.
+func (c *MasterClient) RegisterSubscriber(topic, topicType, callerAPI string) ([]string, error) {
+	result, err := c.call("registerSubscriber", topic, topicType, callerAPI)
+	if err != nil {
+		return nil, err
+	}
+	return asStringList("registerSubscriber", result)
+}
+
+// UnregisterSubscriber returns the number of unregistrations (0 or 1).
+func (c *MasterClient) UnregisterSubscriber(topic, callerAPI string) (int, error) {
+	result, err := c.call("unregisterSubscriber", topic, callerAPI)
+	if err != nil {
+		return 0, err
+	}
+	return asInt("unregisterSubscriber", result)
+}
+
+// RegisterPublisher returns the XML-RPC URIs of the current subscribers.
+func (c *MasterClient) RegisterPublisher(topic, topicType, callerAPI string) ([]string, error) {
+	result, err := c.call("registerPublisher", topic, topicType, callerAPI)
+	if err != nil {
+		return nil, err
+	}
+	return asStringList("registerPublisher", result)
+}
+
+// UnregisterPublisher returns the number of unregistrations (0 or 1).
+func (c *MasterClient) UnregisterPublisher(topic, callerAPI string) (int, error) {
+	result, err := c.call("unregisterPublisher", topic, callerAPI)
+	if err != nil {
+		return 0, err
+	}
+	return asInt("unregisterPublisher", result)
+}
+
+// LookupNode returns the XML-RPC URI of a node.
+func (c *MasterClient) LookupNode(nodeName string) (string, error) {
+	result, err := c.call("lookupNode", nodeName)
+	if err != nil {
+		return "", err
+	}
+	return asString("lookupNode", result)
+}
+
+// GetPublishedTopics returns the topics having publishers in the namespace
+// subgraph. An empty subgraph means all namespaces.
+func (c *MasterClient) GetPublishedTopics(subgraph string) ([]TopicInfo, error) {
+	result, err := c.call("getPublishedTopics", subgraph)
+	if err != nil {
+		return nil, err
+	}
+	return asTopicInfoList("getPublishedTopics", result)
+}
+
+// GetTopicTypes returns every topic known to the master with its type.
+func (c *MasterClient) GetTopicTypes() ([]TopicInfo, error) {
+	result, err := c.call("getTopicTypes")
+	if err != nil {
+		return nil, err
+	}
+	return asTopicInfoList("getTopicTypes", result)
+}
+
+// GetSystemState returns the publishers, subscribers and services of the
+// ROS graph.
+func (c *MasterClient) GetSystemState() (*SystemState, error) {
+	const method = "getSystemState"
+	result, err := c.call(method)
+	if err != nil {
+		return nil, err
+	}
+	lists, err := asList(method, result)
+	if err != nil {
+		return nil, err
+	}
+	if len(lists) != 3 {
+		return nil, malformed(method, result)
+	}
+	var maps [3]map[string][]string
+	for i, l := range lists {
+		entries, err := asList(method, l)
+		if err != nil {
+			return nil, err
+		}
+		maps[i] = make(map[string][]string)
+		for _, entry := range entries {
+			pair, err := asList(method, entry)
+			if err != nil {
+				return nil, err
+			}
+			if len(pair) != 2 {
+				return nil, malformed(method, entry)
+			}
+			name, err := asString(method, pair[0])
+			if err != nil {
+				return nil, err
+			}
+			nodes, err := asStringList(method, pair[1])
+			if err != nil {
+				return nil, err
+			}
+			maps[i][name] = nodes
+		}
+	}
+	return &SystemState{maps[0], maps[1], maps[2]}, nil
+}
+
+// GetURI returns the URI of the master.
+func (c *MasterClient) GetURI() (string, error) {
+	result, err := c.call("getUri")
+	if err != nil {
+		return "", err
+	}
+	return asString("getUri", result)
+}
+
+// GetPid returns the process ID of the master.
+func (c *MasterClient) GetPid() (int, error) {
+	result, err := c.call("getPid")
+	if err != nil {
+		return 0, err
+	}
+	return asInt("getPid", result)
+}
+
+// LookupService returns the rosrpc URI of a service.
+func (c *MasterClient) LookupService(service string) (string, error) {
+	result, err := c.call("lookupService", service)
+	if err != nil {
+		return "", err
+	}
+	return asString("lookupService", result)
+}
+
+// DeleteParam deletes a parameter or a namespace.
+func (c *MasterClient) DeleteParam(key string) error {
+	_, err := c.call("deleteParam", key)
+	return err
+}
+
+// SetParam sets a parameter. Dictionaries (map[string]interface{}) replace the
+// whole namespace.
+func (c *MasterClient) SetParam(key string, value interface{}) error {
+	_, err := c.call("setParam", key, value)
+	return err
+}
+
+// GetParam returns the value of a parameter. Namespaces are returned as
+// map[string]interface{}.
+func (c *MasterClient) GetParam(key string) (interface{}, error) {
+	return c.call("getParam", key)
+}
+
+// SearchParam searches key upwards from the namespace of the caller and
+// returns the first matching global name.
+func (c *MasterClient) SearchParam(key string) (string, error) {
+	result, err := c.call("searchParam", key)
+	if err != nil {
+		return "", err
+	}
+	return asString("searchParam", result)
+}
+
+// SubscribeParam subscribes the caller to updates of key and returns its
+// current value, or an empty dictionary if it is not set.
+func (c *MasterClient) SubscribeParam(callerAPI, key string) (interface{}, error) {
+	return c.call("subscribeParam", callerAPI, key)
+}
+
+// UnsubscribeParam returns the number of unsubscriptions (0 or 1).
+func (c *MasterClient) UnsubscribeParam(callerAPI, key string) (int, error) {
+	result, err := c.call("unsubscribeParam", callerAPI, key)
+	if err != nil {
+		return 0, err
+	}
+	return asInt("unsubscribeParam", result)
+}
+
+// HasParam checks whether a parameter is set.
+func (c *MasterClient) HasParam(key string) (bool, error) {
+	result, err := c.call("hasParam", key)
+	if err != nil {
+		return false, err
+	}
+	return asBool("hasParam", result)
+}
+
+// GetParamNames returns the names of all parameters.
+func (c *MasterClient) GetParamNames() ([]string, error) {
+	result, err := c.call("getParamNames")
+	if err != nil {
+		return nil, err
+	}
+	return asStringList("getParamNames", result)
+}
@@ -0,0 +1,156 @@
+// Package rosapi provides typed clients for the ROS Master API and the Slave
+// API of remote nodes.
+//
+// Every call returns the value of the [code, statusMessage, value] triplet
+// converted to Go types. Calls answered with a status other than success fail
+// with an *Error which keeps the code and message reported by the callee.
+package rosapi
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/xmlrpc"
+)
+
+// Status codes of the ROS API result triplet.
+const (
+	StatusError   = -1
+	StatusFailure = 0
+	StatusSuccess = 1
+)
+
+// Error is returned when the callee reports a failure.
+type Error struct {
+	Method  string
+	Code    int32
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("ROS API call %s failed with code %d: %s", e.Method, e.Code, e.Message)
+}
+
+// Call invokes a ROS API method at uri and returns the value of the result
+// triplet.
+func Call(uri string, method string, args ...interface{}) (interface{}, error) {
+	return CallTimeout(uri, 0, method, args...)
+}
+
+// CallTimeout invokes a ROS API method like Call but fails when the call
+// takes longer than timeout. A zero timeout means no timeout.
+func CallTimeout(uri string, timeout time.Duration, method string, args ...interface{}) (interface{}, error) {
+	result, err := xmlrpc.CallTimeout(uri, timeout, method, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	xs, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("malformed ROS API result")
+	}
+	if len(xs) != 3 {
+		return nil, fmt.Errorf("Malformed ROS API result. Length must be 3 but %d", len(xs))
+	}
+	code, ok := xs[0].(int32)
+	if !ok {
+		return nil, fmt.Errorf("status code is not int")
+	}
+	message, ok := xs[1].(string)
+	if !ok {
+		return nil, fmt.Errorf("message is not string")
+	}
+	if code != StatusSuccess {
+		return nil, &Error{method, code, message}
+	}
+	return xs[2], nil
+}
+
+// BuildResult builds an XML-RPC ready array from a ROS API result triplet.
+func BuildResult(code int32, message string, value interface{}) interface{} {
+	return []interface{}{code, message, value}
+}
+
+// TopicInfo is a topic name with its message type.
+type TopicInfo struct {
+	Name string
+	Type string
+}
+
+func malformed(method string, value interface{}) error {
+	return fmt.Errorf("malformed result of %s: %v", method, value)
+}
+
+func asString(method string, value interface{}) (string, error) {
+	s, ok := value.(string)
+	if !ok {
+		return "", malformed(method, value)
+	}
+	return s, nil
+}
+
+func asInt(method string, value interface{}) (int, error) {
+	i, ok := value.(int32)
+	if !ok {
+		return 0, malformed(method, value)
+	}
+	return int(i), nil
+}
+
+func asBool(method string, value interface{}) (bool, error) {
+	b, ok := value.(bool)
+	if !ok {
+		return false, malformed(method, value)
+	}
+	return b, nil
+}
+
+func asList(method string, value interface{}) ([]interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	// Empty arrays may be encoded as empty strings by some implementations.
+	if s, ok := value.(string); ok && len(s) == 0 {
+		return nil, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, malformed(method, value)
+	}
+	return list, nil
+}
+
+func asStringList(method string, value interface{}) ([]string, error) {
+	list, err := asList(method, value)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, item := range list {
+		s, err := asString(method, item)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, nil
+}
+
+func asTopicInfoList(method string, value interface{}) ([]TopicInfo, error) {
+	list, err := asList(method, value)
+	if err != nil {
+		return nil, err
+	}
+	result := []TopicInfo{}
+	for _, item := range list {
+		pair, err := asStringList(method, item)
+		if err != nil {
+			return nil, err
+		}
+		if len(pair) != 2 {
+			return nil, malformed(method, item)
+		}
+		result = append(result, TopicInfo{pair[0], pair[1]})
+	}
+	return result, nil
+}
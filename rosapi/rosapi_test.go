@@ -0,0 +1,169 @@
+package rosapi
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/xmlrpc"
+)
+
+func TestMasterClient(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	c := NewMasterClient(m.URI(), "/ns/node")
+	if uri, err := c.GetURI(); err != nil || uri != m.URI() {
+		t.Errorf("GetURI: %q, %v", uri, err)
+	}
+	if _, err := c.GetPid(); err != nil {
+		t.Error(err)
+	}
+
+	const api = "http://127.0.0.1:1/"
+	if subs, err := c.RegisterPublisher("/chatter", "std_msgs/String", api); err != nil || len(subs) != 0 {
+		t.Errorf("RegisterPublisher: %v, %v", subs, err)
+	}
+	if pubs, err := c.RegisterSubscriber("/chatter", "std_msgs/String", api); err != nil || !reflect.DeepEqual(pubs, []string{api}) {
+		t.Errorf("RegisterSubscriber: %v, %v", pubs, err)
+	}
+	if err := c.RegisterService("/ns/srv", "rosrpc://127.0.0.1:2", api); err != nil {
+		t.Error(err)
+	}
+
+	topics, err := c.GetPublishedTopics("")
+	if err != nil || !reflect.DeepEqual(topics, []TopicInfo{{"/chatter", "std_msgs/String"}}) {
+		t.Errorf("GetPublishedTopics: %v, %v", topics, err)
+	}
+	state, err := c.GetSystemState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &SystemState{
+		Publishers:  map[string][]string{"/chatter": {"/ns/node"}},
+		Subscribers: map[string][]string{"/chatter": {"/ns/node"}},
+		Services:    map[string][]string{"/ns/srv": {"/ns/node"}},
+	}
+	if !reflect.DeepEqual(state, expected) {
+		t.Errorf("GetSystemState: expected %v but %v", expected, state)
+	}
+	if uri, err := c.LookupNode("/ns/node"); err != nil || uri != api {
+		t.Errorf("LookupNode: %q, %v", uri, err)
+	}
+	if uri, err := c.LookupService("srv"); err != nil || uri != "rosrpc://127.0.0.1:2" {
+		t.Errorf("LookupService: %q, %v", uri, err)
+	}
+
+	_, err = c.LookupNode("/unknown")
+	if e, ok := err.(*Error); !ok || e.Code == StatusSuccess || e.Method != "lookupNode" {
+		t.Errorf("LookupNode of unknown node: %#v", err)
+	}
+
+	if n, err := c.UnregisterPublisher("/chatter", api); err != nil || n != 1 {
+		t.Errorf("UnregisterPublisher: %d, %v", n, err)
+	}
+	if n, err := c.UnregisterPublisher("/chatter", api); err != nil || n != 0 {
+		t.Errorf("UnregisterPublisher twice: %d, %v", n, err)
+	}
+}
+
+func TestMasterClientParams(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+
+	c := NewMasterClient(m.URI(), "/ns/node")
+	if err := c.SetParam("/ns/a", map[string]interface{}{"b": int32(1), "c": "x"}); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.GetParam("/ns/a/b"); err != nil || v != int32(1) {
+		t.Errorf("GetParam: %v, %v", v, err)
+	}
+	if ok, err := c.HasParam("/ns/a/c"); err != nil || !ok {
+		t.Errorf("HasParam: %v, %v", ok, err)
+	}
+	if key, err := c.SearchParam("a"); err != nil || key != "/ns/a" {
+		t.Errorf("SearchParam: %q, %v", key, err)
+	}
+	if names, err := c.GetParamNames(); err != nil || !reflect.DeepEqual(names, []string{"/ns/a/b", "/ns/a/c"}) {
+		t.Errorf("GetParamNames: %v, %v", names, err)
+	}
+	if err := c.DeleteParam("/ns/a"); err != nil {
+		t.Error(err)
+	}
+	_, err = c.GetParam("/ns/a")
+	if e, ok := err.(*Error); !ok || e.Code == StatusSuccess {
+		t.Errorf("GetParam of deleted parameter: %#v", err)
+	}
+}
+
+func TestSlaveClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := xmlrpc.NewHandler(map[string]xmlrpc.Method{
+		"getPid": func(callerID string) (interface{}, error) {
+			return BuildResult(StatusSuccess, "", int32(42)), nil
+		},
+		"getPublications": func(callerID string) (interface{}, error) {
+			return BuildResult(StatusSuccess, "", []interface{}{[]interface{}{"/chatter", "std_msgs/String"}}), nil
+		},
+		"getBusStats": func(callerID string) (interface{}, error) {
+			return BuildResult(StatusSuccess, "", []interface{}{
+				[]interface{}{[]interface{}{"/chatter", int32(10), []interface{}{[]interface{}{int32(1), int32(100), int32(10), true}}}},
+				[]interface{}{[]interface{}{"/in", []interface{}{[]interface{}{int32(2), int32(50), int32(0), false}}}},
+				[]interface{}{int32(3), int32(4), int32(5)},
+			}), nil
+		},
+		"getBusInfo": func(callerID string) (interface{}, error) {
+			return BuildResult(StatusSuccess, "", []interface{}{
+				[]interface{}{int32(1), "/listener", "o", "TCPROS", "/chatter", true, "info"},
+			}), nil
+		},
+		"shutdown": func(callerID string, msg string) (interface{}, error) {
+			return BuildResult(StatusFailure, "refused", int32(0)), nil
+		},
+	})
+	go http.Serve(listener, handler)
+	defer func() {
+		listener.Close()
+		handler.WaitForShutdown()
+	}()
+
+	c := NewSlaveClient(fmt.Sprintf("http://%s/", listener.Addr()), "/caller")
+	if pid, err := c.GetPid(); err != nil || pid != 42 {
+		t.Errorf("GetPid: %d, %v", pid, err)
+	}
+	if pubs, err := c.GetPublications(); err != nil || !reflect.DeepEqual(pubs, []TopicInfo{{"/chatter", "std_msgs/String"}}) {
+		t.Errorf("GetPublications: %v, %v", pubs, err)
+	}
+	stats, err := c.GetBusStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStats := &BusStats{
+		Publish:   []PublishStats{{"/chatter", 10, []PublishConnectionStats{{1, 100, 10, true}}}},
+		Subscribe: []SubscribeStats{{"/in", []SubscribeConnectionStats{{2, 50, 0, false}}}},
+		Service:   ServiceStats{3, 4, 5},
+	}
+	if !reflect.DeepEqual(stats, expectedStats) {
+		t.Errorf("GetBusStats: expected %v but %v", expectedStats, stats)
+	}
+	info, err := c.GetBusInfo()
+	if err != nil || !reflect.DeepEqual(info, []BusInfo{{1, "/listener", "o", "TCPROS", "/chatter", true, "info"}}) {
+		t.Errorf("GetBusInfo: %v, %v", info, err)
+	}
+	err = c.Shutdown("bye")
+	if e, ok := err.(*Error); !ok || e.Code != StatusFailure || e.Message != "refused" {
+		t.Errorf("Shutdown: %#v", err)
+	}
+}
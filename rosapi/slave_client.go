@@ -0,0 +1,319 @@
+package rosapi
+
+import (
+	"time"
+)
+
+// PublishStats is the getBusStats entry of a published topic.
+type PublishStats struct {
+	Topic            string
+	MessageDataSent  int
+	ConnectionsStats []PublishConnectionStats
+}
+
+// PublishConnectionStats describes a connection to a subscriber.
+type PublishConnectionStats struct {
+	ConnectionID    int
+	BytesSent       int
+	NumSentMessages int
+	Connected       bool
+}
+
+// SubscribeStats is the getBusStats entry of a subscribed topic.
+type SubscribeStats struct {
+	Topic            string
+	ConnectionsStats []SubscribeConnectionStats
+}
+
+// SubscribeConnectionStats describes a connection to a publisher.
+type SubscribeConnectionStats struct {
+	ConnectionID  int
+	BytesReceived int
+	DropEstimate  int
+	Connected     bool
+}
+
+// ServiceStats is the service part of getBusStats.
+type ServiceStats struct {
+	NumRequests   int
+	BytesReceived int
+	BytesSent     int
+}
+
+// BusStats is the result of getBusStats.
+type BusStats struct {
+	Publish   []PublishStats
+	Subscribe []SubscribeStats
+	Service   ServiceStats
+}
+
+// BusInfo describes a connection of a node.
+type BusInfo struct {
+	ConnectionID  int
+	DestinationID string
+	Direction     string
+	Transport     string
+	Topic         string
+	Connected     bool
+	Info          string
+}
+
+// SlaveClient calls the Slave API of a node on behalf of the node CallerID.
+type SlaveClient struct {
+	URI      string
+	CallerID string
+	// Timeout bounds the duration of the calls, zero for no timeout.
+	Timeout time.Duration
+}
+
+// NewSlaveClient creates a client of the node serving its Slave API at
+// nodeURI.
+func NewSlaveClient(nodeURI string, callerID string) *SlaveClient {
+	return &SlaveClient{URI: nodeURI, CallerID: callerID}
+}
+
+func (c *SlaveClient) call(method string, args ...interface{}) (interface{}, error) {
+	return CallTimeout(c.URI, c.Timeout, method, append([]interface{}{c.CallerID}, args...)...)
+}
+
+// asInts converts a list of integers of an expected length.
+func asInts(method string, value interface{}, n int) ([]int, error) {
+	list, err := asList(method, value)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) < n {
+		return nil, malformed(method, value)
+	}
+	result := make([]int, n)
+	for i := 0; i < n; i++ {
+		if result[i], err = asInt(method, list[i]); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// GetBusStats returns the transport statistics of the node.
+func (c *SlaveClient) GetBusStats() (*BusStats, error) {
+	const method = "getBusStats"
+	result, err := c.call(method)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := asList(method, result)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) != 3 {
+		return nil, malformed(method, result)
+	}
+	stats := &BusStats{}
+
+	pubs, err := asList(method, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pubs {
+		entry, err := asList(method, p)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 3 {
+			return nil, malformed(method, p)
+		}
+		var s PublishStats
+		if s.Topic, err = asString(method, entry[0]); err != nil {
+			return nil, err
+		}
+		if s.MessageDataSent, err = asInt(method, entry[1]); err != nil {
+			return nil, err
+		}
+		conns, err := asList(method, entry[2])
+		if err != nil {
+			return nil, err
+		}
+		for _, conn := range conns {
+			fields, err := asList(method, conn)
+			if err != nil {
+				return nil, err
+			}
+			ints, err := asInts(method, fields, 3)
+			if err != nil || len(fields) != 4 {
+				return nil, malformed(method, conn)
+			}
+			connected, err := asBool(method, fields[3])
+			if err != nil {
+				return nil, err
+			}
+			s.ConnectionsStats = append(s.ConnectionsStats, PublishConnectionStats{ints[0], ints[1], ints[2], connected})
+		}
+		stats.Publish = append(stats.Publish, s)
+	}
+
+	subs, err := asList(method, parts[1])
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range subs {
+		entry, err := asList(method, p)
+		if err != nil {
+			return nil, err
+		}
+		if len(entry) != 2 {
+			return nil, malformed(method, p)
+		}
+		var s SubscribeStats
+		if s.Topic, err = asString(method, entry[0]); err != nil {
+			return nil, err
+		}
+		conns, err := asList(method, entry[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, conn := range conns {
+			fields, err := asList(method, conn)
+			if err != nil {
+				return nil, err
+			}
+			ints, err := asInts(method, fields, 3)
+			if err != nil || len(fields) != 4 {
+				return nil, malformed(method, conn)
+			}
+			connected, err := asBool(method, fields[3])
+			if err != nil {
+				return nil, err
+			}
+			s.ConnectionsStats = append(s.ConnectionsStats, SubscribeConnectionStats{ints[0], ints[1], ints[2], connected})
+		}
+		stats.Subscribe = append(stats.Subscribe, s)
+	}
+
+	if srv, err := asList(method, parts[2]); err == nil && len(srv) == 3 {
+		ints, err := asInts(method, srv, 3)
+		if err != nil {
+			return nil, err
+		}
+		stats.Service = ServiceStats{ints[0], ints[1], ints[2]}
+	}
+	return stats, nil
+}
+
+// GetBusInfo returns the connections of the node.
+func (c *SlaveClient) GetBusInfo() ([]BusInfo, error) {
+	const method = "getBusInfo"
+	result, err := c.call(method)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := asList(method, result)
+	if err != nil {
+		return nil, err
+	}
+	infos := []BusInfo{}
+	for _, e := range entries {
+		fields, err := asList(method, e)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) < 6 {
+			return nil, malformed(method, e)
+		}
+		var info BusInfo
+		if info.ConnectionID, err = asInt(method, fields[0]); err != nil {
+			return nil, err
+		}
+		strs := []*string{&info.DestinationID, &info.Direction, &info.Transport, &info.Topic}
+		for i, s := range strs {
+			if *s, err = asString(method, fields[i+1]); err != nil {
+				return nil, err
+			}
+		}
+		if info.Connected, err = asBool(method, fields[5]); err != nil {
+			// Older implementations report the connection state as an integer.
+			connected, err := asInt(method, fields[5])
+			if err != nil {
+				return nil, err
+			}
+			info.Connected = connected != 0
+		}
+		if len(fields) > 6 {
+			info.Info, _ = fields[6].(string)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// GetMasterURI returns the URI of the master the node is using.
+func (c *SlaveClient) GetMasterURI() (string, error) {
+	result, err := c.call("getMasterUri")
+	if err != nil {
+		return "", err
+	}
+	return asString("getMasterUri", result)
+}
+
+// Shutdown requests the node to shut down.
+func (c *SlaveClient) Shutdown(msg string) error {
+	_, err := c.call("shutdown", msg)
+	return err
+}
+
+// GetPid returns the process ID of the node.
+func (c *SlaveClient) GetPid() (int, error) {
+	result, err := c.call("getPid")
+	if err != nil {
+		return 0, err
+	}
+	return asInt("getPid", result)
+}
+
+// GetSubscriptions returns the topics the node subscribes to.
+func (c *SlaveClient) GetSubscriptions() ([]TopicInfo, error) {
+	result, err := c.call("getSubscriptions")
+	if err != nil {
+		return nil, err
+	}
+	return asTopicInfoList("getSubscriptions", result)
+}
+
+// GetPublications returns the topics the node publishes.
+func (c *SlaveClient) GetPublications() ([]TopicInfo, error) {
+	result, err := c.call("getPublications")
+	if err != nil {
+		return nil, err
+	}
+	return asTopicInfoList("getPublications", result)
+}
+
+// ParamUpdate notifies the node of a new value of a subscribed parameter.
+func (c *SlaveClient) ParamUpdate(key string, value interface{}) error {
+	_, err := c.call("paramUpdate", key, value)
+	return err
+}
+
+// PublisherUpdate notifies the node of the current publishers of topic.
+func (c *SlaveClient) PublisherUpdate(topic string, publishers []string) error {
+	uris := make([]interface{}, len(publishers))
+	for i, uri := range publishers {
+		uris[i] = uri
+	}
+	_, err := c.call("publisherUpdate", topic, uris)
+	return err
+}
+
+// RequestTopic asks the node for a connection to topic using one of the
+// given protocols, e.g. []interface{}{"TCPROS"}. It returns the parameters of
+// the selected protocol.
+func (c *SlaveClient) RequestTopic(topic string, protocols ...[]interface{}) ([]interface{}, error) {
+	list := make([]interface{}, len(protocols))
+	for i, p := range protocols {
+		list[i] = p
+	}
+	result, err := c.call("requestTopic", topic, list)
+	if err != nil {
+		return nil, err
+	}
+	return asList("requestTopic", result)
+}
@@ -0,0 +1,350 @@
+package rosbag
+
+import (
+	"bytes"
+	"sort"
+)
+
+// The standard library only decompresses bzip2, so chunks are compressed
+// with this encoder. It favours simplicity over ratio: blocks are sorted
+// with prefix doubling and coded with a single Huffman table.
+
+const (
+	bz2Level    = 9
+	bz2MaxBlock = bz2Level*100000 - 19
+	bz2MaxCode  = 17
+	bz2Group    = 50
+)
+
+// bz2CRC is the non reflected CRC-32 of bzip2.
+var bz2CRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		table[i] = c
+	}
+	return table
+}()
+
+func bz2CRC(crc uint32, b []byte) uint32 {
+	crc = ^crc
+	for _, c := range b {
+		crc = crc<<8 ^ bz2CRCTable[byte(crc>>24)^c]
+	}
+	return ^crc
+}
+
+type bitWriter struct {
+	buf   bytes.Buffer
+	bits  uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(n uint, v uint64) {
+	w.bits = w.bits<<n | v&(1<<n-1)
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.nbits -= 8
+		w.buf.WriteByte(byte(w.bits >> w.nbits))
+	}
+}
+
+func (w *bitWriter) flush() []byte {
+	if w.nbits > 0 {
+		w.write(8-w.nbits, 0)
+	}
+	return w.buf.Bytes()
+}
+
+// bz2Compress compresses src into a bzip2 stream.
+func bz2Compress(src []byte) []byte {
+	w := &bitWriter{}
+	w.buf.WriteString("BZh")
+	w.buf.WriteByte('0' + bz2Level)
+	var combined uint32
+	for len(src) > 0 {
+		block, n := bz2RLE(src)
+		crc := bz2CRC(0, src[:n])
+		combined = (combined<<1 | combined>>31) ^ crc
+		bz2WriteBlock(w, block, crc)
+		src = src[n:]
+	}
+	w.write(24, 0x177245)
+	w.write(24, 0x385090)
+	w.write(32, uint64(combined))
+	return w.flush()
+}
+
+// bz2RLE encodes runs of 4 to 255 equal bytes as 4 bytes and a count. It
+// returns the encoded block and the number of bytes of src it holds.
+func bz2RLE(src []byte) ([]byte, int) {
+	var out []byte
+	i := 0
+	for i < len(src) && len(out) < bz2MaxBlock-5 {
+		c := src[i]
+		n := 1
+		for n < 255 && i+n < len(src) && src[i+n] == c {
+			n++
+		}
+		if n >= 4 {
+			out = append(out, c, c, c, c, byte(n-4))
+		} else {
+			for j := 0; j < n; j++ {
+				out = append(out, c)
+			}
+		}
+		i += n
+	}
+	return out, i
+}
+
+// bz2BWT returns the last column of the sorted rotations of data and the
+// row of the original string.
+func bz2BWT(data []byte) ([]byte, int) {
+	n := len(data)
+	p := make([]int32, n)
+	c := make([]int32, n)
+	pn := make([]int32, n)
+	cn := make([]int32, n)
+	size := n
+	if size < 256 {
+		size = 256
+	}
+	cnt := make([]int32, size)
+
+	for _, b := range data {
+		cnt[b]++
+	}
+	for i := 1; i < 256; i++ {
+		cnt[i] += cnt[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		cnt[data[i]]--
+		p[cnt[data[i]]] = int32(i)
+	}
+	classes := int32(1)
+	for i := 1; i < n; i++ {
+		if data[p[i]] != data[p[i-1]] {
+			classes++
+		}
+		c[p[i]] = classes - 1
+	}
+
+	for h := 1; h < n && int(classes) < n; h <<= 1 {
+		for i := range p {
+			pn[i] = p[i] - int32(h)
+			if pn[i] < 0 {
+				pn[i] += int32(n)
+			}
+		}
+		for i := int32(0); i < classes; i++ {
+			cnt[i] = 0
+		}
+		for i := range pn {
+			cnt[c[pn[i]]]++
+		}
+		for i := int32(1); i < classes; i++ {
+			cnt[i] += cnt[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			cnt[c[pn[i]]]--
+			p[cnt[c[pn[i]]]] = pn[i]
+		}
+		cn[p[0]] = 0
+		classes = 1
+		for i := 1; i < n; i++ {
+			cur, prev := p[i], p[i-1]
+			if c[cur] != c[prev] || c[(int(cur)+h)%n] != c[(int(prev)+h)%n] {
+				classes++
+			}
+			cn[cur] = classes - 1
+		}
+		c, cn = cn, c
+	}
+
+	last := make([]byte, n)
+	origPtr := 0
+	for i, start := range p {
+		if start == 0 {
+			origPtr = i
+		}
+		last[i] = data[(int(start)+n-1)%n]
+	}
+	return last, origPtr
+}
+
+// bz2MTF applies the move to front transform and the run length coding of
+// zeros. It returns the symbols ending with the end of block symbol, the
+// used bytes and the size of the alphabet.
+func bz2MTF(data []byte) ([]uint16, [256]bool, int) {
+	var used [256]bool
+	for _, b := range data {
+		used[b] = true
+	}
+	var order []byte
+	for b := 0; b < 256; b++ {
+		if used[b] {
+			order = append(order, byte(b))
+		}
+	}
+	alphaSize := len(order) + 2
+
+	var symbols []uint16
+	run := 0
+	flushRun := func() {
+		for run > 0 {
+			if run&1 == 1 {
+				symbols = append(symbols, 0) // RUNA
+				run = (run - 1) / 2
+			} else {
+				symbols = append(symbols, 1) // RUNB
+				run = (run - 2) / 2
+			}
+		}
+	}
+	for _, b := range data {
+		j := bytes.IndexByte(order, b)
+		if j == 0 {
+			run++
+			continue
+		}
+		flushRun()
+		copy(order[1:j+1], order[:j])
+		order[0] = b
+		symbols = append(symbols, uint16(j+1))
+	}
+	flushRun()
+	symbols = append(symbols, uint16(alphaSize-1))
+	return symbols, used, alphaSize
+}
+
+// bz2CodeLengths builds Huffman code lengths of at most bz2MaxCode bits.
+func bz2CodeLengths(freqs []int) []uint8 {
+	weights := make([]int, len(freqs))
+	for i, f := range freqs {
+		weights[i] = f
+		if weights[i] == 0 {
+			weights[i] = 1
+		}
+	}
+	for {
+		lengths := huffmanLengths(weights)
+		ok := true
+		for _, l := range lengths {
+			if l > bz2MaxCode {
+				ok = false
+			}
+		}
+		if ok {
+			return lengths
+		}
+		for i := range weights {
+			weights[i] = 1 + weights[i]/2
+		}
+	}
+}
+
+func huffmanLengths(weights []int) []uint8 {
+	type node struct {
+		weight int
+		leaves []int
+	}
+	nodes := make([]node, len(weights))
+	for i, w := range weights {
+		nodes[i] = node{w, []int{i}}
+	}
+	lengths := make([]uint8, len(weights))
+	for len(nodes) > 1 {
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+		a, b := nodes[0], nodes[1]
+		merged := node{a.weight + b.weight, append(append([]int{}, a.leaves...), b.leaves...)}
+		for _, leaf := range merged.leaves {
+			lengths[leaf]++
+		}
+		nodes = append(nodes[2:], merged)
+	}
+	return lengths
+}
+
+func bz2WriteBlock(w *bitWriter, block []byte, crc uint32) {
+	last, origPtr := bz2BWT(block)
+	symbols, used, alphaSize := bz2MTF(last)
+
+	w.write(24, 0x314159)
+	w.write(24, 0x265359)
+	w.write(32, uint64(crc))
+	w.write(1, 0) // not randomized
+	w.write(24, uint64(origPtr))
+
+	var ranges uint64
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			if used[i*16+j] {
+				ranges |= 1 << uint(15-i)
+				break
+			}
+		}
+	}
+	w.write(16, ranges)
+	for i := 0; i < 16; i++ {
+		if ranges&(1<<uint(15-i)) == 0 {
+			continue
+		}
+		var bits uint64
+		for j := 0; j < 16; j++ {
+			if used[i*16+j] {
+				bits |= 1 << uint(15-j)
+			}
+		}
+		w.write(16, bits)
+	}
+
+	// Two identical tables, the minimum allowed, all groups using the first.
+	freqs := make([]int, alphaSize)
+	for _, s := range symbols {
+		freqs[s]++
+	}
+	lengths := bz2CodeLengths(freqs)
+	selectors := (len(symbols) + bz2Group - 1) / bz2Group
+	w.write(3, 2)
+	w.write(15, uint64(selectors))
+	for i := 0; i < selectors; i++ {
+		w.write(1, 0)
+	}
+	for t := 0; t < 2; t++ {
+		cur := lengths[0]
+		w.write(5, uint64(cur))
+		for _, l := range lengths {
+			for ; cur < l; cur++ {
+				w.write(2, 2)
+			}
+			for ; cur > l; cur-- {
+				w.write(2, 3)
+			}
+			w.write(1, 0)
+		}
+	}
+
+	// Canonical codes in the order of lengths then symbols.
+	codes := make([]uint32, alphaSize)
+	code := uint32(0)
+	for l := uint8(1); l <= bz2MaxCode; l++ {
+		for s, sl := range lengths {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	for _, s := range symbols {
+		w.write(uint(lengths[s]), uint64(codes[s]))
+	}
+}
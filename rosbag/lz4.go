@@ -0,0 +1,435 @@
+package rosbag
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/bits"
+)
+
+// LZ4 frames as written by roslz4: independent blocks without block
+// checksums, followed by a checksum of the content. The reader accepts any
+// frame of the LZ4 frame format.
+
+const (
+	lz4Magic          = 0x184d2204
+	lz4SkippableMagic = 0x184d2a50
+	lz4SkippableMask  = 0xfffffff0
+	lz4BlockSizeID    = 7
+	lz4MinMatch       = 4
+	lz4MaxOffset      = 65535
+	lz4HashLog        = 16
+	lz4History        = 64 * 1024
+)
+
+var errLZ4 = errors.New("rosbag: malformed lz4 data")
+
+func lz4BlockSize(id byte) int {
+	return 1 << (8 + 2*uint(id))
+}
+
+// lz4Compress compresses src into a single frame.
+func lz4Compress(src []byte) []byte {
+	const flags = 1<<6 | 1<<5 | 1<<2 // version 1, independent blocks, content checksum
+	descriptor := []byte{flags, lz4BlockSizeID << 4}
+	out := make([]byte, 4, len(src)/2+32)
+	binary.LittleEndian.PutUint32(out, lz4Magic)
+	out = append(out, descriptor...)
+	out = append(out, byte(xxh32(descriptor)>>8))
+
+	checksum := xxh32(src)
+	blockSize := lz4BlockSize(lz4BlockSizeID)
+	for len(src) > 0 {
+		n := len(src)
+		if n > blockSize {
+			n = blockSize
+		}
+		block := lz4CompressBlock(src[:n])
+		if len(block) >= n {
+			out = appendUint32(out, uint32(n)|1<<31)
+			out = append(out, src[:n]...)
+		} else {
+			out = appendUint32(out, uint32(len(block)))
+			out = append(out, block...)
+		}
+		src = src[n:]
+	}
+	out = appendUint32(out, 0)
+	return appendUint32(out, checksum)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// lz4CompressBlock compresses a block with a greedy search of 4 byte matches.
+func lz4CompressBlock(src []byte) []byte {
+	var table [1 << lz4HashLog]int
+	dst := make([]byte, 0, len(src))
+	anchor := 0
+	// The last match starts at least 12 bytes and ends at least 5 bytes
+	// before the end of the block.
+	limit := len(src) - 12
+	for i := 0; i < limit; {
+		seq := binary.LittleEndian.Uint32(src[i:])
+		h := (seq * 2654435761) >> (32 - lz4HashLog)
+		ref := table[h] - 1
+		table[h] = i + 1
+		if ref < 0 || i-ref > lz4MaxOffset || binary.LittleEndian.Uint32(src[ref:]) != seq {
+			i++
+			continue
+		}
+		for i > anchor && ref > 0 && src[i-1] == src[ref-1] {
+			i--
+			ref--
+		}
+		length := lz4MinMatch
+		for i+length < len(src)-5 && src[i+length] == src[ref+length] {
+			length++
+		}
+		dst = lz4AppendSequence(dst, src[anchor:i], i-ref, length)
+		i += length
+		anchor = i
+	}
+	return lz4AppendSequence(dst, src[anchor:], 0, 0)
+}
+
+func lz4AppendLength(dst []byte, n int) []byte {
+	for ; n >= 255; n -= 255 {
+		dst = append(dst, 255)
+	}
+	return append(dst, byte(n))
+}
+
+// lz4AppendSequence appends literals followed by a match. The last sequence
+// of a block has no match.
+func lz4AppendSequence(dst []byte, literals []byte, offset int, length int) []byte {
+	token := byte(0)
+	if len(literals) >= 15 {
+		token = 15 << 4
+	} else {
+		token = byte(len(literals)) << 4
+	}
+	if length > 0 {
+		if length-lz4MinMatch >= 15 {
+			token |= 15
+		} else {
+			token |= byte(length - lz4MinMatch)
+		}
+	}
+	dst = append(dst, token)
+	if len(literals) >= 15 {
+		dst = lz4AppendLength(dst, len(literals)-15)
+	}
+	dst = append(dst, literals...)
+	if length > 0 {
+		dst = append(dst, byte(offset), byte(offset>>8))
+		if length-lz4MinMatch >= 15 {
+			dst = lz4AppendLength(dst, length-lz4MinMatch-15)
+		}
+	}
+	return dst
+}
+
+// lz4DecompressBlock appends the decompressed block to dst, whose content
+// may be referenced by matches.
+func lz4DecompressBlock(dst []byte, src []byte) ([]byte, error) {
+	readLength := func(n int) (int, error) {
+		for {
+			if len(src) == 0 {
+				return 0, errLZ4
+			}
+			b := src[0]
+			src = src[1:]
+			n += int(b)
+			if b != 255 {
+				return n, nil
+			}
+		}
+	}
+	for len(src) > 0 {
+		token := src[0]
+		src = src[1:]
+		n := int(token >> 4)
+		if n == 15 {
+			var err error
+			if n, err = readLength(n); err != nil {
+				return nil, err
+			}
+		}
+		if len(src) < n {
+			return nil, errLZ4
+		}
+		dst = append(dst, src[:n]...)
+		src = src[n:]
+		if len(src) == 0 {
+			return dst, nil
+		}
+
+		if len(src) < 2 {
+			return nil, errLZ4
+		}
+		offset := int(binary.LittleEndian.Uint16(src))
+		src = src[2:]
+		length := int(token & 15)
+		if length == 15 {
+			var err error
+			if length, err = readLength(length); err != nil {
+				return nil, err
+			}
+		}
+		length += lz4MinMatch
+		if offset == 0 || offset > len(dst) {
+			return nil, errLZ4
+		}
+		// Matches may overlap the bytes they produce.
+		start := len(dst) - offset
+		for i := 0; i < length; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+	return dst, nil
+}
+
+// lz4Reader decompresses a sequence of LZ4 frames.
+type lz4Reader struct {
+	r           *bufio.Reader
+	buf         []byte
+	pos         int
+	inFrame     bool
+	independent bool
+	blockCheck  bool
+	checksum    *xxh32Digest
+	maxBlock    int
+	err         error
+}
+
+func newLZ4Reader(r io.Reader) *lz4Reader {
+	return &lz4Reader{r: bufio.NewReader(r)}
+}
+
+func (z *lz4Reader) Read(p []byte) (int, error) {
+	for z.pos == len(z.buf) {
+		if z.err != nil {
+			return 0, z.err
+		}
+		z.err = z.next()
+	}
+	n := copy(p, z.buf[z.pos:])
+	z.pos += n
+	return n, nil
+}
+
+func (z *lz4Reader) readUint32() (uint32, error) {
+	var b [4]byte
+	if _, err := io.ReadFull(z.r, b[:]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(b[:]), nil
+}
+
+// next decodes the next block into buf.
+func (z *lz4Reader) next() error {
+	if !z.inFrame {
+		return z.readFrameHeader()
+	}
+	size, err := z.readUint32()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if size == 0 {
+		z.inFrame = false
+		if z.checksum != nil {
+			sum, err := z.readUint32()
+			if err != nil {
+				return unexpectedEOF(err)
+			}
+			if sum != z.checksum.Sum32() {
+				return errors.New("rosbag: lz4 content checksum mismatch")
+			}
+		}
+		return nil
+	}
+	uncompressed := size&(1<<31) != 0
+	size &^= 1 << 31
+	if int(size) > z.maxBlock {
+		return errLZ4
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(z.r, data); err != nil {
+		return unexpectedEOF(err)
+	}
+	if z.blockCheck {
+		sum, err := z.readUint32()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if sum != xxh32(data) {
+			return errors.New("rosbag: lz4 block checksum mismatch")
+		}
+	}
+
+	// Dependent blocks may reference the previous 64 KB.
+	var history []byte
+	if !z.independent {
+		history = z.buf
+		if len(history) > lz4History {
+			history = history[len(history)-lz4History:]
+		}
+	}
+	out := append(make([]byte, 0, len(history)+z.maxBlock), history...)
+	if uncompressed {
+		out = append(out, data...)
+	} else if out, err = lz4DecompressBlock(out, data); err != nil {
+		return err
+	}
+	if z.checksum != nil {
+		z.checksum.Write(out[len(history):])
+	}
+	z.buf, z.pos = out, len(history)
+	return nil
+}
+
+func (z *lz4Reader) readFrameHeader() error {
+	magic, err := z.readUint32()
+	if err != nil {
+		return err
+	}
+	if magic&lz4SkippableMask == lz4SkippableMagic {
+		size, err := z.readUint32()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		_, err = io.CopyN(ioutil.Discard, z.r, int64(size))
+		return unexpectedEOF(err)
+	}
+	if magic != lz4Magic {
+		return errLZ4
+	}
+	descriptor := make([]byte, 2, 14)
+	if _, err := io.ReadFull(z.r, descriptor); err != nil {
+		return unexpectedEOF(err)
+	}
+	flags, bd := descriptor[0], descriptor[1]
+	if flags>>6 != 1 || flags&2 != 0 || bd&0x8f != 0 || bd>>4 < 4 {
+		return errLZ4
+	}
+	extra := 0
+	if flags&8 != 0 {
+		extra += 8
+	}
+	if flags&1 != 0 {
+		extra += 4
+	}
+	descriptor = descriptor[:2+extra]
+	if _, err := io.ReadFull(z.r, descriptor[2:]); err != nil {
+		return unexpectedEOF(err)
+	}
+	hc, err := z.r.ReadByte()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if hc != byte(xxh32(descriptor)>>8) {
+		return errors.New("rosbag: lz4 frame header checksum mismatch")
+	}
+	z.inFrame = true
+	z.independent = flags&(1<<5) != 0
+	z.blockCheck = flags&(1<<4) != 0
+	z.checksum = nil
+	if flags&(1<<2) != 0 {
+		z.checksum = newXXH32()
+	}
+	z.maxBlock = lz4BlockSize(bd >> 4)
+	z.buf, z.pos = nil, 0
+	return nil
+}
+
+// xxHash32 with a zero seed, as used by the LZ4 frame format.
+
+const (
+	xxhPrime1 uint32 = 2654435761
+	xxhPrime2 uint32 = 2246822519
+	xxhPrime3 uint32 = 3266489917
+	xxhPrime4 uint32 = 668265263
+	xxhPrime5 uint32 = 374761393
+)
+
+type xxh32Digest struct {
+	v     [4]uint32
+	total uint64
+	buf   []byte
+}
+
+func newXXH32() *xxh32Digest {
+	d := &xxh32Digest{v: [4]uint32{xxhPrime1, xxhPrime2, 0, 0}}
+	d.v[0] += xxhPrime2
+	d.v[3] -= xxhPrime1
+	return d
+}
+
+func xxh32(b []byte) uint32 {
+	d := newXXH32()
+	d.Write(b)
+	return d.Sum32()
+}
+
+func xxhRound(v, lane uint32) uint32 {
+	return bits.RotateLeft32(v+lane*xxhPrime2, 13) * xxhPrime1
+}
+
+func (d *xxh32Digest) Write(b []byte) (int, error) {
+	n := len(b)
+	d.total += uint64(n)
+	if len(d.buf) > 0 {
+		m := 16 - len(d.buf)
+		if m > len(b) {
+			m = len(b)
+		}
+		d.buf = append(d.buf, b[:m]...)
+		b = b[m:]
+		if len(d.buf) < 16 {
+			return n, nil
+		}
+		d.stripe(d.buf)
+		d.buf = d.buf[:0]
+	}
+	for ; len(b) >= 16; b = b[16:] {
+		d.stripe(b)
+	}
+	d.buf = append(d.buf, b...)
+	return n, nil
+}
+
+func (d *xxh32Digest) stripe(b []byte) {
+	for i := range d.v {
+		d.v[i] = xxhRound(d.v[i], binary.LittleEndian.Uint32(b[4*i:]))
+	}
+}
+
+func (d *xxh32Digest) Sum32() uint32 {
+	var h uint32
+	if d.total >= 16 {
+		h = bits.RotateLeft32(d.v[0], 1) + bits.RotateLeft32(d.v[1], 7) +
+			bits.RotateLeft32(d.v[2], 12) + bits.RotateLeft32(d.v[3], 18)
+	} else {
+		h = xxhPrime5
+	}
+	h += uint32(d.total)
+	b := d.buf
+	for ; len(b) >= 4; b = b[4:] {
+		h += binary.LittleEndian.Uint32(b) * xxhPrime3
+		h = bits.RotateLeft32(h, 17) * xxhPrime4
+	}
+	for _, c := range b {
+		h += uint32(c) * xxhPrime5
+		h = bits.RotateLeft32(h, 11) * xxhPrime1
+	}
+	h ^= h >> 15
+	h *= xxhPrime2
+	h ^= h >> 13
+	h *= xxhPrime3
+	h ^= h >> 16
+	return h
+}
@@ -0,0 +1,831 @@
+package rosbag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// MCAP files start and end with a magic, and are a sequence of records made
+// of an op code, a uint64 length and the record content. Messages and the
+// schema and channel records describing them are grouped in chunks, each
+// followed by message index records. The summary section at the end repeats
+// the schemas and channels and indexes the chunks.
+
+var mcapMagic = []byte{0x89, 'M', 'C', 'A', 'P', '0', '\r', '\n'}
+
+// MCAP record op codes.
+const (
+	mcapOpHeader        = 0x01
+	mcapOpFooter        = 0x02
+	mcapOpSchema        = 0x03
+	mcapOpChannel       = 0x04
+	mcapOpMessage       = 0x05
+	mcapOpChunk         = 0x06
+	mcapOpMessageIndex  = 0x07
+	mcapOpChunkIndex    = 0x08
+	mcapOpStatistics    = 0x0B
+	mcapOpSummaryOffset = 0x0E
+	mcapOpDataEnd       = 0x0F
+)
+
+const (
+	mcapProfile         = "ros1"
+	mcapSchemaEncoding  = "ros1msg"
+	mcapMessageEncoding = "ros1"
+	// mcapFooterLength is the length of the footer record.
+	mcapFooterLength = 1 + 8 + 8 + 8 + 4
+)
+
+// mcapCompression converts chunk compressions to their MCAP names.
+func mcapCompression(compression string) string {
+	if compression == CompressionNone {
+		return ""
+	}
+	return compression
+}
+
+// mcapEncoder builds the content of a record.
+type mcapEncoder struct {
+	bytes.Buffer
+}
+
+func (e *mcapEncoder) uint16(v uint16) {
+	binary.Write(e, binary.LittleEndian, v)
+}
+
+func (e *mcapEncoder) uint32(v uint32) {
+	binary.Write(e, binary.LittleEndian, v)
+}
+
+func (e *mcapEncoder) uint64(v uint64) {
+	binary.Write(e, binary.LittleEndian, v)
+}
+
+func (e *mcapEncoder) time(t ros.Time) {
+	e.uint64(t.ToNSec())
+}
+
+func (e *mcapEncoder) string(s string) {
+	e.uint32(uint32(len(s)))
+	e.WriteString(s)
+}
+
+// prefixed writes the content built by fill prefixed with its uint32 length,
+// as maps and arrays are.
+func (e *mcapEncoder) prefixed(fill func(e *mcapEncoder)) {
+	var content mcapEncoder
+	fill(&content)
+	e.uint32(uint32(content.Len()))
+	e.Write(content.Bytes())
+}
+
+func (e *mcapEncoder) stringMap(m map[string]string) {
+	e.prefixed(func(e *mcapEncoder) {
+		for _, k := range sortedKeys(m) {
+			e.string(k)
+			e.string(m[k])
+		}
+	})
+}
+
+// record returns the content as a record.
+func (e *mcapEncoder) record(op byte) []byte {
+	record := make([]byte, 9, 9+e.Len())
+	record[0] = op
+	binary.LittleEndian.PutUint64(record[1:], uint64(e.Len()))
+	return append(record, e.Bytes()...)
+}
+
+// mcapDecoder reads the content of a record, keeping the first error.
+type mcapDecoder struct {
+	data []byte
+	err  error
+}
+
+var errMCAPShort = errors.New("rosbag: truncated MCAP record")
+
+func (d *mcapDecoder) next(n uint64) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if uint64(len(d.data)) < n {
+		d.err = errMCAPShort
+		d.data = nil
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *mcapDecoder) uint16() uint16 {
+	if b := d.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *mcapDecoder) uint32() uint32 {
+	if b := d.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (d *mcapDecoder) uint64() uint64 {
+	if b := d.next(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (d *mcapDecoder) time() ros.Time {
+	nsec := d.uint64()
+	return ros.NewTime(uint32(nsec/1e9), uint32(nsec%1e9))
+}
+
+func (d *mcapDecoder) string() string {
+	return string(d.next(uint64(d.uint32())))
+}
+
+func (d *mcapDecoder) prefixed() *mcapDecoder {
+	content := d.next(uint64(d.uint32()))
+	return &mcapDecoder{data: content, err: d.err}
+}
+
+func (d *mcapDecoder) stringMap() map[string]string {
+	m := map[string]string{}
+	content := d.prefixed()
+	for len(content.data) > 0 && content.err == nil {
+		k := content.string()
+		m[k] = content.string()
+	}
+	if d.err == nil {
+		d.err = content.err
+	}
+	return m
+}
+
+// readMCAPRecord reads the op code and content of a record.
+func readMCAPRecord(r io.Reader) (byte, []byte, error) {
+	var prefix [9]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return 0, nil, err
+	}
+	content, err := readBytes(r, binary.LittleEndian.Uint64(prefix[1:]))
+	if err != nil {
+		return 0, nil, err
+	}
+	return prefix[0], content, nil
+}
+
+// mcapSchema is a message definition shared by the channels of a type.
+type mcapSchema struct {
+	id   uint16
+	name string
+	data string
+}
+
+func (s *mcapSchema) record() []byte {
+	var e mcapEncoder
+	e.uint16(s.id)
+	e.string(s.name)
+	e.string(mcapSchemaEncoding)
+	e.string(s.data)
+	return e.record(mcapOpSchema)
+}
+
+func parseMCAPSchema(content []byte) (*mcapSchema, string, error) {
+	d := &mcapDecoder{data: content}
+	s := &mcapSchema{id: d.uint16(), name: d.string()}
+	encoding := d.string()
+	s.data = d.string()
+	return s, encoding, d.err
+}
+
+// channelRecord returns the channel record of a connection. The connection
+// header fields other than the topic and type are the channel metadata.
+func channelRecord(conn *Connection, schemaID uint16) []byte {
+	metadata := map[string]string{}
+	for k, v := range conn.Header {
+		switch k {
+		case "topic", "type", "message_definition":
+		default:
+			metadata[k] = v
+		}
+	}
+	var e mcapEncoder
+	e.uint16(uint16(conn.ID))
+	e.uint16(schemaID)
+	e.string(conn.Topic)
+	e.string(mcapMessageEncoding)
+	e.stringMap(metadata)
+	return e.record(mcapOpChannel)
+}
+
+// mcapChannel is a channel record waiting for its schema.
+type mcapChannel struct {
+	id       uint16
+	schemaID uint16
+	topic    string
+	encoding string
+	metadata map[string]string
+}
+
+func parseMCAPChannel(content []byte) (*mcapChannel, error) {
+	d := &mcapDecoder{data: content}
+	c := &mcapChannel{id: d.uint16(), schemaID: d.uint16(), topic: d.string(), encoding: d.string()}
+	c.metadata = d.stringMap()
+	return c, d.err
+}
+
+// mcapConnections builds connections from channels and schemas. Channels
+// which are not ROS 1 messages are skipped. The MD5 sum is computed from the
+// definition when the channel metadata does not have it.
+type mcapConnections struct {
+	schemas     map[uint16]*mcapSchema
+	connections map[uint32]*Connection
+	ctx         *dynamic.Context
+}
+
+func newMCAPConnections() *mcapConnections {
+	return &mcapConnections{
+		schemas:     map[uint16]*mcapSchema{},
+		connections: map[uint32]*Connection{},
+	}
+}
+
+func (m *mcapConnections) addSchema(content []byte) error {
+	s, encoding, err := parseMCAPSchema(content)
+	if err != nil {
+		return err
+	}
+	if encoding == mcapSchemaEncoding {
+		m.schemas[s.id] = s
+	}
+	return nil
+}
+
+func (m *mcapConnections) addChannel(content []byte) error {
+	c, err := parseMCAPChannel(content)
+	if err != nil {
+		return err
+	}
+	schema, ok := m.schemas[c.schemaID]
+	if !ok || c.encoding != mcapMessageEncoding {
+		return nil
+	}
+	if _, ok := m.connections[uint32(c.id)]; ok {
+		return nil
+	}
+	header := map[string]string{}
+	for k, v := range c.metadata {
+		header[k] = v
+	}
+	header["topic"] = c.topic
+	header["type"] = schema.name
+	header["message_definition"] = schema.data
+	if header["md5sum"] == "" {
+		if m.ctx == nil {
+			m.ctx = dynamic.NewContext(nil)
+		}
+		t, err := m.ctx.AddDefinition(schema.name, schema.data)
+		if err != nil {
+			return fmt.Errorf("rosbag: cannot compute the MD5 sum of %s: %v", schema.name, err)
+		}
+		header["md5sum"] = t.MD5Sum()
+	}
+	m.connections[uint32(c.id)] = newConnection(uint32(c.id), c.topic, header)
+	return nil
+}
+
+// startMCAP writes the magic and header record.
+func (w *Writer) startMCAP() error {
+	w.crc = crc32.NewIEEE()
+	w.schemaIDs = map[string]uint16{}
+	w.sequences = map[uint32]uint32{}
+	if err := w.write(mcapMagic); err != nil {
+		return err
+	}
+	var e mcapEncoder
+	e.string(mcapProfile)
+	e.string("rosgo")
+	return w.write(e.record(mcapOpHeader))
+}
+
+// writeMCAPConnection adds the schema and channel records of a new
+// connection to the chunk.
+func (w *Writer) writeMCAPConnection(conn *Connection) {
+	key := conn.Type + "\x00" + conn.MD5Sum
+	id, ok := w.schemaIDs[key]
+	if !ok {
+		// Schema ID 0 means no schema.
+		schema := &mcapSchema{uint16(len(w.schemas) + 1), conn.Type, conn.MessageDefinition}
+		w.schemas = append(w.schemas, schema)
+		w.schemaIDs[key] = schema.id
+		w.chunk.Write(schema.record())
+		id = schema.id
+	}
+	w.connSchemas = append(w.connSchemas, id)
+	w.chunk.Write(channelRecord(conn, id))
+}
+
+func (w *Writer) writeMCAPMessage(conn *Connection, t ros.Time, data []byte) {
+	var e mcapEncoder
+	e.uint16(uint16(conn.ID))
+	e.uint32(w.sequences[conn.ID])
+	e.time(t)
+	e.time(t)
+	e.Write(data)
+	w.sequences[conn.ID]++
+	w.chunk.Write(e.record(mcapOpMessage))
+}
+
+// writeMCAPChunk writes a chunk and its message index records.
+func (w *Writer) writeMCAPChunk(chunk *ChunkInfo, records, compressed []byte) error {
+	var e mcapEncoder
+	e.time(chunk.StartTime)
+	e.time(chunk.EndTime)
+	e.uint64(uint64(len(records)))
+	e.uint32(crc32.ChecksumIEEE(records))
+	e.string(mcapCompression(chunk.Compression))
+	e.uint64(uint64(len(compressed)))
+	e.Write(compressed)
+	if err := w.write(e.record(mcapOpChunk)); err != nil {
+		return err
+	}
+
+	chunk.indexPos = w.pos
+	chunk.indexOffsets = map[uint32]int64{}
+	var ids []uint32
+	for id := range w.chunkIndex {
+		ids = append(ids, id)
+	}
+	for _, id := range sortIDs(ids) {
+		chunk.indexOffsets[id] = w.pos
+		var e mcapEncoder
+		e.uint16(uint16(id))
+		e.prefixed(func(e *mcapEncoder) {
+			for _, entry := range w.chunkIndex[id] {
+				e.time(entry.time)
+				e.uint64(uint64(entry.offset))
+			}
+		})
+		if err := w.write(e.record(mcapOpMessageIndex)); err != nil {
+			return err
+		}
+	}
+	chunk.indexLength = w.pos - chunk.indexPos
+	return nil
+}
+
+// writeMCAPSummary ends the data section and writes the summary section,
+// the footer and the closing magic.
+func (w *Writer) writeMCAPSummary() error {
+	var e mcapEncoder
+	e.uint32(w.crc.Sum32())
+	if err := w.write(e.record(mcapOpDataEnd)); err != nil {
+		return err
+	}
+	w.crc = nil
+
+	summaryStart := w.pos
+	var summary bytes.Buffer
+	type group struct {
+		op          byte
+		start, size int64
+	}
+	var groups []group
+	addGroup := func(op byte, records ...[]byte) {
+		if len(records) == 0 {
+			return
+		}
+		g := group{op, summaryStart + int64(summary.Len()), 0}
+		for _, r := range records {
+			summary.Write(r)
+		}
+		g.size = summaryStart + int64(summary.Len()) - g.start
+		groups = append(groups, g)
+	}
+
+	var schemas, channels, chunkIndexes [][]byte
+	for _, s := range w.schemas {
+		schemas = append(schemas, s.record())
+	}
+	for i, conn := range w.connections {
+		channels = append(channels, channelRecord(conn, w.connSchemas[i]))
+	}
+	counts := map[uint32]uint64{}
+	var messageCount uint64
+	var start, end ros.Time
+	for i, chunk := range w.chunks {
+		for id, n := range chunk.MessageCounts {
+			counts[id] += uint64(n)
+			messageCount += uint64(n)
+		}
+		if i == 0 || chunk.StartTime.Cmp(start) < 0 {
+			start = chunk.StartTime
+		}
+		if chunk.EndTime.Cmp(end) > 0 {
+			end = chunk.EndTime
+		}
+		chunkIndexes = append(chunkIndexes, chunkIndexRecord(chunk))
+	}
+	var stats mcapEncoder
+	stats.uint64(messageCount)
+	stats.uint16(uint16(len(w.schemas)))
+	stats.uint32(uint32(len(w.connections)))
+	stats.uint32(0) // attachments
+	stats.uint32(0) // metadata
+	stats.uint32(uint32(len(w.chunks)))
+	stats.time(start)
+	stats.time(end)
+	var ids []uint32
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	stats.prefixed(func(e *mcapEncoder) {
+		for _, id := range sortIDs(ids) {
+			e.uint16(uint16(id))
+			e.uint64(counts[id])
+		}
+	})
+	addGroup(mcapOpSchema, schemas...)
+	addGroup(mcapOpChannel, channels...)
+	addGroup(mcapOpStatistics, stats.record(mcapOpStatistics))
+	addGroup(mcapOpChunkIndex, chunkIndexes...)
+
+	summaryOffsetStart := summaryStart + int64(summary.Len())
+	for _, g := range groups {
+		var e mcapEncoder
+		e.WriteByte(g.op)
+		e.uint64(uint64(g.start))
+		e.uint64(uint64(g.size))
+		summary.Write(e.record(mcapOpSummaryOffset))
+	}
+	// The CRC covers the summary up to the CRC field of the footer.
+	footer := make([]byte, mcapFooterLength-4)
+	footer[0] = mcapOpFooter
+	binary.LittleEndian.PutUint64(footer[1:], mcapFooterLength-9)
+	binary.LittleEndian.PutUint64(footer[9:], uint64(summaryStart))
+	binary.LittleEndian.PutUint64(footer[17:], uint64(summaryOffsetStart))
+	summary.Write(footer)
+	summary.Write(packUint32(crc32.ChecksumIEEE(summary.Bytes())))
+	summary.Write(mcapMagic)
+	return w.write(summary.Bytes())
+}
+
+func chunkIndexRecord(chunk *ChunkInfo) []byte {
+	var e mcapEncoder
+	e.time(chunk.StartTime)
+	e.time(chunk.EndTime)
+	e.uint64(uint64(chunk.Pos))
+	e.uint64(uint64(chunk.indexPos - chunk.Pos))
+	var ids []uint32
+	for id := range chunk.indexOffsets {
+		ids = append(ids, id)
+	}
+	e.prefixed(func(e *mcapEncoder) {
+		for _, id := range sortIDs(ids) {
+			e.uint16(uint16(id))
+			e.uint64(uint64(chunk.indexOffsets[id]))
+		}
+	})
+	e.uint64(uint64(chunk.indexLength))
+	e.string(mcapCompression(chunk.Compression))
+	e.uint64(uint64(chunk.CompressedSize))
+	e.uint64(uint64(chunk.Size))
+	return e.record(mcapOpChunkIndex)
+}
+
+// sortIDs sorts connection IDs.
+func sortIDs(ids []uint32) []uint32 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// chunkCompression converts MCAP compressions to chunk compressions.
+func chunkCompression(compression string) string {
+	if compression == "" {
+		return CompressionNone
+	}
+	return compression
+}
+
+// readMCAPIndex reads the summary section, which ends with the footer before
+// the closing magic. Files without it were not closed.
+func (r *Reader) readMCAPIndex() error {
+	size := r.size
+	end := make([]byte, mcapFooterLength+len(mcapMagic))
+	if size < int64(len(mcapMagic)+len(end)) {
+		return ErrUnindexed
+	}
+	br, err := r.seek(size - int64(len(end)))
+	if err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(br, end); err != nil {
+		return err
+	}
+	if end[0] != mcapOpFooter || !bytes.Equal(end[mcapFooterLength:], mcapMagic) {
+		return ErrUnindexed
+	}
+	summaryStart := binary.LittleEndian.Uint64(end[9:])
+	if summaryStart == 0 {
+		return ErrUnindexed
+	}
+
+	if br, err = r.seek(int64(summaryStart)); err != nil {
+		return err
+	}
+	conns := newMCAPConnections()
+	// Channels are added once all their schemas are known.
+	var channels [][]byte
+	for {
+		op, content, err := readMCAPRecord(br)
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if op == mcapOpFooter {
+			break
+		}
+		switch op {
+		case mcapOpSchema:
+			if err := conns.addSchema(content); err != nil {
+				return err
+			}
+		case mcapOpChannel:
+			channels = append(channels, content)
+		case mcapOpChunkIndex:
+			chunk, err := parseMCAPChunkIndex(content)
+			if err != nil {
+				return err
+			}
+			r.chunks = append(r.chunks, chunk)
+		}
+	}
+	for _, content := range channels {
+		if err := conns.addChannel(content); err != nil {
+			return err
+		}
+	}
+	r.connections = conns.connections
+
+	for _, chunk := range r.chunks {
+		br, err := r.seek(chunk.Pos)
+		if err != nil {
+			return err
+		}
+		if err := chunk.readMCAPHeader(br); err != nil {
+			return err
+		}
+		if int64(chunk.CompressedSize) > int64(br.Len()) {
+			return fmt.Errorf("rosbag: chunk at %d exceeds the end of the file", chunk.Pos)
+		}
+		index, err := r.readMCAPChunkIndex(chunk)
+		if err != nil {
+			return err
+		}
+		chunk.MessageCounts = map[uint32]uint32{}
+		for id, entries := range index {
+			chunk.MessageCounts[id] = uint32(len(entries))
+		}
+	}
+	return nil
+}
+
+func parseMCAPChunkIndex(content []byte) (*ChunkInfo, error) {
+	d := &mcapDecoder{data: content}
+	chunk := &ChunkInfo{
+		StartTime:    d.time(),
+		EndTime:      d.time(),
+		Pos:          int64(d.uint64()),
+		indexOffsets: map[uint32]int64{},
+	}
+	d.uint64() // chunk length
+	offsets := d.prefixed()
+	for len(offsets.data) > 0 && offsets.err == nil {
+		id := uint32(offsets.uint16())
+		offset := int64(offsets.uint64())
+		chunk.indexOffsets[id] = offset
+		if chunk.indexPos == 0 || offset < chunk.indexPos {
+			chunk.indexPos = offset
+		}
+	}
+	chunk.indexLength = int64(d.uint64())
+	if d.err == nil {
+		d.err = offsets.err
+	}
+	return chunk, d.err
+}
+
+// readMCAPHeader completes the chunk info from the chunk record.
+func (c *ChunkInfo) readMCAPHeader(r io.Reader) error {
+	header := make([]byte, 9+8+8+8+4+4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return unexpectedEOF(err)
+	}
+	if header[0] != mcapOpChunk {
+		return fmt.Errorf("rosbag: no chunk record at %d", c.Pos)
+	}
+	d := &mcapDecoder{data: header[9+8+8:]}
+	size := d.uint64()
+	c.crc = d.uint32()
+	// The compression is followed by the length of the records.
+	rest, err := readBytes(r, uint64(d.uint32())+8)
+	if err != nil {
+		return err
+	}
+	n := len(rest) - 8
+	c.Compression = chunkCompression(string(rest[:n]))
+	c.Size = uint32(size)
+	c.CompressedSize = uint32(binary.LittleEndian.Uint64(rest[n:]))
+	c.dataPos = c.Pos + int64(len(header)+len(rest))
+	return nil
+}
+
+// readMCAPChunkIndex reads the message index records following a chunk, or
+// scans the chunk when they are missing.
+func (r *Reader) readMCAPChunkIndex(chunk *ChunkInfo) (map[uint32][]indexEntry, error) {
+	index := map[uint32][]indexEntry{}
+	if chunk.indexLength == 0 {
+		data, err := r.readChunk(chunk)
+		if err != nil {
+			return nil, err
+		}
+		for offset := 0; offset < len(data); {
+			op, content, err := readMCAPRecord(bytes.NewReader(data[offset:]))
+			if err != nil {
+				return nil, fmt.Errorf("rosbag: cannot read chunk at %d: %v", chunk.Pos, unexpectedEOF(err))
+			}
+			if op == mcapOpMessage {
+				d := &mcapDecoder{data: content}
+				id := uint32(d.uint16())
+				d.uint32()
+				index[id] = append(index[id], indexEntry{d.time(), uint32(offset)})
+				if d.err != nil {
+					return nil, d.err
+				}
+			}
+			offset += 9 + len(content)
+		}
+		return index, nil
+	}
+	br, err := r.seek(chunk.indexPos)
+	if err != nil {
+		return nil, err
+	}
+	src := io.LimitReader(br, chunk.indexLength)
+	for {
+		op, content, err := readMCAPRecord(src)
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if op != mcapOpMessageIndex {
+			continue
+		}
+		d := &mcapDecoder{data: content}
+		id := uint32(d.uint16())
+		entries := d.prefixed()
+		for len(entries.data) > 0 && entries.err == nil {
+			index[id] = append(index[id], indexEntry{entries.time(), uint32(entries.uint64())})
+		}
+		if entries.err != nil {
+			return nil, entries.err
+		}
+	}
+}
+
+// readMCAPMessage reads the message record at the start of b.
+func readMCAPMessage(b []byte) (ros.Time, []byte, error) {
+	op, content, err := readMCAPRecord(bytes.NewReader(b))
+	if err != nil {
+		return ros.Time{}, nil, unexpectedEOF(err)
+	}
+	if op != mcapOpMessage {
+		return ros.Time{}, nil, fmt.Errorf("rosbag: index points to a record of op %#02x", op)
+	}
+	d := &mcapDecoder{data: content}
+	d.uint16()
+	d.uint32()
+	t := d.time()
+	d.uint64() // publish time
+	return t, d.data, d.err
+}
+
+func (s *Scanner) startMCAP() {
+	s.mcap = newMCAPConnections()
+	s.connections = s.mcap.connections
+	s.r.Discard(len(mcapMagic))
+	op, _, err := readMCAPRecord(s.r)
+	if err != nil {
+		s.stop(unexpectedEOF(err))
+	} else if op != mcapOpHeader {
+		s.err = fmt.Errorf("rosbag: missing MCAP header record")
+	}
+}
+
+// nextMCAP scans the data section. Files missing the data end record are
+// truncated.
+func (s *Scanner) nextMCAP() bool {
+	for s.err == nil {
+		if s.chunk != nil && s.chunk.Len() > 0 {
+			op, content, err := readMCAPRecord(s.chunk)
+			if err != nil {
+				s.truncated = true
+				s.chunk = nil
+				continue
+			}
+			if s.handleMCAP(op, content) {
+				return true
+			}
+			continue
+		}
+		s.chunk = nil
+		if s.done {
+			return false
+		}
+
+		var prefix [9]byte
+		if _, err := io.ReadFull(s.r, prefix[:]); err != nil {
+			s.truncated = true
+			s.done = true
+			return false
+		}
+		content, err := readBytes(s.r, binary.LittleEndian.Uint64(prefix[1:]))
+		if err != nil {
+			s.truncated = true
+			s.done = true
+			if prefix[0] != mcapOpChunk {
+				return false
+			}
+		}
+		if prefix[0] == mcapOpChunk {
+			s.readMCAPChunk(content)
+			continue
+		}
+		if s.handleMCAP(prefix[0], content) {
+			return true
+		}
+	}
+	return false
+}
+
+// readMCAPChunk decompresses as much of the chunk as is in the file.
+func (s *Scanner) readMCAPChunk(content []byte) {
+	d := &mcapDecoder{data: content}
+	d.time()
+	d.time()
+	size := d.uint64()
+	d.uint32()
+	compression := chunkCompression(d.string())
+	n := d.uint64()
+	if d.err != nil {
+		s.truncated = true
+		return
+	}
+	records := d.data
+	if uint64(len(records)) > n {
+		records = records[:n]
+	}
+	s.decompress(compression, records, uint32(size))
+}
+
+// handleMCAP processes a record and reports whether it is a message.
+func (s *Scanner) handleMCAP(op byte, content []byte) bool {
+	switch op {
+	case mcapOpSchema:
+		s.err = s.mcap.addSchema(content)
+	case mcapOpChannel:
+		s.err = s.mcap.addChannel(content)
+	case mcapOpMessage:
+		d := &mcapDecoder{data: content}
+		id := uint32(d.uint16())
+		d.uint32()
+		t := d.time()
+		d.uint64()
+		if d.err != nil {
+			s.err = d.err
+			return false
+		}
+		// Messages of channels which are not ROS 1 messages are skipped.
+		if conn, ok := s.connections[id]; ok {
+			s.message = &Message{conn, t, d.data}
+			return true
+		}
+	case mcapOpDataEnd, mcapOpFooter:
+		s.done = true
+	}
+	return false
+}
@@ -0,0 +1,417 @@
+package rosbag
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// ClockType is the type of the /clock topic followed by nodes using
+// simulated time.
+var ClockType = ros.NewRawMessageType("rosgraph_msgs/Clock", "a9c97c1d230cfc112e270351a944ee47", "time clock\n")
+
+// PlayerOption configures a Player.
+type PlayerOption func(p *Player)
+
+// PlayerRate multiplies the playback speed.
+func PlayerRate(rate float64) PlayerOption {
+	return func(p *Player) {
+		p.rate = rate
+	}
+}
+
+// PlayerStart skips the first offset of the bags.
+func PlayerStart(offset time.Duration) PlayerOption {
+	return func(p *Player) {
+		p.start = offset
+	}
+}
+
+// PlayerDuration plays only duration of the bags.
+func PlayerDuration(duration time.Duration) PlayerOption {
+	return func(p *Player) {
+		p.duration = duration
+	}
+}
+
+// PlayerLoop restarts the playback when it reaches the end.
+func PlayerLoop(loop bool) PlayerOption {
+	return func(p *Player) {
+		p.loop = loop
+	}
+}
+
+// PlayerPaused starts the playback paused.
+func PlayerPaused(paused bool) PlayerOption {
+	return func(p *Player) {
+		p.paused = paused
+	}
+}
+
+// PlayerTopics plays only the given topics.
+func PlayerTopics(topics ...string) PlayerOption {
+	return func(p *Player) {
+		p.topics = append(p.topics, topics...)
+	}
+}
+
+// PlayerRemap publishes the messages of topic from on topic to.
+func PlayerRemap(from, to string) PlayerOption {
+	return func(p *Player) {
+		p.remap[from] = to
+	}
+}
+
+// PlayerClock publishes the bag time on /clock at frequency hz.
+func PlayerClock(hz float64) PlayerOption {
+	return func(p *Player) {
+		p.clockHz = hz
+	}
+}
+
+// PlayerDelay waits after advertising the topics, so that subscribers can
+// connect before the first messages. It is 200ms by default.
+func PlayerDelay(delay time.Duration) PlayerOption {
+	return func(p *Player) {
+		p.delay = delay
+	}
+}
+
+// Player publishes the messages of bags with their original timing, types
+// and MD5 sums.
+type Player struct {
+	node     ros.Node
+	readers  []*Reader
+	rate     float64
+	start    time.Duration
+	duration time.Duration
+	loop     bool
+	topics   []string
+	remap    map[string]string
+	clockHz  float64
+	delay    time.Duration
+
+	publishers map[string]ros.Publisher
+	clock      ros.Publisher
+	quitChan   chan struct{}
+	quitOnce   sync.Once
+
+	mutex    sync.Mutex
+	paused   bool
+	pausedAt time.Time
+	steps    int
+	// The wall time at which the bag time origin is played.
+	wallOrigin time.Time
+	bagOrigin  ros.Time
+	current    ros.Time
+}
+
+// NewPlayer advertises the topics of the bags.
+func NewPlayer(node ros.Node, readers []*Reader, options ...PlayerOption) (*Player, error) {
+	p := &Player{
+		node:       node,
+		readers:    readers,
+		rate:       1,
+		remap:      map[string]string{},
+		delay:      200 * time.Millisecond,
+		publishers: map[string]ros.Publisher{},
+		quitChan:   make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt(p)
+	}
+	if p.rate <= 0 {
+		return nil, fmt.Errorf("rosbag: invalid playback rate %v", p.rate)
+	}
+	if p.paused {
+		p.pausedAt = time.Now()
+	}
+
+	selected := map[string]bool{}
+	for _, t := range p.topics {
+		selected[t] = true
+	}
+	for _, r := range readers {
+		for _, conn := range r.Connections() {
+			if len(selected) > 0 && !selected[conn.Topic] {
+				continue
+			}
+			key := publisherKey(conn)
+			if _, ok := p.publishers[key]; ok {
+				continue
+			}
+			topic := conn.Topic
+			if to, ok := p.remap[topic]; ok {
+				topic = to
+			}
+			p.publishers[key] = node.NewPublisher(topic, conn.MessageType(), ros.PublisherLatched(conn.Latching))
+		}
+	}
+	if p.clockHz > 0 {
+		p.clock = node.NewPublisher("/clock", ClockType)
+	}
+	return p, nil
+}
+
+func publisherKey(conn *Connection) string {
+	return conn.Topic + "\x00" + conn.MD5Sum
+}
+
+// Play publishes the messages until the end of the bags, or forever when
+// looping, unless the player is shut down.
+func (p *Player) Play() error {
+	if !p.sleep(p.delay) {
+		return nil
+	}
+	for {
+		if err := p.playOnce(); err != nil {
+			return err
+		}
+		if !p.loop || p.stopped() {
+			return nil
+		}
+	}
+}
+
+func (p *Player) stopped() bool {
+	select {
+	case <-p.quitChan:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *Player) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-p.quitChan:
+		return false
+	}
+}
+
+func (p *Player) timeRange() (ros.Time, *ros.Time) {
+	var start ros.Time
+	for i, r := range p.readers {
+		if t := r.StartTime(); i == 0 || t.Cmp(start) < 0 {
+			start = t
+		}
+	}
+	start = start.Add(rosDuration(p.start))
+	if p.duration <= 0 {
+		return start, nil
+	}
+	end := start.Add(rosDuration(p.duration))
+	return start, &end
+}
+
+func rosDuration(d time.Duration) ros.Duration {
+	var result ros.Duration
+	result.FromNSec(uint64(d))
+	return result
+}
+
+func (p *Player) playOnce() error {
+	start, end := p.timeRange()
+	options := []ReadOption{ReadStart(start)}
+	if end != nil {
+		options = append(options, ReadEnd(*end))
+	}
+	if len(p.topics) > 0 {
+		options = append(options, ReadTopics(p.topics...))
+	}
+	var iterators []*Iterator
+	for _, r := range p.readers {
+		iterators = append(iterators, r.Messages(options...))
+	}
+	merged := newMergedIterator(iterators)
+
+	p.mutex.Lock()
+	p.wallOrigin = time.Now()
+	if p.paused {
+		p.pausedAt = p.wallOrigin
+	}
+	p.bagOrigin = start
+	p.current = start
+	p.mutex.Unlock()
+
+	for merged.Next() {
+		m := merged.Message()
+		if !p.waitFor(m.Time) {
+			return nil
+		}
+		if pub, ok := p.publishers[publisherKey(m.Connection)]; ok {
+			pub.Publish(m.Raw())
+		}
+	}
+	return merged.Err()
+}
+
+// waitFor waits until the bag time t is due, publishing the clock meanwhile.
+func (p *Player) waitFor(t ros.Time) bool {
+	var period time.Duration
+	if p.clock != nil {
+		period = time.Duration(float64(time.Second) / p.clockHz)
+	}
+	for {
+		if p.stopped() {
+			return false
+		}
+		p.mutex.Lock()
+		if p.paused {
+			if p.steps > 0 {
+				// Stepping moves the time origin to the stepped message.
+				p.steps--
+				p.wallOrigin, p.pausedAt, p.bagOrigin = time.Now(), time.Now(), t
+				p.current = t
+				p.mutex.Unlock()
+				p.publishClock(t)
+				return true
+			}
+			p.mutex.Unlock()
+			if !p.sleep(10 * time.Millisecond) {
+				return false
+			}
+			continue
+		}
+		offset := t.Diff(p.bagOrigin)
+		target := p.wallOrigin.Add(time.Duration(float64(offset.ToNSec()) / p.rate))
+		now := time.Now()
+		if !now.Before(target) {
+			p.current = t
+			p.mutex.Unlock()
+			p.publishClock(t)
+			return true
+		}
+		elapsed := rosDuration(time.Duration(float64(now.Sub(p.wallOrigin)) * p.rate))
+		p.current = p.bagOrigin.Add(elapsed)
+		current := p.current
+		p.mutex.Unlock()
+
+		wait := target.Sub(now)
+		if p.clock != nil {
+			p.publishClock(current)
+			if wait > period {
+				wait = period
+			}
+		}
+		if !p.sleep(wait) {
+			return false
+		}
+	}
+}
+
+func (p *Player) publishClock(t ros.Time) {
+	if p.clock != nil {
+		p.clock.Publish(ros.NewRawMessage(ClockType, packTime(t)))
+	}
+}
+
+// Time returns the bag time being played.
+func (p *Player) Time() ros.Time {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.current
+}
+
+// Pause suspends the playback.
+func (p *Player) Pause() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.paused {
+		p.paused = true
+		p.pausedAt = time.Now()
+	}
+}
+
+// Resume continues a paused playback.
+func (p *Player) Resume() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.paused {
+		p.paused = false
+		p.steps = 0
+		p.wallOrigin = p.wallOrigin.Add(time.Since(p.pausedAt))
+	}
+}
+
+// Paused tells whether the playback is paused.
+func (p *Player) Paused() bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.paused
+}
+
+// Step publishes the next message of a paused playback.
+func (p *Player) Step() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.paused {
+		p.steps++
+	}
+}
+
+// Shutdown stops the playback and its publishers.
+func (p *Player) Shutdown() {
+	p.quitOnce.Do(func() { close(p.quitChan) })
+	for _, pub := range p.publishers {
+		pub.Shutdown()
+	}
+	if p.clock != nil {
+		p.clock.Shutdown()
+	}
+}
+
+// mergedIterator iterates over several bags in time order.
+type mergedIterator struct {
+	iterators []*Iterator
+	heads     []*Message
+	message   *Message
+	err       error
+}
+
+func newMergedIterator(iterators []*Iterator) *mergedIterator {
+	m := &mergedIterator{iterators: iterators, heads: make([]*Message, len(iterators))}
+	for i, it := range iterators {
+		m.advance(i, it)
+	}
+	return m
+}
+
+func (m *mergedIterator) advance(i int, it *Iterator) {
+	m.heads[i] = nil
+	if it.Next() {
+		m.heads[i] = it.Message()
+	} else if err := it.Err(); err != nil && m.err == nil {
+		m.err = err
+	}
+}
+
+func (m *mergedIterator) Next() bool {
+	if m.err != nil {
+		return false
+	}
+	next := -1
+	for i, head := range m.heads {
+		if head != nil && (next < 0 || head.Time.Cmp(m.heads[next].Time) < 0) {
+			next = i
+		}
+	}
+	if next < 0 {
+		return false
+	}
+	m.message = m.heads[next]
+	m.advance(next, m.iterators[next])
+	return true
+}
+
+func (m *mergedIterator) Message() *Message {
+	return m.message
+}
+
+func (m *mergedIterator) Err() error {
+	return m.err
+}
@@ -0,0 +1,573 @@
+package rosbag
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// Reader reads an indexed bag or MCAP file. Messages are read from the file
+// on demand.
+type Reader struct {
+	r           io.ReadSeeker
+	size        int64
+	closer      io.Closer
+	format      string
+	connections map[uint32]*Connection
+	chunks      []*ChunkInfo
+}
+
+// Open opens the bag at path.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+// NewReader reads the index of the bag in r.
+func NewReader(r io.ReadSeeker) (*Reader, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	reader := &Reader{r: r, size: size, format: FormatBag, connections: map[uint32]*Connection{}}
+	if err := reader.readIndex(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Close closes the file opened by Open.
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
+
+// Format returns FormatBag or FormatMCAP.
+func (r *Reader) Format() string {
+	return r.format
+}
+
+// fileReader reads the file from a position, counting the bytes left to
+// check the sizes read from the file before allocating them.
+type fileReader struct {
+	br   *bufio.Reader
+	left int64
+}
+
+func (f *fileReader) Read(p []byte) (int, error) {
+	if f.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > f.left {
+		p = p[:f.left]
+	}
+	n, err := f.br.Read(p)
+	f.left -= int64(n)
+	return n, err
+}
+
+// Len returns the number of bytes left in the file.
+func (f *fileReader) Len() int {
+	return int(f.left)
+}
+
+func (f *fileReader) Peek(n int) ([]byte, error) {
+	return f.br.Peek(n)
+}
+
+func (r *Reader) seek(pos int64) (*fileReader, error) {
+	if pos < 0 || pos > r.size {
+		return nil, fmt.Errorf("rosbag: position %d is past the end of the file", pos)
+	}
+	if _, err := r.r.Seek(pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return &fileReader{bufio.NewReader(r.r), r.size - pos}, nil
+}
+
+func readVersion(r io.Reader) error {
+	buf := make([]byte, len(version))
+	if _, err := io.ReadFull(r, buf); err != nil || string(buf) != version {
+		return fmt.Errorf("rosbag: not a ROS bag 2.0 file")
+	}
+	return nil
+}
+
+func (r *Reader) readIndex() error {
+	br, err := r.seek(0)
+	if err != nil {
+		return err
+	}
+	if magic, err := br.Peek(len(mcapMagic)); err == nil && bytes.Equal(magic, mcapMagic) {
+		r.format = FormatMCAP
+		return r.readMCAPIndex()
+	}
+	if err := readVersion(br); err != nil {
+		return err
+	}
+	h, _, err := readRecord(br)
+	if err != nil {
+		return err
+	}
+	if op, err := h.op(); err != nil || op != opBagHeader {
+		return fmt.Errorf("rosbag: missing bag header record")
+	}
+	indexPos, err := h.uint64("index_pos")
+	if err != nil {
+		return err
+	}
+	connCount, err := h.uint32("conn_count")
+	if err != nil {
+		return err
+	}
+	chunkCount, err := h.uint32("chunk_count")
+	if err != nil {
+		return err
+	}
+	if indexPos == 0 {
+		return ErrUnindexed
+	}
+
+	if br, err = r.seek(int64(indexPos)); err != nil {
+		return err
+	}
+	for i := uint32(0); i < connCount; i++ {
+		h, data, err := readRecord(br)
+		if err != nil {
+			return err
+		}
+		if op, err := h.op(); err != nil || op != opConnection {
+			return fmt.Errorf("rosbag: expected a connection record in the index")
+		}
+		conn, err := parseConnection(h, data)
+		if err != nil {
+			return err
+		}
+		r.connections[conn.ID] = conn
+	}
+	for i := uint32(0); i < chunkCount; i++ {
+		h, data, err := readRecord(br)
+		if err != nil {
+			return err
+		}
+		chunk, err := parseChunkInfo(h, data)
+		if err != nil {
+			return err
+		}
+		r.chunks = append(r.chunks, chunk)
+	}
+
+	// The chunk headers hold the compression and the sizes.
+	for _, chunk := range r.chunks {
+		br, err := r.seek(chunk.Pos)
+		if err != nil {
+			return err
+		}
+		h, n, err := readRecordHeader(br)
+		if err != nil {
+			return err
+		}
+		if int64(n) > int64(br.Len()) {
+			return fmt.Errorf("rosbag: chunk at %d exceeds the end of the file", chunk.Pos)
+		}
+		if err := chunk.setHeader(h, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseChunkInfo(h recordHeader, data []byte) (*ChunkInfo, error) {
+	if op, err := h.op(); err != nil || op != opChunkInfo {
+		return nil, fmt.Errorf("rosbag: expected a chunk info record in the index")
+	}
+	if v, err := h.uint32("ver"); err != nil || v != 1 {
+		return nil, fmt.Errorf("rosbag: unsupported chunk info version")
+	}
+	pos, err := h.uint64("chunk_pos")
+	if err != nil {
+		return nil, err
+	}
+	start, err := h.time("start_time")
+	if err != nil {
+		return nil, err
+	}
+	end, err := h.time("end_time")
+	if err != nil {
+		return nil, err
+	}
+	count, err := h.uint32("count")
+	if err != nil {
+		return nil, err
+	}
+	if uint32(len(data)) != count*8 {
+		return nil, fmt.Errorf("rosbag: malformed chunk info record")
+	}
+	chunk := &ChunkInfo{
+		Pos:           int64(pos),
+		StartTime:     start,
+		EndTime:       end,
+		MessageCounts: map[uint32]uint32{},
+	}
+	for i := 0; i < len(data); i += 8 {
+		chunk.MessageCounts[binary.LittleEndian.Uint32(data[i:])] = binary.LittleEndian.Uint32(data[i+4:])
+	}
+	return chunk, nil
+}
+
+// setHeader completes the chunk info from the chunk record header.
+func (c *ChunkInfo) setHeader(h recordHeader, dataLen uint32) error {
+	if op, err := h.op(); err != nil || op != opChunk {
+		return fmt.Errorf("rosbag: no chunk record at %d", c.Pos)
+	}
+	compression, err := h.string("compression")
+	if err != nil {
+		return err
+	}
+	size, err := h.uint32("size")
+	if err != nil {
+		return err
+	}
+	if compression == CompressionNone && size != dataLen {
+		return fmt.Errorf("rosbag: size %d of uncompressed chunk at %d differs from its length %d", size, c.Pos, dataLen)
+	}
+	c.Compression = compression
+	c.Size = size
+	c.CompressedSize = dataLen
+	c.dataPos = c.Pos + int64(4+headerLength(h)+4)
+	return nil
+}
+
+// headerLength returns the encoded length of a record header.
+func headerLength(h recordHeader) int {
+	n := 0
+	for k, v := range h {
+		n += 4 + len(k) + 1 + len(v)
+	}
+	return n
+}
+
+// Connections returns the connections sorted by ID.
+func (r *Reader) Connections() []*Connection {
+	result := make([]*Connection, 0, len(r.connections))
+	for _, c := range r.connections {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	return result
+}
+
+// Chunks returns the chunks in file order.
+func (r *Reader) Chunks() []*ChunkInfo {
+	return r.chunks
+}
+
+// StartTime returns the time of the earliest message.
+func (r *Reader) StartTime() ros.Time {
+	var start ros.Time
+	for i, c := range r.chunks {
+		if i == 0 || c.StartTime.Cmp(start) < 0 {
+			start = c.StartTime
+		}
+	}
+	return start
+}
+
+// EndTime returns the time of the latest message.
+func (r *Reader) EndTime() ros.Time {
+	var end ros.Time
+	for _, c := range r.chunks {
+		if c.EndTime.Cmp(end) > 0 {
+			end = c.EndTime
+		}
+	}
+	return end
+}
+
+// MessageCount returns the number of messages of the bag.
+func (r *Reader) MessageCount() int {
+	count := 0
+	for _, c := range r.chunks {
+		for _, n := range c.MessageCounts {
+			count += int(n)
+		}
+	}
+	return count
+}
+
+// ReadOption selects the messages read by Messages.
+type ReadOption func(q *query)
+
+type query struct {
+	topics map[string]bool
+	start  *ros.Time
+	end    *ros.Time
+}
+
+// ReadTopics restricts the messages to topics.
+func ReadTopics(topics ...string) ReadOption {
+	return func(q *query) {
+		if q.topics == nil {
+			q.topics = map[string]bool{}
+		}
+		for _, t := range topics {
+			q.topics[t] = true
+		}
+	}
+}
+
+// ReadStart skips the messages recorded before start.
+func ReadStart(start ros.Time) ReadOption {
+	return func(q *query) {
+		q.start = &start
+	}
+}
+
+// ReadEnd skips the messages recorded after end.
+func ReadEnd(end ros.Time) ReadOption {
+	return func(q *query) {
+		q.end = &end
+	}
+}
+
+func (q *query) matchTime(t ros.Time) bool {
+	return (q.start == nil || t.Cmp(*q.start) >= 0) && (q.end == nil || t.Cmp(*q.end) <= 0)
+}
+
+// Messages iterates over the selected messages in time order.
+func (r *Reader) Messages(options ...ReadOption) *Iterator {
+	q := &query{}
+	for _, opt := range options {
+		opt(q)
+	}
+	it := &Iterator{reader: r}
+	for _, chunk := range r.chunks {
+		if q.start != nil && chunk.EndTime.Cmp(*q.start) < 0 {
+			continue
+		}
+		if q.end != nil && chunk.StartTime.Cmp(*q.end) > 0 {
+			continue
+		}
+		var conns []uint32
+		for id := range chunk.MessageCounts {
+			if conn, ok := r.connections[id]; ok && (q.topics == nil || q.topics[conn.Topic]) {
+				conns = append(conns, id)
+			}
+		}
+		if len(conns) == 0 {
+			continue
+		}
+		index, err := r.readChunkIndex(chunk)
+		if err != nil {
+			it.err = err
+			return it
+		}
+		for _, id := range conns {
+			for _, e := range index[id] {
+				if q.matchTime(e.time) {
+					it.entries = append(it.entries, iteratorEntry{e, chunk, r.connections[id]})
+				}
+			}
+		}
+	}
+	sort.SliceStable(it.entries, func(i, j int) bool {
+		a, b := it.entries[i], it.entries[j]
+		if c := a.time.Cmp(b.time); c != 0 {
+			return c < 0
+		}
+		if a.chunk != b.chunk {
+			return a.chunk.Pos < b.chunk.Pos
+		}
+		return a.offset < b.offset
+	})
+	return it
+}
+
+// readChunkIndex reads the index data records following a chunk.
+func (r *Reader) readChunkIndex(chunk *ChunkInfo) (map[uint32][]indexEntry, error) {
+	if r.format == FormatMCAP {
+		return r.readMCAPChunkIndex(chunk)
+	}
+	br, err := r.seek(chunk.dataPos + int64(chunk.CompressedSize))
+	if err != nil {
+		return nil, err
+	}
+	index := map[uint32][]indexEntry{}
+	for range chunk.MessageCounts {
+		h, data, err := readRecord(br)
+		if err != nil {
+			return nil, err
+		}
+		id, entries, err := parseIndexData(h, data)
+		if err != nil {
+			return nil, err
+		}
+		index[id] = entries
+	}
+	return index, nil
+}
+
+func parseIndexData(h recordHeader, data []byte) (uint32, []indexEntry, error) {
+	if op, err := h.op(); err != nil || op != opIndexData {
+		return 0, nil, fmt.Errorf("rosbag: expected an index data record")
+	}
+	if v, err := h.uint32("ver"); err != nil || v != 1 {
+		return 0, nil, fmt.Errorf("rosbag: unsupported index data version")
+	}
+	id, err := h.uint32("conn")
+	if err != nil {
+		return 0, nil, err
+	}
+	count, err := h.uint32("count")
+	if err != nil {
+		return 0, nil, err
+	}
+	if uint32(len(data)) != count*12 {
+		return 0, nil, fmt.Errorf("rosbag: malformed index data record")
+	}
+	entries := make([]indexEntry, 0, count)
+	for i := 0; i < len(data); i += 12 {
+		entries = append(entries, indexEntry{unpackTime(data[i:]), binary.LittleEndian.Uint32(data[i+8:])})
+	}
+	return id, entries, nil
+}
+
+// readChunk returns the uncompressed data of a chunk. Compressed data is
+// streamed from the file to the decompressor.
+func (r *Reader) readChunk(chunk *ChunkInfo) ([]byte, error) {
+	if _, err := r.r.Seek(chunk.dataPos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, err := newDecompressor(chunk.Compression, bufio.NewReader(io.LimitReader(r.r, int64(chunk.CompressedSize))))
+	if err != nil {
+		return nil, fmt.Errorf("rosbag: cannot read chunk at %d: %v", chunk.Pos, err)
+	}
+	// The size is only trusted as far as the decompressed data goes.
+	data, err := readBytes(src, uint64(chunk.Size))
+	if err != nil {
+		return nil, fmt.Errorf("rosbag: cannot read chunk at %d: %v", chunk.Pos, err)
+	}
+	if chunk.crc != 0 && crc32.ChecksumIEEE(data) != chunk.crc {
+		return nil, fmt.Errorf("rosbag: CRC mismatch of chunk at %d", chunk.Pos)
+	}
+	return data, nil
+}
+
+// newDecompressor returns a reader of the uncompressed data of a chunk.
+// zstd data is decompressed at once.
+func newDecompressor(compression string, src io.Reader) (io.Reader, error) {
+	switch compression {
+	case CompressionNone:
+		return src, nil
+	case CompressionBZ2:
+		return bzip2.NewReader(src), nil
+	case CompressionLZ4:
+		return newLZ4Reader(src), nil
+	case CompressionZSTD:
+		compressed, err := ioutil.ReadAll(src)
+		if err != nil {
+			return nil, err
+		}
+		data, err := zstdDecompress(compressed, 0)
+		if err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(data), nil
+	}
+	return nil, fmt.Errorf("rosbag: unsupported chunk compression %q", compression)
+}
+
+type iteratorEntry struct {
+	indexEntry
+	chunk *ChunkInfo
+	conn  *Connection
+}
+
+// Iterator iterates over messages of a bag.
+type Iterator struct {
+	reader    *Reader
+	entries   []iteratorEntry
+	next      int
+	message   *Message
+	err       error
+	chunk     *ChunkInfo
+	chunkData []byte
+}
+
+// Next reads the next message and reports whether there was one.
+func (it *Iterator) Next() bool {
+	if it.err != nil || it.next >= len(it.entries) {
+		return false
+	}
+	e := it.entries[it.next]
+	it.next++
+	if e.chunk != it.chunk {
+		data, err := it.reader.readChunk(e.chunk)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.chunk, it.chunkData = e.chunk, data
+	}
+	if int(e.offset) > len(it.chunkData) {
+		it.err = fmt.Errorf("rosbag: index points past the end of chunk %d", e.chunk.Pos)
+		return false
+	}
+	var t ros.Time
+	var data []byte
+	var err error
+	if it.reader.format == FormatMCAP {
+		t, data, err = readMCAPMessage(it.chunkData[e.offset:])
+	} else {
+		t, data, err = readBagMessage(it.chunkData[e.offset:])
+	}
+	if err != nil {
+		it.err = err
+		return false
+	}
+	it.message = &Message{e.conn, t, data}
+	return true
+}
+
+// readBagMessage reads the message data record at the start of b.
+func readBagMessage(b []byte) (ros.Time, []byte, error) {
+	h, data, err := readRecord(bytes.NewReader(b))
+	if err != nil {
+		return ros.Time{}, nil, err
+	}
+	if op, err := h.op(); err != nil || op != opMessageData {
+		return ros.Time{}, nil, fmt.Errorf("rosbag: index points to a record of op %s", formatOp(op))
+	}
+	_, t, err := parseMessage(h)
+	return t, data, err
+}
+
+// Message returns the message read by Next.
+func (it *Iterator) Message() *Message {
+	return it.message
+}
+
+// Err returns the error which stopped the iteration.
+func (it *Iterator) Err() error {
+	return it.err
+}
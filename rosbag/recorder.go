@@ -0,0 +1,320 @@
+package rosbag
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// activeSuffix is appended to the name of the bag being recorded, which is
+// renamed once its index is written.
+const activeSuffix = ".active"
+
+// RecorderOption configures a Recorder.
+type RecorderOption func(r *Recorder)
+
+// RecorderTopics records the given topics.
+func RecorderTopics(topics ...string) RecorderOption {
+	return func(r *Recorder) {
+		r.topics = append(r.topics, topics...)
+	}
+}
+
+// RecorderRegex records the topics matching any of the patterns.
+func RecorderRegex(patterns ...*regexp.Regexp) RecorderOption {
+	return func(r *Recorder) {
+		r.patterns = append(r.patterns, patterns...)
+	}
+}
+
+// RecorderAll records all topics.
+func RecorderAll() RecorderOption {
+	return func(r *Recorder) {
+		r.all = true
+	}
+}
+
+// RecorderExclude skips the topics matching pattern.
+func RecorderExclude(pattern *regexp.Regexp) RecorderOption {
+	return func(r *Recorder) {
+		r.exclude = pattern
+	}
+}
+
+// RecorderDiscoveryPeriod sets how often the master is asked for new topics
+// matching the patterns.
+func RecorderDiscoveryPeriod(period time.Duration) RecorderOption {
+	return func(r *Recorder) {
+		r.discoveryPeriod = period
+	}
+}
+
+// RecorderSplitSize starts a new bag when the current one reaches size bytes.
+func RecorderSplitSize(size int64) RecorderOption {
+	return func(r *Recorder) {
+		r.splitSize = size
+	}
+}
+
+// RecorderSplitDuration starts a new bag when the current one was recorded
+// for duration.
+func RecorderSplitDuration(duration time.Duration) RecorderOption {
+	return func(r *Recorder) {
+		r.splitDuration = duration
+	}
+}
+
+// RecorderMaxSplits keeps at most n bags, deleting the oldest ones.
+func RecorderMaxSplits(n int) RecorderOption {
+	return func(r *Recorder) {
+		r.maxSplits = n
+	}
+}
+
+// RecorderWriterOptions sets the options of the bag writers, such as the
+// compression.
+func RecorderWriterOptions(options ...WriterOption) RecorderOption {
+	return func(r *Recorder) {
+		r.writerOptions = options
+	}
+}
+
+// Recorder subscribes to topics with raw subscribers and writes their
+// messages to bags. Messages are received while the node spins.
+type Recorder struct {
+	node            ros.Node
+	path            string
+	topics          []string
+	patterns        []*regexp.Regexp
+	all             bool
+	exclude         *regexp.Regexp
+	discoveryPeriod time.Duration
+	splitSize       int64
+	splitDuration   time.Duration
+	maxSplits       int
+	writerOptions   []WriterOption
+
+	mutex       sync.Mutex
+	subscribers map[string]ros.Subscriber
+	writer      *Writer
+	bagPath     string
+	bagStart    time.Time
+	split       int
+	bags        []string
+	err         error
+	quitChan    chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewRecorder starts recording to the bag at path, or to an MCAP file when
+// path ends with .mcap. When the recording is split, bags are named after
+// path with an index, such as name_0.bag.
+func NewRecorder(node ros.Node, path string, options ...RecorderOption) (*Recorder, error) {
+	r := &Recorder{
+		node:            node,
+		path:            path,
+		discoveryPeriod: time.Second,
+		subscribers:     map[string]ros.Subscriber{},
+		quitChan:        make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+	if len(r.topics) == 0 && len(r.patterns) == 0 && !r.all {
+		return nil, fmt.Errorf("rosbag: no topic to record")
+	}
+	if err := r.openBag(); err != nil {
+		return nil, err
+	}
+
+	for _, topic := range r.topics {
+		r.subscribe(topic)
+	}
+	if len(r.patterns) > 0 || r.all {
+		r.discover()
+		r.wg.Add(1)
+		go r.watch()
+	}
+	return r, nil
+}
+
+func (r *Recorder) match(topic string) bool {
+	if r.exclude != nil && r.exclude.MatchString(topic) {
+		return false
+	}
+	if r.all {
+		return true
+	}
+	for _, p := range r.patterns {
+		if p.MatchString(topic) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Recorder) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.discoveryPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.discover()
+		case <-r.quitChan:
+			return
+		}
+	}
+}
+
+// discover subscribes to the published topics matching the patterns.
+func (r *Recorder) discover() {
+	topics, err := r.node.Graph().PublishedTopics("")
+	if err != nil {
+		r.node.Logger().Warnf("Failed to discover topics: %v", err)
+		return
+	}
+	for _, t := range topics {
+		if r.match(t.Name) {
+			r.subscribe(t.Name)
+		}
+	}
+}
+
+func (r *Recorder) subscribe(topic string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.subscribers[topic]; ok || r.writer == nil {
+		return
+	}
+	r.node.Logger().Infof("Subscribing to %s", topic)
+	r.subscribers[topic] = r.node.NewSubscriber(topic, ros.AnyMessageType, func(msg *ros.RawMessage, event ros.MessageEvent) {
+		r.record(topic, msg, event)
+	})
+}
+
+func (r *Recorder) record(topic string, msg *ros.RawMessage, event ros.MessageEvent) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.writer == nil {
+		return
+	}
+	if r.splitDuration > 0 && time.Since(r.bagStart) >= r.splitDuration {
+		if !r.check(r.nextBag()) {
+			return
+		}
+	}
+	// The publisher knows the resolved name of the topic.
+	if name, ok := event.ConnectionHeader["topic"]; ok {
+		topic = name
+	}
+	var t ros.Time
+	t.FromNSec(uint64(event.ReceiptTime.UnixNano()))
+	if !r.check(r.writer.WriteWithHeader(topic, t, msg, event.ConnectionHeader)) {
+		return
+	}
+	if r.splitSize > 0 && r.writer.Size() >= r.splitSize {
+		r.check(r.nextBag())
+	}
+}
+
+// check keeps the first error, which stops the recording.
+func (r *Recorder) check(err error) bool {
+	if err == nil {
+		return true
+	}
+	r.node.Logger().Errorf("Recording failed: %v", err)
+	if r.err == nil {
+		r.err = err
+	}
+	if r.writer != nil {
+		r.closeBag()
+	}
+	return false
+}
+
+func (r *Recorder) splitting() bool {
+	return r.splitSize > 0 || r.splitDuration > 0
+}
+
+func (r *Recorder) openBag() error {
+	path := r.path
+	if r.splitting() {
+		ext := ".bag"
+		if strings.HasSuffix(r.path, ".mcap") {
+			ext = ".mcap"
+		}
+		path = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(r.path, ext), r.split, ext)
+		r.split++
+	}
+	if r.maxSplits > 0 {
+		for len(r.bags) >= r.maxSplits {
+			os.Remove(r.bags[0])
+			r.bags = r.bags[1:]
+		}
+	}
+	w, err := Create(path+activeSuffix, r.writerOptions...)
+	if err != nil {
+		return err
+	}
+	r.writer = w
+	r.bagPath = path
+	r.bagStart = time.Now()
+	return nil
+}
+
+func (r *Recorder) closeBag() error {
+	w := r.writer
+	r.writer = nil
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(r.bagPath+activeSuffix, r.bagPath); err != nil {
+		return err
+	}
+	r.bags = append(r.bags, r.bagPath)
+	return nil
+}
+
+func (r *Recorder) nextBag() error {
+	if err := r.closeBag(); err != nil {
+		return err
+	}
+	return r.openBag()
+}
+
+// Bags returns the paths of the bags completed so far.
+func (r *Recorder) Bags() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]string{}, r.bags...)
+}
+
+// Shutdown stops the subscriptions and completes the bag being recorded.
+// It returns the first error of the recording.
+func (r *Recorder) Shutdown() error {
+	close(r.quitChan)
+	r.wg.Wait()
+
+	r.mutex.Lock()
+	subscribers := r.subscribers
+	r.subscribers = map[string]ros.Subscriber{}
+	var err error
+	if r.writer != nil {
+		err = r.closeBag()
+	}
+	if r.err == nil {
+		r.err = err
+	}
+	r.mutex.Unlock()
+
+	for _, s := range subscribers {
+		s.Shutdown()
+	}
+	return r.err
+}
@@ -0,0 +1,376 @@
+// Package rosbag reads and writes ROS bag files in the 2.0 format.
+//
+// A bag is a sequence of records. Messages and the connection records
+// describing their topics are grouped in chunks, each followed by index data
+// records locating its messages. The index section at the end of the bag
+// repeats every connection and summarizes each chunk, so that readers can
+// select messages by topic and time without scanning the whole file.
+//
+// Chunks may be compressed with bz2 or lz4. They are decompressed one at a
+// time while reading.
+//
+// Bags whose recording was interrupted have no index. Scanner reads their
+// messages in file order, so that they can be written again to a new bag.
+//
+// The same types read and write MCAP files, with TCPROS serialized messages
+// and ros1msg schemas. Readers detect the format of a file, and writers
+// create MCAP files for paths ending with .mcap. MCAP chunks may be
+// compressed with lz4, and zstd chunks written by other tools can be read.
+//
+// Recorder writes the messages of live topics to bags, and Player publishes
+// them again with their original timing.
+package rosbag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+const version = "#ROSBAG V2.0\n"
+
+// Record op codes.
+const (
+	opMessageData = 0x02
+	opBagHeader   = 0x03
+	opIndexData   = 0x04
+	opChunk       = 0x05
+	opChunkInfo   = 0x06
+	opConnection  = 0x07
+)
+
+// bagHeaderLength is the length of the padded bag header record, which is
+// rewritten in place when a bag is closed.
+const bagHeaderLength = 4096
+
+// ErrUnindexed is returned when a bag has no index, which happens when its
+// recording was interrupted.
+var ErrUnindexed = errors.New("rosbag: bag is not indexed")
+
+// Connection describes the messages of a topic from one publisher.
+type Connection struct {
+	ID                uint32
+	Topic             string
+	Type              string
+	MD5Sum            string
+	MessageDefinition string
+	CallerID          string
+	Latching          bool
+	// Header is the whole connection header as received from the publisher.
+	Header map[string]string
+}
+
+func newConnection(id uint32, topic string, header map[string]string) *Connection {
+	return &Connection{
+		ID:                id,
+		Topic:             topic,
+		Type:              header["type"],
+		MD5Sum:            header["md5sum"],
+		MessageDefinition: header["message_definition"],
+		CallerID:          header["callerid"],
+		Latching:          header["latching"] == "1",
+		Header:            header,
+	}
+}
+
+// MessageType returns a raw message type matching the connection.
+func (c *Connection) MessageType() *ros.RawMessageType {
+	return ros.NewRawMessageType(c.Type, c.MD5Sum, c.MessageDefinition)
+}
+
+// Message is a serialized message read from a bag.
+type Message struct {
+	Connection *Connection
+	Time       ros.Time
+	Data       []byte
+}
+
+// Decode deserializes the message into msg, usually a generated message.
+func (m *Message) Decode(msg ros.Message) error {
+	md5sum := msg.GetType().MD5Sum()
+	if md5sum != "*" && md5sum != m.Connection.MD5Sum {
+		return fmt.Errorf("rosbag: cannot decode %s message of %s as %s: MD5 sum mismatch",
+			m.Connection.Type, m.Connection.Topic, msg.GetType().Name())
+	}
+	return msg.Deserialize(ros.NewReader(m.Data))
+}
+
+// Raw returns the message as a raw message of the connection type.
+func (m *Message) Raw() *ros.RawMessage {
+	return ros.NewRawMessage(m.Connection.MessageType(), m.Data)
+}
+
+// ChunkInfo summarizes a chunk.
+type ChunkInfo struct {
+	Pos            int64
+	StartTime      ros.Time
+	EndTime        ros.Time
+	Compression    string
+	Size           uint32
+	CompressedSize uint32
+	// MessageCounts maps connection IDs to their number of messages.
+	MessageCounts map[uint32]uint32
+	dataPos       int64
+	// The index records following the chunk.
+	indexPos     int64
+	indexLength  int64
+	indexOffsets map[uint32]int64
+	// crc is the checksum of the uncompressed data of MCAP chunks, or zero.
+	crc uint32
+}
+
+// indexEntry locates a message in the uncompressed data of a chunk.
+type indexEntry struct {
+	time   ros.Time
+	offset uint32
+}
+
+// Record headers are a sequence of length prefixed name=value fields, where
+// values are binary.
+
+type recordHeader map[string][]byte
+
+func (h recordHeader) op() (byte, error) {
+	v, ok := h["op"]
+	if !ok || len(v) != 1 {
+		return 0, fmt.Errorf("rosbag: record has no op")
+	}
+	return v[0], nil
+}
+
+func (h recordHeader) uint32(name string) (uint32, error) {
+	v, ok := h[name]
+	if !ok || len(v) != 4 {
+		return 0, fmt.Errorf("rosbag: record has no %s field", name)
+	}
+	return binary.LittleEndian.Uint32(v), nil
+}
+
+func (h recordHeader) uint64(name string) (uint64, error) {
+	v, ok := h[name]
+	if !ok || len(v) != 8 {
+		return 0, fmt.Errorf("rosbag: record has no %s field", name)
+	}
+	return binary.LittleEndian.Uint64(v), nil
+}
+
+func (h recordHeader) time(name string) (ros.Time, error) {
+	v, ok := h[name]
+	if !ok || len(v) != 8 {
+		return ros.Time{}, fmt.Errorf("rosbag: record has no %s field", name)
+	}
+	return unpackTime(v), nil
+}
+
+func (h recordHeader) string(name string) (string, error) {
+	v, ok := h[name]
+	if !ok {
+		return "", fmt.Errorf("rosbag: record has no %s field", name)
+	}
+	return string(v), nil
+}
+
+func parseHeader(buf []byte) (recordHeader, error) {
+	h := recordHeader{}
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return nil, fmt.Errorf("rosbag: truncated header field")
+		}
+		n := binary.LittleEndian.Uint32(buf)
+		buf = buf[4:]
+		if uint32(len(buf)) < n {
+			return nil, fmt.Errorf("rosbag: truncated header field")
+		}
+		field := buf[:n]
+		buf = buf[n:]
+		i := bytes.IndexByte(field, '=')
+		if i < 0 {
+			return nil, fmt.Errorf("rosbag: header field without '='")
+		}
+		h[string(field[:i])] = field[i+1:]
+	}
+	return h, nil
+}
+
+// stringHeader converts the header of connection data.
+func stringHeader(h recordHeader) map[string]string {
+	result := make(map[string]string, len(h))
+	for k, v := range h {
+		result[k] = string(v)
+	}
+	return result
+}
+
+type field struct {
+	name  string
+	value []byte
+}
+
+func packHeader(fields ...field) []byte {
+	var buf bytes.Buffer
+	for _, f := range fields {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(f.name)+1+len(f.value)))
+		buf.WriteString(f.name)
+		buf.WriteByte('=')
+		buf.Write(f.value)
+	}
+	return buf.Bytes()
+}
+
+// packStringHeader packs a connection header with sorted field names.
+func packStringHeader(header map[string]string) []byte {
+	var fields []field
+	for _, k := range sortedKeys(header) {
+		fields = append(fields, field{k, []byte(header[k])})
+	}
+	return packHeader(fields...)
+}
+
+func packOp(op byte) []byte {
+	return []byte{op}
+}
+
+func packUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+func packUint64(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+func packTime(t ros.Time) []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, t.Sec)
+	binary.LittleEndian.PutUint32(b[4:], t.NSec)
+	return b
+}
+
+func unpackTime(b []byte) ros.Time {
+	return ros.NewTime(binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:]))
+}
+
+// readRecordHeader reads the header of a record and the length of its data.
+func readRecordHeader(r io.Reader) (recordHeader, uint32, error) {
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, 0, err
+	}
+	buf, err := readBytes(r, uint64(n))
+	if err != nil {
+		return nil, 0, err
+	}
+	h, err := parseHeader(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+	var dataLen uint32
+	if err := binary.Read(r, binary.LittleEndian, &dataLen); err != nil {
+		return nil, 0, unexpectedEOF(err)
+	}
+	return h, dataLen, nil
+}
+
+// readRecord reads a whole record.
+func readRecord(r io.Reader) (recordHeader, []byte, error) {
+	h, n, err := readRecordHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := readBytes(r, uint64(n))
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, data, nil
+}
+
+// lenReader is a reader which knows how many bytes it has left.
+type lenReader interface {
+	io.Reader
+	Len() int
+}
+
+// readBytes reads n bytes whose count comes from the file. Counts larger
+// than what a lenReader has left are an error. Other readers fill a buffer
+// growing with the data read instead of one allocated at once, so that a
+// corrupt count cannot exhaust the memory. The bytes read are returned with
+// the error.
+func readBytes(r io.Reader, n uint64) ([]byte, error) {
+	if lr, ok := r.(lenReader); ok {
+		if left := uint64(lr.Len()); n > left {
+			data := make([]byte, left)
+			read, _ := io.ReadFull(r, data)
+			return data[:read], fmt.Errorf("rosbag: size %d exceeds the %d bytes left", n, left)
+		}
+		data := make([]byte, n)
+		read, err := io.ReadFull(r, data)
+		return data[:read], unexpectedEOF(err)
+	}
+	if n > math.MaxInt64 {
+		return nil, fmt.Errorf("rosbag: size %d is too large", n)
+	}
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, int64(n))
+	return buf.Bytes(), unexpectedEOF(err)
+}
+
+func writeRecord(w io.Writer, header []byte, data []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(header))); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// parseConnection parses a connection record.
+func parseConnection(h recordHeader, data []byte) (*Connection, error) {
+	id, err := h.uint32("conn")
+	if err != nil {
+		return nil, err
+	}
+	topic, err := h.string("topic")
+	if err != nil {
+		return nil, err
+	}
+	connHeader, err := parseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	return newConnection(id, topic, stringHeader(connHeader)), nil
+}
+
+// parseMessage parses the header of a message data record.
+func parseMessage(h recordHeader) (uint32, ros.Time, error) {
+	id, err := h.uint32("conn")
+	if err != nil {
+		return 0, ros.Time{}, err
+	}
+	t, err := h.time("time")
+	return id, t, err
+}
+
+func formatOp(op byte) string {
+	return "0x" + strconv.FormatUint(uint64(op), 16)
+}
@@ -0,0 +1,826 @@
+package rosbag
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+type testStringType struct{}
+
+func (t testStringType) Text() string            { return "string data\n" }
+func (t testStringType) MD5Sum() string          { return "992ce8a1687cec8c8bd883ec73ca41d1" }
+func (t testStringType) Name() string            { return "std_msgs/String" }
+func (t testStringType) NewMessage() ros.Message { return &testString{} }
+
+type testString struct {
+	data string
+}
+
+func (m *testString) GetType() ros.MessageType { return testStringType{} }
+
+func (m *testString) Serialize(buf *bytes.Buffer) error {
+	binary.Write(buf, binary.LittleEndian, uint32(len(m.data)))
+	buf.WriteString(m.data)
+	return nil
+}
+
+func (m *testString) Deserialize(buf *ros.Reader) error {
+	var n uint32
+	if err := binary.Read(buf, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	m.data = string(buf.Next(int(n)))
+	return nil
+}
+
+func tempBag(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "rosbag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return filepath.Join(dir, "test.bag")
+}
+
+type readMessage struct {
+	topic string
+	sec   uint32
+	data  string
+}
+
+func readAll(t *testing.T, r *Reader, options ...ReadOption) []readMessage {
+	var result []readMessage
+	it := r.Messages(options...)
+	for it.Next() {
+		m := it.Message()
+		var msg testString
+		if err := m.Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, readMessage{m.Connection.Topic, m.Time.Sec, msg.data})
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestWriteRead(t *testing.T) {
+	path := tempBag(t)
+	w, err := Create(path, WriterChunkSize(64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Messages of /b are written late to span several chunks.
+	for i := uint32(1); i <= 5; i++ {
+		if err := w.Write("/a", ros.NewTime(i, 0), &testString{"a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := uint32(1); i <= 5; i++ {
+		if err := w.Write("/b", ros.NewTime(i, 500), &testString{"b"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if len(r.Chunks()) < 2 {
+		t.Errorf("expected several chunks but %d", len(r.Chunks()))
+	}
+	if r.Chunks()[0].Pos != int64(len(version)+4+bagHeaderLength+4) {
+		t.Errorf("unexpected position of the first chunk %d", r.Chunks()[0].Pos)
+	}
+	if r.MessageCount() != 10 {
+		t.Errorf("expected 10 messages but %d", r.MessageCount())
+	}
+	if start, end := r.StartTime(), r.EndTime(); start != ros.NewTime(1, 0) || end != ros.NewTime(5, 500) {
+		t.Errorf("unexpected time range %v - %v", start, end)
+	}
+	conns := r.Connections()
+	if len(conns) != 2 {
+		t.Fatalf("expected 2 connections but %d", len(conns))
+	}
+	want := &Connection{
+		ID:                1,
+		Topic:             "/b",
+		Type:              "std_msgs/String",
+		MD5Sum:            "992ce8a1687cec8c8bd883ec73ca41d1",
+		MessageDefinition: "string data\n",
+		Header: map[string]string{
+			"topic":              "/b",
+			"type":               "std_msgs/String",
+			"md5sum":             "992ce8a1687cec8c8bd883ec73ca41d1",
+			"message_definition": "string data\n",
+		},
+	}
+	if !reflect.DeepEqual(conns[1], want) {
+		t.Errorf("expected connection %+v but %+v", want, conns[1])
+	}
+
+	all := readAll(t, r)
+	if len(all) != 10 {
+		t.Fatalf("expected 10 messages but %d", len(all))
+	}
+	for i, m := range all {
+		topic, data := "/a", "a"
+		if i%2 == 1 {
+			topic, data = "/b", "b"
+		}
+		if m.topic != topic || m.data != data || m.sec != uint32(i/2+1) {
+			t.Errorf("message %d: unexpected %+v", i, m)
+		}
+	}
+
+	got := readAll(t, r, ReadTopics("/b"), ReadStart(ros.NewTime(2, 0)), ReadEnd(ros.NewTime(3, 500)))
+	expected := []readMessage{{"/b", 2, "b"}, {"/b", 3, "b"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v but %v", expected, got)
+	}
+	if got := readAll(t, r, ReadTopics("/c")); len(got) != 0 {
+		t.Errorf("expected no message on /c but %v", got)
+	}
+}
+
+func TestWriteRaw(t *testing.T) {
+	var buf bytes.Buffer
+	(&testString{"hello"}).Serialize(&buf)
+	raw := ros.NewRawMessage(ros.AnyMessageType, buf.Bytes())
+	header := map[string]string{
+		"callerid":           "/talker",
+		"latching":           "1",
+		"md5sum":             "992ce8a1687cec8c8bd883ec73ca41d1",
+		"message_definition": "string data\n",
+		"topic":              "/chatter",
+		"type":               "std_msgs/String",
+	}
+
+	path := tempBag(t)
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("/unknown", ros.NewTime(1, 0), raw); err == nil {
+		t.Error("expected an error for a raw message without header")
+	}
+	if err := w.WriteWithHeader("/recorded", ros.NewTime(1, 0), raw, header); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	it := r.Messages()
+	if !it.Next() {
+		t.Fatal(it.Err())
+	}
+	m := it.Message()
+	if m.Connection.Topic != "/recorded" || m.Connection.CallerID != "/talker" || !m.Connection.Latching {
+		t.Errorf("unexpected connection %+v", m.Connection)
+	}
+	if !reflect.DeepEqual(m.Connection.Header, header) {
+		t.Errorf("expected header %v but %v", header, m.Connection.Header)
+	}
+	if got := m.Raw(); !bytes.Equal(got.Bytes, buf.Bytes()) || got.GetType().Name() != "std_msgs/String" {
+		t.Errorf("unexpected raw message %v", got)
+	}
+	if err := m.Decode(ros.NewRawMessage(ros.NewRawMessageType("std_msgs/Int32", "da5909fbe378aeaf85e547e830cc1bb7", ""), nil)); err == nil {
+		t.Error("expected an MD5 sum mismatch")
+	}
+	if it.Next() {
+		t.Error("expected a single message")
+	}
+}
+
+func TestUnindexed(t *testing.T) {
+	path := tempBag(t)
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write("/a", ros.NewTime(1, 0), &testString{"a"})
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err != ErrUnindexed {
+		t.Errorf("expected ErrUnindexed but %v", err)
+	}
+	w.Close()
+
+	ioutil.WriteFile(path, []byte("#ROSBAG V1.2\n"), 0644)
+	if _, err := Open(path); err == nil {
+		t.Error("expected an error for a bag of another version")
+	}
+}
+
+// TestCorruptSizes checks that sizes read from a corrupt bag are checked
+// instead of being allocated.
+func TestCorruptSizes(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionLZ4} {
+		path := tempBag(t)
+		w, err := Create(path, WriterCompression(compression))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write("/a", ros.NewTime(1, 0), &testString{"a"})
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The size is the last field of the chunk header, followed by the
+		// length of the chunk data.
+		sizePos := bytes.Index(data, []byte("size=")) + len("size=")
+		corrupt := func(pos int) []byte {
+			b := append([]byte{}, data...)
+			binary.LittleEndian.PutUint32(b[pos:], 0xfffffff0)
+			return b
+		}
+
+		if _, err := NewReader(bytes.NewReader(corrupt(sizePos + 4))); err == nil {
+			t.Errorf("%s: expected an error for a chunk past the end of the file", compression)
+		}
+		r, err := NewReader(bytes.NewReader(corrupt(sizePos)))
+		if err == nil {
+			it := r.Messages()
+			for it.Next() {
+			}
+			err = it.Err()
+		}
+		if err == nil {
+			t.Errorf("%s: expected an error for a chunk larger than its data", compression)
+		}
+
+		s := NewScanner(bytes.NewReader(corrupt(sizePos)))
+		for s.Next() {
+		}
+		if s.Err() == nil {
+			t.Errorf("%s: expected a scan error for a chunk larger than its data", compression)
+		}
+		s = NewScanner(bytes.NewReader(corrupt(sizePos + 4)))
+		for s.Next() {
+		}
+		if !s.Truncated() {
+			t.Errorf("%s: expected a chunk past the end of the file to be truncated", compression)
+		}
+	}
+}
+
+func scanAll(t *testing.T, data []byte) ([]string, bool) {
+	var result []string
+	s := NewScanner(bytes.NewReader(data))
+	for s.Next() {
+		var msg testString
+		if err := s.Message().Decode(&msg); err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, msg.data)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("scanning %d bytes: %v", len(data), err)
+	}
+	return result, s.Truncated()
+}
+
+func TestScanner(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionLZ4} {
+		path := tempBag(t)
+		w, err := Create(path, WriterChunkSize(64), WriterCompression(compression))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for i := uint32(0); i < 10; i++ {
+			want = append(want, fmt.Sprint(i))
+			w.Write("/a", ros.NewTime(i, 0), &testString{fmt.Sprint(i)})
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		// The bag is not indexed until the writer is closed.
+		unindexed, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		indexed, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got, truncated := scanAll(t, indexed); !reflect.DeepEqual(got, want) || truncated {
+			t.Errorf("%s: expected %v but %v, truncated %v", compression, want, got, truncated)
+		}
+		if got, truncated := scanAll(t, unindexed); !reflect.DeepEqual(got, want) || truncated {
+			t.Errorf("%s: expected %v but %v, truncated %v", compression, want, got, truncated)
+		}
+		// Cutting the bag anywhere loses only the last messages. Cuts between
+		// records cannot be told from the end of the bag.
+		truncations := 0
+		for n := len(unindexed) - 1; n > len(version)+4+bagHeaderLength+4; n -= 7 {
+			got, truncated := scanAll(t, unindexed[:n])
+			if len(got) > 0 && !reflect.DeepEqual(got, want[:len(got)]) {
+				t.Fatalf("%s: unexpected messages %v of %d bytes", compression, got, n)
+			}
+			if truncated {
+				truncations++
+			}
+		}
+		if truncations == 0 {
+			t.Errorf("%s: truncation was never reported", compression)
+		}
+	}
+}
+
+func TestMCAP(t *testing.T) {
+	var buf bytes.Buffer
+	(&testString{"latched"}).Serialize(&buf)
+	raw := ros.NewRawMessage(ros.AnyMessageType, buf.Bytes())
+	header := map[string]string{
+		"callerid":           "/talker",
+		"latching":           "1",
+		"md5sum":             "992ce8a1687cec8c8bd883ec73ca41d1",
+		"message_definition": "string data\n",
+		"topic":              "/b",
+		"type":               "std_msgs/String",
+	}
+	for _, compression := range []string{CompressionNone, CompressionLZ4} {
+		path := strings.TrimSuffix(tempBag(t), ".bag") + ".mcap"
+		w, err := Create(path, WriterChunkSize(64), WriterCompression(compression))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for i := uint32(1); i <= 10; i++ {
+			want = append(want, fmt.Sprint(i))
+			w.Write("/a", ros.NewTime(i, 0), &testString{fmt.Sprint(i)})
+		}
+		if err := w.WriteWithHeader("/b", ros.NewTime(3, 5), raw, header); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Open(path); err != ErrUnindexed {
+			t.Errorf("%s: expected ErrUnindexed but %v", compression, err)
+		}
+		unfinished, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(data, mcapMagic) || !bytes.HasSuffix(data, mcapMagic) {
+			t.Fatalf("%s: missing MCAP magic", compression)
+		}
+
+		r, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Format() != FormatMCAP || r.MessageCount() != 11 || len(r.Chunks()) < 2 {
+			t.Errorf("%s: unexpected %s file of %d messages in %d chunks", compression, r.Format(), r.MessageCount(), len(r.Chunks()))
+		}
+		if c := r.Chunks()[0]; c.Compression != compression {
+			t.Errorf("%s: unexpected chunk compression %q", compression, c.Compression)
+		}
+		if start, end := r.StartTime(), r.EndTime(); start != ros.NewTime(1, 0) || end != ros.NewTime(10, 0) {
+			t.Errorf("%s: unexpected time range %v - %v", compression, start, end)
+		}
+		conns := r.Connections()
+		if len(conns) != 2 || !reflect.DeepEqual(conns[1].Header, header) || !conns[1].Latching {
+			t.Errorf("%s: unexpected connections %+v", compression, conns)
+		}
+		got := readAll(t, r, ReadStart(ros.NewTime(2, 0)), ReadEnd(ros.NewTime(3, 0)))
+		expected := []readMessage{{"/a", 2, "2"}, {"/a", 3, "3"}}
+		if !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v but %v", compression, expected, got)
+		}
+		// The latched message is read in time order.
+		got = readAll(t, r)
+		if len(got) != 11 || got[3] != (readMessage{"/b", 3, "latched"}) {
+			t.Errorf("%s: unexpected messages %v", compression, got)
+		}
+		r.Close()
+
+		want = append(want, "latched")
+		if got, truncated := scanAll(t, data); !reflect.DeepEqual(got, want) || truncated {
+			t.Errorf("%s: expected %v but %v, truncated %v", compression, want, got, truncated)
+		}
+		// Files which were not closed miss their data end record.
+		if got, truncated := scanAll(t, unfinished); !reflect.DeepEqual(got, want) || !truncated {
+			t.Errorf("%s: expected %v but %v, truncated %v", compression, want, got, truncated)
+		}
+		for n := len(unfinished) - 1; n > len(mcapMagic); n -= 7 {
+			if got, _ := scanAll(t, unfinished[:n]); len(got) > 0 && !reflect.DeepEqual(got, want[:len(got)]) {
+				t.Fatalf("%s: unexpected messages %v of %d bytes", compression, got, n)
+			}
+		}
+	}
+
+	if _, err := NewWriter(nil, WriterFormat(FormatMCAP), WriterCompression(CompressionBZ2)); err == nil {
+		t.Error("expected an error for bz2 compression of MCAP files")
+	}
+}
+
+func TestMCAPZstd(t *testing.T) {
+	conn := newConnection(1, "/a", map[string]string{
+		"topic":              "/a",
+		"type":               "std_msgs/String",
+		"message_definition": "string data\n",
+	})
+	var records bytes.Buffer
+	records.Write((&mcapSchema{1, conn.Type, conn.MessageDefinition}).record())
+	records.Write(channelRecord(conn, 1))
+	for _, s := range []string{"x", "y"} {
+		var e mcapEncoder
+		e.uint16(1)
+		e.uint32(0)
+		e.time(ros.NewTime(1, 0))
+		e.time(ros.NewTime(1, 0))
+		(&testString{s}).Serialize(&e.Buffer)
+		records.Write(e.record(mcapOpMessage))
+	}
+	// A frame of a single raw block.
+	n := records.Len()
+	frame := []byte{0x28, 0xb5, 0x2f, 0xfd, 0x20, byte(n), byte(n<<3 | 1), byte(n >> 5), byte(n >> 13)}
+	frame = append(frame, records.Bytes()...)
+
+	var file, header, chunk, end mcapEncoder
+	file.Write(mcapMagic)
+	header.string(mcapProfile)
+	header.string("")
+	file.Write(header.record(mcapOpHeader))
+	chunk.time(ros.NewTime(1, 0))
+	chunk.time(ros.NewTime(1, 0))
+	chunk.uint64(uint64(n))
+	chunk.uint32(0)
+	chunk.string(CompressionZSTD)
+	chunk.uint64(uint64(len(frame)))
+	chunk.Write(frame)
+	file.Write(chunk.record(mcapOpChunk))
+	end.uint32(0)
+	file.Write(end.record(mcapOpDataEnd))
+
+	got, truncated := scanAll(t, file.Bytes())
+	if want := []string{"x", "y"}; !reflect.DeepEqual(got, want) || truncated {
+		t.Errorf("expected %v but %v, truncated %v", want, got, truncated)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	for _, compression := range []string{CompressionNone, CompressionBZ2, CompressionLZ4} {
+		path := tempBag(t)
+		w, err := Create(path, WriterCompression(compression), WriterChunkSize(4096))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := uint32(0); i < 1000; i++ {
+			if err := w.Write("/a", ros.NewTime(i, 0), &testString{fmt.Sprintf("message %d", i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, chunk := range r.Chunks() {
+			if chunk.Compression != compression {
+				t.Errorf("%s: unexpected chunk compression %q", compression, chunk.Compression)
+			}
+			if compression != CompressionNone && chunk.CompressedSize >= chunk.Size {
+				t.Errorf("%s: chunk of %d bytes compressed to %d", compression, chunk.Size, chunk.CompressedSize)
+			}
+		}
+		messages := readAll(t, r, ReadStart(ros.NewTime(990, 0)))
+		if len(messages) != 10 || messages[9].data != "message 999" {
+			t.Errorf("%s: unexpected messages %v", compression, messages)
+		}
+		r.Close()
+	}
+
+	if _, err := NewWriter(nil, WriterCompression("zstd")); err == nil {
+		t.Error("expected an error for an unsupported compression")
+	}
+}
+
+func TestCodecs(t *testing.T) {
+	random := make([]byte, 100000)
+	rand.New(rand.NewSource(1)).Read(random)
+	for _, input := range [][]byte{
+		[]byte("a"),
+		[]byte("abababababababababab"),
+		bytes.Repeat([]byte{7}, 1000),
+		random,
+		bytes.Repeat(random[:300], 1000),
+	} {
+		out, err := ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(bz2Compress(input))))
+		if err != nil || !bytes.Equal(out, input) {
+			t.Errorf("bz2 round trip of %d bytes failed: %v", len(input), err)
+		}
+		out, err = ioutil.ReadAll(newLZ4Reader(bytes.NewReader(lz4Compress(input))))
+		if err != nil || !bytes.Equal(out, input) {
+			t.Errorf("lz4 round trip of %d bytes failed: %v", len(input), err)
+		}
+	}
+
+	// Written by the lz4 tool with linked blocks, block checksums and the
+	// content size.
+	frame, _ := hex.DecodeString("04224d187c4045000000000000007022000000ff08726f73626167206c7a34206672616d6520746573742c2017001650657374210a69afafbe000000007f74e3ac")
+	out, err := ioutil.ReadAll(newLZ4Reader(bytes.NewReader(frame)))
+	if want := "rosbag lz4 frame test, rosbag lz4 frame test, rosbag lz4 frame test!\n"; err != nil || string(out) != want {
+		t.Errorf("expected %q but %q (%v)", want, out, err)
+	}
+	frame[len(frame)-1]++
+	if _, err := ioutil.ReadAll(newLZ4Reader(bytes.NewReader(frame))); err == nil {
+		t.Error("expected a content checksum error")
+	}
+
+	for input, want := range map[string]uint32{"": 0x02cc5d05, "a": 0x550d7456, "abc": 0x32d153ff} {
+		if got := xxh32([]byte(input)); got != want {
+			t.Errorf("xxh32(%q): expected %08x but %08x", input, want, got)
+		}
+	}
+
+	// Written by the zstd tool at level 19, with a skippable frame and a
+	// frame of raw literals.
+	var seq bytes.Buffer
+	for i := 0; i < 300; i++ {
+		fmt.Fprintf(&seq, "message %d\n", i)
+	}
+	frame, _ = hex.DecodeString("28b52ffd64a20cad0a0086a04011d0653805244ac1a39452a69452c012091d3d0038003a000f4783b18858d1c85d2eaa68e42e17543472978b291ab9cb85148ddce5e2452377b970d1c85d2e5a3472970b168ddce5563472971b022018040a0501213125242322174b853209a9d3e7f2dfeff93d5e268fc5b75dd373b84a9d4a5fb765d7689138149e66498ec11a6d26fbbc8edb621514131201755b768d168943e16996e418acd166b2cfebb82d56413121f17034188b0856514d49bd5c2dd62aaa886848e8642a914641353433321f4f87b3094315d594d4cbd562ada28a8886844ea612691454433323f3f174389b98129211918ba5429984d4e973f9eff7fc1e2f93c7e2dbaee9395ca54ea50f812ba81140f5b603f12b6b119c50f803d1b5a6d4ba545a574aebead0b8aea5d2b552b656ca5aebbabbc230638ba1764cc6388c5363b8c671c40ee3098fa1762ce0561d68611bc336866d668b2da05601c9581eb5" +
+		"502a4d180300000061626328b52ffd241d8d00005868656c6c6f20776f726c640100f14a11d75f93d4")
+	out, err = zstdDecompress(frame, 0)
+	if want := seq.String() + "hello hello hello hello world"; err != nil || string(out) != want {
+		t.Errorf("expected %q but %q (%v)", want, out, err)
+	}
+	frame[len(frame)-1]++
+	if _, err := zstdDecompress(frame, 0); err == nil {
+		t.Error("expected a zstd checksum error")
+	}
+	for input, want := range map[string]uint64{"": 0xef46db3751d8e999, "a": 0xd24ec4f1a98c6e5b, "abc": 0x44bc2cf5ad770999} {
+		if got := xxh64([]byte(input)); got != want {
+			t.Errorf("xxh64(%q): expected %016x but %016x", input, want, got)
+		}
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	talker, err := ros.NewNode("/talker", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer talker.Shutdown()
+	chatter := talker.NewPublisher("/chatter", testStringType{})
+	status := talker.NewPublisher("/status", testStringType{}, ros.PublisherLatched(true))
+	status.Publish(&testString{"ready"})
+	ignored := talker.NewPublisher("/ignored", testStringType{})
+
+	node, err := ros.NewNode("/recorder", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+	path := filepath.Join(filepath.Dir(tempBag(t)), "record.bag")
+	recorder, err := NewRecorder(node, path,
+		RecorderRegex(regexp.MustCompile("^/(chatter|status)$"), regexp.MustCompile("^/late")),
+		RecorderDiscoveryPeriod(50*time.Millisecond),
+		RecorderSplitSize(8192),
+		RecorderMaxSplits(2),
+		RecorderWriterOptions(WriterChunkSize(1024)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		node.Spin()
+	}()
+
+	late := talker.NewPublisher("/late", testStringType{})
+	payload := string(bytes.Repeat([]byte("x"), 100))
+	for i := 0; i < 100; i++ {
+		chatter.Publish(&testString{payload})
+		late.Publish(&testString{"late"})
+		ignored.Publish(&testString{"ignored"})
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := recorder.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+	node.Shutdown()
+	<-done
+
+	bags := recorder.Bags()
+	if len(bags) != 2 {
+		t.Fatalf("expected 2 bags but %v", bags)
+	}
+	matches, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "record_*.bag*"))
+	if !reflect.DeepEqual(matches, bags) {
+		t.Errorf("expected only %v on disk but %v", bags, matches)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), "record_0.bag")); err == nil {
+		t.Error("expected the oldest bag to be deleted")
+	}
+
+	topics := map[string]int{}
+	for _, bag := range bags {
+		r, err := Open(bag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range readAll(t, r) {
+			topics[m.topic]++
+		}
+		for _, c := range r.Connections() {
+			if c.Topic == "/status" && (!c.Latching || c.CallerID != "/talker") {
+				t.Errorf("unexpected connection %+v", c)
+			}
+		}
+		r.Close()
+	}
+	if topics["/chatter"] == 0 || topics["/late"] == 0 || topics["/ignored"] != 0 {
+		t.Errorf("unexpected recorded topics %v", topics)
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	path := tempBag(t)
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.WriteWithHeader("/status", ros.NewTime(100, 0), &testString{"ready"}, map[string]string{"latching": "1", "callerid": "/talker"})
+	for i := uint32(0); i < 5; i++ {
+		w.Write("/chatter", ros.NewTime(100, i*100000000), &testString{fmt.Sprint(i)})
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	listener, err := ros.NewNode("/listener", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mutex sync.Mutex
+	var received []string
+	var latched bool
+	var clock ros.Time
+	listener.NewSubscriber("/remapped", testStringType{}, func(msg *testString) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		received = append(received, msg.data)
+	})
+	listener.NewSubscriber("/status", testStringType{}, func(msg *testString, event ros.MessageEvent) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		latched = event.ConnectionHeader["latching"] == "1"
+	})
+	listener.NewSubscriber("/clock", ClockType, func(msg *ros.RawMessage) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		clock = unpackTime(msg.Bytes)
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		listener.Spin()
+	}()
+	defer func() {
+		listener.Shutdown()
+		<-done
+	}()
+	receivedCount := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(received)
+	}
+
+	node, err := ros.NewNode("/player", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+	player, err := NewPlayer(node, []*Reader{r},
+		PlayerRate(2),
+		PlayerStart(100*time.Millisecond),
+		PlayerRemap("/chatter", "/remapped"),
+		PlayerClock(100),
+		PlayerDelay(500*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	begin := time.Now()
+	if err := player.Play(); err != nil {
+		t.Fatal(err)
+	}
+	// From 100.1s to 100.4s at twice the speed.
+	if elapsed := time.Since(begin) - 500*time.Millisecond; elapsed < 140*time.Millisecond || elapsed > time.Second {
+		t.Errorf("unexpected playback duration %v", elapsed)
+	}
+	time.Sleep(100 * time.Millisecond)
+	mutex.Lock()
+	if want := []string{"1", "2", "3", "4"}; !reflect.DeepEqual(received, want) {
+		t.Errorf("expected %v but %v", want, received)
+	}
+	if clock != ros.NewTime(100, 400000000) {
+		t.Errorf("unexpected clock %v", clock)
+	}
+	if latched {
+		t.Error("status should not be played before the start offset")
+	}
+	received = nil
+	mutex.Unlock()
+	player.Shutdown()
+
+	stepper, err := ros.NewNode("/stepper", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stepper.Shutdown()
+	player, err = NewPlayer(stepper, []*Reader{r}, PlayerPaused(true), PlayerTopics("/chatter"), PlayerRemap("/chatter", "/remapped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer player.Shutdown()
+	finished := make(chan error)
+	go func() { finished <- player.Play() }()
+	time.Sleep(400 * time.Millisecond)
+	if n := receivedCount(); n != 0 {
+		t.Errorf("expected no message while paused but %d", n)
+	}
+	player.Step()
+	player.Step()
+	time.Sleep(200 * time.Millisecond)
+	if n := receivedCount(); n != 2 {
+		t.Errorf("expected 2 stepped messages but %d", n)
+	}
+	if got := player.Time(); got != ros.NewTime(100, 100000000) {
+		t.Errorf("unexpected player time %v", got)
+	}
+	player.Resume()
+	if err := <-finished; err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := receivedCount(); n != 5 {
+		t.Errorf("expected 5 messages but %d", n)
+	}
+}
@@ -0,0 +1,197 @@
+package rosbag
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Scanner reads the messages of a bag or MCAP file in file order without
+// its index, which is how files whose recording was interrupted are
+// recovered. A file cut in the middle of a record ends the scan without
+// error, and Truncated reports it.
+type Scanner struct {
+	r           *bufio.Reader
+	connections map[uint32]*Connection
+	// mcap builds the connections of MCAP files.
+	mcap *mcapConnections
+	// The uncompressed records of the chunk being scanned.
+	chunk     *bytes.Reader
+	message   *Message
+	err       error
+	truncated bool
+	done      bool
+}
+
+// NewScanner starts scanning the bag in r.
+func NewScanner(r io.Reader) *Scanner {
+	s := &Scanner{r: bufio.NewReader(r), connections: map[uint32]*Connection{}}
+	if magic, err := s.r.Peek(len(mcapMagic)); err == nil && bytes.Equal(magic, mcapMagic) {
+		s.startMCAP()
+		return s
+	}
+	if err := readVersion(s.r); err != nil {
+		s.err = err
+		return s
+	}
+	h, _, err := readRecord(s.r)
+	if err != nil {
+		s.err = err
+		return s
+	}
+	if op, err := h.op(); err != nil || op != opBagHeader {
+		s.err = fmt.Errorf("rosbag: missing bag header record")
+	}
+	return s
+}
+
+// Next reads the next message and reports whether there was one.
+func (s *Scanner) Next() bool {
+	if s.mcap != nil {
+		return s.nextMCAP()
+	}
+	for s.err == nil {
+		if s.chunk != nil && s.chunk.Len() > 0 {
+			h, data, err := readRecord(s.chunk)
+			if err != nil {
+				// Only the end of a truncated chunk is lost.
+				s.truncated = true
+				s.chunk = nil
+				continue
+			}
+			if ok := s.handle(h, data); ok {
+				return true
+			}
+			continue
+		}
+		s.chunk = nil
+		if s.done {
+			return false
+		}
+
+		h, n, err := readRecordHeader(s.r)
+		if err == io.EOF {
+			s.done = true
+			return false
+		}
+		if err != nil {
+			s.stop(err)
+			return false
+		}
+		if op, _ := h.op(); op == opChunk {
+			s.readChunk(h, n)
+			continue
+		}
+		data, err := readBytes(s.r, uint64(n))
+		if err != nil {
+			s.stop(err)
+			return false
+		}
+		if ok := s.handle(h, data); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// stop ends the scan, which is not an error at the end of a truncated bag.
+func (s *Scanner) stop(err error) {
+	if err == io.ErrUnexpectedEOF {
+		s.truncated = true
+		s.done = true
+		return
+	}
+	s.err = err
+}
+
+// readChunk decompresses as much of the chunk as is in the file.
+func (s *Scanner) readChunk(h recordHeader, n uint32) {
+	compression, err := h.string("compression")
+	if err != nil {
+		s.err = err
+		return
+	}
+	size, err := h.uint32("size")
+	if err != nil {
+		s.err = err
+		return
+	}
+	compressed, err := readBytes(s.r, uint64(n))
+	if err != nil {
+		s.truncated = true
+		s.done = true
+	}
+	s.decompress(compression, compressed, size)
+}
+
+// decompress starts scanning the records of a chunk, which may be cut. The
+// size is only trusted as far as the data of the chunk goes.
+func (s *Scanner) decompress(compression string, compressed []byte, size uint32) {
+	src, err := newDecompressor(compression, bytes.NewReader(compressed))
+	if err != nil {
+		if s.truncated {
+			return
+		}
+		s.err = err
+		return
+	}
+	data, err := readBytes(src, uint64(size))
+	if err != nil && !s.truncated {
+		s.err = fmt.Errorf("rosbag: cannot read chunk: %v", err)
+		return
+	}
+	s.chunk = bytes.NewReader(data)
+}
+
+// handle processes a record and reports whether it is a message.
+func (s *Scanner) handle(h recordHeader, data []byte) bool {
+	op, err := h.op()
+	if err != nil {
+		s.err = err
+		return false
+	}
+	switch op {
+	case opConnection:
+		conn, err := parseConnection(h, data)
+		if err != nil {
+			s.err = err
+			return false
+		}
+		if _, ok := s.connections[conn.ID]; !ok {
+			s.connections[conn.ID] = conn
+		}
+	case opMessageData:
+		id, t, err := parseMessage(h)
+		if err != nil {
+			s.err = err
+			return false
+		}
+		conn, ok := s.connections[id]
+		if !ok {
+			s.err = fmt.Errorf("rosbag: message of unknown connection %d", id)
+			return false
+		}
+		s.message = &Message{conn, t, data}
+		return true
+	case opIndexData, opChunkInfo:
+	default:
+		s.err = fmt.Errorf("rosbag: unexpected record of op %s", formatOp(op))
+	}
+	return false
+}
+
+// Message returns the message read by Next.
+func (s *Scanner) Message() *Message {
+	return s.message
+}
+
+// Err returns the error which stopped the scan.
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Truncated reports whether the end of the bag was missing.
+func (s *Scanner) Truncated() bool {
+	return s.truncated
+}
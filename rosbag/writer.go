@@ -0,0 +1,425 @@
+package rosbag
+
+import (
+	"bytes"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// DefaultChunkSize is the uncompressed size at which chunks are written.
+const DefaultChunkSize = 768 * 1024
+
+// Chunk compressions. zstd chunks of MCAP files can be read but not
+// written.
+const (
+	CompressionNone = "none"
+	CompressionBZ2  = "bz2"
+	CompressionLZ4  = "lz4"
+	CompressionZSTD = "zstd"
+)
+
+// File formats.
+const (
+	FormatBag  = "bag"
+	FormatMCAP = "mcap"
+)
+
+// WriterOption configures a Writer.
+type WriterOption func(w *Writer)
+
+// WriterChunkSize sets the uncompressed size at which chunks are written.
+func WriterChunkSize(size int) WriterOption {
+	return func(w *Writer) {
+		w.chunkSize = size
+	}
+}
+
+// WriterCompression sets the compression of the chunks, CompressionNone by
+// default.
+func WriterCompression(compression string) WriterOption {
+	return func(w *Writer) {
+		w.compression = compression
+	}
+}
+
+// WriterFormat sets the file format, FormatBag by default or FormatMCAP for
+// paths ending with .mcap.
+func WriterFormat(format string) WriterOption {
+	return func(w *Writer) {
+		w.format = format
+	}
+}
+
+// Writer writes a bag. Its methods are safe for concurrent use.
+type Writer struct {
+	mutex       sync.Mutex
+	w           io.WriteSeeker
+	closer      io.Closer
+	pos         int64
+	format      string
+	chunkSize   int
+	compression string
+	connections []*Connection
+	connIDs     map[string]*Connection
+	chunks      []*ChunkInfo
+	// The chunk being filled.
+	chunk      bytes.Buffer
+	chunkInfo  *ChunkInfo
+	chunkIndex map[uint32][]indexEntry
+	closed     bool
+	// MCAP state. The CRC covers the data section written so far.
+	crc         hash.Hash32
+	schemas     []*mcapSchema
+	schemaIDs   map[string]uint16
+	connSchemas []uint16
+	sequences   map[uint32]uint32
+}
+
+// Create creates the bag at path. Paths ending with .mcap are MCAP files.
+func Create(path string, options ...WriterOption) (*Writer, error) {
+	if strings.HasSuffix(path, ".mcap") {
+		options = append([]WriterOption{WriterFormat(FormatMCAP)}, options...)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(f, options...)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.closer = f
+	return w, nil
+}
+
+// NewWriter starts a bag in w. The bag is complete once the writer is closed.
+func NewWriter(w io.WriteSeeker, options ...WriterOption) (*Writer, error) {
+	writer := &Writer{
+		w:           w,
+		format:      FormatBag,
+		chunkSize:   DefaultChunkSize,
+		compression: CompressionNone,
+		connIDs:     map[string]*Connection{},
+	}
+	for _, opt := range options {
+		opt(writer)
+	}
+	switch {
+	case writer.format != FormatBag && writer.format != FormatMCAP:
+		return nil, fmt.Errorf("rosbag: unsupported format %q", writer.format)
+	case writer.compression == CompressionNone, writer.compression == CompressionLZ4:
+	case writer.compression == CompressionBZ2 && writer.format == FormatBag:
+	default:
+		return nil, fmt.Errorf("rosbag: unsupported %s compression %q", writer.format, writer.compression)
+	}
+	if writer.format == FormatMCAP {
+		if err := writer.startMCAP(); err != nil {
+			return nil, err
+		}
+		return writer, nil
+	}
+	if err := writer.write([]byte(version)); err != nil {
+		return nil, err
+	}
+	if err := writer.writeBagHeader(0); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) write(b []byte) error {
+	n, err := w.w.Write(b)
+	w.pos += int64(n)
+	if w.crc != nil {
+		w.crc.Write(b[:n])
+	}
+	return err
+}
+
+func (w *Writer) writeRecord(header []byte, data []byte) error {
+	var buf bytes.Buffer
+	writeRecord(&buf, header, data)
+	return w.write(buf.Bytes())
+}
+
+// writeBagHeader writes the bag header record padded to a fixed length.
+func (w *Writer) writeBagHeader(indexPos int64) error {
+	header := packHeader(
+		field{"op", packOp(opBagHeader)},
+		field{"index_pos", packUint64(uint64(indexPos))},
+		field{"conn_count", packUint32(uint32(len(w.connections)))},
+		field{"chunk_count", packUint32(uint32(len(w.chunks)))},
+	)
+	padding := bytes.Repeat([]byte{' '}, bagHeaderLength-len(header))
+	return w.writeRecord(header, padding)
+}
+
+// Write writes a message received on topic at time t. The connection header
+// is built from the type of msg.
+func (w *Writer) Write(topic string, t ros.Time, msg ros.Message) error {
+	return w.WriteWithHeader(topic, t, msg, nil)
+}
+
+// WriteWithHeader writes a message with the connection header it was
+// received with, such as MessageEvent.ConnectionHeader. The type, MD5 sum
+// and definition missing from the header are taken from the type of msg,
+// which is how raw messages of any type keep their actual type.
+func (w *Writer) WriteWithHeader(topic string, t ros.Time, msg ros.Message, header map[string]string) error {
+	var buf bytes.Buffer
+	if err := msg.Serialize(&buf); err != nil {
+		return err
+	}
+	connHeader := map[string]string{}
+	for k, v := range header {
+		connHeader[k] = v
+	}
+	msgType := msg.GetType()
+	for k, v := range map[string]string{
+		"type":               msgType.Name(),
+		"md5sum":             msgType.MD5Sum(),
+		"message_definition": msgType.Text(),
+	} {
+		if _, ok := connHeader[k]; !ok || (connHeader[k] == "*" && v != "*") {
+			connHeader[k] = v
+		}
+	}
+	if _, ok := connHeader["topic"]; !ok {
+		connHeader["topic"] = topic
+	}
+	if connHeader["type"] == "*" || connHeader["md5sum"] == "*" {
+		return fmt.Errorf("rosbag: type of the message on %s is unknown", topic)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writeMessage(w.connection(topic, connHeader), t, buf.Bytes())
+}
+
+// WriteMessage copies a message read from another bag.
+func (w *Writer) WriteMessage(m *Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.writeMessage(w.connection(m.Connection.Topic, m.Connection.Header), m.Time, m.Data)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// connection returns the connection matching the topic and header, which is
+// added to the bag if it is new.
+func (w *Writer) connection(topic string, header map[string]string) *Connection {
+	var key strings.Builder
+	key.WriteString(topic)
+	for _, k := range sortedKeys(header) {
+		fmt.Fprintf(&key, "\x00%s=%s", k, header[k])
+	}
+	if conn, ok := w.connIDs[key.String()]; ok {
+		return conn
+	}
+	conn := newConnection(uint32(len(w.connections)), topic, header)
+	w.connections = append(w.connections, conn)
+	w.connIDs[key.String()] = conn
+	// Readers scanning chunks need the connection before its messages.
+	if w.format == FormatMCAP {
+		w.writeMCAPConnection(conn)
+	} else {
+		writeRecord(&w.chunk, connectionHeader(conn), packStringHeader(conn.Header))
+	}
+	return conn
+}
+
+func connectionHeader(conn *Connection) []byte {
+	return packHeader(
+		field{"op", packOp(opConnection)},
+		field{"conn", packUint32(conn.ID)},
+		field{"topic", []byte(conn.Topic)},
+	)
+}
+
+func (w *Writer) writeMessage(conn *Connection, t ros.Time, data []byte) error {
+	if w.closed {
+		return fmt.Errorf("rosbag: writer is closed")
+	}
+	if w.chunkInfo == nil {
+		w.chunkInfo = &ChunkInfo{StartTime: t, EndTime: t, MessageCounts: map[uint32]uint32{}}
+		w.chunkIndex = map[uint32][]indexEntry{}
+	}
+	if t.Cmp(w.chunkInfo.StartTime) < 0 {
+		w.chunkInfo.StartTime = t
+	}
+	if t.Cmp(w.chunkInfo.EndTime) > 0 {
+		w.chunkInfo.EndTime = t
+	}
+	w.chunkInfo.MessageCounts[conn.ID]++
+	w.chunkIndex[conn.ID] = append(w.chunkIndex[conn.ID], indexEntry{t, uint32(w.chunk.Len())})
+	if w.format == FormatMCAP {
+		w.writeMCAPMessage(conn, t, data)
+	} else {
+		header := packHeader(
+			field{"op", packOp(opMessageData)},
+			field{"conn", packUint32(conn.ID)},
+			field{"time", packTime(t)},
+		)
+		writeRecord(&w.chunk, header, data)
+	}
+	if w.chunk.Len() >= w.chunkSize {
+		return w.flushChunk()
+	}
+	return nil
+}
+
+// flushChunk writes the chunk being filled and its index.
+func (w *Writer) flushChunk() error {
+	if w.chunkInfo == nil {
+		return nil
+	}
+	chunk := w.chunkInfo
+	chunk.Pos = w.pos
+	chunk.Compression = w.compression
+	chunk.Size = uint32(w.chunk.Len())
+	data := w.chunk.Bytes()
+	switch w.compression {
+	case CompressionBZ2:
+		data = bz2Compress(data)
+	case CompressionLZ4:
+		data = lz4Compress(data)
+	}
+	chunk.CompressedSize = uint32(len(data))
+	if w.format == FormatMCAP {
+		if err := w.writeMCAPChunk(chunk, w.chunk.Bytes(), data); err != nil {
+			return err
+		}
+		w.endChunk(chunk)
+		return nil
+	}
+	header := packHeader(
+		field{"op", packOp(opChunk)},
+		field{"compression", []byte(chunk.Compression)},
+		field{"size", packUint32(chunk.Size)},
+	)
+	if err := w.writeRecord(header, data); err != nil {
+		return err
+	}
+
+	var ids []uint32
+	for id := range w.chunkIndex {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		entries := w.chunkIndex[id]
+		header := packHeader(
+			field{"op", packOp(opIndexData)},
+			field{"ver", packUint32(1)},
+			field{"conn", packUint32(id)},
+			field{"count", packUint32(uint32(len(entries)))},
+		)
+		var data bytes.Buffer
+		for _, e := range entries {
+			data.Write(packTime(e.time))
+			data.Write(packUint32(e.offset))
+		}
+		if err := w.writeRecord(header, data.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	w.endChunk(chunk)
+	return nil
+}
+
+func (w *Writer) endChunk(chunk *ChunkInfo) {
+	w.chunks = append(w.chunks, chunk)
+	w.chunk.Reset()
+	w.chunkInfo = nil
+	w.chunkIndex = nil
+}
+
+// Size returns the number of bytes written so far, including the messages
+// buffered in the current chunk.
+func (w *Writer) Size() int64 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.pos + int64(w.chunk.Len())
+}
+
+// Flush writes the messages buffered in the current chunk.
+func (w *Writer) Flush() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.flushChunk()
+}
+
+// Close writes the index and closes the file created by Create.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	err := w.writeIndex()
+	if w.closer != nil {
+		if cerr := w.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (w *Writer) writeIndex() error {
+	if err := w.flushChunk(); err != nil {
+		return err
+	}
+	if w.format == FormatMCAP {
+		return w.writeMCAPSummary()
+	}
+	indexPos := w.pos
+	for _, conn := range w.connections {
+		if err := w.writeRecord(connectionHeader(conn), packStringHeader(conn.Header)); err != nil {
+			return err
+		}
+	}
+	for _, chunk := range w.chunks {
+		var ids []uint32
+		for id := range chunk.MessageCounts {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		header := packHeader(
+			field{"op", packOp(opChunkInfo)},
+			field{"ver", packUint32(1)},
+			field{"chunk_pos", packUint64(uint64(chunk.Pos))},
+			field{"start_time", packTime(chunk.StartTime)},
+			field{"end_time", packTime(chunk.EndTime)},
+			field{"count", packUint32(uint32(len(ids)))},
+		)
+		var data bytes.Buffer
+		for _, id := range ids {
+			data.Write(packUint32(id))
+			data.Write(packUint32(chunk.MessageCounts[id]))
+		}
+		if err := w.writeRecord(header, data.Bytes()); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.w.Seek(int64(len(version)), io.SeekStart); err != nil {
+		return err
+	}
+	return w.writeBagHeader(indexPos)
+}
@@ -0,0 +1,797 @@
+package rosbag
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// zstd decompression as specified by RFC 8878, used to read MCAP chunks.
+// Dictionaries are not supported.
+
+const (
+	zstdMagic          = 0xFD2FB528
+	zstdSkippableMagic = 0x184D2A50
+	zstdMaxBlockSize   = 128 << 10
+)
+
+var errZstdCorrupt = errors.New("rosbag: corrupt zstd data")
+
+// zstdDecompress decodes the frames of src.
+func zstdDecompress(src []byte, sizeHint int) ([]byte, error) {
+	out := make([]byte, 0, sizeHint)
+	for len(src) > 0 {
+		if len(src) < 4 {
+			return nil, errZstdCorrupt
+		}
+		magic := binary.LittleEndian.Uint32(src)
+		if magic&0xFFFFFFF0 == zstdSkippableMagic {
+			if len(src) < 8 {
+				return nil, errZstdCorrupt
+			}
+			n := uint64(binary.LittleEndian.Uint32(src[4:]))
+			if uint64(len(src)-8) < n {
+				return nil, errZstdCorrupt
+			}
+			src = src[8+n:]
+			continue
+		}
+		if magic != zstdMagic {
+			return nil, errors.New("rosbag: not zstd data")
+		}
+		var err error
+		if out, src, err = zstdDecodeFrame(out, src[4:]); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// zstdDecoder holds the state kept between the blocks of a frame.
+type zstdDecoder struct {
+	out       []byte
+	frameFrom int
+	huffman   *huffmanTable
+	repeats   [3]int
+	tables    [3]*fseTable
+}
+
+func zstdDecodeFrame(out []byte, src []byte) ([]byte, []byte, error) {
+	if len(src) < 1 {
+		return nil, nil, errZstdCorrupt
+	}
+	descriptor := src[0]
+	src = src[1:]
+	fcsFlag := descriptor >> 6
+	singleSegment := descriptor&0x20 != 0
+	checksum := descriptor&0x04 != 0
+	if descriptor&0x08 != 0 {
+		return nil, nil, errZstdCorrupt
+	}
+	if descriptor&0x03 != 0 {
+		return nil, nil, errors.New("rosbag: zstd dictionaries are not supported")
+	}
+	n := 0
+	if !singleSegment {
+		n++ // window descriptor
+	}
+	fcsSize := [4]int{0, 2, 4, 8}[fcsFlag]
+	if fcsFlag == 0 && singleSegment {
+		fcsSize = 1
+	}
+	n += fcsSize
+	if len(src) < n {
+		return nil, nil, errZstdCorrupt
+	}
+	src = src[n:]
+
+	d := &zstdDecoder{out: out, frameFrom: len(out), repeats: [3]int{1, 4, 8}}
+	for {
+		if len(src) < 3 {
+			return nil, nil, errZstdCorrupt
+		}
+		header := uint32(src[0]) | uint32(src[1])<<8 | uint32(src[2])<<16
+		src = src[3:]
+		last := header&1 != 0
+		size := int(header >> 3)
+		switch (header >> 1) & 3 {
+		case 0:
+			if len(src) < size {
+				return nil, nil, errZstdCorrupt
+			}
+			d.out = append(d.out, src[:size]...)
+			src = src[size:]
+		case 1:
+			if len(src) < 1 {
+				return nil, nil, errZstdCorrupt
+			}
+			for i := 0; i < size; i++ {
+				d.out = append(d.out, src[0])
+			}
+			src = src[1:]
+		case 2:
+			if len(src) < size || size > zstdMaxBlockSize {
+				return nil, nil, errZstdCorrupt
+			}
+			if err := d.decodeBlock(src[:size]); err != nil {
+				return nil, nil, err
+			}
+			src = src[size:]
+		default:
+			return nil, nil, errZstdCorrupt
+		}
+		if last {
+			break
+		}
+	}
+	if checksum {
+		if len(src) < 4 {
+			return nil, nil, errZstdCorrupt
+		}
+		if uint32(xxh64(d.out[d.frameFrom:])) != binary.LittleEndian.Uint32(src) {
+			return nil, nil, errors.New("rosbag: zstd checksum mismatch")
+		}
+		src = src[4:]
+	}
+	return d.out, src, nil
+}
+
+func (d *zstdDecoder) decodeBlock(src []byte) error {
+	literals, n, err := d.decodeLiterals(src)
+	if err != nil {
+		return err
+	}
+	return d.decodeSequences(src[n:], literals)
+}
+
+// decodeLiterals returns the literals section of a block and its length.
+func (d *zstdDecoder) decodeLiterals(src []byte) ([]byte, int, error) {
+	if len(src) < 1 {
+		return nil, 0, errZstdCorrupt
+	}
+	blockType := src[0] & 3
+	sizeFormat := (src[0] >> 2) & 3
+	if blockType < 2 {
+		var size, n int
+		switch sizeFormat {
+		case 0, 2:
+			size, n = int(src[0]>>3), 1
+		case 1:
+			if len(src) < 2 {
+				return nil, 0, errZstdCorrupt
+			}
+			size, n = int(src[0]>>4)+int(src[1])<<4, 2
+		case 3:
+			if len(src) < 3 {
+				return nil, 0, errZstdCorrupt
+			}
+			size, n = int(src[0]>>4)+int(src[1])<<4+int(src[2])<<12, 3
+		}
+		if blockType == 0 {
+			if len(src) < n+size {
+				return nil, 0, errZstdCorrupt
+			}
+			return src[n : n+size], n + size, nil
+		}
+		if len(src) < n+1 {
+			return nil, 0, errZstdCorrupt
+		}
+		literals := make([]byte, size)
+		for i := range literals {
+			literals[i] = src[n]
+		}
+		return literals, n + 1, nil
+	}
+
+	var regenerated, compressed, n int
+	streams := 4
+	switch sizeFormat {
+	case 0, 1:
+		if len(src) < 3 {
+			return nil, 0, errZstdCorrupt
+		}
+		v := uint32(src[0]) | uint32(src[1])<<8 | uint32(src[2])<<16
+		regenerated, compressed, n = int(v>>4&0x3FF), int(v>>14&0x3FF), 3
+		if sizeFormat == 0 {
+			streams = 1
+		}
+	case 2:
+		if len(src) < 4 {
+			return nil, 0, errZstdCorrupt
+		}
+		v := binary.LittleEndian.Uint32(src)
+		regenerated, compressed, n = int(v>>4&0x3FFF), int(v>>18&0x3FFF), 4
+	case 3:
+		if len(src) < 5 {
+			return nil, 0, errZstdCorrupt
+		}
+		v := uint64(binary.LittleEndian.Uint32(src)) | uint64(src[4])<<32
+		regenerated, compressed, n = int(v>>4&0x3FFFF), int(v>>22&0x3FFFF), 5
+	}
+	if len(src) < n+compressed || regenerated > zstdMaxBlockSize {
+		return nil, 0, errZstdCorrupt
+	}
+	data := src[n : n+compressed]
+	if blockType == 2 {
+		table, size, err := readHuffmanTable(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		d.huffman = table
+		data = data[size:]
+	} else if d.huffman == nil {
+		return nil, 0, errZstdCorrupt
+	}
+
+	literals := make([]byte, regenerated)
+	if streams == 1 {
+		if err := d.huffman.decode(literals, data); err != nil {
+			return nil, 0, err
+		}
+		return literals, n + compressed, nil
+	}
+	if len(data) < 6 {
+		return nil, 0, errZstdCorrupt
+	}
+	sizes := [4]int{
+		int(binary.LittleEndian.Uint16(data)),
+		int(binary.LittleEndian.Uint16(data[2:])),
+		int(binary.LittleEndian.Uint16(data[4:])),
+	}
+	data = data[6:]
+	sizes[3] = len(data) - sizes[0] - sizes[1] - sizes[2]
+	if sizes[3] < 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	segment := (regenerated + 3) / 4
+	out := literals
+	for i, size := range sizes {
+		length := segment
+		if i == 3 {
+			length = len(out)
+		}
+		if length > len(out) {
+			return nil, 0, errZstdCorrupt
+		}
+		if err := d.huffman.decode(out[:length], data[:size]); err != nil {
+			return nil, 0, err
+		}
+		out, data = out[length:], data[size:]
+	}
+	return literals, n + compressed, nil
+}
+
+// backwardBits reads a bit stream from its end, as zstd streams are written.
+// The highest set bit of the last byte marks the start of the stream.
+type backwardBits struct {
+	data []byte
+	pos  int // number of unread bits
+}
+
+func newBackwardBits(data []byte) (*backwardBits, error) {
+	if len(data) == 0 || data[len(data)-1] == 0 {
+		return nil, errZstdCorrupt
+	}
+	last := data[len(data)-1]
+	return &backwardBits{data, 8*len(data) - 8 + bits.Len8(last) - 1}, nil
+}
+
+// peek returns the next n bits, padded with zeros past the start.
+func (b *backwardBits) peek(n int) uint64 {
+	if n == 0 {
+		return 0
+	}
+	start := b.pos - n
+	shift := 0
+	if start < 0 {
+		shift = -start
+		start = 0
+	}
+	i := start / 8
+	var v uint64
+	for j := 0; j < 8 && i+j < len(b.data); j++ {
+		v |= uint64(b.data[i+j]) << (8 * uint(j))
+	}
+	v >>= uint(start % 8)
+	width := n - shift
+	v &= 1<<uint(width) - 1
+	return v << uint(shift)
+}
+
+func (b *backwardBits) read(n int) uint64 {
+	v := b.peek(n)
+	b.pos -= n
+	return v
+}
+
+// overflow reports whether more bits were read than the stream had.
+func (b *backwardBits) overflow() bool {
+	return b.pos < 0
+}
+
+type huffmanEntry struct {
+	symbol byte
+	bits   uint8
+}
+
+type huffmanTable struct {
+	maxBits int
+	entries []huffmanEntry
+}
+
+// readHuffmanTable reads a Huffman tree description and returns its length.
+func readHuffmanTable(src []byte) (*huffmanTable, int, error) {
+	if len(src) < 1 {
+		return nil, 0, errZstdCorrupt
+	}
+	var weights []byte
+	var n int
+	if header := int(src[0]); header >= 128 {
+		count := header - 127
+		n = 1 + (count+1)/2
+		if len(src) < n {
+			return nil, 0, errZstdCorrupt
+		}
+		for i := 0; i < count; i++ {
+			w := src[1+i/2]
+			if i%2 == 0 {
+				w >>= 4
+			}
+			weights = append(weights, w&0xF)
+		}
+	} else {
+		n = 1 + header
+		if len(src) < n {
+			return nil, 0, errZstdCorrupt
+		}
+		var err error
+		if weights, err = fseDecodeWeights(src[1:n]); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// The weight of the last symbol completes the sum to a power of 2.
+	sum := 0
+	for _, w := range weights {
+		if w > 11 {
+			return nil, 0, errZstdCorrupt
+		}
+		if w > 0 {
+			sum += 1 << (w - 1)
+		}
+	}
+	if sum == 0 || len(weights) > 255 {
+		return nil, 0, errZstdCorrupt
+	}
+	maxBits := bits.Len(uint(sum))
+	rest := 1<<uint(maxBits) - sum
+	if rest&(rest-1) != 0 {
+		return nil, 0, errZstdCorrupt
+	}
+	weights = append(weights, byte(bits.Len(uint(rest))))
+	if maxBits > 11 {
+		return nil, 0, errZstdCorrupt
+	}
+
+	table := &huffmanTable{maxBits: maxBits, entries: make([]huffmanEntry, 1<<uint(maxBits))}
+	pos := 0
+	for w := 1; w <= maxBits; w++ {
+		for symbol, weight := range weights {
+			if int(weight) != w {
+				continue
+			}
+			size := 1 << uint(w-1)
+			entry := huffmanEntry{byte(symbol), uint8(maxBits + 1 - w)}
+			for i := 0; i < size; i++ {
+				table.entries[pos+i] = entry
+			}
+			pos += size
+		}
+	}
+	return table, n, nil
+}
+
+func (t *huffmanTable) decode(out []byte, src []byte) error {
+	br, err := newBackwardBits(src)
+	if err != nil {
+		return err
+	}
+	for i := range out {
+		e := t.entries[br.peek(t.maxBits)]
+		out[i] = e.symbol
+		br.pos -= int(e.bits)
+	}
+	if br.pos != 0 {
+		return errZstdCorrupt
+	}
+	return nil
+}
+
+type fseEntry struct {
+	symbol   uint8
+	bits     uint8
+	newState uint16
+}
+
+type fseTable struct {
+	accuracyLog int
+	entries     []fseEntry
+}
+
+// forwardBits reads a bit stream from its start.
+type forwardBits struct {
+	data []byte
+	pos  int
+}
+
+func (b *forwardBits) read(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		byteIndex := (b.pos + i) / 8
+		if byteIndex < len(b.data) && b.data[byteIndex]>>(uint(b.pos+i)%8)&1 != 0 {
+			v |= 1 << uint(i)
+		}
+	}
+	b.pos += n
+	return v
+}
+
+func (b *forwardBits) peek(n int) uint32 {
+	v := b.read(n)
+	b.pos -= n
+	return v
+}
+
+// readFSETable reads an FSE table description and returns its length.
+func readFSETable(src []byte, maxAccuracy, maxSymbol int) (*fseTable, int, error) {
+	br := &forwardBits{data: src}
+	accuracyLog := int(br.read(4)) + 5
+	if accuracyLog > maxAccuracy {
+		return nil, 0, errZstdCorrupt
+	}
+	var probabilities []int
+	remaining := 1<<uint(accuracyLog) + 1
+	threshold := 1 << uint(accuracyLog)
+	nbBits := accuracyLog + 1
+	previous0 := false
+	for remaining > 1 && len(probabilities) <= maxSymbol {
+		if previous0 {
+			for {
+				repeat := int(br.read(2))
+				for i := 0; i < repeat; i++ {
+					probabilities = append(probabilities, 0)
+				}
+				if repeat != 3 {
+					break
+				}
+			}
+			if len(probabilities) > maxSymbol {
+				break
+			}
+		}
+		max := 2*threshold - 1 - remaining
+		var count int
+		if v := int(br.peek(nbBits - 1)); v < max {
+			count = v
+			br.pos += nbBits - 1
+		} else {
+			count = int(br.read(nbBits))
+			if count >= threshold {
+				count -= max
+			}
+		}
+		count--
+		if count < 0 {
+			remaining += count
+		} else {
+			remaining -= count
+		}
+		probabilities = append(probabilities, count)
+		previous0 = count == 0
+		for remaining < threshold {
+			nbBits--
+			threshold >>= 1
+		}
+	}
+	if remaining != 1 || len(probabilities) > maxSymbol+1 || br.pos > 8*len(src) {
+		return nil, 0, errZstdCorrupt
+	}
+	table, err := buildFSETable(probabilities, accuracyLog)
+	return table, (br.pos + 7) / 8, err
+}
+
+func buildFSETable(probabilities []int, accuracyLog int) (*fseTable, error) {
+	size := 1 << uint(accuracyLog)
+	table := &fseTable{accuracyLog: accuracyLog, entries: make([]fseEntry, size)}
+	next := make([]int, len(probabilities))
+	high := size - 1
+	for s, p := range probabilities {
+		if p == -1 {
+			table.entries[high].symbol = uint8(s)
+			high--
+			next[s] = 1
+		} else {
+			next[s] = p
+		}
+	}
+	pos := 0
+	step := size>>1 + size>>3 + 3
+	mask := size - 1
+	for s, p := range probabilities {
+		for i := 0; i < p; i++ {
+			table.entries[pos].symbol = uint8(s)
+			pos = (pos + step) & mask
+			for pos > high {
+				pos = (pos + step) & mask
+			}
+		}
+	}
+	if pos != 0 {
+		return nil, errZstdCorrupt
+	}
+	for i := range table.entries {
+		e := &table.entries[i]
+		state := next[e.symbol]
+		next[e.symbol]++
+		e.bits = uint8(accuracyLog - (bits.Len(uint(state)) - 1))
+		e.newState = uint16(state<<e.bits - size)
+	}
+	return table, nil
+}
+
+func rleFSETable(symbol byte) *fseTable {
+	return &fseTable{entries: []fseEntry{{symbol: symbol}}}
+}
+
+// fseDecodeWeights decodes the FSE compressed weights of a Huffman tree.
+func fseDecodeWeights(src []byte) ([]byte, error) {
+	table, n, err := readFSETable(src, 6, 255)
+	if err != nil {
+		return nil, err
+	}
+	br, err := newBackwardBits(src[n:])
+	if err != nil {
+		return nil, err
+	}
+	states := [2]int{int(br.read(table.accuracyLog)), int(br.read(table.accuracyLog))}
+	var weights []byte
+	for i := 0; ; i = 1 - i {
+		e := table.entries[states[i]]
+		weights = append(weights, e.symbol)
+		states[i] = int(e.newState) + int(br.read(int(e.bits)))
+		if br.overflow() {
+			weights = append(weights, table.entries[states[1-i]].symbol)
+			break
+		}
+		if len(weights) > 255 {
+			return nil, errZstdCorrupt
+		}
+	}
+	return weights, nil
+}
+
+var (
+	llBase = [36]int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15,
+		16, 18, 20, 22, 24, 28, 32, 40, 48, 64, 128, 256, 512, 1024, 2048, 4096,
+		8192, 16384, 32768, 65536}
+	llBits = [36]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 6, 7, 8, 9, 10, 11, 12,
+		13, 14, 15, 16}
+	mlBase = [53]int{3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18,
+		19, 20, 21, 22, 23, 24, 25, 26, 27, 28, 29, 30, 31, 32, 33, 34,
+		35, 37, 39, 41, 43, 47, 51, 59, 67, 83, 99, 131, 259, 515, 1027, 2051,
+		4099, 8195, 16387, 32771, 65539}
+	mlBits = [53]uint8{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		1, 1, 1, 1, 2, 2, 3, 3, 4, 4, 5, 7, 8, 9, 10, 11,
+		12, 13, 14, 15, 16}
+
+	// Predefined distributions of literal lengths, offsets and match lengths.
+	defaultTables [3]*fseTable
+)
+
+// Limits of the sequence tables, in the order of the compression modes.
+var (
+	seqMaxAccuracy = [3]int{9, 8, 9}
+	seqMaxSymbol   = [3]int{35, 31, 52}
+)
+
+func init() {
+	for i, d := range []struct {
+		probabilities []int
+		accuracyLog   int
+	}{
+		{[]int{4, 3, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 3, 2, 1, 1, 1, 1, 1, -1, -1, -1, -1}, 6},
+		{[]int{1, 1, 1, 1, 1, 1, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1}, 5},
+		{[]int{1, 4, 3, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, -1, -1, -1, -1, -1, -1, -1}, 6},
+	} {
+		table, err := buildFSETable(d.probabilities, d.accuracyLog)
+		if err != nil {
+			panic(err)
+		}
+		defaultTables[i] = table
+	}
+}
+
+func (d *zstdDecoder) decodeSequences(src []byte, literals []byte) error {
+	if len(src) < 1 {
+		return errZstdCorrupt
+	}
+	count := int(src[0])
+	n := 1
+	switch {
+	case count == 255:
+		if len(src) < 3 {
+			return errZstdCorrupt
+		}
+		count, n = int(src[1])+int(src[2])<<8+0x7F00, 3
+	case count >= 128:
+		if len(src) < 2 {
+			return errZstdCorrupt
+		}
+		count, n = (count-128)<<8+int(src[1]), 2
+	}
+	src = src[n:]
+	if count == 0 {
+		d.out = append(d.out, literals...)
+		return nil
+	}
+
+	if len(src) < 1 {
+		return errZstdCorrupt
+	}
+	modes := src[0]
+	src = src[1:]
+	// Literal lengths, offsets and match lengths.
+	for i := 0; i < 3; i++ {
+		switch modes >> uint(6-2*i) & 3 {
+		case 0:
+			d.tables[i] = defaultTables[i]
+		case 1:
+			if len(src) < 1 {
+				return errZstdCorrupt
+			}
+			d.tables[i] = rleFSETable(src[0])
+			src = src[1:]
+		case 2:
+			table, n, err := readFSETable(src, seqMaxAccuracy[i], seqMaxSymbol[i])
+			if err != nil {
+				return err
+			}
+			d.tables[i] = table
+			src = src[n:]
+		case 3:
+			if d.tables[i] == nil {
+				return errZstdCorrupt
+			}
+		}
+	}
+
+	br, err := newBackwardBits(src)
+	if err != nil {
+		return err
+	}
+	ll, of, ml := d.tables[0], d.tables[1], d.tables[2]
+	llState := int(br.read(ll.accuracyLog))
+	ofState := int(br.read(of.accuracyLog))
+	mlState := int(br.read(ml.accuracyLog))
+	for i := 0; i < count; i++ {
+		llCode := ll.entries[llState].symbol
+		ofCode := of.entries[ofState].symbol
+		mlCode := ml.entries[mlState].symbol
+		if int(llCode) >= len(llBase) || int(mlCode) >= len(mlBase) || ofCode > 31 {
+			return errZstdCorrupt
+		}
+		offsetValue := 1<<ofCode + int(br.read(int(ofCode)))
+		matchLength := mlBase[mlCode] + int(br.read(int(mlBits[mlCode])))
+		literalLength := llBase[llCode] + int(br.read(int(llBits[llCode])))
+		if i < count-1 {
+			e := ll.entries[llState]
+			llState = int(e.newState) + int(br.read(int(e.bits)))
+			e = ml.entries[mlState]
+			mlState = int(e.newState) + int(br.read(int(e.bits)))
+			e = of.entries[ofState]
+			ofState = int(e.newState) + int(br.read(int(e.bits)))
+		}
+		if br.overflow() {
+			return errZstdCorrupt
+		}
+
+		offset := d.offset(offsetValue, literalLength)
+		if literalLength > len(literals) {
+			return errZstdCorrupt
+		}
+		d.out = append(d.out, literals[:literalLength]...)
+		literals = literals[literalLength:]
+		from := len(d.out) - offset
+		if offset <= 0 || from < d.frameFrom {
+			return errZstdCorrupt
+		}
+		for j := 0; j < matchLength; j++ {
+			d.out = append(d.out, d.out[from+j])
+		}
+	}
+	d.out = append(d.out, literals...)
+	return nil
+}
+
+// offset resolves an offset value, updating the repeated offsets.
+func (d *zstdDecoder) offset(value, literalLength int) int {
+	r := &d.repeats
+	if value > 3 {
+		offset := value - 3
+		r[2], r[1], r[0] = r[1], r[0], offset
+		return offset
+	}
+	index := value - 1
+	if literalLength == 0 {
+		index++
+	}
+	switch index {
+	case 0:
+		return r[0]
+	case 1:
+		r[0], r[1] = r[1], r[0]
+	case 2:
+		r[0], r[1], r[2] = r[2], r[0], r[1]
+	case 3:
+		offset := r[0] - 1
+		if offset == 0 {
+			offset = 1
+		}
+		r[2], r[1], r[0] = r[1], r[0], offset
+	}
+	return r[0]
+}
+
+// xxh64 computes the 64 bits xxHash of b with seed 0.
+func xxh64(b []byte) uint64 {
+	const (
+		prime1 uint64 = 11400714785074694791
+		prime2 uint64 = 14029467366897019727
+		prime3 uint64 = 1609587929392839161
+		prime4 uint64 = 9650029242287828579
+		prime5 uint64 = 2870177450012600261
+	)
+	round := func(acc, lane uint64) uint64 {
+		return bits.RotateLeft64(acc+lane*prime2, 31) * prime1
+	}
+	n := uint64(len(b))
+	var h uint64
+	if len(b) >= 32 {
+		p1, p2 := prime1, prime2
+		v1, v2, v3, v4 := p1+p2, p2, uint64(0), -p1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = round(v1, binary.LittleEndian.Uint64(b))
+			v2 = round(v2, binary.LittleEndian.Uint64(b[8:]))
+			v3 = round(v3, binary.LittleEndian.Uint64(b[16:]))
+			v4 = round(v4, binary.LittleEndian.Uint64(b[24:]))
+		}
+		h = bits.RotateLeft64(v1, 1) + bits.RotateLeft64(v2, 7) + bits.RotateLeft64(v3, 12) + bits.RotateLeft64(v4, 18)
+		for _, v := range []uint64{v1, v2, v3, v4} {
+			h = (h^round(0, v))*prime1 + prime4
+		}
+	} else {
+		h = prime5
+	}
+	h += n
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= round(0, binary.LittleEndian.Uint64(b))
+		h = bits.RotateLeft64(h, 27)*prime1 + prime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(binary.LittleEndian.Uint32(b)) * prime1
+		h = bits.RotateLeft64(h, 23)*prime2 + prime3
+		b = b[4:]
+	}
+	for _, c := range b {
+		h ^= uint64(c) * prime5
+		h = bits.RotateLeft64(h, 11) * prime1
+	}
+	h ^= h >> 33
+	h *= prime2
+	h ^= h >> 29
+	h *= prime3
+	h ^= h >> 32
+	return h
+}
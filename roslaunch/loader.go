@@ -0,0 +1,781 @@
+package roslaunch
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/rosparam"
+	"github.com/fetchrobotics/rosgo/yaml"
+)
+
+// element is an element of a launch file.
+type element struct {
+	name     string
+	attrs    map[string]string
+	children []*element
+	text     string
+	line     int
+}
+
+func parseXML(data []byte) (*element, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*element
+	var root *element
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			e := &element{
+				name:  t.Name.Local,
+				attrs: map[string]string{},
+				line:  1 + bytes.Count(data[:offset], []byte("\n")),
+			}
+			for _, a := range t.Attr {
+				e.attrs[a.Name.Local] = a.Value
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, e)
+			} else if root == nil {
+				root = e
+			}
+			stack = append(stack, e)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no root element")
+	}
+	return root, nil
+}
+
+// file is a launch file being loaded.
+type file struct {
+	filename string
+	// passed are the values of the args given to the file, and used records
+	// the ones it declares.
+	passed map[string]string
+	used   map[string]bool
+}
+
+// scope holds the state inherited by the elements of a launch file.
+type scope struct {
+	file   *file
+	ns     string
+	args   map[string]string
+	unset  map[string]bool
+	remaps []Remap
+	env    []Env
+}
+
+func (s *scope) child(ns string) *scope {
+	c := &scope{
+		file:   s.file,
+		ns:     ns,
+		args:   map[string]string{},
+		unset:  map[string]bool{},
+		remaps: s.remaps[:len(s.remaps):len(s.remaps)],
+		env:    s.env[:len(s.env):len(s.env)],
+	}
+	for k, v := range s.args {
+		c.args[k] = v
+	}
+	for k := range s.unset {
+		c.unset[k] = true
+	}
+	return c
+}
+
+func (s *scope) arg(name string) (string, error) {
+	if value, ok := s.args[name]; ok {
+		return value, nil
+	}
+	if s.unset[name] {
+		return "", fmt.Errorf("arg %s is required but not set", name)
+	}
+	return "", fmt.Errorf("arg %s is not declared", name)
+}
+
+type loader struct {
+	config         *Config
+	packagePath    []string
+	anon           map[string]string
+	defaultMachine string
+}
+
+// loadFile loads a launch file into namespace ns. parent is the scope of the
+// including file, if any.
+func (l *loader) loadFile(filename, ns string, args map[string]string, parent *scope, checkUnused bool) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("roslaunch: %v", err)
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return fmt.Errorf("roslaunch: %s: %v", filename, err)
+	}
+	if root.name != "launch" {
+		return fmt.Errorf("roslaunch: %s: root element must be launch but %s", filename, root.name)
+	}
+	s := &scope{ns: ns}
+	if parent != nil {
+		s = parent.child(ns)
+	}
+	s.file = &file{filename, args, map[string]bool{}}
+	// Args do not cross the boundaries of files.
+	s.args, s.unset = map[string]string{}, map[string]bool{}
+	if err := l.loadElements(s, root.children); err != nil {
+		return err
+	}
+	var unused []string
+	for name := range args {
+		if !s.file.used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	if len(unused) > 0 && checkUnused {
+		return fmt.Errorf("roslaunch: %s: unused args %v", filename, unused)
+	}
+	return nil
+}
+
+func (l *loader) errorf(s *scope, e *element, format string, args ...interface{}) error {
+	return fmt.Errorf("roslaunch: %s:%d: <%s>: %s", s.file.filename, e.line, e.name, fmt.Sprintf(format, args...))
+}
+
+// attr returns the substituted value of an attribute and whether it is set.
+func (l *loader) attr(s *scope, e *element, name string) (string, bool, error) {
+	raw, ok := e.attrs[name]
+	if !ok {
+		return "", false, nil
+	}
+	value, err := l.substitute(s, raw)
+	if err != nil {
+		return "", false, l.errorf(s, e, "%s: %v", name, err)
+	}
+	return value, true, nil
+}
+
+func (l *loader) requiredAttr(s *scope, e *element, name string) (string, error) {
+	value, ok, err := l.attr(s, e, name)
+	if err == nil && !ok {
+		err = l.errorf(s, e, "missing %s attribute", name)
+	}
+	return value, err
+}
+
+func (l *loader) boolAttr(s *scope, e *element, name string, def bool) (bool, error) {
+	value, ok, err := l.attr(s, e, name)
+	if err != nil || !ok {
+		return def, err
+	}
+	b, err := parseBool(value)
+	if err != nil {
+		return false, l.errorf(s, e, "%s: %v", name, err)
+	}
+	return b, nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true", "1":
+		return true, nil
+	case "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", value)
+}
+
+// enabled evaluates the if and unless attributes of an element.
+func (l *loader) enabled(s *scope, e *element) (bool, error) {
+	_, hasIf := e.attrs["if"]
+	_, hasUnless := e.attrs["unless"]
+	if hasIf && hasUnless {
+		return false, l.errorf(s, e, "if and unless are exclusive")
+	}
+	if hasIf {
+		return l.boolAttr(s, e, "if", true)
+	}
+	unless, err := l.boolAttr(s, e, "unless", false)
+	return !unless, err
+}
+
+// resolveNamespace resolves the ns attribute of an element.
+func (l *loader) resolveNamespace(s *scope, e *element) (string, error) {
+	ns, ok, err := l.attr(s, e, "ns")
+	if err != nil || !ok || ns == "" {
+		return s.ns, err
+	}
+	if strings.HasPrefix(ns, "~") {
+		return "", l.errorf(s, e, "ns cannot be private")
+	}
+	if strings.HasPrefix(ns, "/") {
+		return path.Clean(ns), nil
+	}
+	return path.Clean(joinName(s.ns, ns)), nil
+}
+
+func (l *loader) loadElements(s *scope, elements []*element) error {
+	for _, e := range elements {
+		ok, err := l.enabled(s, e)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		switch e.name {
+		case "arg":
+			err = l.loadArg(s, e)
+		case "group":
+			err = l.loadGroup(s, e)
+		case "include":
+			err = l.loadInclude(s, e)
+		case "node":
+			err = l.loadNode(s, e)
+		case "param":
+			err = l.loadParam(s, e, s.ns, nil)
+		case "rosparam":
+			err = l.loadRosparam(s, e, s.ns, nil)
+		case "remap":
+			var r Remap
+			if r, err = l.loadRemap(s, e); err == nil {
+				s.remaps = append(s.remaps, r)
+			}
+		case "env":
+			var env Env
+			if env, err = l.loadEnv(s, e); err == nil {
+				s.env = append(s.env, env)
+			}
+		case "machine":
+			err = l.loadMachine(s, e)
+		case "test":
+			// Tests are run by rostest.
+		default:
+			err = l.errorf(s, e, "unknown tag")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *loader) loadArg(s *scope, e *element) error {
+	name, err := l.requiredAttr(s, e, "name")
+	if err != nil {
+		return err
+	}
+	if _, ok := s.args[name]; ok || s.unset[name] {
+		return l.errorf(s, e, "arg %s is declared twice", name)
+	}
+	value, hasValue, err := l.attr(s, e, "value")
+	if err != nil {
+		return err
+	}
+	def, hasDefault, err := l.attr(s, e, "default")
+	if err != nil {
+		return err
+	}
+	passed, isPassed := s.file.passed[name]
+	s.file.used[name] = true
+	switch {
+	case hasValue && hasDefault:
+		return l.errorf(s, e, "value and default are exclusive")
+	case hasValue && isPassed:
+		return l.errorf(s, e, "cannot override arg %s which has a value", name)
+	case hasValue:
+		s.args[name] = value
+	case isPassed:
+		s.args[name] = passed
+	case hasDefault:
+		s.args[name] = def
+	default:
+		s.unset[name] = true
+	}
+	return nil
+}
+
+func (l *loader) loadGroup(s *scope, e *element) error {
+	ns, err := l.resolveNamespace(s, e)
+	if err != nil {
+		return err
+	}
+	clear, err := l.boolAttr(s, e, "clear_params", false)
+	if err != nil {
+		return err
+	}
+	if clear {
+		if ns == "/" {
+			return l.errorf(s, e, "clear_params requires a namespace")
+		}
+		l.config.ClearParams = append(l.config.ClearParams, ns)
+	}
+	return l.loadElements(s.child(ns), e.children)
+}
+
+func (l *loader) loadInclude(s *scope, e *element) error {
+	filename, err := l.requiredAttr(s, e, "file")
+	if err != nil {
+		return err
+	}
+	ns, err := l.resolveNamespace(s, e)
+	if err != nil {
+		return err
+	}
+	clear, err := l.boolAttr(s, e, "clear_params", false)
+	if err != nil {
+		return err
+	}
+	if clear {
+		if ns == "/" {
+			return l.errorf(s, e, "clear_params requires a namespace")
+		}
+		l.config.ClearParams = append(l.config.ClearParams, ns)
+	}
+	passAll, err := l.boolAttr(s, e, "pass_all_args", false)
+	if err != nil {
+		return err
+	}
+	args := map[string]string{}
+	if passAll {
+		for k, v := range s.args {
+			args[k] = v
+		}
+	}
+	child := s.child(ns)
+	for _, c := range e.children {
+		ok, err := l.enabled(s, c)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		switch c.name {
+		case "arg":
+			name, err := l.requiredAttr(s, c, "name")
+			if err != nil {
+				return err
+			}
+			if args[name], err = l.requiredAttr(s, c, "value"); err != nil {
+				return err
+			}
+		case "env":
+			env, err := l.loadEnv(s, c)
+			if err != nil {
+				return err
+			}
+			child.env = append(child.env, env)
+		default:
+			return l.errorf(s, c, "unknown tag in include")
+		}
+	}
+	// Args passed by pass_all_args may be left unused.
+	return l.loadFile(filename, ns, args, child, !passAll)
+}
+
+func (l *loader) loadRemap(s *scope, e *element) (Remap, error) {
+	from, err := l.requiredAttr(s, e, "from")
+	if err != nil {
+		return Remap{}, err
+	}
+	to, err := l.requiredAttr(s, e, "to")
+	return Remap{from, to}, err
+}
+
+func (l *loader) loadEnv(s *scope, e *element) (Env, error) {
+	name, err := l.requiredAttr(s, e, "name")
+	if err != nil {
+		return Env{}, err
+	}
+	value, err := l.requiredAttr(s, e, "value")
+	return Env{name, value}, err
+}
+
+func (l *loader) loadMachine(s *scope, e *element) error {
+	m := &Machine{}
+	var err error
+	if m.Name, err = l.requiredAttr(s, e, "name"); err != nil {
+		return err
+	}
+	if m.Address, err = l.requiredAttr(s, e, "address"); err != nil {
+		return err
+	}
+	if m.EnvLoader, _, err = l.attr(s, e, "env-loader"); err != nil {
+		return err
+	}
+	if m.User, _, err = l.attr(s, e, "user"); err != nil {
+		return err
+	}
+	def, _, err := l.attr(s, e, "default")
+	if err != nil {
+		return err
+	}
+	if strings.ToLower(def) == "true" {
+		l.defaultMachine = m.Name
+	}
+	l.config.Machines[m.Name] = m
+	return nil
+}
+
+func (l *loader) loadNode(s *scope, e *element) error {
+	n := &Node{Output: "log"}
+	var err error
+	if n.Package, err = l.requiredAttr(s, e, "pkg"); err != nil {
+		return err
+	}
+	if n.Type, err = l.requiredAttr(s, e, "type"); err != nil {
+		return err
+	}
+	name, err := l.requiredAttr(s, e, "name")
+	if err != nil {
+		return err
+	}
+	if name == "" || strings.ContainsAny(name, "/~") {
+		return l.errorf(s, e, "invalid node name %q", name)
+	}
+	ns, err := l.resolveNamespace(s, e)
+	if err != nil {
+		return err
+	}
+	n.Name = joinName(ns, name)
+	if l.config.Node(n.Name) != nil {
+		return l.errorf(s, e, "duplicate node name %s", n.Name)
+	}
+	args, _, err := l.attr(s, e, "args")
+	if err != nil {
+		return err
+	}
+	if n.Args, err = splitArgs(args); err != nil {
+		return l.errorf(s, e, "args: %v", err)
+	}
+	prefix, _, err := l.attr(s, e, "launch-prefix")
+	if err != nil {
+		return err
+	}
+	if n.LaunchPrefix, err = splitArgs(prefix); err != nil {
+		return l.errorf(s, e, "launch-prefix: %v", err)
+	}
+	var ok bool
+	if n.Machine, ok, err = l.attr(s, e, "machine"); err != nil {
+		return err
+	} else if !ok {
+		n.Machine = l.defaultMachine
+	}
+	if n.Machine != "" && l.config.Machines[n.Machine] == nil {
+		return l.errorf(s, e, "unknown machine %s", n.Machine)
+	}
+	if n.Respawn, err = l.boolAttr(s, e, "respawn", false); err != nil {
+		return err
+	}
+	if n.Required, err = l.boolAttr(s, e, "required", false); err != nil {
+		return err
+	}
+	if n.Respawn && n.Required {
+		return l.errorf(s, e, "respawn and required are exclusive")
+	}
+	if delay, ok, err := l.attr(s, e, "respawn_delay"); err != nil {
+		return err
+	} else if ok {
+		seconds, err := strconv.ParseFloat(delay, 64)
+		if err != nil {
+			return l.errorf(s, e, "respawn_delay: %v", err)
+		}
+		n.RespawnDelay = time.Duration(seconds * float64(time.Second))
+	}
+	if output, ok, err := l.attr(s, e, "output"); err != nil {
+		return err
+	} else if ok {
+		if output != "log" && output != "screen" {
+			return l.errorf(s, e, "output must be log or screen but %s", output)
+		}
+		n.Output = output
+	}
+	if n.Cwd, _, err = l.attr(s, e, "cwd"); err != nil {
+		return err
+	}
+	clear, err := l.boolAttr(s, e, "clear_params", false)
+	if err != nil {
+		return err
+	}
+	if clear {
+		l.config.ClearParams = append(l.config.ClearParams, n.Name)
+	}
+
+	n.Remaps = append([]Remap{}, s.remaps...)
+	n.Env = append([]Env{}, s.env...)
+	for _, c := range e.children {
+		ok, err := l.enabled(s, c)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		switch c.name {
+		case "param":
+			err = l.loadParam(s, c, ns, n)
+		case "rosparam":
+			err = l.loadRosparam(s, c, ns, n)
+		case "remap":
+			var r Remap
+			if r, err = l.loadRemap(s, c); err == nil {
+				n.Remaps = append(n.Remaps, r)
+			}
+		case "env":
+			var env Env
+			if env, err = l.loadEnv(s, c); err == nil {
+				n.Env = append(n.Env, env)
+			}
+		default:
+			err = l.errorf(s, c, "unknown tag in node")
+		}
+		if err != nil {
+			return err
+		}
+	}
+	l.config.Nodes = append(l.config.Nodes, n)
+	return nil
+}
+
+// resolveParam resolves a parameter name in namespace ns. Relative and
+// private names in a node are private to the node.
+func (l *loader) resolveParam(s *scope, e *element, ns string, n *Node, name string) (string, error) {
+	switch {
+	case strings.HasPrefix(name, "/"):
+		return path.Clean(name), nil
+	case n != nil:
+		return path.Clean(joinName(n.Name, strings.TrimPrefix(name, "~"))), nil
+	case strings.HasPrefix(name, "~"):
+		return "", l.errorf(s, e, "private name %s outside of a node", name)
+	}
+	return path.Clean(joinName(ns, name)), nil
+}
+
+func (l *loader) loadParam(s *scope, e *element, ns string, n *Node) error {
+	name, err := l.requiredAttr(s, e, "name")
+	if err != nil {
+		return err
+	}
+	if name, err = l.resolveParam(s, e, ns, n, name); err != nil {
+		return err
+	}
+	typ, _, err := l.attr(s, e, "type")
+	if err != nil {
+		return err
+	}
+	var sources []string
+	for _, source := range []string{"value", "textfile", "binfile", "command"} {
+		if _, ok := e.attrs[source]; ok {
+			sources = append(sources, source)
+		}
+	}
+	if len(sources) != 1 {
+		return l.errorf(s, e, "exactly one of value, textfile, binfile and command is required")
+	}
+	text, err := l.requiredAttr(s, e, sources[0])
+	if err != nil {
+		return err
+	}
+	switch sources[0] {
+	case "textfile", "binfile":
+		data, err := ioutil.ReadFile(text)
+		if err != nil {
+			return l.errorf(s, e, "%v", err)
+		}
+		if sources[0] == "binfile" {
+			l.config.setParam(name, data)
+			return nil
+		}
+		text = string(data)
+	case "command":
+		fields, err := splitArgs(text)
+		if err != nil || len(fields) == 0 {
+			return l.errorf(s, e, "invalid command %q", text)
+		}
+		out, err := exec.Command(fields[0], fields[1:]...).Output()
+		if err != nil {
+			return l.errorf(s, e, "command %q: %v", text, err)
+		}
+		text = string(out)
+	}
+	if typ == "" && sources[0] != "value" {
+		typ = "str"
+	}
+	value, err := convertValue(text, typ)
+	if err != nil {
+		return l.errorf(s, e, "%v", err)
+	}
+	l.config.setParam(name, value)
+	return nil
+}
+
+// convertValue converts the text of a param tag to a value of type typ.
+func convertValue(text, typ string) (interface{}, error) {
+	switch typ {
+	case "str", "string":
+		return text, nil
+	case "int":
+		return strconv.Atoi(strings.TrimSpace(text))
+	case "double", "float":
+		return strconv.ParseFloat(strings.TrimSpace(text), 64)
+	case "bool", "boolean":
+		return parseBool(text)
+	case "yaml":
+		return yaml.Unmarshal([]byte(text))
+	case "", "auto":
+		trimmed := strings.TrimSpace(text)
+		switch strings.ToLower(trimmed) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+		if i, err := strconv.Atoi(trimmed); err == nil {
+			return i, nil
+		}
+		if f, err := strconv.ParseFloat(trimmed, 64); err == nil {
+			return f, nil
+		}
+		return text, nil
+	}
+	return nil, fmt.Errorf("unknown type %s", typ)
+}
+
+func (l *loader) loadRosparam(s *scope, e *element, ns string, n *Node) error {
+	command, ok, err := l.attr(s, e, "command")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		command = "load"
+	}
+	target := ns
+	if n != nil {
+		target = n.Name
+	}
+	if value, ok, err := l.attr(s, e, "ns"); err != nil {
+		return err
+	} else if ok && value != "" {
+		if target, err = l.resolveParam(s, e, ns, n, value); err != nil {
+			return err
+		}
+	}
+	if param, ok, err := l.attr(s, e, "param"); err != nil {
+		return err
+	} else if ok && param != "" {
+		if strings.HasPrefix(param, "/") {
+			target = path.Clean(param)
+		} else {
+			target = path.Clean(joinName(target, strings.TrimPrefix(param, "~")))
+		}
+	}
+
+	switch command {
+	case "delete":
+		l.config.DeleteParams = append(l.config.DeleteParams, target)
+		return nil
+	case "dump":
+		return l.errorf(s, e, "rosparam dump is not supported")
+	case "load":
+	default:
+		return l.errorf(s, e, "unknown command %s", command)
+	}
+	text := e.text
+	if filename, ok, err := l.attr(s, e, "file"); err != nil {
+		return err
+	} else if ok {
+		data, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return l.errorf(s, e, "%v", err)
+		}
+		text = string(data)
+	}
+	if subst, err := l.boolAttr(s, e, "subst_value", false); err != nil {
+		return err
+	} else if subst {
+		if text, err = l.substitute(s, text); err != nil {
+			return l.errorf(s, e, "%v", err)
+		}
+	}
+	value, err := rosparam.Unmarshal([]byte(text))
+	if err != nil {
+		return l.errorf(s, e, "%v", err)
+	}
+	if value == nil {
+		return nil
+	}
+	if _, ok := value.(map[string]interface{}); !ok && e.attrs["param"] == "" {
+		return l.errorf(s, e, "a value which is not a dictionary requires a param attribute")
+	}
+	l.config.setParam(target, value)
+	return nil
+}
+
+// splitArgs splits a command line the way a shell does, honoring quotes and
+// backslashes.
+func splitArgs(text string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range text {
+		switch {
+		case escaped:
+			current.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, fmt.Errorf("unterminated quote in %q", text)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
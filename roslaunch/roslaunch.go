@@ -0,0 +1,215 @@
+// Package roslaunch reads roslaunch XML files and runs the nodes they
+// describe.
+//
+// Load evaluates a launch file, its includes and its substitution args into
+// a Config listing the parameters to set and the nodes to start:
+//
+//	config, err := roslaunch.Load("robot.launch", map[string]string{"sim": "true"})
+//
+// The node, param, rosparam, remap, include, group, arg, env and machine
+// tags are supported, as well as the if and unless attributes and the
+// $(find), $(arg), $(env), $(optenv), $(anon), $(dirname) and $(eval)
+// substitutions. $(eval) accepts the arithmetic, comparison and boolean
+// expressions of Python along with its literals and the arg, env, optenv,
+// find, anon and dirname functions.
+//
+// A Runner sets the parameters through the master API and starts the nodes
+// as local processes. Nodes assigned to remote machines are not supported.
+package roslaunch
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Remap maps the name From to the name To.
+type Remap struct {
+	From string
+	To   string
+}
+
+// Env is an environment variable set for a node.
+type Env struct {
+	Name  string
+	Value string
+}
+
+// Machine is a machine declared by a machine tag.
+type Machine struct {
+	Name      string
+	Address   string
+	EnvLoader string
+	User      string
+}
+
+// Node is a node to start.
+type Node struct {
+	// Package and Type locate the executable of the node.
+	Package string
+	Type    string
+	// Name is the fully qualified name of the node, e.g. "/robot/driver".
+	Name string
+	// Args are the arguments given by the args attribute.
+	Args         []string
+	Remaps       []Remap
+	Env          []Env
+	Machine      string
+	Respawn      bool
+	RespawnDelay time.Duration
+	Required     bool
+	// Output is "screen" or "log".
+	Output       string
+	Cwd          string
+	LaunchPrefix []string
+}
+
+// Namespace returns the namespace of the node, e.g. "/robot".
+func (n *Node) Namespace() string {
+	ns := n.Name[:strings.LastIndex(n.Name, "/")]
+	if ns == "" {
+		return "/"
+	}
+	return ns
+}
+
+// BaseName returns the name of the node without its namespace.
+func (n *Node) BaseName() string {
+	return n.Name[strings.LastIndex(n.Name, "/")+1:]
+}
+
+// Config is the result of loading a launch file.
+type Config struct {
+	// Params maps fully qualified parameter names to their values.
+	// Dictionaries are flattened down to their leaves.
+	Params map[string]interface{}
+	// ClearParams are the namespaces to clear before setting Params.
+	ClearParams []string
+	// DeleteParams are the parameters deleted by rosparam tags.
+	DeleteParams []string
+	Nodes        []*Node
+	Machines     map[string]*Machine
+}
+
+func newConfig() *Config {
+	return &Config{Params: map[string]interface{}{}, Machines: map[string]*Machine{}}
+}
+
+// ParamNames returns the sorted names of the parameters.
+func (c *Config) ParamNames() []string {
+	names := make([]string, 0, len(c.Params))
+	for name := range c.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setParam sets the parameter name, replacing the parameters it contains or
+// belongs to.
+func (c *Config) setParam(name string, value interface{}) {
+	if d, ok := value.(map[string]interface{}); ok && len(d) > 0 {
+		for k, v := range d {
+			c.setParam(joinName(name, k), v)
+		}
+		return
+	}
+	for k := range c.Params {
+		if strings.HasPrefix(k, name+"/") || strings.HasPrefix(name, k+"/") {
+			delete(c.Params, k)
+		}
+	}
+	c.Params[name] = value
+}
+
+// Node returns the node named name, or nil.
+func (c *Config) Node(name string) *Node {
+	for _, n := range c.Nodes {
+		if n.Name == name {
+			return n
+		}
+	}
+	return nil
+}
+
+// LoadOption configures the loading of launch files.
+type LoadOption func(l *loader)
+
+// LoadPackagePath sets the directories searched by $(find), ROS_PACKAGE_PATH
+// by default.
+func LoadPackagePath(paths ...string) LoadOption {
+	return func(l *loader) {
+		l.packagePath = paths
+	}
+}
+
+// Load loads the launch file filename with the values of its args.
+func Load(filename string, args map[string]string, options ...LoadOption) (*Config, error) {
+	l := &loader{config: newConfig(), packagePath: envPackagePath(), anon: map[string]string{}}
+	for _, opt := range options {
+		opt(l)
+	}
+	if err := l.loadFile(filename, "/", args, nil, true); err != nil {
+		return nil, err
+	}
+	return l.config, nil
+}
+
+// envPackagePath returns the directories of ROS_PACKAGE_PATH.
+func envPackagePath() []string {
+	var paths []string
+	for _, p := range filepath.SplitList(os.Getenv("ROS_PACKAGE_PATH")) {
+		if len(p) > 0 {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+const maxPackageDepth = 5
+
+// FindPackage returns the directory of the package named name under paths.
+func FindPackage(paths []string, name string) (string, error) {
+	for _, p := range paths {
+		if dir := findPackage(p, name, 0); dir != "" {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("roslaunch: package %s not found", name)
+}
+
+func findPackage(dir, name string, depth int) string {
+	if _, err := os.Stat(filepath.Join(dir, "package.xml")); err == nil {
+		if filepath.Base(dir) == name {
+			return dir
+		}
+		return ""
+	}
+	if depth >= maxPackageDepth {
+		return ""
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			if found := findPackage(filepath.Join(dir, e.Name()), name, depth+1); found != "" {
+				return found
+			}
+		}
+	}
+	return ""
+}
+
+// joinName joins a namespace and a relative name.
+func joinName(ns, name string) string {
+	if strings.HasSuffix(ns, "/") {
+		return ns + name
+	}
+	return ns + "/" + name
+}
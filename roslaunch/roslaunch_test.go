@@ -0,0 +1,426 @@
+package roslaunch
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/rosapi"
+)
+
+// writeFiles creates files under dir from a map of relative paths to
+// contents. Paths ending with .sh are made executable.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		mode := os.FileMode(0644)
+		if strings.HasSuffix(name, ".sh") {
+			mode = 0755
+		}
+		if err := ioutil.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+const mainLaunch = `<launch>
+  <arg name="robot" default="r2"/>
+  <arg name="sim"/>
+  <arg name="rate" value="$(eval 5 * 2)"/>
+  <param name="use_sim_time" value="$(arg sim)"/>
+  <param name="robot_name" value="$(arg robot)" type="str"/>
+  <rosparam>
+    limits: {speed: 1.5, turn: 2, angle: !degrees 180}
+  </rosparam>
+  <env name="LEVEL" value="debug"/>
+  <remap from="cmd_vel" to="/base/cmd_vel"/>
+  <group ns="$(arg robot)" if="$(arg sim)">
+    <remap from="scan" to="base_scan"/>
+    <node pkg="demo" type="driver" name="driver" args="--rate $(arg rate) 'a b'" respawn="true" respawn_delay="0.5" output="screen">
+      <param name="port" value="/dev/ttyUSB0"/>
+      <param name="~baud" value="115200"/>
+      <param name="/global" value="3.5"/>
+      <rosparam param="gains">[1, 2, 3]</rosparam>
+      <remap from="odom" to="odometry"/>
+      <env name="DRIVER" value="1"/>
+    </node>
+    <include file="$(find demo)/launch/sensor.launch" ns="sensors">
+      <arg name="frame" value="$(arg robot)_laser"/>
+    </include>
+  </group>
+  <group unless="$(arg sim)">
+    <node pkg="demo" type="driver" name="hardware"/>
+  </group>
+</launch>
+`
+
+const sensorLaunch = `<launch>
+  <machine name="local" address="localhost"/>
+  <arg name="frame"/>
+  <arg name="enabled" default="$(eval 'true' if frame != '' else 'false')"/>
+  <node pkg="demo" type="laser" name="laser" required="true" clear_params="true" machine="local" if="$(arg enabled)">
+    <param name="frame_id" value="$(arg frame)"/>
+    <param name="config" textfile="$(dirname)/sensor.yaml" type="yaml"/>
+  </node>
+</launch>
+`
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roslaunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"src/demo/package.xml":          "<package/>",
+		"src/demo/launch/main.launch":   mainLaunch,
+		"src/demo/launch/sensor.launch": sensorLaunch,
+		"src/demo/launch/sensor.yaml":   "range: 30\n",
+	})
+	filename := filepath.Join(dir, "src/demo/launch/main.launch")
+	config, err := Load(filename, map[string]string{"sim": "true"}, LoadPackagePath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantParams := map[string]interface{}{
+		"/use_sim_time":                  true,
+		"/robot_name":                    "r2",
+		"/limits/speed":                  1.5,
+		"/limits/turn":                   2,
+		"/limits/angle":                  math.Pi,
+		"/r2/driver/port":                "/dev/ttyUSB0",
+		"/r2/driver/baud":                115200,
+		"/global":                        3.5,
+		"/r2/driver/gains":               []interface{}{1, 2, 3},
+		"/r2/sensors/laser/frame_id":     "r2_laser",
+		"/r2/sensors/laser/config/range": 30,
+	}
+	if !reflect.DeepEqual(config.Params, wantParams) {
+		t.Errorf("expected the parameters\n%v\nbut\n%v", wantParams, config.Params)
+	}
+	if want := []string{"/r2/sensors/laser"}; !reflect.DeepEqual(config.ClearParams, want) {
+		t.Errorf("expected the cleared namespaces %v but %v", want, config.ClearParams)
+	}
+
+	wantNodes := []*Node{
+		{
+			Package: "demo", Type: "driver", Name: "/r2/driver",
+			Args:         []string{"--rate", "10", "a b"},
+			Remaps:       []Remap{{"cmd_vel", "/base/cmd_vel"}, {"scan", "base_scan"}, {"odom", "odometry"}},
+			Env:          []Env{{"LEVEL", "debug"}, {"DRIVER", "1"}},
+			Respawn:      true,
+			RespawnDelay: 500 * time.Millisecond,
+			Output:       "screen",
+		},
+		{
+			Package: "demo", Type: "laser", Name: "/r2/sensors/laser",
+			Remaps:   []Remap{{"cmd_vel", "/base/cmd_vel"}, {"scan", "base_scan"}},
+			Env:      []Env{{"LEVEL", "debug"}},
+			Machine:  "local",
+			Required: true,
+			Output:   "log",
+		},
+	}
+	if !reflect.DeepEqual(config.Nodes, wantNodes) {
+		for i, n := range config.Nodes {
+			t.Logf("node %d: %+v", i, n)
+		}
+		t.Error("unexpected nodes")
+	}
+	if n := config.Node("/r2/sensors/laser"); n == nil || n.Namespace() != "/r2/sensors" || n.BaseName() != "laser" {
+		t.Errorf("unexpected node %+v", n)
+	}
+
+	config, err = Load(filename, map[string]string{"sim": "false", "robot": "c3"}, LoadPackagePath(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Nodes) != 1 || config.Nodes[0].Name != "/hardware" {
+		t.Errorf("expected only the hardware node but %v", config.Nodes)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "roslaunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, tc := range []struct {
+		launch string
+		args   map[string]string
+		err    string
+	}{
+		{`<launch><arg name="a"/><param name="p" value="$(arg a)"/></launch>`, nil, "arg a is required but not set"},
+		{`<launch><param name="p" value="$(arg a)"/></launch>`, nil, "arg a is not declared"},
+		{`<launch/>`, map[string]string{"a": "1"}, "unused args [a]"},
+		{`<launch><arg name="a" value="1"/></launch>`, map[string]string{"a": "2"}, "cannot override arg a"},
+		{`<launch><arg name="a"/><arg name="a"/></launch>`, nil, "declared twice"},
+		{`<launch><node pkg="p" type="t"/></launch>`, nil, "missing name attribute"},
+		{`<launch><node pkg="p" type="t" name="n"/><node pkg="p" type="t" name="n"/></launch>`, nil, "duplicate node name /n"},
+		{`<launch><node pkg="p" type="t" name="n" respawn="true" required="true"/></launch>`, nil, "exclusive"},
+		{`<launch><node pkg="p" type="t" name="n" machine="m"/></launch>`, nil, "unknown machine m"},
+		{`<launch><param name="~p" value="1"/></launch>`, nil, "private name ~p outside of a node"},
+		{`<launch><param name="p"/></launch>`, nil, "exactly one of"},
+		{`<launch><param name="p" value="x" type="int"/></launch>`, nil, "invalid syntax"},
+		{`<launch><rosparam>5</rosparam></launch>`, nil, "requires a param attribute"},
+		{`<launch><param name="p" value="$(env ROSLAUNCH_TEST_UNSET)"/></launch>`, nil, "ROSLAUNCH_TEST_UNSET is not set"},
+		{`<launch><param name="p" value="$(find missing_pkg)"/></launch>`, nil, "package missing_pkg not found"},
+		{`<launch><group if="maybe"/></launch>`, nil, "invalid boolean"},
+		{`<launch><foo/></launch>`, nil, "unknown tag"},
+		{`<node/>`, nil, "root element must be launch"},
+	} {
+		filename := filepath.Join(dir, fmt.Sprintf("%d.launch", i))
+		writeFiles(t, dir, map[string]string{filepath.Base(filename): tc.launch})
+		_, err := Load(filename, tc.args, LoadPackagePath(dir))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expected an error containing %q but %v", tc.launch, tc.err, err)
+		}
+	}
+}
+
+func TestSubstitute(t *testing.T) {
+	os.Setenv("ROSLAUNCH_TEST_VAR", "value")
+	defer os.Unsetenv("ROSLAUNCH_TEST_VAR")
+	l := &loader{anon: map[string]string{}}
+	s := &scope{
+		file: &file{filename: "/tmp/test.launch"},
+		args: map[string]string{"a": "3", "name": "robot", "flag": "true"},
+	}
+	for _, tc := range []struct {
+		text, want string
+	}{
+		{"plain", "plain"},
+		{"$(arg name)_$(arg a)", "robot_3"},
+		{"$(env ROSLAUNCH_TEST_VAR)", "value"},
+		{"$(optenv ROSLAUNCH_TEST_UNSET default value)", "default value"},
+		{"$(optenv ROSLAUNCH_TEST_VAR other)", "value"},
+		{"$(dirname)/file", "/tmp/file"},
+		{"$(eval 1 + 2 * 3)", "7"},
+		{"$(eval 7 / 2)", "3.5"},
+		{"$(eval 7 // 2 + 7 % 2)", "4"},
+		{"$(eval -2 ** 2)", "-4"},
+		{"$(eval 2.0 * 2)", "4.0"},
+		{"$(eval int_value if False else 'x')", "x"},
+		{"$(eval a == '3')", "True"},
+		{"$(eval arg('name') + '_' + a)", "robot_3"},
+		{"$(eval flag == 'true' and not a == '2')", "True"},
+		{"$(eval 1 < 2 < 3)", "True"},
+		{"$(eval 3 > 2 > 2)", "False"},
+		{"$(eval '' or 'default')", "default"},
+		{"$(eval (1 + 2) * 3)", "9"},
+		{`$(eval "it's" * 2)`, "it'sit's"},
+		{"$(eval optenv('ROSLAUNCH_TEST_UNSET', 'x'))", "x"},
+		{"$(eval None)", "None"},
+	} {
+		got, err := l.substitute(s, tc.text)
+		if err != nil {
+			t.Errorf("%s: %v", tc.text, err)
+		} else if got != tc.want {
+			t.Errorf("%s: expected %q but %q", tc.text, tc.want, got)
+		}
+	}
+	anon1, _ := l.substitute(s, "$(anon node)")
+	anon2, _ := l.substitute(s, "$(anon node)")
+	if !strings.HasPrefix(anon1, "node_") || anon1 != anon2 {
+		t.Errorf("expected the same anonymous name but %s and %s", anon1, anon2)
+	}
+	for _, text := range []string{"$(arg", "$(unknown x)", "$(eval 1 +)", "$(eval 'a' - 1)", "$(eval 1 / 0)", "x $(eval 1)"} {
+		if _, err := l.substitute(s, text); err == nil {
+			t.Errorf("%s: expected an error", text)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"  a  b ", []string{"a", "b"}},
+		{`'a b' "c \"d\"" e\ f`, []string{"a b", `c "d"`, "e f"}},
+		{`''`, []string{""}},
+	} {
+		got, err := splitArgs(tc.text)
+		if err != nil || !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: expected %q but %q, %v", tc.text, tc.want, got, err)
+		}
+	}
+	if _, err := splitArgs(`"a`); err == nil {
+		t.Error("expected an error for an unterminated quote")
+	}
+}
+
+const recordScript = `#!/bin/sh
+echo "$@" >> "$OUT_DIR/$NODE.args"
+echo "$ROS_NAMESPACE $ROS_MASTER_URI" > "$OUT_DIR/$NODE.env"
+`
+
+func TestRunner(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	dir, err := ioutil.TempDir("", "roslaunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"demo/package.xml":        "<package/>",
+		"demo/scripts/spin.sh":    recordScript + "exec sleep 30\n",
+		"demo/scripts/once.sh":    recordScript,
+		"demo/scripts/respawn.sh": recordScript + "sleep 0.1\n",
+		"launch/robot.launch": `<launch>
+  <env name="OUT_DIR" value="` + dir + `"/>
+  <param name="rate" value="10"/>
+  <group ns="robot">
+    <node pkg="demo" type="spin.sh" name="driver" args="--verbose" output="screen">
+      <env name="NODE" value="driver"/>
+      <remap from="scan" to="base_scan"/>
+      <param name="port" value="/dev/ttyUSB0"/>
+    </node>
+    <node pkg="demo" type="respawn.sh" name="monitor" respawn="true" respawn_delay="0.1">
+      <env name="NODE" value="monitor"/>
+    </node>
+  </group>
+  <node pkg="demo" type="once.sh" name="once">
+    <env name="NODE" value="once"/>
+  </node>
+</launch>`,
+	})
+	config, err := Load(filepath.Join(dir, "launch/robot.launch"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	runner := NewRunner(config,
+		RunnerMasterURI(m.URI()),
+		RunnerPackagePath(dir),
+		RunnerOutput(&out, &out),
+		RunnerLogDir(filepath.Join(dir, "log")))
+	if err := runner.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	client := rosapi.NewMasterClient(m.URI(), "/test")
+	for name, want := range map[string]interface{}{"/rate": int32(10), "/robot/driver/port": "/dev/ttyUSB0"} {
+		if value, err := client.GetParam(name); err != nil || value != want {
+			t.Errorf("expected %s to be %v but %v, %v", name, want, value, err)
+		}
+	}
+
+	readFile := func(name string) string {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, name))
+		return string(data)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(readFile("monitor.args"), "\n") < 2 || readFile("driver.env") == "" || readFile("once.env") == "" {
+		if time.Now().After(deadline) {
+			t.Fatalf("the nodes did not run as expected:\n%s", out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := readFile("driver.args"), "--verbose scan:=base_scan __name:=driver __ns:=/robot\n"; got != want {
+		t.Errorf("expected the arguments %q but %q", want, got)
+	}
+	if got, want := readFile("driver.env"), "/robot "+m.URI()+"\n"; got != want {
+		t.Errorf("expected the environment %q but %q", want, got)
+	}
+	if got, want := readFile("once.args"), "__name:=once __ns:=/\n"; got != want {
+		t.Errorf("expected the arguments %q but %q", want, got)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		runner.Shutdown()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the nodes did not stop")
+	}
+	if err := runner.Wait(); err != nil {
+		t.Error(err)
+	}
+	for _, line := range []string{"process[/robot/driver]: started with pid", "[/once] process has finished cleanly", "[/robot/monitor] restarting process"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected the output to contain %q but\n%s", line, out.String())
+		}
+	}
+}
+
+func TestRunnerRequired(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	dir, err := ioutil.TempDir("", "roslaunch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeFiles(t, dir, map[string]string{
+		"demo/package.xml": "<package/>",
+		"demo/spin.sh":     "#!/bin/sh\nexec sleep 30\n",
+		"demo/fail.sh":     "#!/bin/sh\nsleep 0.2\nexit 3\n",
+		"launch/robot.launch": `<launch>
+  <node pkg="demo" type="spin.sh" name="spin"/>
+  <node pkg="demo" type="fail.sh" name="fail" required="true"/>
+  <node pkg="demo" type="fail.sh" name="remote" machine="remote"/>
+</launch>`,
+	})
+	filename := filepath.Join(dir, "launch/robot.launch")
+	if _, err := Load(filename, nil); err == nil {
+		t.Error("expected an error for an undeclared machine")
+	}
+	launch, _ := ioutil.ReadFile(filename)
+	writeFiles(t, dir, map[string]string{"launch/robot.launch": strings.Replace(string(launch), "<launch>", `<launch><machine name="remote" address="192.0.2.1"/>`, 1)})
+	config, err := Load(filename, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	options := []RunnerOption{RunnerMasterURI(m.URI()), RunnerPackagePath(dir), RunnerOutput(&out, &out), RunnerLogDir(filepath.Join(dir, "log"))}
+	if err := NewRunner(config, options...).Start(); err == nil || !strings.Contains(err.Error(), "remote machine") {
+		t.Errorf("expected an error for a remote machine but %v", err)
+	}
+
+	config.Nodes = config.Nodes[:2]
+	runner := NewRunner(config, options...)
+	if err := runner.Start(); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- runner.Wait()
+	}()
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "required node /fail exited") {
+			t.Errorf("expected an error for the required node but %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		runner.Shutdown()
+		t.Fatal("the nodes were not stopped after the required node exited")
+	}
+	if err := NewRunner(&Config{Nodes: []*Node{{Package: "demo", Type: "missing", Name: "/missing"}}}, options...).Start(); err == nil {
+		t.Error("expected an error for a missing executable")
+	}
+}
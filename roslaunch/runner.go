@@ -0,0 +1,421 @@
+package roslaunch
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/rosapi"
+)
+
+// DefaultShutdownTimeout is the time given to nodes to exit after being
+// interrupted before they are terminated.
+const DefaultShutdownTimeout = 15 * time.Second
+
+// killTimeout is the time given to nodes to exit after being terminated
+// before they are killed.
+const killTimeout = 2 * time.Second
+
+// Runner runs the nodes of a Config as local processes.
+type Runner interface {
+	// Start sets the parameters and starts the nodes.
+	Start() error
+	// Wait waits until every node has exited and returns an error if a
+	// required node exited.
+	Wait() error
+	// Shutdown stops the nodes. They are interrupted, then terminated and
+	// killed if they do not exit in time.
+	Shutdown()
+}
+
+// RunnerOption configures a Runner.
+type RunnerOption func(r *defaultRunner)
+
+// RunnerMasterURI sets the URI of the master, ROS_MASTER_URI by default.
+func RunnerMasterURI(uri string) RunnerOption {
+	return func(r *defaultRunner) {
+		r.masterURI = uri
+	}
+}
+
+// RunnerPackagePath sets the directories searched for the packages of the
+// nodes, ROS_PACKAGE_PATH by default.
+func RunnerPackagePath(paths ...string) RunnerOption {
+	return func(r *defaultRunner) {
+		r.packagePath = paths
+	}
+}
+
+// RunnerOutput sets where the status of the nodes and the output of the nodes
+// with output="screen" are written, os.Stdout and os.Stderr by default.
+func RunnerOutput(stdout, stderr io.Writer) RunnerOption {
+	return func(r *defaultRunner) {
+		r.stdout = stdout
+		r.stderr = stderr
+	}
+}
+
+// RunnerLogDir sets the directory of the output of the nodes with
+// output="log". It defaults to ROS_LOG_DIR, or the log directory of ROS_HOME.
+func RunnerLogDir(dir string) RunnerOption {
+	return func(r *defaultRunner) {
+		r.logDir = dir
+	}
+}
+
+// RunnerShutdownTimeout sets the time given to nodes to exit after being
+// interrupted, DefaultShutdownTimeout by default.
+func RunnerShutdownTimeout(timeout time.Duration) RunnerOption {
+	return func(r *defaultRunner) {
+		r.shutdownTimeout = timeout
+	}
+}
+
+// lockedWriter serializes the writes of the processes and the runner.
+type lockedWriter struct {
+	mutex *sync.Mutex
+	w     io.Writer
+}
+
+func (w lockedWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.w.Write(p)
+}
+
+// process is a node run by the runner.
+type process struct {
+	node       *Node
+	executable string
+	// cmd is the running command and done is closed when it exits.
+	cmd  *exec.Cmd
+	done chan struct{}
+}
+
+type defaultRunner struct {
+	config          *Config
+	masterURI       string
+	packagePath     []string
+	stdout, stderr  io.Writer
+	logDir          string
+	homeDir         string
+	shutdownTimeout time.Duration
+
+	mutex     sync.Mutex
+	processes []*process
+	err       error
+	stopping  chan struct{}
+	stopOnce  sync.Once
+	waitGroup sync.WaitGroup
+}
+
+// NewRunner creates a runner of the nodes of config.
+func NewRunner(config *Config, options ...RunnerOption) Runner {
+	r := &defaultRunner{
+		config:          config,
+		masterURI:       os.Getenv("ROS_MASTER_URI"),
+		packagePath:     envPackagePath(),
+		stdout:          os.Stdout,
+		stderr:          os.Stderr,
+		homeDir:         filepath.Join(os.Getenv("HOME"), ".ros"),
+		shutdownTimeout: DefaultShutdownTimeout,
+		stopping:        make(chan struct{}),
+	}
+	if homeDir := os.Getenv("ROS_HOME"); len(homeDir) > 0 {
+		r.homeDir = homeDir
+	}
+	r.logDir = filepath.Join(r.homeDir, "log")
+	if logDir := os.Getenv("ROS_LOG_DIR"); len(logDir) > 0 {
+		r.logDir = logDir
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+	var mutex sync.Mutex
+	r.stdout = lockedWriter{&mutex, r.stdout}
+	r.stderr = lockedWriter{&mutex, r.stderr}
+	return r
+}
+
+func (r *defaultRunner) logf(format string, args ...interface{}) {
+	fmt.Fprintf(r.stdout, format+"\n", args...)
+}
+
+func (r *defaultRunner) Start() error {
+	for _, n := range r.config.Nodes {
+		if n.Machine != "" {
+			if m := r.config.Machines[n.Machine]; m != nil && !isLocal(m.Address) {
+				return fmt.Errorf("roslaunch: %s: remote machine %s is not supported", n.Name, m.Address)
+			}
+		}
+		executable, err := r.findExecutable(n.Package, n.Type)
+		if err != nil {
+			return err
+		}
+		r.processes = append(r.processes, &process{node: n, executable: executable})
+	}
+
+	if r.masterURI == "" {
+		return fmt.Errorf("roslaunch: ROS_MASTER_URI is not set")
+	}
+	master := rosapi.NewMasterClient(r.masterURI, "/roslaunch")
+	for _, names := range [][]string{r.config.ClearParams, r.config.DeleteParams} {
+		for _, name := range names {
+			// Deleting parameters which are not set fails with an *rosapi.Error.
+			if err := master.DeleteParam(name); err != nil {
+				if _, ok := err.(*rosapi.Error); !ok {
+					return err
+				}
+			}
+		}
+	}
+	for _, name := range r.config.ParamNames() {
+		if err := master.SetParam(name, r.config.Params[name]); err != nil {
+			return fmt.Errorf("roslaunch: setting %s: %v", name, err)
+		}
+	}
+
+	for _, p := range r.processes {
+		r.waitGroup.Add(1)
+		go r.run(p)
+	}
+	return nil
+}
+
+// isLocal tells whether address designates this machine.
+func isLocal(address string) bool {
+	if address == "localhost" || strings.HasPrefix(address, "127.") || address == "::1" {
+		return true
+	}
+	if host, err := os.Hostname(); err == nil && host == address {
+		return true
+	}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.String() == address {
+			return true
+		}
+	}
+	return false
+}
+
+// findExecutable finds the executable typ of package pkg in the lib
+// directories of CMAKE_PREFIX_PATH or in the directory of the package.
+func (r *defaultRunner) findExecutable(pkg, typ string) (string, error) {
+	isExecutable := func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && info.Mode().IsRegular() && info.Mode()&0111 != 0
+	}
+	for _, prefix := range filepath.SplitList(os.Getenv("CMAKE_PREFIX_PATH")) {
+		if path := filepath.Join(prefix, "lib", pkg, typ); prefix != "" && isExecutable(path) {
+			return path, nil
+		}
+	}
+	dir, err := FindPackage(r.packagePath, pkg)
+	if err != nil {
+		return "", err
+	}
+	var found string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || found != "" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() && path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if info.Name() == typ && isExecutable(path) {
+			found = path
+		}
+		return nil
+	})
+	if found == "" {
+		return "", fmt.Errorf("roslaunch: cannot find executable %s in package %s", typ, pkg)
+	}
+	return found, nil
+}
+
+func (r *defaultRunner) command(p *process) (*exec.Cmd, error) {
+	n := p.node
+	argv := append(append([]string{}, n.LaunchPrefix...), p.executable)
+	argv = append(argv, n.Args...)
+	for _, remap := range n.Remaps {
+		argv = append(argv, remap.From+":="+remap.To)
+	}
+	argv = append(argv, "__name:="+n.BaseName(), "__ns:="+n.Namespace())
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), "ROS_MASTER_URI="+r.masterURI, "ROS_NAMESPACE="+n.Namespace())
+	for _, env := range n.Env {
+		cmd.Env = append(cmd.Env, env.Name+"="+env.Value)
+	}
+	switch n.Cwd {
+	case "node":
+		cmd.Dir = filepath.Dir(p.executable)
+	default:
+		if info, err := os.Stat(r.homeDir); err == nil && info.IsDir() {
+			cmd.Dir = r.homeDir
+		}
+	}
+	if n.Output == "screen" {
+		cmd.Stdout, cmd.Stderr = r.stdout, r.stderr
+		return cmd, nil
+	}
+	if err := os.MkdirAll(r.logDir, 0755); err != nil {
+		return nil, err
+	}
+	name := strings.Replace(strings.TrimPrefix(n.Name, "/"), "/", "-", -1)
+	out, err := os.OpenFile(filepath.Join(r.logDir, name+"-stdout.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout, cmd.Stderr = out, out
+	return cmd, nil
+}
+
+// start starts a process unless the runner is stopping.
+func (r *defaultRunner) start(p *process) (*exec.Cmd, chan struct{}, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	select {
+	case <-r.stopping:
+		return nil, nil, nil
+	default:
+	}
+	cmd, err := r.command(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		if f, ok := cmd.Stdout.(*os.File); ok {
+			f.Close()
+		}
+		return nil, nil, err
+	}
+	p.cmd, p.done = cmd, make(chan struct{})
+	return cmd, p.done, nil
+}
+
+func (r *defaultRunner) run(p *process) {
+	defer r.waitGroup.Done()
+	n := p.node
+	for {
+		cmd, done, err := r.start(p)
+		if err != nil {
+			r.logf("[%s] failed to start: %v", n.Name, err)
+			if n.Required {
+				r.fail(fmt.Errorf("roslaunch: required node %s failed to start: %v", n.Name, err))
+			}
+			return
+		}
+		if cmd == nil {
+			return
+		}
+		r.logf("process[%s]: started with pid [%d]", n.Name, cmd.Process.Pid)
+		err = cmd.Wait()
+		if f, ok := cmd.Stdout.(*os.File); ok {
+			f.Close()
+		}
+		close(done)
+
+		select {
+		case <-r.stopping:
+			r.logf("[%s] killing on exit", n.Name)
+			return
+		default:
+		}
+		if err != nil {
+			r.logf("[%s] process has died [pid %d, %v]", n.Name, cmd.Process.Pid, err)
+		} else {
+			r.logf("[%s] process has finished cleanly", n.Name)
+		}
+		if n.Required {
+			r.fail(fmt.Errorf("roslaunch: required node %s exited", n.Name))
+			return
+		}
+		if !n.Respawn {
+			return
+		}
+		r.logf("[%s] restarting process", n.Name)
+		select {
+		case <-time.After(n.RespawnDelay):
+		case <-r.stopping:
+			return
+		}
+	}
+}
+
+// fail records the first error and shuts the nodes down.
+func (r *defaultRunner) fail(err error) {
+	r.mutex.Lock()
+	if r.err == nil {
+		r.err = err
+	}
+	r.mutex.Unlock()
+	go r.Shutdown()
+}
+
+func (r *defaultRunner) Wait() error {
+	r.waitGroup.Wait()
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+func (r *defaultRunner) Shutdown() {
+	r.stopOnce.Do(func() {
+		r.mutex.Lock()
+		close(r.stopping)
+		processes := append([]*process{}, r.processes...)
+		r.mutex.Unlock()
+		var wg sync.WaitGroup
+		for _, p := range processes {
+			r.mutex.Lock()
+			cmd, done := p.cmd, p.done
+			r.mutex.Unlock()
+			if cmd == nil {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.stop(cmd, done)
+			}()
+		}
+		wg.Wait()
+	})
+	r.waitGroup.Wait()
+}
+
+// stop interrupts a process, then terminates and kills it if it does not
+// exit in time.
+func (r *defaultRunner) stop(cmd *exec.Cmd, done chan struct{}) {
+	for _, step := range []struct {
+		signal  os.Signal
+		timeout time.Duration
+	}{
+		{os.Interrupt, r.shutdownTimeout},
+		{syscall.SIGTERM, killTimeout},
+		{os.Kill, killTimeout},
+	} {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		cmd.Process.Signal(step.signal)
+		select {
+		case <-done:
+			return
+		case <-time.After(step.timeout):
+		}
+	}
+}
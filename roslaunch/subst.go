@@ -0,0 +1,581 @@
+package roslaunch
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// substitute resolves the $(...) substitution args of s.
+func (l *loader) substitute(s *scope, text string) (string, error) {
+	if strings.HasPrefix(text, "$(eval ") && strings.HasSuffix(text, ")") {
+		value, err := l.eval(s, text[len("$(eval "):len(text)-1])
+		if err != nil {
+			return "", err
+		}
+		return formatValue(value), nil
+	}
+	var buf strings.Builder
+	for {
+		start := strings.Index(text, "$(")
+		if start < 0 {
+			buf.WriteString(text)
+			return buf.String(), nil
+		}
+		end := strings.Index(text[start:], ")")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated substitution arg in %q", text)
+		}
+		end += start
+		fields := strings.Fields(text[start+2 : end])
+		if len(fields) == 0 {
+			return "", fmt.Errorf("empty substitution arg in %q", text)
+		}
+		value, err := l.substituteArg(s, fields[0], fields[1:])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(text[:start])
+		buf.WriteString(value)
+		text = text[end+1:]
+	}
+}
+
+func (l *loader) substituteArg(s *scope, command string, args []string) (string, error) {
+	switch command {
+	case "find", "arg", "env", "anon":
+		if len(args) != 1 {
+			return "", fmt.Errorf("$(%s) takes one argument but %d", command, len(args))
+		}
+		switch command {
+		case "find":
+			return FindPackage(l.packagePath, args[0])
+		case "arg":
+			return s.arg(args[0])
+		case "env":
+			value, ok := os.LookupEnv(args[0])
+			if !ok {
+				return "", fmt.Errorf("environment variable %s is not set", args[0])
+			}
+			return value, nil
+		default:
+			return l.anonName(args[0]), nil
+		}
+	case "optenv":
+		if len(args) == 0 {
+			return "", fmt.Errorf("$(optenv) takes at least one argument")
+		}
+		if value, ok := os.LookupEnv(args[0]); ok {
+			return value, nil
+		}
+		return strings.Join(args[1:], " "), nil
+	case "dirname":
+		if len(args) != 0 {
+			return "", fmt.Errorf("$(dirname) takes no argument")
+		}
+		return filepath.Dir(s.file.filename), nil
+	case "eval":
+		return "", fmt.Errorf("$(eval) must span the whole attribute")
+	}
+	return "", fmt.Errorf("unknown substitution arg $(%s)", command)
+}
+
+// anonName returns the anonymous name generated for base, which is the same
+// for the whole launch.
+func (l *loader) anonName(base string) string {
+	if name, ok := l.anon[base]; ok {
+		return name
+	}
+	host, _ := os.Hostname()
+	host = regexp.MustCompile(`[^a-zA-Z0-9_]`).ReplaceAllString(host, "_")
+	name := fmt.Sprintf("%s_%s_%d_%d", base, host, os.Getpid(), rand.New(rand.NewSource(time.Now().UnixNano())).Int63())
+	l.anon[base] = name
+	return name
+}
+
+// formatValue formats a value of an $(eval) expression the way Python does.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "None"
+	case bool:
+		if v {
+			return "True"
+		}
+		return "False"
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1e16 {
+			return strconv.FormatFloat(v, 'f', 1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// eval evaluates an $(eval) expression.
+func (l *loader) eval(s *scope, expr string) (interface{}, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, fmt.Errorf("$(eval %s): %v", expr, err)
+	}
+	e := &evaluator{loader: l, scope: s, tokens: tokens}
+	value, err := e.ternary()
+	if err == nil && e.pos < len(e.tokens) {
+		err = fmt.Errorf("unexpected %q", e.tokens[e.pos].text)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("$(eval %s): %v", expr, err)
+	}
+	return value, nil
+}
+
+type tokenKind int
+
+const (
+	tokenName tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+var tokenPattern = regexp.MustCompile(`^(?:` +
+	`(?P<name>[A-Za-z_][A-Za-z0-9_]*)|` +
+	`(?P<number>(?:[0-9]+\.?[0-9]*|\.[0-9]+)(?:[eE][-+]?[0-9]+)?)|` +
+	`(?P<string>'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*")|` +
+	`(?P<operator>\*\*|//|==|!=|<=|>=|[-+*/%<>(),]))`)
+
+func tokenize(expr string) ([]token, error) {
+	var tokens []token
+	for {
+		expr = strings.TrimLeft(expr, " \t\n")
+		if expr == "" {
+			return tokens, nil
+		}
+		m := tokenPattern.FindStringSubmatch(expr)
+		if m == nil {
+			return nil, fmt.Errorf("invalid character %q", expr[0])
+		}
+		for i, kind := range []tokenKind{tokenName, tokenNumber, tokenString, tokenOperator} {
+			if m[i+1] != "" {
+				tokens = append(tokens, token{kind, m[i+1]})
+			}
+		}
+		expr = expr[len(m[0]):]
+	}
+}
+
+// evaluator evaluates the subset of Python expressions used in launch files.
+type evaluator struct {
+	loader *loader
+	scope  *scope
+	tokens []token
+	pos    int
+	// skip is positive while parsing operands which are not evaluated, like
+	// the right operand of a short-circuited or.
+	skip int
+}
+
+func (e *evaluator) peek(texts ...string) bool {
+	if e.pos >= len(e.tokens) || e.tokens[e.pos].kind == tokenString {
+		return false
+	}
+	for _, text := range texts {
+		if e.tokens[e.pos].text == text {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *evaluator) next() (token, error) {
+	if e.pos >= len(e.tokens) {
+		return token{}, fmt.Errorf("unexpected end of expression")
+	}
+	e.pos++
+	return e.tokens[e.pos-1], nil
+}
+
+func (e *evaluator) expect(text string) error {
+	if !e.peek(text) {
+		return fmt.Errorf("expected %q", text)
+	}
+	e.pos++
+	return nil
+}
+
+// skipped parses an operand without evaluating it.
+func (e *evaluator) skipped(parse func() (interface{}, error)) error {
+	e.skip++
+	defer func() { e.skip-- }()
+	_, err := parse()
+	return err
+}
+
+func (e *evaluator) ternary() (interface{}, error) {
+	start := e.pos
+	if err := e.skipped(e.or); err != nil || !e.peek("if") {
+		if err != nil {
+			return nil, err
+		}
+		e.pos = start
+		return e.or()
+	}
+	e.pos++
+	cond, err := e.or()
+	if err != nil {
+		return nil, err
+	}
+	if err := e.expect("else"); err != nil {
+		return nil, err
+	}
+	if !truth(cond) || e.skip > 0 {
+		return e.ternary()
+	}
+	if err := e.skipped(e.ternary); err != nil {
+		return nil, err
+	}
+	end := e.pos
+	e.pos = start
+	value, err := e.or()
+	e.pos = end
+	return value, err
+}
+
+func (e *evaluator) or() (interface{}, error) {
+	value, err := e.and()
+	for err == nil && e.peek("or") {
+		e.pos++
+		if truth(value) {
+			err = e.skipped(e.and)
+		} else {
+			value, err = e.and()
+		}
+	}
+	return value, err
+}
+
+func (e *evaluator) and() (interface{}, error) {
+	value, err := e.not()
+	for err == nil && e.peek("and") {
+		e.pos++
+		if !truth(value) {
+			err = e.skipped(e.not)
+		} else {
+			value, err = e.not()
+		}
+	}
+	return value, err
+}
+
+func (e *evaluator) not() (interface{}, error) {
+	if e.peek("not") {
+		e.pos++
+		value, err := e.not()
+		return !truth(value), err
+	}
+	return e.comparison()
+}
+
+func (e *evaluator) comparison() (interface{}, error) {
+	left, err := e.arith()
+	if err != nil || !e.peek("==", "!=", "<", "<=", ">", ">=") {
+		return left, err
+	}
+	// Comparisons chain: a < b < c means a < b and b < c.
+	result := true
+	for e.peek("==", "!=", "<", "<=", ">", ">=") {
+		op, _ := e.next()
+		right, err := e.arith()
+		if err != nil {
+			return nil, err
+		}
+		if e.skip == 0 {
+			ok, err := compare(op.text, left, right)
+			if err != nil {
+				return nil, err
+			}
+			result = result && ok
+		}
+		left = right
+	}
+	return result, nil
+}
+
+// binary applies a binary operator unless operands are skipped.
+func (e *evaluator) binary(op string, a, b interface{}) (interface{}, error) {
+	if e.skip > 0 {
+		return nil, nil
+	}
+	return binary(op, a, b)
+}
+
+func (e *evaluator) arith() (interface{}, error) {
+	value, err := e.term()
+	for err == nil && e.peek("+", "-") {
+		op, _ := e.next()
+		var other interface{}
+		if other, err = e.term(); err == nil {
+			value, err = e.binary(op.text, value, other)
+		}
+	}
+	return value, err
+}
+
+func (e *evaluator) term() (interface{}, error) {
+	value, err := e.factor()
+	for err == nil && e.peek("*", "/", "//", "%") {
+		op, _ := e.next()
+		var other interface{}
+		if other, err = e.factor(); err == nil {
+			value, err = e.binary(op.text, value, other)
+		}
+	}
+	return value, err
+}
+
+func (e *evaluator) factor() (interface{}, error) {
+	if e.peek("-", "+") {
+		op, _ := e.next()
+		value, err := e.factor()
+		if err != nil {
+			return nil, err
+		}
+		return e.binary(op.text, int64(0), value)
+	}
+	value, err := e.primary()
+	if err != nil || !e.peek("**") {
+		return value, err
+	}
+	e.pos++
+	exponent, err := e.factor()
+	if err != nil {
+		return nil, err
+	}
+	return e.binary("**", value, exponent)
+}
+
+func (e *evaluator) primary() (interface{}, error) {
+	t, err := e.next()
+	if err != nil {
+		return nil, err
+	}
+	switch t.kind {
+	case tokenNumber:
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return i, nil
+		}
+		return strconv.ParseFloat(t.text, 64)
+	case tokenString:
+		return unquote(t.text)
+	case tokenOperator:
+		if t.text != "(" {
+			return nil, fmt.Errorf("unexpected %q", t.text)
+		}
+		value, err := e.ternary()
+		if err != nil {
+			return nil, err
+		}
+		return value, e.expect(")")
+	}
+	switch t.text {
+	case "True":
+		return true, nil
+	case "False":
+		return false, nil
+	case "None":
+		return nil, nil
+	}
+	if !e.peek("(") {
+		if e.skip > 0 {
+			return nil, nil
+		}
+		// Bare names are the args of the launch file.
+		return e.scope.arg(t.text)
+	}
+	e.pos++
+	var args []string
+	for !e.peek(")") {
+		if len(args) > 0 {
+			if err := e.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		value, err := e.ternary()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, formatArg(value))
+	}
+	e.pos++
+	if e.skip > 0 {
+		return nil, nil
+	}
+	return e.loader.substituteArg(e.scope, t.text, args)
+}
+
+// formatArg formats a function argument, leaving strings unchanged.
+func formatArg(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return formatValue(value)
+}
+
+func unquote(text string) (string, error) {
+	body := text[1 : len(text)-1]
+	if text[0] == '\'' {
+		body = strings.Replace(strings.Replace(body, `\'`, `'`, -1), `"`, `\"`, -1)
+	}
+	return strconv.Unquote(`"` + body + `"`)
+}
+
+// truth returns the truth value of a value the way Python does.
+func truth(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// number converts booleans and integers to numbers.
+func number(value interface{}) (float64, bool, bool) {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return 1, true, true
+		}
+		return 0, true, true
+	case int64:
+		return float64(v), true, true
+	case float64:
+		return v, false, true
+	}
+	return 0, false, false
+}
+
+func binary(op string, a, b interface{}) (interface{}, error) {
+	if sa, ok := a.(string); ok {
+		if sb, ok := b.(string); ok && op == "+" {
+			return sa + sb, nil
+		}
+		if n, ok := b.(int64); ok && op == "*" {
+			return strings.Repeat(sa, int(math.Max(0, float64(n)))), nil
+		}
+	}
+	x, xInt, ok1 := number(a)
+	y, yInt, ok2 := number(b)
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("unsupported operand types for %s: %s and %s", op, typeName(a), typeName(b))
+	}
+	integers := xInt && yInt
+	var result float64
+	switch op {
+	case "+":
+		result = x + y
+	case "-":
+		result = x - y
+	case "*":
+		result = x * y
+	case "/":
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return x / y, nil
+	case "//", "%":
+		if y == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		result = math.Floor(x / y)
+		if op == "%" {
+			result = x - y*result
+		}
+	case "**":
+		result = math.Pow(x, y)
+		integers = integers && y >= 0
+	}
+	if integers {
+		return int64(result), nil
+	}
+	return result, nil
+}
+
+func compare(op string, a, b interface{}) (bool, error) {
+	var c int
+	if sa, ok := a.(string); ok {
+		sb, ok := b.(string)
+		if !ok {
+			if op == "==" || op == "!=" {
+				return op == "!=", nil
+			}
+			return false, fmt.Errorf("cannot compare %s and %s", typeName(a), typeName(b))
+		}
+		c = strings.Compare(sa, sb)
+	} else if a == nil || b == nil {
+		if op != "==" && op != "!=" {
+			return false, fmt.Errorf("cannot compare %s and %s", typeName(a), typeName(b))
+		}
+		return (a == b) == (op == "=="), nil
+	} else {
+		x, _, ok1 := number(a)
+		y, _, ok2 := number(b)
+		if !ok1 || !ok2 {
+			if op == "==" || op == "!=" {
+				return op == "!=", nil
+			}
+			return false, fmt.Errorf("cannot compare %s and %s", typeName(a), typeName(b))
+		}
+		switch {
+		case x < y:
+			c = -1
+		case x > y:
+			c = 1
+		}
+	}
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "NoneType"
+	case bool:
+		return "bool"
+	case int64:
+		return "int"
+	case float64:
+		return "float"
+	}
+	return "str"
+}
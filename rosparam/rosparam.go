@@ -0,0 +1,247 @@
+// Package rosparam loads YAML documents into the parameter server and dumps
+// namespaces back to YAML, like the rosparam tool.
+//
+// The functions work on any Params, such as a ros.Node or a
+// rosapi.MasterClient:
+//
+//	data, _ := ioutil.ReadFile("config.yaml")
+//	err := rosparam.Load(node, "/robot", data)
+//
+// Documents may use the !degrees and !radians tags of rosparam, whose values
+// are arithmetic expressions of numbers and pi, e.g. `!radians pi/2`. Both
+// are converted to radians.
+package rosparam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/fetchrobotics/rosgo/yaml"
+)
+
+// Params is the parameter server API used by the functions of this package.
+type Params interface {
+	GetParam(name string) (interface{}, error)
+	SetParam(name string, value interface{}) error
+	DeleteParam(name string) error
+}
+
+// Tags are the YAML tags understood by rosparam.
+var Tags = map[string]yaml.TagFunc{
+	"!degrees": func(raw string) (interface{}, error) {
+		value, err := evalAngle(raw)
+		return value * math.Pi / 180, err
+	},
+	"!radians": func(raw string) (interface{}, error) {
+		return evalAngle(raw)
+	},
+}
+
+// Unmarshal decodes a YAML document with the rosparam tags.
+func Unmarshal(data []byte) (interface{}, error) {
+	return yaml.UnmarshalWithTags(data, Tags)
+}
+
+// Load sets the parameters of a YAML document under namespace. The keys of
+// a dictionary are set one by one, each replacing the parameter of the same
+// name; other values require a namespace other than the root.
+func Load(params Params, namespace string, data []byte) error {
+	value, err := Unmarshal(data)
+	if err != nil {
+		return err
+	}
+	if d, ok := value.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(d))
+		for k := range d {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := params.SetParam(joinName(namespace, k), d[k]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if value == nil {
+		return nil
+	}
+	if namespace == "" || namespace == "/" {
+		return fmt.Errorf("rosparam: cannot set a %T at the root namespace", value)
+	}
+	return params.SetParam(namespace, value)
+}
+
+// LoadFile sets the parameters of a YAML file under namespace.
+func LoadFile(params Params, namespace string, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return Load(params, namespace, data)
+}
+
+// Dump encodes the parameters of namespace as a YAML document.
+func Dump(params Params, namespace string) ([]byte, error) {
+	if namespace == "" {
+		namespace = "/"
+	}
+	value, err := params.GetParam(namespace)
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(value)
+}
+
+// Set sets a parameter to the value of a YAML document.
+func Set(params Params, name string, text string) error {
+	value, err := Unmarshal([]byte(text))
+	if err != nil {
+		return err
+	}
+	return params.SetParam(name, value)
+}
+
+// List returns the sorted names of the parameters in namespace.
+func List(params Params, namespace string) ([]string, error) {
+	if namespace == "" {
+		namespace = "/"
+	}
+	value, err := params.GetParam(namespace)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	var walk func(name string, value interface{})
+	walk = func(name string, value interface{}) {
+		d, ok := value.(map[string]interface{})
+		if !ok {
+			names = append(names, name)
+			return
+		}
+		for k, v := range d {
+			walk(joinName(name, k), v)
+		}
+	}
+	walk(namespace, value)
+	sort.Strings(names)
+	return names, nil
+}
+
+// joinName joins a namespace and a name. Global names are left unchanged.
+func joinName(ns, name string) string {
+	switch {
+	case strings.HasPrefix(name, "/"):
+		return name
+	case ns == "":
+		return name
+	case strings.HasSuffix(ns, "/") || ns == "~":
+		return ns + name
+	}
+	return ns + "/" + name
+}
+
+// evalAngle evaluates an arithmetic expression of numbers and pi.
+func evalAngle(text string) (float64, error) {
+	p := &angleParser{text: text}
+	value, err := p.sum()
+	if err == nil {
+		p.skipSpaces()
+		if p.pos < len(p.text) {
+			err = fmt.Errorf("unexpected %q", p.text[p.pos:])
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("invalid angle %q: %v", text, err)
+	}
+	return value, nil
+}
+
+type angleParser struct {
+	text string
+	pos  int
+}
+
+func (p *angleParser) skipSpaces() {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// operator consumes one of ops and returns it, or 0.
+func (p *angleParser) operator(ops string) byte {
+	p.skipSpaces()
+	if p.pos < len(p.text) && strings.IndexByte(ops, p.text[p.pos]) >= 0 {
+		p.pos++
+		return p.text[p.pos-1]
+	}
+	return 0
+}
+
+func (p *angleParser) sum() (float64, error) {
+	value, err := p.product()
+	for err == nil {
+		op := p.operator("+-")
+		if op == 0 {
+			break
+		}
+		var other float64
+		if other, err = p.product(); op == '+' {
+			value += other
+		} else {
+			value -= other
+		}
+	}
+	return value, err
+}
+
+func (p *angleParser) product() (float64, error) {
+	value, err := p.unary()
+	for err == nil {
+		op := p.operator("*/")
+		if op == 0 {
+			break
+		}
+		var other float64
+		if other, err = p.unary(); op == '*' {
+			value *= other
+		} else {
+			value /= other
+		}
+	}
+	return value, err
+}
+
+func (p *angleParser) unary() (float64, error) {
+	switch p.operator("-+(") {
+	case '-':
+		value, err := p.unary()
+		return -value, err
+	case '+':
+		return p.unary()
+	case '(':
+		value, err := p.sum()
+		if err == nil && p.operator(")") == 0 {
+			err = fmt.Errorf("missing )")
+		}
+		return value, err
+	}
+	start := p.pos
+	for p.pos < len(p.text) && (unicode.IsLetter(rune(p.text[p.pos])) || unicode.IsDigit(rune(p.text[p.pos])) || p.text[p.pos] == '.') {
+		p.pos++
+	}
+	token := p.text[start:p.pos]
+	if token == "pi" {
+		return math.Pi, nil
+	}
+	value, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", token)
+	}
+	return value, nil
+}
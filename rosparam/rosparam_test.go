@@ -0,0 +1,92 @@
+package rosparam
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+	"github.com/fetchrobotics/rosgo/rosapi"
+)
+
+func TestTags(t *testing.T) {
+	value, err := Unmarshal([]byte("a: !degrees 180\nb: !radians pi/2\nc: !degrees -(45 + 45) * 2\nd: !radians 1.5"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"a": math.Pi, "b": math.Pi / 2, "c": -math.Pi, "d": 1.5}
+	if !reflect.DeepEqual(value, want) {
+		t.Errorf("expected %v but %v", want, value)
+	}
+	for _, text := range []string{"a: !degrees x", "a: !radians pi/", "a: !radians (1", "a: !degrees 1 2"} {
+		if _, err := Unmarshal([]byte(text)); err == nil {
+			t.Errorf("%s: expected an error", text)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	client := rosapi.NewMasterClient(m.URI(), "/test")
+	node, err := ros.NewNode("/robot/test", []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Shutdown()
+
+	if err := client.SetParam("/kept", "yes"); err != nil {
+		t.Fatal(err)
+	}
+	config := []byte("arm:\n  joints: [shoulder, elbow]\n  limit: !degrees 90\nrate: 10\n")
+	if err := Load(client, "/", config); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := client.GetParam("/arm"); err != nil || !reflect.DeepEqual(value, map[string]interface{}{
+		"joints": []interface{}{"shoulder", "elbow"}, "limit": math.Pi / 2}) {
+		t.Errorf("unexpected /arm %v, %v", value, err)
+	}
+	if value, err := client.GetParam("/kept"); err != nil || value != "yes" {
+		t.Errorf("expected the other parameters to be kept but %v, %v", value, err)
+	}
+	// Relative names are resolved by the node.
+	if err := Load(node, "~", []byte("gain: 0.5\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(node, "mode", []byte("fast\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(node, "/", []byte("[1, 2]")); err == nil {
+		t.Error("expected an error for a list at the root namespace")
+	}
+
+	names, err := List(client, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"/arm/joints", "/arm/limit", "/kept", "/rate", "/robot/mode", "/robot/test/gain"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected the names %v but %v", want, names)
+	}
+	if names, err := List(node, "~"); err != nil || !reflect.DeepEqual(names, []string{"~gain"}) {
+		t.Errorf("unexpected private names %v, %v", names, err)
+	}
+
+	if err := Set(client, "/arm/kept", "[1, {a: b}]"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Dump(client, "/arm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "joints:\n- shoulder\n- elbow\nkept:\n- 1\n- a: b\nlimit: 1.5707963267948966\n"
+	if string(data) != want {
+		t.Errorf("expected the dump\n%s\nbut\n%s", want, data)
+	}
+	if _, err := Dump(client, "/missing"); err == nil {
+		t.Error("expected an error for a missing namespace")
+	}
+}
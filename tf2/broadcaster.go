@@ -0,0 +1,74 @@
+package tf2
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// TransformBroadcaster publishes transforms on /tf.
+type TransformBroadcaster interface {
+	SendTransform(transforms ...TransformStamped)
+	Shutdown()
+}
+
+type defaultTransformBroadcaster struct {
+	pub ros.Publisher
+}
+
+// NewTransformBroadcaster creates a publisher of node on /tf.
+func NewTransformBroadcaster(node ros.Node) TransformBroadcaster {
+	return &defaultTransformBroadcaster{pub: node.NewPublisher("/tf", TFMessageType)}
+}
+
+func (b *defaultTransformBroadcaster) SendTransform(transforms ...TransformStamped) {
+	b.pub.Publish(NewTFMessage(transforms))
+}
+
+func (b *defaultTransformBroadcaster) Shutdown() {
+	b.pub.Shutdown()
+}
+
+// StaticTransformBroadcaster publishes transforms which never change on
+// /tf_static. The publisher is latched so that listeners started later
+// receive them too.
+type StaticTransformBroadcaster interface {
+	// SendTransform adds transforms, replacing the transforms of the same
+	// child frames, and publishes all of them.
+	SendTransform(transforms ...TransformStamped)
+	Shutdown()
+}
+
+type defaultStaticTransformBroadcaster struct {
+	mutex      sync.Mutex
+	pub        ros.Publisher
+	transforms map[string]TransformStamped
+}
+
+// NewStaticTransformBroadcaster creates a latched publisher of node on
+// /tf_static.
+func NewStaticTransformBroadcaster(node ros.Node) StaticTransformBroadcaster {
+	return &defaultStaticTransformBroadcaster{
+		pub:        node.NewPublisher("/tf_static", TFMessageType, ros.PublisherLatched(true)),
+		transforms: map[string]TransformStamped{},
+	}
+}
+
+func (b *defaultStaticTransformBroadcaster) SendTransform(transforms ...TransformStamped) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, t := range transforms {
+		b.transforms[t.ChildFrameID] = t
+	}
+	all := make([]TransformStamped, 0, len(b.transforms))
+	for _, t := range b.transforms {
+		all = append(all, t)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ChildFrameID < all[j].ChildFrameID })
+	b.pub.Publish(NewTFMessage(all))
+}
+
+func (b *defaultStaticTransformBroadcaster) Shutdown() {
+	b.pub.Shutdown()
+}
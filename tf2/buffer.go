@@ -0,0 +1,426 @@
+package tf2
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// DefaultCacheTime is how long a buffer keeps transforms by default.
+const DefaultCacheTime = 10 * time.Second
+
+// maxDepth limits the length of the chains of frames, which catches loops.
+const maxDepth = 1000
+
+// LookupError is returned when a frame is unknown.
+type LookupError struct {
+	msg string
+}
+
+func (e *LookupError) Error() string { return e.msg }
+
+// ConnectivityError is returned when two frames are not in the same tree.
+type ConnectivityError struct {
+	msg string
+}
+
+func (e *ConnectivityError) Error() string { return e.msg }
+
+// ExtrapolationError is returned when a transform is requested at a time
+// the buffer has no data for.
+type ExtrapolationError struct {
+	msg string
+}
+
+func (e *ExtrapolationError) Error() string { return e.msg }
+
+// TimeoutError is returned when a transform was not available in time.
+type TimeoutError struct {
+	msg string
+}
+
+func (e *TimeoutError) Error() string { return e.msg }
+
+// Buffer stores transforms and looks them up between any two frames. A zero
+// time means the latest time at which the transform is available. Frames
+// may be given with a leading slash.
+type Buffer interface {
+	// SetTransform adds a transform. Static transforms are valid at all
+	// times.
+	SetTransform(t TransformStamped, static bool) error
+	// LookupTransform returns the transform from source to target at t.
+	LookupTransform(target, source string, t ros.Time) (TransformStamped, error)
+	// LookupTransformFull returns the transform from source at sourceTime
+	// to target at targetTime, assuming that fixed does not move.
+	LookupTransformFull(target string, targetTime ros.Time, source string, sourceTime ros.Time, fixed string) (TransformStamped, error)
+	// CanTransform reports whether LookupTransform would succeed.
+	CanTransform(target, source string, t ros.Time) bool
+	// CanTransformFull reports whether LookupTransformFull would succeed.
+	CanTransformFull(target string, targetTime ros.Time, source string, sourceTime ros.Time, fixed string) bool
+	// WaitForTransform waits at most timeout for the transform from source
+	// to target at t to be available, and returns it.
+	WaitForTransform(target, source string, t ros.Time, timeout time.Duration) (TransformStamped, error)
+	// Frames returns the names of the known frames.
+	Frames() []string
+	// Clear removes all the transforms.
+	Clear()
+}
+
+// BufferOption configures a Buffer.
+type BufferOption func(b *defaultBuffer)
+
+// BufferCacheTime sets how long transforms are kept, DefaultCacheTime by
+// default. Lookups older than the latest transform of a frame by more than
+// this fail.
+func BufferCacheTime(d time.Duration) BufferOption {
+	return func(b *defaultBuffer) {
+		b.cacheTime = d
+	}
+}
+
+type defaultBuffer struct {
+	mutex     sync.Mutex
+	cacheTime time.Duration
+	// caches are the transforms to the parents of the frames.
+	caches map[string]*frameCache
+	known  map[string]bool
+	// updated is closed and replaced whenever a transform is added.
+	updated chan struct{}
+}
+
+// NewBuffer creates an empty buffer.
+func NewBuffer(options ...BufferOption) Buffer {
+	b := &defaultBuffer{cacheTime: DefaultCacheTime}
+	for _, opt := range options {
+		opt(b)
+	}
+	b.Clear()
+	return b
+}
+
+func stripSlash(frame string) string {
+	return strings.TrimPrefix(frame, "/")
+}
+
+func formatTime(t ros.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Sec, t.NSec)
+}
+
+func (b *defaultBuffer) Clear() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.caches = map[string]*frameCache{}
+	b.known = map[string]bool{}
+	if b.updated == nil {
+		b.updated = make(chan struct{})
+	}
+}
+
+func (b *defaultBuffer) SetTransform(t TransformStamped, static bool) error {
+	t.FrameID = stripSlash(t.FrameID)
+	t.ChildFrameID = stripSlash(t.ChildFrameID)
+	switch {
+	case t.FrameID == "" || t.ChildFrameID == "":
+		return fmt.Errorf("tf2: transform from %q to %q has an empty frame", t.ChildFrameID, t.FrameID)
+	case t.FrameID == t.ChildFrameID:
+		return fmt.Errorf("tf2: transform from %q to itself", t.ChildFrameID)
+	}
+	v, q := t.Transform.Translation, t.Transform.Rotation
+	for _, x := range []float64{v.X, v.Y, v.Z, q.X, q.Y, q.Z, q.W} {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return fmt.Errorf("tf2: transform from %q to %q is not finite", t.ChildFrameID, t.FrameID)
+		}
+	}
+	t.Transform.Rotation = q.Normalize()
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	cache, ok := b.caches[t.ChildFrameID]
+	if !ok {
+		cache = &frameCache{static: static}
+		b.caches[t.ChildFrameID] = cache
+	}
+	if err := cache.insert(t, b.cacheTime); err != nil {
+		return err
+	}
+	b.known[t.FrameID] = true
+	b.known[t.ChildFrameID] = true
+	close(b.updated)
+	b.updated = make(chan struct{})
+	return nil
+}
+
+func (b *defaultBuffer) Frames() []string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	frames := make([]string, 0, len(b.known))
+	for frame := range b.known {
+		frames = append(frames, frame)
+	}
+	sort.Strings(frames)
+	return frames
+}
+
+func (b *defaultBuffer) LookupTransform(target, source string, t ros.Time) (TransformStamped, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.lookupTransform(target, source, t)
+}
+
+func (b *defaultBuffer) lookupTransform(target, source string, t ros.Time) (TransformStamped, error) {
+	target, source = stripSlash(target), stripSlash(source)
+	transform, stamp, err := b.lookup(target, source, t)
+	if err != nil {
+		return TransformStamped{}, err
+	}
+	return TransformStamped{Stamp: stamp, FrameID: target, ChildFrameID: source, Transform: transform}, nil
+}
+
+func (b *defaultBuffer) LookupTransformFull(target string, targetTime ros.Time, source string, sourceTime ros.Time, fixed string) (TransformStamped, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.lookupTransformFull(target, targetTime, source, sourceTime, fixed)
+}
+
+func (b *defaultBuffer) lookupTransformFull(target string, targetTime ros.Time, source string, sourceTime ros.Time, fixed string) (TransformStamped, error) {
+	target, source, fixed = stripSlash(target), stripSlash(source), stripSlash(fixed)
+	toFixed, _, err := b.lookup(fixed, source, sourceTime)
+	if err != nil {
+		return TransformStamped{}, err
+	}
+	toTarget, stamp, err := b.lookup(target, fixed, targetTime)
+	if err != nil {
+		return TransformStamped{}, err
+	}
+	return TransformStamped{Stamp: stamp, FrameID: target, ChildFrameID: source, Transform: toTarget.Mul(toFixed)}, nil
+}
+
+func (b *defaultBuffer) CanTransform(target, source string, t ros.Time) bool {
+	_, err := b.LookupTransform(target, source, t)
+	return err == nil
+}
+
+func (b *defaultBuffer) CanTransformFull(target string, targetTime ros.Time, source string, sourceTime ros.Time, fixed string) bool {
+	_, err := b.LookupTransformFull(target, targetTime, source, sourceTime, fixed)
+	return err == nil
+}
+
+func (b *defaultBuffer) WaitForTransform(target, source string, t ros.Time, timeout time.Duration) (TransformStamped, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		b.mutex.Lock()
+		result, err := b.lookupTransform(target, source, t)
+		updated := b.updated
+		b.mutex.Unlock()
+		if err == nil {
+			return result, nil
+		}
+		select {
+		case <-updated:
+		case <-timer.C:
+			return TransformStamped{}, &TimeoutError{fmt.Sprintf("tf2: timed out after %v waiting for the transform from %s to %s: %v", timeout, source, target, err)}
+		}
+	}
+}
+
+func (b *defaultBuffer) checkFrame(frame, argument string) error {
+	if frame == "" {
+		return &LookupError{fmt.Sprintf("tf2: empty %s frame", argument)}
+	}
+	if !b.known[frame] {
+		return &LookupError{fmt.Sprintf("tf2: %s frame %s does not exist", argument, frame)}
+	}
+	return nil
+}
+
+// lookup returns the transform from source to target at t, and t or the
+// latest common time of the frames when t is zero.
+func (b *defaultBuffer) lookup(target, source string, t ros.Time) (Transform, ros.Time, error) {
+	if err := b.checkFrame(target, "target"); err != nil {
+		return Transform{}, t, err
+	}
+	if err := b.checkFrame(source, "source"); err != nil {
+		return Transform{}, t, err
+	}
+	if target == source {
+		return IdentityTransform, t, nil
+	}
+	if t.IsZero() {
+		var err error
+		if t, err = b.latestCommonTime(target, source); err != nil {
+			return Transform{}, t, err
+		}
+	}
+
+	// The transforms from source to its ancestors, until one fails.
+	ancestors := map[string]Transform{source: IdentityTransform}
+	var sourceErr error
+	frame, transform := source, IdentityTransform
+	for depth := 0; ; depth++ {
+		cache, ok := b.caches[frame]
+		if !ok {
+			break
+		}
+		if depth > maxDepth {
+			return Transform{}, t, &LookupError{fmt.Sprintf("tf2: the tree of frame %s has a loop", source)}
+		}
+		parent, err := cache.at(t, frame)
+		if err != nil {
+			sourceErr = err
+			break
+		}
+		transform = parent.Transform.Mul(transform)
+		frame = parent.FrameID
+		ancestors[frame] = transform
+		if frame == target {
+			return transform, t, nil
+		}
+	}
+
+	// The transforms from target to its ancestors, until one is an ancestor
+	// of source.
+	frame, transform = target, IdentityTransform
+	for depth := 0; ; depth++ {
+		if toSource, ok := ancestors[frame]; ok {
+			return transform.Inverse().Mul(toSource), t, nil
+		}
+		cache, ok := b.caches[frame]
+		if !ok {
+			break
+		}
+		if depth > maxDepth {
+			return Transform{}, t, &LookupError{fmt.Sprintf("tf2: the tree of frame %s has a loop", target)}
+		}
+		parent, err := cache.at(t, frame)
+		if err != nil {
+			return Transform{}, t, err
+		}
+		transform = parent.Transform.Mul(transform)
+		frame = parent.FrameID
+	}
+	if sourceErr != nil {
+		return Transform{}, t, sourceErr
+	}
+	return Transform{}, t, &ConnectivityError{fmt.Sprintf("tf2: could not find a connection between %s and %s because they are not part of the same tree", target, source)}
+}
+
+// latestCommonTime returns the latest time at which all the transforms
+// between source and target are available, or zero when they are static.
+func (b *defaultBuffer) latestCommonTime(target, source string) (ros.Time, error) {
+	type link struct {
+		stamp  ros.Time
+		static bool
+	}
+	visited := map[string]int{source: 0}
+	var sourceLinks []link
+	for frame := source; len(sourceLinks) <= maxDepth; {
+		cache, ok := b.caches[frame]
+		if !ok {
+			break
+		}
+		latest := cache.latest()
+		sourceLinks = append(sourceLinks, link{latest.Stamp, cache.static})
+		frame = latest.FrameID
+		if _, ok := visited[frame]; ok {
+			break
+		}
+		visited[frame] = len(sourceLinks)
+	}
+	var targetLinks []link
+	for frame := target; len(targetLinks) <= maxDepth; {
+		if n, ok := visited[frame]; ok {
+			var common ros.Time
+			for _, l := range append(sourceLinks[:n:n], targetLinks...) {
+				if !l.static && (common.IsZero() || l.stamp.Cmp(common) < 0) {
+					common = l.stamp
+				}
+			}
+			return common, nil
+		}
+		cache, ok := b.caches[frame]
+		if !ok {
+			break
+		}
+		latest := cache.latest()
+		targetLinks = append(targetLinks, link{latest.Stamp, cache.static})
+		frame = latest.FrameID
+	}
+	return ros.Time{}, &ConnectivityError{fmt.Sprintf("tf2: could not find a connection between %s and %s because they are not part of the same tree", target, source)}
+}
+
+// frameCache keeps the transforms of a frame to its parent sorted by time.
+// Static frames have a single transform.
+type frameCache struct {
+	static     bool
+	transforms []TransformStamped
+}
+
+func (c *frameCache) insert(t TransformStamped, cacheTime time.Duration) error {
+	if c.static {
+		c.transforms = []TransformStamped{t}
+		return nil
+	}
+	stamp := t.Stamp.ToNSec()
+	if n := len(c.transforms); n > 0 {
+		latest := c.transforms[n-1].Stamp
+		if latest.ToNSec() > stamp+uint64(cacheTime) {
+			return fmt.Errorf("tf2: transform from %s to %s at %s is older than the cache, which ends at %s", t.ChildFrameID, t.FrameID, formatTime(t.Stamp), formatTime(latest))
+		}
+	}
+	i := sort.Search(len(c.transforms), func(i int) bool { return c.transforms[i].Stamp.ToNSec() >= stamp })
+	if i < len(c.transforms) && c.transforms[i].Stamp.ToNSec() == stamp {
+		c.transforms[i] = t
+	} else {
+		c.transforms = append(c.transforms, TransformStamped{})
+		copy(c.transforms[i+1:], c.transforms[i:])
+		c.transforms[i] = t
+	}
+	latest := c.transforms[len(c.transforms)-1].Stamp
+	oldest := sort.Search(len(c.transforms), func(i int) bool { return c.transforms[i].Stamp.ToNSec()+uint64(cacheTime) >= latest.ToNSec() })
+	c.transforms = c.transforms[oldest:]
+	return nil
+}
+
+func (c *frameCache) latest() TransformStamped {
+	return c.transforms[len(c.transforms)-1]
+}
+
+// at returns the transform of frame at t, interpolated between the
+// transforms before and after it.
+func (c *frameCache) at(t ros.Time, frame string) (TransformStamped, error) {
+	if c.static {
+		result := c.transforms[0]
+		result.Stamp = t
+		return result, nil
+	}
+	first, last := c.transforms[0], c.latest()
+	if t.Cmp(first.Stamp) < 0 {
+		return TransformStamped{}, &ExtrapolationError{fmt.Sprintf("tf2: lookup would require extrapolation into the past: requested time %s but the earliest data of %s is at %s", formatTime(t), frame, formatTime(first.Stamp))}
+	}
+	if t.Cmp(last.Stamp) > 0 {
+		return TransformStamped{}, &ExtrapolationError{fmt.Sprintf("tf2: lookup would require extrapolation into the future: requested time %s but the latest data of %s is at %s", formatTime(t), frame, formatTime(last.Stamp))}
+	}
+	stamp := t.ToNSec()
+	i := sort.Search(len(c.transforms), func(i int) bool { return c.transforms[i].Stamp.ToNSec() >= stamp })
+	after := c.transforms[i]
+	if after.Stamp.ToNSec() == stamp {
+		return after, nil
+	}
+	before := c.transforms[i-1]
+	// The parent changed, so there is nothing to interpolate.
+	if before.FrameID != after.FrameID {
+		return before, nil
+	}
+	start, end := before.Stamp.ToNSec(), after.Stamp.ToNSec()
+	ratio := float64(stamp-start) / float64(end-start)
+	result := before
+	result.Stamp = t
+	result.Transform = before.Transform.Interpolate(after.Transform, ratio)
+	return result, nil
+}
@@ -0,0 +1,46 @@
+package tf2
+
+import (
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// TransformListener adds the transforms published on /tf and /tf_static to
+// a buffer.
+type TransformListener interface {
+	Shutdown()
+}
+
+type defaultTransformListener struct {
+	tf       ros.Subscriber
+	tfStatic ros.Subscriber
+}
+
+// NewTransformListener subscribes node to /tf and /tf_static and adds the
+// received transforms to buffer.
+func NewTransformListener(node ros.Node, buffer Buffer) TransformListener {
+	logger := node.Logger()
+	callback := func(static bool) func(msg *dynamic.Message, event ros.MessageEvent) {
+		return func(msg *dynamic.Message, event ros.MessageEvent) {
+			transforms, err := TransformsOf(msg)
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			for _, t := range transforms {
+				if err := buffer.SetTransform(t, static); err != nil {
+					logger.Warnf("ignoring transform from %s: %v", event.PublisherName, err)
+				}
+			}
+		}
+	}
+	return &defaultTransformListener{
+		tf:       node.NewSubscriber("/tf", TFMessageType, callback(false)),
+		tfStatic: node.NewSubscriber("/tf_static", TFMessageType, callback(true)),
+	}
+}
+
+func (l *defaultTransformListener) Shutdown() {
+	l.tf.Shutdown()
+	l.tfStatic.Shutdown()
+}
@@ -0,0 +1,94 @@
+package tf2
+
+import (
+	"fmt"
+
+	"github.com/fetchrobotics/rosgo/dynamic"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+const tfMessageDefinition = `geometry_msgs/TransformStamped[] transforms
+================================================================================
+MSG: geometry_msgs/TransformStamped
+Header header
+string child_frame_id
+Transform transform
+================================================================================
+MSG: std_msgs/Header
+uint32 seq
+time stamp
+string frame_id
+================================================================================
+MSG: geometry_msgs/Transform
+Vector3 translation
+Quaternion rotation
+================================================================================
+MSG: geometry_msgs/Vector3
+float64 x
+float64 y
+float64 z
+================================================================================
+MSG: geometry_msgs/Quaternion
+float64 x
+float64 y
+float64 z
+float64 w
+`
+
+// TFMessageType is the tf2_msgs/TFMessage type of /tf and /tf_static.
+var TFMessageType = newTFMessageType()
+
+func newTFMessageType() *dynamic.MessageType {
+	msgType, err := dynamic.NewContext(nil).AddDefinition("tf2_msgs/TFMessage", tfMessageDefinition)
+	if err != nil {
+		panic(err)
+	}
+	return msgType
+}
+
+// NewTFMessage returns a tf2_msgs/TFMessage of transforms.
+func NewTFMessage(transforms []TransformStamped) *dynamic.Message {
+	stampedType := TFMessageType.FieldType("transforms")
+	msg := TFMessageType.New()
+	values := make([]interface{}, len(transforms))
+	for i, t := range transforms {
+		stamped := stampedType.New()
+		header := stamped.Data["header"].(*dynamic.Message)
+		header.Data["stamp"] = t.Stamp
+		header.Data["frame_id"] = t.FrameID
+		stamped.Data["child_frame_id"] = t.ChildFrameID
+		transform := stamped.Data["transform"].(*dynamic.Message)
+		v, q := t.Transform.Translation, t.Transform.Rotation
+		transform.Data["translation"].(*dynamic.Message).Data = map[string]interface{}{"x": v.X, "y": v.Y, "z": v.Z}
+		transform.Data["rotation"].(*dynamic.Message).Data = map[string]interface{}{"x": q.X, "y": q.Y, "z": q.Z, "w": q.W}
+		values[i] = stamped
+	}
+	msg.Data["transforms"] = values
+	return msg
+}
+
+// TransformsOf returns the transforms of a tf2_msgs/TFMessage.
+func TransformsOf(msg *dynamic.Message) ([]TransformStamped, error) {
+	if msg.Type().Name() != TFMessageType.Name() {
+		return nil, fmt.Errorf("tf2: expected %s but %s", TFMessageType.Name(), msg.Type().Name())
+	}
+	values, _ := msg.Data["transforms"].([]interface{})
+	transforms := make([]TransformStamped, 0, len(values))
+	for _, value := range values {
+		stamped := value.(*dynamic.Message)
+		header := stamped.Data["header"].(*dynamic.Message)
+		transform := stamped.Data["transform"].(*dynamic.Message)
+		v := transform.Data["translation"].(*dynamic.Message).Data
+		q := transform.Data["rotation"].(*dynamic.Message).Data
+		transforms = append(transforms, TransformStamped{
+			Stamp:        header.Data["stamp"].(ros.Time),
+			FrameID:      header.Data["frame_id"].(string),
+			ChildFrameID: stamped.Data["child_frame_id"].(string),
+			Transform: Transform{
+				Translation: Vector3{v["x"].(float64), v["y"].(float64), v["z"].(float64)},
+				Rotation:    Quaternion{q["x"].(float64), q["y"].(float64), q["z"].(float64), q["w"].(float64)},
+			},
+		})
+	}
+	return transforms, nil
+}
@@ -0,0 +1,166 @@
+// Package tf2 keeps track of coordinate frames over time, like the tf2 ROS
+// packages.
+//
+// A Buffer stores the transforms between frames for a while, and looks up
+// the transform between any two frames of the same tree at any stored time,
+// interpolating between the received transforms. A TransformListener fills
+// a buffer with the transforms published on /tf and /tf_static, where
+// TransformBroadcaster and StaticTransformBroadcaster publish them.
+package tf2
+
+import (
+	"math"
+
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+// Vector3 is a translation or a point.
+type Vector3 struct {
+	X, Y, Z float64
+}
+
+// Add returns v + o.
+func (v Vector3) Add(o Vector3) Vector3 {
+	return Vector3{v.X + o.X, v.Y + o.Y, v.Z + o.Z}
+}
+
+// Scale returns v * s.
+func (v Vector3) Scale(s float64) Vector3 {
+	return Vector3{v.X * s, v.Y * s, v.Z * s}
+}
+
+// Lerp interpolates linearly between v, at ratio 0, and o, at ratio 1.
+func (v Vector3) Lerp(o Vector3, ratio float64) Vector3 {
+	return v.Scale(1 - ratio).Add(o.Scale(ratio))
+}
+
+// Quaternion is a rotation.
+type Quaternion struct {
+	X, Y, Z, W float64
+}
+
+// IdentityQuaternion is the rotation by 0 radians.
+var IdentityQuaternion = Quaternion{0, 0, 0, 1}
+
+// NewQuaternionFromRPY returns the rotation by roll around X, then pitch
+// around Y and yaw around Z, in radians.
+func NewQuaternionFromRPY(roll, pitch, yaw float64) Quaternion {
+	sr, cr := math.Sincos(roll / 2)
+	sp, cp := math.Sincos(pitch / 2)
+	sy, cy := math.Sincos(yaw / 2)
+	return Quaternion{
+		X: sr*cp*cy - cr*sp*sy,
+		Y: cr*sp*cy + sr*cp*sy,
+		Z: cr*cp*sy - sr*sp*cy,
+		W: cr*cp*cy + sr*sp*sy,
+	}
+}
+
+// RPY returns the roll, pitch and yaw of the rotation.
+func (q Quaternion) RPY() (roll, pitch, yaw float64) {
+	roll = math.Atan2(2*(q.W*q.X+q.Y*q.Z), 1-2*(q.X*q.X+q.Y*q.Y))
+	sinPitch := 2 * (q.W*q.Y - q.Z*q.X)
+	if sinPitch >= 1 {
+		pitch = math.Pi / 2
+	} else if sinPitch <= -1 {
+		pitch = -math.Pi / 2
+	} else {
+		pitch = math.Asin(sinPitch)
+	}
+	yaw = math.Atan2(2*(q.W*q.Z+q.X*q.Y), 1-2*(q.Y*q.Y+q.Z*q.Z))
+	return roll, pitch, yaw
+}
+
+// Mul returns the rotation by o followed by q.
+func (q Quaternion) Mul(o Quaternion) Quaternion {
+	return Quaternion{
+		X: q.W*o.X + q.X*o.W + q.Y*o.Z - q.Z*o.Y,
+		Y: q.W*o.Y - q.X*o.Z + q.Y*o.W + q.Z*o.X,
+		Z: q.W*o.Z + q.X*o.Y - q.Y*o.X + q.Z*o.W,
+		W: q.W*o.W - q.X*o.X - q.Y*o.Y - q.Z*o.Z,
+	}
+}
+
+// Inverse returns the opposite rotation of a unit quaternion.
+func (q Quaternion) Inverse() Quaternion {
+	return Quaternion{-q.X, -q.Y, -q.Z, q.W}
+}
+
+// Normalize returns q with a length of 1.
+func (q Quaternion) Normalize() Quaternion {
+	n := math.Sqrt(q.X*q.X + q.Y*q.Y + q.Z*q.Z + q.W*q.W)
+	if n == 0 {
+		return IdentityQuaternion
+	}
+	return Quaternion{q.X / n, q.Y / n, q.Z / n, q.W / n}
+}
+
+// Rotate returns v rotated by q.
+func (q Quaternion) Rotate(v Vector3) Vector3 {
+	r := q.Mul(Quaternion{v.X, v.Y, v.Z, 0}).Mul(q.Inverse())
+	return Vector3{r.X, r.Y, r.Z}
+}
+
+// Slerp interpolates spherically between q, at ratio 0, and o, at ratio 1,
+// along the shortest path.
+func (q Quaternion) Slerp(o Quaternion, ratio float64) Quaternion {
+	dot := q.X*o.X + q.Y*o.Y + q.Z*o.Z + q.W*o.W
+	if dot < 0 {
+		o = Quaternion{-o.X, -o.Y, -o.Z, -o.W}
+		dot = -dot
+	}
+	a, b := 1-ratio, ratio
+	// Nearly identical rotations are interpolated linearly.
+	if dot < 0.9995 {
+		theta := math.Acos(dot)
+		sin := math.Sin(theta)
+		a = math.Sin((1-ratio)*theta) / sin
+		b = math.Sin(ratio*theta) / sin
+	}
+	return Quaternion{
+		a*q.X + b*o.X,
+		a*q.Y + b*o.Y,
+		a*q.Z + b*o.Z,
+		a*q.W + b*o.W,
+	}.Normalize()
+}
+
+// Transform is a rotation followed by a translation.
+type Transform struct {
+	Translation Vector3
+	Rotation    Quaternion
+}
+
+// IdentityTransform leaves points unchanged.
+var IdentityTransform = Transform{Rotation: IdentityQuaternion}
+
+// Apply returns the point v transformed.
+func (t Transform) Apply(v Vector3) Vector3 {
+	return t.Rotation.Rotate(v).Add(t.Translation)
+}
+
+// Mul returns the transform applying o then t.
+func (t Transform) Mul(o Transform) Transform {
+	return Transform{t.Apply(o.Translation), t.Rotation.Mul(o.Rotation).Normalize()}
+}
+
+// Inverse returns the opposite transform.
+func (t Transform) Inverse() Transform {
+	inverse := t.Rotation.Inverse()
+	return Transform{inverse.Rotate(t.Translation).Scale(-1), inverse}
+}
+
+// Interpolate interpolates between t, at ratio 0, and o, at ratio 1.
+func (t Transform) Interpolate(o Transform, ratio float64) Transform {
+	return Transform{t.Translation.Lerp(o.Translation, ratio), t.Rotation.Slerp(o.Rotation, ratio)}
+}
+
+// TransformStamped is the transform from the child frame to the parent
+// frame at a time. Applied to coordinates in the child frame, it gives the
+// coordinates in the parent frame.
+type TransformStamped struct {
+	Stamp        ros.Time
+	FrameID      string
+	ChildFrameID string
+	Transform    Transform
+}
@@ -0,0 +1,279 @@
+package tf2
+
+import (
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fetchrobotics/rosgo/master"
+	"github.com/fetchrobotics/rosgo/ros"
+)
+
+const epsilon = 1e-9
+
+func near(a, b Vector3) bool {
+	return math.Abs(a.X-b.X) < epsilon && math.Abs(a.Y-b.Y) < epsilon && math.Abs(a.Z-b.Z) < epsilon
+}
+
+func transform(x, y, z, yaw float64) Transform {
+	return Transform{Vector3{x, y, z}, NewQuaternionFromRPY(0, 0, yaw)}
+}
+
+func stamped(sec uint32, parent, child string, t Transform) TransformStamped {
+	return TransformStamped{Stamp: ros.NewTime(sec, 0), FrameID: parent, ChildFrameID: child, Transform: t}
+}
+
+func TestQuaternion(t *testing.T) {
+	q := NewQuaternionFromRPY(0.1, -0.2, 0.3)
+	if roll, pitch, yaw := q.RPY(); math.Abs(roll-0.1) > epsilon || math.Abs(pitch+0.2) > epsilon || math.Abs(yaw-0.3) > epsilon {
+		t.Errorf("unexpected roll, pitch and yaw %v, %v, %v", roll, pitch, yaw)
+	}
+	if v := NewQuaternionFromRPY(0, 0, math.Pi/2).Rotate(Vector3{1, 0, 0}); !near(v, Vector3{0, 1, 0}) {
+		t.Errorf("unexpected rotated vector %v", v)
+	}
+	half := IdentityQuaternion.Slerp(NewQuaternionFromRPY(0, 0, math.Pi/2), 0.5)
+	if _, _, yaw := half.RPY(); math.Abs(yaw-math.Pi/4) > epsilon {
+		t.Errorf("unexpected interpolated yaw %v", yaw)
+	}
+	// The shortest path from 170 to -170 degrees goes through 180.
+	half = NewQuaternionFromRPY(0, 0, 170*math.Pi/180).Slerp(NewQuaternionFromRPY(0, 0, -170*math.Pi/180), 0.5)
+	if _, _, yaw := half.RPY(); math.Abs(math.Abs(yaw)-math.Pi) > 1e-6 {
+		t.Errorf("unexpected interpolated yaw %v", yaw)
+	}
+
+	tf := transform(1, 2, 3, 0.5)
+	if v := tf.Mul(tf.Inverse()).Apply(Vector3{4, 5, 6}); !near(v, Vector3{4, 5, 6}) {
+		t.Errorf("unexpected identity %v", v)
+	}
+}
+
+func TestBuffer(t *testing.T) {
+	b := NewBuffer()
+	set := func(tf TransformStamped, static bool) {
+		if err := b.SetTransform(tf, static); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set(stamped(10, "map", "odom", transform(1, 0, 0, 0)), false)
+	set(stamped(12, "map", "odom", transform(3, 0, 0, 0)), false)
+	set(stamped(10, "/odom", "base_link", transform(0, 0, 0, 0)), false)
+	set(stamped(14, "odom", "base_link", transform(0, 0, 0, math.Pi/2)), false)
+	set(stamped(0, "base_link", "laser", transform(0.5, 0, 0, 0)), true)
+	set(stamped(0, "map", "marker", transform(0, 5, 0, 0)), true)
+
+	if want := []string{"base_link", "laser", "map", "marker", "odom"}; !reflect.DeepEqual(b.Frames(), want) {
+		t.Errorf("expected frames %v but %v", want, b.Frames())
+	}
+
+	// The laser position in map, where odom is at x and base_link turned
+	// yaw.
+	laser := func(x, yaw float64) Vector3 {
+		return Vector3{x + 0.5*math.Cos(yaw), 0.5 * math.Sin(yaw), 0}
+	}
+	// At 11, odom is at x=2 and base_link turned 22.5 degrees.
+	tf, err := b.LookupTransform("map", "/laser", ros.NewTime(11, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at11 := laser(2, math.Pi/8)
+	if v := tf.Transform.Apply(Vector3{}); !near(v, at11) {
+		t.Errorf("unexpected laser position %v", v)
+	}
+	if tf.FrameID != "map" || tf.ChildFrameID != "laser" || tf.Stamp != ros.NewTime(11, 0) {
+		t.Errorf("unexpected header %v", tf)
+	}
+	inverse, err := b.LookupTransform("laser", "map", ros.NewTime(11, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := inverse.Transform.Apply(at11); !near(v, Vector3{}) {
+		t.Errorf("unexpected inverse %v", v)
+	}
+	tf, err = b.LookupTransform("marker", "laser", ros.NewTime(11, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := tf.Transform.Apply(Vector3{}); !near(v, at11.Add(Vector3{0, -5, 0})) {
+		t.Errorf("unexpected laser position in marker %v", v)
+	}
+
+	// The latest common time is 12, the latest time of odom.
+	tf, err = b.LookupTransform("map", "base_link", ros.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tf.Stamp != ros.NewTime(12, 0) {
+		t.Errorf("unexpected latest common time %v", tf.Stamp)
+	}
+	if tf, err = b.LookupTransform("laser", "base_link", ros.Time{}); err != nil || tf.Stamp != (ros.Time{}) {
+		t.Errorf("unexpected static lookup %v, %v", tf, err)
+	}
+
+	if _, err := b.LookupTransform("map", "laser", ros.NewTime(13, 0)); err == nil {
+		t.Error("expected an error when extrapolating into the future")
+	} else if _, ok := err.(*ExtrapolationError); !ok {
+		t.Errorf("expected an extrapolation error but %v", err)
+	}
+	if _, err := b.LookupTransform("map", "laser", ros.NewTime(9, 0)); err == nil {
+		t.Error("expected an error when extrapolating into the past")
+	}
+	if _, err := b.LookupTransform("map", "camera", ros.Time{}); err == nil {
+		t.Error("expected an error for an unknown frame")
+	} else if _, ok := err.(*LookupError); !ok {
+		t.Errorf("expected a lookup error but %v", err)
+	}
+	set(stamped(0, "world", "camera", IdentityTransform), true)
+	if _, err := b.LookupTransform("map", "camera", ros.Time{}); err == nil {
+		t.Error("expected an error for an unconnected frame")
+	} else if _, ok := err.(*ConnectivityError); !ok {
+		t.Errorf("expected a connectivity error but %v", err)
+	}
+	if !b.CanTransform("odom", "laser", ros.NewTime(13, 0)) || b.CanTransform("map", "laser", ros.NewTime(13, 0)) {
+		t.Error("unexpected CanTransform")
+	}
+
+	// Where the laser was at 14 in the frame of the laser at 12, with odom
+	// then map fixed.
+	motion := func(from, to Vector3, yaw float64) Vector3 {
+		return NewQuaternionFromRPY(0, 0, -yaw).Rotate(to.Add(from.Scale(-1)))
+	}
+	tf, err = b.LookupTransformFull("laser", ros.NewTime(12, 0), "laser", ros.NewTime(14, 0), "odom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := motion(laser(0, math.Pi/4), laser(0, math.Pi/2), math.Pi/4)
+	if v := tf.Transform.Apply(Vector3{}); !near(v, want) {
+		t.Errorf("expected the laser motion in odom %v but %v", want, v)
+	}
+	set(stamped(14, "map", "odom", transform(4, 0, 0, 0)), false)
+	tf, err = b.LookupTransformFull("laser", ros.NewTime(12, 0), "laser", ros.NewTime(14, 0), "map")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = motion(laser(3, math.Pi/4), laser(4, math.Pi/2), math.Pi/4)
+	if v := tf.Transform.Apply(Vector3{}); !near(v, want) {
+		t.Errorf("expected the laser motion in map %v but %v", want, v)
+	}
+	if !b.CanTransformFull("laser", ros.NewTime(12, 0), "laser", ros.NewTime(14, 0), "map") {
+		t.Error("unexpected CanTransformFull")
+	}
+
+	if err := b.SetTransform(stamped(1, "map", "map", IdentityTransform), false); err == nil {
+		t.Error("expected an error for a transform to itself")
+	}
+	if err := b.SetTransform(stamped(1, "map", "odom", IdentityTransform), false); err == nil {
+		t.Error("expected an error for a transform older than the cache")
+	}
+	b.Clear()
+	if len(b.Frames()) != 0 {
+		t.Errorf("unexpected frames after clear %v", b.Frames())
+	}
+}
+
+func TestBufferCacheTime(t *testing.T) {
+	b := NewBuffer(BufferCacheTime(2 * time.Second))
+	for sec := uint32(1); sec <= 5; sec++ {
+		if err := b.SetTransform(stamped(sec, "map", "odom", IdentityTransform), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b.CanTransform("map", "odom", ros.NewTime(2, 0)) || !b.CanTransform("map", "odom", ros.NewTime(3, 0)) {
+		t.Error("expected the transforms older than 2s to be dropped")
+	}
+}
+
+func TestWaitForTransform(t *testing.T) {
+	b := NewBuffer()
+	start := time.Now()
+	if _, err := b.WaitForTransform("map", "odom", ros.Time{}, 50*time.Millisecond); err == nil {
+		t.Error("expected a timeout")
+	} else if _, ok := err.(*TimeoutError); !ok {
+		t.Errorf("expected a timeout error but %v", err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("returned before the timeout")
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.SetTransform(stamped(1, "map", "base_link", IdentityTransform), false)
+		time.Sleep(10 * time.Millisecond)
+		b.SetTransform(stamped(1, "base_link", "odom", IdentityTransform), false)
+	}()
+	if tf, err := b.WaitForTransform("map", "odom", ros.NewTime(1, 0), 5*time.Second); err != nil || tf.Stamp != ros.NewTime(1, 0) {
+		t.Errorf("unexpected transform %v, %v", tf, err)
+	}
+}
+
+func TestTFMessage(t *testing.T) {
+	if md5 := TFMessageType.MD5Sum(); md5 != "94810edda583a504dfda3829e70d7eec" {
+		t.Errorf("unexpected md5sum %s", md5)
+	}
+	transforms := []TransformStamped{
+		stamped(1, "map", "odom", transform(1, 2, 3, 0.5)),
+		stamped(2, "odom", "base_link", IdentityTransform),
+	}
+	got, err := TransformsOf(NewTFMessage(transforms))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, transforms) {
+		t.Errorf("expected %v but %v", transforms, got)
+	}
+}
+
+func TestListener(t *testing.T) {
+	m, err := master.NewMaster("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Shutdown()
+	rosArgs := []string{"__master:=" + m.URI(), "__hostname:=127.0.0.1"}
+	node, err := ros.NewNode("/tf_test", rosArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		node.Spin()
+	}()
+	defer func() {
+		node.Shutdown()
+		wg.Wait()
+	}()
+
+	// The static transform is sent before the listener starts, and
+	// received from the latched publisher.
+	static := NewStaticTransformBroadcaster(node)
+	defer static.Shutdown()
+	static.SendTransform(stamped(0, "base_link", "laser", transform(0.5, 0, 0, 0)))
+	static.SendTransform(stamped(0, "base_link", "camera", transform(0, 0, 1, 0)))
+
+	buffer := NewBuffer()
+	listener := NewTransformListener(node, buffer)
+	defer listener.Shutdown()
+	broadcaster := NewTransformBroadcaster(node)
+	defer broadcaster.Shutdown()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !buffer.CanTransform("map", "laser", ros.NewTime(1, 0)) {
+		if time.Now().After(deadline) {
+			t.Fatal("the transforms were not received")
+		}
+		broadcaster.SendTransform(stamped(1, "map", "base_link", transform(1, 0, 0, 0)))
+		time.Sleep(10 * time.Millisecond)
+	}
+	tf, err := buffer.LookupTransform("map", "laser", ros.NewTime(1, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := tf.Transform.Apply(Vector3{}); !near(v, Vector3{1.5, 0, 0}) {
+		t.Errorf("unexpected laser position %v", v)
+	}
+	if !buffer.CanTransform("laser", "camera", ros.Time{}) {
+		t.Error("expected both static transforms to be received")
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 func xmlEscape(s string) string {
@@ -479,6 +480,12 @@ func parseResponse(d *xml.Decoder) (ok bool, result interface{}, e error) {
 // Args:
 //   url string: URL of the remote host
 func Call(url string, method string, args ...interface{}) (res interface{}, e error) {
+	return CallTimeout(url, 0, method, args...)
+}
+
+// CallTimeout calls a XMLRPC API like Call but fails when the call takes
+// longer than timeout. A zero timeout means no timeout.
+func CallTimeout(url string, timeout time.Duration, method string, args ...interface{}) (res interface{}, e error) {
 	var buffer bytes.Buffer
 	e = emitRequest(&buffer, method, args...)
 	if e != nil {
@@ -486,7 +493,11 @@ func Call(url string, method string, args ...interface{}) (res interface{}, e er
 		return
 	}
 	var r *http.Response
-	r, e = http.Post(url, "text/xml", &buffer)
+	client := http.DefaultClient
+	if timeout > 0 {
+		client = &http.Client{Timeout: timeout}
+	}
+	r, e = client.Post(url, "text/xml", &buffer)
 	if e != nil {
 		e = fmt.Errorf("Sending request failed for %v", e)
 		return
@@ -0,0 +1,894 @@
+// Simple YAML decoder/encoder for go
+//
+// Only the subset of YAML used by ROS parameter files is supported: block and
+// flow collections, plain/quoted/block scalars, comments, anchors and aliases,
+// merge keys and tags. Documents are decoded into generic values:
+// map[string]interface{}, []interface{}, string, int, float64, bool, []byte
+// and nil.
+package yaml
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TagFunc converts the raw text of a scalar carrying a local tag
+// (e.g. `!degrees 90`) into a value.
+type TagFunc func(raw string) (interface{}, error)
+
+// SyntaxError reports a malformed document.
+type SyntaxError struct {
+	Line    int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("yaml: line %d: %s", e.Line, e.Message)
+}
+
+// Unmarshal decodes a single YAML document.
+func Unmarshal(data []byte) (interface{}, error) {
+	return UnmarshalWithTags(data, nil)
+}
+
+// UnmarshalWithTags decodes a single YAML document. Scalars tagged with one of
+// the keys of tags are converted by the corresponding function.
+func UnmarshalWithTags(data []byte, tags map[string]TagFunc) (interface{}, error) {
+	p := newParser(string(data), tags)
+	l := p.peek()
+	if l == nil {
+		return nil, nil
+	}
+	value, err := p.parseNode(l)
+	if err != nil {
+		return nil, err
+	}
+	if l := p.peek(); l != nil {
+		return nil, &SyntaxError{l.num, "unexpected content after document"}
+	}
+	return value, nil
+}
+
+type line struct {
+	num    int
+	indent int
+	text   string
+}
+
+type parser struct {
+	lines   []*line
+	pos     int
+	tags    map[string]TagFunc
+	anchors map[string]interface{}
+}
+
+func newParser(data string, tags map[string]TagFunc) *parser {
+	p := &parser{tags: tags, anchors: make(map[string]interface{})}
+	data = strings.Replace(data, "\r\n", "\n", -1)
+	started := false
+	for i, raw := range strings.Split(data, "\n") {
+		raw = strings.TrimRight(raw, " \t\r")
+		if !started && strings.HasPrefix(raw, "%") {
+			continue
+		}
+		if raw == "---" || strings.HasPrefix(raw, "--- ") {
+			if started {
+				// Only the first document is read.
+				break
+			}
+			started = true
+			raw = strings.TrimSpace(raw[3:])
+		} else if raw == "..." {
+			break
+		}
+		started = true
+		trimmed := strings.TrimLeft(raw, " ")
+		p.lines = append(p.lines, &line{i + 1, len(raw) - len(trimmed), trimmed})
+	}
+	return p
+}
+
+// peek returns the next line holding content, skipping blank and comment lines.
+func (p *parser) peek() *line {
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if len(l.text) > 0 && l.text[0] != '#' {
+			return l
+		}
+		p.pos++
+	}
+	return nil
+}
+
+func (p *parser) errorf(l *line, format string, args ...interface{}) error {
+	num := 0
+	if l != nil {
+		num = l.num
+	}
+	return &SyntaxError{num, fmt.Sprintf(format, args...)}
+}
+
+func (p *parser) parseNode(l *line) (interface{}, error) {
+	if strings.HasPrefix(l.text, "\t") {
+		return nil, p.errorf(l, "tabs are not allowed for indentation")
+	}
+	text := stripComment(l.text)
+	if isSeqEntry(text) {
+		return p.parseSequence(l.indent)
+	}
+	if _, _, ok := splitMapEntry(text); ok {
+		return p.parseMapping(l.indent)
+	}
+	p.pos++
+	return p.parseValue(l, text, l.indent-1, false)
+}
+
+func (p *parser) parseMapping(indent int) (interface{}, error) {
+	m := make(map[string]interface{})
+	for {
+		l := p.peek()
+		if l == nil || l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, "unexpected indentation")
+		}
+		text := stripComment(l.text)
+		key, rest, ok := splitMapEntry(text)
+		if !ok {
+			if isSeqEntry(text) {
+				return nil, p.errorf(l, "unexpected sequence entry in mapping")
+			}
+			return nil, p.errorf(l, "expected a mapping key")
+		}
+		p.pos++
+		value, err := p.parseValue(l, rest, indent, true)
+		if err != nil {
+			return nil, err
+		}
+		if key == "<<" {
+			if err := merge(m, value); err != nil {
+				return nil, p.errorf(l, "%v", err)
+			}
+			continue
+		}
+		m[key] = value
+	}
+	return m, nil
+}
+
+func merge(m map[string]interface{}, value interface{}) error {
+	var sources []interface{}
+	if list, ok := value.([]interface{}); ok {
+		sources = list
+	} else {
+		sources = []interface{}{value}
+	}
+	for _, src := range sources {
+		sm, ok := src.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("merge key requires a mapping")
+		}
+		for k, v := range sm {
+			if _, exists := m[k]; !exists {
+				m[k] = v
+			}
+		}
+	}
+	return nil
+}
+
+func (p *parser) parseSequence(indent int) (interface{}, error) {
+	seq := []interface{}{}
+	for {
+		l := p.peek()
+		if l == nil || l.indent < indent {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.errorf(l, "unexpected indentation")
+		}
+		text := stripComment(l.text)
+		if !isSeqEntry(text) {
+			break
+		}
+		rest := strings.TrimLeft(text[1:], " ")
+		offset := len(text) - len(rest)
+		var item interface{}
+		var err error
+		if len(rest) == 0 {
+			p.pos++
+			item, err = p.parseNested(indent, false)
+		} else if _, _, ok := splitMapEntry(rest); ok || isSeqEntry(rest) {
+			// Compact nested collection such as "- key: value". The entry is
+			// re-read as if it started at the column of its content.
+			l.indent += offset
+			l.text = l.text[offset:]
+			item, err = p.parseNode(l)
+		} else {
+			p.pos++
+			item, err = p.parseValue(l, rest, indent, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seq = append(seq, item)
+	}
+	return seq, nil
+}
+
+// parseNested parses a block node on the following lines which belongs to a
+// parent at parentIndent.
+func (p *parser) parseNested(parentIndent int, allowSeq bool) (interface{}, error) {
+	l := p.peek()
+	if l == nil {
+		return nil, nil
+	}
+	if l.indent > parentIndent {
+		return p.parseNode(l)
+	}
+	if allowSeq && l.indent == parentIndent && isSeqEntry(stripComment(l.text)) {
+		return p.parseSequence(l.indent)
+	}
+	return nil, nil
+}
+
+// parseValue parses the value text found after "key:" or "- " on line l. The
+// cursor has already advanced past l.
+func (p *parser) parseValue(l *line, text string, parentIndent int, allowSeq bool) (interface{}, error) {
+	var anchor, tag string
+	for {
+		if strings.HasPrefix(text, "&") {
+			anchor, text = splitToken(text[1:])
+		} else if strings.HasPrefix(text, "!") {
+			tag, text = splitToken(text)
+		} else {
+			break
+		}
+	}
+
+	var value interface{}
+	var err error
+	switch {
+	case strings.HasPrefix(text, "*"):
+		name, rest := splitToken(text[1:])
+		if len(rest) > 0 {
+			return nil, p.errorf(l, "unexpected content after alias")
+		}
+		var ok bool
+		if value, ok = p.anchors[name]; !ok {
+			return nil, p.errorf(l, "unknown anchor '%s'", name)
+		}
+	case len(text) == 0:
+		value, err = p.parseNested(parentIndent, allowSeq)
+		if err == nil && tag != "" {
+			if s, ok := value.(string); ok || value == nil {
+				value, err = p.applyTag(l, tag, s)
+			}
+		}
+	case text[0] == '|' || text[0] == '>':
+		var s string
+		if s, err = p.parseBlockScalar(l, text, parentIndent); err == nil {
+			value, err = p.resolveScalar(l, tag, s, true)
+		}
+	case text[0] == '[' || text[0] == '{':
+		for flowDepth(text) > 0 {
+			next := p.nextRawLine()
+			if next == nil {
+				return nil, p.errorf(l, "unterminated flow collection")
+			}
+			text += " " + stripComment(next.text)
+		}
+		f := &flowParser{p: p, l: l, s: text}
+		if value, err = f.parse(); err == nil {
+			f.skipSpaces()
+			if f.i < len(f.s) {
+				err = p.errorf(l, "unexpected content after flow collection")
+			}
+		}
+	case text[0] == '"' || text[0] == '\'':
+		for !quoteClosed(text) {
+			next := p.nextRawLine()
+			if next == nil {
+				return nil, p.errorf(l, "unterminated quoted scalar")
+			}
+			if len(next.text) == 0 {
+				text += "\n"
+			} else if strings.HasSuffix(text, "\n") {
+				text += next.text
+			} else {
+				text += " " + next.text
+			}
+		}
+		var s string
+		var n int
+		if s, n, err = unquote(text); err == nil {
+			if rest := strings.TrimSpace(text[n:]); len(rest) > 0 {
+				return nil, p.errorf(l, "unexpected content after quoted scalar")
+			}
+			value, err = p.resolveScalar(l, tag, s, true)
+		}
+	default:
+		// Plain scalars may continue on more indented lines.
+		for {
+			start := p.pos
+			next := p.peek()
+			if next == nil || next.indent <= parentIndent || p.pos != start {
+				break
+			}
+			cont := stripComment(next.text)
+			if _, _, ok := splitMapEntry(cont); ok || isSeqEntry(cont) {
+				break
+			}
+			p.pos++
+			text += " " + cont
+		}
+		value, err = p.resolveScalar(l, tag, text, false)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if anchor != "" {
+		p.anchors[anchor] = value
+	}
+	return value, nil
+}
+
+// nextRawLine consumes the next line regardless of its content.
+func (p *parser) nextRawLine() *line {
+	if p.pos >= len(p.lines) {
+		return nil
+	}
+	l := p.lines[p.pos]
+	p.pos++
+	return l
+}
+
+func (p *parser) parseBlockScalar(l *line, header string, parentIndent int) (string, error) {
+	folded := header[0] == '>'
+	chomp := byte(0)
+	explicit := 0
+	for _, c := range header[1:] {
+		switch {
+		case c == '-' || c == '+':
+			chomp = byte(c)
+		case c >= '1' && c <= '9':
+			explicit = int(c - '0')
+		case c == ' ':
+		default:
+			return "", p.errorf(l, "invalid block scalar header '%s'", header)
+		}
+	}
+
+	indent := -1
+	if explicit > 0 {
+		indent = parentIndent + explicit
+		if parentIndent < 0 {
+			indent = explicit
+		}
+	}
+	var contents []string
+	for p.pos < len(p.lines) {
+		next := p.lines[p.pos]
+		if len(next.text) == 0 {
+			contents = append(contents, "")
+			p.pos++
+			continue
+		}
+		if indent < 0 {
+			if next.indent <= parentIndent {
+				break
+			}
+			indent = next.indent
+		}
+		if next.indent < indent {
+			break
+		}
+		contents = append(contents, strings.Repeat(" ", next.indent-indent)+next.text)
+		p.pos++
+	}
+
+	// Trailing blank lines are only kept by the "+" chomping indicator.
+	trailing := 0
+	for len(contents) > 0 && contents[len(contents)-1] == "" {
+		contents = contents[:len(contents)-1]
+		trailing++
+	}
+
+	var buf strings.Builder
+	for i, c := range contents {
+		switch {
+		case i == 0:
+			if folded && c == "" {
+				buf.WriteByte('\n')
+			}
+		case !folded:
+			buf.WriteByte('\n')
+		case c == "":
+			buf.WriteByte('\n')
+		case contents[i-1] == "":
+			// The line break before a run of empty lines is folded away
+			// unless it is next to a more indented line.
+			j := i - 1
+			for j >= 0 && contents[j] == "" {
+				j--
+			}
+			if j >= 0 && (contents[j][0] == ' ' || c[0] == ' ') {
+				buf.WriteByte('\n')
+			}
+		case contents[i-1][0] == ' ' || c[0] == ' ':
+			buf.WriteByte('\n')
+		default:
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(c)
+	}
+	s := buf.String()
+	if len(contents) > 0 {
+		switch chomp {
+		case '-':
+		case '+':
+			s += strings.Repeat("\n", trailing+1)
+		default:
+			s += "\n"
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) resolveScalar(l *line, tag string, s string, quoted bool) (interface{}, error) {
+	if tag != "" {
+		return p.applyTag(l, tag, s)
+	}
+	if quoted {
+		return s, nil
+	}
+	return resolvePlain(s), nil
+}
+
+func (p *parser) applyTag(l *line, tag string, s string) (interface{}, error) {
+	if fn, ok := p.tags[tag]; ok {
+		value, err := fn(s)
+		if err != nil {
+			return nil, p.errorf(l, "%s: %v", tag, err)
+		}
+		return value, nil
+	}
+	switch tag {
+	case "!", "!!str":
+		return s, nil
+	case "!!int", "!!float", "!!bool", "!!null":
+		value := resolvePlain(s)
+		ok := false
+		switch value.(type) {
+		case int:
+			ok = tag == "!!int" || tag == "!!float"
+			if tag == "!!float" {
+				value = float64(value.(int))
+			}
+		case float64:
+			ok = tag == "!!float"
+		case bool:
+			ok = tag == "!!bool"
+		case nil:
+			ok = tag == "!!null"
+		}
+		if !ok {
+			return nil, p.errorf(l, "cannot decode '%s' as %s", s, tag)
+		}
+		return value, nil
+	case "!!binary":
+		data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+		if err != nil {
+			return nil, p.errorf(l, "!!binary: %v", err)
+		}
+		return data, nil
+	}
+	return nil, p.errorf(l, "unknown tag '%s'", tag)
+}
+
+var (
+	intPattern   = regexp.MustCompile(`^[-+]?(0|[1-9][0-9_]*)$`)
+	hexPattern   = regexp.MustCompile(`^[-+]?0x[0-9a-fA-F_]+$`)
+	octPattern   = regexp.MustCompile(`^[-+]?0o?[0-7_]+$`)
+	floatPattern = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9][0-9_]*(\.[0-9_]*)?)([eE][-+]?[0-9]+)?$`)
+)
+
+// resolvePlain determines the type of a plain (unquoted) scalar the same way
+// YAML 1.1 does.
+func resolvePlain(s string) interface{} {
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil
+	case "true", "True", "TRUE", "yes", "Yes", "YES", "on", "On", "ON":
+		return true
+	case "false", "False", "FALSE", "no", "No", "NO", "off", "Off", "OFF":
+		return false
+	case ".inf", ".Inf", ".INF", "+.inf", "+.Inf", "+.INF":
+		return math.Inf(1)
+	case "-.inf", "-.Inf", "-.INF":
+		return math.Inf(-1)
+	case ".nan", ".NaN", ".NAN":
+		return math.NaN()
+	}
+	c := s[0]
+	if !(c >= '0' && c <= '9') && c != '-' && c != '+' && c != '.' {
+		return s
+	}
+	digits := strings.Replace(s, "_", "", -1)
+	switch {
+	case intPattern.MatchString(s):
+		if i, err := strconv.ParseInt(digits, 10, 64); err == nil {
+			return int(i)
+		}
+	case hexPattern.MatchString(s):
+		if i, err := strconv.ParseInt(strings.Replace(digits, "0x", "", 1), 16, 64); err == nil {
+			return int(i)
+		}
+	case octPattern.MatchString(s):
+		if i, err := strconv.ParseInt(strings.Replace(digits, "0o", "0", 1), 8, 64); err == nil {
+			return int(i)
+		}
+	}
+	if floatPattern.MatchString(s) {
+		if f, err := strconv.ParseFloat(digits, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+func isSeqEntry(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitMapEntry splits "key: value" into its key and value text.
+func splitMapEntry(text string) (string, string, bool) {
+	if len(text) == 0 {
+		return "", "", false
+	}
+	switch text[0] {
+	case '[', '{', '&', '*', '!', '|', '>', '#':
+		return "", "", false
+	case '"', '\'':
+		if !quoteClosed(text) {
+			return "", "", false
+		}
+		key, n, err := unquote(text)
+		if err != nil {
+			return "", "", false
+		}
+		rest := strings.TrimLeft(text[n:], " ")
+		if rest == ":" || strings.HasPrefix(rest, ": ") {
+			return key, strings.TrimSpace(rest[1:]), true
+		}
+		return "", "", false
+	}
+	if strings.HasPrefix(text, "- ") {
+		return "", "", false
+	}
+	for i := 0; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			key := strings.TrimSpace(text[:i])
+			if len(key) == 0 {
+				return "", "", false
+			}
+			return key, strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// splitToken splits off the first whitespace delimited token.
+func splitToken(text string) (string, string) {
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		return text[:i], strings.TrimSpace(text[i:])
+	}
+	return text, ""
+}
+
+// stripComment removes a trailing comment that is not part of a quoted scalar.
+func stripComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.IndexByte(" [{,:-", text[i-1]) >= 0 {
+				quote = c
+			}
+		case c == '#':
+			if i == 0 || text[i-1] == ' ' || text[i-1] == '\t' {
+				return strings.TrimRight(text[:i], " \t")
+			}
+		}
+	}
+	return text
+}
+
+// quoteClosed reports whether the quoted scalar starting text is terminated.
+func quoteClosed(text string) bool {
+	quote := text[0]
+	for i := 1; i < len(text); i++ {
+		switch {
+		case quote == '"' && text[i] == '\\':
+			i++
+		case text[i] == quote:
+			if quote == '\'' && i+1 < len(text) && text[i+1] == '\'' {
+				i++
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// unquote decodes the quoted scalar at the beginning of text and returns the
+// number of bytes consumed.
+func unquote(text string) (string, int, error) {
+	quote := text[0]
+	var buf strings.Builder
+	for i := 1; i < len(text); i++ {
+		c := text[i]
+		if quote == '\'' {
+			if c == '\'' {
+				if i+1 < len(text) && text[i+1] == '\'' {
+					buf.WriteByte('\'')
+					i++
+					continue
+				}
+				return buf.String(), i + 1, nil
+			}
+			buf.WriteByte(c)
+			continue
+		}
+		switch c {
+		case '"':
+			return buf.String(), i + 1, nil
+		case '\\':
+			i++
+			if i >= len(text) {
+				return "", 0, fmt.Errorf("invalid escape sequence")
+			}
+			switch text[i] {
+			case '0':
+				buf.WriteByte(0)
+			case 'a':
+				buf.WriteByte('\a')
+			case 'b':
+				buf.WriteByte('\b')
+			case 't', '\t':
+				buf.WriteByte('\t')
+			case 'n':
+				buf.WriteByte('\n')
+			case 'v':
+				buf.WriteByte('\v')
+			case 'f':
+				buf.WriteByte('\f')
+			case 'r':
+				buf.WriteByte('\r')
+			case 'e':
+				buf.WriteByte(0x1b)
+			case ' ', '"', '/', '\\':
+				buf.WriteByte(text[i])
+			case 'x', 'u', 'U':
+				n := map[byte]int{'x': 2, 'u': 4, 'U': 8}[text[i]]
+				if i+n >= len(text) {
+					return "", 0, fmt.Errorf("invalid escape sequence")
+				}
+				r, err := strconv.ParseUint(text[i+1:i+1+n], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("invalid escape sequence")
+				}
+				buf.WriteRune(rune(r))
+				i += n
+			default:
+				return "", 0, fmt.Errorf("invalid escape sequence '\\%c'", text[i])
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated quoted scalar")
+}
+
+// flowDepth returns the number of unclosed flow collections in text.
+func flowDepth(text string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+type flowParser struct {
+	p *parser
+	l *line
+	s string
+	i int
+}
+
+func (f *flowParser) skipSpaces() {
+	for f.i < len(f.s) && (f.s[f.i] == ' ' || f.s[f.i] == '\t') {
+		f.i++
+	}
+}
+
+func (f *flowParser) parse() (interface{}, error) {
+	f.skipSpaces()
+	if f.i >= len(f.s) {
+		return nil, f.p.errorf(f.l, "unexpected end of flow collection")
+	}
+	var tag, anchor string
+	for f.i < len(f.s) && (f.s[f.i] == '!' || f.s[f.i] == '&') {
+		start := f.i
+		for f.i < len(f.s) && strings.IndexByte(" ,]}", f.s[f.i]) < 0 {
+			f.i++
+		}
+		if f.s[start] == '!' {
+			tag = f.s[start:f.i]
+		} else {
+			anchor = f.s[start+1 : f.i]
+		}
+		f.skipSpaces()
+	}
+
+	var value interface{}
+	var err error
+	switch c := f.s[f.i]; c {
+	case '[':
+		value, err = f.parseList()
+	case '{':
+		value, err = f.parseMap()
+	case '*':
+		start := f.i + 1
+		for f.i < len(f.s) && strings.IndexByte(" ,]}", f.s[f.i]) < 0 {
+			f.i++
+		}
+		var ok bool
+		if value, ok = f.p.anchors[f.s[start:f.i]]; !ok {
+			return nil, f.p.errorf(f.l, "unknown anchor '%s'", f.s[start:f.i])
+		}
+	default:
+		var s string
+		var quoted bool
+		if s, quoted, err = f.parseScalar(); err == nil {
+			value, err = f.p.resolveScalar(f.l, tag, s, quoted)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if anchor != "" {
+		f.p.anchors[anchor] = value
+	}
+	return value, nil
+}
+
+func (f *flowParser) parseScalar() (string, bool, error) {
+	if c := f.s[f.i]; c == '"' || c == '\'' {
+		s, n, err := unquote(f.s[f.i:])
+		if err != nil {
+			return "", false, f.p.errorf(f.l, "%v", err)
+		}
+		f.i += n
+		return s, true, nil
+	}
+	start := f.i
+	for f.i < len(f.s) {
+		c := f.s[f.i]
+		if c == ',' || c == ']' || c == '}' || c == '[' || c == '{' {
+			break
+		}
+		if c == ':' && (f.i+1 == len(f.s) || strings.IndexByte(" ,]}", f.s[f.i+1]) >= 0) {
+			break
+		}
+		f.i++
+	}
+	return strings.TrimSpace(f.s[start:f.i]), false, nil
+}
+
+func (f *flowParser) parseList() (interface{}, error) {
+	f.i++ // [
+	list := []interface{}{}
+	for {
+		f.skipSpaces()
+		if f.i >= len(f.s) {
+			return nil, f.p.errorf(f.l, "unterminated flow sequence")
+		}
+		if f.s[f.i] == ']' {
+			f.i++
+			return list, nil
+		}
+		item, err := f.parse()
+		if err != nil {
+			return nil, err
+		}
+		f.skipSpaces()
+		if f.i < len(f.s) && f.s[f.i] == ':' {
+			// Single pair mapping inside a flow sequence.
+			f.i++
+			value, err := f.parse()
+			if err != nil {
+				return nil, err
+			}
+			item = map[string]interface{}{fmt.Sprint(item): value}
+			f.skipSpaces()
+		}
+		list = append(list, item)
+		if f.i < len(f.s) && f.s[f.i] == ',' {
+			f.i++
+		} else if f.i >= len(f.s) || f.s[f.i] != ']' {
+			return nil, f.p.errorf(f.l, "expected ',' or ']' in flow sequence")
+		}
+	}
+}
+
+func (f *flowParser) parseMap() (interface{}, error) {
+	f.i++ // {
+	m := make(map[string]interface{})
+	for {
+		f.skipSpaces()
+		if f.i >= len(f.s) {
+			return nil, f.p.errorf(f.l, "unterminated flow mapping")
+		}
+		if f.s[f.i] == '}' {
+			f.i++
+			return m, nil
+		}
+		key, _, err := f.parseScalar()
+		if err != nil {
+			return nil, err
+		}
+		f.skipSpaces()
+		var value interface{}
+		if f.i < len(f.s) && f.s[f.i] == ':' {
+			f.i++
+			f.skipSpaces()
+			if f.i < len(f.s) && f.s[f.i] != ',' && f.s[f.i] != '}' {
+				if value, err = f.parse(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if key == "<<" {
+			if err := merge(m, value); err != nil {
+				return nil, f.p.errorf(f.l, "%v", err)
+			}
+		} else {
+			m[key] = value
+		}
+		f.skipSpaces()
+		if f.i < len(f.s) && f.s[f.i] == ',' {
+			f.i++
+		} else if f.i >= len(f.s) || f.s[f.i] != '}' {
+			return nil, f.p.errorf(f.l, "expected ',' or '}' in flow mapping")
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package yaml
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Marshal encodes a generic value as a block style YAML document. Maps must
+// have string keys; they are written in sorted key order.
+func Marshal(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := emitNode(&buf, reflect.ValueOf(value), 0, false); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Interface || v.Kind() == reflect.Ptr) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+func isCollection(v reflect.Value) bool {
+	v = indirect(v)
+	if !v.IsValid() {
+		return false
+	}
+	switch v.Kind() {
+	case reflect.Map:
+		return v.Len() > 0
+	case reflect.Slice, reflect.Array:
+		return v.Len() > 0 && v.Type().Elem().Kind() != reflect.Uint8
+	}
+	return false
+}
+
+// emitNode writes v at the given indentation. If inline is true, the cursor is
+// already placed after a "- " sequence indicator.
+func emitNode(buf *bytes.Buffer, v reflect.Value, indent int, inline bool) error {
+	v = indirect(v)
+	if !isCollection(v) {
+		s, err := formatScalar(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(s)
+		buf.WriteByte('\n')
+		return nil
+	}
+
+	pad := strings.Repeat(" ", indent)
+	if v.Kind() == reflect.Map {
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("yaml: map key must be string")
+		}
+		keys := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			keys = append(keys, k.String())
+		}
+		sort.Strings(keys)
+		for i, k := range keys {
+			if i > 0 || !inline {
+				buf.WriteString(pad)
+			}
+			buf.WriteString(formatString(k))
+			buf.WriteByte(':')
+			item := indirect(v.MapIndex(reflect.ValueOf(k).Convert(v.Type().Key())))
+			if !isCollection(item) {
+				buf.WriteByte(' ')
+				if err := emitNode(buf, item, indent+2, false); err != nil {
+					return err
+				}
+				continue
+			}
+			buf.WriteByte('\n')
+			childIndent := indent + 2
+			if item.Kind() != reflect.Map {
+				// Sequences are not indented relative to their key.
+				childIndent = indent
+			}
+			if err := emitNode(buf, item, childIndent, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 || !inline {
+			buf.WriteString(pad)
+		}
+		buf.WriteString("- ")
+		if err := emitNode(buf, v.Index(i), indent+2, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatScalar(v reflect.Value) (string, error) {
+	if !v.IsValid() {
+		return "null", nil
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return "true", nil
+		}
+		return "false", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return formatFloat(v.Float()), nil
+	case reflect.String:
+		return formatString(v.String()), nil
+	case reflect.Map:
+		return "{}", nil
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			data := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(data), v)
+			return "!!binary " + base64.StdEncoding.EncodeToString(data), nil
+		}
+		return "[]", nil
+	}
+	return "", fmt.Errorf("yaml: unsupported type %s", v.Type())
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return ".inf"
+	case math.IsInf(f, -1):
+		return "-.inf"
+	case math.IsNaN(f):
+		return ".nan"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.Contains(s, ".") {
+		// Keep the value a float when it is read back.
+		if i := strings.IndexByte(s, 'e'); i >= 0 {
+			s = s[:i] + ".0" + s[i:]
+		} else {
+			s += ".0"
+		}
+	}
+	return s
+}
+
+func formatString(s string) string {
+	if needsQuotes(s) {
+		return quote(s)
+	}
+	return s
+}
+
+func needsQuotes(s string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	if _, ok := resolvePlain(s).(string); !ok {
+		return true
+	}
+	if strings.IndexByte("-?:,[]{}#&*!|>'\"%@` \t", s[0]) >= 0 {
+		return true
+	}
+	if s[len(s)-1] == ' ' || s[len(s)-1] == ':' {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return true
+	}
+	for _, r := range s {
+		if r < 0x20 || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+func quote(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&buf, `\x%02x`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
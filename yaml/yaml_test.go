@@ -0,0 +1,215 @@
+package yaml
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnmarshalScalars(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		want interface{}
+	}{
+		{"42", 42},
+		{"-7", -7},
+		{"0x1f", 31},
+		{"1_000", 1000},
+		{"3.14", 3.14},
+		{"1e-3", 0.001},
+		{".5", 0.5},
+		{"true", true},
+		{"No", false},
+		{"~", nil},
+		{"null", nil},
+		{"hello world", "hello world"},
+		{"'it''s'", "it's"},
+		{`"tab\there"`, "tab\there"},
+		{`"42"`, "42"},
+		{"!!str 42", "42"},
+		{"!!float 1", 1.0},
+		{"http://localhost:11311", "http://localhost:11311"},
+		{"1.2.3", "1.2.3"},
+	} {
+		got, err := Unmarshal([]byte(tc.text))
+		if err != nil {
+			t.Errorf("%q: %v", tc.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: expected %#v but %#v", tc.text, tc.want, got)
+		}
+	}
+
+	if f, err := Unmarshal([]byte("-.inf")); err != nil || !math.IsInf(f.(float64), -1) {
+		t.Errorf("-.inf: %v %v", f, err)
+	}
+}
+
+func TestUnmarshalBlock(t *testing.T) {
+	text := `
+# Robot configuration
+robot:
+  name: fetch   # trailing comment
+  joints:
+  - shoulder
+  - elbow
+  limits: {min: -1.5, max: 1.5}
+  sensors:
+    - type: laser
+      topic: /base_scan
+    - type: camera
+      topic: "/head_camera/rgb"
+      resolution: [640, 480]
+enabled: yes
+empty:
+description: |
+  first line
+  second line
+folded: >-
+  folded
+  text
+`
+	got, err := Unmarshal([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"robot": map[string]interface{}{
+			"name":   "fetch",
+			"joints": []interface{}{"shoulder", "elbow"},
+			"limits": map[string]interface{}{"min": -1.5, "max": 1.5},
+			"sensors": []interface{}{
+				map[string]interface{}{"type": "laser", "topic": "/base_scan"},
+				map[string]interface{}{"type": "camera", "topic": "/head_camera/rgb", "resolution": []interface{}{640, 480}},
+			},
+		},
+		"enabled":     true,
+		"empty":       nil,
+		"description": "first line\nsecond line\n",
+		"folded":      "folded text",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %#v but %#v", want, got)
+	}
+}
+
+func TestUnmarshalAnchors(t *testing.T) {
+	text := `
+defaults: &defaults
+  rate: 10
+  frame: base_link
+laser:
+  <<: *defaults
+  rate: 40
+list: [*defaults]
+`
+	got, err := Unmarshal([]byte(text))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := got.(map[string]interface{})
+	laser := m["laser"].(map[string]interface{})
+	if laser["rate"] != 40 || laser["frame"] != "base_link" {
+		t.Errorf("merge failed: %v", laser)
+	}
+	if !reflect.DeepEqual(m["list"], []interface{}{m["defaults"]}) {
+		t.Errorf("alias failed: %v", m["list"])
+	}
+}
+
+func TestUnmarshalTags(t *testing.T) {
+	tags := map[string]TagFunc{
+		"!degrees": func(raw string) (interface{}, error) {
+			f, err := strconv.ParseFloat(raw, 64)
+			return f * math.Pi / 180.0, err
+		},
+	}
+	got, err := UnmarshalWithTags([]byte("angle: !degrees 180\nlist: [!degrees 90]"), tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := got.(map[string]interface{})
+	if m["angle"] != math.Pi {
+		t.Errorf("expected pi but %v", m["angle"])
+	}
+	if m["list"].([]interface{})[0] != math.Pi/2 {
+		t.Errorf("expected pi/2 but %v", m["list"])
+	}
+
+	if _, err := Unmarshal([]byte("angle: !unknown 180")); err == nil {
+		t.Error("unknown tag accepted")
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	for _, text := range []string{
+		"a: 1\n   b: 2",
+		"a: [1, 2",
+		"a: \"unterminated",
+		"a: *missing",
+		"- a\nb: c",
+	} {
+		if _, err := Unmarshal([]byte(text)); err == nil {
+			t.Errorf("%q: error expected", text)
+		} else if _, ok := err.(*SyntaxError); !ok {
+			t.Errorf("%q: unexpected error type %T", text, err)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	value := map[string]interface{}{
+		"rate":    int32(10),
+		"gain":    2.0,
+		"name":    "base",
+		"numeric": "42",
+		"flag":    false,
+		"nothing": nil,
+		"list":    []interface{}{1, "two: 2", []interface{}{}},
+		"nested": map[string]interface{}{
+			"points": []interface{}{
+				map[string]interface{}{"x": 1.5, "y": -2.0},
+			},
+			"empty": map[string]interface{}{},
+		},
+		"data": []byte("abc"),
+	}
+	data, err := Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Join([]string{
+		"data: !!binary YWJj",
+		"flag: false",
+		"gain: 2.0",
+		"list:",
+		"- 1",
+		`- "two: 2"`,
+		"- []",
+		"name: base",
+		"nested:",
+		"  empty: {}",
+		"  points:",
+		"  - x: 1.5",
+		"    y: -2.0",
+		"nothing: null",
+		`numeric: "42"`,
+		"rate: 10",
+		"",
+	}, "\n")
+	if string(data) != expected {
+		t.Errorf("expected\n%s\nbut\n%s", expected, data)
+	}
+
+	decoded, err := Unmarshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := decoded.(map[string]interface{})
+	if m["numeric"] != "42" || m["gain"] != 2.0 || m["rate"] != 10 || string(m["data"].([]byte)) != "abc" {
+		t.Errorf("round trip failed: %#v", m)
+	}
+}